@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"redisx/internal/cluster"
+)
+
+const clusterUsage = `usage:
+  redisx cluster rebalance [-pipeline n] [-timeout d] [-wait d] [-dry-run] <host:port>
+      move slots between the nodes of a running cluster until each serves the same number of slots;
+      first waits until every slot is assigned and every node has seen the whole cluster`
+
+// runCluster 实现 redisx cluster rebalance：连接集群中任一节点，在节点之间在线
+// 迁移槽，使各节点服务的槽数量均衡
+func runCluster(args []string) error {
+	if len(args) == 0 || args[0] != "rebalance" {
+		return fmt.Errorf("%s", clusterUsage)
+	}
+	fs := flag.NewFlagSet("rebalance", flag.ContinueOnError)
+	pipeline := fs.Int("pipeline", 10, "number of keys moved by each MIGRATE")
+	timeout := fs.Duration("timeout", 5*time.Second, "connection and MIGRATE timeout")
+	wait := fs.Duration("wait", 10*time.Second, "how long to wait for the cluster to be ready")
+	dryRun := fs.Bool("dry-run", false, "print the planned moves without moving slots")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 1 {
+		return fmt.Errorf("%s", clusterUsage)
+	}
+	opt := cluster.RebalanceOptions{Pipeline: *pipeline, Timeout: *timeout, Wait: *wait, DryRun: *dryRun}
+	if !*dryRun {
+		opt.Progress = func(m cluster.Move) {
+			fmt.Printf("moved slot %d: %s -> %s\n", m.Slot, m.From.Addr, m.To.Addr)
+		}
+	}
+	moves, err := cluster.Rebalance(fs.Arg(0), opt)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, m := range moves {
+			fmt.Printf("slot %d: %s -> %s\n", m.Slot, m.From.Addr, m.To.Addr)
+		}
+		fmt.Printf("rebalance: %d slots to move\n", len(moves))
+	} else {
+		fmt.Printf("rebalance: %d slots moved\n", len(moves))
+	}
+	return nil
+}
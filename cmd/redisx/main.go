@@ -1,13 +1,181 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"redisx/internal/protocol"
 	"redisx/internal/server"
 )
 
+const serverUsage = `usage:
+  redisx [-bind host:port ...] [-no-tcp] [-unixsocket path] [-unixsocketperm mode]
+         [-proto-max-bulk-len bytes] [-max-multibulk-len n]
+         [-appendonly] [-appendfilename file] [-appendfsync always|everysec|no]
+         [-min-replicas-to-write n] [-min-replicas-max-lag seconds]
+         [-cluster-enabled] [-cluster-node-timeout ms]
+         [-raft] [-raft-dir dir] [-raft-addr host:port] [-raft-bus-addr host:port] [-raft-timeout d]
+         [-raft-snapshot-threshold n]
+         [-requirepass password] [-aclfile path]
+         [-tls-cert-file path -tls-key-file path] [-tls-ca-cert-file path] [-tls-addr host:port]
+         [-tls-auth-clients yes|no|optional] [-tls-min-version 1.2|1.3] [-tls-ciphers list]
+         [-tls-client-cert-user]
+      run the server; without -bind or -no-tcp it listens on :6379. With TLS and no -tls-addr, the
+      TCP addresses only accept TLS; SIGHUP reloads the TLS certificates
+  redisx rdb ...
+  redisx cluster ...
+  redisx sentinel ...`
+
 func main() {
-	s := server.NewServer(":6379")
+	if len(os.Args) > 1 && os.Args[1] == "rdb" {
+		if err := runRDB(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cluster" {
+		if err := runCluster(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sentinel" {
+		if err := runSentinel(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	s, err := newServer(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s.TLSCertFile != "" {
+		go reloadTLSOnHangup(s)
+	}
 	if err := s.Start(); err != nil {
 		log.Fatalf("server failed: %v", err)
 	}
 }
+
+// reloadTLSOnHangup 收到 SIGHUP 时重新加载 TLS 证书，用于证书轮换
+func reloadTLSOnHangup(s *server.Server) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		if err := s.ReloadTLS(); err != nil {
+			log.Printf("reload tls: %v", err)
+			continue
+		}
+		log.Print("tls certificates reloaded")
+	}
+}
+
+// newServer 按命令行参数创建服务器
+func newServer(args []string) (*server.Server, error) {
+	fs := flag.NewFlagSet("redisx", flag.ContinueOnError)
+	var binds []string
+	fs.Func("bind", "TCP address to listen on (repeatable)", func(v string) error {
+		binds = append(binds, v)
+		return nil
+	})
+	noTCP := fs.Bool("no-tcp", false, "do not listen on TCP, e.g. to only listen on -unixsocket")
+	unixSocket := fs.String("unixsocket", "", "unix socket path to listen on")
+	unixSocketPerm := fs.String("unixsocketperm", "", "permissions of the unix socket in octal, e.g. 700")
+	protoMaxBulkLen := fs.Int("proto-max-bulk-len", protocol.DefaultMaxBulkLen, "maximum length in bytes of a request argument, 0 disables the limit")
+	maxMultibulkLen := fs.Int("max-multibulk-len", protocol.DefaultMaxMultibulkLen, "maximum number of arguments in a request, 0 disables the limit")
+	appendOnly := fs.Bool("appendonly", false, "log write commands to the append only file")
+	appendFilename := fs.String("appendfilename", "", "append only file path")
+	appendFsync := fs.String("appendfsync", "", "fsync policy of the append only file: always, everysec or no")
+	minReplicas := fs.Int("min-replicas-to-write", 0, "reject writes with fewer online replicas than this")
+	minReplicasLag := fs.Int("min-replicas-max-lag", 10, "seconds since its last ack for a replica to count as online")
+	clusterEnabled := fs.Bool("cluster-enabled", false, "run as a cluster node")
+	clusterNodeTimeout := fs.Int("cluster-node-timeout", 15000, "milliseconds before an unresponsive node is marked as failing")
+	raftEnabled := fs.Bool("raft", false, "replicate writes through the Raft log")
+	raftDir := fs.String("raft-dir", "", "directory of the Raft log and snapshots")
+	raftAddr := fs.String("raft-addr", "", "address other Raft nodes use to reach this node (default 127.0.0.1 and the listening port)")
+	raftBusAddr := fs.String("raft-bus-addr", "", "address the Raft peer RPCs are served on; expose it only to the other nodes (default the listening port + 10000)")
+	raftTimeout := fs.Duration("raft-timeout", 0, "Raft election timeout (default 1s)")
+	raftSnapshot := fs.Uint64("raft-snapshot-threshold", 1024, "Raft log entries before a snapshot is taken, 0 disables snapshots")
+	requirePass := fs.String("requirepass", "", "password of the default user")
+	aclFile := fs.String("aclfile", "", "ACL file loaded at startup and used by ACL SAVE/LOAD")
+	tlsCertFile := fs.String("tls-cert-file", "", "TLS certificate file; enables TLS together with -tls-key-file")
+	tlsKeyFile := fs.String("tls-key-file", "", "TLS private key file")
+	tlsCAFile := fs.String("tls-ca-cert-file", "", "CA certificates used to verify client certificates")
+	tlsAddr := fs.String("tls-addr", "", "separate address for TLS connections; the other addresses stay plaintext")
+	tlsAuthClients := fs.String("tls-auth-clients", "yes", "client certificates: yes, no or optional")
+	tlsMinVersion := fs.String("tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3")
+	tlsCiphers := fs.String("tls-ciphers", "", "colon separated TLS 1.2 cipher suites")
+	tlsClientCertUser := fs.Bool("tls-client-cert-user", false, "authenticate clients as the ACL user named by their certificate CN")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return nil, fmt.Errorf("%s", serverUsage)
+	}
+	switch {
+	case *noTCP && len(binds) > 0:
+		return nil, fmt.Errorf("-no-tcp cannot be combined with -bind")
+	case *noTCP:
+		binds = []string{""}
+	case len(binds) == 0:
+		binds = []string{":6379"}
+	}
+	s := server.NewServer(binds[0])
+	s.BindAddrs = binds[1:]
+	s.UnixSocket = *unixSocket
+	if *unixSocketPerm != "" {
+		perm, err := strconv.ParseUint(*unixSocketPerm, 8, 32)
+		if err != nil || perm > 0o777 {
+			return nil, fmt.Errorf("invalid unix socket permissions %q", *unixSocketPerm)
+		}
+		s.UnixSocketPerm = os.FileMode(perm)
+	}
+	if *protoMaxBulkLen < 0 || *maxMultibulkLen < 0 {
+		return nil, fmt.Errorf("invalid protocol limits %d/%d", *protoMaxBulkLen, *maxMultibulkLen)
+	}
+	s.ProtoMaxBulkLen = *protoMaxBulkLen
+	s.MaxMultibulkLen = *maxMultibulkLen
+	// 未指定的参数保留 NewServer 的默认值
+	s.AppendOnly = *appendOnly
+	if *appendFilename != "" {
+		s.AppendFilename = *appendFilename
+	}
+	if *appendFsync != "" {
+		s.AppendFsync = *appendFsync
+	}
+	if *minReplicas < 0 || *minReplicasLag < 0 {
+		return nil, fmt.Errorf("invalid min-replicas settings %d/%d", *minReplicas, *minReplicasLag)
+	}
+	s.MinReplicasToWrite = *minReplicas
+	s.MinReplicasMaxLag = time.Duration(*minReplicasLag) * time.Second
+	if *clusterNodeTimeout <= 0 {
+		return nil, fmt.Errorf("invalid cluster-node-timeout %d", *clusterNodeTimeout)
+	}
+	s.ClusterEnabled = *clusterEnabled
+	s.ClusterNodeTimeout = time.Duration(*clusterNodeTimeout) * time.Millisecond
+	s.RaftEnabled = *raftEnabled
+	if *raftDir != "" {
+		s.RaftDir = *raftDir
+	}
+	s.RaftAddr = *raftAddr
+	s.RaftBusAddr = *raftBusAddr
+	if *raftTimeout < 0 {
+		return nil, fmt.Errorf("invalid raft-timeout %s", *raftTimeout)
+	}
+	if *raftTimeout > 0 {
+		s.RaftTimeout = *raftTimeout
+	}
+	s.RaftSnapshotThreshold = *raftSnapshot
+	s.RequirePass = *requirePass
+	s.ACLFile = *aclFile
+	s.TLSCertFile, s.TLSKeyFile, s.TLSCAFile = *tlsCertFile, *tlsKeyFile, *tlsCAFile
+	s.TLSAddr = *tlsAddr
+	s.TLSAuthClients = *tlsAuthClients
+	s.TLSMinVersion = *tlsMinVersion
+	s.TLSCipherSuites = *tlsCiphers
+	s.TLSClientCertUser = *tlsClientCertUser
+	return s, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"redisx/internal/rdb"
+	"redisx/internal/storage"
+)
+
+const rdbUsage = `usage:
+  redisx rdb import <dump.rdb> <redisx.snap>   convert a Redis RDB file into a redisX snapshot
+  redisx rdb export <redisx.snap> <dump.rdb>   convert a redisX snapshot into a Redis RDB file`
+
+// runRDB 实现 redisx rdb import|export，在 Redis 的 RDB 文件与 redisX 快照之间转换
+func runRDB(args []string) error {
+	if len(args) != 3 || (args[0] != "import" && args[0] != "export") {
+		return fmt.Errorf("%s", rdbUsage)
+	}
+	src, dst := args[1], args[2]
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	store := storage.NewStorage()
+	var st rdb.Stats
+	switch args[0] {
+	case "import":
+		if st, err = rdb.Load(in, store); err != nil {
+			return fmt.Errorf("read %s: %w", src, err)
+		}
+		sn := store.Snapshot()
+		defer sn.Release()
+		err = writeFile(dst, func(f *os.File) error {
+			_, err := sn.WriteTo(f)
+			return err
+		})
+	default: // export
+		if _, err = store.LoadSnapshot(in); err != nil {
+			return fmt.Errorf("read %s: %w", src, err)
+		}
+		sn := store.Snapshot()
+		defer sn.Release()
+		err = writeFile(dst, func(f *os.File) error {
+			st, err = rdb.Write(f, sn)
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", dst, err)
+	}
+	fmt.Printf("%s: %d keys written to %s (%d expired, %d skipped)\n", args[0], st.Keys, dst, st.Expired, st.Skipped)
+	return nil
+}
+
+// writeFile 写入 path 的临时文件并在成功后重命名，失败时不留下不完整的文件
+func writeFile(path string, write func(*os.File) error) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
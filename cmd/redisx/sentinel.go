@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/sentinel"
+)
+
+const sentinelUsage = `usage:
+  redisx sentinel [-addr host:port] [-down-after d] [-failover-timeout d] -monitor name,host:port,quorum ...
+      monitor masters and their replicas and fail over automatically when a master is down`
+
+// monitorFlag 为 -monitor name,host:port,quorum，可以重复
+type monitorFlag struct {
+	name, host string
+	port       int
+	quorum     int
+}
+
+func parseMonitor(v string) (monitorFlag, error) {
+	f := strings.Split(v, ",")
+	if len(f) != 3 {
+		return monitorFlag{}, fmt.Errorf("expected name,host:port,quorum")
+	}
+	host, portStr, err := net.SplitHostPort(f[1])
+	if err != nil {
+		return monitorFlag{}, err
+	}
+	port, err1 := strconv.Atoi(portStr)
+	quorum, err2 := strconv.Atoi(f[2])
+	if err1 != nil || err2 != nil {
+		return monitorFlag{}, fmt.Errorf("invalid port or quorum in %q", v)
+	}
+	return monitorFlag{name: f[0], host: host, port: port, quorum: quorum}, nil
+}
+
+// runSentinel 实现 redisx sentinel：监控主节点及其副本，主节点下线时与其他
+// sentinel 协商后自动故障转移
+func runSentinel(args []string) error {
+	fs := flag.NewFlagSet("sentinel", flag.ContinueOnError)
+	addr := fs.String("addr", ":26379", "listen address")
+	downAfter := fs.Duration("down-after", 30*time.Second, "time without a valid reply before an instance is considered down")
+	failoverTimeout := fs.Duration("failover-timeout", 3*time.Minute, "failover timeout")
+	var monitors []monitorFlag
+	fs.Func("monitor", "master to monitor as name,host:port,quorum (repeatable)", func(v string) error {
+		m, err := parseMonitor(v)
+		if err == nil {
+			monitors = append(monitors, m)
+		}
+		return err
+	})
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return fmt.Errorf("%s", sentinelUsage)
+	}
+	s := sentinel.NewSentinel(*addr)
+	s.DownAfter, s.FailoverTimeout = *downAfter, *failoverTimeout
+	for _, m := range monitors {
+		if err := s.Monitor(m.name, m.host, m.port, m.quorum); err != nil {
+			return err
+		}
+	}
+	return s.Start()
+}
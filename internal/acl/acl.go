@@ -0,0 +1,338 @@
+// Package acl 实现 Redis 风格的访问控制：用户、密码（以 SHA-256 保存）、允许执行
+// 的命令与命令类别、可访问的键模式与频道模式，以及拒绝记录（ACL LOG）与 ACL 文件。
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUser 为新连接自动认证的用户，也是只带密码的 AUTH 所认证的用户
+const DefaultUser = "default"
+
+// 拒绝原因，即 ACL LOG 的 reason 字段
+const (
+	ReasonAuth    = "auth"
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+	ReasonChannel = "channel"
+)
+
+var (
+	// ErrAuth 表示用户名或密码错误，或者用户被禁用
+	ErrAuth = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	// ErrDefaultUser 表示试图删除默认用户
+	ErrDefaultUser = errors.New("The 'default' user cannot be removed")
+)
+
+const (
+	// logMaxLen 为 ACL LOG 保留的最大条目数
+	logMaxLen = 128
+	// logGroupWindow 内相同的拒绝合并为一条，只增加计数
+	logGroupWindow = 60 * time.Second
+)
+
+// LogEntry is an ACL LOG entry.
+type LogEntry struct {
+	ID         int64
+	Count      int
+	Reason     string
+	Context    string
+	Object     string
+	Username   string
+	ClientInfo string
+	Created    time.Time
+	Updated    time.Time
+}
+
+// ACL holds the users and the log of denied commands and authentications.
+type ACL struct {
+	mu     sync.RWMutex
+	users  map[string]*User
+	log    []*LogEntry // 最新的在前
+	nextID int64
+}
+
+// New returns an ACL with only the default user, which is enabled, has no
+// password and may run every command on every key and channel.
+func New() *ACL {
+	a := &ACL{users: map[string]*User{}}
+	a.users[DefaultUser] = defaultUser()
+	return a
+}
+
+func defaultUser() *User {
+	u := newUser(DefaultUser)
+	for _, r := range []string{"on", "nopass", "allkeys", "allchannels", "+@all"} {
+		_ = u.apply(r)
+	}
+	return u
+}
+
+// SetUser creates the user if needed and applies rules in order. Either all
+// rules apply or none does.
+func (a *ACL) SetUser(name string, rules ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, ok := a.users[name]
+	if !ok {
+		u = newUser(name)
+	}
+	c := u.clone()
+	for _, r := range rules {
+		if err := c.apply(r); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %v", r, err)
+		}
+	}
+	// 原地更新规则，已认证为该用户的连接立即使用新规则；name 不变，连接可以
+	// 不加锁读取
+	c.deleted = false
+	u.userRules = c.userRules
+	a.users[name] = u
+	return nil
+}
+
+// DelUser deletes users and returns how many existed. Connections
+// authenticated as a deleted user must authenticate again.
+func (a *ACL) DelUser(names ...string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, ErrDefaultUser
+		}
+	}
+	n := 0
+	for _, name := range names {
+		if u, ok := a.users[name]; ok {
+			u.deleted = true
+			delete(a.users, name)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Default returns the default user if new connections are authenticated as
+// it automatically (it is enabled and has no password), or nil.
+func (a *ACL) Default() *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if u := a.users[DefaultUser]; u.enabled && u.nopass {
+		return u
+	}
+	return nil
+}
+
+// Authenticate returns the user if the password is valid for it.
+func (a *ACL) Authenticate(name, password string) (*User, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u, ok := a.users[name]
+	if !ok || !u.enabled || !u.checkPassword(password) {
+		return nil, ErrAuth
+	}
+	return u, nil
+}
+
+// Lookup returns the user if it exists and is enabled, or nil. It
+// authenticates without a password, e.g. by the CN of a TLS client
+// certificate.
+func (a *ACL) Lookup(name string) *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if u, ok := a.users[name]; ok && u.enabled {
+		return u
+	}
+	return nil
+}
+
+// Valid reports whether u still exists; connections authenticated as a
+// deleted user are no longer authenticated.
+func (a *ACL) Valid(u *User) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return !u.deleted
+}
+
+// Check returns why u may not run the command, or "" if it may. name must be
+// upper case. object is the denied command, key or channel.
+func (a *ACL) Check(u *User, name string, args [][]byte) (reason, object string) {
+	if !knownCommands[name] {
+		// 未知命令由分派时报告
+		return "", ""
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return u.check(name, args)
+}
+
+// UserInfo is the result of ACL GETUSER.
+type UserInfo struct {
+	Flags     []string
+	Passwords []string
+	Commands  string
+	Keys      string
+	Channels  string
+}
+
+// GetUser describes a user; ok is false if it does not exist.
+func (a *ACL) GetUser(name string) (info UserInfo, ok bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u, ok := a.users[name]
+	if !ok {
+		return UserInfo{}, false
+	}
+	return UserInfo{
+		Flags:     u.flags(),
+		Passwords: append([]string(nil), u.passwords...),
+		Commands:  u.commandsRule(),
+		Keys:      u.keysRule(),
+		Channels:  strings.TrimPrefix(u.channelsRule(), "resetchannels"),
+	}, true
+}
+
+// Users returns the user names, sorted.
+func (a *ACL) Users() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns one "user <name> <rules>" line per user, sorted by name; the
+// same format is used by the ACL file.
+func (a *ACL) List() []string {
+	names := a.Users()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		if u, ok := a.users[name]; ok {
+			lines = append(lines, "user "+name+" "+u.describe())
+		}
+	}
+	return lines
+}
+
+// Log records a denial. Denials with the same reason, context, object and
+// user within a minute of each other are counted in one entry.
+func (a *ACL) Log(reason, context, object, username, clientInfo string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, e := range a.log {
+		if e.Reason == reason && e.Context == context && e.Object == object && e.Username == username &&
+			now.Sub(e.Updated) < logGroupWindow {
+			e.Count++
+			e.Updated, e.ClientInfo = now, clientInfo
+			return
+		}
+	}
+	e := &LogEntry{ID: a.nextID, Count: 1, Reason: reason, Context: context, Object: object,
+		Username: username, ClientInfo: clientInfo, Created: now, Updated: now}
+	a.nextID++
+	a.log = append([]*LogEntry{e}, a.log...)
+	if len(a.log) > logMaxLen {
+		a.log = a.log[:logMaxLen]
+	}
+}
+
+// Entries returns up to n log entries, newest first; n < 0 returns all.
+func (a *ACL) Entries(n int) []LogEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if n < 0 || n > len(a.log) {
+		n = len(a.log)
+	}
+	out := make([]LogEntry, n)
+	for i := range out {
+		out[i] = *a.log[i]
+	}
+	return out
+}
+
+// ResetLog clears the log.
+func (a *ACL) ResetLog() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.log = nil
+}
+
+// Save writes the users to path atomically, one line per user.
+func (a *ACL) Save(path string) error {
+	var b strings.Builder
+	for _, line := range a.List() {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load replaces the users with those defined in path. The file is validated
+// as a whole: on error the current users are kept. A file that does not
+// define the default user gets the initial default user. Users that exist
+// before and after the load are updated in place.
+func (a *ACL) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users := map[string]*User{}
+	sc := bufio.NewScanner(f)
+	for lineno := 1; sc.Scan(); lineno++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: line should start with user keyword", path, lineno)
+		}
+		name := fields[1]
+		if _, dup := users[name]; dup {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", path, lineno, name)
+		}
+		u := newUser(name)
+		for _, r := range fields[2:] {
+			if err := u.apply(r); err != nil {
+				return fmt.Errorf("%s:%d: Error in user declaration '%s': %v", path, lineno, r, err)
+			}
+		}
+		users[name] = u
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if users[DefaultUser] == nil {
+		users[DefaultUser] = defaultUser()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name, old := range a.users {
+		if u, ok := users[name]; ok {
+			old.userRules = u.userRules
+			users[name] = old
+		} else {
+			old.deleted = true
+		}
+	}
+	a.users = users
+	return nil
+}
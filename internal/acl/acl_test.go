@@ -0,0 +1,191 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"redisx/internal/protocol"
+)
+
+func TestRules(t *testing.T) {
+	a := New()
+	if err := a.SetUser("alice", "on", ">secret", "~cache:*", "&news.*", "+@read", "-hgetall", "+set"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := a.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate("alice", "wrong"); err != ErrAuth {
+		t.Fatalf("wrong password: %v", err)
+	}
+	tests := []struct {
+		cmd            []string
+		reason, object string
+	}{
+		{[]string{"GET", "cache:1"}, "", ""},
+		{[]string{"SET", "cache:1", "v"}, "", ""},
+		{[]string{"GET", "other"}, ReasonKey, "other"},
+		{[]string{"MGET", "cache:1", "x"}, ReasonKey, "x"},
+		{[]string{"HGETALL", "cache:h"}, ReasonCommand, "hgetall"},
+		{[]string{"DEL", "cache:1"}, ReasonCommand, "del"},
+		{[]string{"PUBLISH", "news.tech", "m"}, ReasonCommand, "publish"},
+	}
+	for _, tt := range tests {
+		reason, object := a.Check(u, tt.cmd[0], protocol.Args(tt.cmd[1:]))
+		if reason != tt.reason || object != tt.object {
+			t.Errorf("%v: got %q %q, want %q %q", tt.cmd, reason, object, tt.reason, tt.object)
+		}
+	}
+
+	// 修改规则后原有的 *User 立即生效
+	if err := a.SetUser("alice", "+@pubsub"); err != nil {
+		t.Fatal(err)
+	}
+	if reason, _ := a.Check(u, "PUBLISH", protocol.Args([]string{"news.tech", "m"})); reason != "" {
+		t.Fatalf("PUBLISH after +@pubsub denied: %s", reason)
+	}
+	if reason, obj := a.Check(u, "SUBSCRIBE", protocol.Args([]string{"news.tech", "sports"})); reason != ReasonChannel || obj != "sports" {
+		t.Fatalf("SUBSCRIBE sports: %s %s", reason, obj)
+	}
+	if reason, _ := a.Check(u, "PSUBSCRIBE", protocol.Args([]string{"news.*"})); reason != "" {
+		t.Fatal("PSUBSCRIBE with the exact pattern denied")
+	}
+	if reason, _ := a.Check(u, "PSUBSCRIBE", protocol.Args([]string{"news.t*"})); reason != ReasonChannel {
+		t.Fatal("PSUBSCRIBE with a narrower pattern allowed")
+	}
+
+	// 规则出错时整体不生效
+	if err := a.SetUser("alice", "-@all", "+nosuchcommand"); err == nil || !strings.Contains(err.Error(), "'+nosuchcommand'") {
+		t.Fatalf("unknown command: %v", err)
+	}
+	if reason, _ := a.Check(u, "GET", protocol.Args([]string{"cache:1"})); reason != "" {
+		t.Fatal("failed SETUSER modified the user")
+	}
+
+	if err := a.SetUser("alice", "off"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate("alice", "secret"); err != ErrAuth {
+		t.Fatalf("disabled user authenticated: %v", err)
+	}
+	if n, err := a.DelUser("alice", "nobody"); n != 1 || err != nil || a.Valid(u) {
+		t.Fatalf("DelUser = %d, %v", n, err)
+	}
+	if _, err := a.DelUser(DefaultUser); err != ErrDefaultUser {
+		t.Fatalf("deleting the default user: %v", err)
+	}
+}
+
+func TestDefaultUser(t *testing.T) {
+	a := New()
+	if u := a.Default(); u == nil || !u.NoPass() {
+		t.Fatal("new connections should be authenticated as the default user")
+	}
+	if err := a.SetUser(DefaultUser, ">pass"); err != nil {
+		t.Fatal(err)
+	}
+	if a.Default() != nil || a.Lookup(DefaultUser).NoPass() {
+		t.Fatal("default user with a password should require AUTH")
+	}
+	if _, err := a.Authenticate(DefaultUser, "pass"); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := a.GetUser(DefaultUser)
+	want := UserInfo{Flags: []string{"on"}, Passwords: []string{HashPassword("pass")}, Commands: "+@all", Keys: "~*", Channels: "&*"}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("GetUser = %+v, want %+v", info, want)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	a := New()
+	if err := a.SetUser("bob", "on", "#"+HashPassword("pw"), "~a*", "~b*", "+@all", "-@dangerous"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetUser("carol", "off"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"user bob on #" + HashPassword("pw") + " ~a* ~b* resetchannels +@all -@dangerous",
+		"user carol off resetchannels -@all",
+		"user default on nopass ~* &* +@all",
+	}
+	if got := a.List(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("List =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	path := filepath.Join(t.TempDir(), "users.acl")
+	if err := a.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New()
+	if err := b.SetUser("dave", "on", "nopass"); err != nil {
+		t.Fatal(err)
+	}
+	dave, _ := b.Authenticate("dave", "")
+	if err := b.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.List(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("List after Load =\n%s", strings.Join(got, "\n"))
+	}
+	if b.Valid(dave) {
+		t.Fatal("user missing from the file should be deleted")
+	}
+
+	// 文件有错误时保留原有用户
+	if err := os.WriteFile(path, []byte("user eve on +nosuchcommand\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Load(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Fatalf("Load of an invalid file: %v", err)
+	}
+	if len(b.Users()) != 3 {
+		t.Fatalf("users after a failed load: %v", b.Users())
+	}
+}
+
+func TestLog(t *testing.T) {
+	a := New()
+	a.Log(ReasonCommand, "toplevel", "get", "alice", "addr=1")
+	a.Log(ReasonCommand, "toplevel", "get", "alice", "addr=2")
+	a.Log(ReasonAuth, "toplevel", "AUTH", "bob", "addr=3")
+	entries := a.Entries(-1)
+	if len(entries) != 2 || entries[0].Reason != ReasonAuth || entries[1].Count != 2 || entries[1].ClientInfo != "addr=2" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if len(a.Entries(1)) != 1 {
+		t.Fatal("Entries(1) should return one entry")
+	}
+	a.ResetLog()
+	if len(a.Entries(-1)) != 0 {
+		t.Fatal("log not reset")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	read, _ := CategoryCommands("read")
+	write, _ := CategoryCommands("write")
+	has := func(list []string, s string) bool {
+		for _, x := range list {
+			if x == s {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(read, "get") || has(read, "set") || !has(write, "set") || has(write, "get") {
+		t.Fatalf("read = %v\nwrite = %v", read, write)
+	}
+	if _, ok := CategoryCommands("nosuch"); ok {
+		t.Fatal("unknown category")
+	}
+	dangerous, _ := CategoryCommands("dangerous")
+	if !has(dangerous, "acl") || !has(dangerous, "info") {
+		t.Fatalf("dangerous = %v", dangerous)
+	}
+}
@@ -0,0 +1,99 @@
+package acl
+
+import (
+	"sort"
+	"strings"
+
+	"redisx/internal/command"
+)
+
+// categoryCommands 为各命令类别包含的命令；read 与 write 由 command.IsWrite 推导
+// （见 init），all 包含全部命令
+var categoryCommands = map[string][]string{
+	"keyspace": {"DEL", "EXISTS", "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "EXPIRETIME",
+		"PEXPIRETIME", "TTL", "PTTL", "PERSIST", "DUMP", "RESTORE", "RESTORE-ASKING", "MIGRATE"},
+	"string": {"SET", "GET", "INCR", "MGET"},
+	"hash": {"HSET", "HMSET", "HSETNX", "HGET", "HMGET", "HDEL", "HEXISTS", "HLEN", "HSTRLEN",
+		"HKEYS", "HVALS", "HGETALL", "HINCRBY", "HINCRBYFLOAT", "HRANDFIELD"},
+	"list": {"LPUSH", "RPUSH", "LPUSHX", "RPUSHX", "LPOP", "RPOP", "LLEN", "LRANGE", "LINDEX",
+		"LSET", "LINSERT", "LREM", "LTRIM", "LPOS", "LMOVE", "RPOPLPUSH", "LMPOP",
+		"BLPOP", "BRPOP", "BLMOVE", "BLMPOP"},
+	"set": {"SADD", "SREM", "SISMEMBER", "SMISMEMBER", "SMEMBERS", "SCARD", "SPOP",
+		"SRANDMEMBER", "SMOVE", "SINTER", "SUNION", "SDIFF", "SINTERSTORE", "SUNIONSTORE",
+		"SDIFFSTORE", "SINTERCARD"},
+	"sortedset": {"ZADD", "ZINCRBY", "ZREM", "ZCARD", "ZSCORE", "ZMSCORE", "ZRANK", "ZREVRANK",
+		"ZRANGE", "ZRANGESTORE", "ZCOUNT", "ZLEXCOUNT", "ZPOPMIN", "ZPOPMAX", "ZUNIONSTORE",
+		"ZINTERSTORE", "ZDIFFSTORE", "BZPOPMIN", "BZPOPMAX"},
+	"stream": {"XADD", "XTRIM", "XLEN", "XRANGE", "XREVRANGE", "XDEL", "XGROUP", "XACK",
+		"XPENDING", "XCLAIM", "XAUTOCLAIM", "XINFO", "XREAD", "XREADGROUP"},
+	"pubsub": {"PUBLISH", "SPUBLISH", "PUBSUB", "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE",
+		"UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE"},
+	"transaction": {"MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH"},
+	"connection":  {"PING", "QUIT", "AUTH", "HELLO", "ASKING", "WAIT"},
+	"blocking":    {"BLPOP", "BRPOP", "BLMOVE", "BLMPOP", "BZPOPMIN", "BZPOPMAX", "XREAD", "XREADGROUP", "WAIT"},
+	"admin": {"SAVE", "BGSAVE", "LASTSAVE", "BGREWRITEAOF", "REPLICAOF", "SLAVEOF", "REPLCONF",
+		"PSYNC", "SYNC", "CLUSTER", "ACL", "RAFT", "CONFIG"},
+	// dangerous 另外包含 admin 的全部命令
+	"dangerous": {"INFO", "MIGRATE", "RESTORE", "RESTORE-ASKING"},
+}
+
+// categories 为类别到命令集合的映射
+var categories = map[string]map[string]bool{}
+
+// knownCommands 为 ACL 规则可以引用的命令
+var knownCommands = map[string]bool{}
+
+func init() {
+	for _, name := range command.Commands() {
+		knownCommands[name] = true
+	}
+	for cat, names := range categoryCommands {
+		set := make(map[string]bool, len(names))
+		for _, name := range names {
+			set[name] = true
+		}
+		categories[cat] = set
+	}
+	for name := range categories["admin"] {
+		categories["dangerous"][name] = true
+	}
+	read, write, all := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for name := range knownCommands {
+		all[name] = true
+		if command.IsWrite(name) {
+			write[name] = true
+		}
+	}
+	for _, cat := range []string{"keyspace", "string", "hash", "list", "set", "sortedset", "stream"} {
+		for name := range categories[cat] {
+			if !write[name] {
+				read[name] = true
+			}
+		}
+	}
+	categories["read"], categories["write"], categories["all"] = read, write, all
+}
+
+// Categories returns the names of the command categories, sorted.
+func Categories() []string {
+	names := make([]string, 0, len(categories))
+	for cat := range categories {
+		names = append(names, cat)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CategoryCommands returns the lower-case names of the commands in a
+// category, sorted; ok is false if the category does not exist.
+func CategoryCommands(cat string) (names []string, ok bool) {
+	set, ok := categories[strings.ToLower(cat)]
+	if !ok {
+		return nil, false
+	}
+	for name := range set {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names, true
+}
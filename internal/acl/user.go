@@ -0,0 +1,336 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+	"redisx/internal/pubsub"
+)
+
+// User 为一个 ACL 用户。name 创建后不再改变，可以不加锁读取；userRules 由
+// ACL.mu 保护，ACL 修改用户时原地替换它，已认证为该用户的连接立即按新的规则检查。
+type User struct {
+	name string
+	userRules
+}
+
+// userRules 为用户的规则与状态
+type userRules struct {
+	enabled bool
+	nopass  bool
+	// passwords 为密码的 SHA-256（小写十六进制），按添加顺序
+	passwords []string
+
+	// commands 为允许执行的命令；cmdRules 为描述它的规则（+@all 或 -@all 之后的
+	// 增删），用于 ACL LIST 与 ACL 文件
+	commands map[string]bool
+	cmdRules []string
+
+	keys        []string
+	allKeys     bool
+	channels    []string
+	allChannels bool
+
+	// deleted 表示用户已被删除，认证为该用户的连接需要重新认证
+	deleted bool
+}
+
+// newUser 返回新用户的初始状态：禁用、无密码、无任何权限
+func newUser(name string) *User {
+	return &User{name: name, userRules: userRules{commands: map[string]bool{}}}
+}
+
+// Name returns the user name.
+func (u *User) Name() string { return u.name }
+
+// NoPass reports whether the user accepts any password (the nopass rule).
+// It does not take the ACL lock; servers use ACL.Default instead.
+func (u *User) NoPass() bool { return u.nopass }
+
+// HashPassword returns the SHA-256 of a password as stored in ACL rules.
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+var errSyntax = errors.New("Syntax error")
+
+// clone 返回用户规则的副本，SETUSER 在副本上应用规则，全部成功后才生效
+func (u *User) clone() *User {
+	c := *u
+	c.passwords = slices.Clone(u.passwords)
+	c.commands = maps.Clone(u.commands)
+	c.cmdRules = slices.Clone(u.cmdRules)
+	c.keys = slices.Clone(u.keys)
+	c.channels = slices.Clone(u.channels)
+	return &c
+}
+
+// apply 应用一条规则，语法与 Redis 的 ACL SETUSER 相同
+func (u *User) apply(rule string) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+		return nil
+	case "off":
+		u.enabled = false
+		return nil
+	case "nopass":
+		u.nopass, u.passwords = true, nil
+		return nil
+	case "resetpass":
+		u.nopass, u.passwords = false, nil
+		return nil
+	case "allkeys":
+		u.keys, u.allKeys = []string{"*"}, true
+		return nil
+	case "resetkeys":
+		u.keys, u.allKeys = nil, false
+		return nil
+	case "allchannels":
+		u.channels, u.allChannels = []string{"*"}, true
+		return nil
+	case "resetchannels":
+		u.channels, u.allChannels = nil, false
+		return nil
+	case "allcommands":
+		return u.apply("+@all")
+	case "nocommands":
+		return u.apply("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			_ = u.apply(r)
+		}
+		return nil
+	}
+	if rule == "" {
+		return errSyntax
+	}
+	switch rule[0] {
+	case '>':
+		u.addPassword(HashPassword(rule[1:]))
+	case '<':
+		u.removePassword(HashPassword(rule[1:]))
+	case '#':
+		if !validHash(rule[1:]) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.addPassword(rule[1:])
+	case '!':
+		if !validHash(rule[1:]) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.removePassword(rule[1:])
+	case '~':
+		if u.allKeys {
+			return fmt.Errorf("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+		}
+		if rule == "~*" {
+			u.keys, u.allKeys = []string{"*"}, true
+		} else if !slices.Contains(u.keys, rule[1:]) {
+			u.keys = append(u.keys, rule[1:])
+		}
+	case '&':
+		if u.allChannels {
+			return fmt.Errorf("Adding a pattern after the * pattern (or the 'allchannels' flag) is not valid and does not have any effect. Try 'resetchannels' to start with an empty list of channels")
+		}
+		if rule == "&*" {
+			u.channels, u.allChannels = []string{"*"}, true
+		} else if !slices.Contains(u.channels, rule[1:]) {
+			u.channels = append(u.channels, rule[1:])
+		}
+	case '+', '-':
+		return u.applyCommandRule(rule[0] == '+', lower[1:])
+	default:
+		return errSyntax
+	}
+	return nil
+}
+
+// applyCommandRule 处理 +cmd、-cmd、+@category 与 -@category
+func (u *User) applyCommandRule(allow bool, name string) error {
+	var names map[string]bool
+	if cat, ok := strings.CutPrefix(name, "@"); ok {
+		if names = categories[cat]; names == nil {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if cat == "all" {
+			// +@all 与 -@all 重置命令规则
+			clear(u.commands)
+			u.cmdRules = nil
+			if allow {
+				maps.Copy(u.commands, names)
+				u.cmdRules = []string{"+@all"}
+			}
+			return nil
+		}
+	} else {
+		if !knownCommands[strings.ToUpper(name)] {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		names = map[string]bool{strings.ToUpper(name): true}
+	}
+	for n := range names {
+		if allow {
+			u.commands[n] = true
+		} else {
+			delete(u.commands, n)
+		}
+	}
+	sign := "-"
+	if allow {
+		sign = "+"
+	}
+	u.cmdRules = append(u.cmdRules, sign+name)
+	return nil
+}
+
+func validHash(h string) bool {
+	if len(h) != 64 {
+		return false
+	}
+	for _, c := range h {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (u *User) addPassword(hash string) {
+	if !slices.Contains(u.passwords, hash) {
+		u.passwords = append(u.passwords, hash)
+	}
+	u.nopass = false
+}
+
+func (u *User) removePassword(hash string) {
+	u.passwords = slices.DeleteFunc(u.passwords, func(h string) bool { return h == hash })
+}
+
+// checkPassword 报告 password 能否认证为该用户（不检查是否启用）
+func (u *User) checkPassword(password string) bool {
+	return u.nopass || slices.Contains(u.passwords, HashPassword(password))
+}
+
+// commandsRule 返回命令规则的描述
+func (u *User) commandsRule() string {
+	if len(u.cmdRules) > 0 && u.cmdRules[0] == "+@all" {
+		return strings.Join(u.cmdRules, " ")
+	}
+	return strings.Join(append([]string{"-@all"}, u.cmdRules...), " ")
+}
+
+func (u *User) keysRule() string {
+	rules := make([]string, len(u.keys))
+	for i, k := range u.keys {
+		rules[i] = "~" + k
+	}
+	return strings.Join(rules, " ")
+}
+
+func (u *User) channelsRule() string {
+	if len(u.channels) == 0 {
+		return "resetchannels"
+	}
+	rules := make([]string, len(u.channels))
+	for i, ch := range u.channels {
+		rules[i] = "&" + ch
+	}
+	return strings.Join(rules, " ")
+}
+
+// describe 返回用户的完整规则（不含 "user <name>"），与 ACL LIST 和 ACL 文件的
+// 格式相同；按此应用到新用户上得到相同的用户
+func (u *User) describe() string {
+	parts := []string{"off"}
+	if u.enabled {
+		parts[0] = "on"
+	}
+	if u.nopass {
+		parts = append(parts, "nopass")
+	}
+	for _, h := range u.passwords {
+		parts = append(parts, "#"+h)
+	}
+	if k := u.keysRule(); k != "" {
+		parts = append(parts, k)
+	}
+	parts = append(parts, u.channelsRule(), u.commandsRule())
+	return strings.Join(parts, " ")
+}
+
+// flags 返回 ACL GETUSER 的 flags
+func (u *User) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// check 返回执行命令被拒绝的原因与对象；允许执行时 reason 为空。参数只在需要
+// 检查键或频道时才转换为字符串
+func (u *User) check(name string, argv [][]byte) (reason, object string) {
+	if !u.commands[name] {
+		return ReasonCommand, strings.ToLower(name)
+	}
+	if u.allKeys && u.allChannels {
+		return "", ""
+	}
+	args := protocol.ArgStrings(argv)
+	if !u.allKeys {
+		for _, k := range command.Keys(name, args) {
+			if !matchAny(u.keys, k) {
+				return ReasonKey, k
+			}
+		}
+	}
+	if !u.allChannels {
+		for _, ch := range channelArgs(name, args) {
+			if !matchAny(u.channels, ch) {
+				return ReasonChannel, ch
+			}
+		}
+		if name == "PSUBSCRIBE" {
+			// 模式订阅只允许订阅与规则完全相同的模式
+			for _, p := range args {
+				if !slices.Contains(u.channels, p) {
+					return ReasonChannel, p
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// channelArgs 返回命令访问的频道
+func channelArgs(name string, args []string) []string {
+	switch name {
+	case "PUBLISH", "SPUBLISH":
+		return args[:min(len(args), 1)]
+	case "SUBSCRIBE", "SSUBSCRIBE":
+		return args
+	}
+	return nil
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if pubsub.Match(p, s) {
+			return true
+		}
+	}
+	return false
+}
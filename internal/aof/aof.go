@@ -0,0 +1,280 @@
+// Package aof 实现追加写日志（append-only file）：成功执行的写命令以 RESP 格式
+// 追加到文件末尾，启动时按顺序重放。BGREWRITEAOF 以数据集快照作为文件前导
+// （格式同 SAVE 的快照文件）重写日志，重写期间的新命令追加在快照之后。
+package aof
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redisx/internal/storage"
+)
+
+// FsyncPolicy 为 appendfsync 策略
+type FsyncPolicy int
+
+const (
+	// FsyncEverySec 每秒在后台 fsync 一次，宕机时最多丢失约一秒的写入
+	FsyncEverySec FsyncPolicy = iota
+	// FsyncAlways 每次追加后立即 fsync，回复客户端前数据已落盘
+	FsyncAlways
+	// FsyncNo 不主动 fsync，由操作系统决定何时刷盘
+	FsyncNo
+)
+
+// ParseFsyncPolicy parses an appendfsync value (always, everysec or no).
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec", "":
+		return FsyncEverySec, nil
+	case "no":
+		return FsyncNo, nil
+	}
+	return 0, fmt.Errorf("invalid appendfsync policy %q", s)
+}
+
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncAlways:
+		return "always"
+	case FsyncNo:
+		return "no"
+	}
+	return "everysec"
+}
+
+// ErrRewriteInProgress 表示已有重写在进行
+var ErrRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// Log 为打开的 AOF。Append 的调用顺序即命令在文件中的顺序，调用方需保证它与
+// 命令的执行顺序一致。
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	policy   FsyncPolicy
+	f        *os.File
+	size     int64  // 当前文件大小
+	baseSize int64  // 最近一次打开或重写完成时的文件大小
+	pending  []byte // 尚未成功写入文件的数据，写入失败时保留以便重试
+	unsynced bool   // 有已写入但尚未 fsync 的数据
+	err      error  // 最近一次写入或 fsync 的错误，成功写入后清除
+	rewrite  *bytes.Buffer
+	done     chan struct{}
+}
+
+// Open opens (creating if necessary) the AOF at path for appending and
+// starts the background goroutine that fsyncs once per second under the
+// everysec policy and retries failed writes.
+func Open(path string, policy FsyncPolicy) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l := &Log{path: path, policy: policy, f: f, size: fi.Size(), baseSize: fi.Size(), done: make(chan struct{})}
+	go l.loop()
+	return l, nil
+}
+
+// Path returns the file path of the log.
+func (l *Log) Path() string { return l.path }
+
+// Policy returns the fsync policy of the log.
+func (l *Log) Policy() FsyncPolicy { return l.policy }
+
+func (l *Log) loop() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			l.mu.Lock()
+			if err := l.flushLocked(l.policy != FsyncNo); err != nil {
+				log.Printf("AOF write failed: %v", err)
+			}
+			l.mu.Unlock()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Append appends cmds in RESP format. Under the always policy the data is
+// fsynced before Append returns. On failure the data is kept and retried in
+// the background; the error is also reported by Err until a write succeeds.
+func (l *Log) Append(cmds ...[]string) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start := len(l.pending)
+	for _, cmd := range cmds {
+		l.pending = AppendCommand(l.pending, cmd)
+	}
+	if l.rewrite != nil {
+		l.rewrite.Write(l.pending[start:])
+	}
+	return l.flushLocked(l.policy == FsyncAlways)
+}
+
+// flushLocked 写出 pending，sync 为 true 时随后 fsync；调用方需持有 mu
+func (l *Log) flushLocked(sync bool) error {
+	if len(l.pending) > 0 {
+		n, err := l.f.Write(l.pending)
+		if err != nil {
+			// 截掉写了一半的命令，整段数据留待重试；无法截断时只保留未写出的部分
+			if n > 0 {
+				if terr := l.f.Truncate(l.size); terr != nil {
+					l.size += int64(n)
+					l.pending = l.pending[n:]
+				}
+			}
+			l.err = err
+			return err
+		}
+		l.size += int64(n)
+		l.pending = l.pending[:0]
+		l.unsynced = true
+	}
+	if sync && l.unsynced {
+		if err := l.f.Sync(); err != nil {
+			l.err = err
+			return err
+		}
+		l.unsynced = false
+	}
+	l.err = nil
+	return nil
+}
+
+// Err returns the error of the last failed write or fsync, or nil once data
+// has been written successfully again.
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Size returns the current size of the file and its size right after it was
+// opened or last rewritten.
+func (l *Log) Size() (current, base int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size + int64(len(l.pending)), l.baseSize
+}
+
+// Close flushes and fsyncs pending data and closes the file.
+func (l *Log) Close() error {
+	close(l.done)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.flushLocked(true)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// BeginRewrite starts a rewrite: from now on appended commands are also
+// buffered for the rewritten file. The caller must take the snapshot passed
+// to Rewrite at the same point in the command stream, i.e. while no write
+// command can execute.
+func (l *Log) BeginRewrite() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rewrite != nil {
+		return ErrRewriteInProgress
+	}
+	l.rewrite = new(bytes.Buffer)
+	return nil
+}
+
+// Rewrite writes sn followed by the commands appended since BeginRewrite to
+// a temporary file, then atomically replaces the log with it. Appends only
+// wait for the final copy of the buffered commands, not for the snapshot.
+func (l *Log) Rewrite(sn *storage.Snapshot) error {
+	err := l.rewriteFile(sn)
+	if err != nil {
+		l.mu.Lock()
+		l.rewrite = nil
+		l.mu.Unlock()
+	}
+	return err
+}
+
+func (l *Log) rewriteFile(sn *storage.Snapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".rewrite-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := sn.WriteTo(tmp); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := tmp.Write(l.rewrite.Bytes()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		// 新文件已就位但无法追加：保留旧句柄会写入已被替换的文件，只能报告错误
+		l.err = err
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f.Close()
+	// 未写出的 pending 已包含在重写缓冲中
+	l.f, l.size, l.baseSize = f, fi.Size(), fi.Size()
+	l.pending, l.unsynced, l.err, l.rewrite = l.pending[:0], false, nil, nil
+	return nil
+}
+
+// Rewriting reports whether a rewrite is in progress.
+func (l *Log) Rewriting() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rewrite != nil
+}
+
+// AppendCommand appends cmd encoded as a RESP array of bulk strings to buf.
+func AppendCommand(buf []byte, cmd []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(cmd)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, a := range cmd {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, a...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
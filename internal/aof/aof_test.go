@@ -0,0 +1,133 @@
+package aof
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// replay 将 AOF 重放到新的 Storage
+func replay(t *testing.T, data []byte) (*storage.Storage, int, int64, error) {
+	t.Helper()
+	r := command.NewRouter()
+	r.RegisterBytes("SET", command.Set)
+	r.Register("INCR", command.Incr)
+	r.Register("RPUSH", command.RPush)
+	store := storage.NewStorage()
+	n, valid, err := Load(bytes.NewReader(data), store, func(cmd string, args []string) error {
+		if _, handled, err := r.Handle(cmd, store, protocol.Args(args)); !handled || err != nil {
+			t.Fatalf("cannot apply %s %v: %v", cmd, args, err)
+		}
+		return nil
+	})
+	return store, n, valid, err
+}
+
+func TestLoadTruncated(t *testing.T) {
+	var buf []byte
+	buf = AppendCommand(buf, []string{"SET", "a", "1"})
+	buf = AppendCommand(buf, []string{"INCR", "a"})
+	complete := len(buf)
+
+	store, n, valid, err := replay(t, buf)
+	if err != nil || n != 2 || valid != int64(complete) {
+		t.Fatalf("unexpected result n=%d valid=%d err=%v", n, valid, err)
+	}
+	if v, _ := store.Get("a"); string(v) != "2" {
+		t.Fatalf("expected 2, got %q", v)
+	}
+
+	// 末尾不完整的命令
+	_, n, valid, err = replay(t, append(append([]byte(nil), buf...), "*2\r\n$4\r\nINCR\r\n$1"...))
+	if !errors.Is(err, ErrTruncated) || n != 2 || valid != int64(complete) {
+		t.Fatalf("expected truncation at %d, got n=%d valid=%d err=%v", complete, n, valid, err)
+	}
+
+	// 未以 EXEC 结束的事务整体丢弃
+	tx := AppendCommand(append([]byte(nil), buf...), []string{"MULTI"})
+	tx = AppendCommand(tx, []string{"INCR", "a"})
+	store, _, valid, err = replay(t, tx)
+	if !errors.Is(err, ErrTruncated) || valid != int64(complete) {
+		t.Fatalf("expected unfinished transaction to be dropped, valid=%d err=%v", valid, err)
+	}
+	if v, _ := store.Get("a"); string(v) != "2" {
+		t.Fatalf("unfinished transaction must not be applied, got %q", v)
+	}
+
+	if _, _, _, err := replay(t, append(append([]byte(nil), buf...), "garbage\r\n"...)); err == nil || errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	l, err := Open(path, FsyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	store := storage.NewStorage()
+	for i := 0; i < 10; i++ {
+		store.IncrBy("n", 1)
+		l.Append([]string{"INCR", "n"})
+	}
+	store.RPush("l", []string{"a", "b"})
+	l.Append([]string{"RPUSH", "l", "a", "b"})
+
+	if err := l.BeginRewrite(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.BeginRewrite(); !errors.Is(err, ErrRewriteInProgress) {
+		t.Fatalf("expected ErrRewriteInProgress, got %v", err)
+	}
+	sn := store.Snapshot()
+	// 重写期间追加的命令写在快照之后
+	l.Append([]string{"SET", "after", "x"})
+	if err := l.Rewrite(sn); err != nil {
+		t.Fatal(err)
+	}
+	sn.Release()
+	l.Append([]string{"INCR", "n"})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, base := l.Size(); current != int64(len(data)) || base >= current {
+		t.Fatalf("unexpected sizes current=%d base=%d file=%d", current, base, len(data))
+	}
+	r, n, _, err := replay(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 commands after the preamble, got %d", n)
+	}
+	if v, _ := r.Get("n"); string(v) != "11" {
+		t.Fatalf("expected n=11, got %q", v)
+	}
+	if v, _ := r.Get("after"); string(v) != "x" {
+		t.Fatalf("expected write during rewrite, got %q", v)
+	}
+	if l, _ := r.LRange("l", 0, -1); len(l) != 2 {
+		t.Fatalf("expected list from preamble, got %v", l)
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, s := range []string{"always", "everysec", "no"} {
+		p, err := ParseFsyncPolicy(s)
+		if err != nil || p.String() != s {
+			t.Fatalf("%s: got %v %v", s, p, err)
+		}
+	}
+	if _, err := ParseFsyncPolicy("sometimes"); err == nil {
+		t.Fatal("expected error for invalid policy")
+	}
+}
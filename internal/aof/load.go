@@ -0,0 +1,104 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// ErrTruncated 表示 AOF 末尾有不完整的命令或未提交的事务（通常是写入过程中宕机）
+var ErrTruncated = errors.New("truncated append only file")
+
+// countingReader 记录从底层读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Load replays the AOF read from r. A snapshot preamble written by a rewrite
+// is loaded into store; the commands that follow are passed to apply in
+// order, and commands between MULTI and EXEC are only applied once EXEC is
+// read. It returns the number of commands applied and the offset just past
+// the last complete command or transaction. If the file ends in the middle
+// of one, the error is ErrTruncated and the caller may truncate the file to
+// that offset; any other error means the file is corrupt.
+func Load(r io.Reader, store *storage.Storage, apply func(cmd string, args []string) error) (n int, valid int64, err error) {
+	cr := &countingReader{r: r}
+	br := bufio.NewReader(cr)
+	offset := func() int64 { return cr.n - int64(br.Buffered()) }
+
+	b, err := br.Peek(1)
+	if err == io.EOF {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if b[0] != '*' {
+		// 快照前导；LoadSnapshot 直接使用 br，不会读过快照末尾
+		if _, err := store.LoadSnapshot(br); err != nil {
+			return 0, 0, fmt.Errorf("load AOF preamble: %w", err)
+		}
+		valid = offset()
+	}
+
+	var multi [][]string
+	inMulti := false
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, valid, err
+		}
+		if b[0] != '*' {
+			return n, valid, fmt.Errorf("bad AOF format at offset %d", offset())
+		}
+		cmd, args, err := protocol.ParseRequest(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, valid, ErrTruncated
+		}
+		if err != nil {
+			return n, valid, fmt.Errorf("bad AOF format at offset %d: %v", offset(), err)
+		}
+		switch strings.ToUpper(cmd) {
+		case "MULTI":
+			inMulti, multi = true, nil
+			continue
+		case "EXEC":
+			for _, c := range multi {
+				if err := apply(c[0], c[1:]); err != nil {
+					return n, valid, err
+				}
+				n++
+			}
+			inMulti, multi = false, nil
+		default:
+			if inMulti {
+				multi = append(multi, append([]string{cmd}, args...))
+				continue
+			}
+			if err := apply(cmd, args); err != nil {
+				return n, valid, err
+			}
+			n++
+		}
+		valid = offset()
+	}
+	if inMulti {
+		return n, valid, ErrTruncated
+	}
+	return n, valid, nil
+}
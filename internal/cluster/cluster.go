@@ -0,0 +1,572 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownNode 表示命令引用了节点表中不存在的节点
+	ErrUnknownNode = errors.New("ERR I don't know about node")
+	// ErrBadNodes 表示无法解析对端返回的 CLUSTER NODES
+	ErrBadNodes = errors.New("malformed CLUSTER NODES reply")
+)
+
+// bitmap 记录节点声明的槽
+type bitmap [Slots / 64]uint64
+
+func (b *bitmap) has(slot int) bool { return b[slot/64]&(1<<(slot%64)) != 0 }
+func (b *bitmap) set(slot int)      { b[slot/64] |= 1 << (slot % 64) }
+func (b *bitmap) clear(slot int)    { b[slot/64] &^= 1 << (slot % 64) }
+
+// node 为节点表中的一个节点
+type node struct {
+	id    string
+	host  string
+	port  int
+	epoch uint64
+	// slots 为该节点自己声明的槽（本节点之外的节点以其最近一次的 CLUSTER NODES 为准）
+	slots bitmap
+	// handshake 表示 MEET 之后尚未与对方交换过信息，id 为临时生成的
+	handshake bool
+	// pong 为最近一次成功交换信息的时间；linked 表示最近一次交换是否成功
+	pong   time.Time
+	linked bool
+}
+
+func (n *node) addr() string { return net.JoinHostPort(n.host, strconv.Itoa(n.port)) }
+
+// Peer identifies another node to exchange information with.
+type Peer struct {
+	ID   string
+	Addr string
+}
+
+// SlotInfo describes how a slot is served as seen by this node.
+type SlotInfo struct {
+	// Owner 为服务该槽的节点地址，空表示未分配
+	Owner string
+	Mine  bool
+	// Migrating 为该槽迁出的目标节点地址（本节点拥有该槽时）
+	Migrating string
+	// Importing 表示本节点正在从其他节点导入该槽
+	Importing bool
+}
+
+// SlotRange is a run of consecutive slots served by the same node.
+type SlotRange struct {
+	Start, End int
+	ID         string
+	Host       string
+	Port       int
+}
+
+// State 为本节点所见的集群状态，可并发使用
+type State struct {
+	mu      sync.RWMutex
+	myself  *node
+	nodes   map[string]*node
+	owner   [Slots]*node
+	epoch   uint64 // currentEpoch：所见过的最大配置纪元
+	timeout time.Duration
+	// migrating/importing 为迁移中的槽及对端节点
+	migrating map[int]*node
+	importing map[int]*node
+}
+
+// New creates the state of a fresh node listening on host:port with a new
+// random node ID. Nodes that have not been heard of for nodeTimeout are
+// flagged as possibly failing.
+func New(host string, port int, nodeTimeout time.Duration) *State {
+	me := &node{id: newID(), host: host, port: port, linked: true}
+	return &State{
+		myself:    me,
+		nodes:     map[string]*node{me.id: me},
+		timeout:   nodeTimeout,
+		migrating: make(map[int]*node),
+		importing: make(map[int]*node),
+	}
+}
+
+func newID() string {
+	var b [20]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// MyID returns the ID of this node.
+func (st *State) MyID() string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.myself.id
+}
+
+// SetMyHost sets the address other nodes and clients use to reach this node.
+func (st *State) SetMyHost(host string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.myself.host = host
+}
+
+// Slot returns how slot is served.
+func (st *State) Slot(slot int) SlotInfo {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var info SlotInfo
+	if n := st.owner[slot]; n != nil {
+		info.Owner, info.Mine = n.addr(), n == st.myself
+	}
+	if n := st.migrating[slot]; n != nil {
+		info.Migrating = n.addr()
+	}
+	info.Importing = st.importing[slot] != nil
+	return info
+}
+
+// OK reports whether every slot is served by some node.
+func (st *State) OK() bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	for _, n := range st.owner {
+		if n == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Meet adds the node at host:port; its ID becomes known on the next
+// information exchange.
+func (st *State) Meet(host string, port int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	for _, n := range st.nodes {
+		if n.addr() == addr {
+			return
+		}
+	}
+	n := &node{id: newID(), host: host, port: port, handshake: true}
+	st.nodes[n.id] = n
+}
+
+// Peers returns the other nodes to exchange information with.
+func (st *State) Peers() []Peer {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var peers []Peer
+	for _, n := range st.nodes {
+		if n != st.myself {
+			peers = append(peers, Peer{ID: n.id, Addr: n.addr()})
+		}
+	}
+	return peers
+}
+
+// AddSlots assigns the slots to this node. Every slot must be unassigned.
+func (st *State) AddSlots(slots []int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	seen := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		if st.owner[slot] != nil {
+			return fmt.Errorf("ERR Slot %d is already busy", slot)
+		}
+		if seen[slot] {
+			return fmt.Errorf("ERR Slot %d specified multiple times", slot)
+		}
+		seen[slot] = true
+	}
+	for _, slot := range slots {
+		st.myself.slots.set(slot)
+		delete(st.importing, slot)
+	}
+	st.updateOwners()
+	return nil
+}
+
+// DelSlots marks the slots as unassigned in this node's view.
+func (st *State) DelSlots(slots []int) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, slot := range slots {
+		if st.owner[slot] == nil {
+			return fmt.Errorf("ERR Slot %d is already unassigned", slot)
+		}
+	}
+	for _, slot := range slots {
+		st.owner[slot].slots.clear(slot)
+		delete(st.migrating, slot)
+		delete(st.importing, slot)
+	}
+	st.updateOwners()
+	return nil
+}
+
+// SetSlot implements CLUSTER SETSLOT <slot> MIGRATING|IMPORTING|NODE <id>
+// and STABLE (id is ignored). Assigning a slot to this node with NODE bumps
+// its configuration epoch so that the new ownership wins over the old one.
+func (st *State) SetSlot(slot int, action, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	action = strings.ToUpper(action)
+	if action == "STABLE" {
+		delete(st.migrating, slot)
+		delete(st.importing, slot)
+		return nil
+	}
+	n := st.nodes[id]
+	if n == nil || n.handshake {
+		return fmt.Errorf("%w %s", ErrUnknownNode, id)
+	}
+	switch action {
+	case "MIGRATING":
+		if st.owner[slot] != st.myself {
+			return fmt.Errorf("ERR I'm not the owner of hash slot %d", slot)
+		}
+		if n == st.myself {
+			return errors.New("ERR I'm already the owner of this slot")
+		}
+		st.migrating[slot] = n
+	case "IMPORTING":
+		if n == st.myself {
+			return fmt.Errorf("ERR I'm already the owner of hash slot %d", slot)
+		}
+		st.importing[slot] = n
+	case "NODE":
+		delete(st.migrating, slot)
+		delete(st.importing, slot)
+		if owner := st.owner[slot]; owner != nil {
+			owner.slots.clear(slot)
+		}
+		n.slots.set(slot)
+		if n == st.myself && st.owner[slot] != st.myself {
+			st.epoch++
+			st.myself.epoch = st.epoch
+		}
+		st.owner[slot] = n
+		st.updateSlot(slot, st.nodeList())
+	default:
+		return errors.New("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	return nil
+}
+
+// updateOwners 根据各节点声明的槽与纪元重新计算槽的归属：多个节点声明同一个槽
+// 时纪元大者胜出，纪元相同时保留原归属。本节点失去的槽不再声明。调用方需持有写锁。
+func (st *State) updateOwners() {
+	nodes := st.nodeList()
+	for slot := range st.owner {
+		st.updateSlot(slot, nodes)
+	}
+}
+
+// nodeList 返回全部节点并更新 currentEpoch。每个槽都要遍历全部节点，转为切片
+// 避免 16384 次 map 迭代。调用方需持有写锁。
+func (st *State) nodeList() []*node {
+	nodes := make([]*node, 0, len(st.nodes))
+	for _, n := range st.nodes {
+		st.epoch = max(st.epoch, n.epoch)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// updateSlot 重新计算单个槽的归属（规则见 updateOwners）；调用方需持有写锁
+func (st *State) updateSlot(slot int, nodes []*node) {
+	best := st.owner[slot]
+	if best != nil && !best.slots.has(slot) {
+		best = nil
+	}
+	for _, n := range nodes {
+		if n.slots.has(slot) && (best == nil || n.epoch > best.epoch) {
+			best = n
+		}
+	}
+	st.owner[slot] = best
+	if best != st.myself {
+		if st.myself.slots.has(slot) {
+			st.myself.slots.clear(slot)
+		}
+		if len(st.migrating) > 0 {
+			delete(st.migrating, slot)
+		}
+	} else if len(st.importing) > 0 {
+		delete(st.importing, slot)
+	}
+}
+
+// Unreachable records a failed information exchange with node id.
+func (st *State) Unreachable(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if n := st.nodes[id]; n != nil {
+		n.linked = false
+	}
+}
+
+// Merge updates the state with the CLUSTER NODES output of the peer that was
+// known as id. The line flagged "myself" describes the peer and is trusted
+// for its own slots and epoch; other lines only introduce unknown nodes.
+// It reports whether the peer already knows this node.
+func (st *State) Merge(id, nodes string) (knowsMe bool, err error) {
+	type line struct {
+		id, host  string
+		port      int
+		epoch     uint64
+		myself    bool
+		handshake bool
+		slots     []string
+	}
+	var lines []line
+	for _, text := range strings.Split(strings.TrimSpace(nodes), "\n") {
+		f := strings.Fields(text)
+		if len(f) < 8 {
+			return false, ErrBadNodes
+		}
+		addr, _, _ := strings.Cut(f[1], "@")
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return false, ErrBadNodes
+		}
+		l := line{id: f[0], host: host, slots: f[8:]}
+		if l.port, err = strconv.Atoi(port); err != nil {
+			return false, ErrBadNodes
+		}
+		if l.epoch, err = strconv.ParseUint(f[6], 10, 64); err != nil {
+			return false, ErrBadNodes
+		}
+		for _, flag := range strings.Split(f[2], ",") {
+			l.myself = l.myself || flag == "myself"
+			l.handshake = l.handshake || flag == "handshake"
+		}
+		lines = append(lines, l)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	peer := st.nodes[id]
+	if peer == nil {
+		return false, fmt.Errorf("%w %s", ErrUnknownNode, id)
+	}
+	for _, l := range lines {
+		switch {
+		case l.myself:
+			if l.id == st.myself.id {
+				// MEET 了自己的地址
+				delete(st.nodes, id)
+				return true, nil
+			}
+			if l.id != peer.id {
+				// 握手完成（或节点 ID 变化）：以对方声明的 ID 记录
+				delete(st.nodes, peer.id)
+				if known := st.nodes[l.id]; known != nil {
+					peer = known
+				} else {
+					peer.id = l.id
+					st.nodes[l.id] = peer
+				}
+			}
+			peer.port, peer.epoch, peer.handshake = l.port, l.epoch, false
+			peer.pong, peer.linked = time.Now(), true
+			peer.slots = bitmap{}
+			for _, r := range l.slots {
+				if strings.HasPrefix(r, "[") {
+					continue // 对方的迁移状态
+				}
+				lo, hi, ok := parseRange(r)
+				if !ok {
+					return false, ErrBadNodes
+				}
+				for slot := lo; slot <= hi; slot++ {
+					peer.slots.set(slot)
+				}
+			}
+		case l.id == st.myself.id:
+			knowsMe = true
+		case !l.handshake && st.nodes[l.id] == nil:
+			if !st.knownAddr(net.JoinHostPort(l.host, strconv.Itoa(l.port))) {
+				st.nodes[l.id] = &node{id: l.id, host: l.host, port: l.port}
+			}
+		}
+	}
+	st.updateOwners()
+	return knowsMe, nil
+}
+
+// knownAddr 报告是否已有节点使用该地址（例如尚在握手中的节点）
+func (st *State) knownAddr(addr string) bool {
+	for _, n := range st.nodes {
+		if n.addr() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange 解析 "lo-hi" 或单个槽
+func parseRange(s string) (int, int, bool) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	a, err1 := strconv.Atoi(lo)
+	b, err2 := strconv.Atoi(hi)
+	if err1 != nil || err2 != nil || a < 0 || b >= Slots || a > b {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// sortedNodes 按 ID 排序返回节点；调用方需持有锁
+func (st *State) sortedNodes() []*node {
+	nodes := make([]*node, 0, len(st.nodes))
+	for _, n := range st.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes
+}
+
+// ranges 返回 n 服务的连续槽区间；调用方需持有锁
+func (st *State) ranges(n *node) [][2]int {
+	var out [][2]int
+	for slot := 0; slot < Slots; slot++ {
+		if st.owner[slot] != n {
+			continue
+		}
+		if k := len(out); k > 0 && out[k-1][1] == slot-1 {
+			out[k-1][1] = slot
+		} else {
+			out = append(out, [2]int{slot, slot})
+		}
+	}
+	return out
+}
+
+// Nodes returns the node table in the CLUSTER NODES format. The cluster bus
+// port equals the client port: nodes exchange information over the client
+// protocol.
+func (st *State) Nodes() string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var b strings.Builder
+	now := time.Now()
+	for _, n := range st.sortedNodes() {
+		flags, link, pong := "master", "connected", int64(0)
+		switch {
+		case n == st.myself:
+			flags = "myself,master"
+		case n.handshake:
+			flags, link = "handshake", "disconnected"
+		default:
+			if now.Sub(n.pong) > st.timeout {
+				flags += ",fail?"
+			}
+			if !n.linked {
+				link = "disconnected"
+			}
+			pong = n.pong.UnixMilli()
+		}
+		fmt.Fprintf(&b, "%s %s:%d@%d %s - 0 %d %d %s", n.id, n.host, n.port, n.port, flags, pong, n.epoch, link)
+		for _, r := range st.ranges(n) {
+			if r[0] == r[1] {
+				fmt.Fprintf(&b, " %d", r[0])
+			} else {
+				fmt.Fprintf(&b, " %d-%d", r[0], r[1])
+			}
+		}
+		if n == st.myself {
+			slots := make([]int, 0, len(st.migrating)+len(st.importing))
+			for slot := range st.migrating {
+				slots = append(slots, slot)
+			}
+			for slot := range st.importing {
+				slots = append(slots, slot)
+			}
+			sort.Ints(slots)
+			for _, slot := range slots {
+				if m := st.migrating[slot]; m != nil {
+					fmt.Fprintf(&b, " [%d->-%s]", slot, m.id)
+				} else {
+					fmt.Fprintf(&b, " [%d-<-%s]", slot, st.importing[slot].id)
+				}
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SlotRanges returns the assigned slot ranges in slot order.
+func (st *State) SlotRanges() []SlotRange {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var out []SlotRange
+	for slot, n := range st.owner {
+		if n == nil {
+			continue
+		}
+		if k := len(out); k > 0 && out[k-1].End == slot-1 && out[k-1].ID == n.id {
+			out[k-1].End = slot
+			continue
+		}
+		out = append(out, SlotRange{Start: slot, End: slot, ID: n.id, Host: n.host, Port: n.port})
+	}
+	return out
+}
+
+// Shard describes a node and the slot ranges it serves.
+type Shard struct {
+	ID     string
+	Host   string
+	Port   int
+	Ranges [][2]int
+	Online bool
+}
+
+// Shards returns one shard per known node, in node ID order.
+func (st *State) Shards() []Shard {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	var out []Shard
+	now := time.Now()
+	for _, n := range st.sortedNodes() {
+		if n.handshake {
+			continue
+		}
+		online := n == st.myself || now.Sub(n.pong) <= st.timeout
+		out = append(out, Shard{ID: n.id, Host: n.host, Port: n.port, Ranges: st.ranges(n), Online: online})
+	}
+	return out
+}
+
+// Info returns the CLUSTER INFO fields.
+func (st *State) Info() string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	assigned := 0
+	serving := make(map[*node]bool)
+	for _, n := range st.owner {
+		if n != nil {
+			assigned++
+			serving[n] = true
+		}
+	}
+	state := "ok"
+	if assigned < Slots {
+		state = "fail"
+	}
+	return fmt.Sprintf("cluster_enabled:1\r\ncluster_state:%s\r\ncluster_slots_assigned:%d\r\ncluster_slots_ok:%d\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\ncluster_known_nodes:%d\r\ncluster_size:%d\r\ncluster_current_epoch:%d\r\ncluster_my_epoch:%d\r\n",
+		state, assigned, assigned, len(st.nodes), len(serving), st.epoch, st.myself.epoch)
+}
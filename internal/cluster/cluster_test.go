@@ -0,0 +1,155 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeySlot(t *testing.T) {
+	if got := crc16("123456789"); got != 0x31c3 {
+		t.Fatalf("crc16 = %#x", got)
+	}
+	cases := map[string]int{
+		"foo":                  12182,
+		"somekey":              11058,
+		"{user1000}.following": KeySlot("user1000"),
+		"foo{}{bar}":           KeySlot("foo{}{bar}"),
+		"foo{{bar}}zap":        KeySlot("{bar"),
+		"foo{bar}{zap}":        KeySlot("bar"),
+		"{":                    KeySlot("{"),
+	}
+	for key, want := range cases {
+		if got := KeySlot(key); got != want {
+			t.Errorf("KeySlot(%q) = %d, want %d", key, got, want)
+		}
+	}
+	if KeySlot("foo{}{bar}") == KeySlot("bar") {
+		t.Error("empty hash tag must hash the whole key")
+	}
+}
+
+// exchange 模拟 a 读取 b 的 CLUSTER NODES
+func exchange(t *testing.T, a, b *State) bool {
+	t.Helper()
+	for _, p := range a.Peers() {
+		if strings.HasSuffix(p.Addr, ":"+portOf(b)) {
+			knowsMe, err := a.Merge(p.ID, b.Nodes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return knowsMe
+		}
+	}
+	t.Fatalf("peer not found")
+	return false
+}
+
+func portOf(st *State) string {
+	_, port, _ := strings.Cut(st.myself.addr(), ":")
+	return port
+}
+
+func TestMergeAndOwnership(t *testing.T) {
+	a := New("127.0.0.1", 7001, time.Minute)
+	b := New("127.0.0.1", 7002, time.Minute)
+	c := New("127.0.0.1", 7003, time.Minute)
+	if err := a.AddSlots([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddSlots([]int{2}); err == nil || err.Error() != "ERR Slot 2 is already busy" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b.AddSlots([]int{3})
+
+	// a 与 b 握手；c 通过 b 被 a 发现
+	a.Meet("127.0.0.1", 7002)
+	b.Meet("127.0.0.1", 7003)
+	exchange(t, b, c)
+	if exchange(t, a, b) {
+		t.Fatal("b should not know a yet")
+	}
+	b.Meet("127.0.0.1", 7001)
+	exchange(t, b, a)
+	if !exchange(t, a, b) {
+		t.Fatal("b should know a after the handshake")
+	}
+	exchange(t, a, c)
+	if len(a.Peers()) != 2 || strings.Contains(a.Nodes(), "handshake") {
+		t.Fatalf("unexpected node table:\n%s", a.Nodes())
+	}
+	if info := a.Slot(3); info.Owner != "127.0.0.1:7002" || info.Mine {
+		t.Fatalf("unexpected slot info %+v", info)
+	}
+	if info := a.Slot(1); !info.Mine {
+		t.Fatalf("unexpected slot info %+v", info)
+	}
+
+	// 迁移槽 2：b 以更大的纪元声明后，a 放弃该槽
+	if err := b.SetSlot(2, "IMPORTING", a.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetSlot(2, "MIGRATING", b.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(a.Nodes(), "[2->-"+b.MyID()+"]") || !strings.Contains(b.Nodes(), "[2-<-"+a.MyID()+"]") {
+		t.Fatal("expected migration state in CLUSTER NODES")
+	}
+	if err := b.SetSlot(2, "NODE", b.MyID()); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b)
+	if info := a.Slot(2); info.Mine || info.Owner != "127.0.0.1:7002" || info.Migrating != "" {
+		t.Fatalf("expected a to lose slot 2, got %+v", info)
+	}
+	if r := a.SlotRanges(); len(r) != 2 || r[0].End != 1 || r[1].Start != 2 || r[1].End != 3 {
+		t.Fatalf("unexpected ranges %+v", r)
+	}
+	if !strings.Contains(a.Info(), "cluster_current_epoch:1\r\n") {
+		t.Fatalf("unexpected info %q", a.Info())
+	}
+	if _, err := a.Merge(a.Peers()[0].ID, "garbage"); err == nil {
+		t.Fatal("expected malformed nodes to be rejected")
+	}
+}
+
+func TestPlanRebalance(t *testing.T) {
+	layout := func(counts ...int) []*layoutNode {
+		var nodes []*layoutNode
+		slot := 0
+		for i, n := range counts {
+			ln := &layoutNode{NodeAddr: NodeAddr{ID: string(rune('a' + i))}}
+			for j := 0; j < n; j++ {
+				ln.slots = append(ln.slots, slot)
+				slot++
+			}
+			nodes = append(nodes, ln)
+		}
+		return nodes
+	}
+	if moves := planRebalance(layout(6, 5, 5)); len(moves) != 0 {
+		t.Fatalf("balanced layout should not move slots, got %v", moves)
+	}
+	nodes := layout(8, 8, 0)
+	moves := planRebalance(nodes)
+	if len(moves) != 5 {
+		t.Fatalf("expected 5 moves, got %v", moves)
+	}
+	counts := map[string]int{}
+	for _, n := range nodes {
+		counts[n.ID] = len(n.slots)
+	}
+	for _, m := range moves {
+		if m.To.ID != "c" {
+			t.Fatalf("unexpected move %+v", m)
+		}
+		counts[m.From.ID]--
+		counts[m.To.ID]++
+	}
+	if counts["a"] != 6 || counts["b"] != 5 || counts["c"] != 5 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	if _, err := parseLayout("id 127.0.0.1:7000@7000 master,fail? - 0 0 1 connected 0-10"); err == nil {
+		t.Fatal("expected failing node to be rejected")
+	}
+}
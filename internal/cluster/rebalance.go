@@ -0,0 +1,310 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// RebalanceOptions controls Rebalance and MoveSlot.
+type RebalanceOptions struct {
+	// Pipeline 为每次 MIGRATE 迁移的键数，0 表示 10
+	Pipeline int
+	// Timeout 为连接与 MIGRATE 的超时，0 表示 5 秒
+	Timeout time.Duration
+	// Wait 为等待集群就绪的最长时间，0 表示 10 秒：全部槽已分配、各节点互相
+	// 认识且 cluster_state 为 ok 之后才计算迁移计划
+	Wait time.Duration
+	// DryRun 时只计算迁移计划，不移动槽
+	DryRun bool
+	// Progress 非 nil 时在每个槽迁移完成后调用
+	Progress func(Move)
+}
+
+func (o *RebalanceOptions) defaults() {
+	if o.Pipeline <= 0 {
+		o.Pipeline = 10
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.Wait <= 0 {
+		o.Wait = 10 * time.Second
+	}
+}
+
+// errNotReady 表示集群还在形成中（节点握手、槽未全部分配等），稍后重试即可
+var errNotReady = errors.New("cluster is not ready")
+
+// readyPollInterval 为等待集群就绪时重新检查的间隔
+var readyPollInterval = 100 * time.Millisecond
+
+// Move is a slot moved from one node to another.
+type Move struct {
+	Slot     int
+	From, To NodeAddr
+}
+
+// NodeAddr identifies a node of a running cluster.
+type NodeAddr struct {
+	ID   string
+	Addr string // host:port
+}
+
+// layoutNode 为 CLUSTER NODES 中的一个主节点及其声明的槽
+type layoutNode struct {
+	NodeAddr
+	slots []int
+}
+
+// Rebalance connects to the node at addr, reads the cluster layout and moves
+// slots so that every node serves the same number of slots, give or take
+// one. Nodes that already serve more slots keep the extra ones, which
+// minimizes the number of moves. It first waits up to opt.Wait for the
+// cluster to be ready: every slot assigned and every node aware of the
+// others with cluster_state:ok. It returns the moves performed, or the
+// planned ones with DryRun.
+func Rebalance(addr string, opt RebalanceOptions) ([]Move, error) {
+	opt.defaults()
+	// 同一对节点之间通常要迁移很多个槽，连接在整个过程中复用
+	conns := make(map[string]*protocol.Conn)
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	conn := func(addr string) (*protocol.Conn, error) {
+		if c := conns[addr]; c != nil {
+			return c, nil
+		}
+		c, err := dialNode(addr, opt)
+		if err == nil {
+			conns[addr] = c
+		}
+		return c, err
+	}
+	// 刚加入的节点通过 gossip 得知全部槽的归属之前，会以 CLUSTERDOWN 拒绝迁入的键
+	var nodes []*layoutNode
+	deadline := time.Now().Add(opt.Wait)
+	for {
+		var err error
+		if nodes, err = readyLayout(addr, conn); err == nil {
+			break
+		}
+		if !errors.Is(err, errNotReady) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(readyPollInterval)
+	}
+	moves := planRebalance(nodes)
+	if opt.DryRun {
+		return moves, nil
+	}
+	for i, m := range moves {
+		src, err := conn(m.From.Addr)
+		if err == nil {
+			var dst *protocol.Conn
+			if dst, err = conn(m.To.Addr); err == nil {
+				err = moveSlot(src, dst, m, opt)
+			}
+		}
+		if err != nil {
+			return moves[:i], fmt.Errorf("move slot %d from %s to %s: %w", m.Slot, m.From.Addr, m.To.Addr, err)
+		}
+		if opt.Progress != nil {
+			opt.Progress(m)
+		}
+	}
+	return moves, nil
+}
+
+// readyLayout 读取 addr 所见的集群布局，并确认集群已就绪：全部槽已分配，且
+// 布局中的每个节点都认识全部节点、cluster_state 为 ok。未就绪时返回的错误包装
+// errNotReady
+func readyLayout(addr string, conn func(string) (*protocol.Conn, error)) ([]*layoutNode, error) {
+	c, err := conn(addr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.Do("CLUSTER", "NODES")
+	if err != nil {
+		return nil, err
+	}
+	text, _ := v.(string)
+	nodes, err := parseLayout(text)
+	if err != nil {
+		return nil, err
+	}
+	assigned := 0
+	for _, n := range nodes {
+		assigned += len(n.slots)
+	}
+	if assigned != Slots {
+		return nil, fmt.Errorf("%w: %d of %d slots assigned", errNotReady, assigned, Slots)
+	}
+	known := "cluster_known_nodes:" + strconv.Itoa(len(nodes))
+	for _, n := range nodes {
+		c, err := conn(n.Addr)
+		if err != nil {
+			return nil, err
+		}
+		v, err := c.Do("CLUSTER", "INFO")
+		if err != nil {
+			return nil, err
+		}
+		info, _ := v.(string)
+		if !strings.Contains(info, "cluster_state:ok") || !strings.Contains(info, known+"\r\n") {
+			return nil, fmt.Errorf("%w: node %s has not seen the whole cluster yet", errNotReady, n.Addr)
+		}
+	}
+	return nodes, nil
+}
+
+// parseLayout 解析 CLUSTER NODES 的输出；任何节点处于握手或故障状态时拒绝迁移
+func parseLayout(text string) ([]*layoutNode, error) {
+	var nodes []*layoutNode
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 8 {
+			return nil, ErrBadNodes
+		}
+		for _, flag := range strings.Split(f[2], ",") {
+			if flag == "handshake" || strings.HasPrefix(flag, "fail") {
+				return nil, fmt.Errorf("%w: node %s is %s", errNotReady, f[0], f[2])
+			}
+		}
+		addr, _, _ := strings.Cut(f[1], "@")
+		n := &layoutNode{NodeAddr: NodeAddr{ID: f[0], Addr: addr}}
+		for _, r := range f[8:] {
+			if strings.HasPrefix(r, "[") {
+				return nil, fmt.Errorf("slot %s is already being migrated", strings.Trim(r, "[]"))
+			}
+			lo, hi, ok := parseRange(r)
+			if !ok {
+				return nil, ErrBadNodes
+			}
+			for slot := lo; slot <= hi; slot++ {
+				n.slots = append(n.slots, slot)
+			}
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// planRebalance 计算迁移计划：槽多的节点优先保留多出的一个槽，超出目标的节点
+// 从其最大的槽开始迁出，依次补给低于目标的节点
+func planRebalance(nodes []*layoutNode) []Move {
+	if len(nodes) == 0 {
+		return nil
+	}
+	total := 0
+	for _, n := range nodes {
+		total += len(n.slots)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if len(nodes[i].slots) != len(nodes[j].slots) {
+			return len(nodes[i].slots) > len(nodes[j].slots)
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+	target := make([]int, len(nodes))
+	for i := range nodes {
+		target[i] = total / len(nodes)
+		if i < total%len(nodes) {
+			target[i]++
+		}
+	}
+	var spare []Move
+	for i, n := range nodes {
+		for _, slot := range n.slots[min(target[i], len(n.slots)):] {
+			spare = append(spare, Move{Slot: slot, From: n.NodeAddr})
+		}
+	}
+	var moves []Move
+	for i, n := range nodes {
+		for need := target[i] - len(n.slots); need > 0; need-- {
+			m := spare[0]
+			spare = spare[1:]
+			m.To = n.NodeAddr
+			moves = append(moves, m)
+		}
+	}
+	return moves
+}
+
+// MoveSlot migrates slot from node from to node to while both keep serving
+// it: the target is marked IMPORTING and the source MIGRATING, so that
+// clients are sent with ASK to the target for keys that already moved. The
+// keys are then moved in batches with MIGRATE, and finally both nodes assign
+// the slot to the target, which announces it to the rest of the cluster.
+func MoveSlot(slot int, from, to NodeAddr, opt RebalanceOptions) error {
+	opt.defaults()
+	src, err := dialNode(from.Addr, opt)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := dialNode(to.Addr, opt)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return moveSlot(src, dst, Move{Slot: slot, From: from, To: to}, opt)
+}
+
+// moveSlot 通过已建立的连接执行 MoveSlot
+func moveSlot(src, dst *protocol.Conn, m Move, opt RebalanceOptions) error {
+	host, port, err := net.SplitHostPort(m.To.Addr)
+	if err != nil {
+		return err
+	}
+	s := strconv.Itoa(m.Slot)
+	if _, err := dst.Do("CLUSTER", "SETSLOT", s, "IMPORTING", m.From.ID); err != nil {
+		return err
+	}
+	if _, err := src.Do("CLUSTER", "SETSLOT", s, "MIGRATING", m.To.ID); err != nil {
+		return err
+	}
+	timeout := strconv.FormatInt(opt.Timeout.Milliseconds(), 10)
+	for {
+		v, err := src.Do("CLUSTER", "GETKEYSINSLOT", s, strconv.Itoa(opt.Pipeline))
+		if err != nil {
+			return err
+		}
+		keys, _ := v.([]any)
+		if len(keys) == 0 {
+			break
+		}
+		// REPLACE：上次中断时已写入目标的键可以覆盖
+		cmd := []string{"MIGRATE", host, port, "", "0", timeout, "REPLACE", "KEYS"}
+		for _, k := range keys {
+			key, _ := k.(string)
+			cmd = append(cmd, key)
+		}
+		if _, err := src.Do(cmd...); err != nil {
+			return err
+		}
+	}
+	// 先由目标节点接管（提升纪元），再让源节点放弃该槽
+	if _, err := dst.Do("CLUSTER", "SETSLOT", s, "NODE", m.To.ID); err != nil {
+		return err
+	}
+	_, err = src.Do("CLUSTER", "SETSLOT", s, "NODE", m.To.ID)
+	return err
+}
+
+// dialNode 连接节点；MIGRATE 本身受 opt.Timeout 限制，请求的超时取其两倍
+func dialNode(addr string, opt RebalanceOptions) (*protocol.Conn, error) {
+	c, err := protocol.Dial(addr, opt.Timeout)
+	if err == nil {
+		c.Timeout = 2 * opt.Timeout
+	}
+	return c, err
+}
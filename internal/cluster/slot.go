@@ -0,0 +1,53 @@
+// Package cluster 实现集群模式的槽映射与节点表。
+//
+// 与 Redis Cluster 一样，键按 CRC16(key) mod 16384 映射到槽；键中第一个 "{...}"
+// 非空时只对其中的内容计算（hash tag），使相关的键落在同一个槽。每个节点自己
+// 声明所服务的槽及其配置纪元（epoch），节点之间通过交换 CLUSTER NODES 的输出
+// 互相发现并获知其他节点声明的槽；多个节点声明同一个槽时纪元大者胜出。
+package cluster
+
+// Slots 为哈希槽的数量
+const Slots = 16384
+
+// crc16Table 为 CRC-16/XMODEM（多项式 0x1021，初值 0）的查找表
+var crc16Table = func() (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// KeySlot returns the hash slot of key, honouring {hash tags}.
+func KeySlot(key string) int {
+	for i := 0; i < len(key); i++ {
+		if key[i] != '{' {
+			continue
+		}
+		for j := i + 1; j < len(key); j++ {
+			if key[j] == '}' {
+				if j > i+1 {
+					key = key[i+1 : j]
+				}
+				return int(crc16(key) & (Slots - 1))
+			}
+		}
+		break
+	}
+	return int(crc16(key) & (Slots - 1))
+}
@@ -0,0 +1,105 @@
+package command
+
+import (
+	"sort"
+	"strings"
+)
+
+// arity 记录命令的参数个数（含命令名本身，与 Redis 的约定一致）：正数表示必须恰好
+// 为该数量，负数表示至少为其绝对值。MULTI 在入队前据此校验命令；服务器自身处理的
+// 命令（PING、PUBLISH 等）也登记在这里。
+var arity = map[string]int{
+	// 服务器命令
+	"PING": -1, "QUIT": -1, "INFO": -1,
+	"PUBLISH": 3, "SPUBLISH": 3, "PUBSUB": -2,
+	"SUBSCRIBE": -2, "PSUBSCRIBE": -2, "SSUBSCRIBE": -2,
+	"UNSUBSCRIBE": -1, "PUNSUBSCRIBE": -1, "SUNSUBSCRIBE": -1,
+	"MULTI": 1, "EXEC": 1, "DISCARD": 1, "WATCH": -2, "UNWATCH": 1,
+	"SAVE": 1, "BGSAVE": -1, "LASTSAVE": 1, "BGREWRITEAOF": 1,
+	"REPLICAOF": 3, "SLAVEOF": 3, "REPLCONF": -1, "PSYNC": 3, "SYNC": 1, "WAIT": 3,
+	"CLUSTER": -2, "ASKING": 1, "MIGRATE": -6, "RAFT": -2, "AUTH": -2, "ACL": -2,
+	"HELLO": -1, "CONFIG": -2,
+	// 字符串与键
+	"SET": -3, "GET": 2, "DEL": -2, "EXISTS": -2, "EXPIRE": -3, "PEXPIRE": -3,
+	"EXPIREAT": -3, "PEXPIREAT": -3, "EXPIRETIME": 2, "PEXPIRETIME": 2,
+	"TTL": 2, "PTTL": 2, "PERSIST": 2, "INCR": 2, "MGET": -2,
+	"DUMP": 2, "RESTORE": -4, "RESTORE-ASKING": -4,
+	// Hash
+	"HSET": -4, "HMSET": -4, "HSETNX": 4, "HGET": 3, "HMGET": -3, "HDEL": -3,
+	"HEXISTS": 3, "HLEN": 2, "HSTRLEN": 3, "HKEYS": 2, "HVALS": 2, "HGETALL": 2,
+	"HINCRBY": 4, "HINCRBYFLOAT": 4, "HRANDFIELD": -2,
+	// List
+	"LPUSH": -3, "RPUSH": -3, "LPUSHX": -3, "RPUSHX": -3, "LPOP": -2, "RPOP": -2,
+	"LLEN": 2, "LRANGE": 4, "LINDEX": 3, "LSET": 4, "LINSERT": 5, "LREM": 4,
+	"LTRIM": 4, "LPOS": -3, "LMOVE": 5, "RPOPLPUSH": 3, "LMPOP": -4,
+	"BLPOP": -3, "BRPOP": -3, "BLMOVE": 6, "BLMPOP": -5,
+	// Set
+	"SADD": -3, "SREM": -3, "SISMEMBER": 3, "SMISMEMBER": -3, "SMEMBERS": 2,
+	"SCARD": 2, "SPOP": -2, "SRANDMEMBER": -2, "SMOVE": 4, "SINTER": -2,
+	"SUNION": -2, "SDIFF": -2, "SINTERSTORE": -3, "SUNIONSTORE": -3,
+	"SDIFFSTORE": -3, "SINTERCARD": -3,
+	// Sorted set
+	"ZADD": -4, "ZINCRBY": 4, "ZREM": -3, "ZCARD": 2, "ZSCORE": 3, "ZMSCORE": -3,
+	"ZRANK": -3, "ZREVRANK": -3, "ZRANGE": -4, "ZRANGESTORE": -5, "ZCOUNT": 4,
+	"ZLEXCOUNT": 4, "ZPOPMIN": -2, "ZPOPMAX": -2, "ZUNIONSTORE": -4,
+	"ZINTERSTORE": -4, "ZDIFFSTORE": -4, "BZPOPMIN": -3, "BZPOPMAX": -3,
+	// Stream
+	"XADD": -5, "XTRIM": -4, "XLEN": 2, "XRANGE": -4, "XREVRANGE": -4, "XDEL": -3,
+	"XGROUP": -2, "XACK": -4, "XPENDING": -3, "XCLAIM": -6, "XAUTOCLAIM": -6,
+	"XINFO": -2, "XREAD": -4, "XREADGROUP": -7,
+}
+
+// names 将已知命令的大写名称映射到其自身，供 Name 在不分配内存的情况下取得名称
+var names = func() map[string]string {
+	m := make(map[string]string, len(arity))
+	for name := range arity {
+		m[name] = name
+	}
+	return m
+}()
+
+// maxNameLen 为 Name 在栈上转换大小写的缓冲区长度，长于它的名称不是已知命令
+const maxNameLen = 32
+
+// Name returns the upper-case name of the command b. Known command names are
+// returned without allocating; other names are converted as they are.
+func Name(b []byte) string {
+	if len(b) <= maxNameLen {
+		var buf [maxNameLen]byte
+		up := buf[:len(b)]
+		for i, c := range b {
+			if 'a' <= c && c <= 'z' {
+				c -= 'a' - 'A'
+			}
+			up[i] = c
+		}
+		if name, ok := names[string(up)]; ok {
+			return name
+		}
+	}
+	return strings.ToUpper(string(b))
+}
+
+// CheckArity reports whether a command called with argc arguments (including
+// the command name) satisfies its arity. Commands without a registered arity
+// always pass.
+func CheckArity(name string, argc int) bool {
+	n, ok := arity[strings.ToUpper(name)]
+	if !ok {
+		return true
+	}
+	if n >= 0 {
+		return argc == n
+	}
+	return argc >= -n
+}
+
+// Commands returns the names of all known commands, sorted.
+func Commands() []string {
+	names := make([]string, 0, len(arity))
+	for name := range arity {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
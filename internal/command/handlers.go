@@ -2,43 +2,248 @@ package command
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
 	"redisx/internal/storage"
 )
 
 // INCR key
-func Incr(store *storage.Storage, args []string) ([]byte, error) {
+func Incr(store *storage.Storage, args []string) (protocol.Reply, error) {
 	if len(args) < 1 {
-		return []byte("-ERR wrong number of arguments for 'INCR' command\r\n"), nil
+		return protocol.Error("ERR wrong number of arguments for 'INCR' command"), nil
 	}
 	n, err := store.IncrBy(args[0], 1)
+	if errors.Is(err, storage.ErrWrongType) {
+		return errReply(err), nil
+	}
 	if err != nil {
-		return []byte("-ERR value is not an integer or out of range\r\n"), nil
+		return protocol.ErrNotInteger, nil
 	}
-	return []byte(fmt.Sprintf(":%d\r\n", n)), nil
+	return protocol.Integer(n), nil
 }
 
 // MGET key [key ...]
-func MGet(store *storage.Storage, args []string) ([]byte, error) {
-	var b bytes.Buffer
-	b.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
-	for _, k := range args {
-		if v, ok := store.Get(k); ok {
-			b.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(v), v))
+func MGet(store *storage.Storage, args [][]byte) (protocol.Reply, error) {
+	out := make(protocol.Array, len(args))
+	for i, k := range args {
+		if v, ok := store.Get(string(k)); ok {
+			out[i] = protocol.BulkBytes(v)
 		} else {
-			b.WriteString("$-1\r\n")
+			out[i] = protocol.NullBulk
 		}
 	}
-	return b.Bytes(), nil
+	return out, nil
 }
 
 // PERSIST key
-func Persist(store *storage.Storage, args []string) ([]byte, error) {
+func Persist(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 {
+		return protocol.Error("ERR wrong number of arguments for 'PERSIST' command"), nil
+	}
+	return boolReply(store.Persist(args[0])), nil
+}
+
+// SET key value [EX seconds] [PX milliseconds]
+func Set(store *storage.Storage, args [][]byte) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.Error("ERR wrong number of arguments for 'SET' command"), nil
+	}
+	key := string(args[0])
+	// 存储取得值的所有权，此后不再修改：大参数直接取自解析器，其余复制
+	value := protocol.Own(args[1])
+	// 支持 EX seconds 和 PX milliseconds；PX 存在时按毫秒设置
+	ttl := int64(0)
+	pxMillis := int64(0)
+	for i := 2; i < len(args); {
+		ex := bytes.EqualFold(args[i], []byte("EX"))
+		switch {
+		case ex || bytes.EqualFold(args[i], []byte("PX")):
+			if i+1 >= len(args) {
+				return protocol.ErrSyntax, nil
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return protocol.Error("ERR invalid expire time"), nil
+			}
+			if ex {
+				ttl = n
+			} else {
+				// 转换为秒（向上取整）
+				ttl = (n + 999) / 1000
+				pxMillis = n
+			}
+			i += 2
+		default:
+			i++
+		}
+	}
+	// 如果 storage 配置了 max memory 则使用 TrySet 系列以进行内存检查
+	if store.GetMaxMemory() > 0 {
+		var ok bool
+		if pxMillis > 0 {
+			ok = store.TrySetWithMs(key, value, pxMillis)
+		} else {
+			ok = store.TrySet(key, value, ttl)
+		}
+		if !ok {
+			return protocol.Error("ERR max memory reached"), nil
+		}
+	} else if pxMillis > 0 {
+		store.SetWithMs(key, value, pxMillis)
+	} else {
+		store.Set(key, value, ttl)
+	}
+	return protocol.OK, nil
+}
+
+// GET key
+func Get(store *storage.Storage, args [][]byte) (protocol.Reply, error) {
+	if len(args) < 1 {
+		return protocol.Error("ERR wrong number of arguments for 'GET' command"), nil
+	}
+	v, ok, err := store.GetString(string(args[0]))
+	if err != nil {
+		return protocol.Error(err.Error()), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.BulkBytes(v), nil
+}
+
+// DEL key [key ...]
+func Del(store *storage.Storage, args []string) (protocol.Reply, error) {
+	count := 0
+	for _, k := range args {
+		if store.Delete(k) {
+			count++
+		}
+	}
+	return protocol.Integer(int64(count)), nil
+}
+
+// EXISTS key [key ...]
+func Exists(store *storage.Storage, args []string) (protocol.Reply, error) {
+	count := 0
+	for _, k := range args {
+		if store.Exists(k) {
+			count++
+		}
+	}
+	return protocol.Integer(int64(count)), nil
+}
+
+// EXPIRE key seconds
+func Expire(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return expire("EXPIRE", store.Expire, args)
+}
+
+// PEXPIRE key milliseconds
+func PExpire(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return expire("PEXPIRE", store.PExpire, args)
+}
+
+func expire(cmd string, set func(key string, ttl int64) bool, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs(cmd), nil
+	}
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return protocol.Error("ERR invalid expire time"), nil
+	}
+	return boolReply(set(args[0], ttl)), nil
+}
+
+// EXPIREAT key unix-time-seconds
+func ExpireAt(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return expire("EXPIREAT", func(key string, t int64) bool { return store.PExpireAt(key, t*1000) }, args)
+}
+
+// PEXPIREAT key unix-time-milliseconds
+func PExpireAt(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return expire("PEXPIREAT", store.PExpireAt, args)
+}
+
+// EXPIRETIME key
+func ExpireTime(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("expiretime"), nil
+	}
+	t := store.PExpireTime(args[0])
+	if t > 0 {
+		t /= 1000
+	}
+	return protocol.Integer(t), nil
+}
+
+// PEXPIRETIME key
+func PExpireTime(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("pexpiretime"), nil
+	}
+	return protocol.Integer(store.PExpireTime(args[0])), nil
+}
+
+// TTL key
+func TTL(store *storage.Storage, args []string) (protocol.Reply, error) {
 	if len(args) < 1 {
-		return []byte("-ERR wrong number of arguments for 'PERSIST' command\r\n"), nil
+		return protocol.Error("ERR wrong number of arguments for 'TTL' command"), nil
+	}
+	return protocol.Integer(store.TTL(args[0])), nil
+}
+
+// PTTL key
+func PTTL(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 {
+		return protocol.Error("ERR wrong number of arguments for 'PTTL' command"), nil
+	}
+	return protocol.Integer(store.PTTL(args[0])), nil
+}
+
+// DUMP key
+func Dump(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("dump"), nil
+	}
+	payload, ok := store.Dump(args[0])
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(payload), nil
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL]
+//
+// ttl 为毫秒，0 表示永不过期；ABSTTL 时为 Unix 毫秒时间戳。RESTORE-ASKING 与
+// RESTORE 相同，供槽迁移时发往导入方（见 server 的 clusterRedirect）。
+func Restore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("restore"), nil
+	}
+	replace, absTTL := false, false
+	for _, a := range args[3:] {
+		switch strings.ToUpper(a) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return protocol.ErrSyntax, nil
+		}
+	}
+	ttl, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || ttl < 0 {
+		return protocol.Error("ERR Invalid TTL value, must be >= 0"), nil
+	}
+	if ttl > 0 && !absTTL {
+		ttl += time.Now().UnixMilli()
 	}
-	if store.Persist(args[0]) {
-		return []byte(":1\r\n"), nil
+	if err := store.Restore(args[0], args[2], ttl, replace); err != nil {
+		return errReply(err), nil
 	}
-	return []byte(":0\r\n"), nil
+	return protocol.OK, nil
 }
@@ -0,0 +1,183 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// parseTimeout 解析秒为单位的超时（支持小数），0 表示无限等待
+func parseTimeout(s string) (time.Duration, protocol.Reply) {
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(sec) || math.IsInf(sec, 0) {
+		return 0, protocol.Error("ERR timeout is not a float or out of range")
+	}
+	if sec < 0 {
+		return 0, protocol.Error("ERR timeout is negative")
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// blockTimeout 在不允许阻塞（cancel 为 nil）时返回负数超时，使存储层只尝试一次
+func blockTimeout(d time.Duration, cancel <-chan struct{}) time.Duration {
+	if cancel == nil {
+		return -1
+	}
+	return d
+}
+
+// MayBlock reports whether a blocking command called with args can actually
+// block. XREAD and XREADGROUP only block with the BLOCK option, and
+// XREADGROUP only when every stream reads new entries (">"); other calls
+// behave like ordinary commands.
+func MayBlock(name string, args []string) bool {
+	switch upper := strings.ToUpper(name); upper {
+	case "XREAD", "XREADGROUP":
+		opts, errResp := parseXRead(strings.ToLower(upper), args, upper == "XREADGROUP")
+		if errResp != nil || !opts.block {
+			return false
+		}
+		if upper == "XREADGROUP" {
+			for _, a := range opts.streams {
+				if !a.New {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func blockingPop(name string, store *storage.Storage, args []string, cancel <-chan struct{}, left bool) protocol.Reply {
+	if len(args) < 2 {
+		return protocol.WrongArgs(name)
+	}
+	timeout, errResp := parseTimeout(args[len(args)-1])
+	if errResp != nil {
+		return errResp
+	}
+	key, val, ok, err := store.BlockingPop(args[:len(args)-1], left, blockTimeout(timeout, cancel), cancel)
+	if err != nil {
+		return errReply(err)
+	}
+	if !ok {
+		return protocol.NullArray
+	}
+	return protocol.BulkStrings([]string{key, val})
+}
+
+// BLPOP key [key ...] timeout
+func BLPop(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	return blockingPop("blpop", store, args, cancel, true), nil
+}
+
+// BRPOP key [key ...] timeout
+func BRPop(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	return blockingPop("brpop", store, args, cancel, false), nil
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func BLMove(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	if len(args) != 5 {
+		return protocol.WrongArgs("blmove"), nil
+	}
+	srcLeft, ok1 := parseDirection(args[2])
+	dstLeft, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return protocol.ErrSyntax, nil
+	}
+	timeout, errResp := parseTimeout(args[4])
+	if errResp != nil {
+		return errResp, nil
+	}
+	v, ok, err := store.BlockingMove(args[0], args[1], srcLeft, dstLeft, blockTimeout(timeout, cancel), cancel)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(v), nil
+}
+
+// parseMPop 解析 numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func parseMPop(args []string) (keys []string, left bool, count int, errResp protocol.Reply) {
+	if len(args) < 3 {
+		return nil, false, 0, protocol.ErrSyntax
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return nil, false, 0, protocol.Error("ERR numkeys should be greater than 0")
+	}
+	if len(args) < n+2 {
+		return nil, false, 0, protocol.ErrSyntax
+	}
+	keys = args[1 : n+1]
+	left, ok := parseDirection(args[n+1])
+	if !ok {
+		return nil, false, 0, protocol.ErrSyntax
+	}
+	count = 1
+	rest := args[n+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(rest[0], "COUNT") {
+			return nil, false, 0, protocol.ErrSyntax
+		}
+		count, err = strconv.Atoi(rest[1])
+		if err != nil || count <= 0 {
+			return nil, false, 0, protocol.Error("ERR count should be greater than 0")
+		}
+	}
+	return keys, left, count, nil
+}
+
+// mpopReply 编码 [key, [element ...]]
+func mpopReply(key string, vals []string) protocol.Reply {
+	return protocol.Array{protocol.Bulk(key), protocol.BulkStrings(vals)}
+}
+
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func LMPop(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("lmpop"), nil
+	}
+	keys, left, count, errResp := parseMPop(args)
+	if errResp != nil {
+		return errResp, nil
+	}
+	key, vals, ok, err := store.LMPop(keys, left, count)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullArray, nil
+	}
+	return mpopReply(key, vals), nil
+}
+
+// BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func BLMPop(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	if len(args) < 4 {
+		return protocol.WrongArgs("blmpop"), nil
+	}
+	timeout, errResp := parseTimeout(args[0])
+	if errResp != nil {
+		return errResp, nil
+	}
+	keys, left, count, errResp := parseMPop(args[1:])
+	if errResp != nil {
+		return errResp, nil
+	}
+	key, vals, ok, err := store.BlockingMPop(keys, left, count, blockTimeout(timeout, cancel), cancel)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullArray, nil
+	}
+	return mpopReply(key, vals), nil
+}
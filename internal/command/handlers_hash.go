@@ -0,0 +1,227 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// HSET key field value [field value ...]
+func HSet(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return protocol.WrongArgs("hset"), nil
+	}
+	n, err := store.HSet(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// HMSET key field value [field value ...]
+func HMSet(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return protocol.WrongArgs("hmset"), nil
+	}
+	if _, err := store.HSet(args[0], args[1:]); err != nil {
+		return errReply(err), nil
+	}
+	return protocol.OK, nil
+}
+
+// HSETNX key field value
+func HSetNX(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("hsetnx"), nil
+	}
+	ok, err := store.HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return boolReply(ok), nil
+}
+
+// HGET key field
+func HGet(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("hget"), nil
+	}
+	v, ok, err := store.HGet(args[0], args[1])
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(v), nil
+}
+
+// HMGET key field [field ...]
+func HMGet(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("hmget"), nil
+	}
+	vals, found, err := store.HMGet(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return optionalArrayReply(vals, found), nil
+}
+
+// HDEL key field [field ...]
+func HDel(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("hdel"), nil
+	}
+	n, err := store.HDel(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// HEXISTS key field
+func HExists(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("hexists"), nil
+	}
+	ok, err := store.HExists(args[0], args[1])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return boolReply(ok), nil
+}
+
+// HLEN key
+func HLen(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("hlen"), nil
+	}
+	n, err := store.HLen(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// HSTRLEN key field
+func HStrLen(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("hstrlen"), nil
+	}
+	n, err := store.HStrLen(args[0], args[1])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// HKEYS key
+func HKeys(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("hkeys"), nil
+	}
+	keys, err := store.HKeys(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.BulkStrings(keys), nil
+}
+
+// HVALS key
+func HVals(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("hvals"), nil
+	}
+	vals, err := store.HVals(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.BulkStrings(vals), nil
+}
+
+// HGETALL key
+func HGetAll(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("hgetall"), nil
+	}
+	pairs, err := store.HGetAll(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return mapReply(pairs), nil
+}
+
+// HINCRBY key field increment
+func HIncrBy(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("hincrby"), nil
+	}
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	n, err := store.HIncrBy(args[0], args[1], delta)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(n), nil
+}
+
+// HINCRBYFLOAT key field increment
+func HIncrByFloat(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("hincrbyfloat"), nil
+	}
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return protocol.ErrNotFloat, nil
+	}
+	v, err := store.HIncrByFloat(args[0], args[1], delta)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Bulk(v), nil
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func HRandField(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return protocol.WrongArgs("hrandfield"), nil
+	}
+	if len(args) == 1 {
+		fields, _, err := store.HRandField(args[0], 1)
+		if err != nil {
+			return errReply(err), nil
+		}
+		if len(fields) == 0 {
+			return protocol.NullBulk, nil
+		}
+		return protocol.Bulk(fields[0]), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	withValues := false
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "WITHVALUES") {
+			return protocol.ErrSyntax, nil
+		}
+		withValues = true
+	}
+	fields, values, err := store.HRandField(args[0], count)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !withValues {
+		return protocol.BulkStrings(fields), nil
+	}
+	out := make([]string, 0, len(fields)*2)
+	for i := range fields {
+		out = append(out, fields[i], values[i])
+	}
+	return protocol.BulkStrings(out), nil
+}
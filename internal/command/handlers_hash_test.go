@@ -0,0 +1,87 @@
+package command
+
+import (
+	"redisx/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestHSetHGet(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := HSet(s, []string{"h", "f", "v"})
+	if resp2(resp) != ":1\r\n" {
+		t.Fatalf("expected :1, got %q", resp2(resp))
+	}
+	resp, _ = HGet(s, []string{"h", "f"})
+	if resp2(resp) != "$1\r\nv\r\n" {
+		t.Fatalf("expected bulk v, got %q", resp2(resp))
+	}
+	resp, _ = HGet(s, []string{"h", "missing"})
+	if resp2(resp) != "$-1\r\n" {
+		t.Fatalf("expected null bulk, got %q", resp2(resp))
+	}
+	resp, _ = HSet(s, []string{"h", "f"})
+	if !strings.HasPrefix(resp2(resp), "-ERR wrong number") {
+		t.Fatalf("expected arity error, got %q", resp2(resp))
+	}
+}
+
+func TestHMGetAndGetAll(t *testing.T) {
+	s := storage.NewStorage()
+	HSet(s, []string{"h", "a", "1"})
+	resp, _ := HMGet(s, []string{"h", "a", "x"})
+	if resp2(resp) != "*2\r\n$1\r\n1\r\n$-1\r\n" {
+		t.Fatalf("unexpected HMGET reply %q", resp2(resp))
+	}
+	resp, _ = HGetAll(s, []string{"h"})
+	if resp2(resp) != "*2\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Fatalf("unexpected HGETALL reply %q", resp2(resp))
+	}
+}
+
+func TestHashWrongTypeReply(t *testing.T) {
+	s := storage.NewStorage()
+	HSet(s, []string{"h", "f", "1"})
+	resp, _ := Incr(s, []string{"h"})
+	if !strings.HasPrefix(resp2(resp), "-WRONGTYPE") {
+		t.Fatalf("expected WRONGTYPE, got %q", resp2(resp))
+	}
+	s.Set("str", []byte("v"), 0)
+	resp, _ = HGet(s, []string{"str", "f"})
+	if !strings.HasPrefix(resp2(resp), "-WRONGTYPE") {
+		t.Fatalf("expected WRONGTYPE, got %q", resp2(resp))
+	}
+}
+
+func TestHIncrByFloatReply(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := HIncrByFloat(s, []string{"h", "f", "1.5"})
+	if resp2(resp) != "$3\r\n1.5\r\n" {
+		t.Fatalf("expected 1.5, got %q", resp2(resp))
+	}
+	resp, _ = HIncrBy(s, []string{"h", "f", "1"})
+	if !strings.HasPrefix(resp2(resp), "-ERR hash value is not an integer") {
+		t.Fatalf("expected not integer error, got %q", resp2(resp))
+	}
+}
+
+func TestHRandFieldOutOfRange(t *testing.T) {
+	s := storage.NewStorage()
+	HSet(s, []string{"h", "a", "1"})
+	resp, _ := HRandField(s, []string{"h", "-9223372036854775808"})
+	if resp2(resp) != "-ERR value is out of range\r\n" {
+		t.Fatalf("expected out of range, got %q", resp2(resp))
+	}
+	resp, _ = HRandField(s, []string{"h", "-4611686018427387904", "WITHVALUES"})
+	if resp2(resp) != "-ERR value is out of range\r\n" {
+		t.Fatalf("expected out of range, got %q", resp2(resp))
+	}
+	resp, _ = HRandField(s, []string{"h", "-1000000000000"})
+	if resp2(resp) != "-ERR value is out of range\r\n" {
+		t.Fatalf("expected out of range, got %q", resp2(resp))
+	}
+	resp, _ = HRandField(s, []string{"h", "-3", "WITHVALUES"})
+	if resp2(resp) != "*6\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Fatalf("unexpected HRANDFIELD reply %q", resp2(resp))
+	}
+}
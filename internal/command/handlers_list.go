@@ -0,0 +1,292 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// parseDirection 解析 LEFT/RIGHT，返回是否为 LEFT
+func parseDirection(s string) (left bool, ok bool) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// intArrayReply 将整数列表编码为数组
+func intArrayReply(items []int) protocol.Reply {
+	out := make(protocol.Array, len(items))
+	for i, n := range items {
+		out[i] = protocol.Integer(n)
+	}
+	return out
+}
+
+func pushCommand(name string, push func(string, []string) (int, error), args []string) protocol.Reply {
+	if len(args) < 2 {
+		return protocol.WrongArgs(name)
+	}
+	n, err := push(args[0], args[1:])
+	if err != nil {
+		return errReply(err)
+	}
+	return protocol.Integer(int64(n))
+}
+
+// LPUSH key element [element ...]
+func LPush(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return pushCommand("lpush", store.LPush, args), nil
+}
+
+// RPUSH key element [element ...]
+func RPush(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return pushCommand("rpush", store.RPush, args), nil
+}
+
+// LPUSHX key element [element ...]
+func LPushX(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return pushCommand("lpushx", store.LPushX, args), nil
+}
+
+// RPUSHX key element [element ...]
+func RPushX(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return pushCommand("rpushx", store.RPushX, args), nil
+}
+
+func popCommand(name string, pop func(string, int) ([]string, error), args []string) protocol.Reply {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.WrongArgs(name)
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return protocol.Error("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	vals, err := pop(args[0], count)
+	if err != nil {
+		return errReply(err)
+	}
+	if len(args) == 1 {
+		if len(vals) == 0 {
+			return protocol.NullBulk
+		}
+		return protocol.Bulk(vals[0])
+	}
+	if vals == nil {
+		return protocol.NullArray
+	}
+	return protocol.BulkStrings(vals)
+}
+
+// LPOP key [count]
+func LPop(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return popCommand("lpop", store.LPop, args), nil
+}
+
+// RPOP key [count]
+func RPop(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return popCommand("rpop", store.RPop, args), nil
+}
+
+// LLEN key
+func LLen(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("llen"), nil
+	}
+	n, err := store.LLen(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// LRANGE key start stop
+func LRange(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("lrange"), nil
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	vals, err := store.LRange(args[0], start, stop)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.BulkStrings(vals), nil
+}
+
+// LINDEX key index
+func LIndex(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("lindex"), nil
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	v, ok, err := store.LIndex(args[0], idx)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(v), nil
+}
+
+// LSET key index element
+func LSet(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("lset"), nil
+	}
+	idx, err := strconv.Atoi(args[1])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	if err := store.LSet(args[0], idx, args[2]); err != nil {
+		return errReply(err), nil
+	}
+	return protocol.OK, nil
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func LInsert(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 4 {
+		return protocol.WrongArgs("linsert"), nil
+	}
+	var before bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+	default:
+		return protocol.ErrSyntax, nil
+	}
+	n, err := store.LInsert(args[0], before, args[2], args[3])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// LREM key count element
+func LRem(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("lrem"), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	n, err := store.LRem(args[0], count, args[2])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// LTRIM key start stop
+func LTrim(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("ltrim"), nil
+	}
+	start, err1 := strconv.Atoi(args[1])
+	stop, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	if err := store.LTrim(args[0], start, stop); err != nil {
+		return errReply(err), nil
+	}
+	return protocol.OK, nil
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func LPos(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("lpos"), nil
+	}
+	rank, count, maxLen := 1, 0, 0
+	hasCount := false
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.ErrSyntax, nil
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil {
+			return protocol.ErrNotInteger, nil
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return protocol.Error("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"), nil
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return protocol.Error("ERR COUNT can't be negative"), nil
+			}
+			count, hasCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return protocol.Error("ERR MAXLEN can't be negative"), nil
+			}
+			maxLen = n
+		default:
+			return protocol.ErrSyntax, nil
+		}
+	}
+	if !hasCount {
+		count = 1
+	}
+	idx, err := store.LPos(args[0], args[1], rank, count, maxLen)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if hasCount {
+		return intArrayReply(idx), nil
+	}
+	if len(idx) == 0 {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Integer(int64(idx[0])), nil
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func LMove(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 4 {
+		return protocol.WrongArgs("lmove"), nil
+	}
+	srcLeft, ok1 := parseDirection(args[2])
+	dstLeft, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return protocol.ErrSyntax, nil
+	}
+	v, ok, err := store.LMove(args[0], args[1], srcLeft, dstLeft)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(v), nil
+}
+
+// RPOPLPUSH source destination
+func RPopLPush(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("rpoplpush"), nil
+	}
+	return LMove(store, []string{args[0], args[1], "RIGHT", "LEFT"})
+}
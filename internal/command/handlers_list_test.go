@@ -0,0 +1,70 @@
+package command
+
+import (
+	"redisx/internal/storage"
+	"strings"
+	"testing"
+)
+
+func TestListPushPopReplies(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := RPush(s, []string{"q", "a", "b", "c"})
+	if resp2(resp) != ":3\r\n" {
+		t.Fatalf("expected :3, got %q", resp2(resp))
+	}
+	resp, _ = LPop(s, []string{"q"})
+	if resp2(resp) != "$1\r\na\r\n" {
+		t.Fatalf("expected a, got %q", resp2(resp))
+	}
+	resp, _ = RPop(s, []string{"q", "5"})
+	if resp2(resp) != "*2\r\n$1\r\nc\r\n$1\r\nb\r\n" {
+		t.Fatalf("unexpected RPOP count reply %q", resp2(resp))
+	}
+	resp, _ = LPop(s, []string{"q", "1"})
+	if resp2(resp) != "*-1\r\n" {
+		t.Fatalf("expected null array, got %q", resp2(resp))
+	}
+}
+
+func TestLPosReply(t *testing.T) {
+	s := storage.NewStorage()
+	RPush(s, []string{"l", "a", "b", "a"})
+	resp, _ := LPos(s, []string{"l", "a", "COUNT", "0"})
+	if resp2(resp) != "*2\r\n:0\r\n:2\r\n" {
+		t.Fatalf("unexpected LPOS reply %q", resp2(resp))
+	}
+	resp, _ = LPos(s, []string{"l", "z"})
+	if resp2(resp) != "$-1\r\n" {
+		t.Fatalf("expected null, got %q", resp2(resp))
+	}
+	resp, _ = LPos(s, []string{"l", "a", "RANK", "0"})
+	if !strings.HasPrefix(resp2(resp), "-ERR RANK") {
+		t.Fatalf("expected RANK error, got %q", resp2(resp))
+	}
+}
+
+func TestLSetNoSuchKey(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := LSet(s, []string{"missing", "0", "v"})
+	if resp2(resp) != "-ERR no such key\r\n" {
+		t.Fatalf("expected no such key, got %q", resp2(resp))
+	}
+}
+
+func TestBlockingHandlersWithoutCancel(t *testing.T) {
+	s := storage.NewStorage()
+	// cancel 为 nil（如 MULTI 中）时不阻塞
+	resp, _ := BLPop(s, []string{"q", "0"}, nil)
+	if resp2(resp) != "*-1\r\n" {
+		t.Fatalf("expected null array, got %q", resp2(resp))
+	}
+	RPush(s, []string{"q", "a", "b"})
+	resp, _ = BLMPop(s, []string{"0", "1", "q", "RIGHT", "COUNT", "5"}, nil)
+	if resp2(resp) != "*2\r\n$1\r\nq\r\n*2\r\n$1\r\nb\r\n$1\r\na\r\n" {
+		t.Fatalf("unexpected BLMPOP reply %q", resp2(resp))
+	}
+	resp, _ = BLPop(s, []string{"q", "-1"}, nil)
+	if resp2(resp) != "-ERR timeout is negative\r\n" {
+		t.Fatalf("expected negative timeout error, got %q", resp2(resp))
+	}
+}
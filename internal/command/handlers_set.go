@@ -0,0 +1,234 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// SADD key member [member ...]
+func SAdd(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("sadd"), nil
+	}
+	n, err := store.SAdd(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// SREM key member [member ...]
+func SRem(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("srem"), nil
+	}
+	n, err := store.SRem(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// SISMEMBER key member
+func SIsMember(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("sismember"), nil
+	}
+	ok, err := store.SIsMember(args[0], args[1])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return boolReply(ok), nil
+}
+
+// SMISMEMBER key member [member ...]
+func SMIsMember(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("smismember"), nil
+	}
+	res, err := store.SMIsMember(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	ints := make([]int, len(res))
+	for i, ok := range res {
+		if ok {
+			ints[i] = 1
+		}
+	}
+	return intArrayReply(ints), nil
+}
+
+// SMEMBERS key
+func SMembers(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("smembers"), nil
+	}
+	members, err := store.SMembers(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return setReply(members), nil
+}
+
+// SCARD key
+func SCard(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("scard"), nil
+	}
+	n, err := store.SCard(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// SPOP key [count]
+func SPop(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.WrongArgs("spop"), nil
+	}
+	if len(args) == 1 {
+		members, err := store.SPop(args[0], 1)
+		if err != nil {
+			return errReply(err), nil
+		}
+		if len(members) == 0 {
+			return protocol.NullBulk, nil
+		}
+		return protocol.Bulk(members[0]), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count < 0 {
+		return protocol.Error("ERR value is out of range, must be positive"), nil
+	}
+	members, err := store.SPop(args[0], count)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.BulkStrings(members), nil
+}
+
+// SRANDMEMBER key [count]
+func SRandMember(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.WrongArgs("srandmember"), nil
+	}
+	if len(args) == 1 {
+		members, err := store.SRandMember(args[0], 1)
+		if err != nil {
+			return errReply(err), nil
+		}
+		if len(members) == 0 {
+			return protocol.NullBulk, nil
+		}
+		return protocol.Bulk(members[0]), nil
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	members, err := store.SRandMember(args[0], count)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.BulkStrings(members), nil
+}
+
+// SMOVE source destination member
+func SMove(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("smove"), nil
+	}
+	ok, err := store.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return boolReply(ok), nil
+}
+
+func setOpCommand(name string, op storage.SetOp, store *storage.Storage, args []string) protocol.Reply {
+	if len(args) < 1 {
+		return protocol.WrongArgs(name)
+	}
+	members, err := store.SetOperation(op, args)
+	if err != nil {
+		return errReply(err)
+	}
+	return setReply(members)
+}
+
+func setOpStoreCommand(name string, op storage.SetOp, store *storage.Storage, args []string) protocol.Reply {
+	if len(args) < 2 {
+		return protocol.WrongArgs(name)
+	}
+	n, err := store.SetOperationStore(op, args[0], args[1:])
+	if err != nil {
+		return errReply(err)
+	}
+	return protocol.Integer(int64(n))
+}
+
+// SINTER key [key ...]
+func SInter(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpCommand("sinter", storage.SetInter, store, args), nil
+}
+
+// SUNION key [key ...]
+func SUnion(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpCommand("sunion", storage.SetUnion, store, args), nil
+}
+
+// SDIFF key [key ...]
+func SDiff(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpCommand("sdiff", storage.SetDiff, store, args), nil
+}
+
+// SINTERSTORE destination key [key ...]
+func SInterStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpStoreCommand("sinterstore", storage.SetInter, store, args), nil
+}
+
+// SUNIONSTORE destination key [key ...]
+func SUnionStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpStoreCommand("sunionstore", storage.SetUnion, store, args), nil
+}
+
+// SDIFFSTORE destination key [key ...]
+func SDiffStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return setOpStoreCommand("sdiffstore", storage.SetDiff, store, args), nil
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func SInterCard(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("sintercard"), nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return protocol.Error("ERR numkeys should be greater than 0"), nil
+	}
+	if len(args) < n+1 {
+		return protocol.Error("ERR Number of keys can't be greater than number of args"), nil
+	}
+	keys := args[1 : n+1]
+	limit := 0
+	rest := args[n+1:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(rest[0], "LIMIT") {
+			return protocol.ErrSyntax, nil
+		}
+		limit, err = strconv.Atoi(rest[1])
+		if err != nil || limit < 0 {
+			return protocol.Error("ERR LIMIT can't be negative"), nil
+		}
+	}
+	card, err := store.SInterCard(keys, limit)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(card)), nil
+}
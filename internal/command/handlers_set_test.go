@@ -0,0 +1,62 @@
+package command
+
+import (
+	"redisx/internal/storage"
+	"testing"
+)
+
+func TestSAddSIsMember(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := SAdd(s, []string{"tags", "go", "redis", "go"})
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", resp2(resp))
+	}
+	resp, _ = SMIsMember(s, []string{"tags", "go", "rust"})
+	if resp2(resp) != "*2\r\n:1\r\n:0\r\n" {
+		t.Fatalf("unexpected SMISMEMBER reply %q", resp2(resp))
+	}
+}
+
+func TestSInterCardReply(t *testing.T) {
+	s := storage.NewStorage()
+	SAdd(s, []string{"a", "1", "2", "3"})
+	SAdd(s, []string{"b", "1", "2", "3"})
+	resp, _ := SInterCard(s, []string{"2", "a", "b", "LIMIT", "2"})
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", resp2(resp))
+	}
+	resp, _ = SInterCard(s, []string{"3", "a", "b"})
+	if resp2(resp) != "-ERR Number of keys can't be greater than number of args\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+}
+
+func TestSPopReplies(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := SPop(s, []string{"missing"})
+	if resp2(resp) != "$-1\r\n" {
+		t.Fatalf("expected null bulk, got %q", resp2(resp))
+	}
+	SAdd(s, []string{"s", "only"})
+	resp, _ = SPop(s, []string{"s", "3"})
+	if resp2(resp) != "*1\r\n$4\r\nonly\r\n" {
+		t.Fatalf("unexpected SPOP count reply %q", resp2(resp))
+	}
+}
+
+func TestSRandMemberOutOfRange(t *testing.T) {
+	s := storage.NewStorage()
+	SAdd(s, []string{"s", "only"})
+	resp, _ := SRandMember(s, []string{"s", "-9223372036854775808"})
+	if resp2(resp) != "-ERR value is out of range\r\n" {
+		t.Fatalf("expected out of range, got %q", resp2(resp))
+	}
+	resp, _ = SRandMember(s, []string{"s", "-1000000000000"})
+	if resp2(resp) != "-ERR value is out of range\r\n" {
+		t.Fatalf("expected out of range, got %q", resp2(resp))
+	}
+	resp, _ = SRandMember(s, []string{"s", "-2"})
+	if resp2(resp) != "*2\r\n$4\r\nonly\r\n$4\r\nonly\r\n" {
+		t.Fatalf("unexpected SRANDMEMBER reply %q", resp2(resp))
+	}
+}
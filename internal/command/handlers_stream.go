@@ -0,0 +1,799 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+var invalidStreamIDErr = protocol.Error("ERR Invalid stream ID specified as stream command argument")
+
+// streamEntryReply 输出 [id, [field, value, ...]]；Fields 为 nil（条目已删除）时输出 null 数组
+func streamEntryReply(e storage.StreamEntry) protocol.Reply {
+	if e.Fields == nil {
+		return protocol.Array{protocol.Bulk(e.ID.String()), protocol.NullArray}
+	}
+	return protocol.Array{protocol.Bulk(e.ID.String()), protocol.BulkStrings(e.Fields)}
+}
+
+func streamEntriesReply(entries []storage.StreamEntry) protocol.Reply {
+	out := make(protocol.Array, len(entries))
+	for i, e := range entries {
+		out[i] = streamEntryReply(e)
+	}
+	return out
+}
+
+// streamIDsReply 输出 ID 数组（JUSTID 等场景）
+func streamIDsReply(ids []storage.StreamID) protocol.Reply {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return protocol.BulkStrings(out)
+}
+
+// parseRangeID 解析 XRANGE 的边界："-"、"+"、不完整 ID 以及 "(" 开头的开区间
+func parseRangeID(s string, start bool) (storage.StreamID, protocol.Reply) {
+	switch s {
+	case "-":
+		return storage.StreamID{}, nil
+	case "+":
+		return storage.MaxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	missingSeq := uint64(0)
+	if !start {
+		missingSeq = storage.MaxStreamID.Seq
+	}
+	id, err := storage.ParseStreamID(s, missingSeq)
+	if err != nil {
+		return id, invalidStreamIDErr
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if start {
+		id, ok = id.Next()
+		if !ok {
+			return id, protocol.Error("ERR invalid start ID for the interval")
+		}
+	} else {
+		id, ok = id.Prev()
+		if !ok {
+			return id, protocol.Error("ERR invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+// parseTrim 解析 MAXLEN|MINID [=|~] threshold [LIMIT count]，返回消耗的参数个数
+func parseTrim(args []string) (storage.XTrimOptions, int, protocol.Reply) {
+	var opts storage.XTrimOptions
+	if strings.EqualFold(args[0], "MAXLEN") {
+		opts.Strategy = storage.TrimMaxLen
+	} else {
+		opts.Strategy = storage.TrimMinID
+	}
+	i := 1
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		opts.Approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return opts, 0, protocol.ErrSyntax
+	}
+	if opts.Strategy == storage.TrimMaxLen {
+		n, err := strconv.ParseInt(args[i], 10, 64)
+		if err != nil {
+			return opts, 0, protocol.ErrNotInteger
+		}
+		if n < 0 {
+			return opts, 0, protocol.Error("ERR The MAXLEN argument must be >= 0.")
+		}
+		opts.MaxLen = n
+	} else {
+		id, err := storage.ParseStreamID(args[i], 0)
+		if err != nil {
+			return opts, 0, invalidStreamIDErr
+		}
+		opts.MinID = id
+	}
+	i++
+	if i+1 < len(args) && strings.EqualFold(args[i], "LIMIT") {
+		if !opts.Approx {
+			return opts, 0, protocol.Error("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n < 0 {
+			return opts, 0, protocol.Error("ERR The LIMIT argument must be >= 0.")
+		}
+		opts.Limit = n
+		i += 2
+	}
+	return opts, i, nil
+}
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func XAdd(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 4 {
+		return protocol.WrongArgs("xadd"), nil
+	}
+	noMkStream := false
+	var trim *storage.XTrimOptions
+	i := 1
+loop:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			opts, n, errResp := parseTrim(args[i:])
+			if errResp != nil {
+				return errResp, nil
+			}
+			trim = &opts
+			i += n
+		default:
+			break loop
+		}
+	}
+	rest := args[i:]
+	if len(rest) < 3 || len(rest)%2 == 0 {
+		return protocol.WrongArgs("xadd"), nil
+	}
+	id, err := storage.ParseXAddID(rest[0])
+	if err != nil {
+		return invalidStreamIDErr, nil
+	}
+	newID, ok, err := store.XAdd(args[0], noMkStream, id, rest[1:], trim)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Bulk(newID.String()), nil
+}
+
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func XTrim(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("xtrim"), nil
+	}
+	s := strings.ToUpper(args[1])
+	if s != "MAXLEN" && s != "MINID" {
+		return protocol.ErrSyntax, nil
+	}
+	opts, n, errResp := parseTrim(args[1:])
+	if errResp != nil {
+		return errResp, nil
+	}
+	if 1+n != len(args) {
+		return protocol.ErrSyntax, nil
+	}
+	removed, err := store.XTrim(args[0], opts)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(removed), nil
+}
+
+// XLEN key
+func XLen(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("xlen"), nil
+	}
+	n, err := store.XLen(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+func xrangeCommand(name string, store *storage.Storage, args []string, rev bool) protocol.Reply {
+	if len(args) != 3 && len(args) != 5 {
+		return protocol.WrongArgs(name)
+	}
+	lo, hi := args[1], args[2]
+	if rev {
+		lo, hi = hi, lo
+	}
+	start, errResp := parseRangeID(lo, true)
+	if errResp != nil {
+		return errResp
+	}
+	end, errResp := parseRangeID(hi, false)
+	if errResp != nil {
+		return errResp
+	}
+	count := 0
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "COUNT") {
+			return protocol.ErrSyntax
+		}
+		n, err := strconv.Atoi(args[4])
+		if err != nil {
+			return protocol.ErrNotInteger
+		}
+		if n <= 0 {
+			return protocol.EmptyArray
+		}
+		count = n
+	}
+	entries, err := store.XRange(args[0], start, end, count, rev)
+	if err != nil {
+		return errReply(err)
+	}
+	return streamEntriesReply(entries)
+}
+
+// XRANGE key start end [COUNT count]
+func XRange(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return xrangeCommand("xrange", store, args, false), nil
+}
+
+// XREVRANGE key end start [COUNT count]
+func XRevRange(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return xrangeCommand("xrevrange", store, args, true), nil
+}
+
+// parseStreamIDs 解析一组完整或不完整的 ID
+func parseStreamIDs(args []string) ([]storage.StreamID, protocol.Reply) {
+	ids := make([]storage.StreamID, len(args))
+	for i, a := range args {
+		id, err := storage.ParseStreamID(a, 0)
+		if err != nil {
+			return nil, invalidStreamIDErr
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// XDEL key id [id ...]
+func XDel(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("xdel"), nil
+	}
+	ids, errResp := parseStreamIDs(args[1:])
+	if errResp != nil {
+		return errResp, nil
+	}
+	n, err := store.XDel(args[0], ids)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// xreadOptions 为 XREAD/XREADGROUP 的公共选项
+type xreadOptions struct {
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	group    string
+	consumer string
+	streams  []storage.XReadArg
+}
+
+// parseXRead 解析 [GROUP g c] [COUNT n] [BLOCK ms] [NOACK] STREAMS key... id...
+func parseXRead(name string, args []string, group bool) (xreadOptions, protocol.Reply) {
+	var opts xreadOptions
+	i := 0
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if opt == "STREAMS" {
+			i++
+			break
+		}
+		switch {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, protocol.ErrNotInteger
+			}
+			if n > 0 {
+				opts.count = n
+			}
+			i++
+		case opt == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return opts, protocol.Error("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return opts, protocol.Error("ERR timeout is negative")
+			}
+			opts.block, opts.timeout = true, time.Duration(ms)*time.Millisecond
+			i++
+		case opt == "GROUP" && group && i+2 < len(args):
+			opts.group, opts.consumer = args[i+1], args[i+2]
+			i += 2
+		case opt == "NOACK" && group:
+			opts.noAck = true
+		default:
+			return opts, protocol.ErrSyntax
+		}
+	}
+	if group && opts.group == "" {
+		return opts, protocol.Error("ERR Missing GROUP option for XREADGROUP")
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return opts, protocol.Error("ERR Unbalanced '" + name + "' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	n := len(rest) / 2
+	for k := 0; k < n; k++ {
+		a := storage.XReadArg{Key: rest[k]}
+		switch idArg := rest[n+k]; {
+		case idArg == "$" && !group:
+			a.Latest = true
+		case idArg == "$":
+			return opts, protocol.Error("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		case idArg == ">" && group:
+			a.New = true
+		case idArg == ">":
+			return opts, protocol.Error("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, err := storage.ParseStreamID(idArg, 0)
+			if err != nil {
+				return opts, invalidStreamIDErr
+			}
+			a.ID = id
+		}
+		opts.streams = append(opts.streams, a)
+	}
+	return opts, nil
+}
+
+// xreadReply 输出 [[key, entries], ...]，没有结果时为 null 数组
+func xreadReply(res []storage.StreamResult) protocol.Reply {
+	if res == nil {
+		return protocol.NullArray
+	}
+	out := make(protocol.Array, len(res))
+	for i, r := range res {
+		out[i] = protocol.Array{protocol.Bulk(r.Key), streamEntriesReply(r.Entries)}
+	}
+	return out
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func XRead(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("xread"), nil
+	}
+	opts, errResp := parseXRead("xread", args, false)
+	if errResp != nil {
+		return errResp, nil
+	}
+	timeout := time.Duration(-1)
+	if opts.block {
+		timeout = blockTimeout(opts.timeout, cancel)
+	}
+	res, err := store.XRead(opts.streams, opts.count, timeout, cancel)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return xreadReply(res), nil
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func XReadGroup(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	if len(args) < 6 {
+		return protocol.WrongArgs("xreadgroup"), nil
+	}
+	opts, errResp := parseXRead("xreadgroup", args, true)
+	if errResp != nil {
+		return errResp, nil
+	}
+	timeout := time.Duration(-1)
+	if opts.block {
+		timeout = blockTimeout(opts.timeout, cancel)
+	}
+	res, err := store.XReadGroup(opts.group, opts.consumer, opts.streams, opts.count, opts.noAck, timeout, cancel)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return xreadReply(res), nil
+}
+
+// parseGroupID 解析 XGROUP 的 id|$ 与可选的 ENTRIESREAD
+func parseGroupID(idArg string, rest []string, allowMkStream bool) (id storage.StreamID, latest, mkStream bool, entriesRead int64, errResp protocol.Reply) {
+	entriesRead = -1
+	if idArg == "$" {
+		latest = true
+	} else {
+		var err error
+		if id, err = storage.ParseStreamID(idArg, 0); err != nil {
+			return id, false, false, 0, invalidStreamIDErr
+		}
+	}
+	for i := 0; i < len(rest); i++ {
+		switch opt := strings.ToUpper(rest[i]); {
+		case opt == "MKSTREAM" && allowMkStream:
+			mkStream = true
+		case opt == "ENTRIESREAD" && i+1 < len(rest):
+			n, err := strconv.ParseInt(rest[i+1], 10, 64)
+			if err != nil {
+				return id, false, false, 0, protocol.ErrNotInteger
+			}
+			if n < -1 {
+				return id, false, false, 0, protocol.Error("ERR value for ENTRIESREAD must be positive or -1")
+			}
+			entriesRead = n
+			i++
+		default:
+			return id, false, false, 0, protocol.ErrSyntax
+		}
+	}
+	return id, latest, mkStream, entriesRead, nil
+}
+
+// XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER ...
+func XGroup(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 {
+		return protocol.WrongArgs("xgroup"), nil
+	}
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "CREATE" && len(args) >= 4:
+		id, latest, mk, entriesRead, errResp := parseGroupID(args[3], args[4:], true)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if err := store.XGroupCreate(args[1], args[2], id, latest, mk, entriesRead); err != nil {
+			return errReply(err), nil
+		}
+		return protocol.OK, nil
+	case sub == "SETID" && len(args) >= 4:
+		id, latest, _, entriesRead, errResp := parseGroupID(args[3], args[4:], false)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if err := store.XGroupSetID(args[1], args[2], id, latest, entriesRead); err != nil {
+			return errReply(err), nil
+		}
+		return protocol.OK, nil
+	case sub == "DESTROY" && len(args) == 3:
+		ok, err := store.XGroupDestroy(args[1], args[2])
+		if err != nil {
+			return errReply(err), nil
+		}
+		if ok {
+			return protocol.Integer(1), nil
+		}
+		return protocol.Integer(0), nil
+	case sub == "CREATECONSUMER" && len(args) == 4:
+		ok, err := store.XGroupCreateConsumer(args[1], args[2], args[3])
+		if err != nil {
+			return errReply(err), nil
+		}
+		if ok {
+			return protocol.Integer(1), nil
+		}
+		return protocol.Integer(0), nil
+	case sub == "DELCONSUMER" && len(args) == 4:
+		n, err := store.XGroupDelConsumer(args[1], args[2], args[3])
+		if err != nil {
+			return errReply(err), nil
+		}
+		return protocol.Integer(int64(n)), nil
+	case sub == "CREATE" || sub == "SETID" || sub == "DESTROY" || sub == "CREATECONSUMER" || sub == "DELCONSUMER":
+		return protocol.WrongArgs("xgroup|" + strings.ToLower(sub)), nil
+	}
+	return protocol.Error("ERR unknown subcommand '" + args[0] + "'. Try XGROUP HELP."), nil
+}
+
+// XACK key group id [id ...]
+func XAck(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("xack"), nil
+	}
+	ids, errResp := parseStreamIDs(args[2:])
+	if errResp != nil {
+		return errResp, nil
+	}
+	n, err := store.XAck(args[0], args[1], ids)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func XPending(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("xpending"), nil
+	}
+	key, group := args[0], args[1]
+	if len(args) == 2 {
+		sum, err := store.XPendingSummary(key, group)
+		if err != nil {
+			return errReply(err), nil
+		}
+		if sum.Count == 0 {
+			return protocol.Array{protocol.Integer(0), protocol.NullBulk, protocol.NullBulk, protocol.NullArray}, nil
+		}
+		consumers := make(protocol.Array, len(sum.Consumers))
+		for i, c := range sum.Consumers {
+			consumers[i] = protocol.BulkStrings{c.Name, strconv.Itoa(c.Count)}
+		}
+		return protocol.Array{
+			protocol.Integer(sum.Count),
+			protocol.Bulk(sum.Min.String()),
+			protocol.Bulk(sum.Max.String()),
+			consumers,
+		}, nil
+	}
+
+	rest := args[2:]
+	minIdle := int64(0)
+	if strings.EqualFold(rest[0], "IDLE") {
+		if len(rest) < 2 {
+			return protocol.ErrSyntax, nil
+		}
+		n, err := strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return protocol.ErrNotInteger, nil
+		}
+		minIdle = n
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return protocol.ErrSyntax, nil
+	}
+	start, errResp := parseRangeID(rest[0], true)
+	if errResp != nil {
+		return errResp, nil
+	}
+	end, errResp := parseRangeID(rest[1], false)
+	if errResp != nil {
+		return errResp, nil
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return protocol.ErrNotInteger, nil
+	}
+	if count <= 0 {
+		return protocol.EmptyArray, nil
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = rest[3]
+	}
+	infos, err := store.XPendingRange(key, group, minIdle, start, end, count, consumer)
+	if err != nil {
+		return errReply(err), nil
+	}
+	out := make(protocol.Array, len(infos))
+	for i, p := range infos {
+		out[i] = protocol.Array{
+			protocol.Bulk(p.ID.String()),
+			protocol.Bulk(p.Consumer),
+			protocol.Integer(p.Idle),
+			protocol.Integer(p.DeliveryCount),
+		}
+	}
+	return out, nil
+}
+
+// parseMinIdle 解析 min-idle-time（毫秒）
+func parseMinIdle(s string) (int64, protocol.Reply) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, protocol.Error("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, nil
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func XClaim(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 5 {
+		return protocol.WrongArgs("xclaim"), nil
+	}
+	minIdle, errResp := parseMinIdle(args[3])
+	if errResp != nil {
+		return errResp, nil
+	}
+	i := 4
+	var ids []storage.StreamID
+	for ; i < len(args); i++ {
+		id, err := storage.ParseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return invalidStreamIDErr, nil
+	}
+	opts := storage.XClaimOptions{Idle: -1, Time: -1, RetryCount: -1}
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "FORCE":
+			opts.Force = true
+		case opt == "JUSTID":
+			opts.JustID = true
+		case (opt == "IDLE" || opt == "TIME" || opt == "RETRYCOUNT") && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return protocol.Error("ERR Invalid " + opt + " option argument for XCLAIM"), nil
+			}
+			switch opt {
+			case "IDLE":
+				opts.Idle = n
+			case "TIME":
+				opts.Time = n
+			default:
+				opts.RetryCount = n
+			}
+			i++
+		case opt == "LASTID" && i+1 < len(args):
+			id, err := storage.ParseStreamID(args[i+1], 0)
+			if err != nil {
+				return invalidStreamIDErr, nil
+			}
+			opts.LastID = &id
+			i++
+		default:
+			return protocol.Error("ERR Unrecognized XCLAIM option '" + args[i] + "'"), nil
+		}
+	}
+	entries, err := store.XClaim(args[0], args[1], args[2], minIdle, ids, opts)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if opts.JustID {
+		claimed := make([]storage.StreamID, len(entries))
+		for i, e := range entries {
+			claimed[i] = e.ID
+		}
+		return streamIDsReply(claimed), nil
+	}
+	return streamEntriesReply(entries), nil
+}
+
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func XAutoClaim(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 5 {
+		return protocol.WrongArgs("xautoclaim"), nil
+	}
+	minIdle, errResp := parseMinIdle(args[3])
+	if errResp != nil {
+		return errResp, nil
+	}
+	start, errResp := parseRangeID(args[4], true)
+	if errResp != nil {
+		return errResp, nil
+	}
+	count, justID := 100, false
+	for i := 5; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return protocol.ErrNotInteger, nil
+			}
+			if n <= 0 {
+				return protocol.Error("ERR COUNT must be > 0"), nil
+			}
+			count = n
+			i++
+		case opt == "JUSTID":
+			justID = true
+		default:
+			return protocol.ErrSyntax, nil
+		}
+	}
+	next, claimed, deleted, err := store.XAutoClaim(args[0], args[1], args[2], minIdle, start, count, justID)
+	if err != nil {
+		return errReply(err), nil
+	}
+	var entries protocol.Reply
+	if justID {
+		ids := make([]string, len(claimed))
+		for i, e := range claimed {
+			ids[i] = e.ID.String()
+		}
+		entries = protocol.BulkStrings(ids)
+	} else {
+		entries = streamEntriesReply(claimed)
+	}
+	return protocol.Array{protocol.Bulk(next.String()), entries, streamIDsReply(deleted)}, nil
+}
+
+// XINFO STREAM key | GROUPS key | CONSUMERS key group
+func XInfo(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 1 {
+		return protocol.WrongArgs("xinfo"), nil
+	}
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "STREAM" && len(args) == 2:
+		info, ok, err := store.XInfoStream(args[1])
+		if err != nil {
+			return errReply(err), nil
+		}
+		if !ok {
+			return errReply(storage.ErrNoSuchKey), nil
+		}
+		out := protocol.Map{
+			protocol.Bulk("length"), protocol.Integer(info.Length),
+			protocol.Bulk("last-generated-id"), protocol.Bulk(info.LastGeneratedID.String()),
+			protocol.Bulk("max-deleted-entry-id"), protocol.Bulk(info.MaxDeletedID.String()),
+			protocol.Bulk("entries-added"), protocol.Integer(info.EntriesAdded),
+			protocol.Bulk("recorded-first-entry-id"), protocol.Bulk(info.FirstID.String()),
+			protocol.Bulk("groups"), protocol.Integer(info.Groups),
+		}
+		for _, e := range []struct {
+			name  string
+			entry *storage.StreamEntry
+		}{{"first-entry", info.First}, {"last-entry", info.Last}} {
+			out = append(out, protocol.Bulk(e.name))
+			if e.entry == nil {
+				out = append(out, protocol.NullBulk)
+			} else {
+				out = append(out, streamEntryReply(*e.entry))
+			}
+		}
+		return out, nil
+	case sub == "GROUPS" && len(args) == 2:
+		groups, err := store.XInfoGroups(args[1])
+		if err != nil {
+			return errReply(err), nil
+		}
+		out := make(protocol.Array, len(groups))
+		for i, g := range groups {
+			out[i] = protocol.Map{
+				protocol.Bulk("name"), protocol.Bulk(g.Name),
+				protocol.Bulk("consumers"), protocol.Integer(g.Consumers),
+				protocol.Bulk("pending"), protocol.Integer(g.Pending),
+				protocol.Bulk("last-delivered-id"), protocol.Bulk(g.LastID.String()),
+				protocol.Bulk("entries-read"), optionalInt(g.EntriesRead),
+				protocol.Bulk("lag"), optionalInt(g.Lag),
+			}
+		}
+		return out, nil
+	case sub == "CONSUMERS" && len(args) == 3:
+		consumers, err := store.XInfoConsumers(args[1], args[2])
+		if err != nil {
+			return errReply(err), nil
+		}
+		out := make(protocol.Array, len(consumers))
+		for i, c := range consumers {
+			out[i] = protocol.Map{
+				protocol.Bulk("name"), protocol.Bulk(c.Name),
+				protocol.Bulk("pending"), protocol.Integer(c.Pending),
+				protocol.Bulk("idle"), protocol.Integer(c.Idle),
+				protocol.Bulk("inactive"), protocol.Integer(c.Inactive),
+			}
+		}
+		return out, nil
+	case sub == "STREAM" || sub == "GROUPS" || sub == "CONSUMERS":
+		return protocol.WrongArgs("xinfo|" + strings.ToLower(sub)), nil
+	}
+	return protocol.Error("ERR unknown subcommand '" + args[0] + "'. Try XINFO HELP."), nil
+}
+
+// optionalInt 输出整数，负数表示未知，输出 null
+func optionalInt(n int64) protocol.Reply {
+	if n < 0 {
+		return protocol.NullBulk
+	}
+	return protocol.Integer(n)
+}
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"redisx/internal/storage"
+	"testing"
+)
+
+func TestXAddAndRangeReplies(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := XAdd(s, []string{"s", "1-1", "name", "alice"})
+	if resp2(resp) != "$3\r\n1-1\r\n" {
+		t.Fatalf("unexpected XADD reply %q", resp2(resp))
+	}
+	XAdd(s, []string{"s", "2-0", "name", "bob"})
+	resp, _ = XAdd(s, []string{"s", "1-0", "x", "y"})
+	if resp2(resp) != "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XAdd(s, []string{"s", "MAXLEN", "10", "LIMIT", "5", "*", "a", "b"})
+	if resp2(resp) != "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XAdd(s, []string{"s", "3-0", "odd"})
+	if resp2(resp) != "-ERR wrong number of arguments for 'xadd' command\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XRange(s, []string{"s", "(1-1", "+"})
+	if resp2(resp) != "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$4\r\nname\r\n$3\r\nbob\r\n" {
+		t.Fatalf("unexpected XRANGE reply %q", resp2(resp))
+	}
+	resp, _ = XRevRange(s, []string{"s", "+", "-", "COUNT", "1"})
+	if resp2(resp) != "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$4\r\nname\r\n$3\r\nbob\r\n" {
+		t.Fatalf("unexpected XREVRANGE reply %q", resp2(resp))
+	}
+	resp, _ = XAdd(s, []string{"s", "MAXLEN", "=", "1", "3-0", "name", "carol"})
+	if resp2(resp) != "$3\r\n3-0\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XLen(s, []string{"s"})
+	if resp2(resp) != ":1\r\n" {
+		t.Fatalf("expected :1 after MAXLEN, got %q", resp2(resp))
+	}
+}
+
+func TestXReadGroupReplies(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := XGroup(s, []string{"CREATE", "s", "g", "$", "MKSTREAM"})
+	if resp2(resp) != "+OK\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XGroup(s, []string{"CREATE", "s", "g", "$"})
+	if resp2(resp) != "-BUSYGROUP Consumer Group name already exists\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	XAdd(s, []string{"s", "1-0", "k", "v"})
+	resp, _ = XReadGroup(s, []string{"GROUP", "g", "c", "STREAMS", "s", ">"}, nil)
+	if resp2(resp) != "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nk\r\n$1\r\nv\r\n" {
+		t.Fatalf("unexpected XREADGROUP reply %q", resp2(resp))
+	}
+	// 没有 cancel（如 MULTI 中）时 BLOCK 不阻塞
+	resp, _ = XReadGroup(s, []string{"GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">"}, nil)
+	if resp2(resp) != "*-1\r\n" {
+		t.Fatalf("expected null array, got %q", resp2(resp))
+	}
+	resp, _ = XReadGroup(s, []string{"GROUP", "missing", "c", "STREAMS", "s", ">"}, nil)
+	if resp2(resp) != "-NOGROUP No such key 's' or consumer group 'missing'\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XRead(s, []string{"STREAMS", "s", ">"}, nil)
+	if resp2(resp) != "-ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XPending(s, []string{"s", "g"})
+	if resp2(resp) != "*4\r\n:1\r\n$3\r\n1-0\r\n$3\r\n1-0\r\n*1\r\n*2\r\n$1\r\nc\r\n$1\r\n1\r\n" {
+		t.Fatalf("unexpected XPENDING reply %q", resp2(resp))
+	}
+	resp, _ = XClaim(s, []string{"s", "g", "d", "0", "1-0", "JUSTID"})
+	if resp2(resp) != "*1\r\n$3\r\n1-0\r\n" {
+		t.Fatalf("unexpected XCLAIM reply %q", resp2(resp))
+	}
+	resp, _ = XAck(s, []string{"s", "g", "1-0"})
+	if resp2(resp) != ":1\r\n" {
+		t.Fatalf("unexpected XACK reply %q", resp2(resp))
+	}
+	resp, _ = XAutoClaim(s, []string{"s", "g", "d", "0", "0", "COUNT", "0"})
+	if resp2(resp) != "-ERR COUNT must be > 0\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = XInfo(s, []string{"CONSUMERS", "s", "g"})
+	if r := resp2(resp); r == "" || r[0] != '*' {
+		t.Fatalf("unexpected XINFO reply %q", resp2(resp))
+	}
+}
@@ -1,34 +1,200 @@
 package command
 
 import (
-	"redisx/internal/storage"
+	"strconv"
+	"strings"
 	"testing"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
 )
 
+// resp2 返回回复的 RESP2 编码，nil 为空字符串
+func resp2(r protocol.Reply) string {
+	if r == nil {
+		return ""
+	}
+	return string(protocol.Encode(r, protocol.RESP2))
+}
+
 func TestIncr(t *testing.T) {
 	s := storage.NewStorage()
-	s.Set("k", "1", 0)
+	s.Set("k", []byte("1"), 0)
 	resp, _ := Incr(s, []string{"k"})
-	if string(resp) != ":2\r\n" {
-		t.Fatalf("expected :2, got %q", string(resp))
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", resp2(resp))
 	}
 }
 
 func TestMGet(t *testing.T) {
 	s := storage.NewStorage()
-	s.Set("a", "1", 0)
-	s.Set("b", "2", 0)
-	resp, _ := MGet(s, []string{"a", "x", "b"})
-	if len(resp) == 0 {
-		t.Fatalf("expected response, got empty")
+	s.Set("a", []byte("1"), 0)
+	s.Set("b", []byte("2"), 0)
+	resp, _ := MGet(s, protocol.Args([]string{"a", "x", "b"}))
+	if resp2(resp) != "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n" {
+		t.Fatalf("unexpected MGET reply %q", resp2(resp))
 	}
 }
 
 func TestPersist(t *testing.T) {
 	s := storage.NewStorage()
-	s.Set("p", "v", 1)
+	s.Set("p", []byte("v"), 1)
 	resp, _ := Persist(s, []string{"p"})
-	if string(resp) != ":1\r\n" {
-		t.Fatalf("expected :1, got %q", string(resp))
+	if resp2(resp) != ":1\r\n" {
+		t.Fatalf("expected :1, got %q", resp2(resp))
+	}
+}
+
+func TestSetGetHandlers(t *testing.T) {
+	s := storage.NewStorage()
+	if resp, _ := Set(s, protocol.Args([]string{"k", "v", "PX", "oops"})); resp2(resp) != "-ERR invalid expire time\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	if resp, _ := Set(s, protocol.Args([]string{"k", "v", "EX"})); resp2(resp) != "-ERR syntax error\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	if resp, _ := Set(s, protocol.Args([]string{"k", "v", "PX", "100000"})); resp2(resp) != "+OK\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	if resp, _ := Get(s, protocol.Args([]string{"k"})); resp2(resp) != "$1\r\nv\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	if resp, _ := PTTL(s, []string{"k"}); resp2(resp) == ":-1\r\n" {
+		t.Fatal("expected PX to set a TTL")
+	}
+	if resp, _ := Del(s, []string{"k", "missing"}); resp2(resp) != ":1\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+}
+
+func TestRouterValidate(t *testing.T) {
+	r := NewRouter()
+	r.RegisterBytes("GET", Get)
+	r.RegisterBytes("SET", Set)
+	r.RegisterBlocking("BLPOP", BLPop)
+	cases := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"get", []string{"k"}, ""},
+		{"GET", nil, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"GET", []string{"a", "b"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{"SET", []string{"k", "v", "EX", "1"}, ""},
+		{"BLPOP", []string{"k"}, "-ERR wrong number of arguments for 'blpop' command\r\n"},
+		{"NOPE", nil, "-ERR unknown command\r\n"},
+	}
+	for _, c := range cases {
+		if got := resp2(r.Validate(c.name, protocol.Args(c.args))); got != c.want {
+			t.Errorf("Validate(%s %v) = %q, want %q", c.name, c.args, got, c.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	for in, want := range map[string]string{"get": "GET", "xAdd": "XADD", "RESTORE-asking": "RESTORE-ASKING", "nosuch": "NOSUCH"} {
+		if got := Name([]byte(in)); got != want {
+			t.Errorf("Name(%q) = %q, want %q", in, got, want)
+		}
+	}
+	b := []byte("zrangestore")
+	if n := testing.AllocsPerRun(100, func() { Name(b) }); n != 0 {
+		t.Fatalf("Name allocated %v times for a known command", n)
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	s := storage.NewStorage()
+	// stringArgs 使以字节参数执行的处理器可以按 Handler 调用
+	stringArgs := func(h BytesHandler) Handler {
+		return func(store *storage.Storage, args []string) (protocol.Reply, error) {
+			return h(store, protocol.Args(args))
+		}
+	}
+	run := func(h Handler, name string, args ...string) [][]string {
+		t.Helper()
+		resp, _ := h(s, args)
+		return Propagate(s, name, args, resp)
+	}
+	join := func(cmds [][]string) string {
+		var parts []string
+		for _, c := range cmds {
+			parts = append(parts, strings.Join(c, " "))
+		}
+		return strings.Join(parts, "; ")
+	}
+
+	got := run(stringArgs(Set), "set", "k", "v", "EX", "100")
+	at := strconv.FormatInt(s.PExpireTime("k"), 10)
+	if want := "SET k v; PEXPIREAT k " + at; join(got) != want {
+		t.Fatalf("got %q, want %q", join(got), want)
+	}
+	if got := join(run(stringArgs(Set), "SET", "plain", "v")); got != "SET plain v" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if got := join(run(PExpire, "PEXPIRE", "k", "0")); got != "PERSIST k" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if got := join(run(Expire, "EXPIRE", "missing", "10")); got != "" {
+		t.Fatalf("no-op EXPIRE should not propagate, got %q", got)
+	}
+	if got := join(run(stringArgs(Get), "GET", "k")); got != "" {
+		t.Fatalf("read command should not propagate, got %q", got)
+	}
+	if got := join(run(Incr, "INCR", "k")); got != "" {
+		t.Fatalf("failed command should not propagate, got %q", got)
+	}
+
+	s.SAdd("s", []string{"a"})
+	if got := join(run(SPop, "SPOP", "s")); got != "SREM s a" {
+		t.Fatalf("unexpected %q", got)
+	}
+	got = run(XAdd, "XADD", "st", "MAXLEN", "~", "10", "*", "f", "v")
+	if len(got) != 1 || got[0][5] == "*" || got[0][5] == "" {
+		t.Fatalf("expected generated ID to be recorded, got %v", got)
+	}
+	id := got[0][5]
+	s.XGroupCreate("st", "g", storage.StreamID{}, false, false, -1)
+	s.XReadGroup("g", "alice", []storage.XReadArg{{Key: "st", New: true}}, 0, false, -1, nil)
+	if got := join(run(XClaim, "XCLAIM", "st", "g", "bob", "0", id, "0-1", "IDLE", "5", "RETRYCOUNT", "3")); got != "XCLAIM st g bob 0 "+id+" RETRYCOUNT 3" {
+		t.Fatalf("unexpected %q", got)
+	}
+
+	payload, _ := s.Dump("st")
+	got = run(Restore, "RESTORE", "r", "10000", payload)
+	at = strconv.FormatInt(s.PExpireTime("r"), 10)
+	if len(got) != 1 || strings.Join(got[0][:3], " ") != "RESTORE r "+at || strings.Join(got[0][4:], " ") != "REPLACE ABSTTL" {
+		t.Fatalf("expected RESTORE with an absolute TTL, got %v", got)
+	}
+	if got := Propagate(s, "MIGRATE", []string{"h", "1", "", "0", "10", "KEYS", "a", "b"}, protocol.OK); join(got) != "DEL a b" {
+		t.Fatalf("unexpected %q", join(got))
+	}
+	if got := Propagate(s, "MIGRATE", []string{"h", "1", "a", "0", "10", "COPY"}, protocol.OK); got != nil {
+		t.Fatalf("MIGRATE COPY should not propagate, got %q", join(got))
+	}
+}
+
+func TestKeys(t *testing.T) {
+	cases := []struct {
+		cmd  []string
+		want string
+	}{
+		{[]string{"GET", "k"}, "k"},
+		{[]string{"mget", "a", "b", "c"}, "a b c"},
+		{[]string{"BLPOP", "a", "b", "0"}, "a b"},
+		{[]string{"LMOVE", "a", "b", "LEFT", "RIGHT"}, "a b"},
+		{[]string{"BLMPOP", "0", "2", "a", "b", "LEFT"}, "a b"},
+		{[]string{"ZUNIONSTORE", "d", "2", "a", "b", "WEIGHTS", "1", "2"}, "d a b"},
+		{[]string{"XREADGROUP", "GROUP", "g", "c", "STREAMS", "a", "b", ">", ">"}, "a b"},
+		{[]string{"XGROUP", "CREATE", "s", "g", "$"}, "s"},
+		{[]string{"MIGRATE", "h", "1", "k", "0", "10", "COPY"}, "k"},
+		{[]string{"MIGRATE", "h", "1", "", "0", "10", "REPLACE", "KEYS", "a", "b"}, "a b"},
+		{[]string{"LMPOP", "5", "a"}, ""},
+		{[]string{"PING"}, ""},
+	}
+	for _, c := range cases {
+		if got := strings.Join(Keys(c.cmd[0], c.cmd[1:]), " "); got != c.want {
+			t.Errorf("Keys(%v) = %q, want %q", c.cmd, got, c.want)
+		}
 	}
 }
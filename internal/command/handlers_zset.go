@@ -0,0 +1,531 @@
+package command
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+var (
+	minMaxNotFloatErr = protocol.Error("ERR min or max is not a float")
+	minMaxNotLexErr   = protocol.Error("ERR min or max not valid string range item")
+)
+
+// formatScore 按 Redis 习惯格式化分值：整数不带小数，无穷显示为 inf/-inf
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// parseScore 解析分值，支持 inf/+inf/-inf，拒绝 NaN
+func parseScore(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// parseScoreRange 解析 ZRANGEBYSCORE 风格的区间，"(" 前缀表示开区间
+func parseScoreRange(min, max string) (storage.ScoreRange, bool) {
+	var r storage.ScoreRange
+	var ok bool
+	if strings.HasPrefix(min, "(") {
+		r.MinEx, min = true, min[1:]
+	}
+	if strings.HasPrefix(max, "(") {
+		r.MaxEx, max = true, max[1:]
+	}
+	if r.Min, ok = parseScore(min); !ok {
+		return r, false
+	}
+	if r.Max, ok = parseScore(max); !ok {
+		return r, false
+	}
+	return r, true
+}
+
+func parseLexBound(s string) (storage.LexBound, bool) {
+	switch {
+	case s == "-":
+		return storage.LexBound{Inf: -1}, true
+	case s == "+":
+		return storage.LexBound{Inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return storage.LexBound{Value: s[1:], Inclusive: true}, true
+	case strings.HasPrefix(s, "("):
+		return storage.LexBound{Value: s[1:]}, true
+	}
+	return storage.LexBound{}, false
+}
+
+func parseLexRange(min, max string) (storage.LexRange, bool) {
+	lo, ok1 := parseLexBound(min)
+	hi, ok2 := parseLexBound(max)
+	return storage.LexRange{Min: lo, Max: hi}, ok1 && ok2
+}
+
+// zmembersReply 编码元素列表，withScores 时元素与分值交替输出
+func zmembersReply(members []storage.ZMember, withScores bool) protocol.Reply {
+	n := len(members)
+	if withScores {
+		n *= 2
+	}
+	out := make(protocol.BulkStrings, 0, n)
+	for _, m := range members {
+		out = append(out, m.Member)
+		if withScores {
+			out = append(out, formatScore(m.Score))
+		}
+	}
+	return out
+}
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func ZAdd(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("zadd"), nil
+	}
+	var flags storage.ZAddFlags
+	ch, incr := false, false
+	i := 1
+loop:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			flags.NX = true
+		case "XX":
+			flags.XX = true
+		case "GT":
+			flags.GT = true
+		case "LT":
+			flags.LT = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break loop
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return protocol.ErrSyntax, nil
+	}
+	if flags.NX && flags.XX {
+		return protocol.Error("ERR XX and NX options at the same time are not compatible"), nil
+	}
+	if (flags.GT && flags.LT) || (flags.NX && (flags.GT || flags.LT)) {
+		return protocol.Error("ERR GT, LT, and/or NX options at the same time are not compatible"), nil
+	}
+	if incr && len(pairs) != 2 {
+		return protocol.Error("ERR INCR option supports a single increment-element pair"), nil
+	}
+	members := make([]storage.ZMember, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		sc, ok := parseScore(pairs[j])
+		if !ok {
+			return protocol.ErrNotFloat, nil
+		}
+		members = append(members, storage.ZMember{Member: pairs[j+1], Score: sc})
+	}
+	if incr {
+		sc, ok, err := store.ZAddIncr(args[0], flags, members[0].Member, members[0].Score)
+		if err != nil {
+			return errReply(err), nil
+		}
+		if !ok {
+			return protocol.NullBulk, nil
+		}
+		return protocol.Double(sc), nil
+	}
+	added, updated, err := store.ZAdd(args[0], flags, members)
+	if err != nil {
+		return errReply(err), nil
+	}
+	if ch {
+		return protocol.Integer(int64(added + updated)), nil
+	}
+	return protocol.Integer(int64(added)), nil
+}
+
+// ZINCRBY key increment member
+func ZIncrBy(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("zincrby"), nil
+	}
+	incr, ok := parseScore(args[1])
+	if !ok {
+		return protocol.ErrNotFloat, nil
+	}
+	sc, _, err := store.ZAddIncr(args[0], storage.ZAddFlags{}, args[2], incr)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Double(sc), nil
+}
+
+// ZREM key member [member ...]
+func ZRem(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("zrem"), nil
+	}
+	n, err := store.ZRem(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// ZCARD key
+func ZCard(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 1 {
+		return protocol.WrongArgs("zcard"), nil
+	}
+	n, err := store.ZCard(args[0])
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// ZSCORE key member
+func ZScore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 2 {
+		return protocol.WrongArgs("zscore"), nil
+	}
+	sc, ok, err := store.ZScore(args[0], args[1])
+	if err != nil {
+		return errReply(err), nil
+	}
+	if !ok {
+		return protocol.NullBulk, nil
+	}
+	return protocol.Double(sc), nil
+}
+
+// ZMSCORE key member [member ...]
+func ZMScore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 2 {
+		return protocol.WrongArgs("zmscore"), nil
+	}
+	scores, found, err := store.ZMScore(args[0], args[1:])
+	if err != nil {
+		return errReply(err), nil
+	}
+	out := make(protocol.Array, len(scores))
+	for i, sc := range scores {
+		if found[i] {
+			out[i] = protocol.Double(sc)
+		} else {
+			out[i] = protocol.NullBulk
+		}
+	}
+	return out, nil
+}
+
+func zrankCommand(name string, store *storage.Storage, args []string, rev bool) protocol.Reply {
+	if len(args) < 2 || len(args) > 3 {
+		return protocol.WrongArgs(name)
+	}
+	withScore := false
+	if len(args) == 3 {
+		if !strings.EqualFold(args[2], "WITHSCORE") {
+			return protocol.ErrSyntax
+		}
+		withScore = true
+	}
+	rank, sc, ok, err := store.ZRank(args[0], args[1], rev)
+	if err != nil {
+		return errReply(err)
+	}
+	if !ok {
+		if withScore {
+			return protocol.NullArray
+		}
+		return protocol.NullBulk
+	}
+	if !withScore {
+		return protocol.Integer(int64(rank))
+	}
+	return protocol.Array{protocol.Integer(rank), protocol.Double(sc)}
+}
+
+// ZRANK key member [WITHSCORE]
+func ZRank(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zrankCommand("zrank", store, args, false), nil
+}
+
+// ZREVRANK key member [WITHSCORE]
+func ZRevRank(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zrankCommand("zrevrank", store, args, true), nil
+}
+
+// parseZRange 解析 start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func parseZRange(args []string, allowWithScores bool) (spec storage.ZRangeSpec, withScores bool, errResp protocol.Reply) {
+	spec.Count = -1
+	hasLimit := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			spec.By = storage.ByScore
+		case "BYLEX":
+			spec.By = storage.ByLex
+		case "REV":
+			spec.Rev = true
+		case "WITHSCORES":
+			if !allowWithScores {
+				return spec, false, protocol.ErrSyntax
+			}
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return spec, false, protocol.ErrSyntax
+			}
+			off, err1 := strconv.Atoi(args[i+1])
+			cnt, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return spec, false, protocol.ErrNotInteger
+			}
+			spec.Offset, spec.Count, hasLimit = off, cnt, true
+			i += 2
+		default:
+			return spec, false, protocol.ErrSyntax
+		}
+	}
+	if hasLimit && spec.By == storage.ByRank {
+		return spec, false, protocol.Error("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if withScores && spec.By == storage.ByLex {
+		return spec, false, protocol.Error("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	min, max := args[0], args[1]
+	if spec.Rev && spec.By != storage.ByRank {
+		// REV 配合 BYSCORE/BYLEX 时参数顺序为 max min
+		min, max = max, min
+	}
+	switch spec.By {
+	case storage.ByScore:
+		r, ok := parseScoreRange(min, max)
+		if !ok {
+			return spec, false, minMaxNotFloatErr
+		}
+		spec.Score = r
+	case storage.ByLex:
+		r, ok := parseLexRange(min, max)
+		if !ok {
+			return spec, false, minMaxNotLexErr
+		}
+		spec.Lex = r
+	default:
+		start, err1 := strconv.Atoi(args[0])
+		stop, err2 := strconv.Atoi(args[1])
+		if err1 != nil || err2 != nil {
+			return spec, false, protocol.ErrNotInteger
+		}
+		spec.Start, spec.Stop = start, stop
+	}
+	return spec, withScores, nil
+}
+
+// ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func ZRange(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 3 {
+		return protocol.WrongArgs("zrange"), nil
+	}
+	spec, withScores, errResp := parseZRange(args[1:], true)
+	if errResp != nil {
+		return errResp, nil
+	}
+	members, err := store.ZRange(args[0], spec)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return zmembersReply(members, withScores), nil
+}
+
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func ZRangeStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) < 4 {
+		return protocol.WrongArgs("zrangestore"), nil
+	}
+	spec, _, errResp := parseZRange(args[2:], false)
+	if errResp != nil {
+		return errResp, nil
+	}
+	n, err := store.ZRangeStore(args[0], args[1], spec)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// ZCOUNT key min max
+func ZCount(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("zcount"), nil
+	}
+	r, ok := parseScoreRange(args[1], args[2])
+	if !ok {
+		return minMaxNotFloatErr, nil
+	}
+	n, err := store.ZCount(args[0], r)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+// ZLEXCOUNT key min max
+func ZLexCount(store *storage.Storage, args []string) (protocol.Reply, error) {
+	if len(args) != 3 {
+		return protocol.WrongArgs("zlexcount"), nil
+	}
+	r, ok := parseLexRange(args[1], args[2])
+	if !ok {
+		return minMaxNotLexErr, nil
+	}
+	n, err := store.ZLexCount(args[0], r)
+	if err != nil {
+		return errReply(err), nil
+	}
+	return protocol.Integer(int64(n)), nil
+}
+
+func zpopCommand(name string, store *storage.Storage, args []string, max bool) protocol.Reply {
+	if len(args) < 1 || len(args) > 2 {
+		return protocol.WrongArgs(name)
+	}
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return protocol.Error("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	members, err := store.ZPop(args[0], count, max)
+	if err != nil {
+		return errReply(err)
+	}
+	return zmembersReply(members, true)
+}
+
+// ZPOPMIN key [count]
+func ZPopMin(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zpopCommand("zpopmin", store, args, false), nil
+}
+
+// ZPOPMAX key [count]
+func ZPopMax(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zpopCommand("zpopmax", store, args, true), nil
+}
+
+func bzpopCommand(name string, store *storage.Storage, args []string, cancel <-chan struct{}, max bool) protocol.Reply {
+	if len(args) < 2 {
+		return protocol.WrongArgs(name)
+	}
+	timeout, errResp := parseTimeout(args[len(args)-1])
+	if errResp != nil {
+		return errResp
+	}
+	key, m, ok, err := store.BlockingZPop(args[:len(args)-1], max, blockTimeout(timeout, cancel), cancel)
+	if err != nil {
+		return errReply(err)
+	}
+	if !ok {
+		return protocol.NullArray
+	}
+	return protocol.Array{protocol.Bulk(key), protocol.Bulk(m.Member), protocol.Double(m.Score)}
+}
+
+// BZPOPMIN key [key ...] timeout
+func BZPopMin(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	return bzpopCommand("bzpopmin", store, args, cancel, false), nil
+}
+
+// BZPOPMAX key [key ...] timeout
+func BZPopMax(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error) {
+	return bzpopCommand("bzpopmax", store, args, cancel, true), nil
+}
+
+// zsetOpStoreCommand 解析 destination numkeys key [key ...] [WEIGHTS ...] [AGGREGATE ...]
+func zsetOpStoreCommand(name string, op storage.SetOp, store *storage.Storage, args []string) protocol.Reply {
+	if len(args) < 3 {
+		return protocol.WrongArgs(name)
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n <= 0 {
+		return protocol.Error("ERR at least 1 input key is needed for '" + name + "' command")
+	}
+	if len(args) < n+2 {
+		return protocol.ErrSyntax
+	}
+	keys := args[2 : n+2]
+	var weights []float64
+	agg := storage.AggregateSum
+	for i := n + 2; i < len(args); i++ {
+		switch {
+		case op != storage.SetDiff && strings.EqualFold(args[i], "WEIGHTS"):
+			if i+n >= len(args) {
+				return protocol.ErrSyntax
+			}
+			weights = make([]float64, n)
+			for j := 0; j < n; j++ {
+				w, ok := parseScore(args[i+1+j])
+				if !ok {
+					return protocol.Error("ERR weight value is not a float")
+				}
+				weights[j] = w
+			}
+			i += n
+		case op != storage.SetDiff && strings.EqualFold(args[i], "AGGREGATE"):
+			if i+1 >= len(args) {
+				return protocol.ErrSyntax
+			}
+			switch strings.ToUpper(args[i+1]) {
+			case "SUM":
+				agg = storage.AggregateSum
+			case "MIN":
+				agg = storage.AggregateMin
+			case "MAX":
+				agg = storage.AggregateMax
+			default:
+				return protocol.ErrSyntax
+			}
+			i++
+		default:
+			return protocol.ErrSyntax
+		}
+	}
+	card, err := store.ZSetOperationStore(op, args[0], keys, weights, agg)
+	if err != nil {
+		return errReply(err)
+	}
+	return protocol.Integer(int64(card))
+}
+
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func ZUnionStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zsetOpStoreCommand("zunionstore", storage.SetUnion, store, args), nil
+}
+
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func ZInterStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zsetOpStoreCommand("zinterstore", storage.SetInter, store, args), nil
+}
+
+// ZDIFFSTORE destination numkeys key [key ...]
+func ZDiffStore(store *storage.Storage, args []string) (protocol.Reply, error) {
+	return zsetOpStoreCommand("zdiffstore", storage.SetDiff, store, args), nil
+}
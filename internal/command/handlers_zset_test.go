@@ -0,0 +1,65 @@
+package command
+
+import (
+	"redisx/internal/storage"
+	"testing"
+)
+
+func TestZAddReplies(t *testing.T) {
+	s := storage.NewStorage()
+	resp, _ := ZAdd(s, []string{"lb", "10", "alice", "20", "bob"})
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", resp2(resp))
+	}
+	resp, _ = ZAdd(s, []string{"lb", "CH", "15", "alice", "30", "carol"})
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected CH count 2, got %q", resp2(resp))
+	}
+	resp, _ = ZAdd(s, []string{"lb", "INCR", "1.5", "alice"})
+	if resp2(resp) != "$4\r\n16.5\r\n" {
+		t.Fatalf("expected 16.5, got %q", resp2(resp))
+	}
+	resp, _ = ZAdd(s, []string{"lb", "NX", "XX", "1", "a"})
+	if resp2(resp) != "-ERR XX and NX options at the same time are not compatible\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = ZAdd(s, []string{"lb", "nan", "a"})
+	if resp2(resp) != "-ERR value is not a valid float\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+}
+
+func TestZRangeReplies(t *testing.T) {
+	s := storage.NewStorage()
+	ZAdd(s, []string{"z", "1", "a", "2", "b", "3", "c"})
+	resp, _ := ZRange(s, []string{"z", "(3", "1", "BYSCORE", "REV", "WITHSCORES"})
+	if resp2(resp) != "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Fatalf("unexpected ZRANGE reply %q", resp2(resp))
+	}
+	resp, _ = ZRange(s, []string{"z", "0", "-1", "LIMIT", "0", "1"})
+	if resp2(resp) != "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n" {
+		t.Fatalf("unexpected reply %q", resp2(resp))
+	}
+	resp, _ = ZRangeStore(s, []string{"dst", "z", "[b", "+", "BYLEX"})
+	if resp2(resp) != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", resp2(resp))
+	}
+	resp, _ = ZRank(s, []string{"z", "c", "WITHSCORE"})
+	if resp2(resp) != "*2\r\n:2\r\n$1\r\n3\r\n" {
+		t.Fatalf("unexpected ZRANK reply %q", resp2(resp))
+	}
+}
+
+func TestZUnionStoreReply(t *testing.T) {
+	s := storage.NewStorage()
+	ZAdd(s, []string{"a", "1", "x"})
+	ZAdd(s, []string{"b", "2", "x"})
+	resp, _ := ZUnionStore(s, []string{"out", "2", "a", "b", "WEIGHTS", "1", "3", "AGGREGATE", "SUM"})
+	if resp2(resp) != ":1\r\n" {
+		t.Fatalf("expected :1, got %q", resp2(resp))
+	}
+	resp, _ = ZScore(s, []string{"out", "x"})
+	if resp2(resp) != "$1\r\n7\r\n" {
+		t.Fatalf("expected 7, got %q", resp2(resp))
+	}
+}
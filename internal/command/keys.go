@@ -0,0 +1,119 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+)
+
+// keyRange 描述命令参数中键的位置（args 不含命令名）：从 first 开始每隔 step 个
+// 参数一个键，直到 last；last 为负数时从末尾计数（-1 为最后一个参数）
+type keyRange struct {
+	first, last, step int
+}
+
+var (
+	firstKey   = keyRange{0, 0, 1}
+	allKeys    = keyRange{0, -1, 1}
+	twoKeys    = keyRange{0, 1, 1}
+	keysButEnd = keyRange{0, -2, 1} // 最后一个参数为超时
+)
+
+// keyRanges 为参数位置固定的命令的键位置；numkeys 与 STREAMS 形式的命令见 Keys
+var keyRanges = map[string]keyRange{
+	// 字符串与键
+	"SET": firstKey, "GET": firstKey, "DEL": allKeys, "EXISTS": allKeys, "EXPIRE": firstKey,
+	"PEXPIRE": firstKey, "EXPIREAT": firstKey, "PEXPIREAT": firstKey, "EXPIRETIME": firstKey,
+	"PEXPIRETIME": firstKey, "TTL": firstKey, "PTTL": firstKey, "PERSIST": firstKey,
+	"INCR": firstKey, "MGET": allKeys, "WATCH": allKeys, "DUMP": firstKey, "RESTORE": firstKey,
+	"RESTORE-ASKING": firstKey,
+	// Hash
+	"HSET": firstKey, "HMSET": firstKey, "HSETNX": firstKey, "HGET": firstKey, "HMGET": firstKey,
+	"HDEL": firstKey, "HEXISTS": firstKey, "HLEN": firstKey, "HSTRLEN": firstKey, "HKEYS": firstKey,
+	"HVALS": firstKey, "HGETALL": firstKey, "HINCRBY": firstKey, "HINCRBYFLOAT": firstKey,
+	"HRANDFIELD": firstKey,
+	// List
+	"LPUSH": firstKey, "RPUSH": firstKey, "LPUSHX": firstKey, "RPUSHX": firstKey, "LPOP": firstKey,
+	"RPOP": firstKey, "LLEN": firstKey, "LRANGE": firstKey, "LINDEX": firstKey, "LSET": firstKey,
+	"LINSERT": firstKey, "LREM": firstKey, "LTRIM": firstKey, "LPOS": firstKey, "LMOVE": twoKeys,
+	"RPOPLPUSH": twoKeys, "BLPOP": keysButEnd, "BRPOP": keysButEnd, "BLMOVE": twoKeys,
+	// Set
+	"SADD": firstKey, "SREM": firstKey, "SISMEMBER": firstKey, "SMISMEMBER": firstKey,
+	"SMEMBERS": firstKey, "SCARD": firstKey, "SPOP": firstKey, "SRANDMEMBER": firstKey,
+	"SMOVE": twoKeys, "SINTER": allKeys, "SUNION": allKeys, "SDIFF": allKeys,
+	"SINTERSTORE": allKeys, "SUNIONSTORE": allKeys, "SDIFFSTORE": allKeys,
+	// Sorted set
+	"ZADD": firstKey, "ZINCRBY": firstKey, "ZREM": firstKey, "ZCARD": firstKey, "ZSCORE": firstKey,
+	"ZMSCORE": firstKey, "ZRANK": firstKey, "ZREVRANK": firstKey, "ZRANGE": firstKey,
+	"ZRANGESTORE": twoKeys, "ZCOUNT": firstKey, "ZLEXCOUNT": firstKey, "ZPOPMIN": firstKey,
+	"ZPOPMAX": firstKey, "BZPOPMIN": keysButEnd, "BZPOPMAX": keysButEnd,
+	// Stream
+	"XADD": firstKey, "XTRIM": firstKey, "XLEN": firstKey, "XRANGE": firstKey, "XREVRANGE": firstKey,
+	"XDEL": firstKey, "XACK": firstKey, "XPENDING": firstKey, "XCLAIM": firstKey,
+	"XAUTOCLAIM": firstKey,
+	// 分片频道与键一样属于某个槽
+	"SPUBLISH": firstKey, "SSUBSCRIBE": allKeys,
+}
+
+// Keys returns the keys accessed by a command, in argument order, as used
+// for cluster slot routing. Commands without keys and malformed argument
+// lists (which fail later with a syntax error) return nil.
+func Keys(name string, args []string) []string {
+	name = strings.ToUpper(name)
+	if r, ok := keyRanges[name]; ok {
+		last := r.last
+		if last < 0 {
+			last += len(args)
+		}
+		var keys []string
+		for i := r.first; i <= last && i < len(args); i += r.step {
+			keys = append(keys, args[i])
+		}
+		return keys
+	}
+	switch name {
+	case "LMPOP", "SINTERCARD":
+		// LMPOP numkeys key... / SINTERCARD numkeys key...
+		return numKeys(args, 0, nil)
+	case "BLMPOP":
+		// BLMPOP timeout numkeys key...
+		return numKeys(args, 1, nil)
+	case "ZUNIONSTORE", "ZINTERSTORE", "ZDIFFSTORE":
+		// destination numkeys key...
+		if len(args) == 0 {
+			return nil
+		}
+		return numKeys(args, 1, args[:1])
+	case "XREAD", "XREADGROUP":
+		// STREAMS 之后前一半参数为键，后一半为 ID
+		for i, a := range args {
+			if strings.EqualFold(a, "STREAMS") {
+				rest := args[i+1:]
+				return rest[:len(rest)/2]
+			}
+		}
+	case "MIGRATE":
+		// MIGRATE host port key|"" db timeout [COPY] [REPLACE] [KEYS key...]
+		m, errResp := ParseMigrate(args)
+		if errResp == nil {
+			return m.Keys
+		}
+	case "XGROUP", "XINFO":
+		// 子命令之后的第一个参数为键（XINFO HELP 等没有键）
+		if len(args) >= 2 {
+			return args[1:2]
+		}
+	}
+	return nil
+}
+
+// numKeys 返回 args[i] 给出的键个数之后紧跟的键，追加在 keys 之后
+func numKeys(args []string, i int, keys []string) []string {
+	if i >= len(args) {
+		return keys
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n <= 0 || i+1+n > len(args) {
+		return keys
+	}
+	return append(keys, args[i+1:i+1+n]...)
+}
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// MigrateArgs holds the parsed arguments of MIGRATE.
+type MigrateArgs struct {
+	Addr          string // 目标节点 host:port
+	DB            int
+	Timeout       time.Duration
+	Copy, Replace bool
+	Keys          []string
+}
+
+// ParseMigrate parses the arguments of
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key ...]
+// and returns the error reply for malformed ones. The command itself needs a
+// connection to the target node and is executed by the server.
+func ParseMigrate(args []string) (MigrateArgs, protocol.Reply) {
+	if len(args) < 5 {
+		return MigrateArgs{}, protocol.WrongArgs("migrate")
+	}
+	m := MigrateArgs{Addr: args[0] + ":" + args[1]}
+	db, err := strconv.Atoi(args[3])
+	if err != nil || db < 0 {
+		return m, protocol.ErrNotInteger
+	}
+	timeout, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil || timeout < 0 {
+		return m, protocol.ErrNotInteger
+	}
+	m.DB = db
+	// 与 Redis 一致，timeout 为 0 时使用 1 秒
+	m.Timeout = time.Duration(timeout) * time.Millisecond
+	if timeout == 0 {
+		m.Timeout = time.Second
+	}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COPY":
+			m.Copy = true
+		case "REPLACE":
+			m.Replace = true
+		case "KEYS":
+			if args[2] != "" {
+				return m, protocol.Error("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			m.Keys = args[i+1:]
+			i = len(args)
+		default:
+			return m, protocol.ErrSyntax
+		}
+	}
+	if args[2] != "" {
+		m.Keys = []string{args[2]}
+	}
+	return m, nil
+}
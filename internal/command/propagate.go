@@ -0,0 +1,211 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// writeCommands 为可能修改数据的命令；成功执行后需要传播到 AOF 与副本，只读副本拒绝执行
+var writeCommands = map[string]bool{
+	// 字符串与键
+	"SET": true, "DEL": true, "EXPIRE": true, "PEXPIRE": true, "EXPIREAT": true,
+	"PEXPIREAT": true, "PERSIST": true, "INCR": true, "RESTORE": true, "RESTORE-ASKING": true,
+	"MIGRATE": true,
+	// Hash
+	"HSET": true, "HMSET": true, "HSETNX": true, "HDEL": true, "HINCRBY": true, "HINCRBYFLOAT": true,
+	// List
+	"LPUSH": true, "RPUSH": true, "LPUSHX": true, "RPUSHX": true, "LPOP": true, "RPOP": true,
+	"LSET": true, "LINSERT": true, "LREM": true, "LTRIM": true, "LMOVE": true, "RPOPLPUSH": true,
+	"LMPOP": true, "BLPOP": true, "BRPOP": true, "BLMOVE": true, "BLMPOP": true,
+	// Set
+	"SADD": true, "SREM": true, "SPOP": true, "SMOVE": true,
+	"SINTERSTORE": true, "SUNIONSTORE": true, "SDIFFSTORE": true,
+	// Sorted set
+	"ZADD": true, "ZINCRBY": true, "ZREM": true, "ZRANGESTORE": true, "ZPOPMIN": true, "ZPOPMAX": true,
+	"ZUNIONSTORE": true, "ZINTERSTORE": true, "ZDIFFSTORE": true, "BZPOPMIN": true, "BZPOPMAX": true,
+	// Stream
+	"XADD": true, "XTRIM": true, "XDEL": true, "XGROUP": true, "XACK": true,
+	"XCLAIM": true, "XAUTOCLAIM": true, "XREADGROUP": true,
+}
+
+// IsWrite reports whether the command may modify the dataset.
+func IsWrite(name string) bool {
+	return writeCommands[strings.ToUpper(name)]
+}
+
+// Propagate returns the commands to append to the AOF for a write command
+// that was executed with the given reply. Commands whose effect depends on
+// the time or on randomness are rewritten into a deterministic form: relative
+// TTLs become PEXPIREAT or an ABSTTL RESTORE, MIGRATE becomes DEL of the
+// moved keys, SPOP becomes SREM, XADD records the generated ID and
+// XCLAIM/XAUTOCLAIM record the entries actually claimed. Error replies and
+// non-write commands propagate nothing.
+//
+// Blocking commands called without a cancel channel (inside MULTI or during
+// replay) never block, so they are propagated as is.
+func Propagate(store *storage.Storage, name string, args []string, reply protocol.Reply) [][]string {
+	name = strings.ToUpper(name)
+	if !writeCommands[name] || reply == nil || protocol.IsError(reply) {
+		return nil
+	}
+	cmd := append([]string{name}, args...)
+	switch name {
+	case "SET":
+		for _, a := range args[2:] {
+			if opt := strings.ToUpper(a); opt == "EX" || opt == "PX" {
+				out := [][]string{{"SET", args[0], args[1]}}
+				if t := store.PExpireTime(args[0]); t > 0 {
+					out = append(out, pexpireAt(args[0], t))
+				}
+				return out
+			}
+		}
+	case "EXPIRE", "PEXPIRE", "EXPIREAT":
+		if reply != protocol.Integer(1) {
+			return nil
+		}
+		switch t := store.PExpireTime(args[0]); t {
+		case -2:
+			return [][]string{{"DEL", args[0]}}
+		case -1:
+			return [][]string{{"PERSIST", args[0]}}
+		default:
+			return [][]string{pexpireAt(args[0], t)}
+		}
+	case "RESTORE", "RESTORE-ASKING":
+		// 相对 TTL 改写为绝对时间；键已过期时 RESTORE 只删除了旧值
+		t := store.PExpireTime(args[0])
+		if t == -2 {
+			return [][]string{{"DEL", args[0]}}
+		}
+		return [][]string{{"RESTORE", args[0], strconv.FormatInt(max(t, 0), 10), args[2], "REPLACE", "ABSTTL"}}
+	case "MIGRATE":
+		// 键已迁移到目标节点，本地（COPY 以外）等同于删除
+		m, errResp := ParseMigrate(args)
+		if errResp != nil || m.Copy || reply != protocol.OK {
+			return nil
+		}
+		return [][]string{append([]string{"DEL"}, m.Keys...)}
+	case "SPOP":
+		members := protocol.Strings(reply)
+		if len(members) == 0 {
+			return nil
+		}
+		return [][]string{append([]string{"SREM", args[0]}, members...)}
+	case "XADD":
+		if id, ok := reply.(protocol.Bulk); ok {
+			cmd[xaddIDIndex(args)+1] = string(id)
+			return [][]string{cmd}
+		}
+		return nil
+	case "XCLAIM":
+		return propagateXClaim(args, reply)
+	case "XAUTOCLAIM":
+		return propagateXAutoClaim(args, reply)
+	}
+	return [][]string{cmd}
+}
+
+func pexpireAt(key string, t int64) []string {
+	return []string{"PEXPIREAT", key, strconv.FormatInt(t, 10)}
+}
+
+// xaddIDIndex 返回 XADD 参数（不含命令名）中 ID 的位置
+func xaddIDIndex(args []string) int {
+	i := 1
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			i++
+		case "MAXLEN", "MINID":
+			_, n, _ := parseTrim(args[i:])
+			i += n
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// propagateXClaim 将 XCLAIM 改写为只认领实际被认领的条目、min-idle-time 为 0
+// 的形式；IDLE/TIME 依赖执行时刻，不予保留
+func propagateXClaim(args []string, reply protocol.Reply) [][]string {
+	ids := entryIDs(reply)
+	if len(ids) == 0 {
+		return nil
+	}
+	cmd := append([]string{"XCLAIM", args[0], args[1], args[2], "0"}, ids...)
+	i := 4
+	for i < len(args) {
+		if _, err := storage.ParseStreamID(args[i], 0); err != nil {
+			break
+		}
+		i++
+	}
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "IDLE", "TIME":
+			i++
+		case "RETRYCOUNT", "LASTID":
+			if i+1 < len(args) {
+				cmd = append(cmd, args[i], args[i+1])
+			}
+			i++
+		default:
+			cmd = append(cmd, args[i])
+		}
+	}
+	return [][]string{cmd}
+}
+
+// propagateXAutoClaim 将 XAUTOCLAIM 改写为认领实际条目的 XCLAIM，以及从 PEL
+// 中移除已删除条目的 XACK
+func propagateXAutoClaim(args []string, reply protocol.Reply) [][]string {
+	res, ok := reply.(protocol.Array)
+	if !ok || len(res) < 3 {
+		return nil
+	}
+	justID := false
+	for _, a := range args[5:] {
+		if strings.EqualFold(a, "JUSTID") {
+			justID = true
+		}
+	}
+	var out [][]string
+	if ids := entryIDs(res[1]); len(ids) > 0 {
+		cmd := append([]string{"XCLAIM", args[0], args[1], args[2], "0"}, ids...)
+		if justID {
+			cmd = append(cmd, "JUSTID")
+		}
+		out = append(out, cmd)
+	}
+	if deleted := entryIDs(res[2]); len(deleted) > 0 {
+		out = append(out, append([]string{"XACK", args[0], args[1]}, deleted...))
+	}
+	return out
+}
+
+// entryIDs 从条目数组（[id, fields] 或 JUSTID 形式的 id）中取出 ID
+func entryIDs(r protocol.Reply) []string {
+	items, _ := r.(protocol.Array)
+	if ids, ok := r.(protocol.BulkStrings); ok {
+		return ids
+	}
+	var ids []string
+	for _, it := range items {
+		switch x := it.(type) {
+		case protocol.Bulk:
+			ids = append(ids, string(x))
+		case protocol.Array:
+			if len(x) > 0 {
+				if id, ok := x[0].(protocol.Bulk); ok {
+					ids = append(ids, string(id))
+				}
+			}
+		}
+	}
+	return ids
+}
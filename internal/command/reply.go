@@ -0,0 +1,70 @@
+package command
+
+import (
+	"errors"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/storage"
+)
+
+// errReply 将存储层错误转换为错误回复；WRONGTYPE、NOGROUP 等自带错误码的错误保留自身前缀
+func errReply(err error) protocol.Reply {
+	if errors.Is(err, storage.ErrWrongType) || hasErrorCode(err.Error()) {
+		return protocol.Error(err.Error())
+	}
+	return protocol.Error("ERR " + err.Error())
+}
+
+// hasErrorCode 判断错误信息是否以全大写的错误码开头（如 "BUSYGROUP ..."）
+func hasErrorCode(msg string) bool {
+	code, _, ok := strings.Cut(msg, " ")
+	if !ok || len(code) < 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// optionalArrayReply 与 protocol.BulkStrings 相同，但 found[i] 为 false 时输出 null
+func optionalArrayReply(items []string, found []bool) protocol.Reply {
+	out := make(protocol.Array, len(items))
+	for i, s := range items {
+		if found[i] {
+			out[i] = protocol.Bulk(s)
+		} else {
+			out[i] = protocol.NullBulk
+		}
+	}
+	return out
+}
+
+// setReply 将集合成员编码为 set（RESP2 中为数组）
+func setReply(members []string) protocol.Reply {
+	out := make(protocol.Set, len(members))
+	for i, m := range members {
+		out[i] = protocol.Bulk(m)
+	}
+	return out
+}
+
+// mapReply 将字段与值交替的列表编码为 map（RESP2 中为数组）
+func mapReply(pairs []string) protocol.Reply {
+	out := make(protocol.Map, len(pairs))
+	for i, s := range pairs {
+		out[i] = protocol.Bulk(s)
+	}
+	return out
+}
+
+// boolReply 以整数 1/0 回复布尔结果
+func boolReply(ok bool) protocol.Reply {
+	if ok {
+		return protocol.Integer(1)
+	}
+	return protocol.Integer(0)
+}
@@ -1,30 +1,102 @@
 package command
 
 import (
+	"redisx/internal/protocol"
 	"redisx/internal/storage"
 	"strings"
 )
 
-type Handler func(store *storage.Storage, args []string) ([]byte, error)
+// Handler executes a command and returns its reply; errors that are part of the
+// command's semantics are returned as a protocol.Error reply.
+type Handler func(store *storage.Storage, args []string) (protocol.Reply, error)
+
+// BytesHandler is a Handler that takes the arguments as received, without
+// converting them to strings. The arguments are only valid during the call; a
+// handler that keeps one must take it with protocol.Own.
+type BytesHandler func(store *storage.Storage, args [][]byte) (protocol.Reply, error)
+
+// BlockingHandler 处理可能阻塞的命令；cancel 被关闭时（如连接断开）应尽快返回。
+// cancel 为 nil 表示调用方不允许阻塞（如 MULTI 中），此时命令按超时处理。
+type BlockingHandler func(store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, error)
 
 type Router struct {
-	h map[string]Handler
+	h        map[string]Handler
+	bytes    map[string]BytesHandler
+	blocking map[string]BlockingHandler
 }
 
 func NewRouter() *Router {
-	return &Router{h: make(map[string]Handler)}
+	return &Router{h: make(map[string]Handler), bytes: make(map[string]BytesHandler), blocking: make(map[string]BlockingHandler)}
 }
 
 func (r *Router) Register(name string, h Handler) {
 	r.h[strings.ToUpper(name)] = h
 }
 
+// RegisterBytes registers a handler that takes the arguments as bytes.
+func (r *Router) RegisterBytes(name string, h BytesHandler) {
+	r.bytes[strings.ToUpper(name)] = h
+}
+
+// RegisterBlocking registers a handler for a command that may block.
+func (r *Router) RegisterBlocking(name string, h BlockingHandler) {
+	r.blocking[strings.ToUpper(name)] = h
+}
+
+// IsBlocking reports whether name was registered with RegisterBlocking.
+func (r *Router) IsBlocking(name string) bool {
+	_, ok := r.blocking[strings.ToUpper(name)]
+	return ok
+}
+
 // Handle attempts to handle the command by name. Returns (resp, handled, err).
-func (r *Router) Handle(name string, store *storage.Storage, args []string) ([]byte, bool, error) {
-	h, ok := r.h[strings.ToUpper(name)]
+// The arguments are converted to strings only for handlers that take strings.
+// Blocking commands handled here never block (as inside MULTI).
+func (r *Router) Handle(name string, store *storage.Storage, args [][]byte) (protocol.Reply, bool, error) {
+	upper := strings.ToUpper(name)
+	if h, ok := r.bytes[upper]; ok {
+		resp, err := h(store, args)
+		return resp, true, err
+	}
+	if h, ok := r.h[upper]; ok {
+		resp, err := h(store, protocol.ArgStrings(args))
+		return resp, true, err
+	}
+	if h, ok := r.blocking[upper]; ok {
+		resp, err := h(store, protocol.ArgStrings(args), nil)
+		return resp, true, err
+	}
+	return nil, false, nil
+}
+
+// HandleBlocking handles a blocking command; cancel aborts the wait.
+func (r *Router) HandleBlocking(name string, store *storage.Storage, args []string, cancel <-chan struct{}) (protocol.Reply, bool, error) {
+	h, ok := r.blocking[strings.ToUpper(name)]
 	if !ok {
 		return nil, false, nil
 	}
-	resp, err := h(store, args)
+	resp, err := h(store, args, cancel)
 	return resp, true, err
 }
+
+// Has reports whether name is registered (blocking or not).
+func (r *Router) Has(name string) bool {
+	upper := strings.ToUpper(name)
+	_, ok := r.h[upper]
+	_, isBytes := r.bytes[upper]
+	_, blocking := r.blocking[upper]
+	return ok || isBytes || blocking
+}
+
+// Validate checks a command before it is queued (e.g. by MULTI): the command
+// must be registered and called with a valid number of arguments. It returns
+// the error reply, or nil if the command is valid.
+func (r *Router) Validate(name string, args [][]byte) protocol.Reply {
+	if !r.Has(name) {
+		return protocol.ErrUnknownCommand
+	}
+	if !CheckArity(name, len(args)+1) {
+		return protocol.WrongArgs(strings.ToLower(name))
+	}
+	return nil
+}
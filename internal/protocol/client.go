@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReplyError is an error reply sent by the server, without the leading '-'.
+type ReplyError string
+
+func (e ReplyError) Error() string { return string(e) }
+
+// Conn is a minimal client connection used by the tools and processes that
+// talk to redisX nodes (cluster rebalancing, sentinel).
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// Timeout 为每次请求（写入命令并读取回复）的超时，0 表示不限制
+	Timeout time.Duration
+}
+
+// Dial connects to addr; timeout bounds the connection and every request.
+func Dial(addr string, timeout time.Duration) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, r: bufio.NewReader(conn), Timeout: timeout}, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error { return c.conn.Close() }
+
+// LocalAddr returns the local network address of the connection.
+func (c *Conn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// Do sends a command and reads its reply (see ReadReply).
+func (c *Conn) Do(args ...string) (any, error) {
+	if err := c.Send(args...); err != nil {
+		return nil, err
+	}
+	return ReadReply(c.r)
+}
+
+// Send writes a command without waiting for the reply.
+func (c *Conn) Send(args ...string) error {
+	c.setDeadline(c.Timeout)
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	_, err := io.WriteString(c.conn, b.String())
+	return err
+}
+
+// Receive reads the next reply, waiting at most timeout (0 means forever);
+// used for pushed messages such as Pub/Sub.
+func (c *Conn) Receive(timeout time.Duration) (any, error) {
+	c.setDeadline(timeout)
+	return ReadReply(c.r)
+}
+
+func (c *Conn) setDeadline(d time.Duration) {
+	var t time.Time
+	if d > 0 {
+		t = time.Now().Add(d)
+	}
+	_ = c.conn.SetDeadline(t)
+}
+
+// ReadReply reads one reply: simple and bulk strings are returned as string,
+// integers as int64, arrays as []any and null replies as nil. Error replies
+// are returned as a ReplyError.
+func ReadReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply line")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, ReplyError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
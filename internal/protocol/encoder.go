@@ -0,0 +1,243 @@
+package protocol
+
+import (
+	"io"
+	"math"
+	"strconv"
+)
+
+// 客户端可协商的协议版本
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Encoder appends replies to Buf in protocol version Proto. Types that only
+// exist in RESP3 are encoded with their RESP2 equivalent for RESP2 clients:
+// maps become flat arrays, sets and pushes arrays, doubles, big numbers and
+// verbatim strings bulk strings, booleans integers and nulls the null bulk
+// string; attributes are omitted. Aggregate methods write only the header,
+// the caller then encodes the elements.
+type Encoder struct {
+	Buf   []byte
+	Proto int
+}
+
+func (e *Encoder) resp3() bool { return e.Proto >= RESP3 }
+
+func (e *Encoder) header(prefix byte, n int) {
+	e.Buf = append(e.Buf, prefix)
+	e.Buf = strconv.AppendInt(e.Buf, int64(n), 10)
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// line 写出单行回复。与 Redis 一致，s 中的 \r、\n 替换为空格：错误信息可能
+// 包含客户端的参数，其中的换行会在回复中注入额外的回复
+func (e *Encoder) line(prefix byte, s string) {
+	e.Buf = append(e.Buf, prefix)
+	start := len(e.Buf)
+	e.Buf = append(e.Buf, s...)
+	for i := start; i < len(e.Buf); i++ {
+		if e.Buf[i] == '\r' || e.Buf[i] == '\n' {
+			e.Buf[i] = ' '
+		}
+	}
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// SimpleString encodes a simple string; \r and \n in s are written as spaces.
+func (e *Encoder) SimpleString(s string) { e.line('+', s) }
+
+// Error encodes an error reply; msg starts with the error code, e.g. "ERR ...".
+// \r and \n in msg are written as spaces, so client arguments quoted in the
+// message cannot break the reply framing.
+func (e *Encoder) Error(msg string) { e.line('-', msg) }
+
+// Integer encodes an integer.
+func (e *Encoder) Integer(n int64) {
+	e.Buf = append(e.Buf, ':')
+	e.Buf = strconv.AppendInt(e.Buf, n, 10)
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// Bulk encodes a bulk string.
+func (e *Encoder) Bulk(s string) {
+	e.header('$', len(s))
+	e.Buf = append(e.Buf, s...)
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// BulkBytes encodes a bulk string held as a byte slice.
+func (e *Encoder) BulkBytes(b []byte) {
+	e.header('$', len(b))
+	e.Buf = append(e.Buf, b...)
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// NullBulk encodes a missing value: the null bulk string in RESP2 and the
+// null in RESP3.
+func (e *Encoder) NullBulk() {
+	if e.resp3() {
+		e.Buf = append(e.Buf, "_\r\n"...)
+		return
+	}
+	e.Buf = append(e.Buf, "$-1\r\n"...)
+}
+
+// NullArray encodes a missing aggregate (the null array in RESP2).
+func (e *Encoder) NullArray() {
+	if e.resp3() {
+		e.Buf = append(e.Buf, "_\r\n"...)
+		return
+	}
+	e.Buf = append(e.Buf, "*-1\r\n"...)
+}
+
+// Array starts an array of n elements.
+func (e *Encoder) Array(n int) { e.header('*', n) }
+
+// Map starts a map of n key/value pairs (2n elements follow).
+func (e *Encoder) Map(n int) {
+	if e.resp3() {
+		e.header('%', n)
+		return
+	}
+	e.header('*', 2*n)
+}
+
+// Set starts a set of n elements.
+func (e *Encoder) Set(n int) {
+	if e.resp3() {
+		e.header('~', n)
+		return
+	}
+	e.header('*', n)
+}
+
+// Push starts an out-of-band push message of n elements, e.g. a Pub/Sub
+// message.
+func (e *Encoder) Push(n int) {
+	if e.resp3() {
+		e.header('>', n)
+		return
+	}
+	e.header('*', n)
+}
+
+// Double encodes a floating point number.
+func (e *Encoder) Double(f float64) {
+	if e.resp3() {
+		e.line(',', formatDouble(f))
+		return
+	}
+	e.Bulk(formatDouble(f))
+}
+
+// Boolean encodes a boolean (1 or 0 in RESP2).
+func (e *Encoder) Boolean(v bool) {
+	switch {
+	case e.resp3() && v:
+		e.Buf = append(e.Buf, "#t\r\n"...)
+	case e.resp3():
+		e.Buf = append(e.Buf, "#f\r\n"...)
+	case v:
+		e.Integer(1)
+	default:
+		e.Integer(0)
+	}
+}
+
+// BigNumber encodes an integer of arbitrary size given in decimal.
+func (e *Encoder) BigNumber(digits string) {
+	if e.resp3() {
+		e.line('(', digits)
+		return
+	}
+	e.Bulk(digits)
+}
+
+// Verbatim encodes a string to be shown as is; format is the three letter
+// format such as "txt" or "mkd".
+func (e *Encoder) Verbatim(format, s string) {
+	if !e.resp3() {
+		e.Bulk(s)
+		return
+	}
+	e.header('=', len(format)+1+len(s))
+	e.Buf = append(e.Buf, format...)
+	e.Buf = append(e.Buf, ':')
+	e.Buf = append(e.Buf, s...)
+	e.Buf = append(e.Buf, '\r', '\n')
+}
+
+// Attribute encodes auxiliary key/value string pairs that precede the next
+// reply. RESP2 has no attributes, so nothing is written for RESP2 clients.
+func (e *Encoder) Attribute(pairs ...string) {
+	if !e.resp3() {
+		return
+	}
+	e.header('|', len(pairs)/2)
+	for _, p := range pairs[:len(pairs)/2*2] {
+		e.Bulk(p)
+	}
+}
+
+// formatDouble 与分值的格式一致：整数不带小数，无穷为 inf/-inf
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	case f == math.Trunc(f) && math.Abs(f) < 1e17:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Encode encodes a structured reply.
+func (e *Encoder) Encode(r Reply) { r.encode(e) }
+
+// maxRetainedBuffer 为 Writer 在 Flush 后保留的缓冲区上限，避免偶尔的大回复
+// 使连接长期占用内存
+const maxRetainedBuffer = 64 << 10
+
+// Writer is a buffered reply writer for one connection. Replies are encoded
+// into the embedded Encoder's buffer and written to the connection by Flush;
+// Proto is the protocol version the client negotiated.
+type Writer struct {
+	Encoder
+	w io.Writer
+}
+
+// NewWriter returns a Writer for w using RESP2 until the client negotiates
+// another version.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{Encoder: Encoder{Proto: RESP2}, w: w}
+}
+
+// Write appends an already encoded reply.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.Buf = append(w.Buf, p...)
+	return len(p), nil
+}
+
+// Buffered returns the number of bytes not yet flushed.
+func (w *Writer) Buffered() int { return len(w.Buf) }
+
+// Flush writes the buffered replies to the connection. The buffer is
+// discarded even if the write fails.
+func (w *Writer) Flush() error {
+	if len(w.Buf) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.Buf)
+	if cap(w.Buf) > maxRetainedBuffer {
+		w.Buf = nil
+	} else {
+		w.Buf = w.Buf[:0]
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	encode := func(proto int) string {
+		e := Encoder{Proto: proto}
+		e.Map(2)
+		e.Bulk("a")
+		e.Double(1.5)
+		e.Bulk("b")
+		e.NullBulk()
+		e.Set(1)
+		e.Boolean(true)
+		e.Push(2)
+		e.BigNumber("12345678901234567890")
+		e.Verbatim("txt", "hi")
+		e.Attribute("ttl", "10")
+		e.Double(math.Inf(-1))
+		e.NullArray()
+		e.SimpleString("OK")
+		e.Error("ERR bad")
+		e.Integer(-3)
+		e.Array(0)
+		return string(e.Buf)
+	}
+	want3 := "%2\r\n$1\r\na\r\n,1.5\r\n$1\r\nb\r\n_\r\n~1\r\n#t\r\n>2\r\n(12345678901234567890\r\n=6\r\ntxt:hi\r\n" +
+		"|1\r\n$3\r\nttl\r\n$2\r\n10\r\n,-inf\r\n_\r\n+OK\r\n-ERR bad\r\n:-3\r\n*0\r\n"
+	if got := encode(RESP3); got != want3 {
+		t.Errorf("RESP3:\n got %q\nwant %q", got, want3)
+	}
+	want2 := "*4\r\n$1\r\na\r\n$3\r\n1.5\r\n$1\r\nb\r\n$-1\r\n*1\r\n:1\r\n*2\r\n$20\r\n12345678901234567890\r\n$2\r\nhi\r\n" +
+		"$4\r\n-inf\r\n*-1\r\n+OK\r\n-ERR bad\r\n:-3\r\n*0\r\n"
+	if got := encode(RESP2); got != want2 {
+		t.Errorf("RESP2:\n got %q\nwant %q", got, want2)
+	}
+}
+
+func TestEncoderLineBreaks(t *testing.T) {
+	// 单行回复中的换行替换为空格，不会注入额外的回复
+	e := Encoder{Proto: RESP2}
+	e.Error("ERR unknown subcommand 'x\r\n+OK'")
+	e.SimpleString("a\nb\rc")
+	if got, want := string(e.Buf), "-ERR unknown subcommand 'x  +OK'\r\n+a b c\r\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		r            Reply
+		want2, want3 string
+	}{
+		{OK, "+OK\r\n", "+OK\r\n"},
+		{Errorf("ERR bad %d", 1), "-ERR bad 1\r\n", "-ERR bad 1\r\n"},
+		{Integer(-3), ":-3\r\n", ":-3\r\n"},
+		{Bulk("a\r\nb"), "$4\r\na\r\nb\r\n", "$4\r\na\r\nb\r\n"},
+		{BulkBytes("\x00\r\n"), "$3\r\n\x00\r\n\r\n", "$3\r\n\x00\r\n\r\n"},
+		{NullBulk, "$-1\r\n", "_\r\n"},
+		{NullArray, "*-1\r\n", "_\r\n"},
+		{Double(2.5), "$3\r\n2.5\r\n", ",2.5\r\n"},
+		{Verbatim("a\r\n"), "$3\r\na\r\n\r\n", "=7\r\ntxt:a\r\n\r\n"},
+		{EmptyArray, "*0\r\n", "*0\r\n"},
+		{Array{Bulk("a"), NullBulk, Integer(1)}, "*3\r\n$1\r\na\r\n$-1\r\n:1\r\n", "*3\r\n$1\r\na\r\n_\r\n:1\r\n"},
+		{BulkStrings{"a", ""}, "*2\r\n$1\r\na\r\n$0\r\n\r\n", "*2\r\n$1\r\na\r\n$0\r\n\r\n"},
+		{Map{Bulk("f"), Double(1)}, "*2\r\n$1\r\nf\r\n$1\r\n1\r\n", "%1\r\n$1\r\nf\r\n,1\r\n"},
+		{Set{Bulk("m")}, "*1\r\n$1\r\nm\r\n", "~1\r\n$1\r\nm\r\n"},
+		{Push{Bulk("message")}, "*1\r\n$7\r\nmessage\r\n", ">1\r\n$7\r\nmessage\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(Encode(tt.r, RESP2)); got != tt.want2 {
+			t.Errorf("Encode(%#v, RESP2) = %q, want %q", tt.r, got, tt.want2)
+		}
+		if got := string(Encode(tt.r, RESP3)); got != tt.want3 {
+			t.Errorf("Encode(%#v, RESP3) = %q, want %q", tt.r, got, tt.want3)
+		}
+	}
+	if !IsError(ErrSyntax) || IsError(OK) || IsError(nil) {
+		t.Error("IsError")
+	}
+	if got := Strings(Array{Bulk("a"), NullBulk, Bulk("b")}); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Strings: %q", got)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	w.Encode(OK)
+	w.Integer(1)
+	if out.Len() != 0 || w.Buffered() != len("+OK\r\n:1\r\n") {
+		t.Fatalf("replies written before Flush: %q, buffered %d", out.String(), w.Buffered())
+	}
+	if err := w.Flush(); err != nil || out.String() != "+OK\r\n:1\r\n" || w.Buffered() != 0 {
+		t.Fatalf("Flush: %q, buffered %d (%v)", out.String(), w.Buffered(), err)
+	}
+
+	// 超过上限的缓冲区在刷出后释放，较小的缓冲区复用
+	w.Bulk(strings.Repeat("x", maxRetainedBuffer))
+	if err := w.Flush(); err != nil || cap(w.Buf) != 0 {
+		t.Fatalf("large buffer retained: cap %d (%v)", cap(w.Buf), err)
+	}
+	w.Proto = RESP3
+	w.Encode(NullBulk)
+	if err := w.Flush(); err != nil || cap(w.Buf) == 0 || !strings.HasSuffix(out.String(), "_\r\n") {
+		t.Fatalf("small buffer: cap %d, out %q (%v)", cap(w.Buf), out.String(), err)
+	}
+}
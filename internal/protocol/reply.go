@@ -0,0 +1,171 @@
+package protocol
+
+import "fmt"
+
+// Reply is a structured reply returned by command handlers. It is encoded by
+// an Encoder (or the connection's Writer) in the protocol version the client
+// negotiated, so handlers need not know whether the client speaks RESP2 or
+// RESP3.
+type Reply interface {
+	encode(e *Encoder)
+}
+
+// SimpleString is a status reply such as OK.
+type SimpleString string
+
+// Error is an error reply; it starts with the error code, e.g.
+// "ERR syntax error".
+type Error string
+
+// Integer is an integer reply.
+type Integer int64
+
+// Bulk is a binary-safe string.
+type Bulk string
+
+// BulkBytes is a bulk string held as a byte slice, such as a stored string
+// value; the slice must not be modified until the reply is encoded.
+type BulkBytes []byte
+
+// Double is a floating point number, a bulk string in RESP2.
+type Double float64
+
+// Verbatim is a text to be shown as is, such as INFO; a bulk string in RESP2.
+type Verbatim string
+
+// Array is an array of replies.
+type Array []Reply
+
+// BulkStrings is an array of bulk strings; it saves converting each element
+// to a Reply.
+type BulkStrings []string
+
+// Map holds alternating keys and values; a flat array in RESP2.
+type Map []Reply
+
+// Set is an unordered collection of distinct elements; an array in RESP2.
+type Set []Reply
+
+// Push is an out-of-band message such as a Pub/Sub message; an array in
+// RESP2.
+type Push []Reply
+
+type null struct{ array bool }
+
+// 常用的回复
+var (
+	// NullBulk is a missing value: the null bulk string in RESP2, the null in
+	// RESP3.
+	NullBulk Reply = null{}
+	// NullArray is a missing aggregate: the null array in RESP2, the null in
+	// RESP3.
+	NullArray  Reply = null{array: true}
+	OK         Reply = SimpleString("OK")
+	EmptyArray Reply = Array{}
+)
+
+// 多个命令共用的错误回复
+var (
+	ErrSyntax         = Error("ERR syntax error")
+	ErrNotInteger     = Error("ERR value is not an integer or out of range")
+	ErrNotFloat       = Error("ERR value is not a valid float")
+	ErrOutOfRange     = Error("ERR value is out of range")
+	ErrUnknownCommand = Error("ERR unknown command")
+)
+
+// Errorf formats an error reply.
+func Errorf(format string, a ...any) Error {
+	return Error(fmt.Sprintf(format, a...))
+}
+
+// WrongArgs returns the error reply for a command called with the wrong
+// number of arguments.
+func WrongArgs(cmd string) Error {
+	return Error("ERR wrong number of arguments for '" + cmd + "' command")
+}
+
+// IsError reports whether r is an error reply.
+func IsError(r Reply) bool {
+	_, ok := r.(Error)
+	return ok
+}
+
+// Strings returns the strings of a bulk string or an array of bulk strings,
+// skipping other elements.
+func Strings(r Reply) []string {
+	switch v := r.(type) {
+	case Bulk:
+		return []string{string(v)}
+	case BulkBytes:
+		return []string{string(v)}
+	case BulkStrings:
+		return v
+	case Array:
+		out := make([]string, 0, len(v))
+		for _, it := range v {
+			if s, ok := it.(Bulk); ok {
+				out = append(out, string(s))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Encode returns r encoded in protocol version proto.
+func Encode(r Reply, proto int) []byte {
+	e := Encoder{Proto: proto}
+	r.encode(&e)
+	return e.Buf
+}
+
+func (r SimpleString) encode(e *Encoder) { e.SimpleString(string(r)) }
+func (r Error) encode(e *Encoder)        { e.Error(string(r)) }
+func (r Integer) encode(e *Encoder)      { e.Integer(int64(r)) }
+func (r Bulk) encode(e *Encoder)         { e.Bulk(string(r)) }
+func (r BulkBytes) encode(e *Encoder)    { e.BulkBytes(r) }
+func (r Double) encode(e *Encoder)       { e.Double(float64(r)) }
+func (r Verbatim) encode(e *Encoder)     { e.Verbatim("txt", string(r)) }
+
+func (r null) encode(e *Encoder) {
+	if r.array {
+		e.NullArray()
+	} else {
+		e.NullBulk()
+	}
+}
+
+func (r Array) encode(e *Encoder) {
+	e.Array(len(r))
+	for _, it := range r {
+		it.encode(e)
+	}
+}
+
+func (r BulkStrings) encode(e *Encoder) {
+	e.Array(len(r))
+	for _, s := range r {
+		e.Bulk(s)
+	}
+}
+
+func (r Map) encode(e *Encoder) {
+	e.Map(len(r) / 2)
+	for _, it := range r[:len(r)/2*2] {
+		it.encode(e)
+	}
+}
+
+func (r Set) encode(e *Encoder) {
+	e.Set(len(r))
+	for _, it := range r {
+		it.encode(e)
+	}
+}
+
+func (r Push) encode(e *Encoder) {
+	e.Push(len(r))
+	for _, it := range r {
+		it.encode(e)
+	}
+}
@@ -2,72 +2,403 @@ package protocol
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
 	"io"
-	"strconv"
-	"strings"
+	"slices"
 )
 
 var ErrClosed = io.EOF
 
-// ParseRequest 支持两种简单情况：
-// 1) 行协议（inline commands），如: "PING\r\n" -> ["PING"]
-// 2) RESP 数组（支持批量字符串）：*N\r\n$len\r\n...\r\n
-func ParseRequest(r *bufio.Reader) (string, []string, error) {
-	// Peek first byte
-	b, err := r.Peek(1)
-	if err != nil {
-		return "", nil, err
+// 请求的默认限制：单个参数的最大长度（与 Redis 的 proto-max-bulk-len 一致）与
+// 一个请求的最大参数个数
+const (
+	DefaultMaxBulkLen      = 512 << 20
+	DefaultMaxMultibulkLen = 1 << 20
+)
+
+// maxInlineLen 为 inline 请求以及 *N、$len 请求头的最大长度
+const maxInlineLen = 64 << 10
+
+// BigArgLen is the length from which a request argument gets its own
+// allocation instead of sharing the parser's reused buffer (like Redis's
+// PROTO_MBULK_BIG_ARG), so that a command storing it can keep it without
+// copying; see Own.
+const BigArgLen = 32 << 10
+
+// bulkChunk 为读取参数时缓冲区每次增长的上限：缓冲区随实际到达的数据增长，声明
+// 了很大的长度却不发送数据的客户端不会使服务器预先分配内存
+const bulkChunk = 64 << 10
+
+// ProtocolError is a malformed request. The connection is out of sync after
+// it and should be closed once the error is reported.
+type ProtocolError string
+
+func (e ProtocolError) Error() string { return "Protocol error: " + string(e) }
+
+// Parser reads requests from a connection. It supports RESP arrays of bulk
+// strings and inline commands split the way redis-cli quotes arguments. The
+// arguments share buffers that are reused by the next request, so parsing
+// does not allocate once the buffers have grown to fit; only arguments of at
+// least BigArgLen bytes are allocated separately.
+type Parser struct {
+	r *bufio.Reader
+	// MaxBulkLen limits the length of an argument and MaxMultibulkLen the
+	// number of arguments of a RESP request; 0 means no limit.
+	MaxBulkLen      int
+	MaxMultibulkLen int
+
+	buf  []byte   // 当前请求的全部参数
+	ends []int    // 每个参数在 buf 中的结束位置
+	big  [][]byte // 与 ends 对应：单独分配的大参数，其余为 nil
+	args [][]byte
+	line []byte // 超过 bufio 缓冲区大小的行
+}
+
+// NewParser returns a Parser reading from r with the default limits.
+func NewParser(r *bufio.Reader) *Parser {
+	return &Parser{r: r, MaxBulkLen: DefaultMaxBulkLen, MaxMultibulkLen: DefaultMaxMultibulkLen}
+}
+
+// Next reads the next request and returns its arguments, the first being the
+// command name; empty requests are skipped. The arguments are only valid
+// until the next call, except those of at least BigArgLen bytes, RESP or
+// inline, which the parser never reuses; see Detached.
+func (p *Parser) Next() ([][]byte, error) {
+	// 偶尔的大请求不应使连接长期占用内存
+	if cap(p.buf) > maxRetainedBuffer {
+		p.buf = nil
+	}
+	if cap(p.line) > maxRetainedBuffer {
+		p.line = nil
 	}
-	if b[0] == '*' {
-		// RESP Array
-		line, err := r.ReadString('\n')
+	for len(p.ends) == 0 {
+		p.buf, p.ends, p.big = p.buf[:0], p.ends[:0], p.big[:0]
+		b, err := p.r.Peek(1)
 		if err != nil {
-			return "", nil, err
+			return nil, err
+		}
+		if b[0] == '*' {
+			err = p.multibulk()
+		} else {
+			err = p.inline()
 		}
-		line = strings.TrimSpace(line)
-		n, err := strconv.Atoi(strings.TrimPrefix(line, "*"))
 		if err != nil {
-			return "", nil, errors.New("invalid array header")
-		}
-		args := make([]string, 0, n)
-		for i := 0; i < n; i++ {
-			// Read $len header
-			h, err := r.ReadString('\n')
-			if err != nil {
-				return "", nil, err
-			}
-			h = strings.TrimSpace(h)
-			if !strings.HasPrefix(h, "$") {
-				return "", nil, errors.New("invalid bulk string header")
-			}
-			llen, err := strconv.Atoi(strings.TrimPrefix(h, "$"))
-			if err != nil {
-				return "", nil, errors.New("invalid bulk len")
+			p.ends = p.ends[:0]
+			return nil, err
+		}
+	}
+	p.args = p.args[:0]
+	start := 0
+	for i, end := range p.ends {
+		if p.big[i] != nil {
+			p.args = append(p.args, p.big[i])
+			// 交给调用方后不再引用
+			p.big[i] = nil
+		} else {
+			p.args = append(p.args, p.buf[start:end:end])
+		}
+		start = end
+	}
+	p.ends = p.ends[:0]
+	return p.args, nil
+}
+
+// multibulk 读取 *N 与 N 个 $len 参数
+func (p *Parser) multibulk() error {
+	line, err := p.readLine("too big mbulk count string")
+	if err != nil {
+		return err
+	}
+	// 与 Redis 一致：参数个数不大于 0（如 *-1）的请求与 *0 一样视为空请求跳过
+	n, ok := parseLen(line[1:])
+	if !ok || (p.MaxMultibulkLen > 0 && n > p.MaxMultibulkLen) {
+		return ProtocolError("invalid multibulk length")
+	}
+	for i := 0; i < n; i++ {
+		line, err := p.readLine("too big bulk count string")
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if len(line) == 0 || line[0] != '$' {
+			got := ""
+			if len(line) > 0 {
+				got = string(line[:1])
 			}
-			buf := make([]byte, llen+2)
-			if _, err := io.ReadFull(r, buf); err != nil {
-				return "", nil, err
+			return ProtocolError("expected '$', got '" + got + "'")
+		}
+		size, ok := parseLen(line[1:])
+		if !ok || size < 0 || (p.MaxBulkLen > 0 && size > p.MaxBulkLen) {
+			return ProtocolError("invalid bulk length")
+		}
+		if err := p.readBulk(size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBulk 读取 n 字节的参数及其后的 \r\n；不短于 BigArgLen 的参数读入单独
+// 分配的切片
+func (p *Parser) readBulk(n int) error {
+	if n < BigArgLen {
+		buf, err := p.readCRLF(p.buf, n)
+		if err != nil {
+			return err
+		}
+		p.buf = buf
+		p.ends, p.big = append(p.ends, len(buf)), append(p.big, nil)
+		return nil
+	}
+	arg, err := p.readCRLF(nil, n)
+	if err != nil {
+		return err
+	}
+	p.ends, p.big = append(p.ends, len(p.buf)), append(p.big, arg[:n:n])
+	return nil
+}
+
+// readCRLF 将 n 字节及其后的 \r\n 追加到 buf，返回去掉 \r\n 后的 buf。buf 随
+// 实际到达的数据增长，声明了很大长度的参数不会预先分配内存。
+func (p *Parser) readCRLF(buf []byte, n int) ([]byte, error) {
+	for remaining := n + 2; remaining > 0; {
+		chunk := min(remaining, bulkChunk)
+		off := len(buf)
+		buf = slices.Grow(buf, chunk)[:off+chunk]
+		if _, err := io.ReadFull(p.r, buf[off:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		remaining -= chunk
+	}
+	end := len(buf) - 2
+	if buf[end] != '\r' || buf[end+1] != '\n' {
+		return nil, ProtocolError("expected CRLF after bulk string")
+	}
+	return buf[:end], nil
+}
+
+// inline 读取一行 inline 请求并拆分参数
+func (p *Parser) inline() error {
+	line, err := p.readLine("too big inline request")
+	if err != nil {
+		return err
+	}
+	return p.splitArgs(line)
+}
+
+// readLine 读取一行，去掉行尾的 \n 或 \r\n；超过 maxInlineLen 时返回 tooBig。
+// 返回的切片在下一次读取前有效。
+func (p *Parser) readLine(tooBig ProtocolError) ([]byte, error) {
+	line, err := p.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		p.line = append(p.line[:0], line...)
+		for err == bufio.ErrBufferFull && len(p.line) <= maxInlineLen {
+			line, err = p.r.ReadSlice('\n')
+			p.line = append(p.line, line...)
+		}
+		line = p.line
+	}
+	if len(line) > maxInlineLen+2 || err == bufio.ErrBufferFull {
+		return nil, tooBig
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// splitArgs 按 redis-cli 的规则拆分 inline 请求：参数以空白分隔，可以用双引号
+// 括起（支持 \n、\r、\t、\b、\a、\xHH 等转义）或单引号括起（只支持 \'），引号
+// 结束后须为空白或行尾
+func (p *Parser) splitArgs(line []byte) error {
+	const unbalanced = ProtocolError("unbalanced quotes in request")
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return nil
+		}
+		start, inDouble, inSingle := len(p.buf), false, false
+		for done := false; !done; i++ {
+			switch {
+			case inDouble:
+				switch {
+				case i == len(line):
+					return unbalanced
+				case line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					p.buf = append(p.buf, unhex(line[i+2])<<4|unhex(line[i+3]))
+					i += 3
+				case line[i] == '\\' && i+1 < len(line):
+					i++
+					p.buf = append(p.buf, unescape(line[i]))
+				case line[i] == '"':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return unbalanced
+					}
+					done = true
+				default:
+					p.buf = append(p.buf, line[i])
+				}
+			case inSingle:
+				switch {
+				case i == len(line):
+					return unbalanced
+				case line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					p.buf = append(p.buf, '\'')
+				case line[i] == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return unbalanced
+					}
+					done = true
+				default:
+					p.buf = append(p.buf, line[i])
+				}
+			default:
+				switch {
+				case i == len(line) || isSpace(line[i]):
+					done = true
+				case line[i] == '"':
+					inDouble = true
+				case line[i] == '\'':
+					inSingle = true
+				default:
+					p.buf = append(p.buf, line[i])
+				}
 			}
-			arg := string(buf[:llen])
-			args = append(args, arg)
 		}
-		if len(args) == 0 {
-			return "", nil, errors.New("empty command")
+		p.endInlineArg(start)
+		if i > len(line) {
+			return nil
 		}
-		cmd := args[0]
-		return cmd, args[1:], nil
 	}
-	// Inline: read a line
-	line, err := r.ReadString('\n')
+}
+
+// endInlineArg 结束从 buf[start:] 开始的 inline 参数；与 RESP 请求一致，不短于
+// BigArgLen 的参数移入单独分配的切片
+func (p *Parser) endInlineArg(start int) {
+	if len(p.buf)-start < BigArgLen {
+		p.ends, p.big = append(p.ends, len(p.buf)), append(p.big, nil)
+		return
+	}
+	arg := make([]byte, len(p.buf)-start)
+	copy(arg, p.buf[start:])
+	p.buf = p.buf[:start]
+	p.ends, p.big = append(p.ends, start), append(p.big, arg)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10
+	}
+	return c - 'a' + 10
+}
+
+// unescape 返回双引号内 \c 表示的字符；未知的转义即字符本身
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
+
+// parseLen 解析请求头中的十进制长度，只接受可选的负号与数字
+func parseLen(b []byte) (int, bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	// 18 位以内不会溢出
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+// unexpectedEOF 将请求中途的 io.EOF 转换为 io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Detached reports whether arg, as returned by Parser.Next, has its own
+// allocation that the Parser does not reuse, so it stays valid after the
+// next request.
+func Detached(arg []byte) bool { return len(arg) >= BigArgLen }
+
+// Own returns arg for keeping after the request that carried it: detached
+// arguments are returned as they are, the others are copied.
+func Own(arg []byte) []byte {
+	if Detached(arg) {
+		return arg
+	}
+	return bytes.Clone(arg)
+}
+
+// ArgStrings converts request arguments to strings, for code that keeps them
+// or needs them as strings.
+func ArgStrings(args [][]byte) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = string(a)
+	}
+	return out
+}
+
+// Args converts string arguments, such as commands replayed from the AOF or
+// the Raft log, to the form taken by command.Router.
+func Args(args []string) [][]byte {
+	out := make([][]byte, len(args))
+	for i, a := range args {
+		out[i] = []byte(a)
+	}
+	return out
+}
+
+// ParseRequest reads one request without limits, for trusted streams such as
+// the AOF and the replication stream.
+func ParseRequest(r *bufio.Reader) (string, []string, error) {
+	p := Parser{r: r}
+	argv, err := p.Next()
 	if err != nil {
 		return "", nil, err
 	}
-	line = strings.TrimSpace(line)
-	if line == "" {
-		return "", nil, errors.New("empty line")
-	}
-	parts := strings.Fields(line)
-	cmd := parts[0]
-	return cmd, parts[1:], nil
+	return string(argv[0]), ArgStrings(argv[1:]), nil
 }
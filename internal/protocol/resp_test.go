@@ -2,6 +2,9 @@ package protocol
 
 import (
 	"bufio"
+	"bytes"
+	"io"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -34,3 +37,165 @@ func TestParseArray(t *testing.T) {
 		t.Fatalf("expected args [TEST], got %v", args)
 	}
 }
+
+func TestParser(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [][]string
+	}{
+		{"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$0\r\n\r\n", [][]string{{"SET", "k", ""}}},
+		// 参数可以包含 \r\n 与 NUL
+		{"*2\r\n$3\r\nGET\r\n$4\r\na\r\n\x00\r\n", [][]string{{"GET", "a\r\n\x00"}}},
+		// 空请求被跳过
+		{"*0\r\n\r\n  \nPING\n", [][]string{{"PING"}}},
+		{"*-1\r\n*-5\r\n*1\r\n$4\r\nPING\r\n", [][]string{{"PING"}}},
+		{"GET k\r\nset  k\t v \r\n", [][]string{{"GET", "k"}, {"set", "k", "v"}}},
+		{`SET "a b" "\x41\n\t\"\\\z"` + "\r\n", [][]string{{"SET", "a b", "A\n\t\"\\z"}}},
+		{`SET 'it\'s' 'a\nb' "" ''` + "\n", [][]string{{"SET", "it's", `a\nb`, "", ""}}},
+		{`SET k"ey" "\x4"` + "\n", [][]string{{"SET", "key", `x4`}}},
+	}
+	for _, tt := range tests {
+		p := NewParser(bufio.NewReader(strings.NewReader(tt.in)))
+		for _, want := range tt.want {
+			argv, err := p.Next()
+			if err != nil {
+				t.Fatalf("%q: %v", tt.in, err)
+			}
+			got := make([]string, len(argv))
+			for i, a := range argv {
+				got[i] = string(a)
+			}
+			if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+				t.Errorf("%q: got %q, want %q", tt.in, got, want)
+			}
+		}
+		if _, err := p.Next(); err != io.EOF {
+			t.Errorf("%q: expected EOF at the end, got %v", tt.in, err)
+		}
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	long := strings.Repeat("x", maxInlineLen+1)
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"*-\r\n", ProtocolError("invalid multibulk length")},
+		{"*x\r\n", ProtocolError("invalid multibulk length")},
+		{"*+1\r\n", ProtocolError("invalid multibulk length")},
+		{"*\r\n", ProtocolError("invalid multibulk length")},
+		{"*1025\r\n", ProtocolError("invalid multibulk length")},
+		{"*1\r\n$-1\r\n", ProtocolError("invalid bulk length")},
+		{"*1\r\n$1x\r\n", ProtocolError("invalid bulk length")},
+		{"*1\r\n$999999999\r\n", ProtocolError("invalid bulk length")},
+		{"*1\r\n$1025\r\n", ProtocolError("invalid bulk length")},
+		{"*1\r\n:1\r\n", ProtocolError("expected '$', got ':'")},
+		{"*1\r\n$1\r\nab\r\n", ProtocolError("expected CRLF after bulk string")},
+		{"*" + long + "\r\n", ProtocolError("too big mbulk count string")},
+		{"*1\r\n$" + long + "\r\n", ProtocolError("too big bulk count string")},
+		{"GET " + long + "\r\n", ProtocolError("too big inline request")},
+		{`GET "k` + "\r\n", ProtocolError("unbalanced quotes in request")},
+		{`GET "k"x` + "\r\n", ProtocolError("unbalanced quotes in request")},
+		{`GET 'k` + "\r\n", ProtocolError("unbalanced quotes in request")},
+		// 请求中途断开
+		{"*2\r\n$3\r\nGET\r\n", io.ErrUnexpectedEOF},
+		{"*1\r\n$3\r\nGE", io.ErrUnexpectedEOF},
+		{"GET k", io.EOF},
+	}
+	for _, tt := range tests {
+		p := NewParser(bufio.NewReader(strings.NewReader(tt.in)))
+		p.MaxBulkLen, p.MaxMultibulkLen = 1024, 1024
+		if _, err := p.Next(); err != tt.want {
+			t.Errorf("%.40q: got %v, want %v", tt.in, err, tt.want)
+		}
+	}
+	// 默认限制
+	p := NewParser(bufio.NewReader(strings.NewReader("*1\r\n$999999999\r\n")))
+	if _, err := p.Next(); err != ProtocolError("invalid bulk length") {
+		t.Errorf("default limit: %v", err)
+	}
+	if got := ProtocolError("invalid bulk length").Error(); got != "Protocol error: invalid bulk length" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestParserLargeBulk(t *testing.T) {
+	// 超过 bufio 缓冲区与单次增长上限的参数
+	value := strings.Repeat("v", 3*bulkChunk+7)
+	in := "*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n*1\r\n$4\r\nPING\r\n"
+	p := NewParser(bufio.NewReader(strings.NewReader(in)))
+	argv, err := p.Next()
+	if err != nil || len(argv) != 2 || string(argv[1]) != value {
+		t.Fatalf("large bulk: %d args (%v)", len(argv), err)
+	}
+	big := argv[1]
+	// 大参数单独分配，不在共用的缓冲区中
+	if argv, err = p.Next(); err != nil || string(argv[0]) != "PING" || cap(p.buf) >= BigArgLen {
+		t.Fatalf("after large bulk: %q, cap %d (%v)", argv, cap(p.buf), err)
+	}
+	if string(big) != value || cap(big) != len(value) {
+		t.Fatalf("large bulk changed after the next request: len %d cap %d", len(big), cap(big))
+	}
+}
+
+func TestParserLargeInline(t *testing.T) {
+	// inline 请求中的大参数同样单独分配
+	value := strings.Repeat("v", BigArgLen+1)
+	p := NewParser(bufio.NewReader(strings.NewReader("SET k " + value + "\r\nSET k2 \"" + strings.Repeat("w", BigArgLen) + "\"\r\n")))
+	argv, err := p.Next()
+	if err != nil || len(argv) != 3 || string(argv[2]) != value || !Detached(argv[2]) {
+		t.Fatalf("large inline: %d args (%v)", len(argv), err)
+	}
+	big := argv[2]
+	if argv, err = p.Next(); err != nil || string(argv[1]) != "k2" || len(argv[2]) != BigArgLen {
+		t.Fatalf("after large inline: %d args (%v)", len(argv), err)
+	}
+	if string(big) != value {
+		t.Fatal("large inline argument changed after the next request")
+	}
+}
+
+func TestOwn(t *testing.T) {
+	small := []byte("v")
+	if o := Own(small); &o[0] == &small[0] || string(o) != "v" {
+		t.Fatal("Own did not copy a small argument")
+	}
+	big := make([]byte, BigArgLen)
+	if o := Own(big); &o[0] != &big[0] {
+		t.Fatal("Own copied a big argument")
+	}
+}
+
+func TestParserAllocs(t *testing.T) {
+	req := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\nGET \"key\"\r\n"
+	p := NewParser(bufio.NewReader(strings.NewReader(strings.Repeat(req, 100))))
+	if _, err := p.Next(); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := p.Next(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Next: %v allocations per request, want 0", allocs)
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	req := []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+	in := bytes.Repeat(req, 1000)
+	r := bytes.NewReader(in)
+	p := NewParser(bufio.NewReader(r))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(req)))
+	for i := 0; i < b.N; i++ {
+		if i%1000 == 0 {
+			r.Reset(in)
+		}
+		if _, err := p.Next(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Package pubsub 实现发布/订阅：频道、glob 模式与分片频道的订阅关系，
+// 以及每个订阅客户端的有界输出队列。
+package pubsub
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"redisx/internal/protocol"
+)
+
+// Subscriber 为一个处于订阅模式的客户端。推送消息先进入有界输出队列，由 Run
+// 在独立 goroutine 中写出，因此 PUBLISH 不会被慢速订阅者阻塞；队列超过上限时
+// 订阅者被关闭并触发 onOverflow（通常为断开连接）。
+type Subscriber struct {
+	mu         sync.Mutex
+	queue      [][]byte
+	queued     int64 // 已入队但尚未写出的字节数（含正在写出的批次）
+	limit      int64
+	closed     bool
+	overflowed bool
+	err        error // Run 写出失败的错误
+	wake       chan struct{}
+	done       chan struct{}
+	onOverflow func()
+	// resp3 表示客户端使用 RESP3，推送消息编码为 push 类型
+	resp3 atomic.Bool
+
+	// 以下字段由 Hub.mu 保护
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	shards   map[string]struct{}
+}
+
+// NewSubscriber creates a subscriber whose output queue may hold at most
+// limit bytes (0 means unlimited). onOverflow is called once when the limit
+// is exceeded.
+func NewSubscriber(limit int64, onOverflow func()) *Subscriber {
+	return &Subscriber{
+		limit:      limit,
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		onOverflow: onOverflow,
+		channels:   make(map[string]struct{}),
+		patterns:   make(map[string]struct{}),
+		shards:     make(map[string]struct{}),
+	}
+}
+
+// SetRESP3 sets whether messages are encoded as RESP3 pushes (the default
+// is RESP2 arrays).
+func (s *Subscriber) SetRESP3(v bool) { s.resp3.Store(v) }
+
+func (s *Subscriber) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Send enqueues b without blocking. It returns false if the subscriber is
+// closed or the output limit would be exceeded.
+func (s *Subscriber) Send(b []byte) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+	if s.limit > 0 && s.queued+int64(len(b)) > s.limit {
+		s.closed, s.overflowed = true, true
+		s.queue = nil
+		s.mu.Unlock()
+		s.notify()
+		if s.onOverflow != nil {
+			s.onOverflow()
+		}
+		return false
+	}
+	s.queue = append(s.queue, b)
+	s.queued += int64(len(b))
+	s.mu.Unlock()
+	s.notify()
+	return true
+}
+
+// Overflowed reports whether the subscriber was closed because its output
+// queue exceeded the limit.
+func (s *Subscriber) Overflowed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overflowed
+}
+
+// Run writes queued data to w until Close is called and the queue has been
+// drained, the subscriber overflows, or a write fails.
+func (s *Subscriber) Run(w io.Writer) error {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		batch, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			if closed {
+				return nil
+			}
+			<-s.wake
+			continue
+		}
+		for _, b := range batch {
+			if _, err := w.Write(b); err != nil {
+				s.mu.Lock()
+				s.closed = true
+				s.queue = nil
+				s.err = err
+				s.mu.Unlock()
+				return err
+			}
+			s.mu.Lock()
+			s.queued -= int64(len(b))
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Close stops accepting data and waits for Run to flush what is already
+// queued. It returns the error that stopped Run, if a write failed.
+func (s *Subscriber) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.notify()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Hub 保存所有订阅关系
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+	shards   map[string]map[*Subscriber]struct{}
+}
+
+// NewHub returns an empty hub.
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[*Subscriber]struct{}),
+		patterns: make(map[string]map[*Subscriber]struct{}),
+		shards:   make(map[string]map[*Subscriber]struct{}),
+	}
+}
+
+func add(index map[string]map[*Subscriber]struct{}, own map[string]struct{}, name string, s *Subscriber) {
+	if _, ok := own[name]; ok {
+		return
+	}
+	own[name] = struct{}{}
+	subs := index[name]
+	if subs == nil {
+		subs = make(map[*Subscriber]struct{})
+		index[name] = subs
+	}
+	subs[s] = struct{}{}
+}
+
+func remove(index map[string]map[*Subscriber]struct{}, own map[string]struct{}, name string, s *Subscriber) {
+	if _, ok := own[name]; !ok {
+		return
+	}
+	delete(own, name)
+	subs := index[name]
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(index, name)
+	}
+}
+
+// Count returns the number of channel and pattern subscriptions of s, as
+// reported in SUBSCRIBE/UNSUBSCRIBE replies.
+func (h *Hub) Count(s *Subscriber) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(s.channels) + len(s.patterns)
+}
+
+// ShardCount returns the number of shard channel subscriptions of s.
+func (h *Hub) ShardCount(s *Subscriber) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(s.shards)
+}
+
+// Subscribe subscribes s to channel and returns its subscription count.
+func (h *Hub) Subscribe(s *Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	add(h.channels, s.channels, channel, s)
+	return len(s.channels) + len(s.patterns)
+}
+
+// Unsubscribe removes s from channel and returns its subscription count.
+func (h *Hub) Unsubscribe(s *Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.channels, s.channels, channel, s)
+	return len(s.channels) + len(s.patterns)
+}
+
+// PSubscribe subscribes s to a glob pattern and returns its subscription count.
+func (h *Hub) PSubscribe(s *Subscriber, pattern string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	add(h.patterns, s.patterns, pattern, s)
+	return len(s.channels) + len(s.patterns)
+}
+
+// PUnsubscribe removes a pattern subscription and returns the subscription count.
+func (h *Hub) PUnsubscribe(s *Subscriber, pattern string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.patterns, s.patterns, pattern, s)
+	return len(s.channels) + len(s.patterns)
+}
+
+// SSubscribe subscribes s to a shard channel and returns its shard
+// subscription count.
+func (h *Hub) SSubscribe(s *Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	add(h.shards, s.shards, channel, s)
+	return len(s.shards)
+}
+
+// SUnsubscribe removes a shard channel subscription and returns the shard
+// subscription count.
+func (h *Hub) SUnsubscribe(s *Subscriber, channel string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	remove(h.shards, s.shards, channel, s)
+	return len(s.shards)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Channels returns the channels s is subscribed to.
+func (h *Hub) Channels(s *Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return sortedKeys(s.channels)
+}
+
+// Patterns returns the patterns s is subscribed to.
+func (h *Hub) Patterns(s *Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return sortedKeys(s.patterns)
+}
+
+// ShardChannels returns the shard channels s is subscribed to.
+func (h *Hub) ShardChannels(s *Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return sortedKeys(s.shards)
+}
+
+// RemoveAll drops every subscription of s (used when the connection closes).
+func (h *Hub) RemoveAll(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range s.channels {
+		remove(h.channels, s.channels, ch, s)
+	}
+	for p := range s.patterns {
+		remove(h.patterns, s.patterns, p, s)
+	}
+	for ch := range s.shards {
+		remove(h.shards, s.shards, ch, s)
+	}
+}
+
+// push 编码由 bulk string 组成的推送消息：RESP3 中为 push，RESP2 中为数组
+func push(proto int, parts []string) []byte {
+	e := protocol.Encoder{Proto: proto}
+	e.Push(len(parts))
+	for _, p := range parts {
+		e.Bulk(p)
+	}
+	return e.Buf
+}
+
+// pushMessage 按订阅者的协议缓存编码后的推送消息，同一条消息对每种协议只编码一次
+type pushMessage struct {
+	parts        []string
+	resp2, resp3 []byte
+}
+
+func (m *pushMessage) encoded(s *Subscriber) []byte {
+	if s.resp3.Load() {
+		if m.resp3 == nil {
+			m.resp3 = push(protocol.RESP3, m.parts)
+		}
+		return m.resp3
+	}
+	if m.resp2 == nil {
+		m.resp2 = push(protocol.RESP2, m.parts)
+	}
+	return m.resp2
+}
+
+// Publish delivers message to subscribers of channel and of matching
+// patterns, returning the number of receivers. Subscribers that are closed
+// or overflow on this message are not counted.
+func (h *Hub) Publish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	if subs := h.channels[channel]; len(subs) > 0 {
+		msg := &pushMessage{parts: []string{"message", channel, message}}
+		for s := range subs {
+			if s.Send(msg.encoded(s)) {
+				n++
+			}
+		}
+	}
+	for pattern, subs := range h.patterns {
+		if !Match(pattern, channel) {
+			continue
+		}
+		msg := &pushMessage{parts: []string{"pmessage", pattern, channel, message}}
+		for s := range subs {
+			if s.Send(msg.encoded(s)) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// SPublish delivers message to subscribers of a shard channel and returns
+// the number of receivers, counted as for Publish.
+func (h *Hub) SPublish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	subs := h.shards[channel]
+	if len(subs) == 0 {
+		return 0
+	}
+	msg := &pushMessage{parts: []string{"smessage", channel, message}}
+	n := 0
+	for s := range subs {
+		if s.Send(msg.encoded(s)) {
+			n++
+		}
+	}
+	return n
+}
+
+func activeChannels(index map[string]map[*Subscriber]struct{}, pattern string) []string {
+	out := []string{}
+	for ch := range index {
+		if pattern == "" || Match(pattern, ch) {
+			out = append(out, ch)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ActiveChannels returns channels with at least one subscriber, optionally
+// filtered by a glob pattern (empty matches all).
+func (h *Hub) ActiveChannels(pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return activeChannels(h.channels, pattern)
+}
+
+// ActiveShardChannels is ActiveChannels for shard channels.
+func (h *Hub) ActiveShardChannels(pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return activeChannels(h.shards, pattern)
+}
+
+// NumSub returns the number of subscribers of each channel.
+func (h *Hub) NumSub(channels []string) []int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]int, len(channels))
+	for i, ch := range channels {
+		out[i] = len(h.channels[ch])
+	}
+	return out
+}
+
+// ShardNumSub returns the number of subscribers of each shard channel.
+func (h *Hub) ShardNumSub(channels []string) []int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]int, len(channels))
+	for i, ch := range channels {
+		out[i] = len(h.shards[ch])
+	}
+	return out
+}
+
+// NumPat returns the number of distinct subscribed patterns.
+func (h *Hub) NumPat() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.patterns)
+}
@@ -0,0 +1,85 @@
+package pubsub
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"news.*", "news.tech", true},
+		{"news.*", "sport.tech", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a/*", "a/b/c", true},
+		{`news\*`, "news*", true},
+		{`news\*`, "newsX", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.s); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
+
+// blockingWriter 模拟不读取数据的慢速客户端
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func TestPublishDisconnectsSlowSubscriber(t *testing.T) {
+	h := NewHub()
+	overflowed := make(chan struct{})
+	slow := NewSubscriber(64, func() { close(overflowed) })
+	w := &blockingWriter{release: make(chan struct{})}
+	go slow.Run(w)
+	h.Subscribe(slow, "ch")
+	fast := NewSubscriber(0, nil)
+	var out bytes.Buffer
+	go fast.Run(&out)
+	h.PSubscribe(fast, "c*")
+
+	// 第二条消息使慢速订阅者溢出，此后只计入仍能收到消息的订阅者
+	for i := 0; i < 10; i++ {
+		want := 1
+		if i == 0 {
+			want = 2
+		}
+		if n := h.Publish("ch", "0123456789"); n != want {
+			t.Fatalf("publish %d: expected %d receivers, got %d", i, want, n)
+		}
+	}
+	select {
+	case <-overflowed:
+	default:
+		t.Fatal("expected slow subscriber to overflow")
+	}
+	if !slow.Overflowed() || slow.Send([]byte("x")) {
+		t.Fatal("overflowed subscriber should reject further data")
+	}
+	close(w.release)
+	fast.Close()
+	if n := bytes.Count(out.Bytes(), []byte("pmessage")); n != 10 {
+		t.Fatalf("expected 10 pmessages, got %d", n)
+	}
+	h.RemoveAll(slow)
+	if got := h.NumSub([]string{"ch"}); got[0] != 0 {
+		t.Fatalf("expected no subscribers after RemoveAll, got %d", got[0])
+	}
+}
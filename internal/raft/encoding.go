@@ -0,0 +1,133 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errCorrupt 表示 RPC 消息或持久化记录无法解码
+var errCorrupt = errors.New("raft: corrupt message")
+
+// encoder 以 uvarint 与带长度前缀的字节串编码消息与日志记录
+type encoder struct{ b []byte }
+
+func (e *encoder) uvarint(v uint64) { e.b = binary.AppendUvarint(e.b, v) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.b = append(e.b, 1)
+	} else {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *encoder) bytes(p []byte) {
+	e.uvarint(uint64(len(p)))
+	e.b = append(e.b, p...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) strings(ss []string) {
+	e.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) entry(en *Entry) {
+	e.uvarint(en.Index)
+	e.uvarint(en.Term)
+	e.b = append(e.b, byte(en.Type))
+	e.bytes(en.Data)
+}
+
+// decoder 为 encoder 的逆过程；出错后后续读取都返回零值，由 err 报告
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) bool() bool {
+	if d.err != nil {
+		return false
+	}
+	if len(d.b) == 0 {
+		d.err = errCorrupt
+		return false
+	}
+	v := d.b[0] != 0
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.b)) {
+		d.err = errCorrupt
+		return nil
+	}
+	p := append([]byte(nil), d.b[:n]...)
+	d.b = d.b[n:]
+	return p
+}
+
+func (d *decoder) string() string { return string(d.bytes()) }
+
+func (d *decoder) strings() []string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = errCorrupt
+	}
+	if d.err != nil {
+		return nil
+	}
+	ss := make([]string, 0, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		ss = append(ss, d.string())
+	}
+	return ss
+}
+
+func (d *decoder) entry() Entry {
+	var en Entry
+	en.Index = d.uvarint()
+	en.Term = d.uvarint()
+	if d.err == nil && len(d.b) == 0 {
+		d.err = errCorrupt
+	}
+	if d.err != nil {
+		return en
+	}
+	en.Type = EntryType(d.b[0])
+	d.b = d.b[1:]
+	en.Data = d.bytes()
+	return en
+}
+
+// finish 报告解码错误；消息末尾有多余字节同样视为损坏
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.b) != 0 {
+		d.err = errCorrupt
+	}
+	return d.err
+}
@@ -0,0 +1,346 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// 持久化文件（Dir 为空时只保存在内存中）：
+//
+//	raft-state    当前任期与投票，每次修改时整体重写
+//	raft-snapshot 最近一次快照：索引、任期、成员与状态机数据，整体重写
+//	raft-log      快照之后的条目。每条记录为 uvarint 长度 | 内容 | CRC32（4B 小端），
+//	              内容为 'E' + 条目，或 'T' + uvarint 索引（删除该索引及之后的条目）。
+//	              压缩时整体重写。
+const (
+	stateFile    = "raft-state"
+	snapshotFile = "raft-snapshot"
+	logFile      = "raft-log"
+)
+
+// raftLog 为快照与其后的日志条目；由 Node.mu 保护
+type raftLog struct {
+	dir string
+	f   *os.File
+
+	// 快照包含 (0, snapIndex] 的全部条目
+	snapIndex   uint64
+	snapTerm    uint64
+	snapMembers []string
+	snapData    []byte
+	// entries[i].Index == snapIndex+1+i
+	entries []Entry
+}
+
+// openLog 读取 dir 中的快照、日志与任期/投票；文件不存在时为空日志。日志末尾
+// 不完整的记录（写入时宕机）被截掉。
+func openLog(dir string) (l *raftLog, term uint64, vote string, err error) {
+	l = &raftLog{dir: dir}
+	if dir == "" {
+		return l, 0, "", nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, 0, "", err
+	}
+	if b, err := readChecked(filepath.Join(dir, stateFile)); err != nil {
+		return nil, 0, "", err
+	} else if b != nil {
+		d := &decoder{b: b}
+		term, vote = d.uvarint(), d.string()
+		if err := d.finish(); err != nil {
+			return nil, 0, "", fmt.Errorf("%s: %w", stateFile, err)
+		}
+	}
+	if b, err := readChecked(filepath.Join(dir, snapshotFile)); err != nil {
+		return nil, 0, "", err
+	} else if b != nil {
+		d := &decoder{b: b}
+		l.snapIndex, l.snapTerm, l.snapMembers, l.snapData = d.uvarint(), d.uvarint(), d.strings(), d.bytes()
+		if err := d.finish(); err != nil {
+			return nil, 0, "", fmt.Errorf("%s: %w", snapshotFile, err)
+		}
+	}
+	path := filepath.Join(dir, logFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, "", err
+	}
+	valid := l.replay(data)
+	if valid < len(data) {
+		log.Printf("raft: truncating %d bytes of incomplete log records", len(data)-valid)
+	}
+	if l.f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, 0, "", err
+	}
+	if err := l.f.Truncate(int64(valid)); err != nil {
+		return nil, 0, "", err
+	}
+	return l, term, vote, nil
+}
+
+// replay 应用日志文件中的记录，返回最后一条完整记录之后的偏移
+func (l *raftLog) replay(data []byte) int {
+	off := 0
+	for off < len(data) {
+		n, k := binary.Uvarint(data[off:])
+		if k <= 0 || uint64(len(data)-off-k) < n+4 {
+			break
+		}
+		body := data[off+k : off+k+int(n)]
+		if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(data[off+k+int(n):]) || len(body) == 0 {
+			break
+		}
+		d := &decoder{b: body[1:]}
+		switch body[0] {
+		case 'E':
+			e := d.entry()
+			if d.finish() != nil {
+				return off
+			}
+			if e.Index > l.snapIndex {
+				l.truncateMem(e.Index)
+				if e.Index == l.lastIndex()+1 {
+					l.entries = append(l.entries, e)
+				}
+			}
+		case 'T':
+			from := d.uvarint()
+			if d.finish() != nil {
+				return off
+			}
+			l.truncateMem(from)
+		default:
+			return off
+		}
+		off += k + int(n) + 4
+	}
+	return off
+}
+
+// readChecked 读取以 CRC32 结尾的文件；文件不存在时返回 nil
+func readChecked(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 || crc32.ChecksumIEEE(b[:len(b)-4]) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return nil, fmt.Errorf("%s: checksum mismatch", filepath.Base(path))
+	}
+	return b[:len(b)-4], nil
+}
+
+// writeChecked 以临时文件加重命名的方式写入 body 与其 CRC32
+func writeChecked(path string, body []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	body = binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func appendRecord(b []byte, body []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(body)))
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(body))
+}
+
+func entryRecord(e *Entry) []byte {
+	enc := &encoder{b: []byte{'E'}}
+	enc.entry(e)
+	return enc.b
+}
+
+// saveState 持久化任期与投票
+func (l *raftLog) saveState(term uint64, vote string) error {
+	if l.dir == "" {
+		return nil
+	}
+	e := &encoder{}
+	e.uvarint(term)
+	e.string(vote)
+	return writeChecked(filepath.Join(l.dir, stateFile), e.b)
+}
+
+func (l *raftLog) lastIndex() uint64 { return l.snapIndex + uint64(len(l.entries)) }
+
+func (l *raftLog) lastTerm() uint64 {
+	if len(l.entries) == 0 {
+		return l.snapTerm
+	}
+	return l.entries[len(l.entries)-1].Term
+}
+
+// entry 返回 index 处的条目；已被快照压缩或不存在时返回 nil
+func (l *raftLog) entry(index uint64) *Entry {
+	if index <= l.snapIndex || index > l.lastIndex() {
+		return nil
+	}
+	return &l.entries[index-l.snapIndex-1]
+}
+
+// term 返回 index 处条目的任期；ok 为 false 表示该条目已被压缩（快照本身的
+// 索引除外）或不存在
+func (l *raftLog) term(index uint64) (uint64, bool) {
+	if index == l.snapIndex {
+		return l.snapTerm, true
+	}
+	if e := l.entry(index); e != nil {
+		return e.Term, true
+	}
+	return 0, false
+}
+
+// slice 返回 [from, to] 的条目副本（最多 max 条）
+func (l *raftLog) slice(from, to uint64, max int) []Entry {
+	if from <= l.snapIndex {
+		from = l.snapIndex + 1
+	}
+	if to > l.lastIndex() {
+		to = l.lastIndex()
+	}
+	if from > to {
+		return nil
+	}
+	if to-from >= uint64(max) {
+		to = from + uint64(max) - 1
+	}
+	return append([]Entry(nil), l.entries[from-l.snapIndex-1:to-l.snapIndex]...)
+}
+
+// append 追加条目并写入磁盘
+func (l *raftLog) append(entries ...Entry) error {
+	if l.f != nil {
+		var b []byte
+		for i := range entries {
+			b = appendRecord(b, entryRecord(&entries[i]))
+		}
+		if _, err := l.f.Write(b); err != nil {
+			return err
+		}
+		if err := l.f.Sync(); err != nil {
+			return err
+		}
+	}
+	l.entries = append(l.entries, entries...)
+	return nil
+}
+
+// truncate 删除 from 及之后的条目并写入磁盘
+func (l *raftLog) truncate(from uint64) error {
+	if from > l.lastIndex() {
+		return nil
+	}
+	if l.f != nil {
+		e := &encoder{b: []byte{'T'}}
+		e.uvarint(from)
+		if _, err := l.f.Write(appendRecord(nil, e.b)); err != nil {
+			return err
+		}
+	}
+	l.truncateMem(from)
+	return nil
+}
+
+func (l *raftLog) truncateMem(from uint64) {
+	if from <= l.snapIndex {
+		l.entries = nil
+	} else if from <= l.lastIndex() {
+		l.entries = l.entries[:from-l.snapIndex-1]
+	}
+}
+
+// members 返回 index 及之前最新的成员配置（包括未提交的配置条目）及其索引
+func (l *raftLog) members(index uint64) ([]string, uint64) {
+	for i := min(index, l.lastIndex()); i > l.snapIndex; i-- {
+		if e := l.entry(i); e.Type == EntryConfig {
+			return decodeMembers(e.Data), i
+		}
+	}
+	return l.snapMembers, l.snapIndex
+}
+
+// saveSnapshot 保存 index 处的快照，并丢弃已包含在其中的条目。index 之后的条目
+// 在其任期与快照一致时保留（本地压缩），否则全部丢弃（来自领导者的快照）。
+func (l *raftLog) saveSnapshot(index, term uint64, members []string, data []byte) error {
+	keep := []Entry(nil)
+	if t, ok := l.term(index); ok && t == term {
+		keep = append(keep, l.entries[index-l.snapIndex:]...)
+	}
+	if l.dir != "" {
+		e := &encoder{}
+		e.uvarint(index)
+		e.uvarint(term)
+		e.strings(members)
+		e.bytes(data)
+		if err := writeChecked(filepath.Join(l.dir, snapshotFile), e.b); err != nil {
+			return err
+		}
+		if err := l.rewrite(keep); err != nil {
+			return err
+		}
+	}
+	l.snapIndex, l.snapTerm, l.snapMembers, l.snapData = index, term, members, data
+	l.entries = keep
+	return nil
+}
+
+// rewrite 以 entries 重写日志文件
+func (l *raftLog) rewrite(entries []Entry) error {
+	path := filepath.Join(l.dir, logFile)
+	tmp := path + ".tmp"
+	var b []byte
+	for i := range entries {
+		b = appendRecord(b, entryRecord(&entries[i]))
+	}
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.f.Close()
+	l.f = f
+	return f.Sync()
+}
+
+func (l *raftLog) close() {
+	if l.f != nil {
+		l.f.Close()
+	}
+}
+
+func encodeMembers(members []string) []byte {
+	e := &encoder{}
+	e.strings(members)
+	return e.b
+}
+
+func decodeMembers(b []byte) []string {
+	d := &decoder{b: b}
+	return d.strings()
+}
@@ -0,0 +1,908 @@
+// Package raft 实现 Raft 共识：领导者选举、日志复制、快照与单节点成员变更。
+//
+// 节点以客户端地址（host:port）标识，RPC 由 Transport 发送（服务器中为发往对方
+// 客户端端口的 RAFT 命令）。已提交的命令条目按顺序交给 FSM 应用；日志超过
+// SnapshotThreshold 条后由 FSM 生成快照并压缩日志，落后太多的跟随者通过
+// InstallSnapshot 直接接收快照。
+//
+// 与论文一致的几点：每个任期每个节点只投一票，且只投给日志不比自己旧的候选者；
+// 领导者只直接提交本任期的条目（当选后追加一条 no-op 以提交之前任期的条目）；
+// 成员变更每次增删一个节点，配置条目追加后即生效，提交前不允许下一次变更。
+// 此外领导者在一个选举超时内联系不上多数节点时主动退位（check quorum），最近
+// 收到过领导者消息的节点忽略更高任期的投票请求，避免被移除的节点干扰集群。
+package raft
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EntryType is the kind of a log entry.
+type EntryType byte
+
+const (
+	// EntryCommand 为交给 FSM 的命令
+	EntryCommand EntryType = iota
+	// EntryNoop 由新领导者在任期开始时追加，用于提交此前任期的条目
+	EntryNoop
+	// EntryConfig 为成员配置（节点地址列表）
+	EntryConfig
+)
+
+// Entry is a log entry.
+type Entry struct {
+	Index uint64
+	Term  uint64
+	Type  EntryType
+	Data  []byte
+}
+
+// FSM is the replicated state machine.
+type FSM interface {
+	// Apply applies a committed command entry. Entries are applied in log
+	// order, each exactly once unless a snapshot is restored over them.
+	Apply(index uint64, data []byte)
+	// Snapshot serializes the state and returns the index of the last entry
+	// it reflects, which must be committed.
+	Snapshot() (data []byte, index uint64, err error)
+	// Restore replaces the state with a snapshot taken at index.
+	Restore(data []byte, index uint64) error
+}
+
+var (
+	ErrNotLeader      = errors.New("raft: not the leader")
+	ErrPending        = errors.New("raft: earlier entries are not applied yet")
+	ErrLeadershipLost = errors.New("raft: leadership lost before the entry was committed")
+	ErrTimeout        = errors.New("raft: timed out waiting for the entry to be committed")
+	ErrConfigChange   = errors.New("raft: a membership change is already in progress")
+	ErrInitialized    = errors.New("raft: node already has a log")
+	ErrStopped        = errors.New("raft: node stopped")
+)
+
+const (
+	defaultElectionTimeout   = time.Second
+	defaultSnapshotThreshold = 1024
+	// maxAppendEntries 为一次 AppendEntries 携带的最大条目数
+	maxAppendEntries = 256
+)
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	switch r {
+	case candidate:
+		return "candidate"
+	case leader:
+		return "leader"
+	}
+	return "follower"
+}
+
+// Node is a member of a Raft cluster.
+type Node struct {
+	id  string
+	fsm FSM
+	tr  Transport
+	// ElectionTimeout 为跟随者多久收不到领导者消息后发起选举（实际取其 1 到 2 倍
+	// 之间的随机值）；HeartbeatInterval 为领导者发送心跳的间隔，0 表示
+	// ElectionTimeout 的十分之一；日志超过 SnapshotThreshold 条时生成快照，0 表示
+	// 不生成。需在 Start 之前设置。
+	ElectionTimeout   time.Duration
+	HeartbeatInterval time.Duration
+	SnapshotThreshold uint64
+
+	mu          sync.Mutex
+	log         *raftLog
+	role        role
+	term        uint64
+	vote        string
+	leader      string
+	commitIndex uint64
+	lastApplied uint64
+	// restore 表示 log 中的快照尚未交给 FSM
+	restore bool
+
+	electionDeadline  time.Time
+	lastLeaderContact time.Time
+	votes             map[string]bool
+
+	// 领导者状态：每个跟随者的 nextIndex、matchIndex、最近一次回复的时间，以及
+	// 通知其复制协程有新条目的通道
+	next    map[string]uint64
+	match   map[string]uint64
+	contact map[string]time.Time
+	wake    map[string]chan struct{}
+
+	// changed 在提交、应用或角色变化时关闭并替换，用于等待
+	changed chan struct{}
+	applyCh chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewNode creates a node identified by addr and loads its persistent state
+// from dir; an empty dir keeps everything in memory. A node without a log
+// does not start elections until it is bootstrapped or added to a cluster.
+func NewNode(addr, dir string, fsm FSM, tr Transport) (*Node, error) {
+	l, term, vote, err := openLog(dir)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		id:                addr,
+		fsm:               fsm,
+		tr:                tr,
+		ElectionTimeout:   defaultElectionTimeout,
+		SnapshotThreshold: defaultSnapshotThreshold,
+		log:               l,
+		term:              term,
+		vote:              vote,
+		commitIndex:       l.snapIndex,
+		lastApplied:       l.snapIndex,
+		restore:           l.snapData != nil,
+		changed:           make(chan struct{}),
+		applyCh:           make(chan struct{}, 1),
+		stop:              make(chan struct{}),
+	}
+	return n, nil
+}
+
+// ID returns the address that identifies the node.
+func (n *Node) ID() string { return n.id }
+
+// Start starts the election timer and the apply loop.
+func (n *Node) Start() {
+	if n.HeartbeatInterval <= 0 {
+		n.HeartbeatInterval = n.ElectionTimeout / 10
+	}
+	n.mu.Lock()
+	n.resetElectionTimer()
+	n.mu.Unlock()
+	n.wg.Add(2)
+	go n.run()
+	go n.applyLoop()
+	n.signalApply()
+}
+
+// Stop stops the node; it no longer sends or answers RPCs.
+func (n *Node) Stop() {
+	n.mu.Lock()
+	select {
+	case <-n.stop:
+		n.mu.Unlock()
+		return
+	default:
+	}
+	close(n.stop)
+	n.role = follower
+	n.notify()
+	n.mu.Unlock()
+	n.wg.Wait()
+	n.mu.Lock()
+	n.log.close()
+	n.mu.Unlock()
+}
+
+func (n *Node) stopped() bool {
+	select {
+	case <-n.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Bootstrap makes the node the only member of a new cluster; it elects
+// itself right away. Other nodes are then added with AddNode.
+func (n *Node) Bootstrap() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.log.lastIndex() > 0 || n.term > 0 {
+		return ErrInitialized
+	}
+	n.term = 1
+	if err := n.log.saveState(n.term, ""); err != nil {
+		return err
+	}
+	e := Entry{Index: 1, Term: 1, Type: EntryConfig, Data: encodeMembers([]string{n.id})}
+	if err := n.log.append(e); err != nil {
+		return err
+	}
+	n.commitIndex = 1
+	n.electionDeadline = time.Now()
+	n.signalApply()
+	return nil
+}
+
+// run 定期检查选举超时，领导者检查是否仍能联系到多数节点
+func (n *Node) run() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(max(n.HeartbeatInterval/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case now := <-ticker.C:
+			n.mu.Lock()
+			n.tick(now)
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *Node) tick(now time.Time) {
+	members := n.members()
+	if n.role == leader {
+		count := 0
+		for _, m := range members {
+			if m == n.id || now.Sub(n.contact[m]) < n.ElectionTimeout {
+				count++
+			}
+		}
+		if count < quorum(members) {
+			log.Printf("raft: lost contact with the majority, stepping down in term %d", n.term)
+			n.becomeFollower(n.term, "")
+		}
+		return
+	}
+	if now.After(n.electionDeadline) && slices.Contains(members, n.id) {
+		n.startElection()
+	}
+}
+
+// members 返回最新的成员配置
+func (n *Node) members() []string {
+	m, _ := n.log.members(n.log.lastIndex())
+	return m
+}
+
+func quorum(members []string) int { return len(members)/2 + 1 }
+
+func (n *Node) resetElectionTimer() {
+	n.electionDeadline = time.Now().Add(n.ElectionTimeout + time.Duration(rand.Int63n(int64(n.ElectionTimeout))))
+}
+
+// notify 唤醒等待状态变化的调用方；调用方需持有 n.mu
+func (n *Node) notify() {
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+func (n *Node) signalApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+// saveState 持久化任期与投票；失败时无法保证安全，只能停止参与
+func (n *Node) saveState() bool {
+	if err := n.log.saveState(n.term, n.vote); err != nil {
+		log.Printf("raft: persisting term and vote: %v", err)
+		return false
+	}
+	return true
+}
+
+func (n *Node) becomeFollower(term uint64, leaderID string) {
+	if term > n.term {
+		n.term, n.vote = term, ""
+		n.saveState()
+	}
+	if n.role == leader {
+		log.Printf("raft: %s is no longer the leader in term %d", n.id, n.term)
+	}
+	n.role = follower
+	n.leader = leaderID
+	n.notify()
+}
+
+func (n *Node) startElection() {
+	n.term++
+	n.vote = n.id
+	n.role = candidate
+	n.leader = ""
+	if !n.saveState() {
+		return
+	}
+	n.resetElectionTimer()
+	n.votes = map[string]bool{n.id: true}
+	n.notify()
+	log.Printf("raft: %s starting election for term %d", n.id, n.term)
+	req := &voteRequest{Term: n.term, Candidate: n.id, LastIndex: n.log.lastIndex(), LastTerm: n.log.lastTerm()}
+	members := n.members()
+	if n.countVotes(members) >= quorum(members) {
+		n.becomeLeader()
+		return
+	}
+	for _, m := range members {
+		if m != n.id {
+			go n.requestVote(m, req)
+		}
+	}
+}
+
+func (n *Node) countVotes(members []string) int {
+	count := 0
+	for _, m := range members {
+		if n.votes[m] {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *Node) requestVote(peer string, req *voteRequest) {
+	b, err := n.tr.Call(peer, rpcRequestVote, req.marshal())
+	var reply voteReply
+	if err == nil {
+		err = reply.unmarshal(b)
+	}
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() {
+		return
+	}
+	if reply.Term > n.term {
+		n.becomeFollower(reply.Term, "")
+		return
+	}
+	if n.role != candidate || n.term != req.Term || !reply.Granted {
+		return
+	}
+	n.votes[peer] = true
+	if members := n.members(); n.countVotes(members) >= quorum(members) {
+		n.becomeLeader()
+	}
+}
+
+func (n *Node) becomeLeader() {
+	n.role = leader
+	n.leader = n.id
+	log.Printf("raft: %s elected leader for term %d", n.id, n.term)
+	last := n.log.lastIndex()
+	n.next = make(map[string]uint64)
+	n.match = make(map[string]uint64)
+	n.contact = make(map[string]time.Time)
+	n.wake = make(map[string]chan struct{})
+	now := time.Now()
+	for _, m := range n.members() {
+		if m != n.id {
+			n.startReplicator(m, last+1, now)
+		}
+	}
+	if err := n.log.append(Entry{Index: last + 1, Term: n.term, Type: EntryNoop}); err != nil {
+		log.Printf("raft: appending no-op entry: %v", err)
+		n.becomeFollower(n.term, "")
+		return
+	}
+	n.advanceCommit()
+	n.notify()
+}
+
+// startReplicator 启动向 peer 复制日志的协程；调用方需持有 n.mu
+func (n *Node) startReplicator(peer string, next uint64, now time.Time) {
+	ch := make(chan struct{}, 1)
+	n.next[peer], n.match[peer], n.contact[peer], n.wake[peer] = next, 0, now, ch
+	n.wg.Add(1)
+	go n.replicate(peer, n.term, ch)
+}
+
+func (n *Node) wakePeers() {
+	for _, ch := range n.wake {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// replicate 在 term 任期内持续向 peer 发送日志条目，没有新条目时按心跳间隔发送
+// 空的 AppendEntries；不再是该任期的领导者或 peer 被移除后退出
+func (n *Node) replicate(peer string, term uint64, wake chan struct{}) {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		ok, more := n.sendAppend(peer, term)
+		if !ok {
+			return
+		}
+		if more {
+			continue
+		}
+		select {
+		case <-n.stop:
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendAppend 向 peer 发送一次 AppendEntries（nextIndex 已被快照压缩时发送
+// InstallSnapshot）。ok 为 false 表示复制应当停止；more 表示还有未发送的条目。
+func (n *Node) sendAppend(peer string, term uint64) (ok, more bool) {
+	n.mu.Lock()
+	if n.stopped() || n.role != leader || n.term != term || !slices.Contains(n.members(), peer) {
+		n.mu.Unlock()
+		return false, false
+	}
+	next := n.next[peer]
+	if next <= n.log.snapIndex {
+		req := &snapshotRequest{Term: term, Leader: n.id, Index: n.log.snapIndex, SnapTerm: n.log.snapTerm,
+			Members: n.log.snapMembers, Data: n.log.snapData}
+		n.mu.Unlock()
+		return n.sendSnapshot(peer, req)
+	}
+	prevTerm, _ := n.log.term(next - 1)
+	req := &appendRequest{Term: term, Leader: n.id, PrevIndex: next - 1, PrevTerm: prevTerm,
+		Entries: n.log.slice(next, n.log.lastIndex(), maxAppendEntries), Commit: n.commitIndex}
+	n.mu.Unlock()
+
+	b, err := n.tr.Call(peer, rpcAppendEntries, req.marshal())
+	var reply appendReply
+	if err == nil {
+		err = reply.unmarshal(b)
+	}
+	if err != nil {
+		return true, false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if reply.Term > n.term {
+		n.becomeFollower(reply.Term, "")
+		return false, false
+	}
+	if n.role != leader || n.term != term {
+		return false, false
+	}
+	n.contact[peer] = time.Now()
+	if reply.Success {
+		n.match[peer] = max(n.match[peer], reply.Index)
+		n.next[peer] = max(n.next[peer], reply.Index+1)
+		n.advanceCommit()
+	} else {
+		// 跟随者给出的提示总是小于本次尝试的 nextIndex
+		n.next[peer] = max(min(reply.Index, req.PrevIndex), 1)
+	}
+	return true, n.next[peer] <= n.log.lastIndex()
+}
+
+func (n *Node) sendSnapshot(peer string, req *snapshotRequest) (ok, more bool) {
+	b, err := n.tr.Call(peer, rpcInstallSnapshot, req.marshal())
+	var reply snapshotReply
+	if err == nil {
+		err = reply.unmarshal(b)
+	}
+	if err != nil {
+		return true, false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if reply.Term > n.term {
+		n.becomeFollower(reply.Term, "")
+		return false, false
+	}
+	if n.role != leader || n.term != req.Term {
+		return false, false
+	}
+	n.contact[peer] = time.Now()
+	n.match[peer] = max(n.match[peer], req.Index)
+	n.next[peer] = max(n.next[peer], req.Index+1)
+	return true, n.next[peer] <= n.log.lastIndex()
+}
+
+// advanceCommit 提交已复制到多数节点的本任期条目；提交了不含自己的配置后退位
+func (n *Node) advanceCommit() {
+	members := n.members()
+	for idx := n.log.lastIndex(); idx > n.commitIndex; idx-- {
+		if t, _ := n.log.term(idx); t != n.term {
+			break
+		}
+		count := 0
+		for _, m := range members {
+			if m == n.id || n.match[m] >= idx {
+				count++
+			}
+		}
+		if count >= quorum(members) {
+			n.commitIndex = idx
+			n.signalApply()
+			n.notify()
+			break
+		}
+	}
+	if committed, _ := n.log.members(n.commitIndex); n.role == leader && !slices.Contains(committed, n.id) {
+		log.Printf("raft: %s removed from the cluster, stepping down", n.id)
+		n.becomeFollower(n.term, "")
+	}
+}
+
+func (n *Node) handleRequestVote(req *voteRequest) *voteReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// 最近收到过领导者消息（或自己就是领导者）时不理会更高任期的请求
+	recent := n.role == leader || (n.leader != "" && time.Since(n.lastLeaderContact) < n.ElectionTimeout)
+	if n.stopped() || req.Term < n.term || (req.Term > n.term && recent) {
+		return &voteReply{Term: n.term}
+	}
+	// 新的任期与投票一并持久化：投票的往返只包含一次写入，选举不会因磁盘同步
+	// 耗时超过选举超时而反复瓜分选票
+	newTerm := req.Term > n.term
+	if newTerm {
+		n.term, n.vote = req.Term, ""
+		n.becomeFollower(req.Term, "")
+	}
+	lastTerm, lastIndex := n.log.lastTerm(), n.log.lastIndex()
+	upToDate := req.LastTerm > lastTerm || (req.LastTerm == lastTerm && req.LastIndex >= lastIndex)
+	granted := (n.vote == "" || n.vote == req.Candidate) && upToDate
+	if granted {
+		n.vote = req.Candidate
+	}
+	if (granted || newTerm) && !n.saveState() {
+		return &voteReply{Term: n.term}
+	}
+	if granted {
+		n.resetElectionTimer()
+	}
+	return &voteReply{Term: n.term, Granted: granted}
+}
+
+// acceptLeader 处理来自当前任期领导者的消息；调用方需持有 n.mu
+func (n *Node) acceptLeader(term uint64, leaderID string) {
+	if term > n.term || n.role != follower {
+		n.becomeFollower(term, leaderID)
+	}
+	if n.leader != leaderID {
+		n.leader = leaderID
+		n.notify()
+	}
+	n.lastLeaderContact = time.Now()
+	n.resetElectionTimer()
+}
+
+func (n *Node) handleAppendEntries(req *appendRequest) *appendReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() || req.Term < n.term {
+		return &appendReply{Term: n.term}
+	}
+	n.acceptLeader(req.Term, req.Leader)
+	fail := &appendReply{Term: n.term}
+
+	if req.PrevIndex > n.log.lastIndex() {
+		fail.Index = n.log.lastIndex() + 1
+		return fail
+	}
+	if req.PrevIndex > n.log.snapIndex {
+		if t, _ := n.log.term(req.PrevIndex); t != req.PrevTerm {
+			// 跳过冲突任期的全部条目
+			idx := req.PrevIndex
+			for idx-1 > n.log.snapIndex {
+				if pt, _ := n.log.term(idx - 1); pt != t {
+					break
+				}
+				idx--
+			}
+			fail.Index = idx
+			return fail
+		}
+	}
+	for i, e := range req.Entries {
+		if e.Index <= n.log.snapIndex {
+			continue
+		}
+		if t, ok := n.log.term(e.Index); ok {
+			if t == e.Term {
+				continue
+			}
+			if err := n.log.truncate(e.Index); err != nil {
+				log.Printf("raft: truncating log: %v", err)
+				return fail
+			}
+		}
+		if err := n.log.append(req.Entries[i:]...); err != nil {
+			log.Printf("raft: appending entries: %v", err)
+			return fail
+		}
+		break
+	}
+	last := req.PrevIndex + uint64(len(req.Entries))
+	if c := min(req.Commit, last); c > n.commitIndex {
+		n.commitIndex = c
+		n.signalApply()
+		n.notify()
+	}
+	return &appendReply{Term: n.term, Success: true, Index: last}
+}
+
+func (n *Node) handleInstallSnapshot(req *snapshotRequest) *snapshotReply {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped() || req.Term < n.term {
+		return &snapshotReply{Term: n.term}
+	}
+	n.acceptLeader(req.Term, req.Leader)
+	if req.Index <= n.lastApplied {
+		return &snapshotReply{Term: n.term}
+	}
+	if err := n.log.saveSnapshot(req.Index, req.SnapTerm, req.Members, req.Data); err != nil {
+		log.Printf("raft: saving snapshot: %v", err)
+		return &snapshotReply{Term: n.term}
+	}
+	log.Printf("raft: %s installed snapshot at index %d from %s", n.id, req.Index, req.Leader)
+	n.restore = true
+	n.commitIndex = max(n.commitIndex, req.Index)
+	n.signalApply()
+	return &snapshotReply{Term: n.term}
+}
+
+// applyLoop 将已提交的条目依次交给 FSM，并在日志过长时生成快照。FSM 的调用
+// 不持有 n.mu，FSM 可以在其中等待其他持有状态机锁的操作（如等待提交的写命令）。
+func (n *Node) applyLoop() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-n.applyCh:
+		}
+		for n.applyOnce() {
+		}
+		n.maybeSnapshot()
+	}
+}
+
+func (n *Node) applyOnce() bool {
+	n.mu.Lock()
+	if n.stopped() {
+		n.mu.Unlock()
+		return false
+	}
+	if n.restore {
+		data, index := n.log.snapData, n.log.snapIndex
+		n.restore = false
+		n.mu.Unlock()
+		if err := n.fsm.Restore(data, index); err != nil {
+			log.Printf("raft: restoring snapshot at index %d: %v", index, err)
+		}
+		n.mu.Lock()
+		n.lastApplied = index
+		n.notify()
+		n.mu.Unlock()
+		return true
+	}
+	if n.lastApplied >= n.commitIndex {
+		n.mu.Unlock()
+		return false
+	}
+	entries := n.log.slice(n.lastApplied+1, n.commitIndex, maxAppendEntries)
+	n.mu.Unlock()
+	for _, e := range entries {
+		if e.Type == EntryCommand {
+			n.fsm.Apply(e.Index, e.Data)
+		}
+	}
+	n.mu.Lock()
+	if len(entries) > 0 && !n.restore {
+		n.lastApplied = max(n.lastApplied, entries[len(entries)-1].Index)
+	}
+	n.notify()
+	n.mu.Unlock()
+	return true
+}
+
+// maybeSnapshot 在快照之后的已应用条目超过 SnapshotThreshold 时生成快照并压缩日志
+func (n *Node) maybeSnapshot() {
+	n.mu.Lock()
+	should := n.SnapshotThreshold > 0 && n.lastApplied-n.log.snapIndex >= n.SnapshotThreshold
+	n.mu.Unlock()
+	if !should {
+		return
+	}
+	data, index, err := n.fsm.Snapshot()
+	if err != nil {
+		log.Printf("raft: snapshot: %v", err)
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	term, ok := n.log.term(index)
+	if n.restore || index <= n.log.snapIndex || index > n.commitIndex || !ok {
+		return
+	}
+	members, _ := n.log.members(index)
+	if err := n.log.saveSnapshot(index, term, members, data); err != nil {
+		log.Printf("raft: saving snapshot: %v", err)
+		return
+	}
+	n.lastApplied = max(n.lastApplied, index)
+	log.Printf("raft: %s compacted the log up to index %d", n.id, index)
+}
+
+// Propose appends a command entry to the leader's log and returns its index
+// and term; use Wait to know when it is committed.
+func (n *Node) Propose(data []byte) (index, term uint64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.appendLocked(EntryCommand, data)
+}
+
+func (n *Node) appendLocked(t EntryType, data []byte) (index, term uint64, err error) {
+	if n.role != leader || n.stopped() {
+		return 0, 0, ErrNotLeader
+	}
+	e := Entry{Index: n.log.lastIndex() + 1, Term: n.term, Type: t, Data: data}
+	if err := n.log.append(e); err != nil {
+		return 0, 0, err
+	}
+	n.wakePeers()
+	n.advanceCommit()
+	return e.Index, e.Term, nil
+}
+
+// CanPropose reports whether the leader can execute a new command against a
+// state machine that reflects the log up to index: it returns ErrNotLeader
+// on other nodes and ErrPending while the log holds later command entries.
+func (n *Node) CanPropose(index uint64) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role != leader || n.stopped() {
+		return ErrNotLeader
+	}
+	for i := n.log.lastIndex(); i > index && i > n.log.snapIndex; i-- {
+		if n.log.entry(i).Type == EntryCommand {
+			return ErrPending
+		}
+	}
+	return nil
+}
+
+// Wait waits until the entry at index from term is committed. It fails with
+// ErrLeadershipLost once the entry can no longer be committed by this node
+// as leader of term; the entry may still be committed by a later leader.
+func (n *Node) Wait(index, term uint64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		n.mu.Lock()
+		t, ok := n.log.term(index)
+		if ok && t == term && n.commitIndex >= index {
+			n.mu.Unlock()
+			return nil
+		}
+		if !ok || t != term || n.term != term || n.role != leader {
+			n.mu.Unlock()
+			return ErrLeadershipLost
+		}
+		ch := n.changed
+		n.mu.Unlock()
+		select {
+		case <-ch:
+		case <-timer.C:
+			return ErrTimeout
+		case <-n.stop:
+			return ErrStopped
+		}
+	}
+}
+
+// WaitApplied waits until the entries up to index have been applied.
+func (n *Node) WaitApplied(index uint64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		n.mu.Lock()
+		applied, ch := n.lastApplied, n.changed
+		n.mu.Unlock()
+		if applied >= index {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-timer.C:
+			return ErrTimeout
+		case <-n.stop:
+			return ErrStopped
+		}
+	}
+}
+
+// AddNode appends a configuration entry that adds addr to the cluster and
+// returns its index and term. The new node must be running with an empty
+// log; it receives the log (or a snapshot) from the leader.
+func (n *Node) AddNode(addr string) (index, term uint64, err error) {
+	return n.changeMembers(addr, true)
+}
+
+// RemoveNode appends a configuration entry that removes addr from the
+// cluster. A leader that removes itself steps down once the entry commits.
+func (n *Node) RemoveNode(addr string) (index, term uint64, err error) {
+	return n.changeMembers(addr, false)
+}
+
+func (n *Node) changeMembers(addr string, add bool) (index, term uint64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.role != leader {
+		return 0, 0, ErrNotLeader
+	}
+	members, at := n.log.members(n.log.lastIndex())
+	if at > n.commitIndex {
+		return 0, 0, ErrConfigChange
+	}
+	if slices.Contains(members, addr) == add {
+		// 已经是（或已经不是）成员
+		return n.commitIndex, n.term, nil
+	}
+	var updated []string
+	if add {
+		updated = append(slices.Clone(members), addr)
+	} else {
+		for _, m := range members {
+			if m != addr {
+				updated = append(updated, m)
+			}
+		}
+	}
+	if index, term, err = n.appendLocked(EntryConfig, encodeMembers(updated)); err != nil {
+		return 0, 0, err
+	}
+	log.Printf("raft: membership change at index %d: %v", index, updated)
+	if add {
+		n.startReplicator(addr, n.log.lastIndex(), time.Now())
+	}
+	return index, term, nil
+}
+
+// Status is a point-in-time view of the node's state.
+type Status struct {
+	ID            string
+	Role          string
+	Term          uint64
+	Leader        string
+	CommitIndex   uint64
+	LastApplied   uint64
+	LastIndex     uint64
+	SnapshotIndex uint64
+	Members       []string
+}
+
+// Status returns the node's current state.
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		ID:            n.id,
+		Role:          n.role.String(),
+		Term:          n.term,
+		Leader:        n.leader,
+		CommitIndex:   n.commitIndex,
+		LastApplied:   n.lastApplied,
+		LastIndex:     n.log.lastIndex(),
+		SnapshotIndex: n.log.snapIndex,
+		Members:       slices.Clone(n.members()),
+	}
+}
+
+// Leader returns the address of the current leader, or "" if unknown.
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
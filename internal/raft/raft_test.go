@@ -0,0 +1,369 @@
+package raft
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTransport 在进程内投递 RPC，可以断开指定节点
+type memTransport struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+	down  map[string]bool
+}
+
+func (t *memTransport) Call(addr, name string, payload []byte) ([]byte, error) {
+	t.mu.Lock()
+	n := t.nodes[addr]
+	down := t.down[addr]
+	t.mu.Unlock()
+	if n == nil || down {
+		return nil, fmt.Errorf("%s unreachable", addr)
+	}
+	return n.HandleRPC(name, payload)
+}
+
+// from 返回以 addr 身份发送的传输；addr 被断开时请求同样失败
+func (t *memTransport) from(addr string) Transport {
+	return transportFunc(func(to, name string, payload []byte) ([]byte, error) {
+		t.mu.Lock()
+		down := t.down[addr]
+		t.mu.Unlock()
+		if down {
+			return nil, fmt.Errorf("%s unreachable", addr)
+		}
+		return t.Call(to, name, payload)
+	})
+}
+
+func (t *memTransport) setDown(addr string, down bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.down[addr] = down
+}
+
+type transportFunc func(addr, name string, payload []byte) ([]byte, error)
+
+func (f transportFunc) Call(addr, name string, payload []byte) ([]byte, error) {
+	return f(addr, name, payload)
+}
+
+// kvFSM 记录 "key=value" 命令
+type kvFSM struct {
+	mu    sync.Mutex
+	data  map[string]string
+	index uint64
+}
+
+func (f *kvFSM) Apply(index uint64, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	k, v, _ := bytes.Cut(data, []byte("="))
+	f.data[string(k)] = string(v)
+	f.index = index
+}
+
+func (f *kvFSM) Snapshot() ([]byte, uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var b []byte
+	for k, v := range f.data {
+		b = append(b, k+"="+v+"\n"...)
+	}
+	return b, f.index, nil
+}
+
+func (f *kvFSM) Restore(data []byte, index uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data = make(map[string]string)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if k, v, ok := bytes.Cut(line, []byte("=")); ok {
+			f.data[string(k)] = string(v)
+		}
+	}
+	f.index = index
+	return nil
+}
+
+func (f *kvFSM) get(k string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data[k]
+}
+
+type testCluster struct {
+	t     *testing.T
+	tr    *memTransport
+	nodes map[string]*Node
+	fsms  map[string]*kvFSM
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	c := &testCluster{t: t, tr: &memTransport{nodes: map[string]*Node{}, down: map[string]bool{}},
+		nodes: map[string]*Node{}, fsms: map[string]*kvFSM{}}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.Stop()
+		}
+	})
+	return c
+}
+
+// testElectionTimeout 为测试集群的选举超时。一轮选举的往返包含候选者与投票者
+// 各一次带 fsync 的状态写入，在较慢的磁盘或 -race 下可达上百毫秒；超时须远大于
+// 这一耗时，否则候选者在收到投票前就已超时，选举反复瓜分选票
+const testElectionTimeout = 500 * time.Millisecond
+
+// start 启动（或以 dir 中的状态重启）节点 addr
+func (c *testCluster) start(addr, dir string, threshold uint64) *Node {
+	c.t.Helper()
+	fsm := &kvFSM{data: map[string]string{}}
+	n, err := NewNode(addr, dir, fsm, c.tr.from(addr))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	n.ElectionTimeout = testElectionTimeout
+	n.SnapshotThreshold = threshold
+	c.tr.mu.Lock()
+	c.tr.nodes[addr] = n
+	c.tr.mu.Unlock()
+	c.nodes[addr], c.fsms[addr] = n, fsm
+	n.Start()
+	return n
+}
+
+func (c *testCluster) leader(exclude ...string) *Node {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+	next:
+		for addr, n := range c.nodes {
+			for _, e := range exclude {
+				if addr == e {
+					continue next
+				}
+			}
+			if n.Status().Role == "leader" {
+				return n
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+func (c *testCluster) propose(n *Node, kv string) {
+	c.t.Helper()
+	index, term, err := n.Propose([]byte(kv))
+	if err == nil {
+		err = n.Wait(index, term, 5*time.Second)
+	}
+	if err != nil {
+		c.t.Fatalf("propose %s: %v", kv, err)
+	}
+}
+
+func (c *testCluster) waitValue(addr, key, want string) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.fsms[addr].get(key) != want {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("%s: %s = %q, want %q", addr, key, c.fsms[addr].get(key), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (c *testCluster) change(add bool, addr string) {
+	c.t.Helper()
+	n := c.leader()
+	var index, term uint64
+	var err error
+	if add {
+		index, term, err = n.AddNode(addr)
+	} else {
+		index, term, err = n.RemoveNode(addr)
+	}
+	if err == nil {
+		err = n.Wait(index, term, 5*time.Second)
+	}
+	if err != nil {
+		c.t.Fatalf("membership change %s: %v", addr, err)
+	}
+}
+
+// threeNodes 自举 a 后加入 b、c
+func threeNodes(t *testing.T, threshold uint64, dirs ...string) *testCluster {
+	c := newTestCluster(t)
+	for i, addr := range []string{"a", "b", "c"} {
+		dir := ""
+		if i < len(dirs) {
+			dir = dirs[i]
+		}
+		c.start(addr, dir, threshold)
+	}
+	if err := c.nodes["a"].Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.nodes["a"].Bootstrap(); !errors.Is(err, ErrInitialized) {
+		t.Fatalf("second Bootstrap: %v", err)
+	}
+	c.leader()
+	c.change(true, "b")
+	c.change(true, "c")
+	return c
+}
+
+func TestReplicationAndFailover(t *testing.T) {
+	c := threeNodes(t, 0)
+	l := c.leader()
+	c.propose(l, "k=1")
+	for addr := range c.nodes {
+		c.waitValue(addr, "k", "1")
+	}
+	for addr, n := range c.nodes {
+		if n != l {
+			if _, _, err := n.Propose([]byte("x=1")); !errors.Is(err, ErrNotLeader) {
+				t.Fatalf("%s: Propose on follower: %v", addr, err)
+			}
+			if n.Leader() != l.ID() {
+				t.Fatalf("%s: leader = %q, want %q", addr, n.Leader(), l.ID())
+			}
+		}
+	}
+
+	// 断开领导者后其余两个节点选出新的领导者，旧领导者因联系不上多数节点而退位
+	c.tr.setDown(l.ID(), true)
+	nl := c.leader(l.ID())
+	c.propose(nl, "k=2")
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Status().Role == "leader" {
+		if time.Now().After(deadline) {
+			t.Fatal("isolated leader did not step down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, _, err := l.Propose([]byte("k=stale")); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("Propose on the isolated node: %v", err)
+	}
+
+	// 恢复后旧领导者追上日志
+	c.tr.setDown(l.ID(), false)
+	c.waitValue(l.ID(), "k", "2")
+	if st := nl.Status(); st.Role != "leader" {
+		t.Fatalf("rejoining node disrupted the leader: %+v", st)
+	}
+}
+
+func TestSnapshotInstall(t *testing.T) {
+	c := threeNodes(t, 8)
+	l := c.leader()
+	var lagging string
+	for addr := range c.nodes {
+		if addr != l.ID() {
+			lagging = addr
+			break
+		}
+	}
+	c.tr.setDown(lagging, true)
+	for i := 0; i < 40; i++ {
+		c.propose(l, "k"+strconv.Itoa(i)+"="+strconv.Itoa(i))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Status().SnapshotIndex < 8 {
+		if time.Now().After(deadline) {
+			t.Fatalf("leader did not compact its log: %+v", l.Status())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 落后节点需要的条目已被压缩，只能通过 InstallSnapshot 追上
+	c.tr.setDown(lagging, false)
+	c.waitValue(lagging, "k39", "39")
+	c.waitValue(lagging, "k0", "0")
+	if st := c.nodes[lagging].Status(); st.SnapshotIndex == 0 || len(st.Members) != 3 {
+		t.Fatalf("lagging node status after catch-up: %+v", st)
+	}
+}
+
+func TestMembershipChange(t *testing.T) {
+	c := threeNodes(t, 0)
+	c.start("d", "", 0)
+	c.change(true, "d")
+	c.propose(c.leader(), "k=1")
+	c.waitValue("d", "k", "1")
+
+	l := c.leader()
+	index, term, err := l.AddNode("e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := l.AddNode("f"); !errors.Is(err, ErrConfigChange) {
+		t.Fatalf("concurrent membership change: %v", err)
+	}
+	if err := l.Wait(index, term, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	c.change(false, "e")
+
+	// 移除领导者自己后由剩余节点选出新的领导者
+	c.change(false, l.ID())
+	nl := c.leader(l.ID())
+	if st := nl.Status(); len(st.Members) != 3 {
+		t.Fatalf("members after removing the leader: %v", st.Members)
+	}
+	c.propose(nl, "k=2")
+	for _, addr := range nl.Status().Members {
+		c.waitValue(addr, "k", "2")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	c := threeNodes(t, 16, dirs...)
+	l := c.leader()
+	for i := 0; i < 30; i++ {
+		c.propose(l, "k="+strconv.Itoa(i))
+	}
+	for addr := range c.nodes {
+		c.waitValue(addr, "k", "29")
+	}
+	for _, n := range c.nodes {
+		n.Stop()
+	}
+
+	// 以相同的目录重启全部节点：快照与其后的日志恢复状态，集群重新选出领导者
+	c2 := newTestCluster(t)
+	for i, addr := range []string{"a", "b", "c"} {
+		c2.start(addr, dirs[i], 16)
+	}
+	l = c2.leader()
+	c2.propose(l, "k=30")
+	for addr := range c2.nodes {
+		c2.waitValue(addr, "k", "30")
+	}
+	if st := l.Status(); st.Term < 2 || len(st.Members) != 3 {
+		t.Fatalf("status after restart: %+v", st)
+	}
+}
+
+func TestSplitID(t *testing.T) {
+	client, peer, ok := SplitID("10.0.0.1:6379@16379")
+	if !ok || client != "10.0.0.1:6379" || peer != "10.0.0.1:16379" {
+		t.Fatalf("SplitID: %q %q %v", client, peer, ok)
+	}
+	if _, peer, ok := SplitID("[::1]:6379@16379"); !ok || peer != "[::1]:16379" {
+		t.Fatalf("SplitID IPv6: %q %v", peer, ok)
+	}
+	for _, id := range []string{"10.0.0.1:6379", "10.0.0.1@16379", "10.0.0.1:6379@x", "10.0.0.1:6379@70000", "a"} {
+		if _, _, ok := SplitID(id); ok {
+			t.Errorf("SplitID(%q) accepted", id)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package raft
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// RPC 名称；TCP 传输中以 RAFT <name> <payload> 命令发送到对方的节点间端口
+const (
+	rpcRequestVote     = "REQUESTVOTE"
+	rpcAppendEntries   = "APPENDENTRIES"
+	rpcInstallSnapshot = "INSTALLSNAPSHOT"
+)
+
+// Transport sends an encoded RPC to the node at addr and returns the
+// encoded reply, which the node produces with HandleRPC.
+type Transport interface {
+	Call(addr, name string, payload []byte) ([]byte, error)
+}
+
+type voteRequest struct {
+	Term      uint64
+	Candidate string
+	LastIndex uint64
+	LastTerm  uint64
+}
+
+type voteReply struct {
+	Term    uint64
+	Granted bool
+}
+
+type appendRequest struct {
+	Term      uint64
+	Leader    string
+	PrevIndex uint64
+	PrevTerm  uint64
+	Entries   []Entry
+	Commit    uint64
+}
+
+// appendReply 成功时 Index 为跟随者与领导者一致的最后一个索引；失败时为领导者
+// 下一次应尝试的 nextIndex
+type appendReply struct {
+	Term    uint64
+	Success bool
+	Index   uint64
+}
+
+type snapshotRequest struct {
+	Term     uint64
+	Leader   string
+	Index    uint64
+	SnapTerm uint64
+	Members  []string
+	Data     []byte
+}
+
+type snapshotReply struct {
+	Term uint64
+}
+
+func (m *voteRequest) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	e.string(m.Candidate)
+	e.uvarint(m.LastIndex)
+	e.uvarint(m.LastTerm)
+	return e.b
+}
+
+func (m *voteRequest) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term, m.Candidate, m.LastIndex, m.LastTerm = d.uvarint(), d.string(), d.uvarint(), d.uvarint()
+	return d.finish()
+}
+
+func (m *voteReply) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	e.bool(m.Granted)
+	return e.b
+}
+
+func (m *voteReply) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term, m.Granted = d.uvarint(), d.bool()
+	return d.finish()
+}
+
+func (m *appendRequest) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	e.string(m.Leader)
+	e.uvarint(m.PrevIndex)
+	e.uvarint(m.PrevTerm)
+	e.uvarint(uint64(len(m.Entries)))
+	for i := range m.Entries {
+		e.entry(&m.Entries[i])
+	}
+	e.uvarint(m.Commit)
+	return e.b
+}
+
+func (m *appendRequest) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term, m.Leader, m.PrevIndex, m.PrevTerm = d.uvarint(), d.string(), d.uvarint(), d.uvarint()
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		return errCorrupt
+	}
+	m.Entries = make([]Entry, 0, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		m.Entries = append(m.Entries, d.entry())
+	}
+	m.Commit = d.uvarint()
+	return d.finish()
+}
+
+func (m *appendReply) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	e.bool(m.Success)
+	e.uvarint(m.Index)
+	return e.b
+}
+
+func (m *appendReply) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term, m.Success, m.Index = d.uvarint(), d.bool(), d.uvarint()
+	return d.finish()
+}
+
+func (m *snapshotRequest) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	e.string(m.Leader)
+	e.uvarint(m.Index)
+	e.uvarint(m.SnapTerm)
+	e.strings(m.Members)
+	e.bytes(m.Data)
+	return e.b
+}
+
+func (m *snapshotRequest) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term, m.Leader, m.Index, m.SnapTerm = d.uvarint(), d.string(), d.uvarint(), d.uvarint()
+	m.Members, m.Data = d.strings(), d.bytes()
+	return d.finish()
+}
+
+func (m *snapshotReply) marshal() []byte {
+	e := &encoder{}
+	e.uvarint(m.Term)
+	return e.b
+}
+
+func (m *snapshotReply) unmarshal(b []byte) error {
+	d := &decoder{b: b}
+	m.Term = d.uvarint()
+	return d.finish()
+}
+
+// HandleRPC handles an RPC received from another node and returns the
+// encoded reply.
+func (n *Node) HandleRPC(name string, payload []byte) ([]byte, error) {
+	switch name {
+	case rpcRequestVote:
+		var req voteRequest
+		if err := req.unmarshal(payload); err != nil {
+			return nil, err
+		}
+		reply := n.handleRequestVote(&req)
+		return reply.marshal(), nil
+	case rpcAppendEntries:
+		var req appendRequest
+		if err := req.unmarshal(payload); err != nil {
+			return nil, err
+		}
+		reply := n.handleAppendEntries(&req)
+		return reply.marshal(), nil
+	case rpcInstallSnapshot:
+		var req snapshotRequest
+		if err := req.unmarshal(payload); err != nil {
+			return nil, err
+		}
+		reply := n.handleInstallSnapshot(&req)
+		return reply.marshal(), nil
+	}
+	return nil, fmt.Errorf("unknown raft RPC '%s'", name)
+}
+
+// SplitID splits a node ID of the form host:port@busport, the address format
+// of CLUSTER NODES, into the client address host:port and the peer address
+// host:busport that the other nodes send RPCs to.
+func SplitID(id string) (client, peer string, ok bool) {
+	client, bus, found := strings.Cut(id, "@")
+	if !found {
+		return "", "", false
+	}
+	host, _, err := net.SplitHostPort(client)
+	if err != nil {
+		return "", "", false
+	}
+	if p, err := strconv.Atoi(bus); err != nil || p <= 0 || p > 65535 {
+		return "", "", false
+	}
+	return client, net.JoinHostPort(host, bus), true
+}
+
+// TCPTransport sends RPCs as RAFT commands to the peer port of the other
+// nodes (see SplitID), keeping idle connections for reuse.
+type TCPTransport struct {
+	// Timeout 为连接与每次 RPC 的超时
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*protocol.Conn
+}
+
+// NewTCPTransport creates a transport with the given RPC timeout.
+func NewTCPTransport(timeout time.Duration) *TCPTransport {
+	return &TCPTransport{Timeout: timeout, idle: make(map[string][]*protocol.Conn)}
+}
+
+// Call implements Transport.
+func (t *TCPTransport) Call(id, name string, payload []byte) ([]byte, error) {
+	_, addr, ok := SplitID(id)
+	if !ok {
+		return nil, fmt.Errorf("invalid raft node ID '%s'", id)
+	}
+	c, err := t.get(addr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := c.Do("RAFT", name, string(payload))
+	if err != nil {
+		// 错误回复之后连接仍然可用；网络错误时连接的状态未知，关闭
+		if _, ok := err.(protocol.ReplyError); ok {
+			t.put(addr, c)
+		} else {
+			c.Close()
+		}
+		return nil, err
+	}
+	t.put(addr, c)
+	reply, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected raft reply %v", v)
+	}
+	return []byte(reply), nil
+}
+
+func (t *TCPTransport) get(addr string) (*protocol.Conn, error) {
+	t.mu.Lock()
+	if conns := t.idle[addr]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		t.idle[addr] = conns[:len(conns)-1]
+		t.mu.Unlock()
+		return c, nil
+	}
+	t.mu.Unlock()
+	return protocol.Dial(addr, t.Timeout)
+}
+
+func (t *TCPTransport) put(addr string, c *protocol.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.idle[addr] = append(t.idle[addr], c)
+}
+
+// Close closes the idle connections.
+func (t *TCPTransport) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, conns := range t.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(t.idle, addr)
+	}
+}
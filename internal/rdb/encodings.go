@@ -0,0 +1,252 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// 以下解码 Redis 在 RDB 中直接保存的紧凑编码，每个元素以字符串形式交给 fn。
+
+var (
+	errZiplist  = errors.New("corrupt ziplist")
+	errListpack = errors.New("corrupt listpack")
+	errIntset   = errors.New("corrupt intset")
+	errZipmap   = errors.New("corrupt zipmap")
+)
+
+// ziplistEntries 解码 ziplist：<zlbytes:4><zltail:4><zllen:2> 条目... 0xFF。
+// 每个条目为 <prevlen:1 或 5> <encoding> <data>。
+func ziplistEntries(s string, fn func(string)) error {
+	b := []byte(s)
+	if len(b) < 11 {
+		return errZiplist
+	}
+	for pos := 10; ; {
+		if pos >= len(b) {
+			return errZiplist
+		}
+		if b[pos] == 0xFF {
+			return nil
+		}
+		if b[pos] < 254 {
+			pos++
+		} else {
+			pos += 5
+		}
+		if pos >= len(b) {
+			return errZiplist
+		}
+		enc := b[pos]
+		var n, hdr int
+		switch enc >> 6 {
+		case 0:
+			n, hdr = int(enc&0x3f), 1
+		case 1:
+			if pos+2 > len(b) {
+				return errZiplist
+			}
+			n, hdr = int(enc&0x3f)<<8|int(b[pos+1]), 2
+		case 2:
+			if pos+5 > len(b) {
+				return errZiplist
+			}
+			n, hdr = int(binary.BigEndian.Uint32(b[pos+1:])), 5
+		}
+		if enc>>6 != 3 {
+			if n < 0 || pos+hdr+n > len(b) {
+				return errZiplist
+			}
+			fn(string(b[pos+hdr : pos+hdr+n]))
+			pos += hdr + n
+			continue
+		}
+		pos++
+		switch {
+		case enc == 0xC0:
+			n = 2
+		case enc == 0xD0:
+			n = 4
+		case enc == 0xE0:
+			n = 8
+		case enc == 0xF0:
+			n = 3
+		case enc == 0xFE:
+			n = 1
+		case enc >= 0xF1 && enc <= 0xFD:
+			fn(strconv.Itoa(int(enc&0x0f) - 1))
+			continue
+		default:
+			return errZiplist
+		}
+		if pos+n > len(b) {
+			return errZiplist
+		}
+		fn(strconv.FormatInt(leInt(b[pos:pos+n]), 10))
+		pos += n
+	}
+}
+
+// leInt 将 1/2/3/4/8 字节小端补码解码为有符号整数
+func leInt(p []byte) int64 {
+	var u uint64
+	for i := len(p) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(p[i])
+	}
+	shift := 64 - 8*uint(len(p))
+	return int64(u<<shift) >> shift
+}
+
+// listpackEntries 解码 listpack：<total:4><count:2> 元素... 0xFF。
+// 每个元素为 <encoding+data><backlen>，backlen 记录前两部分的长度。
+func listpackEntries(s string, fn func(string)) error {
+	b := []byte(s)
+	if len(b) < 7 {
+		return errListpack
+	}
+	for pos := 6; ; {
+		if pos >= len(b) {
+			return errListpack
+		}
+		enc := b[pos]
+		if enc == 0xFF {
+			return nil
+		}
+		start := pos
+		str, n, hdr := false, 0, 0
+		switch {
+		case enc&0x80 == 0: // 7 位无符号整数
+			fn(strconv.Itoa(int(enc & 0x7f)))
+			pos++
+		case enc&0xC0 == 0x80: // 6 位长度字符串
+			str, n, hdr = true, int(enc&0x3f), 1
+		case enc&0xE0 == 0xC0: // 13 位有符号整数
+			if pos+2 > len(b) {
+				return errListpack
+			}
+			v := int(enc&0x1f)<<8 | int(b[pos+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			fn(strconv.Itoa(v))
+			pos += 2
+		case enc&0xF0 == 0xE0: // 12 位长度字符串
+			if pos+2 > len(b) {
+				return errListpack
+			}
+			str, n, hdr = true, int(enc&0x0f)<<8|int(b[pos+1]), 2
+		case enc == 0xF0: // 32 位长度字符串
+			if pos+5 > len(b) {
+				return errListpack
+			}
+			str, n, hdr = true, int(binary.LittleEndian.Uint32(b[pos+1:])), 5
+		case enc >= 0xF1 && enc <= 0xF4: // 16/24/32/64 位有符号整数
+			size := [...]int{2, 3, 4, 8}[enc-0xF1]
+			if pos+1+size > len(b) {
+				return errListpack
+			}
+			fn(strconv.FormatInt(leInt(b[pos+1:pos+1+size]), 10))
+			pos += 1 + size
+		default:
+			return errListpack
+		}
+		if str {
+			if n < 0 || pos+hdr+n > len(b) {
+				return errListpack
+			}
+			fn(string(b[pos+hdr : pos+hdr+n]))
+			pos += hdr + n
+		}
+		pos += backlenSize(pos - start)
+	}
+}
+
+// backlenSize 返回长度为 n 的 listpack 元素的 backlen 字节数（与 lpEncodeBacklen 一致）
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// intsetEntries 解码 intset：<encoding:4><length:4> 后接按升序排列的 2/4/8 字节整数
+func intsetEntries(s string, fn func(string)) error {
+	b := []byte(s)
+	if len(b) < 8 {
+		return errIntset
+	}
+	width := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if (width != 2 && width != 4 && width != 8) || n < 0 || len(b) != 8+n*width {
+		return errIntset
+	}
+	for i := 0; i < n; i++ {
+		fn(strconv.FormatInt(leInt(b[8+i*width:8+(i+1)*width]), 10))
+	}
+	return nil
+}
+
+// zipmapEntries 解码 zipmap（Redis 2.6 之前的小 hash）：<zmlen:1> 后接
+// <len>key<len><free>value<free 字节空闲>...，以 0xFF 结尾
+func zipmapEntries(s string, fn func(string)) error {
+	b := []byte(s)
+	if len(b) < 2 {
+		return errZipmap
+	}
+	pos := 1
+	next := func(value bool) (string, bool) {
+		if pos >= len(b) {
+			return "", false
+		}
+		n := int(b[pos])
+		pos++
+		if n == 254 {
+			if pos+4 > len(b) {
+				return "", false
+			}
+			n = int(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+		} else if n == 255 {
+			return "", false
+		}
+		free := 0
+		if value {
+			if pos >= len(b) {
+				return "", false
+			}
+			free = int(b[pos])
+			pos++
+		}
+		if n < 0 || pos+n+free > len(b) {
+			return "", false
+		}
+		v := string(b[pos : pos+n])
+		pos += n + free
+		return v, true
+	}
+	for {
+		if pos >= len(b) {
+			return errZipmap
+		}
+		if b[pos] == 0xFF {
+			return nil
+		}
+		key, ok := next(false)
+		if !ok {
+			return errZipmap
+		}
+		val, ok := next(true)
+		if !ok {
+			return errZipmap
+		}
+		fn(key)
+		fn(val)
+	}
+}
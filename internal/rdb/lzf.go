@@ -0,0 +1,108 @@
+package rdb
+
+import "errors"
+
+// LZF 格式（liblzf）：控制字节 c < 32 表示其后 c+1 个字面字节；否则为回溯引用，
+// 长度 len = c>>5（为 7 时再读一字节累加），偏移 off = (c&0x1f)<<8 | 下一字节，
+// 从当前位置之前 off+1 处复制 len+2 个字节。
+
+var errLZF = errors.New("corrupt LZF data")
+
+const (
+	lzfMaxLit = 1 << 5
+	lzfMaxOff = 1 << 13
+	lzfMaxRef = (1 << 8) + (1 << 3) // 264
+	lzfHLog   = 14
+)
+
+// lzfDecompress 解压 in，解压后的长度必须恰好为 n
+func lzfDecompress(in []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for i := 0; i < len(in); {
+		c := int(in[i])
+		i++
+		if c < lzfMaxLit {
+			c++
+			if i+c > len(in) || len(out)+c > n {
+				return nil, errLZF
+			}
+			out = append(out, in[i:i+c]...)
+			i += c
+			continue
+		}
+		l := c >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, errLZF
+			}
+			l += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLZF
+		}
+		ref := len(out) - (c&0x1f)<<8 - int(in[i]) - 1
+		i++
+		l += 2
+		if ref < 0 || len(out)+l > n {
+			return nil, errLZF
+		}
+		// 引用可能与输出重叠，逐字节复制
+		for j := 0; j < l; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != n {
+		return nil, errLZF
+	}
+	return out, nil
+}
+
+// lzfCompress 压缩 in；结果不比原数据短时返回 nil
+func lzfCompress(in []byte) []byte {
+	if len(in) < 4 {
+		return nil
+	}
+	var htab [1 << lzfHLog]int // 位置 + 1，0 表示空
+	out := make([]byte, 0, len(in))
+	lit := 0
+	flush := func(end int) {
+		for lit < end {
+			n := min(end-lit, lzfMaxLit)
+			out = append(out, byte(n-1))
+			out = append(out, in[lit:lit+n]...)
+			lit += n
+		}
+	}
+	for ip := 0; ip+2 < len(in); {
+		h := (uint32(in[ip])<<16 | uint32(in[ip+1])<<8 | uint32(in[ip+2])) * 2654435761 >> (32 - lzfHLog)
+		ref := htab[h] - 1
+		htab[h] = ip + 1
+		off := ip - ref - 1
+		if ref < 0 || off >= lzfMaxOff || in[ref] != in[ip] || in[ref+1] != in[ip+1] || in[ref+2] != in[ip+2] {
+			ip++
+			continue
+		}
+		maxl := min(len(in)-ip, lzfMaxRef)
+		l := 3
+		for l < maxl && in[ref+l] == in[ip+l] {
+			l++
+		}
+		flush(ip)
+		if l -= 2; l < 7 {
+			out = append(out, byte(off>>8|l<<5), byte(off))
+		} else {
+			out = append(out, byte(off>>8|7<<5), byte(l-7), byte(off))
+		}
+		ip += l + 2
+		lit = ip
+		if len(out) >= len(in) {
+			return nil
+		}
+	}
+	flush(len(in))
+	if len(out) >= len(in) {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,401 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"redisx/internal/storage"
+)
+
+// 以下辅助函数按 Redis 源码中的格式手工构造 RDB 片段，
+// 用于覆盖 redisX 自身不会写出的紧凑编码。
+
+func encLen(n int) []byte {
+	switch {
+	case n < 1<<6:
+		return []byte{byte(n)}
+	case n < 1<<14:
+		return []byte{byte(n>>8) | 0x40, byte(n)}
+	}
+	return binary.BigEndian.AppendUint32([]byte{0x80}, uint32(n))
+}
+
+func encStr(s string) []byte { return append(encLen(len(s)), s...) }
+
+// listpack 构造 listpack，int64 元素使用整数编码
+func listpack(elems ...any) string {
+	var body []byte
+	for _, e := range elems {
+		var ent []byte
+		switch v := e.(type) {
+		case int64:
+			switch {
+			case v >= 0 && v <= 127:
+				ent = []byte{byte(v)}
+			case v >= -4096 && v <= 4095:
+				u := uint16(v) & 0x1fff
+				ent = []byte{0xC0 | byte(u>>8), byte(u)}
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				ent = binary.LittleEndian.AppendUint16([]byte{0xF1}, uint16(v))
+			case v >= -1<<23 && v < 1<<23:
+				ent = []byte{0xF2, byte(v), byte(v >> 8), byte(v >> 16)}
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				ent = binary.LittleEndian.AppendUint32([]byte{0xF3}, uint32(v))
+			default:
+				ent = binary.LittleEndian.AppendUint64([]byte{0xF4}, uint64(v))
+			}
+		case string:
+			switch {
+			case len(v) < 64:
+				ent = append([]byte{0x80 | byte(len(v))}, v...)
+			case len(v) < 4096:
+				ent = append([]byte{0xE0 | byte(len(v)>>8), byte(len(v))}, v...)
+			default:
+				ent = append(binary.LittleEndian.AppendUint32([]byte{0xF0}, uint32(len(v))), v...)
+			}
+		}
+		body = append(body, ent...)
+		if l := len(ent); l <= 127 {
+			body = append(body, byte(l))
+		} else {
+			body = append(body, byte(l>>7), byte(l&127)|128)
+		}
+	}
+	out := binary.LittleEndian.AppendUint32(nil, uint32(6+len(body)+1))
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(elems)))
+	return string(append(append(out, body...), 0xFF))
+}
+
+// ziplist 构造 ziplist，int64 元素使用整数编码
+func ziplist(elems ...any) string {
+	var body []byte
+	prev, tail := 0, 0
+	for _, e := range elems {
+		var ent []byte
+		if prev < 254 {
+			ent = []byte{byte(prev)}
+		} else {
+			ent = binary.LittleEndian.AppendUint32([]byte{254}, uint32(prev))
+		}
+		switch v := e.(type) {
+		case int64:
+			switch {
+			case v >= 0 && v <= 12:
+				ent = append(ent, 0xF1+byte(v))
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				ent = append(ent, 0xFE, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				ent = binary.LittleEndian.AppendUint16(append(ent, 0xC0), uint16(v))
+			case v >= -1<<23 && v < 1<<23:
+				ent = append(ent, 0xF0, byte(v), byte(v>>8), byte(v>>16))
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				ent = binary.LittleEndian.AppendUint32(append(ent, 0xD0), uint32(v))
+			default:
+				ent = binary.LittleEndian.AppendUint64(append(ent, 0xE0), uint64(v))
+			}
+		case string:
+			switch {
+			case len(v) < 64:
+				ent = append(ent, byte(len(v)))
+			case len(v) < 16384:
+				ent = append(ent, 0x40|byte(len(v)>>8), byte(len(v)))
+			default:
+				ent = binary.BigEndian.AppendUint32(append(ent, 0x80), uint32(len(v)))
+			}
+			ent = append(ent, v...)
+		}
+		tail = 10 + len(body)
+		body = append(body, ent...)
+		prev = len(ent)
+	}
+	out := binary.LittleEndian.AppendUint32(nil, uint32(10+len(body)+1))
+	out = binary.LittleEndian.AppendUint32(out, uint32(tail))
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(elems)))
+	return string(append(append(out, body...), 0xFF))
+}
+
+func intset(width int, vals ...int64) string {
+	out := binary.LittleEndian.AppendUint32(nil, uint32(width))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(vals)))
+	for _, v := range vals {
+		for i := 0; i < width; i++ {
+			out = append(out, byte(v>>(8*i)))
+		}
+	}
+	return string(out)
+}
+
+func zipmap(pairs ...string) string {
+	out := []byte{byte(len(pairs) / 2)}
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, byte(len(pairs[i])))
+		out = append(out, pairs[i]...)
+		out = append(out, byte(len(pairs[i+1])), 2) // 2 字节空闲
+		out = append(out, pairs[i+1]...)
+		out = append(out, 0, 0)
+	}
+	return string(append(out, 0xFF))
+}
+
+// buildRDB 拼接版本头、body、EOF 与校验和
+func buildRDB(version int, body []byte) []byte {
+	out := append([]byte("REDIS"), []byte{'0' + byte(version/1000), '0' + byte(version/100%10), '0' + byte(version/10%10), '0' + byte(version%10)}...)
+	out = append(append(out, body...), opEOF)
+	return binary.LittleEndian.AppendUint64(out, crc64(0, out))
+}
+
+func TestCRC64(t *testing.T) {
+	if got := crc64(0, []byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Fatalf("unexpected crc %x", got)
+	}
+}
+
+func TestLZF(t *testing.T) {
+	out, err := lzfDecompress([]byte("\x00a\xe0\x00\x00"), 10)
+	if err != nil || string(out) != "aaaaaaaaaa" {
+		t.Fatalf("unexpected result %q %v", out, err)
+	}
+	for _, in := range []string{
+		strings.Repeat("abc", 100),
+		strings.Repeat("hello world ", 500) + "tail",
+		strings.Repeat("x", 10000),
+	} {
+		c := lzfCompress([]byte(in))
+		if c == nil || len(c) >= len(in) {
+			t.Fatalf("expected %d bytes to compress", len(in))
+		}
+		out, err := lzfDecompress(c, len(in))
+		if err != nil || string(out) != in {
+			t.Fatalf("round trip failed: %v", err)
+		}
+	}
+	if lzfCompress([]byte("abcdefghijklmnopqrstuvwxyz")) != nil {
+		t.Fatal("incompressible input should not be compressed")
+	}
+	if _, err := lzfDecompress([]byte("\x00a\xe0\x00\x05"), 10); err == nil {
+		t.Fatal("expected error for a reference before the start")
+	}
+}
+
+func TestLoadEncodings(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	long := strings.Repeat("compressible ", 20)
+
+	var b []byte
+	op := func(p ...byte) { b = append(b, p...) }
+	kv := func(typ byte, key string, val []byte) {
+		op(typ)
+		op(encStr(key)...)
+		op(val...)
+	}
+	op(opAux)
+	op(encStr("redis-ver")...)
+	op(encStr("7.2.4")...)
+	op(opFunction2)
+	op(encStr("#!lua name=lib\nredis.register_function('f', function() end)")...)
+	op(opSelectDB, 0, opResizeDB, 20, 2)
+
+	kv(typeString, "plain", encStr("hello"))
+	kv(typeString, "int8", []byte{0xC0, 0xF6})
+	kv(typeString, "int16", []byte{0xC1, 0x39, 0x30})
+	kv(typeString, "int32", []byte{0xC2, 0x15, 0xCD, 0x5B, 0x07})
+	c := lzfCompress([]byte(long))
+	kv(typeString, "lzf", append(append(append([]byte{0xC3}, encLen(len(c))...), encLen(len(long))...), c...))
+	op(opExpireTimeMs)
+	op(binary.LittleEndian.AppendUint64(nil, uint64(future.UnixMilli()))...)
+	op(opIdle, 5)
+	kv(typeString, "ttl", encStr("v"))
+	op(opExpireTime)
+	op(binary.LittleEndian.AppendUint32(nil, uint32(time.Now().Add(-time.Hour).Unix()))...)
+	kv(typeString, "expired", encStr("v"))
+	op(opFreq, 3)
+	kv(typeList, "list", append(append(encLen(2), encStr("a")...), encStr("b")...))
+
+	ql := append(encLen(2), encLen(quicklistPacked)...)
+	ql = append(ql, encStr(listpack("a", int64(1), int64(-100), int64(300), int64(100000), int64(1<<40), strings.Repeat("s", 100)))...)
+	ql = append(append(ql, encLen(quicklistPlain)...), encStr("plain node")...)
+	kv(typeListQuicklist2, "quicklist2", ql)
+	kv(typeListQuicklist, "quicklist", append(encLen(1), encStr(ziplist("x", int64(7), int64(-5), int64(1000), int64(-70000), int64(1<<33), strings.Repeat("y", 300), "after"))...))
+	kv(typeListZiplist, "ziplist", encStr(ziplist("p", "q")))
+
+	kv(typeSetIntset, "intset", encStr(intset(2, -3, 5, 700)))
+	kv(typeSetListpack, "setlp", encStr(listpack("m1", "m2", int64(3))))
+	kv(typeSet, "set", append(append(encLen(2), encStr("x")...), encStr("y")...))
+
+	kv(typeHashListpack, "hashlp", encStr(listpack("f1", "v1", "f2", int64(2))))
+	kv(typeHashZiplist, "hashzl", encStr(ziplist("f", "v")))
+	kv(typeHashZipmap, "zipmap", encStr(zipmap("a", "1", "bb", "22")))
+	kv(typeHash, "hash", append(append(encLen(1), encStr("k")...), encStr("v")...))
+
+	kv(typeZSetListpack, "zsetlp", encStr(listpack("a", int64(1), "b", "2.5")))
+	kv(typeZSetZiplist, "zsetzl", encStr(ziplist("c", "-1")))
+	zs := append(append(encLen(2), encStr("lo")...), 3, '1', '.', '5')
+	zs = append(append(zs, encStr("hi")...), 254)
+	kv(typeZSet, "zset1", zs)
+	kv(typeZSet2, "zset2", append(append(encLen(1), encStr("m")...), binary.LittleEndian.AppendUint64(nil, math.Float64bits(0.25))...))
+
+	// 其他数据库中的键被跳过
+	op(opSelectDB, 1)
+	kv(typeString, "db1", encStr("v"))
+
+	store := storage.NewStorage()
+	st, err := Load(bytes.NewReader(buildRDB(11, b)), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Keys != 21 || st.Expired != 1 || st.Skipped != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	for key, want := range map[string]string{"plain": "hello", "int8": "-10", "int16": "12345", "int32": "123456789", "lzf": long, "ttl": "v"} {
+		if v, _ := store.Get(key); string(v) != want {
+			t.Fatalf("%s: expected %q, got %q", key, want, v)
+		}
+	}
+	if got := store.PExpireTime("ttl"); got != future.UnixMilli() {
+		t.Fatalf("expected expiry %d, got %d", future.UnixMilli(), got)
+	}
+	if store.Exists("expired") || store.Exists("db1") {
+		t.Fatal("expired keys and other databases must not be loaded")
+	}
+
+	lists := map[string][]string{
+		"list":       {"a", "b"},
+		"quicklist2": {"a", "1", "-100", "300", "100000", "1099511627776", strings.Repeat("s", 100), "plain node"},
+		"quicklist":  {"x", "7", "-5", "1000", "-70000", "8589934592", strings.Repeat("y", 300), "after"},
+		"ziplist":    {"p", "q"},
+	}
+	for key, want := range lists {
+		if got, _ := store.LRange(key, 0, -1); !slices.Equal(got, want) {
+			t.Fatalf("%s: expected %v, got %v", key, want, got)
+		}
+	}
+	sets := map[string][]string{"intset": {"-3", "5", "700"}, "setlp": {"3", "m1", "m2"}, "set": {"x", "y"}}
+	for key, want := range sets {
+		got, _ := store.SMembers(key)
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: expected %v, got %v", key, want, got)
+		}
+	}
+	hashes := map[string]map[string]string{
+		"hashlp": {"f1": "v1", "f2": "2"},
+		"hashzl": {"f": "v"},
+		"zipmap": {"a": "1", "bb": "22"},
+		"hash":   {"k": "v"},
+	}
+	for key, want := range hashes {
+		for f, v := range want {
+			if got, _, _ := store.HGet(key, f); got != v {
+				t.Fatalf("%s.%s: expected %q, got %q", key, f, v, got)
+			}
+		}
+		if n, _ := store.HLen(key); n != len(want) {
+			t.Fatalf("%s: expected %d fields, got %d", key, len(want), n)
+		}
+	}
+	scores := map[string]map[string]float64{
+		"zsetlp": {"a": 1, "b": 2.5},
+		"zsetzl": {"c": -1},
+		"zset1":  {"lo": 1.5, "hi": math.Inf(1)},
+		"zset2":  {"m": 0.25},
+	}
+	for key, want := range scores {
+		for m, score := range want {
+			if got, ok, _ := store.ZScore(key, m); !ok || got != score {
+				t.Fatalf("%s.%s: expected %v, got %v", key, m, score, got)
+			}
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	good := buildRDB(9, append([]byte{typeString}, append(encStr("k"), encStr("v")...)...))
+	if _, err := Load(bytes.NewReader(good), storage.NewStorage()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 校验和为 0 表示未计算，不做检查
+	noSum := append(append([]byte(nil), good[:len(good)-8]...), make([]byte, 8)...)
+	if _, err := Load(bytes.NewReader(noSum), storage.NewStorage()); err != nil {
+		t.Fatalf("zero checksum should be accepted: %v", err)
+	}
+
+	bad := append([]byte(nil), good...)
+	bad[len(bad)-12] ^= 1
+	for name, data := range map[string][]byte{
+		"checksum":  bad,
+		"truncated": good[:len(good)-10],
+		"signature": append([]byte("RDX"), good[3:]...),
+		"version":   buildRDB(99, nil),
+		"stream":    buildRDB(11, append([]byte{typeStream3}, encStr("s")...)),
+	} {
+		if _, err := Load(bytes.NewReader(data), storage.NewStorage()); !errors.Is(err, ErrBadRDB) {
+			t.Fatalf("%s: expected ErrBadRDB, got %v", name, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := storage.NewStorage()
+	src.Set("str", []byte("hello"), 0)
+	src.Set("int", []byte("-123456"), 0)
+	src.Set("notint", []byte("007"), 0)
+	src.Set("long", []byte(strings.Repeat("abcdef", 50)), 0)
+	src.SetWithMs("ttl", []byte("v"), 60000)
+	src.RPush("l", []string{"a", "1", "b"})
+	src.SAdd("s", []string{"3", "1", "2"})
+	src.SAdd("w", []string{"x", "y"})
+	src.HSet("h", []string{"f", "v", "n", "42"})
+	src.ZAdd("z", storage.ZAddFlags{}, []storage.ZMember{{Member: "a", Score: -1.5}, {Member: "b", Score: math.Inf(1)}})
+	src.XAdd("st", false, storage.XAddID{Auto: true}, []string{"f", "v"}, nil)
+
+	sn := src.Snapshot()
+	var buf bytes.Buffer
+	st, err := Write(&buf, sn)
+	sn.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Keys != 10 || st.Skipped != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("REDIS0009")) {
+		t.Fatalf("unexpected header %q", buf.Bytes()[:9])
+	}
+
+	dst := storage.NewStorage()
+	if st, err := Load(bytes.NewReader(buf.Bytes()), dst); err != nil || st.Keys != 10 {
+		t.Fatalf("load: %+v %v", st, err)
+	}
+	for _, key := range []string{"str", "int", "notint", "long", "ttl"} {
+		want, _ := src.Get(key)
+		if got, _ := dst.Get(key); string(got) != string(want) {
+			t.Fatalf("%s: expected %q, got %q", key, want, got)
+		}
+	}
+	if dst.PExpireTime("ttl") != src.PExpireTime("ttl") {
+		t.Fatal("expiry was not preserved")
+	}
+	if got, _ := dst.LRange("l", 0, -1); !slices.Equal(got, []string{"a", "1", "b"}) {
+		t.Fatalf("unexpected list %v", got)
+	}
+	if n, _ := dst.SCard("s"); n != 3 {
+		t.Fatalf("unexpected set size %d", n)
+	}
+	if v, _, _ := dst.HGet("h", "n"); v != "42" {
+		t.Fatalf("unexpected hash field %q", v)
+	}
+	if score, _, _ := dst.ZScore("z", "b"); !math.IsInf(score, 1) {
+		t.Fatalf("unexpected score %v", score)
+	}
+	if dst.Exists("st") {
+		t.Fatal("streams are not exported")
+	}
+}
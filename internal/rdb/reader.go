@@ -0,0 +1,419 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"redisx/internal/storage"
+)
+
+type reader struct {
+	r   *bufio.Reader
+	crc uint64
+	err error
+}
+
+func (rd *reader) fail(format string, args ...any) {
+	if rd.err == nil {
+		rd.err = fmt.Errorf("%w: %s", ErrBadRDB, fmt.Sprintf(format, args...))
+	}
+}
+
+func (rd *reader) read(p []byte) {
+	if rd.err != nil {
+		return
+	}
+	if _, err := io.ReadFull(rd.r, p); err != nil {
+		rd.fail("unexpected end of file")
+		return
+	}
+	rd.crc = crc64(rd.crc, p)
+}
+
+func (rd *reader) byte() byte {
+	var b [1]byte
+	rd.read(b[:])
+	return b[0]
+}
+
+// length 读取长度编码；encoded 为 true 时 n 为特殊字符串编码的类型
+func (rd *reader) length() (n uint64, encoded bool) {
+	b := rd.byte()
+	var buf [8]byte
+	switch b >> 6 {
+	case len6Bit:
+		return uint64(b & 0x3f), false
+	case len14Bit:
+		return uint64(b&0x3f)<<8 | uint64(rd.byte()), false
+	case lenEnc:
+		return uint64(b & 0x3f), true
+	}
+	switch b {
+	case len32Bit:
+		rd.read(buf[:4])
+		return uint64(binary.BigEndian.Uint32(buf[:4])), false
+	case len64Bit:
+		rd.read(buf[:])
+		return binary.BigEndian.Uint64(buf[:]), false
+	}
+	rd.fail("unknown length encoding 0x%02x", b)
+	return 0, false
+}
+
+// count 读取不带特殊编码的长度并做上限检查
+func (rd *reader) count() int {
+	n, encoded := rd.length()
+	if encoded || n > maxLen {
+		rd.fail("invalid length")
+		return 0
+	}
+	return int(n)
+}
+
+func (rd *reader) bytes(n int) []byte {
+	if rd.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	rd.read(b)
+	return b
+}
+
+// string 读取字符串，处理整数编码与 LZF 压缩
+func (rd *reader) string() string {
+	n, encoded := rd.length()
+	if rd.err != nil {
+		return ""
+	}
+	if !encoded {
+		if n > maxLen {
+			rd.fail("string length %d too large", n)
+			return ""
+		}
+		return string(rd.bytes(int(n)))
+	}
+	var buf [4]byte
+	switch n {
+	case encInt8:
+		return strconv.Itoa(int(int8(rd.byte())))
+	case encInt16:
+		rd.read(buf[:2])
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(buf[:2]))))
+	case encInt32:
+		rd.read(buf[:])
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(buf[:]))))
+	case encLZF:
+		clen, ulen := rd.count(), rd.count()
+		in := rd.bytes(clen)
+		if rd.err != nil {
+			return ""
+		}
+		out, err := lzfDecompress(in, ulen)
+		if err != nil {
+			rd.fail("%v", err)
+			return ""
+		}
+		return string(out)
+	}
+	rd.fail("unknown string encoding %d", n)
+	return ""
+}
+
+// float 读取类型 3 中以字符串表示的分值
+func (rd *reader) float() float64 {
+	n := rd.byte()
+	switch n {
+	case 253:
+		return math.NaN()
+	case 254:
+		return math.Inf(1)
+	case 255:
+		return math.Inf(-1)
+	}
+	b := rd.bytes(int(n))
+	if rd.err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		rd.fail("invalid score %q", b)
+	}
+	return f
+}
+
+// double 读取类型 5 中的 8 字节小端 IEEE 754 分值
+func (rd *reader) double() float64 {
+	var buf [8]byte
+	rd.read(buf[:])
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+}
+
+// value 为解码后的值，按 Entry 的类型保存
+type value struct {
+	typ   storage.ValueType
+	str   string
+	elems []string // list 元素、set 成员或 hash 的 field/value 对
+	zset  []storage.ZMember
+}
+
+// Load reads a Redis RDB file from r into store and reports what was loaded.
+// Only database 0 is imported; keys from other databases are counted as
+// skipped, as are keys that have already expired. Streams and module values
+// cannot be imported and make Load fail. The store should be empty: keys are
+// added one by one, so a malformed file may leave part of it loaded.
+func Load(r io.Reader, store *storage.Storage) (Stats, error) {
+	var st Stats
+	rd := &reader{r: bufio.NewReader(r)}
+	header := rd.bytes(len(magic) + 4)
+	if rd.err != nil || string(header[:len(magic)]) != magic {
+		return st, fmt.Errorf("%w: wrong signature", ErrBadRDB)
+	}
+	version, err := strconv.Atoi(string(header[len(magic):]))
+	if err != nil || version < 1 || version > maxVersion {
+		return st, fmt.Errorf("%w: unsupported version %q", ErrBadRDB, header[len(magic):])
+	}
+
+	now := time.Now().UnixMilli()
+	db := 0
+	var expireAt int64
+	var buf [8]byte
+	for rd.err == nil {
+		op := rd.byte()
+		switch op {
+		case opEOF:
+		case opSelectDB:
+			db = rd.count()
+			continue
+		case opResizeDB:
+			rd.length()
+			rd.length()
+			continue
+		case opSlotInfo:
+			rd.length()
+			rd.length()
+			rd.length()
+			continue
+		case opAux:
+			rd.string()
+			rd.string()
+			continue
+		case opFunction2:
+			rd.string()
+			continue
+		case opFunctionPre, opModuleAux:
+			rd.fail("functions and module data are not supported")
+			continue
+		case opFreq:
+			rd.byte()
+			continue
+		case opIdle:
+			rd.length()
+			continue
+		case opExpireTime:
+			rd.read(buf[:4])
+			expireAt = int64(binary.LittleEndian.Uint32(buf[:4])) * 1000
+			continue
+		case opExpireTimeMs:
+			rd.read(buf[:])
+			expireAt = int64(binary.LittleEndian.Uint64(buf[:]))
+			continue
+		default:
+			key := rd.string()
+			v := rd.readValue(op)
+			if rd.err != nil {
+				break
+			}
+			switch {
+			case db != 0:
+				st.Skipped++
+			case expireAt != 0 && expireAt <= now:
+				st.Expired++
+			default:
+				if err := insert(store, key, v, expireAt); err != nil {
+					return st, fmt.Errorf("load key %q: %w", key, err)
+				}
+				st.Keys++
+			}
+			expireAt = 0
+			continue
+		}
+		break
+	}
+	if rd.err != nil {
+		return st, rd.err
+	}
+	// 版本 5 起文件以 8 字节小端 CRC64 结尾，全 0 表示写出时未计算校验和
+	if version >= 5 {
+		want := rd.crc
+		if _, err := io.ReadFull(rd.r, buf[:]); err != nil {
+			return st, fmt.Errorf("%w: missing checksum", ErrBadRDB)
+		}
+		if sum := binary.LittleEndian.Uint64(buf[:]); sum != 0 && sum != want {
+			return st, fmt.Errorf("%w: checksum mismatch", ErrBadRDB)
+		}
+	}
+	return st, nil
+}
+
+// insert 通过 Storage 的公开接口写入一个键
+func insert(store *storage.Storage, key string, v value, expireAt int64) error {
+	if v.typ != storage.TypeString && len(v.elems) == 0 && len(v.zset) == 0 {
+		return nil // Redis 不会写出空容器
+	}
+	store.Delete(key)
+	var err error
+	switch v.typ {
+	case storage.TypeString:
+		store.Set(key, []byte(v.str), 0)
+	case storage.TypeList:
+		_, err = store.RPush(key, v.elems)
+	case storage.TypeSet:
+		_, err = store.SAdd(key, v.elems)
+	case storage.TypeHash:
+		_, err = store.HSet(key, v.elems)
+	case storage.TypeZSet:
+		_, _, err = store.ZAdd(key, storage.ZAddFlags{}, v.zset)
+	}
+	if err != nil {
+		return err
+	}
+	if expireAt != 0 {
+		store.PExpireAt(key, expireAt)
+	}
+	return nil
+}
+
+// readValue 解码一个值，涵盖各版本 Redis 写出的 string/list/set/hash/zset 编码
+func (rd *reader) readValue(t byte) value {
+	switch t {
+	case typeString:
+		return value{typ: storage.TypeString, str: rd.string()}
+	case typeList, typeSet:
+		n := rd.count()
+		elems := make([]string, 0, min(n, 1024))
+		for i := 0; i < n && rd.err == nil; i++ {
+			elems = append(elems, rd.string())
+		}
+		typ := storage.TypeList
+		if t == typeSet {
+			typ = storage.TypeSet
+		}
+		return value{typ: typ, elems: elems}
+	case typeHash:
+		n := rd.count()
+		elems := make([]string, 0, min(2*n, 1024))
+		for i := 0; i < n && rd.err == nil; i++ {
+			elems = append(elems, rd.string(), rd.string())
+		}
+		return value{typ: storage.TypeHash, elems: elems}
+	case typeZSet, typeZSet2:
+		n := rd.count()
+		zs := make([]storage.ZMember, 0, min(n, 1024))
+		for i := 0; i < n && rd.err == nil; i++ {
+			m := storage.ZMember{Member: rd.string()}
+			if t == typeZSet {
+				m.Score = rd.float()
+			} else {
+				m.Score = rd.double()
+			}
+			if math.IsNaN(m.Score) {
+				rd.fail("NaN score")
+			}
+			zs = append(zs, m)
+		}
+		return value{typ: storage.TypeZSet, zset: zs}
+	case typeListQuicklist, typeListQuicklist2:
+		n := rd.count()
+		var elems []string
+		for i := 0; i < n && rd.err == nil; i++ {
+			container := uint64(quicklistPacked)
+			if t == typeListQuicklist2 {
+				container, _ = rd.length()
+			}
+			blob := rd.string()
+			if rd.err != nil {
+				break
+			}
+			if container == quicklistPlain {
+				elems = append(elems, blob)
+				continue
+			}
+			decode := listpackEntries
+			if t == typeListQuicklist {
+				decode = ziplistEntries
+			}
+			rd.check(decode(blob, func(s string) { elems = append(elems, s) }))
+		}
+		return value{typ: storage.TypeList, elems: elems}
+	}
+
+	switch t {
+	case typeHashZipmap, typeListZiplist, typeSetIntset, typeSetListpack,
+		typeHashZiplist, typeHashListpack, typeZSetZiplist, typeZSetListpack:
+	default:
+		rd.fail("unsupported value type: %s", typeName(t))
+		return value{}
+	}
+	blob := rd.string()
+	if rd.err != nil {
+		return value{}
+	}
+	var elems []string
+	add := func(s string) { elems = append(elems, s) }
+	switch t {
+	case typeHashZipmap:
+		rd.check(zipmapEntries(blob, add))
+		return value{typ: storage.TypeHash, elems: elems}
+	case typeListZiplist:
+		rd.check(ziplistEntries(blob, add))
+		return value{typ: storage.TypeList, elems: elems}
+	case typeSetIntset:
+		rd.check(intsetEntries(blob, add))
+		return value{typ: storage.TypeSet, elems: elems}
+	case typeSetListpack:
+		rd.check(listpackEntries(blob, add))
+		return value{typ: storage.TypeSet, elems: elems}
+	case typeHashZiplist, typeHashListpack:
+		decode := listpackEntries
+		if t == typeHashZiplist {
+			decode = ziplistEntries
+		}
+		rd.check(decode(blob, add))
+		if len(elems)%2 != 0 {
+			rd.fail("odd number of hash elements")
+		}
+		return value{typ: storage.TypeHash, elems: elems}
+	case typeZSetZiplist, typeZSetListpack:
+		decode := listpackEntries
+		if t == typeZSetZiplist {
+			decode = ziplistEntries
+		}
+		rd.check(decode(blob, add))
+		if len(elems)%2 != 0 {
+			rd.fail("odd number of zset elements")
+			return value{}
+		}
+		zs := make([]storage.ZMember, 0, len(elems)/2)
+		for i := 0; i < len(elems); i += 2 {
+			score, err := strconv.ParseFloat(elems[i+1], 64)
+			if err != nil || math.IsNaN(score) {
+				rd.fail("invalid score %q", elems[i+1])
+				break
+			}
+			zs = append(zs, storage.ZMember{Member: elems[i], Score: score})
+		}
+		return value{typ: storage.TypeZSet, zset: zs}
+	}
+	return value{}
+}
+
+func (rd *reader) check(err error) {
+	if err != nil {
+		rd.fail("%v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"redisx/internal/storage"
+)
+
+// lzfMinLen 为尝试 LZF 压缩的最短字符串长度（与 Redis 相同）
+const lzfMinLen = 20
+
+type writer struct {
+	w   *bufio.Writer
+	crc uint64
+	buf [9]byte
+	err error
+}
+
+func (wr *writer) write(p []byte) {
+	if wr.err != nil {
+		return
+	}
+	wr.crc = crc64(wr.crc, p)
+	_, wr.err = wr.w.Write(p)
+}
+
+func (wr *writer) byte(b byte) { wr.write([]byte{b}) }
+
+func (wr *writer) length(n uint64) {
+	switch {
+	case n < 1<<6:
+		wr.byte(byte(n))
+	case n < 1<<14:
+		wr.write([]byte{byte(n>>8) | len14Bit<<6, byte(n)})
+	case n <= math.MaxUint32:
+		wr.buf[0] = len32Bit
+		binary.BigEndian.PutUint32(wr.buf[1:], uint32(n))
+		wr.write(wr.buf[:5])
+	default:
+		wr.buf[0] = len64Bit
+		binary.BigEndian.PutUint64(wr.buf[1:], n)
+		wr.write(wr.buf[:9])
+	}
+}
+
+// string 写出字符串：能无损表示为 32 位整数时使用整数编码，较长且可压缩时使用 LZF
+func (wr *writer) string(s string) {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(s, 10, 32); err == nil && strconv.FormatInt(v, 10) == s {
+			wr.int(v)
+			return
+		}
+	}
+	if len(s) > lzfMinLen {
+		if c := lzfCompress([]byte(s)); c != nil {
+			wr.byte(lenEnc<<6 | encLZF)
+			wr.length(uint64(len(c)))
+			wr.length(uint64(len(s)))
+			wr.write(c)
+			return
+		}
+	}
+	wr.length(uint64(len(s)))
+	wr.write([]byte(s))
+}
+
+func (wr *writer) int(v int64) {
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		wr.write([]byte{lenEnc<<6 | encInt8, byte(v)})
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		wr.buf[0] = lenEnc<<6 | encInt16
+		binary.LittleEndian.PutUint16(wr.buf[1:], uint16(v))
+		wr.write(wr.buf[:3])
+	default:
+		wr.buf[0] = lenEnc<<6 | encInt32
+		binary.LittleEndian.PutUint32(wr.buf[1:], uint32(v))
+		wr.write(wr.buf[:5])
+	}
+}
+
+// Write encodes the snapshot as a Redis RDB file (version 9, loadable by
+// Redis 5.0 and later) into database 0. Streams have no counterpart in the
+// encodings used here and are counted as skipped.
+func Write(w io.Writer, sn *storage.Snapshot) (Stats, error) {
+	var st Stats
+	expires := 0
+	sn.Range(func(key string, e *storage.Entry) bool {
+		if e.Type == storage.TypeStream {
+			st.Skipped++
+			return true
+		}
+		st.Keys++
+		if e.ExpireAt != 0 {
+			expires++
+		}
+		return true
+	})
+
+	wr := &writer{w: bufio.NewWriter(w)}
+	wr.write([]byte(fmt.Sprintf("%s%04d", magic, writeVersion)))
+	for _, aux := range [][2]string{
+		{"redis-ver", "7.0.0"},
+		{"redis-bits", "64"},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+		{"aof-preamble", "0"},
+	} {
+		wr.byte(opAux)
+		wr.string(aux[0])
+		wr.string(aux[1])
+	}
+	wr.byte(opSelectDB)
+	wr.length(0)
+	wr.byte(opResizeDB)
+	wr.length(uint64(st.Keys))
+	wr.length(uint64(expires))
+	sn.Range(func(key string, e *storage.Entry) bool {
+		if e.Type == storage.TypeStream {
+			return true
+		}
+		if e.ExpireAt != 0 {
+			wr.byte(opExpireTimeMs)
+			binary.LittleEndian.PutUint64(wr.buf[:], uint64(e.ExpireAt))
+			wr.write(wr.buf[:8])
+		}
+		wr.writeValue(key, e)
+		return wr.err == nil
+	})
+	wr.byte(opEOF)
+	if wr.err != nil {
+		return st, wr.err
+	}
+	binary.LittleEndian.PutUint64(wr.buf[:], wr.crc)
+	if _, err := wr.w.Write(wr.buf[:8]); err != nil {
+		return st, err
+	}
+	return st, wr.w.Flush()
+}
+
+// writeValue 以基本编码（而非 ziplist/listpack 等紧凑编码）写出键和值，
+// Redis 加载时会按自身配置重新选择内部编码
+func (wr *writer) writeValue(key string, e *storage.Entry) {
+	switch e.Type {
+	case storage.TypeString:
+		wr.byte(typeString)
+		wr.string(key)
+		wr.string(string(e.Value))
+	case storage.TypeList:
+		wr.byte(typeList)
+		wr.string(key)
+		wr.length(uint64(e.List.Len()))
+		for _, v := range e.List.Slice(0, e.List.Len()-1) {
+			wr.string(v)
+		}
+	case storage.TypeSet:
+		wr.byte(typeSet)
+		wr.string(key)
+		members := e.Set.Members()
+		wr.length(uint64(len(members)))
+		for _, m := range members {
+			wr.string(m)
+		}
+	case storage.TypeHash:
+		wr.byte(typeHash)
+		wr.string(key)
+		wr.length(uint64(len(e.Hash)))
+		for f, v := range e.Hash {
+			wr.string(f)
+			wr.string(v)
+		}
+	case storage.TypeZSet:
+		wr.byte(typeZSet2)
+		wr.string(key)
+		members := e.ZSet.RangeByRank(0, -1, false)
+		wr.length(uint64(len(members)))
+		for _, m := range members {
+			wr.string(m.Member)
+			binary.LittleEndian.PutUint64(wr.buf[:], math.Float64bits(m.Score))
+			wr.write(wr.buf[:8])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package repl 提供主从复制使用的积压缓冲区与复制 ID。
+//
+// 复制流是主节点按执行顺序写出的 RESP 命令序列，偏移（offset）为自复制 ID
+// 生成以来写入复制流的总字节数。积压缓冲区保存复制流最近的一段，断线重连的
+// 副本只要其偏移仍在缓冲区范围内，就可以从该偏移继续（部分重同步）而无需
+// 重新传输全部数据。
+package repl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// ErrOffsetOutOfRange 表示请求的偏移已不在积压缓冲区中（或超出复制流末尾）
+var ErrOffsetOutOfRange = errors.New("offset out of backlog range")
+
+// Backlog 是固定大小的环形缓冲区，保存复制流最后 size 个字节
+type Backlog struct {
+	mu      sync.Mutex
+	buf     []byte
+	offset  int64 // 复制流的总字节数（末尾偏移）
+	histlen int   // 缓冲区中的有效字节数
+	// notify 在每次追加后关闭并替换，供等待新数据的读者使用
+	notify chan struct{}
+}
+
+// NewBacklog returns an empty backlog of the given size whose stream
+// currently ends at offset.
+func NewBacklog(size int, offset int64) *Backlog {
+	return &Backlog{buf: make([]byte, size), offset: offset, notify: make(chan struct{})}
+}
+
+// Append adds p to the end of the stream, overwriting the oldest bytes once
+// the backlog is full.
+func (b *Backlog) Append(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := len(b.buf)
+	b.offset += int64(len(p))
+	if len(p) > size {
+		p = p[len(p)-size:]
+	}
+	// 新数据的起点（取模后）在 offset-len(p) 处
+	pos := int((b.offset - int64(len(p))) % int64(size))
+	n := copy(b.buf[pos:], p)
+	copy(b.buf, p[n:])
+	b.histlen = min(b.histlen+len(p), size)
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Reset discards the buffered data and restarts the stream at offset, as
+// after a full resynchronization with a new master. Waiting readers are
+// woken up and see ErrOffsetOutOfRange.
+func (b *Backlog) Reset(offset int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offset = offset
+	b.histlen = 0
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Offset returns the offset at the end of the stream.
+func (b *Backlog) Offset() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.offset
+}
+
+// Size returns the capacity of the backlog in bytes.
+func (b *Backlog) Size() int { return len(b.buf) }
+
+// HistLen returns the number of bytes currently buffered.
+func (b *Backlog) HistLen() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.histlen
+}
+
+// Contains reports whether a reader that has consumed the stream up to off
+// can continue from the backlog.
+func (b *Backlog) Contains(off int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return off >= b.offset-int64(b.histlen) && off <= b.offset
+}
+
+// ReadFrom returns up to max bytes that follow offset off. When no data is
+// available yet it returns an empty slice and a channel that is closed once
+// more data is appended. ErrOffsetOutOfRange is returned when the bytes
+// following off are no longer (or not yet) in the backlog.
+func (b *Backlog) ReadFrom(off int64, max int) ([]byte, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if off < b.offset-int64(b.histlen) || off > b.offset {
+		return nil, nil, ErrOffsetOutOfRange
+	}
+	n := int(min(b.offset-off, int64(max)))
+	out := make([]byte, n)
+	if n > 0 {
+		pos := int(off % int64(len(b.buf)))
+		m := copy(out, b.buf[pos:])
+		copy(out[m:], b.buf)
+	}
+	return out, b.notify, nil
+}
+
+// NewID returns a random 40-character replication ID.
+func NewID() string {
+	var b [20]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,59 @@
+package repl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBacklog(t *testing.T) {
+	b := NewBacklog(8, 100)
+	data, ch, err := b.ReadFrom(100, 16)
+	if err != nil || len(data) != 0 {
+		t.Fatalf("expected empty read, got %q %v", data, err)
+	}
+	b.Append([]byte("abcde"))
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected readers to be notified")
+	}
+	if data, _, _ := b.ReadFrom(100, 16); string(data) != "abcde" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	if data, _, _ := b.ReadFrom(102, 2); string(data) != "cd" {
+		t.Fatalf("unexpected data %q", data)
+	}
+
+	// 环绕：保留最后 8 个字节
+	b.Append([]byte("fghij"))
+	if b.Offset() != 110 || b.HistLen() != 8 {
+		t.Fatalf("unexpected offset %d histlen %d", b.Offset(), b.HistLen())
+	}
+	if data, _, _ := b.ReadFrom(102, 16); string(data) != "cdefghij" {
+		t.Fatalf("unexpected data %q", data)
+	}
+	if _, _, err := b.ReadFrom(101, 16); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Fatalf("expected out of range, got %v", err)
+	}
+	if b.Contains(111) || !b.Contains(110) || !b.Contains(102) {
+		t.Fatal("unexpected Contains result")
+	}
+
+	// 超过容量的追加只保留末尾
+	b.Append([]byte("0123456789"))
+	if data, _, _ := b.ReadFrom(112, 16); string(data) != "23456789" {
+		t.Fatalf("unexpected data %q", data)
+	}
+
+	b.Reset(5)
+	if b.Offset() != 5 || b.HistLen() != 0 || !b.Contains(5) || b.Contains(4) {
+		t.Fatal("unexpected state after reset")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 40 || a == b {
+		t.Fatalf("unexpected ids %q %q", a, b)
+	}
+}
@@ -0,0 +1,361 @@
+package sentinel
+
+import (
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// failoverState 为主节点的故障转移进度
+type failoverState int
+
+const (
+	failoverNone          failoverState = iota
+	failoverWaitStart                   // 已发起选举，等待得票
+	failoverSelectReplica               // 当选，选择要提升的副本
+	failoverWaitPromotion               // 已发送 REPLICAOF NO ONE，等待副本成为主节点
+)
+
+func (st failoverState) String() string {
+	switch st {
+	case failoverWaitStart:
+		return "wait_start"
+	case failoverSelectReplica:
+		return "select_slave"
+	case failoverWaitPromotion:
+		return "wait_promotion"
+	}
+	return "none"
+}
+
+// electionTimeout 为等待选举结果的上限
+const electionTimeout = 10 * time.Second
+
+// tickLoop 定期检查每个主节点的状态，推进故障转移
+func (s *Sentinel) tickLoop() {
+	ticker := time.NewTicker(min(100*time.Millisecond, s.PingPeriod))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for _, m := range s.masters {
+				s.checkMaster(m, now)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// desync 返回随机的延迟，避免多个 sentinel 同时发起选举而平分选票
+func (s *Sentinel) desync() time.Duration {
+	return time.Duration(rand.Int63n(int64(min(time.Second, 10*s.PingPeriod)) + 1))
+}
+
+// checkMaster 更新主节点的客观下线状态并推进故障转移；调用方需持有 s.mu
+func (s *Sentinel) checkMaster(m *master, now time.Time) {
+	sdown := m.inst.sdown(m.downAfter, now)
+	odown := false
+	if sdown {
+		if now.Sub(m.lastAsk) >= s.PingPeriod {
+			m.lastAsk = now
+			s.askPeers(m, m.state == failoverWaitStart)
+		}
+		down := 1
+		for _, p := range m.peers {
+			if p.masterDown && now.Sub(p.replyTime) < 5*s.PingPeriod {
+				down++
+			}
+		}
+		odown = down >= m.quorum
+	}
+	if odown != m.odown {
+		if odown {
+			log.Printf("sentinel: +odown master %s %s #quorum %d", m.name, m.inst.addr, m.quorum)
+		} else {
+			log.Printf("sentinel: -odown master %s %s", m.name, m.inst.addr)
+		}
+		m.odown = odown
+	}
+
+	switch m.state {
+	case failoverNone:
+		// 最近一次尝试（或投票给其他 sentinel）之后的两倍 failoverTimeout 内不再发起
+		if m.odown && now.After(m.failoverStart.Add(2*m.failoverTimeout)) {
+			if m.startAfter.IsZero() {
+				m.startAfter = now.Add(s.desync())
+			} else if now.After(m.startAfter) {
+				s.startFailover(m, now)
+			}
+		} else {
+			m.startAfter = time.Time{}
+		}
+		if !sdown {
+			s.fixReplicas(m, now)
+		}
+	case failoverWaitStart:
+		votes := s.countVotes(m)
+		need := max(m.quorum, (len(m.peers)+1)/2+1)
+		switch {
+		case votes >= need:
+			log.Printf("sentinel: +elected-leader master %s %s epoch %d", m.name, m.inst.addr, m.failoverEpoch)
+			s.setState(m, failoverSelectReplica, now)
+		case !m.odown:
+			s.abortFailover(m, "master is no longer down")
+		case now.Sub(m.stateTime) > min(electionTimeout, m.failoverTimeout):
+			s.abortFailover(m, "not elected")
+		}
+	case failoverSelectReplica:
+		r := s.selectReplica(m, now)
+		if r == nil {
+			s.abortFailover(m, "no good replica")
+			return
+		}
+		log.Printf("sentinel: +selected-slave %s for master %s", r.addr, m.name)
+		m.promoted = r
+		s.setState(m, failoverWaitPromotion, now)
+		s.sendReplicaOf(r, now, "NO", "ONE")
+	case failoverWaitPromotion:
+		r := m.promoted
+		switch {
+		case r.role == "master" && r.infoTime.After(m.stateTime):
+			log.Printf("sentinel: +promoted-slave %s for master %s", r.addr, m.name)
+			s.switchMaster(m, r.addr, m.failoverEpoch)
+		case now.Sub(m.stateTime) > m.failoverTimeout:
+			s.abortFailover(m, "promotion timed out")
+		case now.Sub(r.lastReconf) > 10*s.PingPeriod:
+			s.sendReplicaOf(r, now, "NO", "ONE")
+		}
+	}
+}
+
+func (s *Sentinel) setState(m *master, st failoverState, now time.Time) {
+	m.state, m.stateTime = st, now
+}
+
+// startFailover 以新的纪元发起选举并为自己投票
+func (s *Sentinel) startFailover(m *master, now time.Time) {
+	s.epoch++
+	m.failoverEpoch = s.epoch
+	m.failoverStart = now
+	m.startAfter = time.Time{}
+	s.vote(m, s.runID, s.epoch, now)
+	s.setState(m, failoverWaitStart, now)
+	// 立即以选举模式询问其他 sentinel
+	m.lastAsk = now
+	s.askPeers(m, true)
+	log.Printf("sentinel: +try-failover master %s %s epoch %d", m.name, m.inst.addr, m.failoverEpoch)
+}
+
+func (s *Sentinel) abortFailover(m *master, reason string) {
+	log.Printf("sentinel: -failover-abort master %s %s: %s", m.name, m.inst.addr, reason)
+	m.state, m.promoted = failoverNone, nil
+}
+
+// countVotes 返回本 sentinel 在当前故障转移纪元得到的票数
+func (s *Sentinel) countVotes(m *master) int {
+	votes := 0
+	if m.leader == s.runID && m.leaderEpoch == m.failoverEpoch {
+		votes++
+	}
+	for _, p := range m.peers {
+		if p.leader == s.runID && p.leaderEpoch == m.failoverEpoch {
+			votes++
+		}
+	}
+	return votes
+}
+
+// vote 在 epoch 中为 runID 投票：每个纪元只投给第一个请求者。返回本纪元
+// （或更新的纪元）中已投给的 sentinel。投票给其他 sentinel 后在两倍
+// failoverTimeout 内不自行发起故障转移。
+func (s *Sentinel) vote(m *master, runID string, epoch uint64, now time.Time) (string, uint64) {
+	s.epoch = max(s.epoch, epoch)
+	if m.leaderEpoch < epoch && s.epoch <= epoch {
+		m.leader, m.leaderEpoch = runID, epoch
+		if runID != s.runID {
+			m.failoverStart = now.Add(s.desync())
+		}
+		log.Printf("sentinel: +vote-for-leader %s epoch %d", runID, epoch)
+	}
+	return m.leader, m.leaderEpoch
+}
+
+// isMasterDown 实现 SENTINEL IS-MASTER-DOWN-BY-ADDR ip port epoch runid：回复
+// 本 sentinel 是否认为该主节点主观下线；runid 不为 * 时同时请求在 epoch 中投票，
+// 回复所投的 sentinel 与纪元。调用方需持有 s.mu。
+func (s *Sentinel) isMasterDown(ip, port, epochArg, runID string) []byte {
+	epoch, err := strconv.ParseUint(epochArg, 10, 64)
+	if err != nil {
+		return []byte("-ERR value is not an integer or out of range\r\n")
+	}
+	addr := net.JoinHostPort(ip, port)
+	now := time.Now()
+	down, leader, leaderEpoch := 0, "*", uint64(0)
+	for _, m := range s.masters {
+		if m.inst.addr != addr {
+			continue
+		}
+		if m.inst.sdown(m.downAfter, now) {
+			down = 1
+		}
+		if runID != "*" {
+			leader, leaderEpoch = s.vote(m, runID, epoch, now)
+		}
+		break
+	}
+	return []byte("*3\r\n:" + strconv.Itoa(down) + "\r\n" + string(bulk(leader)) + ":" + strconv.FormatUint(leaderEpoch, 10) + "\r\n")
+}
+
+// askPeers 异步向其他 sentinel 询问主节点是否下线；election 时同时请求投票。
+// 调用方需持有 s.mu。
+func (s *Sentinel) askPeers(m *master, election bool) {
+	host, port, _ := net.SplitHostPort(m.inst.addr)
+	runID, epoch := "*", strconv.FormatUint(s.epoch, 10)
+	if election {
+		runID, epoch = s.runID, strconv.FormatUint(m.failoverEpoch, 10)
+	}
+	timeout := min(m.downAfter, time.Second)
+	for _, p := range m.peers {
+		if p.asking {
+			continue
+		}
+		p.asking = true
+		go func(p *peer, addr string) {
+			var reply []any
+			c, err := protocol.Dial(addr, timeout)
+			if err == nil {
+				var v any
+				v, err = c.Do("SENTINEL", "IS-MASTER-DOWN-BY-ADDR", host, port, epoch, runID)
+				c.Close()
+				reply, _ = v.([]any)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			p.asking = false
+			if err != nil || len(reply) != 3 {
+				return
+			}
+			down, _ := reply[0].(int64)
+			leader, _ := reply[1].(string)
+			leaderEpoch, _ := reply[2].(int64)
+			p.masterDown, p.replyTime = down == 1, time.Now()
+			if leader != "*" {
+				p.leader, p.leaderEpoch = leader, uint64(leaderEpoch)
+			}
+		}(p, p.addr)
+	}
+}
+
+// selectReplica 选择要提升的副本：排除下线、INFO 过旧与优先级为 0 的副本，
+// 依次按优先级从小到大、复制偏移从大到小、地址排序
+func (s *Sentinel) selectReplica(m *master, now time.Time) *instance {
+	var best *instance
+	for _, r := range m.sortedReplicas() {
+		if r.sdown(m.downAfter, now) || r.role != "slave" || r.priority == 0 ||
+			now.Sub(r.infoTime) > 5*s.infoPeriod(r) {
+			continue
+		}
+		if best == nil || r.priority < best.priority ||
+			(r.priority == best.priority && r.offset > best.offset) {
+			best = r
+		}
+	}
+	return best
+}
+
+// infoPeriod 为向实例发送 INFO 的间隔：主节点客观下线或故障转移期间副本每个
+// PingPeriod 发送一次，以便及时得到复制偏移与提升结果
+func (s *Sentinel) infoPeriod(inst *instance) time.Duration {
+	m := inst.master
+	if inst != m.inst && (m.odown || m.state != failoverNone) {
+		return min(s.InfoPeriod, s.PingPeriod)
+	}
+	return s.InfoPeriod
+}
+
+// switchMaster 将主节点的地址改为 addr 并以 epoch 为配置纪元：原主节点与其余
+// 副本都成为新主节点的副本，随后由 fixReplicas 重新配置。调用方需持有 s.mu。
+func (s *Sentinel) switchMaster(m *master, addr string, epoch uint64) {
+	log.Printf("sentinel: +switch-master %s %s %s", m.name, m.inst.addr, addr)
+	addrs := []string{m.inst.addr}
+	for _, inst := range m.instances() {
+		inst.close()
+		if inst != m.inst {
+			addrs = append(addrs, inst.addr)
+		}
+	}
+	m.configEpoch = epoch
+	m.inst = s.newInstance(m, addr)
+	m.replicas = make(map[string]*instance)
+	for _, a := range addrs {
+		if a != addr {
+			m.replicas[a] = s.newInstance(m, a)
+		}
+	}
+	m.odown, m.state, m.promoted, m.startAfter = false, failoverNone, nil, time.Time{}
+	if s.started {
+		for _, inst := range m.instances() {
+			s.startInstance(inst)
+		}
+	}
+}
+
+// fixReplicas 让自认为主节点或复制其他节点的副本改为复制当前主节点，包括
+// 故障转移后重新上线的原主节点。只在主节点在线并确认自己为主节点时进行。
+func (s *Sentinel) fixReplicas(m *master, now time.Time) {
+	if m.inst.role != "master" {
+		return
+	}
+	for _, r := range m.replicas {
+		if r.infoTime.IsZero() || r.sdown(m.downAfter, now) ||
+			(r.role == "slave" && r.masterAddr == m.inst.addr) ||
+			now.Sub(r.lastReconf) < 10*s.PingPeriod {
+			continue
+		}
+		log.Printf("sentinel: +reconf-slave %s for master %s %s", r.addr, m.name, m.inst.addr)
+		host, port, _ := net.SplitHostPort(m.inst.addr)
+		s.sendReplicaOf(r, now, host, port)
+	}
+}
+
+// sendReplicaOf 异步向实例发送 REPLICAOF；调用方需持有 s.mu
+func (s *Sentinel) sendReplicaOf(inst *instance, now time.Time, host, port string) {
+	inst.lastReconf = now
+	timeout := min(inst.master.downAfter, time.Second)
+	go func() {
+		c, err := protocol.Dial(inst.addr, timeout)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, err := c.Do("REPLICAOF", host, port); err != nil {
+			log.Printf("sentinel: REPLICAOF %s %s on %s: %v", host, port, inst.addr, err)
+		}
+	}()
+}
+
+// forceFailover 实现 SENTINEL FAILOVER：不经其他 sentinel 同意立即提升副本。
+// 调用方需持有 s.mu。
+func (s *Sentinel) forceFailover(m *master) []byte {
+	if m.state != failoverNone {
+		return []byte("-INPROG Failover already in progress\r\n")
+	}
+	now := time.Now()
+	if s.selectReplica(m, now) == nil {
+		return []byte("-NOGOODSLAVE No suitable replica to promote\r\n")
+	}
+	s.epoch++
+	m.failoverEpoch = s.epoch
+	m.failoverStart = now
+	s.vote(m, s.runID, s.epoch, now)
+	s.setState(m, failoverSelectReplica, now)
+	log.Printf("sentinel: +new-epoch %d, forced failover of master %s", s.epoch, m.name)
+	return []byte("+OK\r\n")
+}
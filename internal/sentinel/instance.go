@@ -0,0 +1,378 @@
+package sentinel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// helloChannel 为 sentinel 之间互相发现与通告配置的频道
+const helloChannel = "__sentinel__:hello"
+
+// master 为被监控的主节点及其副本、其他 sentinel 与故障转移状态；
+// 字段由 Sentinel.mu 保护
+type master struct {
+	name            string
+	quorum          int
+	downAfter       time.Duration
+	failoverTimeout time.Duration
+	// configEpoch 为当前主节点地址所对应的纪元，故障转移后为该次转移的纪元
+	configEpoch uint64
+	inst        *instance
+	replicas    map[string]*instance // 以地址为键
+	peers       map[string]*peer     // 其他 sentinel，以 run ID 为键
+	odown       bool
+	lastAsk     time.Time
+	// leader/leaderEpoch 为本 sentinel 在该主节点上最近一次的投票
+	leader      string
+	leaderEpoch uint64
+	// 故障转移状态，见 failover.go
+	state         failoverState
+	failoverEpoch uint64
+	// failoverStart 为最近一次开始故障转移（或投票给其他 sentinel）的时间，
+	// 在其两倍 failoverTimeout 之内不再发起新的故障转移
+	failoverStart time.Time
+	startAfter    time.Time
+	stateTime     time.Time
+	promoted      *instance
+}
+
+// instances 返回主节点与全部副本
+func (m *master) instances() []*instance {
+	out := []*instance{m.inst}
+	for _, r := range m.replicas {
+		out = append(out, r)
+	}
+	return out
+}
+
+func (m *master) sortedReplicas() []*instance {
+	out := make([]*instance, 0, len(m.replicas))
+	for _, r := range m.replicas {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].addr < out[j].addr })
+	return out
+}
+
+func (m *master) sortedPeers() []*peer {
+	out := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].runID < out[j].runID })
+	return out
+}
+
+func (s *Sentinel) sortedMasters() []*master {
+	out := make([]*master, 0, len(s.masters))
+	for _, m := range s.masters {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+// peer 为监控同一主节点的另一个 sentinel
+type peer struct {
+	runID     string
+	addr      string
+	lastHello time.Time
+	// 最近一次 IS-MASTER-DOWN-BY-ADDR 的回复：对方是否认为主节点下线，以及对方
+	// 的投票
+	masterDown  bool
+	replyTime   time.Time
+	leader      string
+	leaderEpoch uint64
+	asking      bool
+}
+
+// instance 为被监控的主节点或副本；除 addr、master 与 stop 外的字段由
+// Sentinel.mu 保护
+type instance struct {
+	addr   string
+	master *master
+	added  time.Time
+	// lastOK 为最近一次有效 PING 回复的时间
+	lastOK time.Time
+	// 以下来自最近一次 INFO
+	infoTime   time.Time
+	role       string
+	masterAddr string // 副本所复制的主节点
+	linkUp     bool
+	offset     int64
+	priority   int
+	replicas   []string // 主节点报告的在线副本
+	// lastReconf 为最近一次发送 REPLICAOF 纠正其配置的时间
+	lastReconf time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (s *Sentinel) newInstance(m *master, addr string) *instance {
+	return &instance{addr: addr, master: m, added: time.Now(), priority: 100, stop: make(chan struct{})}
+}
+
+// startInstance 开始监控实例；调用方需持有 s.mu
+func (s *Sentinel) startInstance(inst *instance) {
+	go s.monitor(inst)
+	go s.subscribe(inst)
+}
+
+func (inst *instance) close() {
+	inst.stopOnce.Do(func() { close(inst.stop) })
+}
+
+// sdown 报告实例是否主观下线：超过 downAfter 没有有效的 PING 回复
+func (inst *instance) sdown(downAfter time.Duration, now time.Time) bool {
+	last := inst.lastOK
+	if last.Before(inst.added) {
+		last = inst.added
+	}
+	return now.Sub(last) > downAfter
+}
+
+// monitor 维护到实例的命令连接：每个 PingPeriod 发送 PING，并按 InfoPeriod 与
+// HelloPeriod 发送 INFO、发布 hello 消息；连接出错后在下一个周期重连
+func (s *Sentinel) monitor(inst *instance) {
+	var c *protocol.Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	var lastInfo, lastHello time.Time
+	ticker := time.NewTicker(s.PingPeriod)
+	defer ticker.Stop()
+	for {
+		if c == nil {
+			c, _ = protocol.Dial(inst.addr, s.requestTimeout(inst))
+		}
+		if c != nil {
+			if err := s.poll(inst, c, &lastInfo, &lastHello); err != nil {
+				c.Close()
+				c = nil
+			}
+		}
+		select {
+		case <-inst.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// requestTimeout 为发往实例的请求的超时：不超过 down-after
+func (s *Sentinel) requestTimeout(inst *instance) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return min(inst.master.downAfter, time.Second)
+}
+
+func (s *Sentinel) poll(inst *instance, c *protocol.Conn, lastInfo, lastHello *time.Time) error {
+	_, err := c.Do("PING")
+	var re protocol.ReplyError
+	if err != nil && !errors.As(err, &re) {
+		return err
+	}
+	// 与 Redis 一致，LOADING 与 MASTERDOWN 也视为有效回复
+	if err == nil || strings.HasPrefix(string(re), "LOADING") || strings.HasPrefix(string(re), "MASTERDOWN") {
+		s.mu.Lock()
+		inst.lastOK = time.Now()
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	infoPeriod := s.infoPeriod(inst)
+	s.mu.Unlock()
+	if time.Since(*lastInfo) >= infoPeriod {
+		v, err := c.Do("INFO")
+		if err != nil {
+			return err
+		}
+		text, _ := v.(string)
+		s.updateInfo(inst, parseInfo(text))
+		*lastInfo = time.Now()
+	}
+	if time.Since(*lastHello) >= s.HelloPeriod {
+		if _, err := c.Do("PUBLISH", helloChannel, s.hello(inst, c)); err != nil {
+			return err
+		}
+		*lastHello = time.Now()
+	}
+	return nil
+}
+
+// hello 返回 hello 消息：sentinel 地址、run ID、当前纪元，以及主节点名称、地址
+// 与配置纪元，以逗号分隔
+func (s *Sentinel) hello(inst *instance, c *protocol.Conn) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ln := s.ln.Addr().(*net.TCPAddr)
+	host := ln.IP.String()
+	if ln.IP.IsUnspecified() {
+		// 监听在所有地址上时通告连接实例所用的本地地址
+		host = c.LocalAddr().(*net.TCPAddr).IP.String()
+	}
+	m := inst.master
+	mhost, mport, _ := net.SplitHostPort(m.inst.addr)
+	return fmt.Sprintf("%s,%d,%s,%d,%s,%s,%s,%d", host, ln.Port, s.runID, s.epoch, m.name, mhost, mport, m.configEpoch)
+}
+
+// subscribe 订阅实例的 hello 频道，处理其他 sentinel 的 hello 消息
+func (s *Sentinel) subscribe(inst *instance) {
+	for {
+		timeout := s.requestTimeout(inst)
+		if c, err := protocol.Dial(inst.addr, timeout); err == nil {
+			// 停止监控时关闭连接以结束阻塞的读取
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-inst.stop:
+					c.Close()
+				case <-done:
+				}
+			}()
+			s.readHellos(c)
+			close(done)
+			c.Close()
+		}
+		select {
+		case <-inst.stop:
+			return
+		case <-time.After(s.PingPeriod):
+		}
+	}
+}
+
+func (s *Sentinel) readHellos(c *protocol.Conn) {
+	if err := c.Send("SUBSCRIBE", helloChannel); err != nil {
+		return
+	}
+	for {
+		v, err := c.Receive(0)
+		if err != nil {
+			return
+		}
+		if msg, _ := v.([]any); len(msg) == 3 && msg[0] == "message" {
+			payload, _ := msg[2].(string)
+			s.processHello(payload)
+		}
+	}
+}
+
+// processHello 记录发送 hello 的 sentinel；对方通告的主节点配置纪元更大时切换到
+// 其通告的主节点地址
+func (s *Sentinel) processHello(payload string) {
+	f := strings.Split(payload, ",")
+	if len(f) != 8 {
+		return
+	}
+	epoch, err1 := strconv.ParseUint(f[3], 10, 64)
+	masterEpoch, err2 := strconv.ParseUint(f[7], 10, 64)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	runID, addr := f[2], net.JoinHostPort(f[0], f[1])
+	masterAddr := net.JoinHostPort(f[5], f[6])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.masters[f[4]]
+	if m == nil || runID == s.runID {
+		return
+	}
+	s.epoch = max(s.epoch, epoch)
+	p := m.peers[runID]
+	if p == nil {
+		// 同一地址上的 sentinel 重启后 run ID 改变
+		for id, old := range m.peers {
+			if old.addr == addr {
+				delete(m.peers, id)
+			}
+		}
+		p = &peer{runID: runID}
+		m.peers[runID] = p
+	}
+	p.addr, p.lastHello = addr, time.Now()
+	if masterEpoch > m.configEpoch {
+		if masterAddr != m.inst.addr {
+			s.switchMaster(m, masterAddr, masterEpoch)
+		} else {
+			m.configEpoch = masterEpoch
+		}
+	}
+}
+
+// parseInfo 解析 INFO 的 key:value 行
+func parseInfo(text string) map[string]string {
+	info := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if k, v, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, "#") {
+			info[k] = v
+		}
+	}
+	return info
+}
+
+// infoReplicas 从主节点的 INFO 中取出在线副本的地址（slaveN:ip=...,port=...）
+func infoReplicas(info map[string]string) []string {
+	var out []string
+	for k, v := range info {
+		if n := strings.TrimPrefix(k, "slave"); n == k || n == "" || strings.Trim(n, "0123456789") != "" {
+			continue
+		}
+		var ip, port string
+		for _, kv := range strings.Split(v, ",") {
+			switch name, val, _ := strings.Cut(kv, "="); name {
+			case "ip":
+				ip = val
+			case "port":
+				port = val
+			}
+		}
+		if ip != "" && port != "" && port != "0" {
+			out = append(out, net.JoinHostPort(ip, port))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// updateInfo 以 INFO 的结果更新实例；主节点报告的新副本加入监控
+func (s *Sentinel) updateInfo(inst *instance, info map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.infoTime = time.Now()
+	inst.role = info["role"]
+	inst.linkUp = info["master_link_status"] == "up"
+	inst.masterAddr = ""
+	if info["master_host"] != "" {
+		inst.masterAddr = net.JoinHostPort(info["master_host"], info["master_port"])
+	}
+	inst.offset, _ = strconv.ParseInt(info["slave_repl_offset"], 10, 64)
+	inst.priority = 100
+	if p, err := strconv.Atoi(info["slave_priority"]); err == nil {
+		inst.priority = p
+	}
+	m := inst.master
+	if inst != m.inst || inst.role != "master" {
+		return
+	}
+	inst.replicas = infoReplicas(info)
+	for _, addr := range inst.replicas {
+		if m.replicas[addr] == nil && addr != m.inst.addr {
+			r := s.newInstance(m, addr)
+			m.replicas[addr] = r
+			s.startInstance(r)
+		}
+	}
+}
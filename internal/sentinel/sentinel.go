@@ -0,0 +1,401 @@
+// Package sentinel 实现 redisx sentinel：监控主节点及其副本，在主节点下线时自动
+// 故障转移。
+//
+// 与 Redis Sentinel 一致：每个 sentinel 定期 PING 与 INFO 被监控的实例，超过
+// down-after 没有有效回复的实例为主观下线（SDOWN）。主节点主观下线后向其他
+// sentinel 询问（SENTINEL IS-MASTER-DOWN-BY-ADDR），包括自己在内有 quorum 个认为
+// 下线时为客观下线（ODOWN）。随后以递增的纪元请求其他 sentinel 投票，每个纪元
+// 每个 sentinel 只投一票；得票过半且不少于 quorum 的 sentinel 提升最佳副本
+// （REPLICAOF NO ONE），再以新的配置纪元通过 hello 消息通告新的主节点，其余副本
+// 随后被改为复制新主节点。sentinel 之间通过被监控实例的 __sentinel__:hello 频道
+// 互相发现。
+package sentinel
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+const (
+	defaultPingPeriod      = time.Second
+	defaultInfoPeriod      = 10 * time.Second
+	defaultHelloPeriod     = 2 * time.Second
+	defaultDownAfter       = 30 * time.Second
+	defaultFailoverTimeout = 3 * time.Minute
+)
+
+// Sentinel 监控一组主节点；配置字段需在 Start 之前设置
+type Sentinel struct {
+	addr string
+	ln   net.Listener
+	// PingPeriod、InfoPeriod、HelloPeriod 分别为向每个实例发送 PING、INFO 与
+	// 发布 hello 消息的间隔
+	PingPeriod  time.Duration
+	InfoPeriod  time.Duration
+	HelloPeriod time.Duration
+	// DownAfter 与 FailoverTimeout 为 Monitor 新增主节点时的默认值：实例多久没有
+	// 有效回复后主观下线；一次故障转移的超时（同一主节点两次尝试至少间隔其两倍）
+	DownAfter       time.Duration
+	FailoverTimeout time.Duration
+
+	runID   string
+	mu      sync.Mutex
+	epoch   uint64 // currentEpoch：所见过的最大纪元
+	masters map[string]*master
+	started bool
+	done    chan struct{}
+}
+
+// NewSentinel creates a sentinel that will listen on addr.
+func NewSentinel(addr string) *Sentinel {
+	var id [20]byte
+	rand.Read(id[:])
+	return &Sentinel{
+		addr:            addr,
+		PingPeriod:      defaultPingPeriod,
+		InfoPeriod:      defaultInfoPeriod,
+		HelloPeriod:     defaultHelloPeriod,
+		DownAfter:       defaultDownAfter,
+		FailoverTimeout: defaultFailoverTimeout,
+		runID:           hex.EncodeToString(id[:]),
+		masters:         make(map[string]*master),
+		done:            make(chan struct{}),
+	}
+}
+
+// MyID returns the run ID that identifies this sentinel to the others.
+func (s *Sentinel) MyID() string { return s.runID }
+
+// Addr returns the listening address, or "" before Start.
+func (s *Sentinel) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Monitor starts monitoring the master at host:port under name; quorum is
+// the number of sentinels that must agree that it is down.
+func (s *Sentinel) Monitor(name, host string, port, quorum int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.monitorLocked(name, host, port, quorum)
+}
+
+func (s *Sentinel) monitorLocked(name, host string, port, quorum int) error {
+	if _, ok := s.masters[name]; ok {
+		return errors.New("ERR Duplicated master name")
+	}
+	if quorum <= 0 {
+		return errors.New("ERR Quorum must be 1 or greater.")
+	}
+	if port <= 0 || port > 65535 {
+		return errors.New("ERR Invalid port number")
+	}
+	m := &master{
+		name:            name,
+		quorum:          quorum,
+		downAfter:       s.DownAfter,
+		failoverTimeout: s.FailoverTimeout,
+		replicas:        make(map[string]*instance),
+		peers:           make(map[string]*peer),
+	}
+	m.inst = s.newInstance(m, net.JoinHostPort(host, strconv.Itoa(port)))
+	s.masters[name] = m
+	return nil
+}
+
+// Start listens on the configured address and serves clients until Close.
+func (s *Sentinel) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ln = ln
+	s.started = true
+	for _, m := range s.masters {
+		for _, inst := range m.instances() {
+			s.startInstance(inst)
+		}
+	}
+	s.mu.Unlock()
+	log.Printf("sentinel: listening on %s, ID %s", ln.Addr(), s.runID)
+	go s.tickLoop()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Println("sentinel: accept error:", err)
+			continue
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops the sentinel: the listener and all monitoring are shut down.
+func (s *Sentinel) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	close(s.done)
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	for _, m := range s.masters {
+		for _, inst := range m.instances() {
+			inst.close()
+		}
+	}
+}
+
+func (s *Sentinel) handleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, args, err := protocol.ParseRequest(r)
+		if err != nil {
+			if err != protocol.ErrClosed {
+				conn.Write([]byte(fmt.Sprintf("-ERR %v\r\n", err)))
+			}
+			return
+		}
+		switch strings.ToUpper(cmd) {
+		case "PING":
+			conn.Write([]byte("+PONG\r\n"))
+		case "INFO":
+			conn.Write(bulk(s.info()))
+		case "SENTINEL":
+			conn.Write(s.sentinelCommand(args))
+		case "QUIT":
+			conn.Write([]byte("+OK\r\n"))
+			return
+		default:
+			conn.Write([]byte(fmt.Sprintf("-ERR unknown command '%s'\r\n", cmd)))
+		}
+	}
+}
+
+// info 返回 INFO 的内容
+func (s *Sentinel) info() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Server\r\nredis_mode:sentinel\r\nrun_id:%s\r\n\r\n# Sentinel\r\nsentinel_masters:%d\r\n", s.runID, len(s.masters))
+	for i, m := range s.sortedMasters() {
+		status := "ok"
+		if m.odown {
+			status = "odown"
+		} else if m.inst.sdown(m.downAfter, time.Now()) {
+			status = "sdown"
+		}
+		fmt.Fprintf(&b, "master%d:name=%s,status=%s,address=%s,slaves=%d,sentinels=%d\r\n",
+			i, m.name, status, m.inst.addr, len(m.replicas), len(m.peers)+1)
+	}
+	return b.String()
+}
+
+// sentinelCommand 实现 SENTINEL 子命令
+func (s *Sentinel) sentinelCommand(args []string) []byte {
+	if len(args) == 0 {
+		return []byte("-ERR wrong number of arguments for 'sentinel' command\r\n")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "MYID" && len(args) == 1:
+		return bulk(s.runID)
+	case sub == "MASTERS" && len(args) == 1:
+		var items [][]byte
+		for _, m := range s.sortedMasters() {
+			items = append(items, fields(s.masterFields(m)))
+		}
+		return array(items)
+	case sub == "MONITOR" && len(args) == 5:
+		port, err1 := strconv.Atoi(args[3])
+		quorum, err2 := strconv.Atoi(args[4])
+		if err1 != nil || err2 != nil {
+			return []byte("-ERR value is not an integer or out of range\r\n")
+		}
+		if err := s.monitorLocked(args[1], args[2], port, quorum); err != nil {
+			return errReply(err)
+		}
+		if s.started {
+			s.startInstance(s.masters[args[1]].inst)
+		}
+		return []byte("+OK\r\n")
+	case sub == "IS-MASTER-DOWN-BY-ADDR" && len(args) == 5:
+		return s.isMasterDown(args[1], args[2], args[3], args[4])
+	}
+	if len(args) < 2 {
+		return []byte("-ERR Unknown sentinel subcommand or wrong number of arguments\r\n")
+	}
+	m := s.masters[args[1]]
+	if m == nil {
+		if sub == "GET-MASTER-ADDR-BY-NAME" {
+			return []byte("*-1\r\n")
+		}
+		return []byte("-ERR No such master with that name\r\n")
+	}
+	switch {
+	case sub == "GET-MASTER-ADDR-BY-NAME" && len(args) == 2:
+		host, port, _ := net.SplitHostPort(m.inst.addr)
+		return array([][]byte{bulk(host), bulk(port)})
+	case sub == "MASTER" && len(args) == 2:
+		return fields(s.masterFields(m))
+	case (sub == "REPLICAS" || sub == "SLAVES") && len(args) == 2:
+		var items [][]byte
+		for _, r := range m.sortedReplicas() {
+			items = append(items, fields(replicaFields(r, m.downAfter)))
+		}
+		return array(items)
+	case sub == "SENTINELS" && len(args) == 2:
+		var items [][]byte
+		for _, p := range m.sortedPeers() {
+			host, port, _ := net.SplitHostPort(p.addr)
+			items = append(items, fields([]string{"name", p.addr, "ip", host, "port", port, "runid", p.runID,
+				"flags", "sentinel", "last-hello-message", strconv.FormatInt(time.Since(p.lastHello).Milliseconds(), 10)}))
+		}
+		return array(items)
+	case sub == "CKQUORUM" && len(args) == 2:
+		return s.ckquorum(m)
+	case sub == "FAILOVER" && len(args) == 2:
+		return s.forceFailover(m)
+	case sub == "REMOVE" && len(args) == 2:
+		for _, inst := range m.instances() {
+			inst.close()
+		}
+		delete(s.masters, m.name)
+		return []byte("+OK\r\n")
+	case sub == "SET" && len(args) >= 4 && len(args)%2 == 0:
+		return s.setOptions(m, args[2:])
+	}
+	return []byte("-ERR Unknown sentinel subcommand or wrong number of arguments\r\n")
+}
+
+// masterFields 返回 SENTINEL MASTER 的字段
+func (s *Sentinel) masterFields(m *master) []string {
+	host, port, _ := net.SplitHostPort(m.inst.addr)
+	flags := "master"
+	if m.inst.sdown(m.downAfter, time.Now()) {
+		flags += ",s_down"
+	}
+	if m.odown {
+		flags += ",o_down"
+	}
+	if m.state != failoverNone {
+		flags += ",failover_in_progress"
+	}
+	return []string{
+		"name", m.name, "ip", host, "port", port, "flags", flags,
+		"num-slaves", strconv.Itoa(len(m.replicas)),
+		"num-other-sentinels", strconv.Itoa(len(m.peers)),
+		"quorum", strconv.Itoa(m.quorum),
+		"config-epoch", strconv.FormatUint(m.configEpoch, 10),
+		"down-after-milliseconds", strconv.FormatInt(m.downAfter.Milliseconds(), 10),
+		"failover-timeout", strconv.FormatInt(m.failoverTimeout.Milliseconds(), 10),
+		"failover-state", m.state.String(),
+	}
+}
+
+func replicaFields(r *instance, downAfter time.Duration) []string {
+	host, port, _ := net.SplitHostPort(r.addr)
+	flags := "slave"
+	if r.sdown(downAfter, time.Now()) {
+		flags += ",s_down"
+	}
+	link := "err"
+	if r.linkUp {
+		link = "ok"
+	}
+	return []string{
+		"name", r.addr, "ip", host, "port", port, "flags", flags,
+		"role-reported", r.role, "master-link-status", link,
+		"slave-priority", strconv.Itoa(r.priority),
+		"slave-repl-offset", strconv.FormatInt(r.offset, 10),
+	}
+}
+
+// setOptions 实现 SENTINEL SET name option value [option value ...]
+func (s *Sentinel) setOptions(m *master, args []string) []byte {
+	for i := 0; i < len(args); i += 2 {
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n <= 0 {
+			return []byte(fmt.Sprintf("-ERR Invalid argument '%s' for SENTINEL SET '%s'\r\n", args[i+1], args[i]))
+		}
+		switch strings.ToLower(args[i]) {
+		case "down-after-milliseconds":
+			m.downAfter = time.Duration(n) * time.Millisecond
+		case "failover-timeout":
+			m.failoverTimeout = time.Duration(n) * time.Millisecond
+		case "quorum":
+			m.quorum = int(n)
+		default:
+			return []byte(fmt.Sprintf("-ERR Invalid argument '%s' for SENTINEL SET\r\n", args[i]))
+		}
+	}
+	return []byte("+OK\r\n")
+}
+
+// ckquorum 检查当前可用的 sentinel 是否足以判定客观下线并授权故障转移
+func (s *Sentinel) ckquorum(m *master) []byte {
+	usable := 1
+	for _, p := range m.peers {
+		if time.Since(p.lastHello) < 5*s.HelloPeriod {
+			usable++
+		}
+	}
+	voters := len(m.peers) + 1
+	switch {
+	case usable < m.quorum:
+		return []byte(fmt.Sprintf("-NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the specified quorum for this master\r\n", usable))
+	case usable < voters/2+1:
+		return []byte(fmt.Sprintf("-NOQUORUM %d usable Sentinels. Not enough available Sentinels to reach the majority and authorize a failover\r\n", usable))
+	}
+	return []byte(fmt.Sprintf("+OK %d usable Sentinels. Quorum and failover authorization can be reached\r\n", usable))
+}
+
+func bulk(v string) []byte {
+	return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(v), v))
+}
+
+func array(items [][]byte) []byte {
+	b := []byte(fmt.Sprintf("*%d\r\n", len(items)))
+	for _, it := range items {
+		b = append(b, it...)
+	}
+	return b
+}
+
+// fields 将字段名与值交替编码为 bulk string 数组
+func fields(kv []string) []byte {
+	items := make([][]byte, len(kv))
+	for i, v := range kv {
+		items[i] = bulk(v)
+	}
+	return array(items)
+}
+
+func errReply(err error) []byte {
+	return []byte("-" + err.Error() + "\r\n")
+}
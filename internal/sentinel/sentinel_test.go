@@ -0,0 +1,109 @@
+package sentinel
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo("# Replication\r\nrole:master\r\nslave0:ip=127.0.0.1,port=7001,state=online,offset=10,lag=0\r\n" +
+		"slave1:ip=10.0.0.2,port=7002,state=online,offset=10,lag=1\r\nslave_read_only:1\r\nconnected_slaves:2\r\n")
+	if info["role"] != "master" || info["connected_slaves"] != "2" {
+		t.Fatalf("unexpected fields: %v", info)
+	}
+	want := []string{"10.0.0.2:7002", "127.0.0.1:7001"}
+	if got := infoReplicas(info); !reflect.DeepEqual(got, want) {
+		t.Fatalf("infoReplicas = %v, want %v", got, want)
+	}
+}
+
+func testSentinel(t *testing.T) (*Sentinel, *master) {
+	s := NewSentinel("127.0.0.1:0")
+	if err := s.Monitor("mymaster", "127.0.0.1", 6379, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Monitor("mymaster", "127.0.0.1", 6380, 2); err == nil {
+		t.Fatal("expected duplicated master name to be rejected")
+	}
+	return s, s.masters["mymaster"]
+}
+
+func TestProcessHello(t *testing.T) {
+	s, m := testSentinel(t)
+	s.processHello("127.0.0.1,26380,peer1,3,mymaster,127.0.0.1,6379,0")
+	s.processHello("127.0.0.1,26381,peer2,1,other,127.0.0.1,6379,0")
+	if len(m.peers) != 1 || m.peers["peer1"].addr != "127.0.0.1:26380" || s.epoch != 3 {
+		t.Fatalf("expected one peer and epoch 3, got %d peers, epoch %d", len(m.peers), s.epoch)
+	}
+	// 同一地址上重启的 sentinel 替换旧的记录
+	s.processHello("127.0.0.1,26380,peer1b,3,mymaster,127.0.0.1,6379,0")
+	if len(m.peers) != 1 || m.peers["peer1b"] == nil {
+		t.Fatalf("expected the restarted peer to replace the old one: %v", m.peers)
+	}
+
+	// 配置纪元更大的 hello 通告新的主节点
+	s.processHello("127.0.0.1,26380,peer1b,4,mymaster,127.0.0.1,6380,4")
+	if m.inst.addr != "127.0.0.1:6380" || m.configEpoch != 4 {
+		t.Fatalf("expected switch to 127.0.0.1:6380 at epoch 4, got %s at %d", m.inst.addr, m.configEpoch)
+	}
+	if m.replicas["127.0.0.1:6379"] == nil {
+		t.Fatal("expected the old master to become a replica")
+	}
+	// 较旧的配置被忽略
+	s.processHello("127.0.0.1,26380,peer1b,4,mymaster,127.0.0.1,6379,2")
+	if m.inst.addr != "127.0.0.1:6380" {
+		t.Fatalf("stale hello switched the master to %s", m.inst.addr)
+	}
+}
+
+func TestVote(t *testing.T) {
+	s, m := testSentinel(t)
+	now := time.Now()
+	if leader, epoch := s.vote(m, "a", 1, now); leader != "a" || epoch != 1 {
+		t.Fatalf("vote = %s %d", leader, epoch)
+	}
+	// 每个纪元只投一票
+	if leader, _ := s.vote(m, "b", 1, now); leader != "a" {
+		t.Fatalf("second vote in epoch 1 went to %s", leader)
+	}
+	if leader, epoch := s.vote(m, "b", 2, now); leader != "b" || epoch != 2 || s.epoch != 2 {
+		t.Fatalf("vote in epoch 2 = %s %d", leader, epoch)
+	}
+	// 投票给其他 sentinel 后暂不自行发起故障转移
+	if m.failoverStart.Before(now) {
+		t.Fatal("expected voting for another sentinel to delay our own failover")
+	}
+
+	m.inst.added = now.Add(-time.Hour) // 主观下线
+	reply := string(s.isMasterDown("127.0.0.1", "6379", "3", "c"))
+	if !strings.HasPrefix(reply, "*3\r\n:1\r\n$1\r\nc\r\n:3\r\n") {
+		t.Fatalf("IS-MASTER-DOWN-BY-ADDR reply %q", reply)
+	}
+}
+
+func TestSelectReplica(t *testing.T) {
+	s, m := testSentinel(t)
+	now := time.Now()
+	add := func(addr string, priority int, offset int64) *instance {
+		r := s.newInstance(m, addr)
+		r.lastOK, r.infoTime, r.role, r.priority, r.offset = now, now, "slave", priority, offset
+		m.replicas[addr] = r
+		return r
+	}
+	add("127.0.0.1:7001", 100, 50)
+	best := add("127.0.0.1:7002", 100, 80)
+	add("127.0.0.1:7003", 0, 200)
+	if got := s.selectReplica(m, now); got != best {
+		t.Fatalf("expected the replica with the largest offset, got %s", got.addr)
+	}
+	preferred := add("127.0.0.1:7004", 10, 1)
+	if got := s.selectReplica(m, now); got != preferred {
+		t.Fatalf("expected the replica with the lowest priority, got %s", got.addr)
+	}
+	preferred.lastOK, preferred.added = now.Add(-time.Hour), now.Add(-time.Hour)
+	if got := s.selectReplica(m, now); got != best {
+		t.Fatalf("expected a down replica to be skipped, got %s", got.addr)
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/acl"
+	"redisx/internal/protocol"
+)
+
+const (
+	noAuthReply protocol.Error = "NOAUTH Authentication required."
+	// aclFileReply 为未配置 ACL 文件时 ACL SAVE/LOAD 的回复
+	aclFileReply protocol.Error = "ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration."
+)
+
+// startACL 在开始接受连接前加载 ACL 文件并设置默认用户的密码
+func (s *Server) startACL() error {
+	if s.ACLFile != "" {
+		if err := s.acl.Load(s.ACLFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("load acl file: %w", err)
+		}
+	}
+	if s.RequirePass != "" {
+		return s.acl.SetUser(acl.DefaultUser, "resetpass", ">"+s.RequirePass)
+	}
+	return nil
+}
+
+// auth 处理 AUTH [username] password；认证失败记入 ACL LOG
+func (s *Server) auth(c *client, args []string) protocol.Reply {
+	name := acl.DefaultUser
+	switch len(args) {
+	case 1:
+		if s.acl.Default() != nil {
+			return protocol.Error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		}
+	case 2:
+		name = args[0]
+	default:
+		return protocol.ErrSyntax
+	}
+	u, err := s.acl.Authenticate(name, args[len(args)-1])
+	if err != nil {
+		s.acl.Log(acl.ReasonAuth, s.aclContext(c), "AUTH", name, s.clientInfo(c))
+		return protocol.Error(err.Error())
+	}
+	c.user = u
+	return protocol.OK
+}
+
+// checkACL 返回连接的用户不能执行命令时的错误回复，允许执行时返回 nil。
+// 未认证的连接只能执行 AUTH 与 QUIT。
+func (s *Server) checkACL(c *client, name string, args [][]byte) protocol.Reply {
+	if c.user != nil && !s.acl.Valid(c.user) {
+		// 用户已被删除
+		c.user = nil
+	}
+	if c.user == nil {
+		if name == "QUIT" {
+			return nil
+		}
+		return noAuthReply
+	}
+	reason, object := s.acl.Check(c.user, name, args)
+	if reason == "" {
+		return nil
+	}
+	s.acl.Log(reason, s.aclContext(c), object, c.user.Name(), s.clientInfo(c))
+	if c.multi && name != "EXEC" && name != "DISCARD" {
+		// 与入队时的其他错误一样，使 EXEC 放弃事务
+		c.dirty = true
+	}
+	switch reason {
+	case acl.ReasonKey:
+		return protocol.Error("NOPERM No permissions to access a key")
+	case acl.ReasonChannel:
+		return protocol.Error("NOPERM No permissions to access a channel")
+	}
+	return protocol.Errorf("NOPERM User %s has no permissions to run the '%s' command", c.user.Name(), object)
+}
+
+func (s *Server) aclContext(c *client) string {
+	if c.multi {
+		return "multi"
+	}
+	return "toplevel"
+}
+
+// clientInfo 返回 ACL LOG 中 client-info 字段的内容
+func (s *Server) clientInfo(c *client) string {
+	user := ""
+	if c.user != nil {
+		user = c.user.Name()
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s user=%s", c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), c.name, user)
+}
+
+// aclCommand 处理 ACL 的各个子命令
+func (s *Server) aclCommand(c *client, args []string) protocol.Reply {
+	if len(args) == 0 {
+		return protocol.WrongArgs("acl")
+	}
+	sub := strings.ToUpper(args[0])
+	switch {
+	case sub == "SETUSER" && len(args) >= 2:
+		if err := s.acl.SetUser(args[1], args[2:]...); err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.OK
+	case sub == "GETUSER" && len(args) == 2:
+		info, ok := s.acl.GetUser(args[1])
+		if !ok {
+			return protocol.NullArray
+		}
+		return protocol.Map{
+			protocol.Bulk("flags"), protocol.BulkStrings(info.Flags),
+			protocol.Bulk("passwords"), protocol.BulkStrings(info.Passwords),
+			protocol.Bulk("commands"), protocol.Bulk(info.Commands),
+			protocol.Bulk("keys"), protocol.Bulk(info.Keys),
+			protocol.Bulk("channels"), protocol.Bulk(info.Channels),
+			protocol.Bulk("selectors"), protocol.EmptyArray,
+		}
+	case sub == "DELUSER" && len(args) >= 2:
+		n, err := s.acl.DelUser(args[1:]...)
+		if err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.Integer(n)
+	case sub == "LIST" && len(args) == 1:
+		return protocol.BulkStrings(s.acl.List())
+	case sub == "USERS" && len(args) == 1:
+		return protocol.BulkStrings(s.acl.Users())
+	case sub == "WHOAMI" && len(args) == 1:
+		return protocol.Bulk(c.user.Name())
+	case sub == "CAT" && len(args) <= 2:
+		if len(args) == 1 {
+			return protocol.BulkStrings(acl.Categories())
+		}
+		names, ok := acl.CategoryCommands(args[1])
+		if !ok {
+			return protocol.Errorf("ERR Unknown category '%s'", args[1])
+		}
+		return protocol.BulkStrings(names)
+	case sub == "LOG" && len(args) <= 2:
+		n := 10
+		if len(args) == 2 {
+			if strings.EqualFold(args[1], "RESET") {
+				s.acl.ResetLog()
+				return protocol.OK
+			}
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v < 0 {
+				return protocol.Error("ERR value is out of range, must be positive")
+			}
+			n = v
+		}
+		return aclLogReply(s.acl.Entries(n))
+	case (sub == "SAVE" || sub == "LOAD") && len(args) == 1:
+		if s.ACLFile == "" {
+			return aclFileReply
+		}
+		var err error
+		if sub == "SAVE" {
+			err = s.acl.Save(s.ACLFile)
+		} else {
+			err = s.acl.Load(s.ACLFile)
+		}
+		if err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.OK
+	}
+	return protocol.Errorf("ERR unknown subcommand or wrong number of arguments for '%s'. Try ACL HELP.", args[0])
+}
+
+// aclLogReply 将 ACL LOG 条目编码为数组，每个条目为字段名与值组成的 map
+func aclLogReply(entries []acl.LogEntry) protocol.Reply {
+	now := time.Now()
+	out := make(protocol.Array, len(entries))
+	for i, e := range entries {
+		out[i] = protocol.Map{
+			protocol.Bulk("count"), protocol.Integer(e.Count),
+			protocol.Bulk("reason"), protocol.Bulk(e.Reason),
+			protocol.Bulk("context"), protocol.Bulk(e.Context),
+			protocol.Bulk("object"), protocol.Bulk(e.Object),
+			protocol.Bulk("username"), protocol.Bulk(e.Username),
+			protocol.Bulk("age-seconds"), protocol.Bulk(strconv.FormatFloat(now.Sub(e.Created).Seconds(), 'f', 3, 64)),
+			protocol.Bulk("client-info"), protocol.Bulk(e.ClientInfo),
+			protocol.Bulk("entry-id"), protocol.Integer(e.ID),
+			protocol.Bulk("timestamp-created"), protocol.Integer(e.Created.UnixMilli()),
+			protocol.Bulk("timestamp-last-updated"), protocol.Integer(e.Updated.UnixMilli()),
+		}
+	}
+	return out
+}
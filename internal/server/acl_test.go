@@ -0,0 +1,157 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"redisx/internal/acl"
+	"redisx/internal/protocol"
+)
+
+// startACLServer 启动不加载快照的服务器
+func startACLServer(t *testing.T, requirePass, aclFile string) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	s.RequirePass = requirePass
+	s.ACLFile = aclFile
+	startConfigured(t, s)
+	t.Cleanup(func() { s.ln.Close() })
+	return s
+}
+
+func TestAuthRequirePass(t *testing.T) {
+	s := startACLServer(t, "secret", "")
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "-NOAUTH Authentication required.", "GET", "k")
+	expectLine(t, conn, r, "-NOAUTH Authentication required.", "MULTI")
+	expectLine(t, conn, r, "-WRONGPASS invalid username-password pair or user is disabled.", "AUTH", "wrong")
+	expectLine(t, conn, r, "+OK", "AUTH", "secret")
+	expectLine(t, conn, r, "+OK", "SET", "k", "v")
+	expectLine(t, conn, r, "$7", "ACL", "WHOAMI")
+	expectLine(t, conn, r, "default")
+
+	// 用户名与密码认证
+	expectLine(t, conn, r, "+OK", "ACL", "SETUSER", "alice", "on", ">pw", "~k", "+get")
+	conn2, r2 := dialServer(t, s)
+	defer conn2.Close()
+	expectLine(t, conn2, r2, "+OK", "AUTH", "alice", "pw")
+	expectLine(t, conn2, r2, "$1", "GET", "k")
+	expectLine(t, conn2, r2, "v")
+
+	// 删除用户后连接需重新认证
+	expectLine(t, conn, r, ":1", "ACL", "DELUSER", "alice")
+	expectLine(t, conn2, r2, "-NOAUTH Authentication required.", "GET", "k")
+}
+
+func TestACLPermissions(t *testing.T) {
+	s := startACLServer(t, "", "")
+	admin, ar := dialServer(t, s)
+	defer admin.Close()
+	expectLine(t, admin, ar, "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?", "AUTH", "x")
+	expectLine(t, admin, ar, "+OK", "ACL", "SETUSER", "bob", "on", "nopass", "~cache:*", "&news", "+@all", "-@dangerous", "-del")
+	expectLine(t, admin, ar, "-ERR Error in ACL SETUSER modifier '+@nosuch': Unknown command or category name in ACL",
+		"ACL", "SETUSER", "bob", "+@nosuch")
+	expectLine(t, admin, ar, "-ERR wrong number of arguments for 'acl' command", "ACL")
+	if resp := s.aclCommand(nil, nil); resp != protocol.WrongArgs("acl") {
+		t.Fatalf("ACL without a subcommand: %v", resp)
+	}
+
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "AUTH", "bob", "anything")
+	expectLine(t, conn, r, "+OK", "SET", "cache:1", "v")
+	expectLine(t, conn, r, "-NOPERM No permissions to access a key", "GET", "other")
+	expectLine(t, conn, r, "-NOPERM User bob has no permissions to run the 'del' command", "DEL", "cache:1")
+	expectLine(t, conn, r, "-NOPERM User bob has no permissions to run the 'info' command", "INFO")
+	expectLine(t, conn, r, ":0", "PUBLISH", "news", "m")
+	expectLine(t, conn, r, "-NOPERM No permissions to access a channel", "PUBLISH", "sports", "m")
+
+	// 事务中被拒绝的命令使 EXEC 放弃事务
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "-NOPERM No permissions to access a key", "SET", "other", "v")
+	expectLine(t, conn, r, "-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+
+	expectLine(t, admin, ar, "*2", "ACL", "LOG", "2")
+	expectLine(t, admin, ar, "*20")
+	expectLine(t, admin, ar, "$5")
+	expectLine(t, admin, ar, "count")
+	expectLine(t, admin, ar, ":1")
+	expectLine(t, admin, ar, "$6")
+	expectLine(t, admin, ar, "reason")
+	expectLine(t, admin, ar, "$3")
+	expectLine(t, admin, ar, "key")
+	expectLine(t, admin, ar, "$7")
+	expectLine(t, admin, ar, "context")
+	expectLine(t, admin, ar, "$5")
+	expectLine(t, admin, ar, "multi")
+}
+
+func TestACLSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.acl")
+	hash := "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8" // sha256("password")
+	if err := os.WriteFile(path, []byte("user carol on #"+hash+" ~* &* +@read\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := startACLServer(t, "", path)
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "*2", "ACL", "USERS")
+	expectLine(t, conn, r, "$5")
+	expectLine(t, conn, r, "carol")
+	expectLine(t, conn, r, "$7")
+	expectLine(t, conn, r, "default")
+
+	expectLine(t, conn, r, "+OK", "ACL", "SETUSER", "dave", "on", ">pw", "+ping")
+	expectLine(t, conn, r, "+OK", "ACL", "SAVE")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "user dave on #") || !strings.Contains(string(data), "user carol on #"+hash) {
+		t.Fatalf("acl file:\n%s", data)
+	}
+
+	// LOAD 以文件内容替换当前用户
+	expectLine(t, conn, r, "+OK", "ACL", "SETUSER", "erin", "on")
+	expectLine(t, conn, r, "+OK", "ACL", "LOAD")
+	expectLine(t, conn, r, "*-1", "ACL", "GETUSER", "erin")
+	auth, ar := dialServer(t, s)
+	defer auth.Close()
+	expectLine(t, auth, ar, "+OK", "AUTH", "carol", "password")
+	expectLine(t, auth, ar, "$-1", "GET", "k")
+	expectLine(t, auth, ar, "-NOPERM User carol has no permissions to run the 'set' command", "SET", "k", "v")
+}
+
+// TestACLSetUserWhileConnected 在连接使用用户时并发修改该用户，由 -race 检查
+func TestACLSetUserWhileConnected(t *testing.T) {
+	s := startACLServer(t, "", "")
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "ACL", "SETUSER", "bob", "on", "nopass", "+get")
+	expectLine(t, conn, r, "+OK", "AUTH", "bob", "x")
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			s.acl.SetUser("bob", "~k")
+			s.acl.SetUser(acl.DefaultUser, "nopass")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		expectLine(t, conn, r, "-NOPERM User bob has no permissions to run the 'set' command", "SET", "k", "v")
+		expectLine(t, conn, r, "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?", "AUTH", "x")
+	}
+	close(stop)
+	<-done
+	expectLine(t, conn, r, "$-1", "GET", "k")
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"redisx/internal/aof"
+	"redisx/internal/protocol"
+)
+
+// defaultAppendFilename 为默认的 AOF 路径（相对于工作目录）
+const defaultAppendFilename = "redisx.aof"
+
+// aofState 记录 AOF 重写的状态，供 INFO 使用
+type aofState struct {
+	// rewriteRequested 表示 BGREWRITEAOF 已被接受、待当前命令写入 AOF 后开始；
+	// 只在 Exclusive 中访问
+	rewriteRequested bool
+
+	mu           sync.Mutex
+	rewriteStart time.Time // 当前重写的开始时间
+	lastStatus   string    // 最近一次重写的结果（ok/err）
+}
+
+// loadData 在启动时恢复数据并打开 AOF：开启 AOF 且文件存在时从 AOF 重放，否则
+// 加载快照。AOF 不存在时以当前数据集（可能来自快照）创建，之后的重启可只依赖 AOF。
+func (s *Server) loadData() error {
+	if !s.AppendOnly {
+		return s.loadSnapshot()
+	}
+	policy, err := aof.ParseFsyncPolicy(s.AppendFsync)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(s.AppendFilename)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if exists {
+		err = s.loadAOF()
+	} else {
+		err = s.loadSnapshot()
+	}
+	if err != nil {
+		return err
+	}
+	l, err := aof.Open(s.AppendFilename, policy)
+	if err != nil {
+		return err
+	}
+	if !exists && s.store.Count() > 0 {
+		if err := l.BeginRewrite(); err != nil {
+			l.Close()
+			return err
+		}
+		sn := s.store.Snapshot()
+		err := l.Rewrite(sn)
+		sn.Release()
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("create AOF %s: %w", s.AppendFilename, err)
+		}
+	}
+	s.aof = l
+	s.store.EnablePropagation()
+	return nil
+}
+
+// loadAOF 重放 AOF；末尾不完整时截掉残缺部分后继续启动
+func (s *Server) loadAOF() error {
+	f, err := os.Open(s.AppendFilename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	n, valid, err := aof.Load(f, s.store, func(cmd string, args []string) error {
+		if _, handled, err := s.router.Handle(cmd, s.store, protocol.Args(args)); !handled {
+			return fmt.Errorf("unknown command '%s' in AOF", cmd)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, aof.ErrTruncated) {
+		log.Printf("AOF %s ends with an incomplete command, truncating it to %d bytes", s.AppendFilename, valid)
+		err = os.Truncate(s.AppendFilename, valid)
+	}
+	if err != nil {
+		return fmt.Errorf("load AOF %s: %w", s.AppendFilename, err)
+	}
+	s.snap.mu.Lock()
+	s.snap.changes = s.store.Changes()
+	s.snap.mu.Unlock()
+	log.Printf("replayed %d commands from %s in %v", n, s.AppendFilename, time.Since(start))
+	return nil
+}
+
+// misconfReply 在 AOF 写入失败时拒绝写命令，避免确认无法持久化的写入
+func (s *Server) misconfReply() protocol.Reply {
+	if s.aof == nil {
+		return nil
+	}
+	if err := s.aof.Err(); err != nil {
+		return protocol.Errorf("MISCONF Errors writing to the AOF file: %v", err)
+	}
+	return nil
+}
+
+// feedAOF 追加 cmds，然后开始被请求的重写。调用方需在 Exclusive 中调用。
+func (s *Server) feedAOF(cmds [][]string) {
+	if err := s.aof.Append(cmds...); err != nil {
+		log.Printf("AOF write failed: %v", err)
+	}
+	if s.aofState.rewriteRequested {
+		s.aofState.rewriteRequested = false
+		s.startRewrite()
+	}
+}
+
+// bgrewriteaof 实现 BGREWRITEAOF：重写在当前命令（或事务）写入 AOF 之后开始，
+// 保证快照与日志位置一致。调用方需在 Exclusive 中调用。
+func (s *Server) bgrewriteaof() protocol.Reply {
+	if s.aof == nil {
+		return protocol.Error("ERR append only file is disabled")
+	}
+	if s.aofState.rewriteRequested || s.aof.Rewriting() {
+		return protocol.Errorf("ERR %v", aof.ErrRewriteInProgress)
+	}
+	s.aofState.rewriteRequested = true
+	return protocol.SimpleString("Background append only file rewriting started")
+}
+
+// startRewrite 取得快照并在后台重写 AOF；调用方需在 Exclusive 中调用
+func (s *Server) startRewrite() {
+	if err := s.aof.BeginRewrite(); err != nil {
+		log.Printf("AOF rewrite: %v", err)
+		return
+	}
+	sn := s.store.Snapshot()
+	s.aofState.mu.Lock()
+	s.aofState.rewriteStart = time.Now()
+	s.aofState.mu.Unlock()
+	go func() {
+		err := s.aof.Rewrite(sn)
+		sn.Release()
+		s.aofState.mu.Lock()
+		defer s.aofState.mu.Unlock()
+		s.aofState.rewriteStart = time.Time{}
+		s.aofState.lastStatus = "ok"
+		if err != nil {
+			s.aofState.lastStatus = "err"
+			log.Printf("background AOF rewrite failed: %v", err)
+		}
+	}()
+}
+
+// aofInfo 返回 INFO Persistence 段中的 AOF 字段
+func (s *Server) aofInfo() string {
+	if s.aof == nil {
+		return "aof_enabled:0\r\n"
+	}
+	current, base := s.aof.Size()
+	writeStatus := "ok"
+	if s.aof.Err() != nil {
+		writeStatus = "err"
+	}
+	s.aofState.mu.Lock()
+	defer s.aofState.mu.Unlock()
+	inProgress := 0
+	if !s.aofState.rewriteStart.IsZero() {
+		inProgress = 1
+	}
+	status := s.aofState.lastStatus
+	if status == "" {
+		status = "ok"
+	}
+	return fmt.Sprintf("aof_enabled:1\r\naof_rewrite_in_progress:%d\r\naof_last_bgrewrite_status:%s\r\naof_last_write_status:%s\r\naof_current_size:%d\r\naof_base_size:%d\r\n",
+		inProgress, status, writeStatus, current, base)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startServerWithAOF(t *testing.T, dir, fsync string) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath = filepath.Join(dir, "dump.snap")
+	s.AppendOnly = true
+	s.AppendFilename = filepath.Join(dir, "appendonly.aof")
+	s.AppendFsync = fsync
+	return startConfigured(t, s)
+}
+
+func dialServer(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+func TestAOFReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := startServerWithAOF(t, dir, "always")
+	conn, r := dialServer(t, s)
+	expectLine(t, conn, r, "+OK", "SET", "k", "v", "EX", "100")
+	expectLine(t, conn, r, "+OK", "SET", "gone", "v", "PX", "100")
+	expectLine(t, conn, r, ":1", "INCR", "n")
+	expectLine(t, conn, r, ":2", "INCR", "n")
+	expectLine(t, conn, r, ":1", "PEXPIRE", "n", "60000")
+	expectLine(t, conn, r, ":3", "SADD", "s", "a", "b", "c")
+	writeReq(conn, "SPOP", "s")
+	readLine(r)
+	readLine(r)
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "RPUSH", "l", "x", "y")
+	expectLine(t, conn, r, "+QUEUED", "LPOP", "l")
+	expectLine(t, conn, r, "*2", "EXEC")
+	expectLine(t, conn, r, ":2")
+	expectLine(t, conn, r, "$1")
+	expectLine(t, conn, r, "x")
+	writeReq(conn, "XADD", "st", "*", "f", "v")
+	readBulk(r)
+	ttlBefore := s.store.PExpireTime("k")
+
+	// BLPOP 被另一连接的 RPUSH 唤醒，弹出记录为 LPOP
+	blocked, br := dialServer(t, s)
+	defer blocked.Close()
+	writeReq(blocked, "BLPOP", "q", "0")
+	waitBlockedClients(t, s, 1)
+	expectLine(t, conn, r, ":2", "RPUSH", "q", "a", "b")
+	expectLine(t, blocked, br, "*2")
+	conn.Close()
+	s.ln.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	s2 := startServerWithAOF(t, dir, "always")
+	defer s2.ln.Close()
+	if v, _ := s2.store.Get("k"); string(v) != "v" {
+		t.Fatalf("expected k to be restored, got %q", v)
+	}
+	if got := s2.store.PExpireTime("k"); got != ttlBefore {
+		t.Fatalf("expected absolute expiry %d, got %d", ttlBefore, got)
+	}
+	if s2.store.Exists("gone") {
+		t.Fatal("expired key should not be restored")
+	}
+	if v, _ := s2.store.Get("n"); string(v) != "2" || s2.store.PTTL("n") <= 0 {
+		t.Fatalf("unexpected counter %q ttl %d", v, s2.store.PTTL("n"))
+	}
+	if n, _ := s2.store.SCard("s"); n != 2 {
+		t.Fatalf("expected SPOP to be replayed, got %d members", n)
+	}
+	if l, _ := s2.store.LRange("l", 0, -1); len(l) != 1 || l[0] != "y" {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if l, _ := s2.store.LRange("q", 0, -1); len(l) != 1 || l[0] != "b" {
+		t.Fatalf("expected the served BLPOP to be replayed, got %v", l)
+	}
+	if n, _ := s2.store.XLen("st"); n != 1 {
+		t.Fatalf("expected stream entry, got %d", n)
+	}
+}
+
+func TestAOFTruncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	s := startServerWithAOF(t, dir, "always")
+	conn, r := dialServer(t, s)
+	expectLine(t, conn, r, "+OK", "SET", "a", "1")
+	expectLine(t, conn, r, "+OK", "SET", "b", "2")
+	conn.Close()
+	s.ln.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	path := filepath.Join(dir, "appendonly.aof")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nc\r\n$1")
+	f.Close()
+
+	s2 := startServerWithAOF(t, dir, "everysec")
+	defer s2.ln.Close()
+	if v, _ := s2.store.Get("b"); string(v) != "2" || s2.store.Exists("c") {
+		t.Fatalf("unexpected data after loading a truncated AOF: b=%q", v)
+	}
+	if fi2, _ := os.Stat(path); fi2.Size() != fi.Size() {
+		t.Fatalf("expected the incomplete tail to be truncated: %d vs %d", fi2.Size(), fi.Size())
+	}
+}
+
+func TestBgrewriteaof(t *testing.T) {
+	dir := t.TempDir()
+	s := startServerWithAOF(t, dir, "everysec")
+	conn, r := dialServer(t, s)
+	for i := 0; i < 50; i++ {
+		expectLine(t, conn, r, ":"+strconv.Itoa(i+1), "INCR", "counter")
+	}
+	expectLine(t, conn, r, "+OK", "SET", "k", "v", "EX", "100")
+	before := infoField(t, conn, r, "aof_current_size")
+
+	expectLine(t, conn, r, "+Background append only file rewriting started", "BGREWRITEAOF")
+	// 重写期间的写入追加在重写后的文件中
+	expectLine(t, conn, r, "+OK", "SET", "after", "x")
+	deadline := time.Now().Add(5 * time.Second)
+	for infoField(t, conn, r, "aof_rewrite_in_progress") != "0" {
+		if time.Now().After(deadline) {
+			t.Fatal("rewrite did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := infoField(t, conn, r, "aof_last_bgrewrite_status"); got != "ok" {
+		t.Fatalf("expected rewrite status ok, got %s", got)
+	}
+	after := infoField(t, conn, r, "aof_current_size")
+	if a, _ := strconv.Atoi(after); a >= mustAtoi(t, before) {
+		t.Fatalf("expected rewrite to shrink the AOF: %s -> %s", before, after)
+	}
+	expectLine(t, conn, r, ":51", "INCR", "counter")
+	conn.Close()
+	s.ln.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	data, err := os.ReadFile(filepath.Join(dir, "appendonly.aof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "REDISX") {
+		t.Fatal("expected the rewritten AOF to start with a snapshot preamble")
+	}
+	s2 := startServerWithAOF(t, dir, "everysec")
+	defer s2.ln.Close()
+	if v, _ := s2.store.Get("counter"); string(v) != "51" {
+		t.Fatalf("expected counter 51, got %q", v)
+	}
+	if v, _ := s2.store.Get("after"); string(v) != "x" {
+		t.Fatalf("expected write during rewrite to be kept, got %q", v)
+	}
+	if s2.store.PTTL("k") <= 0 {
+		t.Fatal("expected TTL to survive the rewrite")
+	}
+}
+
+func mustAtoi(t *testing.T, s string) int {
+	t.Helper()
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
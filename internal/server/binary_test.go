@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"redisx/internal/protocol"
+)
+
+// inlineQuote 将参数写为 inline 命令中的双引号参数，不可打印的字节以及引号、
+// 反斜杠以 \xHH 转义
+func inlineQuote(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range b {
+		if c < ' ' || c > '~' || c == '"' || c == '\\' {
+			fmt.Fprintf(&sb, "\\x%02x", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// maxInlineLen 为服务器接受的 inline 请求长度上限
+const maxInlineLen = 64 << 10
+
+// roundTrip 以 RESP 与 inline 两种请求写入键值，检查 GET 与 MGET 原样返回
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, key, value []byte) {
+	t.Helper()
+	req := pipeline([]string{"SET", string(key), string(value)}, []string{"GET", string(key)}, []string{"MGET", string(key), string(key)})
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, conn, r, "+OK")
+	if got, err := readBulk(r); err != nil || got != string(value) {
+		t.Fatalf("GET %q: got %q, want %q (%v)", key, got, value, err)
+	}
+	expectLine(t, conn, r, "*2")
+	for i := 0; i < 2; i++ {
+		if got, err := readBulk(r); err != nil || got != string(value) {
+			t.Fatalf("MGET %q: got %q, want %q (%v)", key, got, value, err)
+		}
+	}
+
+	// inline 请求中转义的二进制参数
+	inlineKey := append([]byte("inline:"), key...)
+	line := "SET " + inlineQuote(inlineKey) + " " + inlineQuote(value) + "\r\n"
+	if len(line) > maxInlineLen {
+		// 服务器拒绝超长的 inline 请求，这样的值只能以 RESP 写入
+		return
+	}
+	if _, err := io.WriteString(conn, line); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, conn, r, "+OK")
+	writeReq(conn, "GET", string(inlineKey))
+	if got, err := readBulk(r); err != nil || got != string(value) {
+		t.Fatalf("inline SET %q: got %q, want %q (%v)", inlineKey, got, value, err)
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	for _, tt := range []struct{ key, value string }{
+		{"k", "a\r\nb\r\n"},
+		{"\x00", "\x00\x00v\x00"},
+		{"*1\r\n$4\r\nPING\r\n", "$-1\r\n"},
+		{"", ""},
+		{"\xff\xfe", "\x80\r\x00\n"},
+		{"k", strings.Repeat("\r\n\x00", 30000)},
+	} {
+		roundTrip(t, conn, r, []byte(tt.key), []byte(tt.value))
+	}
+
+	// 大值由存储直接取自解析器，之后的请求不会改变它
+	big := strings.Repeat("\x00big\r\n", protocol.BigArgLen/6+1)
+	roundTrip(t, conn, r, []byte("big"), []byte(big))
+	roundTrip(t, conn, r, []byte("next"), []byte(strings.Repeat("x", len(big))))
+	writeReq(conn, "GET", "big")
+	if got, err := readBulk(r); err != nil || got != big {
+		t.Fatalf("big value changed after later requests (%v)", err)
+	}
+
+	// inline 请求中的大值同样不会被之后的请求覆盖
+	inline := strings.Repeat("i", protocol.BigArgLen+1)
+	fmt.Fprintf(conn, "SET inline-big %s\r\n", inline)
+	expectLine(t, conn, r, "+OK")
+	fmt.Fprintf(conn, "SET other %s\r\n", strings.Repeat("o", protocol.BigArgLen+1))
+	expectLine(t, conn, r, "+OK")
+	writeReq(conn, "GET", "inline-big")
+	if got, err := readBulk(r); err != nil || got != inline {
+		t.Fatalf("inline big value changed after a later request (%v)", err)
+	}
+}
+
+func FuzzBinaryRoundTrip(f *testing.F) {
+	f.Add([]byte("key"), []byte("value"))
+	s := startServer(f)
+	defer s.ln.Close()
+	addr := s.ln.Addr().String()
+	f.Fuzz(func(t *testing.T, key, value []byte) {
+		// 每个输入使用独立连接，失败时残留的回复不会错位到后续输入
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		roundTrip(t, conn, bufio.NewReader(conn), key, value)
+	})
+}
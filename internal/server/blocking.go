@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// connWatcher 在阻塞命令执行期间监听连接：连接断开或 ConnTimeout 触发时关闭
+// cancel，使存储层撤销等待并清理 waiter。
+type connWatcher struct {
+	conn    net.Conn
+	cancel  chan struct{}
+	done    chan struct{}
+	stopped int32
+	err     error
+}
+
+// watchConn 启动一个 goroutine 在 reader 上 Peek，以发现连接关闭或读超时。
+// 客户端在阻塞期间继续发送（pipeline）的数据不会被消费。
+func watchConn(conn net.Conn, r *bufio.Reader) *connWatcher {
+	w := &connWatcher{conn: conn, cancel: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		if _, err := r.Peek(1); err != nil && atomic.LoadInt32(&w.stopped) == 0 {
+			w.err = err
+			close(w.cancel)
+		}
+	}()
+	return w
+}
+
+// stop 结束监听并等待 goroutine 退出，之后 reader 可以安全地继续使用。
+// 返回非 nil 表示阻塞期间连接已断开或超时。
+func (w *connWatcher) stop() error {
+	atomic.StoreInt32(&w.stopped, 1)
+	select {
+	case <-w.done:
+	default:
+		// 通过读超时唤醒仍阻塞在 Peek 上的 goroutine，随后恢复无读超时状态
+		_ = w.conn.SetReadDeadline(time.Now())
+		<-w.done
+		_ = w.conn.SetReadDeadline(time.Time{})
+	}
+	return w.err
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func waitBlockedClients(t *testing.T, s *Server, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s.store.BlockedClients() == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d blocked clients, got %d", n, s.store.BlockedClients())
+}
+
+func TestBLPopWokenByPush(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+
+	waiter, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer waiter.Close()
+	wr := bufio.NewReader(waiter)
+	if err := writeReq(waiter, "BLPOP", "jobs", "0"); err != nil {
+		t.Fatalf("write blpop: %v", err)
+	}
+	waitBlockedClients(t, s, 1)
+
+	pusher, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer pusher.Close()
+	pr := bufio.NewReader(pusher)
+	if err := writeReq(pusher, "RPUSH", "jobs", "j1"); err != nil {
+		t.Fatalf("write rpush: %v", err)
+	}
+	if line, _ := readLine(pr); line != ":1\r\n" {
+		t.Fatalf("expected :1, got %q", line)
+	}
+
+	if line, _ := readLine(wr); line != "*2\r\n" {
+		t.Fatalf("expected array reply, got %q", line)
+	}
+	key, _ := readBulk(wr)
+	val, _ := readBulk(wr)
+	if key != "jobs" || val != "j1" {
+		t.Fatalf("expected jobs/j1, got %q/%q", key, val)
+	}
+
+	// 阻塞结束后连接可继续使用
+	if err := writeReq(waiter, "PING"); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	if line, _ := readLine(wr); line != "+PONG\r\n" {
+		t.Fatalf("expected +PONG, got %q", line)
+	}
+}
+
+func TestBLPopFractionalTimeout(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	start := time.Now()
+	if err := writeReq(conn, "BRPOP", "nothing", "0.1"); err != nil {
+		t.Fatalf("write brpop: %v", err)
+	}
+	if line, _ := readLine(r); line != "*-1\r\n" {
+		t.Fatalf("expected null array, got %q", line)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond || d > time.Second {
+		t.Fatalf("unexpected timeout duration %v", d)
+	}
+}
+
+func TestBLPopCleanupOnDisconnect(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := writeReq(conn, "BLPOP", "q", "0"); err != nil {
+		t.Fatalf("write blpop: %v", err)
+	}
+	waitBlockedClients(t, s, 1)
+	conn.Close()
+	waitBlockedClients(t, s, 0)
+
+	// 断开的客户端不应再消费元素
+	s.store.RPush("q", []string{"v"})
+	if n, _ := s.store.LLen("q"); n != 1 {
+		t.Fatalf("expected element to remain, got len %d", n)
+	}
+}
+
+func TestBLPopConnTimeout(t *testing.T) {
+	s := startServerWithConfig(t, 0, 200*time.Millisecond, 0)
+	defer s.ln.Close()
+
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if err := writeReq(conn, "BLPOP", "q", "0"); err != nil {
+		t.Fatalf("write blpop: %v", err)
+	}
+	line, _ := readLine(r)
+	if line != "-ERR connection timeout\r\n" {
+		t.Fatalf("expected connection timeout, got %q", line)
+	}
+	waitBlockedClients(t, s, 0)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net"
+
+	"redisx/internal/acl"
+	"redisx/internal/protocol"
+	"redisx/internal/pubsub"
+	"redisx/internal/storage"
+)
+
+// client 保存单个连接的会话状态
+type client struct {
+	conn net.Conn
+	// out 缓冲写往连接的回复，其 Proto 为协商的协议版本（protocol.RESP2 或 RESP3）
+	out *protocol.Writer
+	// id 为连接的唯一编号，name 为 HELLO SETNAME 设置的名称
+	id   uint64
+	name string
+	// user 为连接认证的 ACL 用户，nil 表示尚未认证
+	user *acl.User
+	// sub 非 nil 表示处于订阅模式：推送消息与命令回复都经由其有界输出队列写出，
+	// 以保证两者的顺序
+	sub *pubsub.Subscriber
+
+	// 事务状态：multi 表示处于 MULTI 中，dirty 表示入队时出现过错误
+	multi   bool
+	dirty   bool
+	queue   []queuedCommand
+	watched []storage.WatchToken
+
+	// replPort 为副本通过 REPLCONF listening-port 告知的端口
+	replPort int
+	// woff 为本连接最后一次写命令之后的复制偏移，WAIT 等待副本确认到该偏移
+	woff int64
+
+	// 集群模式：asking 表示上一条命令为 ASKING，multiSlot 为事务中已入队命令的键
+	// 所在的槽（-1 表示尚无）
+	asking    bool
+	multiSlot int
+}
+
+// outputFlushThreshold 为输出缓冲区的刷出阈值：pipeline 的回复累积到该大小时
+// 立即写出，不等读完客户端已发送的命令
+const outputFlushThreshold = 16 << 10
+
+// write 按连接协商的协议向客户端输出回复。回复先写入输出缓冲区，由 handleConn
+// 在读完已到达的命令后（或缓冲超过阈值时）一次写出。
+func (c *client) write(r protocol.Reply) {
+	if c.sub != nil {
+		c.sub.Send(protocol.Encode(r, c.out.Proto))
+		return
+	}
+	c.out.Encode(r)
+	if c.out.Buffered() >= outputFlushThreshold {
+		c.out.Flush()
+	}
+}
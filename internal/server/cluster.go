@@ -0,0 +1,296 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/cluster"
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+)
+
+const defaultClusterNodeTimeout = 15 * time.Second
+
+// clusterGossipPeriod 为与其他节点交换 CLUSTER NODES 的间隔
+var clusterGossipPeriod = time.Second
+
+const (
+	clusterDisabledReply protocol.Error = "ERR This instance has cluster support disabled"
+	crossSlotReply       protocol.Error = "CROSSSLOT Keys in request don't hash to the same slot"
+	invalidSlotReply     protocol.Error = "ERR Invalid or out of range slot"
+)
+
+// startCluster 初始化集群状态：本节点地址取自 TCP 监听地址（未指定主机时先使用
+// 127.0.0.1，与其他节点通信后改为对方所见的地址），并按槽索引键。其他节点须通过
+// TCP 访问本节点，只监听 Unix 套接字时返回错误
+func (s *Server) startCluster() error {
+	addr, ok := s.tcpAddr()
+	if !ok {
+		return errors.New("cluster mode requires a TCP listener")
+	}
+	host := "127.0.0.1"
+	if !addr.IP.IsUnspecified() {
+		host = addr.IP.String()
+	}
+	s.cluster = cluster.New(host, addr.Port, s.ClusterNodeTimeout)
+	s.store.EnableSlotIndex(cluster.Slots, cluster.KeySlot)
+	go s.clusterGossip()
+	return nil
+}
+
+// clusterGossip 定期与其他节点交换信息，直到服务器关闭
+func (s *Server) clusterGossip() {
+	tick := time.NewTicker(clusterGossipPeriod)
+	defer tick.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-tick.C:
+		}
+		for _, p := range s.cluster.Peers() {
+			if err := s.gossipWith(p); err != nil {
+				s.cluster.Unreachable(p.ID)
+			}
+		}
+	}
+}
+
+// gossipWith 读取对端的 CLUSTER NODES 并合并；对端尚不认识本节点时向其发送
+// CLUSTER MEET
+func (s *Server) gossipWith(p cluster.Peer) error {
+	conn, err := protocol.Dial(p.Addr, s.ClusterNodeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reply, err := conn.Do("CLUSTER", "NODES")
+	if err != nil {
+		return err
+	}
+	nodes, ok := reply.(string)
+	if !ok {
+		return fmt.Errorf("unexpected CLUSTER NODES reply %v", reply)
+	}
+	addr, ok := s.tcpAddr()
+	local, lok := conn.LocalAddr().(*net.TCPAddr)
+	if !ok || !lok {
+		return errors.New("cluster: no TCP address to announce")
+	}
+	if addr.IP.IsUnspecified() {
+		s.cluster.SetMyHost(local.IP.String())
+	}
+	knowsMe, err := s.cluster.Merge(p.ID, nodes)
+	if err != nil || knowsMe {
+		return err
+	}
+	// 对端拒绝 MEET 时下一轮再试，不视为对端不可达
+	if _, err := conn.Do("CLUSTER", "MEET", local.IP.String(), strconv.Itoa(addr.Port)); err != nil {
+		if _, ok := err.(protocol.ReplyError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterRedirect 检查命令访问的键是否由本节点服务，返回应回复给客户端的
+// MOVED/ASK/CROSSSLOT 等错误；nil 表示在本节点执行。MULTI 中入队的命令还要求
+// 与事务中此前的键属于同一个槽。
+func (s *Server) clusterRedirect(c *client, name string, args []string) protocol.Reply {
+	// RESTORE-ASKING 为 MIGRATE 发往导入方的命令，自带 ASKING 语义
+	asking := c.asking || strings.EqualFold(name, "RESTORE-ASKING")
+	keys := command.Keys(name, args)
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := cluster.KeySlot(keys[0])
+	for _, k := range keys[1:] {
+		if cluster.KeySlot(k) != slot {
+			return crossSlotReply
+		}
+	}
+	if c.multi {
+		if c.multiSlot >= 0 && c.multiSlot != slot {
+			return crossSlotReply
+		}
+		c.multiSlot = slot
+	}
+	if !s.cluster.OK() {
+		return protocol.Error("CLUSTERDOWN The cluster is down")
+	}
+	info := s.cluster.Slot(slot)
+	// 迁移中的槽：键已不在本节点时由导入方（带 ASKING）服务；多键命令只有部分
+	// 键存在时无法在任何一方执行，客户端需稍后重试
+	missing := 0
+	if (info.Mine && info.Migrating != "") || (info.Importing && asking) {
+		for _, k := range keys {
+			if !s.store.Exists(k) {
+				missing++
+			}
+		}
+		if missing > 0 && missing < len(keys) {
+			return protocol.Error("TRYAGAIN Multiple keys request during rehashing of slot")
+		}
+	}
+	switch {
+	case info.Mine && info.Migrating != "" && missing > 0:
+		return protocol.Errorf("ASK %d %s", slot, info.Migrating)
+	case info.Mine || (info.Importing && asking):
+		return nil
+	case info.Owner == "":
+		return protocol.Error("CLUSTERDOWN Hash slot not served")
+	}
+	return protocol.Errorf("MOVED %d %s", slot, info.Owner)
+}
+
+// parseSlot 解析槽号
+func parseSlot(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 0 && n < cluster.Slots
+}
+
+// clusterCommand 实现 CLUSTER 子命令
+func (s *Server) clusterCommand(args []string) protocol.Reply {
+	if s.cluster == nil {
+		return clusterDisabledReply
+	}
+	if len(args) == 0 {
+		return protocol.WrongArgs("cluster")
+	}
+	switch sub := strings.ToUpper(args[0]); {
+	case sub == "INFO" && len(args) == 1:
+		return protocol.Verbatim(s.cluster.Info())
+	case sub == "MYID" && len(args) == 1:
+		return protocol.Bulk(s.cluster.MyID())
+	case sub == "NODES" && len(args) == 1:
+		return protocol.Verbatim(s.cluster.Nodes())
+	case sub == "SLOTS" && len(args) == 1:
+		ranges := s.cluster.SlotRanges()
+		out := make(protocol.Array, len(ranges))
+		for i, r := range ranges {
+			out[i] = protocol.Array{
+				protocol.Integer(r.Start),
+				protocol.Integer(r.End),
+				protocol.Array{protocol.Bulk(r.Host), protocol.Integer(r.Port), protocol.Bulk(r.ID)},
+			}
+		}
+		return out
+	case sub == "SHARDS" && len(args) == 1:
+		shards := s.cluster.Shards()
+		out := make(protocol.Array, len(shards))
+		for i, sh := range shards {
+			slots := make(protocol.Array, 0, 2*len(sh.Ranges))
+			for _, r := range sh.Ranges {
+				slots = append(slots, protocol.Integer(r[0]), protocol.Integer(r[1]))
+			}
+			health := "online"
+			if !sh.Online {
+				health = "fail"
+			}
+			node := protocol.Map{
+				protocol.Bulk("id"), protocol.Bulk(sh.ID),
+				protocol.Bulk("port"), protocol.Integer(sh.Port),
+				protocol.Bulk("ip"), protocol.Bulk(sh.Host),
+				protocol.Bulk("endpoint"), protocol.Bulk(sh.Host),
+				protocol.Bulk("role"), protocol.Bulk("master"),
+				protocol.Bulk("health"), protocol.Bulk(health),
+			}
+			out[i] = protocol.Map{protocol.Bulk("slots"), slots, protocol.Bulk("nodes"), protocol.Array{node}}
+		}
+		return out
+	case sub == "KEYSLOT" && len(args) == 2:
+		return protocol.Integer(cluster.KeySlot(args[1]))
+	case sub == "COUNTKEYSINSLOT" && len(args) == 2:
+		slot, ok := parseSlot(args[1])
+		if !ok {
+			return protocol.Error("ERR Invalid slot")
+		}
+		return protocol.Integer(s.store.CountKeysInSlot(slot))
+	case sub == "GETKEYSINSLOT" && len(args) == 3:
+		slot, ok := parseSlot(args[1])
+		count, err := strconv.Atoi(args[2])
+		if !ok || err != nil || count < 0 {
+			return protocol.Error("ERR Invalid slot or number of keys")
+		}
+		return protocol.BulkStrings(s.store.KeysInSlot(slot, count))
+	case sub == "MEET" && len(args) == 3:
+		port, err := strconv.Atoi(args[2])
+		if err != nil || port <= 0 || port > 65535 || net.ParseIP(args[1]) == nil {
+			return protocol.Errorf("ERR Invalid node address specified: %s:%s", args[1], args[2])
+		}
+		s.cluster.Meet(args[1], port)
+		return protocol.OK
+	case (sub == "ADDSLOTS" || sub == "DELSLOTS") && len(args) >= 2,
+		(sub == "ADDSLOTSRANGE" || sub == "DELSLOTSRANGE") && len(args) >= 3 && len(args)%2 == 1:
+		var slots []int
+		for i := 1; i < len(args); i++ {
+			lo, ok := parseSlot(args[i])
+			if !ok {
+				return invalidSlotReply
+			}
+			hi := lo
+			if strings.HasSuffix(sub, "RANGE") {
+				i++
+				if hi, ok = parseSlot(args[i]); !ok {
+					return invalidSlotReply
+				}
+				if hi < lo {
+					return protocol.Errorf("ERR start slot number %d is greater than end slot number %d", lo, hi)
+				}
+			}
+			for slot := lo; slot <= hi; slot++ {
+				slots = append(slots, slot)
+			}
+		}
+		var err error
+		if strings.HasPrefix(sub, "ADD") {
+			err = s.cluster.AddSlots(slots)
+		} else {
+			err = s.cluster.DelSlots(slots)
+		}
+		if err != nil {
+			return protocol.Error(err.Error())
+		}
+		return protocol.OK
+	case sub == "SETSLOT" && len(args) >= 3:
+		return s.setSlot(args[1:])
+	}
+	return protocol.Errorf("ERR unknown subcommand or wrong number of arguments for '%s'. Try CLUSTER HELP.", args[0])
+}
+
+// setSlot 实现 CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE node-id 与 STABLE
+func (s *Server) setSlot(args []string) protocol.Reply {
+	slot, ok := parseSlot(args[0])
+	if !ok {
+		return invalidSlotReply
+	}
+	action, id := strings.ToUpper(args[1]), ""
+	switch {
+	case action == "STABLE" && len(args) == 2:
+	case (action == "IMPORTING" || action == "MIGRATING" || action == "NODE") && len(args) == 3:
+		id = args[2]
+	default:
+		return protocol.Error("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	// 本节点仍有该槽的键时不能把槽交给其他节点
+	if action == "NODE" && id != s.cluster.MyID() && s.cluster.Slot(slot).Mine && s.store.CountKeysInSlot(slot) > 0 {
+		return protocol.Errorf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+	}
+	if err := s.cluster.SetSlot(slot, action, id); err != nil {
+		return protocol.Error(err.Error())
+	}
+	return protocol.OK
+}
+
+// clusterInfo 返回 INFO 的 Cluster 段
+func (s *Server) clusterInfo() string {
+	enabled := 0
+	if s.cluster != nil {
+		enabled = 1
+	}
+	return fmt.Sprintf("# Cluster\r\ncluster_enabled:%d\r\n", enabled)
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"redisx/internal/cluster"
+)
+
+// startClusterNodes 在 :0 上启动 n 个集群节点，平均分配全部槽并等待集群状态为 ok
+func startClusterNodes(t *testing.T, n int) []*Server {
+	t.Helper()
+	old := clusterGossipPeriod
+	clusterGossipPeriod = 20 * time.Millisecond
+	t.Cleanup(func() { clusterGossipPeriod = old })
+	nodes := make([]*Server, n)
+	for i := range nodes {
+		s := NewServer(":0")
+		s.SnapshotPath, s.RDBPath = "", ""
+		s.ClusterEnabled = true
+		nodes[i] = startConfigured(t, s)
+		t.Cleanup(func() { s.ln.Close() })
+	}
+	conn, r := dialServer(t, nodes[0])
+	defer conn.Close()
+	for i, s := range nodes {
+		c, cr := dialServer(t, s)
+		lo, hi := i*cluster.Slots/n, (i+1)*cluster.Slots/n-1
+		expectLine(t, c, cr, "+OK", "CLUSTER", "ADDSLOTSRANGE", strconv.Itoa(lo), strconv.Itoa(hi))
+		c.Close()
+		if i > 0 {
+			expectLine(t, conn, r, "+OK", "CLUSTER", "MEET", "127.0.0.1", strconv.Itoa(nodePort(s)))
+		}
+	}
+	for _, s := range nodes {
+		c, cr := dialServer(t, s)
+		waitFor(t, "cluster state ok", func() bool {
+			writeReq(c, "CLUSTER", "INFO")
+			info, _ := readBulk(cr)
+			return strings.Contains(info, "cluster_state:ok") && strings.Contains(info, "cluster_known_nodes:"+strconv.Itoa(n))
+		})
+		c.Close()
+	}
+	return nodes
+}
+
+func nodePort(s *Server) int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+// ownerOf 返回服务该槽的节点
+func ownerOf(nodes []*Server, slot int) *Server {
+	for _, s := range nodes {
+		if s.cluster.Slot(slot).Mine {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestClusterRedirect(t *testing.T) {
+	nodes := startClusterNodes(t, 3)
+	slot := cluster.KeySlot("foo")
+	owner := ownerOf(nodes, slot)
+	other := nodes[0]
+	if other == owner {
+		other = nodes[1]
+	}
+
+	oc, or := dialServer(t, other)
+	defer oc.Close()
+	moved := "-MOVED " + strconv.Itoa(slot) + " 127.0.0.1:" + strconv.Itoa(nodePort(owner))
+	expectLine(t, oc, or, moved, "SET", "foo", "bar")
+	expectLine(t, oc, or, moved, "GET", "foo")
+	expectLine(t, oc, or, "+PONG", "PING")
+
+	c, r := dialServer(t, owner)
+	defer c.Close()
+	expectLine(t, c, r, "+OK", "SET", "foo", "bar")
+	expectLine(t, c, r, "+OK", "SET", "{foo}.a", "1")
+	expectLine(t, c, r, "*2", "MGET", "foo", "{foo}.a")
+	expectLine(t, c, r, "$3")
+	expectLine(t, c, r, "bar")
+	expectLine(t, c, r, "$1")
+	expectLine(t, c, r, "1")
+	expectLine(t, c, r, "-CROSSSLOT Keys in request don't hash to the same slot", "MGET", "foo", "somekey")
+	expectLine(t, c, r, "+OK", "MULTI")
+	expectLine(t, c, r, "+QUEUED", "INCR", "{foo}.n")
+	expectLine(t, c, r, "-CROSSSLOT Keys in request don't hash to the same slot", "INCR", "{bar}.n")
+	expectLine(t, c, r, "-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+
+	expectLine(t, c, r, ":"+strconv.Itoa(slot), "CLUSTER", "KEYSLOT", "foo")
+	expectLine(t, c, r, ":2", "CLUSTER", "COUNTKEYSINSLOT", strconv.Itoa(slot))
+	writeReq(c, "CLUSTER", "GETKEYSINSLOT", strconv.Itoa(slot), "10")
+	if got := readArray(t, r); len(got) != 2 {
+		t.Fatalf("unexpected keys in slot %v", got)
+	}
+	expectLine(t, c, r, "-ERR Invalid slot", "CLUSTER", "COUNTKEYSINSLOT", "16384")
+
+	// CLUSTER SLOTS：三个区间覆盖全部槽
+	writeReq(c, "CLUSTER", "SLOTS")
+	expectLine(t, c, r, "*3")
+	for i := range nodes {
+		lo, hi := i*cluster.Slots/3, (i+1)*cluster.Slots/3-1
+		for _, want := range []string{"*3", ":" + strconv.Itoa(lo), ":" + strconv.Itoa(hi), "*3", "$9", "127.0.0.1", ":" + strconv.Itoa(nodePort(nodes[i]))} {
+			expectLine(t, c, r, want)
+		}
+		readLine(r)
+		readLine(r)
+	}
+	writeReq(c, "CLUSTER", "NODES")
+	text, _ := readBulk(r)
+	if lines := strings.Split(strings.TrimSpace(text), "\n"); len(lines) != 3 || !strings.Contains(text, "myself,master") {
+		t.Fatalf("unexpected CLUSTER NODES:\n%s", text)
+	}
+	if infoField(t, c, r, "cluster_enabled") != "1" {
+		t.Fatal("expected cluster_enabled:1 in INFO")
+	}
+	writeReq(c, "CLUSTER", "SHARDS")
+	for _, want := range []string{"*3", "*4", "$5", "slots", "*2"} {
+		expectLine(t, c, r, want)
+	}
+}
+
+func TestClusterAsk(t *testing.T) {
+	nodes := startClusterNodes(t, 2)
+	slot := cluster.KeySlot("foo")
+	src := ownerOf(nodes, slot)
+	dst := nodes[0]
+	if dst == src {
+		dst = nodes[1]
+	}
+	sc, sr := dialServer(t, src)
+	defer sc.Close()
+	dc, dr := dialServer(t, dst)
+	defer dc.Close()
+	expectLine(t, sc, sr, "+OK", "SET", "foo", "1")
+	expectLine(t, dc, dr, "+OK", "CLUSTER", "SETSLOT", strconv.Itoa(slot), "IMPORTING", src.cluster.MyID())
+	expectLine(t, sc, sr, "+OK", "CLUSTER", "SETSLOT", strconv.Itoa(slot), "MIGRATING", dst.cluster.MyID())
+
+	// 键仍在源节点时照常执行；不存在的键重定向到目标节点
+	expectLine(t, sc, sr, "$1", "GET", "foo")
+	expectLine(t, sc, sr, "1")
+	ask := "-ASK " + strconv.Itoa(slot) + " 127.0.0.1:" + strconv.Itoa(nodePort(dst))
+	expectLine(t, sc, sr, ask, "GET", "{foo}.new")
+	expectLine(t, sc, sr, "-TRYAGAIN Multiple keys request during rehashing of slot", "MGET", "foo", "{foo}.new")
+	moved := "-MOVED " + strconv.Itoa(slot) + " 127.0.0.1:" + strconv.Itoa(nodePort(src))
+	expectLine(t, dc, dr, moved, "SET", "{foo}.new", "v")
+	expectLine(t, dc, dr, "+OK", "ASKING")
+	expectLine(t, dc, dr, "+OK", "SET", "{foo}.new", "v")
+	// ASKING 只对下一条命令有效，即使该命令未经过重定向检查
+	expectLine(t, dc, dr, moved, "GET", "{foo}.new")
+	expectLine(t, dc, dr, "+OK", "ASKING")
+	expectLine(t, dc, dr, "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?", "AUTH", "x")
+	expectLine(t, dc, dr, moved, "GET", "{foo}.new")
+
+	// 源节点仍有键时不能把槽交给目标节点
+	expectLine(t, sc, sr, "-ERR Can't assign hashslot "+strconv.Itoa(slot)+" to a different node while I still hold keys for this hash slot.",
+		"CLUSTER", "SETSLOT", strconv.Itoa(slot), "NODE", dst.cluster.MyID())
+	expectLine(t, sc, sr, ":1", "DEL", "foo")
+	expectLine(t, dc, dr, "+OK", "CLUSTER", "SETSLOT", strconv.Itoa(slot), "NODE", dst.cluster.MyID())
+	expectLine(t, sc, sr, "+OK", "CLUSTER", "SETSLOT", strconv.Itoa(slot), "NODE", dst.cluster.MyID())
+	expectLine(t, dc, dr, "$1", "GET", "{foo}.new")
+	expectLine(t, dc, dr, "v")
+	waitFor(t, "slot ownership to settle", func() bool {
+		return dst.cluster.Slot(slot).Mine && src.cluster.Slot(slot).Owner == dst.cluster.Slot(slot).Owner
+	})
+	expectLine(t, sc, sr, "-MOVED "+strconv.Itoa(slot)+" 127.0.0.1:"+strconv.Itoa(nodePort(dst)), "GET", "{foo}.new")
+}
+
+func TestClusterRebalanceNotReady(t *testing.T) {
+	s := NewServer(":0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.ClusterEnabled = true
+	startConfigured(t, s)
+	defer s.ln.Close()
+	// 没有分配任何槽的集群不会就绪，等待超时后放弃
+	addr := "127.0.0.1:" + strconv.Itoa(nodePort(s))
+	_, err := cluster.Rebalance(addr, cluster.RebalanceOptions{Wait: 200 * time.Millisecond, DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Fatalf("expected not ready error, got %v", err)
+	}
+}
+
+func TestClusterDisabled(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	c, r := dialServer(t, s)
+	defer c.Close()
+	expectLine(t, c, r, "-ERR This instance has cluster support disabled", "CLUSTER", "INFO")
+	expectLine(t, c, r, "-ERR This instance has cluster support disabled", "ASKING")
+	expectLine(t, c, r, "*2", "MGET", "foo", "somekey")
+}
+
+func TestClusterRebalance(t *testing.T) {
+	nodes := startClusterNodes(t, 2)
+	c, r := dialServer(t, nodes[0])
+	defer c.Close()
+	keys := map[string]bool{}
+	for i := 0; len(keys) < 20; i++ {
+		key := "key:" + strconv.Itoa(i)
+		if ownerOf(nodes, cluster.KeySlot(key)) == nodes[0] {
+			expectLine(t, c, r, "+OK", "SET", key, "v"+strconv.Itoa(i))
+			keys[key] = true
+		}
+	}
+
+	// 加入一个没有槽的节点后再平衡
+	s := NewServer(":0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.ClusterEnabled = true
+	added := startConfigured(t, s)
+	t.Cleanup(func() { added.ln.Close() })
+	expectLine(t, c, r, "+OK", "CLUSTER", "MEET", "127.0.0.1", strconv.Itoa(nodePort(added)))
+	nodes = append(nodes, added)
+
+	// Rebalance 自行等待新节点加入并得知全部槽的归属
+	addr := "127.0.0.1:" + strconv.Itoa(nodePort(nodes[0]))
+	planned, err := cluster.Rebalance(addr, cluster.RebalanceOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planned) != cluster.Slots/3 {
+		t.Fatalf("expected %d planned moves, got %d", cluster.Slots/3, len(planned))
+	}
+	moves, err := cluster.Rebalance(addr, cluster.RebalanceOptions{Pipeline: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != len(planned) {
+		t.Fatalf("expected %d moves, got %d", len(planned), len(moves))
+	}
+	for _, n := range nodes {
+		if got := len(n.cluster.SlotRanges()); got == 0 {
+			t.Fatal("expected slot ranges")
+		}
+	}
+	waitFor(t, "slot ownership to settle", func() bool {
+		for slot := 0; slot < cluster.Slots; slot++ {
+			owner := ownerOf(nodes, slot)
+			if owner == nil {
+				return false
+			}
+			for _, n := range nodes {
+				if n.cluster.Slot(slot).Owner != owner.cluster.Slot(slot).Owner {
+					return false
+				}
+			}
+		}
+		return true
+	})
+	counts := map[*Server]int{}
+	for slot := 0; slot < cluster.Slots; slot++ {
+		counts[ownerOf(nodes, slot)]++
+	}
+	for _, n := range nodes {
+		if counts[n] < cluster.Slots/3 || counts[n] > cluster.Slots/3+1 {
+			t.Fatalf("unbalanced slot counts %v", counts)
+		}
+	}
+	// 每个键都在其槽的新归属节点上
+	for key := range keys {
+		owner := ownerOf(nodes, cluster.KeySlot(key))
+		oc, or := dialServer(t, owner)
+		expectLine(t, oc, or, ":1", "EXISTS", key)
+		oc.Close()
+	}
+	if moves, err := cluster.Rebalance(addr, cluster.RebalanceOptions{}); err != nil || len(moves) != 0 {
+		t.Fatalf("expected a balanced cluster, got %d moves (%v)", len(moves), err)
+	}
+}
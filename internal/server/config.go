@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+	"redisx/internal/pubsub"
+)
+
+// configParams 为 CONFIG GET 可读取的参数，名称沿用 Redis 的配置项；bind 为
+// 全部 TCP 监听地址（含端口），以空格分隔，只监听 Unix 套接字时为空
+var configParams = map[string]func(s *Server) string{
+	"bind":                  func(s *Server) string { return strings.Join(s.tcpAddrs(), " ") },
+	"unixsocket":            func(s *Server) string { return s.UnixSocket },
+	"unixsocketperm":        func(s *Server) string { return fmt.Sprintf("%o", s.UnixSocketPerm) },
+	"maxclients":            func(s *Server) string { return strconv.Itoa(s.MaxConns) },
+	"proto-max-bulk-len":    func(s *Server) string { return strconv.Itoa(s.ProtoMaxBulkLen) },
+	"max-multibulk-len":     func(s *Server) string { return strconv.Itoa(s.MaxMultibulkLen) },
+	"timeout":               func(s *Server) string { return strconv.Itoa(int(s.ConnTimeout.Seconds())) },
+	"maxmemory":             func(s *Server) string { return strconv.FormatInt(s.MaxMemoryBytes, 10) },
+	"appendonly":            func(s *Server) string { return yesNo(s.AppendOnly) },
+	"appendfilename":        func(s *Server) string { return s.AppendFilename },
+	"appendfsync":           func(s *Server) string { return s.AppendFsync },
+	"requirepass":           func(s *Server) string { return s.RequirePass },
+	"aclfile":               func(s *Server) string { return s.ACLFile },
+	"repl-backlog-size":     func(s *Server) string { return strconv.Itoa(s.ReplBacklogSize) },
+	"repl-timeout":          func(s *Server) string { return strconv.Itoa(int(s.ReplTimeout.Seconds())) },
+	"min-replicas-to-write": func(s *Server) string { return strconv.Itoa(s.MinReplicasToWrite) },
+	"min-replicas-max-lag":  func(s *Server) string { return strconv.Itoa(int(s.MinReplicasMaxLag.Seconds())) },
+	"replica-priority":      func(s *Server) string { return strconv.Itoa(s.ReplicaPriority) },
+	"cluster-enabled":       func(s *Server) string { return yesNo(s.ClusterEnabled) },
+	"cluster-node-timeout":  func(s *Server) string { return strconv.FormatInt(s.ClusterNodeTimeout.Milliseconds(), 10) },
+	"tls-cert-file":         func(s *Server) string { return s.TLSCertFile },
+	"tls-key-file":          func(s *Server) string { return s.TLSKeyFile },
+	"tls-ca-cert-file":      func(s *Server) string { return s.TLSCAFile },
+	"tls-auth-clients": func(s *Server) string {
+		if s.TLSAuthClients == "" {
+			return "yes"
+		}
+		return s.TLSAuthClients
+	},
+	"tls-ciphers": func(s *Server) string { return s.TLSCipherSuites },
+}
+
+// configSetParams 为 CONFIG SET 可修改的参数，返回参数对应的字段。目前只有 TLS
+// 的证书文件：与 Redis 一致，设置后（即使路径未变）重新加载证书，用于在线轮换证书
+var configSetParams = map[string]func(s *Server) *string{
+	"tls-cert-file":    func(s *Server) *string { return &s.TLSCertFile },
+	"tls-key-file":     func(s *Server) *string { return &s.TLSKeyFile },
+	"tls-ca-cert-file": func(s *Server) *string { return &s.TLSCAFile },
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// configCommand 实现 CONFIG GET 与 CONFIG SET
+func (s *Server) configCommand(args []string) protocol.Reply {
+	if len(args) == 0 {
+		return protocol.WrongArgs("config")
+	}
+	switch {
+	case strings.EqualFold(args[0], "GET") && len(args) >= 2:
+		return s.configGet(args[1:])
+	case strings.EqualFold(args[0], "SET") && len(args) >= 3 && len(args)%2 == 1:
+		return s.configSet(args[1:])
+	}
+	return protocol.Errorf("ERR unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP.", args[0])
+}
+
+// configGet 实现 CONFIG GET parameter [parameter ...]，参数可以是 glob 模式；
+// 回复为按名称排序的参数名与值组成的 map
+func (s *Server) configGet(patterns []string) protocol.Reply {
+	s.tls.mu.RLock()
+	defer s.tls.mu.RUnlock()
+	var names []string
+	for name := range configParams {
+		for _, pattern := range patterns {
+			if pubsub.Match(strings.ToLower(pattern), name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	out := make(protocol.Map, 0, 2*len(names))
+	for _, name := range names {
+		out = append(out, protocol.Bulk(name), protocol.Bulk(configParams[name](s)))
+	}
+	return out
+}
+
+// configSet 实现 CONFIG SET parameter value [parameter value ...]：全部参数一起
+// 生效，重新加载证书失败时恢复原值
+func (s *Server) configSet(args []string) protocol.Reply {
+	fields := make([]*string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		field, ok := configSetParams[strings.ToLower(args[i])]
+		if !ok {
+			return protocol.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+		}
+		fields = append(fields, field(s))
+	}
+	s.tls.mu.Lock()
+	defer s.tls.mu.Unlock()
+	if s.tls.certs.Load() == nil {
+		return protocol.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - TLS is not enabled", args[0])
+	}
+	old := make([]string, len(fields))
+	for i, f := range fields {
+		old[i], *f = *f, args[2*i+1]
+	}
+	if err := s.reloadTLS(); err != nil {
+		// 逆序恢复，同一参数出现多次时得到最初的值
+		for i := len(fields) - 1; i >= 0; i-- {
+			*fields[i] = old[i]
+		}
+		return protocol.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %s", args[0], err)
+	}
+	return protocol.OK
+}
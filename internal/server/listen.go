@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// listen 创建全部监听：s.ln 为第一个监听（通常为监听地址；监听地址为空时可以是
+// Unix 套接字），其余保存在 s.listeners。配置了 TLS 而没有 TLSAddr 时，监听地址与
+// BindAddrs 只接受 TLS 连接；Unix 套接字总是明文。出错时关闭已创建的监听。
+func (s *Server) listen() (err error) {
+	var cfg *tls.Config
+	if s.tlsEnabled() {
+		if cfg, err = s.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	var lns []net.Listener
+	defer func() {
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+		}
+	}()
+	tcp := func(addr string, useTLS bool) (net.Listener, error) {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if useTLS {
+			ln = tls.NewListener(ln, cfg)
+		}
+		lns = append(lns, ln)
+		return ln, nil
+	}
+	tlsOnly := cfg != nil && s.TLSAddr == ""
+	for _, addr := range s.tcpAddrs() {
+		if _, err := tcp(addr, tlsOnly); err != nil {
+			return err
+		}
+	}
+	var tln net.Listener
+	if cfg != nil && s.TLSAddr != "" {
+		if tln, err = tcp(s.TLSAddr, true); err != nil {
+			return err
+		}
+	}
+	if s.UnixSocket != "" {
+		uln, err := s.listenUnix()
+		if err != nil {
+			return err
+		}
+		lns = append(lns, uln)
+	}
+	if len(lns) == 0 {
+		return errors.New("no listening address configured")
+	}
+	s.tlsLn, s.listeners = tln, lns[1:]
+	s.ln = lns[0]
+	return nil
+}
+
+// listenUnix 监听 UnixSocket 并设置其权限。上次未正常退出时残留的套接字文件
+// 先被删除；路径上已有其他类型的文件时返回错误。
+func (s *Server) listenUnix() (net.Listener, error) {
+	if fi, err := os.Lstat(s.UnixSocket); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("unix socket %s: file exists and is not a socket", s.UnixSocket)
+		}
+		if err := os.Remove(s.UnixSocket); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", s.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	if s.UnixSocketPerm != 0 {
+		if err := os.Chmod(s.UnixSocket, s.UnixSocketPerm); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// tcpAddrs 返回明文或 TLS 的 TCP 监听地址：监听地址（为空表示不监听）与 BindAddrs
+func (s *Server) tcpAddrs() []string {
+	if s.addr == "" {
+		return s.BindAddrs
+	}
+	return append([]string{s.addr}, s.BindAddrs...)
+}
+
+// tcpAddr 返回第一个 TCP 监听的地址，供集群、复制等需要向其他节点公布地址的
+// 功能使用；只监听 Unix 套接字时 ok 为 false
+func (s *Server) tcpAddr() (addr *net.TCPAddr, ok bool) {
+	if s.ln == nil {
+		return nil, false
+	}
+	for _, ln := range append([]net.Listener{s.ln}, s.listeners...) {
+		if addr, ok = ln.Addr().(*net.TCPAddr); ok {
+			return addr, true
+		}
+	}
+	return nil, false
+}
+
+// closeListeners 关闭 s.ln 之外的监听
+func (s *Server) closeListeners() {
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func dialAddr(t *testing.T, network string, addr net.Addr) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial(network, addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+func TestMultipleListeners(t *testing.T) {
+	// 路径过长时无法创建 Unix 套接字，不使用 t.TempDir()
+	dir, err := os.MkdirTemp("", "redisx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "redisx.sock")
+	// 残留的套接字文件在启动时被删除
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.BindAddrs = []string{"127.0.0.1:0"}
+	if ln, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		ln.Close()
+		s.BindAddrs = append(s.BindAddrs, "[::1]:0")
+	}
+	s.UnixSocket = sock
+	s.UnixSocketPerm = 0o600
+	s.MaxConns = len(s.BindAddrs) + 2
+	startConfigured(t, s)
+	defer s.ln.Close()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("unix socket permissions = %o", fi.Mode().Perm())
+	}
+
+	// 每个监听都能执行命令，并共用同一份数据与连接数限制
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "SET", "k", "v")
+	for _, ln := range s.listeners {
+		c, cr := dialAddr(t, ln.Addr().Network(), ln.Addr())
+		defer c.Close()
+		expectLine(t, c, cr, "$1", "GET", "k")
+		expectLine(t, c, cr, "v")
+	}
+	extra, er := dialAddr(t, "unix", s.listeners[len(s.listeners)-1].Addr())
+	defer extra.Close()
+	expectLine(t, extra, er, "-ERR max connections")
+
+	// 关闭监听地址后其余监听一并关闭，Unix 套接字文件被删除
+	s.ln.Close()
+	waitFor(t, "unix socket removal", func() bool {
+		_, err := os.Stat(sock)
+		return os.IsNotExist(err)
+	})
+	for _, ln := range s.listeners {
+		if c, err := net.Dial(ln.Addr().Network(), ln.Addr().String()); err == nil {
+			c.Close()
+			t.Fatalf("%s still accepting connections", ln.Addr())
+		}
+	}
+}
+
+func TestUnixSocketOnly(t *testing.T) {
+	dir, err := os.MkdirTemp("", "redisx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := NewServer("")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.UnixSocket = filepath.Join(dir, "redisx.sock")
+	startConfigured(t, s)
+	defer s.ln.Close()
+	if _, ok := s.tcpAddr(); ok || len(s.listeners) != 0 {
+		t.Fatalf("expected only the unix socket, got %s and %d more", s.ln.Addr(), len(s.listeners))
+	}
+	conn, r := dialAddr(t, "unix", s.ln.Addr())
+	defer conn.Close()
+	expectLine(t, conn, r, "+PONG", "PING")
+	expectLine(t, conn, r, "*2", "CONFIG", "GET", "bind")
+	expectLine(t, conn, r, "$4")
+	expectLine(t, conn, r, "bind")
+	expectLine(t, conn, r, "$0")
+	expectLine(t, conn, r, "")
+
+	// 集群模式需要 TCP 地址；没有任何监听时无法启动
+	c := NewServer("")
+	c.SnapshotPath, c.RDBPath = "", ""
+	c.UnixSocket = filepath.Join(dir, "cluster.sock")
+	c.ClusterEnabled = true
+	if err := c.Start(); err == nil {
+		t.Fatal("cluster mode started without a TCP listener")
+	}
+	n := NewServer("")
+	n.SnapshotPath, n.RDBPath = "", ""
+	if err := n.Start(); err == nil {
+		t.Fatal("Start succeeded without any listener")
+	}
+}
+
+func TestListenErrors(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "not-a-socket")
+	if err := os.WriteFile(file, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.UnixSocket = file
+	if err := s.Start(); err == nil {
+		t.Fatal("Start succeeded with a regular file as the unix socket")
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+		t.Fatalf("regular file modified: %q, %v", data, err)
+	}
+
+	// 任一地址监听失败时，已创建的监听被关闭
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	s = NewServer("127.0.0.1:0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.BindAddrs = []string{busy.Addr().String()}
+	if err := s.Start(); err == nil {
+		t.Fatal("Start succeeded with an address in use")
+	}
+}
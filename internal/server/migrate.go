@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/aof"
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+)
+
+// migrate 实现 MIGRATE：序列化键并以 RESTORE-ASKING 批量发往目标节点，目标全部
+// 确认后删除本地的键（COPY 时保留）。MIGRATE 在 Exclusive 中执行（见
+// exclusiveCommands），迁移期间不会有其他命令修改这些键。目标返回错误时本地的
+// 键一律保留，已写入目标的键可用 REPLACE 重试覆盖。
+func (s *Server) migrate(args []string) protocol.Reply {
+	m, errResp := command.ParseMigrate(args)
+	if errResp != nil {
+		return errResp
+	}
+	if m.DB != 0 {
+		return protocol.Error("ERR DB index is out of range")
+	}
+	var buf []byte
+	var keys []string
+	now := time.Now().UnixMilli()
+	for _, key := range m.Keys {
+		payload, ok := s.store.Dump(key)
+		if !ok {
+			// 已过期但尚未删除的键仍在槽索引中，删除以免迁移槽时反复取到它
+			s.store.Delete(key)
+			continue
+		}
+		// RESTORE 的 ttl 为 0 表示永不过期，即将过期的键至少保留 1 毫秒
+		ttl := int64(0)
+		if at := s.store.PExpireTime(key); at > 0 {
+			ttl = max(at-now, 1)
+		}
+		cmd := []string{"RESTORE-ASKING", key, strconv.FormatInt(ttl, 10), payload}
+		if m.Replace {
+			cmd = append(cmd, "REPLACE")
+		}
+		buf = aof.AppendCommand(buf, cmd)
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return protocol.SimpleString("NOKEY")
+	}
+
+	conn, err := net.DialTimeout("tcp", m.Addr, m.Timeout)
+	if err != nil {
+		return protocol.Error("IOERR error or timeout connecting to the client")
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(m.Timeout))
+	if _, err := conn.Write(buf); err != nil {
+		return protocol.Error("IOERR error or timeout writing to target instance")
+	}
+	r := bufio.NewReader(conn)
+	var targetErr string
+	for range keys {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return protocol.Error("IOERR error or timeout reading to target instance")
+		}
+		if line[0] == '-' && targetErr == "" {
+			targetErr = strings.TrimRight(line[1:], "\r\n")
+		}
+	}
+	if targetErr != "" {
+		return protocol.Error("ERR Target instance replied with error: " + targetErr)
+	}
+	if !m.Copy {
+		for _, key := range keys {
+			s.store.Delete(key)
+		}
+	}
+	return protocol.OK
+}
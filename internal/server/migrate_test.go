@@ -0,0 +1,59 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	src, dst := startServer(t), startServer(t)
+	defer src.ln.Close()
+	defer dst.ln.Close()
+	sc, sr := dialServer(t, src)
+	defer sc.Close()
+	dc, dr := dialServer(t, dst)
+	defer dc.Close()
+	port := strconv.Itoa(nodePort(dst))
+
+	expectLine(t, sc, sr, "+OK", "SET", "k", "v", "PX", "60000")
+	expectLine(t, sc, sr, ":2", "RPUSH", "l", "a", "b")
+	expectLine(t, sc, sr, "+OK", "MIGRATE", "127.0.0.1", port, "k", "0", "1000")
+	expectLine(t, sc, sr, ":0", "EXISTS", "k")
+	expectLine(t, dc, dr, "$1", "GET", "k")
+	expectLine(t, dc, dr, "v")
+	writeReq(dc, "PTTL", "k")
+	if line, _ := readLine(dr); mustAtoi(t, line[1:len(line)-2]) <= 0 {
+		t.Fatalf("expected TTL to be migrated, got %q", line)
+	}
+	expectLine(t, sc, sr, "+NOKEY", "MIGRATE", "127.0.0.1", port, "k", "0", "1000")
+
+	// 目标已有键时需要 REPLACE；出错时源节点保留键
+	expectLine(t, sc, sr, "+OK", "SET", "k", "new")
+	expectLine(t, sc, sr, "-ERR Target instance replied with error: BUSYKEY Target key name already exists.",
+		"MIGRATE", "127.0.0.1", port, "k", "0", "1000")
+	expectLine(t, sc, sr, ":1", "EXISTS", "k")
+	expectLine(t, sc, sr, "+OK", "MIGRATE", "127.0.0.1", port, "", "0", "1000", "COPY", "REPLACE", "KEYS", "k", "l", "missing")
+	expectLine(t, sc, sr, ":2", "EXISTS", "k", "l")
+	expectLine(t, dc, dr, "$3", "GET", "k")
+	expectLine(t, dc, dr, "new")
+	expectLine(t, dc, dr, ":2", "LLEN", "l")
+
+	expectLine(t, sc, sr, "-ERR syntax error", "MIGRATE", "127.0.0.1", port, "k", "0", "1000", "NOPE")
+	expectLine(t, sc, sr, "-ERR When using MIGRATE KEYS option, the key argument must be set to the empty string",
+		"MIGRATE", "127.0.0.1", port, "k", "0", "1000", "KEYS", "l")
+	expectLine(t, sc, sr, "-IOERR error or timeout connecting to the client", "MIGRATE", "127.0.0.1", "1", "k", "0", "100")
+
+	// DUMP/RESTORE 走协议往返，负载中的任意字节原样保留
+	writeReq(sc, "DUMP", "l")
+	payload, err := readBulk(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, sc, sr, "$-1", "DUMP", "missing")
+	expectLine(t, dc, dr, "+OK", "RESTORE", "copy", "0", payload)
+	expectLine(t, dc, dr, "-BUSYKEY Target key name already exists.", "RESTORE", "copy", "0", payload)
+	expectLine(t, dc, dr, "-ERR DUMP payload version or checksum are wrong", "RESTORE", "bad", "0", payload[1:])
+	expectLine(t, dc, dr, "-ERR Invalid TTL value, must be >= 0", "RESTORE", "bad", "-1", payload)
+	expectLine(t, dc, dr, "$1", "LINDEX", "copy", "1")
+	expectLine(t, dc, dr, "b")
+}
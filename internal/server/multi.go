@@ -0,0 +1,210 @@
+package server
+
+import (
+	"strings"
+
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+)
+
+// queuedCommand 为 MULTI 中已校验、等待 EXEC 执行的命令
+type queuedCommand struct {
+	name string
+	args [][]byte
+}
+
+// cloneArgs 复制请求参数，使其在解析下一条请求后仍然有效：较短的参数共用一块
+// 内存，解析器不再复用的大参数（见 protocol.Detached）不复制
+func cloneArgs(args [][]byte) [][]byte {
+	n := 0
+	for _, a := range args {
+		if !protocol.Detached(a) {
+			n += len(a)
+		}
+	}
+	buf := make([]byte, 0, n)
+	out := make([][]byte, len(args))
+	for i, a := range args {
+		if protocol.Detached(a) {
+			out[i] = a
+			continue
+		}
+		buf = append(buf, a...)
+		out[i] = buf[len(buf)-len(a) : len(buf) : len(buf)]
+	}
+	return out
+}
+
+// serverCommands 为不经过 command.Router、由服务器直接执行的命令，可在 MULTI 中入队
+var serverCommands = map[string]bool{
+	"PING": true, "INFO": true, "PUBLISH": true, "SPUBLISH": true, "PUBSUB": true, "UNWATCH": true,
+	"SAVE": true, "BGSAVE": true, "LASTSAVE": true, "BGREWRITEAOF": true, "WAIT": true,
+	"CLUSTER": true, "MIGRATE": true, "ACL": true, "CONFIG": true,
+}
+
+// handleMulti 处理 MULTI/EXEC/DISCARD/WATCH，以及事务中的命令入队。
+// 返回 false 表示命令不属于事务处理，由调用方按普通命令执行。
+func (s *Server) handleMulti(c *client, cmd string, args [][]byte) bool {
+	if c.sub != nil && c.out.Proto < protocol.RESP3 {
+		// RESP2 订阅模式下的命令限制由 handlePubSub 负责
+		return false
+	}
+	name := strings.ToUpper(cmd)
+	switch name {
+	case "MULTI":
+		if len(args) != 0 {
+			c.write(protocol.WrongArgs("multi"))
+		} else if c.multi {
+			c.write(protocol.Error("ERR MULTI calls can not be nested"))
+		} else {
+			c.multi = true
+			c.write(protocol.OK)
+		}
+		return true
+	case "EXEC":
+		if !c.multi {
+			c.write(protocol.Error("ERR EXEC without MULTI"))
+			return true
+		}
+		c.write(s.exec(c))
+		return true
+	case "DISCARD":
+		if !c.multi {
+			c.write(protocol.Error("ERR DISCARD without MULTI"))
+			return true
+		}
+		s.resetMulti(c)
+		c.write(protocol.OK)
+		return true
+	case "WATCH":
+		if c.multi {
+			c.write(protocol.Error("ERR WATCH inside MULTI is not allowed"))
+			return true
+		}
+		if len(args) == 0 {
+			c.write(protocol.WrongArgs("watch"))
+			return true
+		}
+		keys := protocol.ArgStrings(args)
+		if s.cluster != nil {
+			if resp := s.clusterRedirect(c, name, keys); resp != nil {
+				c.write(resp)
+				return true
+			}
+		}
+		s.watch(c, keys)
+		c.write(protocol.OK)
+		return true
+	case "QUIT":
+		// 与 Redis 一致，QUIT 不入队
+		return false
+	}
+	if !c.multi {
+		return false
+	}
+	// 入队前校验；出错的事务在 EXEC 时以 EXECABORT 整体放弃
+	var errResp protocol.Reply
+	switch {
+	case subscribeKinds[name].reply != "":
+		errResp = protocol.Error("ERR Command not allowed inside a transaction")
+	case serverCommands[name]:
+		// 参数个数已在分派时检查
+	case command.IsWrite(name) && s.isReplica():
+		errResp = readonlyReply
+	default:
+		errResp = s.router.Validate(name, args)
+	}
+	if errResp == nil && s.cluster != nil {
+		errResp = s.clusterRedirect(c, name, protocol.ArgStrings(args))
+	}
+	if errResp != nil {
+		c.dirty = true
+		c.write(errResp)
+		return true
+	}
+	c.queue = append(c.queue, queuedCommand{name: name, args: cloneArgs(args)})
+	c.write(protocol.SimpleString("QUEUED"))
+	return true
+}
+
+// exec 原子地执行事务队列：期间其他连接的命令不会交错执行。被 WATCH 的键
+// 已被修改或过期时放弃执行并返回 null 数组。
+func (s *Server) exec(c *client) protocol.Reply {
+	defer s.resetMulti(c)
+	if c.dirty {
+		return protocol.Error("EXECABORT Transaction discarded because of previous errors.")
+	}
+	if s.raft.node != nil {
+		for _, q := range c.queue {
+			if command.IsWrite(q.name) {
+				return s.raftExec(c)
+			}
+		}
+	}
+	var resp protocol.Reply
+	s.store.Exclusive(func() {
+		if len(c.watched) > 0 && s.store.Touched(c.watched) {
+			resp = protocol.NullArray
+			return
+		}
+		for _, q := range c.queue {
+			if command.IsWrite(q.name) {
+				if resp = s.denyWrite(); resp != nil {
+					return
+				}
+				break
+			}
+		}
+		out := make(protocol.Array, len(c.queue))
+		resp = out
+		if !s.propagating() {
+			for i, q := range c.queue {
+				out[i] = s.execute(c, q.name, q.args)
+			}
+			return
+		}
+		// 事务中的写命令以 MULTI/EXEC 包裹传播，重放或应用时不完整的事务整体丢弃
+		prior := s.store.TakePropagated()
+		var cmds [][]string
+		for i, q := range c.queue {
+			out[i] = s.execute(c, q.name, q.args)
+			cmds = append(cmds, command.Propagate(s.store, q.name, protocol.ArgStrings(q.args), out[i])...)
+		}
+		if len(cmds) > 1 {
+			cmds = append(append([][]string{{"MULTI"}}, cmds...), []string{"EXEC"})
+		}
+		s.propagate(c, prior, cmds)
+	})
+	return resp
+}
+
+// resetMulti 清除事务状态并释放 WATCH
+func (s *Server) resetMulti(c *client) {
+	c.multi, c.dirty, c.queue, c.multiSlot = false, false, nil, -1
+	s.unwatch(c)
+}
+
+// watch 开始监视尚未监视的键
+func (s *Server) watch(c *client, keys []string) {
+	for _, k := range keys {
+		seen := false
+		for _, t := range c.watched {
+			if t.Key == k {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			c.watched = append(c.watched, s.store.Watch(k))
+		}
+	}
+}
+
+// unwatch 释放连接的所有 WATCH
+func (s *Server) unwatch(c *client) {
+	if len(c.watched) == 0 {
+		return
+	}
+	s.store.Unwatch(c.watched)
+	c.watched = nil
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+// expectLine 发送命令（parts 为空时只读取）并检查单行回复
+func expectLine(t *testing.T, conn net.Conn, r *bufio.Reader, want string, parts ...string) {
+	t.Helper()
+	if len(parts) > 0 {
+		if err := writeReq(conn, parts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	line, err := readLine(r)
+	if err != nil {
+		t.Fatalf("%v: %v", parts, err)
+	}
+	if line != want+"\r\n" {
+		t.Fatalf("%v: expected %q, got %q", parts, want, line)
+	}
+}
+
+func TestMultiExec(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	expectLine(t, conn, r, "-ERR EXEC without MULTI", "EXEC")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "-ERR MULTI calls can not be nested", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "SET", "counter", "10")
+	expectLine(t, conn, r, "+QUEUED", "INCR", "counter")
+	expectLine(t, conn, r, "+QUEUED", "GET", "counter")
+	// 事务中的阻塞命令不阻塞
+	expectLine(t, conn, r, "+QUEUED", "BLPOP", "empty", "0")
+	if err := writeReq(conn, "EXEC"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"*4\r\n", "+OK\r\n", ":11\r\n", "$2\r\n", "11\r\n", "*-1\r\n"} {
+		if line, _ := readLine(r); line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "INCR", "counter")
+	expectLine(t, conn, r, "+OK", "DISCARD")
+	expectLine(t, conn, r, "-ERR DISCARD without MULTI", "DISCARD")
+	expectLine(t, conn, r, "$2", "GET", "counter")
+}
+
+func TestMultiExecAbort(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "SET", "k", "v")
+	expectLine(t, conn, r, "-ERR unknown command", "NOSUCHCMD")
+	expectLine(t, conn, r, "-ERR wrong number of arguments for 'get' command", "GET")
+	expectLine(t, conn, r, "-ERR Command not allowed inside a transaction", "SUBSCRIBE", "ch")
+	expectLine(t, conn, r, "-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	// 整个事务被放弃
+	expectLine(t, conn, r, ":0", "EXISTS", "k")
+}
+
+func TestMultiQueuesInlineBigArgs(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	// 排队的 inline 大参数不会被之后排队的命令覆盖
+	a := strings.Repeat("a", protocol.BigArgLen+1)
+	expectLine(t, conn, r, "+OK", "MULTI")
+	fmt.Fprintf(conn, "SET a %s\r\n", a)
+	expectLine(t, conn, r, "+QUEUED")
+	fmt.Fprintf(conn, "SET b %s\r\n", strings.Repeat("b", protocol.BigArgLen+1))
+	expectLine(t, conn, r, "+QUEUED")
+	if err := writeReq(conn, "EXEC"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"*2\r\n", "+OK\r\n", "+OK\r\n"} {
+		if line, _ := readLine(r); line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+	writeReq(conn, "GET", "a")
+	if got, err := readBulk(r); err != nil || got != a {
+		t.Fatalf("queued inline big value was overwritten (%v)", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	addr := s.ln.Addr().String()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	other, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	r, or := bufio.NewReader(conn), bufio.NewReader(other)
+
+	// 被监视的键在 EXEC 前被其他连接修改：事务不执行
+	expectLine(t, other, or, "+OK", "SET", "balance", "100")
+	expectLine(t, conn, r, "+OK", "WATCH", "balance")
+	expectLine(t, other, or, ":101", "INCR", "balance")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "-ERR WATCH inside MULTI is not allowed", "WATCH", "x")
+	expectLine(t, conn, r, "+QUEUED", "SET", "balance", "0")
+	expectLine(t, conn, r, "*-1", "EXEC")
+	expectLine(t, conn, r, "$3", "GET", "balance")
+	expectLine(t, conn, r, "101")
+
+	// EXEC 释放监视：未被修改时事务正常执行
+	expectLine(t, conn, r, "+OK", "WATCH", "balance")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "SET", "balance", "0")
+	expectLine(t, conn, r, "*1", "EXEC")
+	expectLine(t, conn, r, "+OK")
+
+	// UNWATCH 之后的修改不影响事务
+	expectLine(t, conn, r, "+OK", "WATCH", "balance")
+	expectLine(t, other, or, ":1", "INCR", "balance")
+	expectLine(t, conn, r, "+OK", "UNWATCH")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "INCR", "balance")
+	expectLine(t, conn, r, "*1", "EXEC")
+	expectLine(t, conn, r, ":2")
+
+	// 被监视的键在 EXEC 前过期：事务不执行
+	expectLine(t, conn, r, "+OK", "SET", "lease", "me", "PX", "50")
+	expectLine(t, conn, r, "+OK", "WATCH", "lease")
+	time.Sleep(80 * time.Millisecond)
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "SET", "lease", "you")
+	expectLine(t, conn, r, "*-1", "EXEC")
+	expectLine(t, conn, r, "$-1", "GET", "lease")
+}
+
+// EXEC 执行期间其他连接的命令不会交错
+func TestExecIsAtomic(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	addr := s.ln.Addr().String()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 200; i++ {
+			writeReq(conn, "MULTI")
+			writeReq(conn, "INCR", "a")
+			writeReq(conn, "INCR", "b")
+			writeReq(conn, "EXEC")
+			for j := 0; j < 6; j++ {
+				readLine(r)
+			}
+		}
+	}()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		writeReq(conn, "MGET", "a", "b")
+		got := readArray(t, r)
+		if got[0] != got[1] {
+			t.Fatalf("observed partial transaction: %s", fmt.Sprint(got))
+		}
+	}
+}
+
+// 阻塞的客户端在 EXEC 结束后才被服务，事务中看到自己写入的元素
+func TestExecServesBlockedAfterCommit(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	waiter, wr := dialServer(t, s)
+	defer waiter.Close()
+	if err := writeReq(waiter, "BLPOP", "q", "0"); err != nil {
+		t.Fatal(err)
+	}
+	waitBlockedClients(t, s, 1)
+
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "RPUSH", "q", "x")
+	expectLine(t, conn, r, "+QUEUED", "LLEN", "q")
+	if err := writeReq(conn, "EXEC"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"*2\r\n", ":1\r\n", ":1\r\n"} {
+		if line, _ := readLine(r); line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+	if got := readArray(t, wr); len(got) != 2 || got[0] != "q" || got[1] != "x" {
+		t.Fatalf("expected q/x, got %v", got)
+	}
+	expectLine(t, conn, r, ":0", "LLEN", "q")
+}
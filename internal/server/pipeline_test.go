@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingConn 统计写入连接的次数
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(p)
+}
+
+// pipeline 将多个命令编码为一次写入的请求
+func pipeline(cmds ...[]string) []byte {
+	var b bytes.Buffer
+	for _, parts := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(parts))
+		for _, p := range parts {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(p), p)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestPipelineSingleFlush(t *testing.T) {
+	s := NewServer(":0")
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := &countingConn{Conn: server}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleConn(conn)
+	}()
+	r := bufio.NewReader(client)
+
+	// 一次到达的 16 个命令只产生一次写入
+	var cmds [][]string
+	for i := 0; i < 16; i++ {
+		cmds = append(cmds, []string{"INCR", "n"})
+	}
+	if _, err := client.Write(pipeline(cmds...)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 16; i++ {
+		if line, err := readLine(r); err != nil || line != ":"+strconv.Itoa(i)+"\r\n" {
+			t.Fatalf("reply %d: %q (%v)", i, line, err)
+		}
+	}
+	if n := atomic.LoadInt64(&conn.writes); n != 1 {
+		t.Fatalf("16 pipelined commands: %d writes, want 1", n)
+	}
+
+	// 回复超过阈值时不等读完命令即写出
+	value := strings.Repeat("x", outputFlushThreshold/2)
+	expectLine(t, client, r, "+OK", "SET", "big", value)
+	atomic.StoreInt64(&conn.writes, 0)
+	if _, err := client.Write(pipeline([]string{"GET", "big"}, []string{"GET", "big"}, []string{"GET", "big"}, []string{"GET", "big"})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if got, err := readBulk(r); err != nil || got != value {
+			t.Fatalf("GET %d: %d bytes (%v)", i, len(got), err)
+		}
+	}
+	if n := atomic.LoadInt64(&conn.writes); n < 2 {
+		t.Fatalf("large pipelined replies: %d writes, want at least 2", n)
+	}
+
+	// 连接关闭前写出缓冲中的回复
+	if _, err := client.Write(pipeline([]string{"GET", "n"}, []string{"QUIT"})); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readBulk(r); err != nil || got != "16" {
+		t.Fatalf("GET n: %q (%v)", got, err)
+	}
+	if line, err := readLine(r); err != nil || line != "+OK\r\n" {
+		t.Fatalf("QUIT: %q (%v)", line, err)
+	}
+	<-done
+}
+
+// BenchmarkPipeline 以不同的 pipeline 深度执行 SET，每个操作为一个命令
+func BenchmarkPipeline(b *testing.B) {
+	for _, depth := range []int{1, 16, 128} {
+		b.Run("depth="+strconv.Itoa(depth), func(b *testing.B) {
+			s := startServer(b)
+			defer s.ln.Close()
+			conn, err := net.Dial("tcp", s.ln.Addr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			cmds := make([][]string, depth)
+			for i := range cmds {
+				cmds[i] = []string{"SET", "k", "v"}
+			}
+			req := pipeline(cmds...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i += depth {
+				if _, err := conn.Write(req); err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < depth; j++ {
+					if line, err := r.ReadSlice('\n'); err != nil || string(line) != "+OK\r\n" {
+						b.Fatalf("reply: %q (%v)", line, err)
+					}
+				}
+			}
+		})
+	}
+}
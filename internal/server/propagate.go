@@ -0,0 +1,111 @@
+package server
+
+import (
+	"strings"
+
+	"redisx/internal/aof"
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+)
+
+// exclusiveCommands 为需要在 Exclusive 中执行的服务器命令：它们会改变写命令的
+// 传播方式（开始 AOF 重写、成为副本），必须与写命令的执行互斥；MIGRATE 在等待
+// 目标节点确认期间不允许其他命令修改被迁移的键
+var exclusiveCommands = map[string]bool{
+	"BGREWRITEAOF": true, "REPLICAOF": true, "SLAVEOF": true, "MIGRATE": true,
+}
+
+// propagating 报告写命令是否需要传播（写入 AOF 或复制流）。开启后不会再关闭。
+func (s *Server) propagating() bool {
+	return s.aof != nil || s.replication.backlog.Load() != nil
+}
+
+// call 执行单个非阻塞命令。需要传播时写命令独占执行，使命令在 AOF 与复制流中
+// 的顺序与执行顺序一致。
+func (s *Server) call(c *client, cmd string, args [][]byte) protocol.Reply {
+	var resp protocol.Reply
+	write := command.IsWrite(cmd)
+	if write && s.raft.node != nil {
+		return s.raftCall(c, cmd, args)
+	}
+	if !exclusiveCommands[strings.ToUpper(cmd)] && !(write && s.propagating()) {
+		retry := false
+		s.store.Shared(func() {
+			if write {
+				// 等待期间可能开始了复制，写命令改为独占执行以便传播
+				if s.propagating() {
+					retry = true
+					return
+				}
+				if resp = s.minReplicasReply(); resp != nil {
+					return
+				}
+			}
+			resp = s.execute(c, cmd, args)
+		})
+		if !retry {
+			return resp
+		}
+	}
+	s.store.Exclusive(func() {
+		if write {
+			if resp = s.denyWrite(); resp != nil {
+				return
+			}
+		}
+		prior := s.store.TakePropagated()
+		resp = s.execute(c, cmd, args)
+		if s.propagating() {
+			s.propagate(c, prior, command.Propagate(s.store, cmd, protocol.ArgStrings(args), resp))
+		}
+	})
+	return resp
+}
+
+// denyWrite 返回拒绝写命令的回复：只读副本返回 READONLY，AOF 写入失败时返回
+// MISCONF，健康的副本不足时返回 NOREPLICAS；允许写入时返回 nil
+func (s *Server) denyWrite() protocol.Reply {
+	if s.isReplica() {
+		return readonlyReply
+	}
+	if resp := s.misconfReply(); resp != nil {
+		return resp
+	}
+	return s.minReplicasReply()
+}
+
+// propagate 依次传播 prior（此前阻塞命令记录的写入）、cmds 以及执行期间被唤醒
+// 的阻塞命令的写入，并将 c 的写偏移（供 WAIT 使用）更新为复制流末尾。调用方需在
+// Exclusive 中调用。
+func (s *Server) propagate(c *client, prior, cmds [][]string) {
+	cmds = append(prior, cmds...)
+	cmds = append(cmds, s.store.TakePropagated()...)
+	if s.aof != nil {
+		s.feedAOF(cmds)
+	}
+	s.feedReplicas(cmds)
+	if b := s.replication.backlog.Load(); b != nil {
+		c.woff = b.Offset()
+	}
+}
+
+// feedReplicas 将命令写入复制流；尚未开始复制时忽略。调用方需在 Exclusive 中调用。
+func (s *Server) feedReplicas(cmds [][]string) {
+	b := s.replication.backlog.Load()
+	if b == nil || len(cmds) == 0 {
+		return
+	}
+	var buf []byte
+	for _, cmd := range cmds {
+		buf = aof.AppendCommand(buf, cmd)
+	}
+	b.Append(buf)
+}
+
+// flushPropagated 传播阻塞命令记录的写入，在回复 c 的阻塞命令前调用
+func (s *Server) flushPropagated(c *client) {
+	if !s.propagating() {
+		return
+	}
+	s.store.Exclusive(func() { s.propagate(c, nil, nil) })
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"redisx/internal/protocol"
+	"redisx/internal/pubsub"
+)
+
+// defaultPubSubOutputLimit 为订阅客户端输出队列的默认上限（与 Redis 的 pubsub 硬限制一致）
+const defaultPubSubOutputLimit = 32 << 20
+
+// subscribeKinds 描述三类订阅命令对应的 Hub 操作
+var subscribeKinds = map[string]struct {
+	reply string
+	shard bool
+	op    func(h *pubsub.Hub, s *pubsub.Subscriber, name string) int
+	all   func(h *pubsub.Hub, s *pubsub.Subscriber) []string
+}{
+	"SUBSCRIBE":    {"subscribe", false, (*pubsub.Hub).Subscribe, nil},
+	"PSUBSCRIBE":   {"psubscribe", false, (*pubsub.Hub).PSubscribe, nil},
+	"SSUBSCRIBE":   {"ssubscribe", true, (*pubsub.Hub).SSubscribe, nil},
+	"UNSUBSCRIBE":  {"unsubscribe", false, (*pubsub.Hub).Unsubscribe, (*pubsub.Hub).Channels},
+	"PUNSUBSCRIBE": {"punsubscribe", false, (*pubsub.Hub).PUnsubscribe, (*pubsub.Hub).Patterns},
+	"SUNSUBSCRIBE": {"sunsubscribe", true, (*pubsub.Hub).SUnsubscribe, (*pubsub.Hub).ShardChannels},
+}
+
+// subscriptionReply 返回 [kind, name, count]，RESP3 中为 push；null 表示频道为
+// null（无订阅时退订全部）
+func subscriptionReply(kind, name string, count int, null bool) protocol.Reply {
+	var channel protocol.Reply = protocol.Bulk(name)
+	if null {
+		channel = protocol.NullBulk
+	}
+	return protocol.Push{protocol.Bulk(kind), channel, protocol.Integer(count)}
+}
+
+// enterSubscriberMode 为连接创建订阅者并启动写出 goroutine；输出队列溢出时断开连接
+func (s *Server) enterSubscriberMode(c *client) {
+	if c.sub != nil {
+		return
+	}
+	// 此后回复经由订阅者的队列写出，先写出缓冲中的回复以保持顺序
+	c.out.Flush()
+	conn := c.conn
+	c.sub = pubsub.NewSubscriber(s.PubSubOutputLimit, func() {
+		log.Printf("closing subscriber %s: output buffer limit exceeded", conn.RemoteAddr())
+		conn.Close()
+	})
+	c.sub.SetRESP3(c.out.Proto == protocol.RESP3)
+	go c.sub.Run(conn)
+}
+
+// leaveSubscriberMode 在没有任何订阅时退出订阅模式：写完队列中的数据后恢复直接写连接。
+// 队列未能写完时返回错误，连接的输出已不完整，应关闭连接
+func (s *Server) leaveSubscriberMode(c *client) error {
+	if c.sub == nil || s.pubsub.Count(c.sub) > 0 || s.pubsub.ShardCount(c.sub) > 0 {
+		return nil
+	}
+	// 与 closeSubscriber 相同，避免不读取数据的客户端使命令处理无限期阻塞
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	err := c.sub.Close()
+	c.sub = nil
+	_ = c.conn.SetWriteDeadline(time.Time{})
+	return err
+}
+
+// closeSubscriber 在连接结束时清理订阅关系并尽量写出剩余回复
+func (s *Server) closeSubscriber(c *client) {
+	if c.sub == nil {
+		return
+	}
+	s.pubsub.RemoveAll(c.sub)
+	// 避免不读取数据的客户端使清理无限期阻塞
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.sub.Close()
+	c.sub = nil
+}
+
+// handlePubSub 处理订阅相关命令以及订阅模式下的命令限制（PUBLISH 等由 execute 执行）。
+// 返回 handled 表示命令已处理，quit 表示应关闭连接。
+func (s *Server) handlePubSub(c *client, cmd string, argv [][]byte) (handled, quit bool) {
+	name := strings.ToUpper(cmd)
+	if kind, ok := subscribeKinds[name]; ok {
+		args := protocol.ArgStrings(argv)
+		subscribe := kind.all == nil
+		if subscribe && len(args) == 0 {
+			c.write(protocol.WrongArgs(strings.ToLower(cmd)))
+			return true, false
+		}
+		if subscribe {
+			s.enterSubscriberMode(c)
+		}
+		if c.sub == nil {
+			// 未订阅任何频道时退订：回复 null 频道与 0
+			if len(args) == 0 {
+				c.write(subscriptionReply(kind.reply, "", 0, true))
+			}
+			for _, ch := range args {
+				c.write(subscriptionReply(kind.reply, ch, 0, false))
+			}
+			return true, false
+		}
+		targets := args
+		if len(targets) == 0 {
+			targets = kind.all(s.pubsub, c.sub)
+			if len(targets) == 0 {
+				count := s.pubsub.Count(c.sub)
+				if kind.shard {
+					count = s.pubsub.ShardCount(c.sub)
+				}
+				c.write(subscriptionReply(kind.reply, "", count, true))
+			}
+		}
+		for _, ch := range targets {
+			c.write(subscriptionReply(kind.reply, ch, kind.op(s.pubsub, c.sub, ch), false))
+		}
+		if !subscribe && s.leaveSubscriberMode(c) != nil {
+			return true, true
+		}
+		return true, false
+	}
+
+	if c.sub != nil && c.out.Proto < protocol.RESP3 {
+		// RESP2 的订阅模式下只允许订阅相关命令、PING 与 QUIT；RESP3 的推送消息
+		// 与回复类型不同，可以执行任何命令
+		switch name {
+		case "PING":
+			msg := ""
+			if len(argv) > 0 {
+				msg = string(argv[0])
+			}
+			c.write(protocol.BulkStrings{"pong", msg})
+		case "QUIT":
+			c.write(protocol.OK)
+			return true, true
+		default:
+			c.write(protocol.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd)))
+		}
+		return true, false
+	}
+	return false, false
+}
+
+// publish 实现 PUBLISH/SPUBLISH，返回接收到消息的订阅者数量
+func (s *Server) publish(cmd string, args []string) protocol.Reply {
+	if len(args) != 2 {
+		return protocol.WrongArgs(strings.ToLower(cmd))
+	}
+	if strings.ToUpper(cmd) == "PUBLISH" {
+		return protocol.Integer(s.pubsub.Publish(args[0], args[1]))
+	}
+	return protocol.Integer(s.pubsub.SPublish(args[0], args[1]))
+}
+
+// pubsubCommand 实现 PUBSUB CHANNELS|NUMSUB|NUMPAT|SHARDCHANNELS|SHARDNUMSUB
+func (s *Server) pubsubCommand(args []string) protocol.Reply {
+	if len(args) == 0 {
+		return protocol.WrongArgs("pubsub")
+	}
+	switch sub := strings.ToUpper(args[0]); {
+	case (sub == "CHANNELS" || sub == "SHARDCHANNELS") && len(args) <= 2:
+		pattern := ""
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+		if sub == "CHANNELS" {
+			return protocol.BulkStrings(s.pubsub.ActiveChannels(pattern))
+		}
+		return protocol.BulkStrings(s.pubsub.ActiveShardChannels(pattern))
+	case sub == "NUMSUB" || sub == "SHARDNUMSUB":
+		channels := args[1:]
+		var counts []int
+		if sub == "NUMSUB" {
+			counts = s.pubsub.NumSub(channels)
+		} else {
+			counts = s.pubsub.ShardNumSub(channels)
+		}
+		out := make(protocol.Map, 0, 2*len(channels))
+		for i, ch := range channels {
+			out = append(out, protocol.Bulk(ch), protocol.Integer(counts[i]))
+		}
+		return out
+	case sub == "NUMPAT" && len(args) == 1:
+		return protocol.Integer(s.pubsub.NumPat())
+	}
+	return protocol.Errorf("ERR unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP.", args[0])
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readArray 读取一个由 bulk string / 整数组成的数组回复
+func readArray(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	header, err := readLine(r)
+	if err != nil {
+		t.Fatalf("read array header: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "*")))
+	if err != nil || header[0] != '*' {
+		t.Fatalf("expected array, got %q", header)
+	}
+	out := make([]string, n)
+	for i := range out {
+		b, _ := r.Peek(1)
+		if len(b) > 0 && b[0] == ':' {
+			line, _ := readLine(r)
+			out[i] = strings.TrimSpace(line)
+			continue
+		}
+		if out[i], err = readBulk(r); err != nil {
+			t.Fatalf("read element: %v", err)
+		}
+	}
+	return out
+}
+
+func TestPubSubDelivery(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	sub, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	sr := bufio.NewReader(sub)
+	writeReq(sub, "SUBSCRIBE", "news")
+	if got := readArray(t, sr); fmt.Sprint(got) != "[subscribe news :1]" {
+		t.Fatalf("unexpected subscribe reply %v", got)
+	}
+	writeReq(sub, "PSUBSCRIBE", "n*")
+	if got := readArray(t, sr); fmt.Sprint(got) != "[psubscribe n* :2]" {
+		t.Fatalf("unexpected psubscribe reply %v", got)
+	}
+	writeReq(sub, "GET", "k")
+	if line, _ := readLine(sr); !strings.HasPrefix(line, "-ERR Can't execute 'get'") {
+		t.Fatalf("expected subscriber mode error, got %q", line)
+	}
+
+	pub, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	pr := bufio.NewReader(pub)
+	writeReq(pub, "PUBLISH", "news", "hello")
+	if line, _ := readLine(pr); line != ":2\r\n" {
+		t.Fatalf("expected 2 receivers, got %q", line)
+	}
+	got := []string{fmt.Sprint(readArray(t, sr)), fmt.Sprint(readArray(t, sr))}
+	if !(got[0] == "[message news hello]" && got[1] == "[pmessage n* news hello]") &&
+		!(got[1] == "[message news hello]" && got[0] == "[pmessage n* news hello]") {
+		t.Fatalf("unexpected pushes %v", got)
+	}
+	writeReq(pub, "PUBSUB", "NUMSUB", "news", "other")
+	if got := readArray(t, pr); fmt.Sprint(got) != "[news :1 other :0]" {
+		t.Fatalf("unexpected NUMSUB reply %v", got)
+	}
+	writeReq(pub, "PUBSUB", "NUMPAT")
+	if line, _ := readLine(pr); line != ":1\r\n" {
+		t.Fatalf("unexpected NUMPAT reply %q", line)
+	}
+
+	// 退订全部后恢复普通命令
+	writeReq(sub, "UNSUBSCRIBE")
+	readArray(t, sr)
+	writeReq(sub, "PUNSUBSCRIBE")
+	if got := readArray(t, sr); fmt.Sprint(got) != "[punsubscribe n* :0]" {
+		t.Fatalf("unexpected punsubscribe reply %v", got)
+	}
+	writeReq(sub, "PING")
+	if line, _ := readLine(sr); line != "+PONG\r\n" {
+		t.Fatalf("expected normal PING reply, got %q", line)
+	}
+}
+
+func TestSlowSubscriberDisconnected(t *testing.T) {
+	s := newTestServer(t)
+	s.PubSubOutputLimit = 64 << 10
+	startConfigured(t, s)
+	defer s.ln.Close()
+	sub, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	sr := bufio.NewReader(sub)
+	writeReq(sub, "SUBSCRIBE", "flood")
+	readArray(t, sr)
+
+	pub, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	pr := bufio.NewReader(pub)
+	payload := strings.Repeat("x", 16<<10)
+	// 订阅者不读取数据；PUBLISH 不应被阻塞，订阅者最终被断开
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pub.SetDeadline(time.Now().Add(time.Second))
+		writeReq(pub, "PUBLISH", "flood", payload)
+		line, err := readLine(pr)
+		if err != nil {
+			t.Fatalf("PUBLISH stalled: %v", err)
+		}
+		if line == ":0\r\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("slow subscriber was never disconnected")
+		}
+	}
+	// 读完内核中残留的数据后应看到连接关闭（EOF 或 reset），而不是超时
+	sub.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, sr); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatalf("expected subscriber connection to be closed, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"redisx/internal/aof"
+	"redisx/internal/command"
+	"redisx/internal/protocol"
+	"redisx/internal/raft"
+	"redisx/internal/storage"
+)
+
+// Raft 模式：写命令在领导者上执行后，其效果（与 AOF、复制流相同的确定性命令）作为
+// 一个日志条目提交，多数节点确认后才回复客户端；提交失败时用执行前保存的键恢复
+// 数据。其他节点只通过应用已提交的条目修改数据，客户端的写命令收到 NOTLEADER
+// 重定向，读命令在本地执行。快照复用存储的快照格式。
+//
+// 写命令在 Exclusive 中执行并等待提交，因此领导者上的写入按日志顺序串行执行，
+// 已执行的写入与日志之间没有其他写入交错。RAFT 命令不经过 Shared/Exclusive，
+// 等待提交期间仍能处理。
+//
+// 节点间的 RPC 只在单独的节点间端口（与 Redis 集群总线一样，默认为客户端端口加
+// 10000）上处理，客户端端口不接受 RPC，客户端无法伪造投票或日志条目。节点间端口
+// 只应对其他节点开放。
+
+const (
+	defaultRaftDir     = "redisx-raft"
+	defaultRaftTimeout = time.Second
+	// defaultRaftSnapshotThreshold 为默认的快照间隔（日志条目数）
+	defaultRaftSnapshotThreshold = 1024
+	// raftCommitTimeoutFactor 为等待提交的时间相对选举超时的倍数；联系不上多数
+	// 节点时领导者在一个选举超时内退位，等待随之结束
+	raftCommitTimeoutFactor = 3
+	// raftBusPortOffset 为默认的节点间端口相对客户端端口的偏移
+	raftBusPortOffset = 10000
+)
+
+const (
+	raftDisabledReply protocol.Error = "ERR This instance has Raft mode disabled"
+	noLeaderReply     protocol.Error = "NOLEADER No Raft leader elected"
+	raftPendingReply  protocol.Error = "TRYAGAIN Raft log entries of an earlier term are still being applied"
+	raftUnsupported   protocol.Error = "ERR Command not supported in Raft mode"
+	raftRPCOnBusReply protocol.Error = "ERR Raft RPCs are only accepted on the Raft bus port"
+)
+
+type raftState struct {
+	node *raft.Node
+	tr   *raft.TCPTransport
+	// ln 为节点间端口的监听
+	ln net.Listener
+	// index 为存储已反映的最后一个命令条目的索引；只在 Exclusive 中写入
+	index uint64
+}
+
+// startRaft 开始在节点间端口监听，并创建、启动 Raft 节点。本节点地址默认取
+// 127.0.0.1 与 TCP 监听端口，只监听 Unix 套接字时须指定 RaftAddr；节点间端口
+// 默认在 TCP 监听的主机上取客户端端口加 raftBusPortOffset。节点 ID 为
+// host:port@busport（见 raft.SplitID）。
+func (s *Server) startRaft() error {
+	addr := s.RaftAddr
+	tcp, hasTCP := s.tcpAddr()
+	if addr == "" {
+		if !hasTCP {
+			return errors.New("raft: no TCP listener, RaftAddr must be set")
+		}
+		host := "127.0.0.1"
+		if !tcp.IP.IsUnspecified() {
+			host = tcp.IP.String()
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(tcp.Port))
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("raft: invalid RaftAddr: %w", err)
+	}
+	busAddr := s.RaftBusAddr
+	if busAddr == "" {
+		p, _ := strconv.Atoi(port)
+		if p <= 0 || p+raftBusPortOffset > 65535 {
+			return fmt.Errorf("raft: port %s has no default bus port, RaftBusAddr must be set", port)
+		}
+		bind := ""
+		if hasTCP && !tcp.IP.IsUnspecified() {
+			bind = tcp.IP.String()
+		}
+		busAddr = net.JoinHostPort(bind, strconv.Itoa(p+raftBusPortOffset))
+	}
+	ln, err := net.Listen("tcp", busAddr)
+	if err != nil {
+		return fmt.Errorf("raft: %w", err)
+	}
+	id := addr + "@" + strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	s.raft.tr = raft.NewTCPTransport(s.RaftTimeout)
+	n, err := raft.NewNode(id, s.RaftDir, raftFSM{s}, s.raft.tr)
+	if err != nil {
+		ln.Close()
+		return fmt.Errorf("raft: %w", err)
+	}
+	n.ElectionTimeout = s.RaftTimeout
+	n.SnapshotThreshold = s.RaftSnapshotThreshold
+	s.raft.node, s.raft.ln = n, ln
+	n.Start()
+	go s.serveRaftBus(ln)
+	log.Printf("raft: node %s started, bus listening on %s", id, ln.Addr())
+	return nil
+}
+
+// serveRaftBus 接受其他节点的连接直到 ln 被关闭
+func (s *Server) serveRaftBus(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Println("raft: accept error:", err)
+			continue
+		}
+		go s.handleRaftPeer(conn)
+	}
+}
+
+// handleRaftPeer 处理一个节点间连接：只接受 RAFT <rpc> <payload>，其他请求返回
+// 错误；协议错误时关闭连接
+func (s *Server) handleRaftPeer(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	parser := protocol.NewParser(reader)
+	out := protocol.NewWriter(conn)
+	for {
+		if reader.Buffered() == 0 {
+			if err := out.Flush(); err != nil {
+				return
+			}
+		}
+		argv, err := parser.Next()
+		if err != nil {
+			return
+		}
+		if len(argv) != 3 || command.Name(argv[0]) != "RAFT" {
+			out.Error("ERR Only Raft RPCs are accepted on this port")
+			continue
+		}
+		// HandleRPC 解码时复制数据，不引用解析器的缓冲区
+		reply, err := s.raft.node.HandleRPC(strings.ToUpper(string(argv[1])), argv[2])
+		if err != nil {
+			out.Error("ERR " + err.Error())
+			continue
+		}
+		out.BulkBytes(reply)
+	}
+}
+
+// raftFSM 将已提交的条目应用到存储
+type raftFSM struct{ s *Server }
+
+// Apply 应用一个条目中的命令；领导者在提交前已经执行过的条目跳过
+func (f raftFSM) Apply(index uint64, data []byte) {
+	s := f.s
+	s.store.Exclusive(func() {
+		if index <= s.raft.index {
+			return
+		}
+		_, _, err := aof.Load(bytes.NewReader(data), s.store, func(cmd string, args []string) error {
+			if resp, handled, err := s.router.Handle(cmd, s.store, protocol.Args(args)); !handled || err != nil || protocol.IsError(resp) {
+				log.Printf("raft: applying %s failed: %s%v", cmd, resp, err)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("raft: entry %d: %v", index, err)
+		}
+		s.raft.index = index
+	})
+}
+
+func (f raftFSM) Snapshot() ([]byte, uint64, error) {
+	s := f.s
+	var sn *storage.Snapshot
+	var index uint64
+	s.store.Shared(func() {
+		sn, index = s.store.Snapshot(), s.raft.index
+	})
+	defer sn.Release()
+	var b bytes.Buffer
+	if _, err := sn.WriteTo(&b); err != nil {
+		return nil, 0, err
+	}
+	return b.Bytes(), index, nil
+}
+
+func (f raftFSM) Restore(data []byte, index uint64) error {
+	s := f.s
+	var err error
+	s.store.Exclusive(func() {
+		var keys int
+		if keys, err = s.store.LoadSnapshot(bytes.NewReader(data)); err == nil {
+			s.raft.index = index
+			log.Printf("raft: loaded snapshot at index %d with %d keys", index, keys)
+		}
+	})
+	return err
+}
+
+// savedKey 为写命令执行前键的值，提交失败时据此恢复
+type savedKey struct {
+	key      string
+	payload  string
+	expireAt int64
+	exists   bool
+}
+
+// saveKeys 保存 keys 的当前值；调用方需在 Exclusive 中调用
+func (s *Server) saveKeys(keys []string) []savedKey {
+	saved := make([]savedKey, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		sk := savedKey{key: k}
+		sk.payload, sk.exists = s.store.Dump(k)
+		sk.expireAt = max(s.store.PExpireTime(k), 0)
+		saved = append(saved, sk)
+	}
+	return saved
+}
+
+// restoreKeys 将键恢复为 saveKeys 时的值；调用方需在 Exclusive 中调用
+func (s *Server) restoreKeys(saved []savedKey) {
+	for _, sk := range saved {
+		if !sk.exists {
+			s.store.Delete(sk.key)
+		} else if err := s.store.Restore(sk.key, sk.payload, sk.expireAt, true); err != nil {
+			log.Printf("raft: restoring %s after a failed commit: %v", sk.key, err)
+		}
+	}
+}
+
+// raftWrite 执行写操作 run 并经 Raft 日志提交其效果后返回回复。run 在 Exclusive
+// 中执行，返回回复与需要提交的命令；keys 为 run 可能修改的键。本节点成为领导者
+// 后尚未应用此前任期的条目时，先等待其应用再执行。
+func (s *Server) raftWrite(keys []string, run func() (protocol.Reply, [][]string)) protocol.Reply {
+	for attempt := 0; ; attempt++ {
+		var resp protocol.Reply
+		pending := false
+		s.store.Exclusive(func() {
+			err := s.raft.node.CanPropose(s.raft.index)
+			if errors.Is(err, raft.ErrPending) && attempt == 0 {
+				pending = true
+				return
+			}
+			if err != nil {
+				resp = s.raftErrorReply(err)
+				return
+			}
+			resp = s.raftCommit(keys, run)
+		})
+		if !pending {
+			return resp
+		}
+		_ = s.raft.node.WaitApplied(s.raft.node.Status().LastIndex, s.RaftTimeout)
+	}
+}
+
+// raftCommit 执行 run 并等待其效果提交；调用方需在 Exclusive 中调用
+func (s *Server) raftCommit(keys []string, run func() (protocol.Reply, [][]string)) protocol.Reply {
+	saved := s.saveKeys(keys)
+	resp, cmds := run()
+	if len(cmds) == 0 {
+		return resp
+	}
+	var data []byte
+	for _, cmd := range cmds {
+		data = aof.AppendCommand(data, cmd)
+	}
+	n := s.raft.node
+	index, term, err := n.Propose(data)
+	if err == nil {
+		err = n.Wait(index, term, raftCommitTimeoutFactor*s.RaftTimeout)
+	}
+	if err != nil {
+		// 条目仍可能在之后被提交，届时由 raftFSM.Apply 重新应用
+		s.restoreKeys(saved)
+		return s.raftErrorReply(err)
+	}
+	s.raft.index = index
+	return resp
+}
+
+// raftErrorReply 将 Raft 的错误转换为回复：非领导者返回 NOTLEADER 与领导者地址
+func (s *Server) raftErrorReply(err error) protocol.Reply {
+	switch {
+	case errors.Is(err, raft.ErrNotLeader):
+		if leader := s.raft.node.Leader(); leader != "" && leader != s.raft.node.ID() {
+			if client, _, ok := raft.SplitID(leader); ok {
+				leader = client
+			}
+			return protocol.Error("NOTLEADER " + leader)
+		}
+		return noLeaderReply
+	case errors.Is(err, raft.ErrPending):
+		return raftPendingReply
+	}
+	return protocol.Errorf("TRYAGAIN Write was not committed, its outcome is unknown: %v", err)
+}
+
+// raftCall 在 Raft 模式下执行单个写命令
+func (s *Server) raftCall(c *client, cmd string, argv [][]byte) protocol.Reply {
+	args := protocol.ArgStrings(argv)
+	return s.raftWrite(command.Keys(cmd, args), func() (protocol.Reply, [][]string) {
+		resp := s.execute(c, cmd, argv)
+		return resp, command.Propagate(s.store, cmd, args, resp)
+	})
+}
+
+// raftExec 在 Raft 模式下执行包含写命令的事务，事务的效果作为一个条目提交
+func (s *Server) raftExec(c *client) protocol.Reply {
+	var keys []string
+	for _, q := range c.queue {
+		if command.IsWrite(q.name) {
+			keys = append(keys, command.Keys(q.name, protocol.ArgStrings(q.args))...)
+		}
+	}
+	return s.raftWrite(keys, func() (protocol.Reply, [][]string) {
+		if len(c.watched) > 0 && s.store.Touched(c.watched) {
+			return protocol.NullArray, nil
+		}
+		out := make(protocol.Array, len(c.queue))
+		var cmds [][]string
+		for i, q := range c.queue {
+			out[i] = s.execute(c, q.name, q.args)
+			cmds = append(cmds, command.Propagate(s.store, q.name, protocol.ArgStrings(q.args), out[i])...)
+		}
+		if len(cmds) > 1 {
+			cmds = append(append([][]string{{"MULTI"}}, cmds...), []string{"EXEC"})
+		}
+		return out, cmds
+	})
+}
+
+// raftCommand 实现客户端端口上的 RAFT 命令：INFO、INIT（以本节点为唯一成员创建
+// 集群）、ADDNODE/REMOVENODE（在领导者上增删成员，参数为节点 ID）。节点间的 RPC
+// 只在节点间端口上处理，见 handleRaftPeer。
+func (s *Server) raftCommand(args []string) protocol.Reply {
+	if s.raft.node == nil {
+		return raftDisabledReply
+	}
+	if len(args) == 0 {
+		return protocol.WrongArgs("raft")
+	}
+	n := s.raft.node
+	sub := strings.ToUpper(args[0])
+	switch sub {
+	case "REQUESTVOTE", "APPENDENTRIES", "INSTALLSNAPSHOT":
+		return raftRPCOnBusReply
+	case "INFO":
+		if len(args) != 1 {
+			break
+		}
+		return protocol.Verbatim(s.raftInfo())
+	case "INIT":
+		if len(args) != 1 {
+			break
+		}
+		if err := n.Bootstrap(); err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.OK
+	case "ADDNODE", "REMOVENODE":
+		if len(args) != 2 {
+			break
+		}
+		if _, _, ok := raft.SplitID(args[1]); !ok {
+			return protocol.Error("ERR Invalid node ID, expected host:port@busport")
+		}
+		change := n.AddNode
+		if sub == "REMOVENODE" {
+			change = n.RemoveNode
+		}
+		index, term, err := change(args[1])
+		if err == nil {
+			err = n.Wait(index, term, raftCommitTimeoutFactor*s.RaftTimeout)
+		}
+		switch {
+		case errors.Is(err, raft.ErrNotLeader):
+			return s.raftErrorReply(err)
+		case err != nil:
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR Unknown subcommand '%s'", args[0])
+	}
+	return protocol.WrongArgs("raft|" + strings.ToLower(sub))
+}
+
+// raftInfo 返回 INFO 的 Raft 部分
+func (s *Server) raftInfo() string {
+	if s.raft.node == nil {
+		return "# Raft\r\nraft_enabled:0\r\n"
+	}
+	st := s.raft.node.Status()
+	return fmt.Sprintf("# Raft\r\nraft_enabled:1\r\nraft_node:%s\r\nraft_role:%s\r\nraft_term:%d\r\nraft_leader:%s\r\n"+
+		"raft_members:%s\r\nraft_commit_index:%d\r\nraft_last_applied:%d\r\nraft_last_index:%d\r\nraft_snapshot_index:%d\r\n",
+		st.ID, st.Role, st.Term, st.Leader, strings.Join(st.Members, ","), st.CommitIndex, st.LastApplied, st.LastIndex, st.SnapshotIndex)
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startRaftNode 启动一个 Raft 模式的服务器；测试结束时停止
+func startRaftNode(t *testing.T, threshold uint64) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	s.RaftEnabled = true
+	s.RaftDir = t.TempDir()
+	s.RaftBusAddr = "127.0.0.1:0"
+	s.RaftTimeout = 500 * time.Millisecond
+	s.RaftSnapshotThreshold = threshold
+	startConfigured(t, s)
+	// Raft 节点在开始接受连接之前创建
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "+PONG", "PING")
+	t.Cleanup(func() { stopRaftNode(s) })
+	return s
+}
+
+// stopRaftNode 模拟节点宕机：不再接受连接，Raft 节点停止收发 RPC
+func stopRaftNode(s *Server) {
+	s.ln.Close()
+	s.raft.ln.Close()
+	s.raft.node.Stop()
+}
+
+// raftAddr 为节点的客户端地址，raftID 为其节点 ID（带节点间端口）
+func raftAddr(s *Server) string { return fmt.Sprintf("127.0.0.1:%d", nodePort(s)) }
+func raftID(s *Server) string   { return s.raft.node.ID() }
+
+// startRaftCluster 在 nodes[0] 上创建集群并加入其余节点
+func startRaftCluster(t *testing.T, nodes ...*Server) {
+	t.Helper()
+	conn, r := dialServer(t, nodes[0])
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "RAFT", "INIT")
+	waitFor(t, "initial leader", func() bool { return infoField(t, conn, r, "raft_role") == "leader" })
+	for _, n := range nodes[1:] {
+		expectLine(t, conn, r, "+OK", "RAFT", "ADDNODE", raftID(n))
+	}
+}
+
+// raftGet 读取节点本地的值
+func raftGet(t *testing.T, s *Server, key string) string {
+	t.Helper()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	writeReq(conn, "GET", key)
+	v, err := readBulk(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestRaftReplicationAndFailover(t *testing.T) {
+	nodes := []*Server{startRaftNode(t, 0), startRaftNode(t, 0), startRaftNode(t, 0)}
+	startRaftCluster(t, nodes...)
+	leader := nodes[0]
+
+	conn, r := dialServer(t, leader)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "SET", "k", "v1")
+	expectLine(t, conn, r, ":2", "SADD", "s", "a", "b")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "SET", "n", "1")
+	expectLine(t, conn, r, "+QUEUED", "INCR", "n")
+	expectLine(t, conn, r, "*2", "EXEC")
+	expectLine(t, conn, r, "+OK")
+	expectLine(t, conn, r, ":2")
+	// 阻塞命令不会阻塞
+	expectLine(t, conn, r, "*-1", "BLPOP", "nolist", "0")
+	for _, n := range nodes[1:] {
+		waitFor(t, "replicated writes", func() bool { return raftGet(t, n, "k") == "v1" && raftGet(t, n, "n") == "2" })
+	}
+
+	// 跟随者拒绝写命令并指向领导者，读命令在本地执行
+	fconn, fr := dialServer(t, nodes[1])
+	defer fconn.Close()
+	expectLine(t, fconn, fr, "-NOTLEADER "+raftAddr(leader), "SET", "k", "x")
+	expectLine(t, fconn, fr, "+OK", "MULTI")
+	expectLine(t, fconn, fr, "+QUEUED", "SET", "k", "x")
+	expectLine(t, fconn, fr, "-NOTLEADER "+raftAddr(leader), "EXEC")
+	expectLine(t, fconn, fr, ":1", "SISMEMBER", "s", "a")
+	expectLine(t, fconn, fr, "-ERR Command not supported in Raft mode", "REPLICAOF", "127.0.0.1", "1")
+
+	// 领导者宕机后其余两个节点选出新的领导者，已提交的数据不丢失
+	stopRaftNode(leader)
+	var newLeader, follower *Server
+	waitFor(t, "new leader", func() bool {
+		for i, n := range nodes[1:] {
+			if n.raft.node.Status().Role == "leader" {
+				newLeader, follower = n, nodes[2-i]
+				return true
+			}
+		}
+		return false
+	})
+	nconn, nr := dialServer(t, newLeader)
+	defer nconn.Close()
+	if got := raftGet(t, newLeader, "k"); got != "v1" {
+		t.Fatalf("k on the new leader = %q", got)
+	}
+	expectLine(t, nconn, nr, "+OK", "SET", "k", "v2")
+	waitFor(t, "write on the new leader", func() bool { return raftGet(t, follower, "k") == "v2" })
+	waitFor(t, "redirect to the new leader", func() bool {
+		return follower.raft.node.Leader() == raftID(newLeader)
+	})
+	fconn2, fr2 := dialServer(t, follower)
+	defer fconn2.Close()
+	expectLine(t, fconn2, fr2, "-NOTLEADER "+raftAddr(newLeader), "SET", "k", "x")
+}
+
+func TestRaftSnapshotCatchUp(t *testing.T) {
+	nodes := []*Server{startRaftNode(t, 16), startRaftNode(t, 16), startRaftNode(t, 16)}
+	startRaftCluster(t, nodes...)
+	conn, r := dialServer(t, nodes[0])
+	defer conn.Close()
+	for i := 0; i < 50; i++ {
+		expectLine(t, conn, r, "+OK", "SET", "key"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	waitFor(t, "log compaction", func() bool { return infoField(t, conn, r, "raft_snapshot_index") != "0" })
+
+	// 新加入的节点所需的条目已被压缩，通过快照追上
+	late := startRaftNode(t, 16)
+	expectLine(t, conn, r, "+OK", "RAFT", "ADDNODE", raftID(late))
+	waitFor(t, "snapshot install", func() bool { return raftGet(t, late, "key49") == "49" })
+	if got := raftGet(t, late, "key0"); got != "0" {
+		t.Fatalf("key0 on the new node = %q", got)
+	}
+	lconn, lr := dialServer(t, late)
+	defer lconn.Close()
+	if v := infoField(t, lconn, lr, "raft_members"); len(v) == 0 || infoField(t, lconn, lr, "raft_snapshot_index") == "0" {
+		t.Fatalf("new node did not install a snapshot: members %q", v)
+	}
+	expectLine(t, lconn, lr, "-NOTLEADER "+raftAddr(nodes[0]), "SET", "k", "v")
+}
+
+func TestRaftRPCsOnlyOnBusPort(t *testing.T) {
+	s := startRaftNode(t, 0)
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	// 客户端端口不接受 RPC，客户端无法伪造投票或日志条目
+	for _, rpc := range []string{"REQUESTVOTE", "APPENDENTRIES", "INSTALLSNAPSHOT"} {
+		expectLine(t, conn, r, "-ERR Raft RPCs are only accepted on the Raft bus port", "RAFT", rpc, "x")
+	}
+	expectLine(t, conn, r, "-ERR Invalid node ID, expected host:port@busport", "RAFT", "ADDNODE", raftAddr(s))
+
+	// 节点间端口只接受 RPC
+	bus, err := net.Dial("tcp", s.raft.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	br := bufio.NewReader(bus)
+	expectLine(t, bus, br, "-ERR Only Raft RPCs are accepted on this port", "SET", "k", "v")
+	expectLine(t, bus, br, "-ERR Only Raft RPCs are accepted on this port", "RAFT", "INIT")
+	expectLine(t, bus, br, "-ERR unknown raft RPC 'NOSUCH'", "RAFT", "NOSUCH", "x")
+	expectLine(t, conn, r, "$-1", "GET", "k")
+}
@@ -0,0 +1,654 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"redisx/internal/aof"
+	"redisx/internal/protocol"
+	"redisx/internal/repl"
+	"redisx/internal/storage"
+)
+
+// 复制相关的默认配置
+const (
+	defaultReplBacklogSize = 1 << 20
+	defaultReplTimeout     = 60 * time.Second
+	defaultReplicaPriority = 100
+	defaultReplAckPeriod   = time.Second
+)
+
+var (
+	// replPingPeriod 为主节点在复制流中发送 PING 的间隔，副本据此判断连接存活
+	replPingPeriod = 10 * time.Second
+	// replRetryDelay 为复制连接断开后重新连接前的等待时间
+	replRetryDelay = time.Second
+)
+
+const readonlyReply protocol.Error = "READONLY You can't write against a read only replica."
+
+var errLinkClosed = errors.New("replication link closed")
+
+// replState 保存复制状态；除注明外的字段由 mu 保护
+type replState struct {
+	mu sync.Mutex
+	// id 为当前复制流的 ID；id2/offset2 为提升前所属主节点的复制 ID 及其有效的
+	// 最大 PSYNC 偏移，使原主节点的其他副本可以在故障转移后部分重同步
+	id      string
+	id2     string
+	offset2 int64
+	// backlog 在第一个副本连接或本节点成为副本时创建，此后写命令都进入复制流。
+	// 只在 Exclusive 中写入（PING 与 REPLCONF GETACK 也经 feedIfMaster 在其中
+	// 写入），读取无需加锁。
+	backlog  atomic.Pointer[repl.Backlog]
+	replicas map[*replica]struct{}
+	// master 为到主节点的复制连接，nil 表示本节点为主节点
+	master *masterLink
+	// acked 在副本确认新的偏移后关闭，供 WAIT 等待；nil 表示没有等待者
+	acked chan struct{}
+
+	syncFull, syncPartialOK, syncPartialErr int64
+}
+
+// replica 为连接到本节点的副本
+type replica struct {
+	conn      net.Conn
+	ip        string
+	port      int
+	online    bool
+	ackOffset int64
+	ackTime   time.Time
+	done      chan struct{}
+}
+
+// masterLink 为副本到主节点的复制连接
+type masterLink struct {
+	host string
+	port int
+	stop chan struct{}
+
+	mu     sync.Mutex // 保护 conn 与 closed
+	conn   net.Conn
+	closed bool
+	wmu    sync.Mutex // 串行化向主节点的写入（ACK 与握手）
+
+	up      atomic.Bool
+	syncing atomic.Bool
+	lastIO  atomic.Int64 // 最近一次从主节点收到数据的时间（Unix 秒）
+	// txn 缓存复制流中 MULTI 之后、EXEC 之前的命令；只在复制 goroutine 中访问
+	txn [][]string
+}
+
+func (l *masterLink) addr() string { return net.JoinHostPort(l.host, strconv.Itoa(l.port)) }
+
+// close 停止复制连接；之后复制 goroutine 不再重连
+func (l *masterLink) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.closed = true
+	close(l.stop)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+}
+
+// setConn 记录当前连接；连接已被 close 时返回 false
+func (l *masterLink) setConn(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.conn = conn
+	return true
+}
+
+// send 向主节点写一条命令
+func (l *masterLink) send(conn net.Conn, cmd ...string) error {
+	l.wmu.Lock()
+	defer l.wmu.Unlock()
+	_, err := conn.Write(aof.AppendCommand(nil, cmd))
+	return err
+}
+
+// isReplica 报告本节点当前是否为只读副本
+func (s *Server) isReplica() bool {
+	s.replication.mu.Lock()
+	defer s.replication.mu.Unlock()
+	return s.replication.master != nil
+}
+
+// ensureBacklog 创建复制积压缓冲区并开始传播写命令；调用方需在 Exclusive 中调用
+func (s *Server) ensureBacklog() *repl.Backlog {
+	if b := s.replication.backlog.Load(); b != nil {
+		return b
+	}
+	b := repl.NewBacklog(s.ReplBacklogSize, 0)
+	s.replication.backlog.Store(b)
+	s.store.EnablePropagation()
+	go s.pingReplicas()
+	return b
+}
+
+// pingReplicas 在作为主节点且有副本时定期向复制流写入 PING，直到服务器关闭
+func (s *Server) pingReplicas() {
+	tick := time.NewTicker(replPingPeriod)
+	defer tick.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-tick.C:
+		}
+		s.feedIfMaster("PING")
+	}
+}
+
+// feedIfMaster 在 Exclusive 中将 cmd 写入复制流，与写命令的传播串行。本节点已
+// 成为副本（复制流来自主节点，写入会使偏移与主节点不一致）或没有副本时不写入。
+func (s *Server) feedIfMaster(cmd ...string) {
+	s.store.Exclusive(func() {
+		rs := &s.replication
+		rs.mu.Lock()
+		master := rs.master == nil && len(rs.replicas) > 0
+		rs.mu.Unlock()
+		if master {
+			s.feedReplicas([][]string{cmd})
+		}
+	})
+}
+
+// replicaof 实现 REPLICAOF/SLAVEOF；调用方需在 Exclusive 中调用
+func (s *Server) replicaof(args []string) protocol.Reply {
+	if len(args) != 2 {
+		return protocol.WrongArgs("replicaof")
+	}
+	rs := &s.replication
+	if strings.EqualFold(args[0], "NO") && strings.EqualFold(args[1], "ONE") {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if rs.master != nil {
+			rs.master.close()
+			rs.master = nil
+			// 保留原复制 ID，使原主节点的其他副本可以从本节点部分重同步
+			rs.id2, rs.offset2 = rs.id, s.ensureBacklog().Offset()+1
+			rs.id = repl.NewID()
+			log.Printf("replication: promoted to master, new replication ID %s", rs.id)
+		}
+		return protocol.OK
+	}
+	port, err := strconv.Atoi(args[1])
+	if err != nil || port < 0 || port > 65535 {
+		return protocol.Error("ERR Invalid master port")
+	}
+	s.ensureBacklog()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if l := rs.master; l != nil {
+		if l.host == args[0] && l.port == port {
+			return protocol.SimpleString("OK Already connected to specified master")
+		}
+		l.close()
+	}
+	l := &masterLink{host: args[0], port: port, stop: make(chan struct{})}
+	rs.master = l
+	go s.replicationLoop(l)
+	log.Printf("replication: connecting to master %s", l.addr())
+	return protocol.OK
+}
+
+// replicationLoop 维持到主节点的复制连接，断开后等待 replRetryDelay 重连
+func (s *Server) replicationLoop(l *masterLink) {
+	for {
+		err := s.syncWithMaster(l)
+		l.up.Store(false)
+		l.syncing.Store(false)
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+		log.Printf("replication with %s: %v", l.addr(), err)
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(replRetryDelay):
+		}
+	}
+}
+
+// syncWithMaster 完成一次握手与同步，然后持续应用复制流，直到连接断开
+func (s *Server) syncWithMaster(l *masterLink) error {
+	conn, err := net.DialTimeout("tcp", l.addr(), 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !l.setConn(conn) {
+		return errLinkClosed
+	}
+	r := bufio.NewReader(conn)
+	_ = conn.SetDeadline(time.Now().Add(s.ReplTimeout))
+	request := func(cmd ...string) (string, error) {
+		if err := l.send(conn, cmd...); err != nil {
+			return "", err
+		}
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	if reply, err := request("PING"); err != nil || reply != "+PONG" {
+		return fmt.Errorf("unexpected PING reply %q: %v", reply, err)
+	}
+	// 只监听 Unix 套接字时没有可公布的端口，主节点按连接的来源端口显示本节点
+	if addr, ok := s.tcpAddr(); ok {
+		if _, err := request("REPLCONF", "listening-port", strconv.Itoa(addr.Port)); err != nil {
+			return err
+		}
+	}
+	if _, err := request("REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+	// 以本节点的复制 ID 与偏移请求部分重同步；ID 与主节点无关时主节点会回复
+	// FULLRESYNC
+	s.replication.mu.Lock()
+	id := s.replication.id
+	s.replication.mu.Unlock()
+	offset := s.replication.backlog.Load().Offset()
+	reply, err := request("PSYNC", id, strconv.FormatInt(offset+1, 10))
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(reply, "+FULLRESYNC "):
+		f := strings.Fields(reply)
+		if len(f) != 3 {
+			return fmt.Errorf("unexpected PSYNC reply %q", reply)
+		}
+		off, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected PSYNC reply %q", reply)
+		}
+		if err := s.fullSync(l, conn, r, f[1], off); err != nil {
+			return err
+		}
+	case strings.HasPrefix(reply, "+CONTINUE"):
+		newID := strings.TrimSpace(strings.TrimPrefix(reply, "+CONTINUE"))
+		s.replication.mu.Lock()
+		if newID != "" && newID != s.replication.id {
+			// 主节点经过了故障转移：旧 ID 在当前偏移之前仍然有效
+			s.replication.id2, s.replication.offset2 = s.replication.id, offset+1
+			s.replication.id = newID
+		}
+		s.replication.mu.Unlock()
+		log.Printf("replication: partial resync with %s from offset %d", l.addr(), offset)
+	default:
+		return fmt.Errorf("unexpected PSYNC reply %q", reply)
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	l.up.Store(true)
+	l.lastIO.Store(time.Now().Unix())
+	l.txn = nil
+	done := make(chan struct{})
+	defer close(done)
+	go s.sendAcks(l, conn, done)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.ReplTimeout))
+		cmd, args, err := protocol.ParseRequest(r)
+		if err != nil {
+			return err
+		}
+		l.lastIO.Store(time.Now().Unix())
+		s.applyReplicated(l, conn, append([]string{cmd}, args...))
+	}
+}
+
+// fullSync 读取主节点发送的快照并替换本地数据，复制流从 offset 开始
+func (s *Server) fullSync(l *masterLink, conn net.Conn, r *bufio.Reader, id string, offset int64) error {
+	l.syncing.Store(true)
+	defer l.syncing.Store(false)
+	_ = conn.SetDeadline(time.Time{})
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "$")), 10, 64)
+	if !strings.HasPrefix(line, "$") || err != nil || n < 0 {
+		return fmt.Errorf("unexpected snapshot header %q", line)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	start := time.Now()
+	keys := 0
+	s.store.Exclusive(func() {
+		s.replication.mu.Lock()
+		defer s.replication.mu.Unlock()
+		if s.replication.master != l {
+			err = errLinkClosed
+			return
+		}
+		if keys, err = s.store.LoadSnapshot(bytes.NewReader(data)); err != nil {
+			return
+		}
+		s.replication.id, s.replication.id2, s.replication.offset2 = id, "", -1
+		// 复制流的历史已经改变，本节点的副本需要重新全量同步
+		s.replication.backlog.Load().Reset(offset)
+		for rep := range s.replication.replicas {
+			rep.conn.Close()
+		}
+		if s.aof != nil {
+			s.startRewrite()
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("load snapshot from master: %w", err)
+	}
+	log.Printf("replication: full sync with %s, loaded %d keys in %v", l.addr(), keys, time.Since(start))
+	return nil
+}
+
+// sendAcks 定期向主节点报告已处理的复制偏移
+func (s *Server) sendAcks(l *masterLink, conn net.Conn, done chan struct{}) {
+	t := time.NewTicker(s.ReplAckPeriod)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			s.sendAck(l, conn)
+		}
+	}
+}
+
+func (s *Server) sendAck(l *masterLink, conn net.Conn) {
+	off := s.replication.backlog.Load().Offset()
+	_ = l.send(conn, "REPLCONF", "ACK", strconv.FormatInt(off, 10))
+}
+
+// applyReplicated 应用复制流中的一条命令。MULTI 与 EXEC 之间的命令在收到 EXEC
+// 后一起执行。命令原样写入本节点的复制流（偏移因此与主节点一致）并传播到 AOF。
+func (s *Server) applyReplicated(l *masterLink, conn net.Conn, cmd []string) {
+	name := strings.ToUpper(cmd[0])
+	switch {
+	case name == "MULTI":
+		l.txn = [][]string{cmd}
+		return
+	case l.txn != nil && name != "EXEC":
+		l.txn = append(l.txn, cmd)
+		return
+	}
+	cmds := [][]string{cmd}
+	if l.txn != nil {
+		cmds = append(l.txn, cmd)
+		l.txn = nil
+	}
+	getack := false
+	s.store.Exclusive(func() {
+		if !s.isCurrentLink(l) {
+			return
+		}
+		var writes [][]string
+		for _, c := range cmds {
+			switch strings.ToUpper(c[0]) {
+			case "PING", "SELECT", "MULTI", "EXEC":
+				continue
+			case "REPLCONF":
+				getack = getack || len(c) > 1 && strings.EqualFold(c[1], "GETACK")
+				continue
+			}
+			if resp, handled, err := s.router.Handle(c[0], s.store, protocol.Args(c[1:])); !handled || err != nil || protocol.IsError(resp) {
+				log.Printf("replication: applying %s failed: %s%v", c[0], resp, err)
+			}
+			writes = append(writes, c)
+		}
+		if s.aof != nil && len(writes) > 0 {
+			if len(writes) > 1 {
+				writes = append(append([][]string{{"MULTI"}}, writes...), []string{"EXEC"})
+			}
+			s.feedAOF(writes)
+		}
+		s.feedReplicas(cmds)
+	})
+	if getack {
+		s.sendAck(l, conn)
+	}
+}
+
+func (s *Server) isCurrentLink(l *masterLink) bool {
+	s.replication.mu.Lock()
+	defer s.replication.mu.Unlock()
+	return s.replication.master == l
+}
+
+// replconf 实现副本在 PSYNC 之前发送的 REPLCONF 选项
+func (s *Server) replconf(c *client, args []string) protocol.Reply {
+	if len(args)%2 != 0 {
+		return protocol.ErrSyntax
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "listening-port":
+			port, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return protocol.ErrNotInteger
+			}
+			c.replPort = port
+		case "capa", "ip-address":
+		case "ack", "getack":
+			// 只在复制连接上有意义，普通连接上忽略且不回复
+			return nil
+		default:
+			return protocol.Errorf("ERR Unrecognized REPLCONF option: %s", args[i])
+		}
+	}
+	return protocol.OK
+}
+
+// serveReplica 处理 PSYNC/SYNC：发送全量快照或从积压缓冲区继续，然后持续发送
+// 复制流，直到连接断开。连接从此成为复制连接，返回后应关闭。
+func (s *Server) serveReplica(c *client, r *bufio.Reader, cmd string, args []string) {
+	psync := strings.EqualFold(cmd, "PSYNC")
+	if psync && len(args) != 2 || !psync && len(args) != 0 {
+		c.write(protocol.WrongArgs(strings.ToLower(cmd)))
+		return
+	}
+	conn := c.conn
+	_ = conn.SetDeadline(time.Time{})
+	rep := &replica{conn: conn, port: c.replPort, ackTime: time.Now(), done: make(chan struct{})}
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		rep.ip = host
+	}
+
+	rs := &s.replication
+	var (
+		sn      *storage.Snapshot
+		b       *repl.Backlog
+		id      string
+		offset  int64
+		errResp protocol.Reply
+	)
+	s.store.Exclusive(func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if rs.master != nil && !rs.master.up.Load() {
+			errResp = protocol.Error("NOMASTERLINK Can't SYNC while not connected with my master")
+			return
+		}
+		b = s.ensureBacklog()
+		id = rs.id
+		partial := false
+		if psync {
+			req, err := strconv.ParseInt(args[1], 10, 64)
+			if err == nil && (args[0] == rs.id || args[0] == rs.id2 && req <= rs.offset2) && b.Contains(req-1) {
+				offset, partial = req-1, true
+				rs.syncPartialOK++
+			} else if args[0] != "?" {
+				rs.syncPartialErr++
+			}
+		}
+		if !partial {
+			// 无法部分重同步：在与快照相同的时刻记录复制流位置
+			sn = s.store.Snapshot()
+			offset = b.Offset()
+			rs.syncFull++
+		}
+		if rs.replicas == nil {
+			rs.replicas = make(map[*replica]struct{})
+		}
+		rs.replicas[rep] = struct{}{}
+	})
+	if errResp != nil {
+		c.write(errResp)
+		return
+	}
+	defer func() {
+		rs.mu.Lock()
+		delete(rs.replicas, rep)
+		rs.mu.Unlock()
+		conn.Close()
+	}()
+
+	if sn != nil {
+		var buf bytes.Buffer
+		_, err := sn.WriteTo(&buf)
+		sn.Release()
+		if err != nil {
+			log.Printf("replication: cannot serialize snapshot: %v", err)
+			return
+		}
+		var head []byte
+		if psync {
+			head = fmt.Appendf(head, "+FULLRESYNC %s %d\r\n", id, offset)
+		}
+		head = fmt.Appendf(head, "$%d\r\n", buf.Len())
+		if _, err := conn.Write(append(head, buf.Bytes()...)); err != nil {
+			return
+		}
+	} else if _, err := fmt.Fprintf(conn, "+CONTINUE %s\r\n", id); err != nil {
+		return
+	}
+	rs.mu.Lock()
+	rep.online = true
+	rep.ackTime = time.Now()
+	rs.mu.Unlock()
+	log.Printf("replication: replica %s:%d online at offset %d (full sync: %v)", rep.ip, rep.port, offset, sn != nil)
+
+	go s.readAcks(rep, r)
+	for {
+		data, more, err := b.ReadFrom(offset, 64<<10)
+		if err != nil {
+			log.Printf("replication: replica %s:%d fell behind the backlog, disconnecting", rep.ip, rep.port)
+			return
+		}
+		if len(data) == 0 {
+			select {
+			case <-more:
+				continue
+			case <-rep.done:
+				return
+			}
+		}
+		if _, err := conn.Write(data); err != nil {
+			return
+		}
+		offset += int64(len(data))
+	}
+}
+
+// readAcks 读取副本发来的 REPLCONF ACK；连接出错时通知发送方退出
+func (s *Server) readAcks(rep *replica, r *bufio.Reader) {
+	defer close(rep.done)
+	for {
+		cmd, args, err := protocol.ParseRequest(r)
+		if err != nil {
+			rep.conn.Close()
+			return
+		}
+		if strings.EqualFold(cmd, "REPLCONF") && len(args) >= 2 && strings.EqualFold(args[0], "ACK") {
+			if off, err := strconv.ParseInt(args[1], 10, 64); err == nil {
+				s.replication.mu.Lock()
+				rep.ackOffset = off
+				rep.ackTime = time.Now()
+				if ch := s.replication.acked; ch != nil {
+					close(ch)
+					s.replication.acked = nil
+				}
+				s.replication.mu.Unlock()
+			}
+		}
+	}
+}
+
+// replicationInfo 返回 INFO 的 Replication 段
+func (s *Server) replicationInfo() string {
+	var b strings.Builder
+	b.WriteString("# Replication\r\n")
+	backlog := s.replication.backlog.Load()
+	var offset int64
+	if backlog != nil {
+		offset = backlog.Offset()
+	}
+	rs := &s.replication
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if l := rs.master; l != nil {
+		status, lastIO := "down", int64(-1)
+		if l.up.Load() {
+			status = "up"
+			lastIO = time.Now().Unix() - l.lastIO.Load()
+		}
+		syncing := 0
+		if l.syncing.Load() {
+			syncing = 1
+		}
+		fmt.Fprintf(&b, "role:slave\r\nmaster_host:%s\r\nmaster_port:%d\r\nmaster_link_status:%s\r\nmaster_last_io_seconds_ago:%d\r\nmaster_sync_in_progress:%d\r\nslave_repl_offset:%d\r\nslave_priority:%d\r\nslave_read_only:1\r\n",
+			l.host, l.port, status, lastIO, syncing, offset, s.ReplicaPriority)
+	} else {
+		b.WriteString("role:master\r\n")
+	}
+	n := 0
+	for rep := range rs.replicas {
+		if !rep.online {
+			continue
+		}
+		fmt.Fprintf(&b, "slave%d:ip=%s,port=%d,state=online,offset=%d,lag=%d\r\n",
+			n, rep.ip, rep.port, rep.ackOffset, int64(time.Since(rep.ackTime).Seconds()))
+		n++
+	}
+	id2 := rs.id2
+	if id2 == "" {
+		id2 = strings.Repeat("0", 40)
+	}
+	fmt.Fprintf(&b, "connected_slaves:%d\r\n", n)
+	if s.MinReplicasToWrite > 0 && rs.master == nil {
+		fmt.Fprintf(&b, "min_slaves_good_slaves:%d\r\n", s.goodReplicasLocked())
+	}
+	fmt.Fprintf(&b, "master_replid:%s\r\nmaster_replid2:%s\r\nmaster_repl_offset:%d\r\nsecond_repl_offset:%d\r\n",
+		rs.id, id2, offset, rs.offset2)
+	if backlog != nil {
+		hist := backlog.HistLen()
+		fmt.Fprintf(&b, "repl_backlog_active:1\r\nrepl_backlog_size:%d\r\nrepl_backlog_first_byte_offset:%d\r\nrepl_backlog_histlen:%d\r\n",
+			backlog.Size(), offset-int64(hist)+1, hist)
+	} else {
+		b.WriteString("repl_backlog_active:0\r\n")
+	}
+	fmt.Fprintf(&b, "sync_full:%d\r\nsync_partial_ok:%d\r\nsync_partial_err:%d\r\n", rs.syncFull, rs.syncPartialOK, rs.syncPartialErr)
+	return b.String()
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"redisx/internal/storage"
+)
+
+// startReplServer 启动一个不读写持久化文件的服务器
+func startReplServer(t *testing.T) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	return startConfigured(t, s)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// replicate 让 replica 复制 master 并等待复制连接建立；测试结束时停止复制
+func replicate(t *testing.T, replica, master *Server) {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(master.ln.Addr().String())
+	conn, r := dialServer(t, replica)
+	defer conn.Close()
+	expectLine(t, conn, r, "+OK", "REPLICAOF", "127.0.0.1", port)
+	waitFor(t, "master link", func() bool {
+		return infoField(t, conn, r, "master_link_status") == "up"
+	})
+	t.Cleanup(func() {
+		replica.store.Exclusive(func() { replica.replicaof([]string{"NO", "ONE"}) })
+	})
+}
+
+// dropMasterLink 断开副本到主节点的连接（模拟短暂的网络中断）
+func dropMasterLink(s *Server) {
+	s.replication.mu.Lock()
+	l := s.replication.master
+	s.replication.mu.Unlock()
+	l.mu.Lock()
+	l.conn.Close()
+	l.mu.Unlock()
+}
+
+func TestReplication(t *testing.T) {
+	master := startReplServer(t)
+	defer master.ln.Close()
+	replica := startReplServer(t)
+	defer replica.ln.Close()
+
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+	expectLine(t, mc, mr, "+OK", "SET", "before", "1")
+	expectLine(t, mc, mr, ":3", "RPUSH", "l", "a", "b", "c")
+	replicate(t, replica, master)
+	if v, _ := replica.store.Get("before"); string(v) != "1" {
+		t.Fatalf("expected full sync to copy existing data, got %q", v)
+	}
+
+	// 全量同步之后的写命令以复制流实时到达
+	expectLine(t, mc, mr, "+OK", "SET", "ttl", "v", "EX", "100")
+	expectLine(t, mc, mr, "$1", "LPOP", "l")
+	expectLine(t, mc, mr, "a")
+	expectLine(t, mc, mr, "+OK", "MULTI")
+	expectLine(t, mc, mr, "+QUEUED", "INCR", "n")
+	expectLine(t, mc, mr, "+QUEUED", "INCR", "n")
+	expectLine(t, mc, mr, "*2", "EXEC")
+	expectLine(t, mc, mr, ":1")
+	expectLine(t, mc, mr, ":2")
+	writeReq(mc, "XADD", "st", "*", "f", "v")
+	id, _ := readBulk(mr)
+	waitFor(t, "replica to catch up", func() bool {
+		n, _ := replica.store.XLen("st")
+		return n == 1
+	})
+	sid, _ := storage.ParseStreamID(id, 0)
+	if got, _ := replica.store.XRange("st", sid, sid, -1, false); len(got) != 1 {
+		t.Fatalf("expected generated stream ID %s on the replica", id)
+	}
+	if v, _ := replica.store.Get("n"); string(v) != "2" {
+		t.Fatalf("expected transaction to be replicated, got %q", v)
+	}
+	if replica.store.PExpireTime("ttl") != master.store.PExpireTime("ttl") {
+		t.Fatal("expected identical absolute expiry on the replica")
+	}
+	if l, _ := replica.store.LRange("l", 0, -1); len(l) != 2 {
+		t.Fatalf("unexpected list on replica %v", l)
+	}
+
+	// 副本只读
+	rc, rr := dialServer(t, replica)
+	defer rc.Close()
+	expectLine(t, rc, rr, "-READONLY You can't write against a read only replica.", "SET", "k", "v")
+	expectLine(t, rc, rr, "-READONLY You can't write against a read only replica.", "BLPOP", "l", "1")
+	expectLine(t, rc, rr, "+OK", "MULTI")
+	expectLine(t, rc, rr, "-READONLY You can't write against a read only replica.", "SET", "k", "v")
+	expectLine(t, rc, rr, "-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	expectLine(t, rc, rr, "$1", "GET", "before")
+	expectLine(t, rc, rr, "1")
+
+	// INFO replication：角色、偏移与延迟
+	if got := infoField(t, mc, mr, "role"); got != "master" {
+		t.Fatalf("unexpected master role %q", got)
+	}
+	if got := infoField(t, rc, rr, "role"); got != "slave" {
+		t.Fatalf("unexpected replica role %q", got)
+	}
+	if infoField(t, mc, mr, "connected_slaves") != "1" {
+		t.Fatal("expected one connected replica")
+	}
+	masterOffset := infoField(t, mc, mr, "master_repl_offset")
+	if infoField(t, rc, rr, "slave_repl_offset") != masterOffset || infoField(t, rc, rr, "master_replid") != infoField(t, mc, mr, "master_replid") {
+		t.Fatal("replica offset or replication ID differs from the master")
+	}
+	waitFor(t, "replica ACK", func() bool {
+		line := infoField(t, mc, mr, "slave0")
+		return line == "ip=127.0.0.1,port="+strconv.Itoa(replica.ln.Addr().(*net.TCPAddr).Port)+",state=online,offset="+masterOffset+",lag=0"
+	})
+}
+
+func TestPartialResync(t *testing.T) {
+	master := startReplServer(t)
+	defer master.ln.Close()
+	replica := startReplServer(t)
+	defer replica.ln.Close()
+	replicate(t, replica, master)
+
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+	old := replRetryDelay
+	replRetryDelay = 50 * time.Millisecond
+	defer func() { replRetryDelay = old }()
+
+	// 短暂断开期间的写入从积压缓冲区补发
+	dropMasterLink(replica)
+	for i := 0; i < 10; i++ {
+		expectLine(t, mc, mr, ":"+strconv.Itoa(i+1), "INCR", "n")
+	}
+	waitFor(t, "partial resync", func() bool {
+		v, _ := replica.store.Get("n")
+		return string(v) == "10"
+	})
+	if infoField(t, mc, mr, "sync_partial_ok") != "1" || infoField(t, mc, mr, "sync_full") != "1" {
+		t.Fatalf("expected one full and one partial sync, got full=%s partial=%s",
+			infoField(t, mc, mr, "sync_full"), infoField(t, mc, mr, "sync_partial_ok"))
+	}
+
+}
+
+func TestPartialResyncBacklogOverflow(t *testing.T) {
+	master := NewServer(":0")
+	master.SnapshotPath, master.RDBPath = "", ""
+	master.ReplBacklogSize = 256
+	startConfigured(t, master)
+	defer master.ln.Close()
+	replica := startReplServer(t)
+	defer replica.ln.Close()
+	replicate(t, replica, master)
+	old := replRetryDelay
+	replRetryDelay = 50 * time.Millisecond
+	defer func() { replRetryDelay = old }()
+
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+	dropMasterLink(replica)
+	for i := 0; i < 50; i++ {
+		expectLine(t, mc, mr, "+OK", "SET", "k"+strconv.Itoa(i), "some value to fill the backlog with")
+	}
+	waitFor(t, "full resync", func() bool { return replica.store.Count() == 50 })
+	if got := infoField(t, mc, mr, "sync_full"); got != "2" {
+		t.Fatalf("expected a second full sync, got %s", got)
+	}
+}
+
+func TestReplicaPromotion(t *testing.T) {
+	master := startReplServer(t)
+	defer master.ln.Close()
+	replica := startReplServer(t)
+	defer replica.ln.Close()
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+	expectLine(t, mc, mr, "+OK", "SET", "k", "v")
+	replicate(t, replica, master)
+	oldID := infoField(t, mc, mr, "master_replid")
+
+	rc, rr := dialServer(t, replica)
+	defer rc.Close()
+	waitFor(t, "replica offset", func() bool {
+		return infoField(t, rc, rr, "slave_repl_offset") == infoField(t, mc, mr, "master_repl_offset")
+	})
+	expectLine(t, rc, rr, "+OK", "REPLICAOF", "NO", "ONE")
+	if infoField(t, rc, rr, "role") != "master" || infoField(t, rc, rr, "master_replid2") != oldID {
+		t.Fatal("expected the promoted replica to keep the old replication ID as replid2")
+	}
+	expectLine(t, rc, rr, "+OK", "SET", "k", "new")
+
+	// 原主节点成为新主节点的副本时，可以凭旧复制 ID 部分重同步
+	replicate(t, master, replica)
+	waitFor(t, "write on the new master", func() bool {
+		v, _ := master.store.Get("k")
+		return string(v) == "new"
+	})
+	if got := infoField(t, rc, rr, "sync_partial_ok"); got != "1" {
+		t.Fatalf("expected a partial resync after failover, got %s", got)
+	}
+	expectLine(t, mc, mr, "-READONLY You can't write against a read only replica.", "SET", "k", "v")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"redisx/internal/protocol"
+)
+
+// serverVersion 为 INFO 与 HELLO 报告的版本
+const serverVersion = "redisX-0.2.0"
+
+// hello 处理 HELLO [protover [AUTH username password] [SETNAME clientname]]：
+// 切换协议版本并回复服务器信息。选项全部校验通过后才生效。
+func (s *Server) hello(c *client, args []string) protocol.Reply {
+	resp := c.out.Proto
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			return protocol.Error("ERR Protocol version is not an integer or out of range")
+		}
+		if v != protocol.RESP2 && v != protocol.RESP3 {
+			return protocol.Error("NOPROTO unsupported protocol version")
+		}
+		resp = v
+	}
+	var authArgs []string
+	name, setName := "", false
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "AUTH" && i+2 < len(args):
+			authArgs = args[i+1 : i+3]
+			i += 2
+		case opt == "SETNAME" && i+1 < len(args):
+			name, setName = args[i+1], true
+			i++
+		default:
+			return protocol.Errorf("ERR Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+	if setName && !validClientName(name) {
+		return protocol.Error("ERR Client names cannot contain spaces, newlines or special characters.")
+	}
+	if authArgs != nil {
+		if reply := s.auth(c, authArgs); protocol.IsError(reply) {
+			return reply
+		}
+	} else if !s.authenticated(c) {
+		return protocol.Error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+	if setName {
+		c.name = name
+	}
+	c.out.Proto = resp
+	if c.sub != nil {
+		c.sub.SetRESP3(resp == protocol.RESP3)
+	}
+
+	mode, role := "standalone", "master"
+	if s.cluster != nil {
+		mode = "cluster"
+	}
+	if s.isReplica() {
+		role = "replica"
+	}
+	return protocol.Map{
+		protocol.Bulk("server"), protocol.Bulk("redis"),
+		protocol.Bulk("version"), protocol.Bulk(serverVersion),
+		protocol.Bulk("proto"), protocol.Integer(resp),
+		protocol.Bulk("id"), protocol.Integer(c.id),
+		protocol.Bulk("mode"), protocol.Bulk(mode),
+		protocol.Bulk("role"), protocol.Bulk(role),
+		protocol.Bulk("modules"), protocol.EmptyArray,
+	}
+}
+
+// validClientName 报告名称是否只包含可见的 ASCII 字符且不含空格
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// authenticated 报告连接是否已认证为仍然存在的用户
+func (s *Server) authenticated(c *client) bool {
+	return c.user != nil && s.acl.Valid(c.user)
+}
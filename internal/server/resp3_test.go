@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readHello 读取 HELLO 回复，返回字段与值
+func readHello(t *testing.T, r *bufio.Reader, header string) map[string]string {
+	t.Helper()
+	if line, err := readLine(r); err != nil || line != header+"\r\n" {
+		t.Fatalf("HELLO: expected %q, got %q (%v)", header, line, err)
+	}
+	fields := make(map[string]string)
+	for i := 0; i < 7; i++ {
+		key, err := readBulk(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := r.Peek(1)
+		if len(b) > 0 && b[0] != '$' {
+			line, _ := readLine(r)
+			fields[key] = strings.TrimSpace(line)
+			continue
+		}
+		if fields[key], err = readBulk(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fields
+}
+
+func TestHello(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+
+	writeReq(conn, "HELLO")
+	if f := readHello(t, r, "*14"); f["proto"] != ":2" || f["server"] != "redis" || f["version"] != serverVersion {
+		t.Fatalf("HELLO: %v", f)
+	}
+	expectLine(t, conn, r, "-NOPROTO unsupported protocol version", "HELLO", "4")
+	expectLine(t, conn, r, "-ERR Protocol version is not an integer or out of range", "HELLO", "x")
+	expectLine(t, conn, r, "-ERR Syntax error in HELLO option 'BOGUS'", "HELLO", "3", "BOGUS")
+	// 选项出错时协议保持不变
+	expectLine(t, conn, r, "$-1", "GET", "missing")
+
+	writeReq(conn, "HELLO", "3", "SETNAME", "app")
+	if f := readHello(t, r, "%7"); f["proto"] != ":3" || f["mode"] != "standalone" || f["role"] != "master" || f["modules"] != "*0" {
+		t.Fatalf("HELLO 3: %v", f)
+	}
+	expectLine(t, conn, r, "_", "GET", "missing")
+	expectLine(t, conn, r, ":2", "HSET", "h", "f", "1", "g", "2")
+	expectLine(t, conn, r, "%2", "HGETALL", "h")
+	fields := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		f, _ := readBulk(r)
+		fields[f], _ = readBulk(r)
+	}
+	if fields["f"] != "1" || fields["g"] != "2" {
+		t.Fatalf("HGETALL: %v", fields)
+	}
+	expectLine(t, conn, r, ":1", "SADD", "s", "m")
+	expectLine(t, conn, r, "~1", "SMEMBERS", "s")
+	expectLine(t, conn, r, "$1")
+	expectLine(t, conn, r, "m")
+	expectLine(t, conn, r, ":1", "ZADD", "z", "1.5", "a")
+	expectLine(t, conn, r, ",1.5", "ZSCORE", "z", "a")
+	expectLine(t, conn, r, ",4", "ZADD", "z", "INCR", "2.5", "a")
+	expectLine(t, conn, r, "*2", "ZMSCORE", "z", "a", "b")
+	expectLine(t, conn, r, ",4")
+	expectLine(t, conn, r, "_")
+	expectLine(t, conn, r, "%1", "CONFIG", "GET", "MaxClients")
+	expectLine(t, conn, r, "$10")
+	expectLine(t, conn, r, "maxclients")
+	if _, err := readBulk(r); err != nil {
+		t.Fatal(err)
+	}
+	writeReq(conn, "INFO")
+	line, _ := readLine(r)
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "=")))
+	if err != nil || line[0] != '=' {
+		t.Fatalf("INFO: expected verbatim string, got %q", line)
+	}
+	body := make([]byte, n+2)
+	if _, err := io.ReadFull(r, body); err != nil || !strings.HasPrefix(string(body), "txt:# Server") {
+		t.Fatalf("INFO: unexpected body %q (%v)", body, err)
+	}
+
+	// EXEC 的每个元素按各自的命令转换，WATCH 失败时回复 null
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "GET", "missing")
+	expectLine(t, conn, r, "+QUEUED", "ZSCORE", "z", "a")
+	expectLine(t, conn, r, "*2", "EXEC")
+	expectLine(t, conn, r, "_")
+	expectLine(t, conn, r, ",4")
+	other, or := dialServer(t, s)
+	defer other.Close()
+	expectLine(t, conn, r, "+OK", "WATCH", "k")
+	expectLine(t, other, or, "+OK", "SET", "k", "v")
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "+QUEUED", "GET", "k")
+	expectLine(t, conn, r, "_", "EXEC")
+
+	// HELLO 2 切回 RESP2
+	writeReq(conn, "HELLO", "2")
+	readHello(t, r, "*14")
+	expectLine(t, conn, r, "$-1", "GET", "missing")
+	expectLine(t, conn, r, "*4", "HGETALL", "h")
+}
+
+func TestHelloAuth(t *testing.T) {
+	s := startACLServer(t, "secret", "")
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	expectLine(t, conn, r, "-NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time", "HELLO", "3")
+	expectLine(t, conn, r, "-WRONGPASS invalid username-password pair or user is disabled.", "HELLO", "3", "AUTH", "default", "wrong")
+	expectLine(t, conn, r, "-NOAUTH Authentication required.", "GET", "k")
+	expectLine(t, conn, r, "-ERR Client names cannot contain spaces, newlines or special characters.", "HELLO", "3", "AUTH", "default", "secret", "SETNAME", "a b")
+	writeReq(conn, "HELLO", "3", "AUTH", "default", "secret", "SETNAME", "app")
+	readHello(t, r, "%7")
+	expectLine(t, conn, r, "_", "GET", "k")
+}
+
+func TestResp3PubSub(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	sub, sr := dialServer(t, s)
+	defer sub.Close()
+	writeReq(sub, "HELLO", "3")
+	readHello(t, sr, "%7")
+	expectLine(t, sub, sr, ">3", "SUBSCRIBE", "news")
+	expectLine(t, sub, sr, "$9")
+	expectLine(t, sub, sr, "subscribe")
+	expectLine(t, sub, sr, "$4")
+	expectLine(t, sub, sr, "news")
+	expectLine(t, sub, sr, ":1")
+
+	// RESP3 订阅连接可以执行任意命令
+	expectLine(t, sub, sr, "+OK", "SET", "k", "v")
+	expectLine(t, sub, sr, "$1", "GET", "k")
+	expectLine(t, sub, sr, "v")
+	expectLine(t, sub, sr, "+PONG", "PING")
+
+	pub, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	pr := bufio.NewReader(pub)
+	expectLine(t, pub, pr, ":1", "PUBLISH", "news", "hi")
+	expectLine(t, sub, sr, ">3")
+	expectLine(t, sub, sr, "$7")
+	expectLine(t, sub, sr, "message")
+	expectLine(t, sub, sr, "$4")
+	expectLine(t, sub, sr, "news")
+	expectLine(t, sub, sr, "$2")
+	expectLine(t, sub, sr, "hi")
+
+	// RESP2 订阅者收到数组形式的消息
+	sub2, sr2 := dialServer(t, s)
+	defer sub2.Close()
+	writeReq(sub2, "SUBSCRIBE", "news")
+	readArray(t, sr2)
+	expectLine(t, pub, pr, ":2", "PUBLISH", "news", "again")
+	if got := readArray(t, sr2); strings.Join(got, " ") != "message news again" {
+		t.Fatalf("RESP2 message: %v", got)
+	}
+	expectLine(t, sub, sr, ">3")
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"redisx/internal/protocol"
+	"redisx/internal/sentinel"
+)
+
+// blockingProxy 将连接转发到 target；block 后断开所有连接并拒绝新连接，模拟主节点
+// 网络中断
+type blockingProxy struct {
+	ln      net.Listener
+	target  string
+	mu      sync.Mutex
+	blocked bool
+	conns   []net.Conn
+}
+
+func startProxy(t *testing.T, target string) *blockingProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &blockingProxy{ln: ln, target: target}
+	t.Cleanup(func() {
+		ln.Close()
+		p.setBlocked(true)
+	})
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go p.forward(c)
+		}
+	}()
+	return p
+}
+
+func (p *blockingProxy) port() int { return p.ln.Addr().(*net.TCPAddr).Port }
+
+func (p *blockingProxy) forward(c net.Conn) {
+	p.mu.Lock()
+	if p.blocked {
+		p.mu.Unlock()
+		c.Close()
+		return
+	}
+	up, err := net.Dial("tcp", p.target)
+	if err != nil {
+		p.mu.Unlock()
+		c.Close()
+		return
+	}
+	p.conns = append(p.conns, c, up)
+	p.mu.Unlock()
+	go func() {
+		io.Copy(up, c)
+		up.Close()
+	}()
+	io.Copy(c, up)
+	c.Close()
+}
+
+func (p *blockingProxy) setBlocked(blocked bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = blocked
+	if blocked {
+		for _, c := range p.conns {
+			c.Close()
+		}
+		p.conns = nil
+	}
+}
+
+// startSentinel 启动一个以较短周期监控 masterPort 的 sentinel
+func startSentinel(t *testing.T, masterPort int) *sentinel.Sentinel {
+	s := sentinel.NewSentinel("127.0.0.1:0")
+	s.PingPeriod = 50 * time.Millisecond
+	s.InfoPeriod = 200 * time.Millisecond
+	s.HelloPeriod = 100 * time.Millisecond
+	s.DownAfter = 500 * time.Millisecond
+	s.FailoverTimeout = 3 * time.Second
+	if err := s.Monitor("mymaster", "127.0.0.1", masterPort, 2); err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	t.Cleanup(s.Close)
+	waitFor(t, "sentinel listener", func() bool { return s.Addr() != "" })
+	return s
+}
+
+// sentinelMaster 返回 SENTINEL MASTER mymaster 中的字段
+func sentinelMaster(t *testing.T, s *sentinel.Sentinel, field string) string {
+	t.Helper()
+	c, err := protocol.Dial(s.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	v, err := c.Do("SENTINEL", "MASTER", "mymaster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, _ := v.([]any)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] == field {
+			return kv[i+1].(string)
+		}
+	}
+	t.Fatalf("SENTINEL MASTER has no %s field: %v", field, kv)
+	return ""
+}
+
+func TestSentinelFailover(t *testing.T) {
+	master := startReplServer(t)
+	defer master.ln.Close()
+	// r1 优先级更高（数值更小），应被提升
+	r1 := NewServer(":0")
+	r1.SnapshotPath, r1.RDBPath, r1.ReplicaPriority = "", "", 10
+	startConfigured(t, r1)
+	defer r1.ln.Close()
+	r2 := startReplServer(t)
+	defer r2.ln.Close()
+	for _, s := range []*Server{master, r1, r2} {
+		s := s
+		t.Cleanup(func() {
+			s.store.Exclusive(func() { s.replicaof([]string{"NO", "ONE"}) })
+		})
+	}
+
+	// 副本通过代理复制主节点，sentinel 也通过代理监控主节点
+	proxy := startProxy(t, master.ln.Addr().String())
+	proxyPort := strconv.Itoa(proxy.port())
+	for _, r := range []*Server{r1, r2} {
+		conn, rd := dialServer(t, r)
+		expectLine(t, conn, rd, "+OK", "REPLICAOF", "127.0.0.1", proxyPort)
+		waitFor(t, "master link", func() bool {
+			return infoField(t, conn, rd, "master_link_status") == "up"
+		})
+		conn.Close()
+	}
+	mc, mr := dialServer(t, master)
+	expectLine(t, mc, mr, "+OK", "SET", "k", "v")
+	mc.Close()
+
+	var sentinels []*sentinel.Sentinel
+	for i := 0; i < 3; i++ {
+		sentinels = append(sentinels, startSentinel(t, proxy.port()))
+	}
+	for _, s := range sentinels {
+		waitFor(t, "sentinel discovery", func() bool {
+			return sentinelMaster(t, s, "num-slaves") == "2" && sentinelMaster(t, s, "num-other-sentinels") == "2"
+		})
+	}
+
+	proxy.setBlocked(true)
+	r1Port := strconv.Itoa(nodePort(r1))
+	deadline := time.Now().Add(20 * time.Second)
+	for _, s := range sentinels {
+		for {
+			c, err := protocol.Dial(s.Addr(), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := c.Do("SENTINEL", "GET-MASTER-ADDR-BY-NAME", "mymaster")
+			c.Close()
+			if addr, _ := v.([]any); err == nil && len(addr) == 2 && addr[1] == r1Port {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("sentinel %s did not switch to the promoted replica, got %v %v", s.MyID(), v, err)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	rc, rr := dialServer(t, r1)
+	defer rc.Close()
+	if role := infoField(t, rc, rr, "role"); role != "master" {
+		t.Fatalf("expected the replica with the lowest priority to be promoted, got role %s", role)
+	}
+	if v, _ := r1.store.Get("k"); string(v) != "v" {
+		t.Fatalf("promoted replica lost data: %q", v)
+	}
+	// 另一个副本与恢复后的原主节点都被改为复制新主节点
+	proxy.setBlocked(false)
+	for _, s := range []*Server{r2, master} {
+		conn, rd := dialServer(t, s)
+		waitFor(t, "replica reconfiguration", func() bool {
+			return infoField(t, conn, rd, "role") == "slave" && infoField(t, conn, rd, "master_port") == r1Port &&
+				infoField(t, conn, rd, "master_link_status") == "up"
+		})
+		conn.Close()
+	}
+}
@@ -2,17 +2,23 @@ package server
 
 import (
 	"bufio"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"net"
-	"strconv"
+	"os"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"redisx/internal/acl"
+	"redisx/internal/aof"
+	"redisx/internal/cluster"
 	"redisx/internal/command"
 	"redisx/internal/protocol"
+	"redisx/internal/pubsub"
+	"redisx/internal/repl"
 	"redisx/internal/storage"
 )
 
@@ -28,30 +34,281 @@ type Server struct {
 	connLimiter    chan struct{}
 	ConnTimeout    time.Duration
 	MaxMemoryBytes int64
+	// PubSubOutputLimit 为每个订阅客户端输出队列的字节上限，超过后断开该客户端；0 表示不限制
+	PubSubOutputLimit int64
+	// ProtoMaxBulkLen 为请求中单个参数的最大长度，MaxMultibulkLen 为一个请求的
+	// 最大参数个数；超过时回复协议错误并关闭连接，0 表示不限制
+	ProtoMaxBulkLen int
+	MaxMultibulkLen int
+
+	pubsub *pubsub.Hub
+
+	// SnapshotPath 为快照文件路径：启动时加载，SAVE/BGSAVE 写入；为空表示禁用
+	SnapshotPath string
+	snap         snapshotState
+	// RDBPath 为 Redis 的 RDB 文件路径：快照文件（及 AOF）不存在时在启动时从中导入；
+	// 为空表示不导入
+	RDBPath string
+	// AppendOnly 开启 AOF：写命令追加到 AppendFilename，启动时优先从中恢复数据；
+	// AppendFsync 为 fsync 策略（always、everysec 或 no）
+	AppendOnly     bool
+	AppendFilename string
+	AppendFsync    string
+	aof            *aof.Log
+	aofState       aofState
+	// ReplBacklogSize 为复制积压缓冲区的字节数；ReplTimeout 为副本在收不到主节点
+	// 数据多久后判定连接断开；ReplAckPeriod 为副本发送 REPLCONF ACK 的间隔
+	ReplBacklogSize int
+	ReplTimeout     time.Duration
+	ReplAckPeriod   time.Duration
+	replication     replState
+	// MinReplicasToWrite 大于 0 时，主节点在最近 MinReplicasMaxLag 内确认过偏移的
+	// 在线副本少于该数量时拒绝写命令
+	MinReplicasToWrite int
+	MinReplicasMaxLag  time.Duration
+	// ReplicaPriority 在副本的 INFO 中报告为 slave_priority：sentinel 故障转移时优先
+	// 提升数值小的副本，0 表示从不提升
+	ReplicaPriority int
+	// ClusterEnabled 开启集群模式：键按 CRC16 映射到 16384 个槽，访问不由本节点
+	// 服务的槽时返回 MOVED/ASK 重定向；ClusterNodeTimeout 为其他节点多久没有响应
+	// 后被标记为疑似下线
+	ClusterEnabled     bool
+	ClusterNodeTimeout time.Duration
+	cluster            *cluster.State
+	// RaftEnabled 开启 Raft 强一致模式：写命令经多数节点确认的日志提交后才生效，
+	// 非领导者节点拒绝写命令；RaftDir 保存 Raft 的日志与快照（为空表示只保存在
+	// 内存中）；RaftAddr 为其他节点访问本节点的地址，为空时取 127.0.0.1 与监听
+	// 端口；RaftBusAddr 为节点间 RPC 的监听地址，为空时取监听端口加 10000（与 Redis
+	// 集群总线一致），该端口只应对其他节点开放；RaftTimeout 为选举超时；RaftSnapshotThreshold 为生成快照前日志的最大
+	// 条目数（0 表示不生成）。Raft 模式不能与集群模式同时开启，也不加载快照文件与 AOF。
+	RaftEnabled           bool
+	RaftDir               string
+	RaftAddr              string
+	RaftBusAddr           string
+	RaftTimeout           time.Duration
+	RaftSnapshotThreshold uint64
+	raft                  raftState
+	// RequirePass 非空时设置默认用户的密码，连接须先 AUTH；ACLFile 为 ACL 文件的
+	// 路径：启动时（存在时）加载，ACL SAVE/LOAD 读写；为空表示不使用 ACL 文件
+	RequirePass string
+	ACLFile     string
+	acl         *acl.ACL
+	// TLSCertFile 与 TLSKeyFile 开启 TLS：TLSAddr 为空时监听地址只接受 TLS 连接，
+	// 否则另外在 TLSAddr 监听 TLS，监听地址仍为明文。TLSCAFile 为验证客户端证书
+	// 的 CA；TLSAuthClients 为 yes（默认，要求客户端证书）、optional 或 no；
+	// TLSMinVersion 为 1.2（默认）或 1.3；TLSCipherSuites 为以冒号分隔的 TLS 1.2
+	// 套件名，为空时使用 Go 的默认值。TLSClientCertUser 开启后，客户端证书的 CN
+	// 与某个启用的 ACL 用户同名时连接自动认证为该用户。证书可通过 ReloadTLS 或 CONFIG SET 重新加载。
+	TLSAddr           string
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSCAFile         string
+	TLSAuthClients    string
+	TLSMinVersion     string
+	TLSCipherSuites   string
+	TLSClientCertUser bool
+	tls               tlsState
+	tlsLn             net.Listener
+	// BindAddrs 为监听地址之外另外监听的 TCP 地址，例如同时监听 IPv4 与 IPv6；
+	// UnixSocket 非空时另外监听该 Unix 套接字，权限为 UnixSocketPerm（0 表示按
+	// umask）。全部监听共用 MaxConns 限制。监听地址为空时不在该地址监听；只监听
+	// Unix 套接字时不能开启集群模式，Raft 模式须指定 RaftAddr。
+	BindAddrs      []string
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+	// listeners 为 ln 之外的监听
+	listeners []net.Listener
 
 	connCount uint64
+	clientIDs uint64
 	startTime time.Time
+	// done 在 Start 返回时关闭，后台任务据此退出
+	done chan struct{}
+	// ready 在监听地址就绪后关闭
+	ready chan struct{}
 }
 
+// NewServer creates a server listening on the TCP address addr. An empty
+// addr disables it, leaving BindAddrs, TLSAddr and UnixSocket.
 func NewServer(addr string) *Server {
-	s := &Server{addr: addr, store: storage.NewStorage(), startTime: time.Now()}
+	s := &Server{
+		addr:                  addr,
+		store:                 storage.NewStorage(),
+		pubsub:                pubsub.NewHub(),
+		acl:                   acl.New(),
+		PubSubOutputLimit:     defaultPubSubOutputLimit,
+		ProtoMaxBulkLen:       protocol.DefaultMaxBulkLen,
+		MaxMultibulkLen:       protocol.DefaultMaxMultibulkLen,
+		SnapshotPath:          defaultSnapshotPath,
+		RDBPath:               defaultRDBPath,
+		AppendFilename:        defaultAppendFilename,
+		AppendFsync:           "everysec",
+		ReplBacklogSize:       defaultReplBacklogSize,
+		ReplTimeout:           defaultReplTimeout,
+		ReplAckPeriod:         defaultReplAckPeriod,
+		MinReplicasMaxLag:     defaultMinReplicasMaxLag,
+		ReplicaPriority:       defaultReplicaPriority,
+		ClusterNodeTimeout:    defaultClusterNodeTimeout,
+		RaftDir:               defaultRaftDir,
+		RaftTimeout:           defaultRaftTimeout,
+		RaftSnapshotThreshold: defaultRaftSnapshotThreshold,
+		startTime:             time.Now(),
+		done:                  make(chan struct{}),
+		ready:                 make(chan struct{}),
+	}
+	s.replication.id, s.replication.offset2 = repl.NewID(), -1
+	s.snap.lastSave = s.startTime
 	// 启动后台清理过期键
 	s.store.StartJanitor(time.Second * 1)
 	// 初始化命令路由并注册处理器
 	r := command.NewRouter()
+	r.RegisterBytes("SET", command.Set)
+	r.RegisterBytes("GET", command.Get)
+	r.Register("DEL", command.Del)
+	r.Register("EXISTS", command.Exists)
+	r.Register("EXPIRE", command.Expire)
+	r.Register("PEXPIRE", command.PExpire)
+	r.Register("EXPIREAT", command.ExpireAt)
+	r.Register("PEXPIREAT", command.PExpireAt)
+	r.Register("EXPIRETIME", command.ExpireTime)
+	r.Register("PEXPIRETIME", command.PExpireTime)
+	r.Register("TTL", command.TTL)
+	r.Register("PTTL", command.PTTL)
+	r.Register("DUMP", command.Dump)
+	r.Register("RESTORE", command.Restore)
+	r.Register("RESTORE-ASKING", command.Restore)
 	r.Register("INCR", command.Incr)
-	r.Register("MGET", command.MGet)
+	r.RegisterBytes("MGET", command.MGet)
 	r.Register("PERSIST", command.Persist)
+	// Hash
+	r.Register("HSET", command.HSet)
+	r.Register("HMSET", command.HMSet)
+	r.Register("HSETNX", command.HSetNX)
+	r.Register("HGET", command.HGet)
+	r.Register("HMGET", command.HMGet)
+	r.Register("HDEL", command.HDel)
+	r.Register("HEXISTS", command.HExists)
+	r.Register("HLEN", command.HLen)
+	r.Register("HSTRLEN", command.HStrLen)
+	r.Register("HKEYS", command.HKeys)
+	r.Register("HVALS", command.HVals)
+	r.Register("HGETALL", command.HGetAll)
+	r.Register("HINCRBY", command.HIncrBy)
+	r.Register("HINCRBYFLOAT", command.HIncrByFloat)
+	r.Register("HRANDFIELD", command.HRandField)
+	// List
+	r.Register("LPUSH", command.LPush)
+	r.Register("RPUSH", command.RPush)
+	r.Register("LPUSHX", command.LPushX)
+	r.Register("RPUSHX", command.RPushX)
+	r.Register("LPOP", command.LPop)
+	r.Register("RPOP", command.RPop)
+	r.Register("LLEN", command.LLen)
+	r.Register("LRANGE", command.LRange)
+	r.Register("LINDEX", command.LIndex)
+	r.Register("LSET", command.LSet)
+	r.Register("LINSERT", command.LInsert)
+	r.Register("LREM", command.LRem)
+	r.Register("LTRIM", command.LTrim)
+	r.Register("LPOS", command.LPos)
+	r.Register("LMOVE", command.LMove)
+	r.Register("RPOPLPUSH", command.RPopLPush)
+	r.Register("LMPOP", command.LMPop)
+	r.RegisterBlocking("BLPOP", command.BLPop)
+	r.RegisterBlocking("BRPOP", command.BRPop)
+	r.RegisterBlocking("BLMOVE", command.BLMove)
+	r.RegisterBlocking("BLMPOP", command.BLMPop)
+	// Set
+	r.Register("SADD", command.SAdd)
+	r.Register("SREM", command.SRem)
+	r.Register("SISMEMBER", command.SIsMember)
+	r.Register("SMISMEMBER", command.SMIsMember)
+	r.Register("SMEMBERS", command.SMembers)
+	r.Register("SCARD", command.SCard)
+	r.Register("SPOP", command.SPop)
+	r.Register("SRANDMEMBER", command.SRandMember)
+	r.Register("SMOVE", command.SMove)
+	r.Register("SINTER", command.SInter)
+	r.Register("SUNION", command.SUnion)
+	r.Register("SDIFF", command.SDiff)
+	r.Register("SINTERSTORE", command.SInterStore)
+	r.Register("SUNIONSTORE", command.SUnionStore)
+	r.Register("SDIFFSTORE", command.SDiffStore)
+	r.Register("SINTERCARD", command.SInterCard)
+	// Sorted set
+	r.Register("ZADD", command.ZAdd)
+	r.Register("ZINCRBY", command.ZIncrBy)
+	r.Register("ZREM", command.ZRem)
+	r.Register("ZCARD", command.ZCard)
+	r.Register("ZSCORE", command.ZScore)
+	r.Register("ZMSCORE", command.ZMScore)
+	r.Register("ZRANK", command.ZRank)
+	r.Register("ZREVRANK", command.ZRevRank)
+	r.Register("ZRANGE", command.ZRange)
+	r.Register("ZRANGESTORE", command.ZRangeStore)
+	r.Register("ZCOUNT", command.ZCount)
+	r.Register("ZLEXCOUNT", command.ZLexCount)
+	r.Register("ZPOPMIN", command.ZPopMin)
+	r.Register("ZPOPMAX", command.ZPopMax)
+	r.Register("ZUNIONSTORE", command.ZUnionStore)
+	r.Register("ZINTERSTORE", command.ZInterStore)
+	r.Register("ZDIFFSTORE", command.ZDiffStore)
+	r.RegisterBlocking("BZPOPMIN", command.BZPopMin)
+	r.RegisterBlocking("BZPOPMAX", command.BZPopMax)
+	// Stream
+	r.Register("XADD", command.XAdd)
+	r.Register("XTRIM", command.XTrim)
+	r.Register("XLEN", command.XLen)
+	r.Register("XRANGE", command.XRange)
+	r.Register("XREVRANGE", command.XRevRange)
+	r.Register("XDEL", command.XDel)
+	r.Register("XGROUP", command.XGroup)
+	r.Register("XACK", command.XAck)
+	r.Register("XPENDING", command.XPending)
+	r.Register("XCLAIM", command.XClaim)
+	r.Register("XAUTOCLAIM", command.XAutoClaim)
+	r.Register("XINFO", command.XInfo)
+	r.RegisterBlocking("XREAD", command.XRead)
+	r.RegisterBlocking("XREADGROUP", command.XReadGroup)
 	s.router = r
 	return s
 }
 
 func (s *Server) Start() error {
-	ln, err := net.Listen("tcp", s.addr)
-	if err != nil {
+	defer close(s.done)
+	// Raft 模式的数据来自 Raft 的快照与日志
+	if !s.RaftEnabled {
+		if err := s.loadData(); err != nil {
+			return err
+		}
+	} else if s.ClusterEnabled {
+		return errors.New("raft mode cannot be combined with cluster mode")
+	}
+	if err := s.startACL(); err != nil {
+		return err
+	}
+	if s.aof != nil {
+		defer s.aof.Close()
+	}
+	if err := s.listen(); err != nil {
 		return err
 	}
-	s.ln = ln
+	close(s.ready)
+	// 监听地址关闭时一并关闭其余监听
+	defer s.closeListeners()
+	if s.ClusterEnabled {
+		if err := s.startCluster(); err != nil {
+			s.ln.Close()
+			return err
+		}
+	}
+	if s.RaftEnabled {
+		if err := s.startRaft(); err != nil {
+			s.ln.Close()
+			return err
+		}
+		defer s.raft.ln.Close()
+	}
 	// 初始化资源限制
 	if s.MaxConns > 0 {
 		s.connLimiter = make(chan struct{}, s.MaxConns)
@@ -59,7 +316,16 @@ func (s *Server) Start() error {
 	if s.MaxMemoryBytes > 0 {
 		s.store.SetMaxMemory(s.MaxMemoryBytes)
 	}
-	log.Printf("redisx server listening on %s", s.addr)
+	for _, ln := range s.listeners {
+		go s.serve(ln)
+		log.Printf("redisx server listening on %s", ln.Addr())
+	}
+	log.Printf("redisx server listening on %s", s.ln.Addr())
+	return s.serve(s.ln)
+}
+
+// serve 接受 ln 上的连接直到其被关闭
+func (s *Server) serve(ln net.Listener) error {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -76,9 +342,12 @@ func (s *Server) Start() error {
 			case s.connLimiter <- struct{}{}:
 				// acquired
 			default:
-				// 拒绝新的连接
-				conn.Write([]byte("-ERR max connections\r\n"))
-				conn.Close()
+				// 拒绝新的连接；TLS 连接的写入需先握手，在独立 goroutine 中写出以免阻塞 Accept
+				go func(c net.Conn) {
+					defer c.Close()
+					_ = c.SetDeadline(time.Now().Add(time.Second))
+					c.Write(protocol.Encode(protocol.Error("ERR max connections"), protocol.RESP2))
+				}(conn)
 				continue
 			}
 		}
@@ -95,209 +364,218 @@ func (s *Server) Start() error {
 	}
 }
 
+// newClient 创建连接的会话状态，新连接使用 RESP2
+func (s *Server) newClient(conn net.Conn) *client {
+	return &client{
+		conn:      conn,
+		id:        atomic.AddUint64(&s.clientIDs, 1),
+		out:       protocol.NewWriter(conn),
+		multiSlot: -1,
+		user:      s.acl.Default(),
+	}
+}
+
 func (s *Server) handleConn(conn net.Conn) {
 	defer conn.Close()
+	c := s.newClient(conn)
+	// 最后写出缓冲中的回复（如 QUIT 与错误），再关闭连接
+	defer c.out.Flush()
+	defer s.closeSubscriber(c)
+	defer s.unwatch(c)
+	if tc, ok := conn.(*tls.Conn); ok && !s.tlsHandshake(c, tc) {
+		return
+	}
 	reader := bufio.NewReader(conn)
+	parser := protocol.NewParser(reader)
+	parser.MaxBulkLen, parser.MaxMultibulkLen = s.ProtoMaxBulkLen, s.MaxMultibulkLen
+	// asked 表示上一条命令为 ASKING：ASKING 只对紧随其后的一条命令有效
+	asked := false
 	for {
-		// 设置读写超时（如果配置了）
+		// 已到达的命令全部处理完后才写出回复：pipeline 中的一批命令只需一次写入
+		if reader.Buffered() == 0 {
+			if err := c.out.Flush(); err != nil {
+				return
+			}
+		}
+		// 设置读写超时（如果配置了）；与 Redis 一致，订阅模式的客户端不受超时限制
 		if s.ConnTimeout > 0 {
-			_ = conn.SetDeadline(time.Now().Add(s.ConnTimeout))
+			if c.sub != nil {
+				_ = conn.SetDeadline(time.Time{})
+			} else {
+				_ = conn.SetDeadline(time.Now().Add(s.ConnTimeout))
+			}
 		}
-		cmd, args, err := protocol.ParseRequest(reader)
+		argv, err := parser.Next()
 		if err != nil {
 			if err == protocol.ErrClosed {
 				return
 			}
 			// 如果是超时错误，给出明确消息
 			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				conn.Write([]byte("-ERR connection timeout\r\n"))
+				_ = conn.SetWriteDeadline(time.Time{})
+				c.write(protocol.Error("ERR connection timeout"))
 				return
 			}
 			// 协议错误，返回错误并关闭连接
-			conn.Write([]byte(fmt.Sprintf("-ERR %v\r\n", err)))
+			c.write(protocol.Error("ERR " + err.Error()))
 			return
 		}
-		// 优先由路由处理可扩展命令
-		if s.router != nil {
-			if resp, handled, rerr := s.router.Handle(cmd, s.store, args); handled {
-				if rerr != nil {
-					conn.Write([]byte(fmt.Sprintf("-ERR %v\r\n", rerr)))
-				} else {
-					conn.Write(resp)
-				}
-				continue
+		// 参数指向解析器复用的缓冲区，只在处理本条命令期间有效；只有需要字符串的
+		// 处理才转换，常见命令的分派不分配内存
+		cmd, args := command.Name(argv[0]), argv[1:]
+		c.asking, asked = asked, false
+		// 与 Redis 一致，参数个数先于认证检查；事务中的错误使 EXEC 放弃事务
+		if !command.CheckArity(cmd, len(argv)) {
+			if c.multi && cmd != "EXEC" && cmd != "DISCARD" {
+				c.dirty = true
 			}
+			c.write(protocol.WrongArgs(strings.ToLower(cmd)))
+			continue
 		}
-		switch strings.ToUpper(cmd) {
-		case "PING":
-			conn.Write([]byte("+PONG\r\n"))
-		case "QUIT":
-			conn.Write([]byte("+OK\r\n"))
-			return
-		case "SET":
-			if len(args) < 2 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'SET' command\r\n"))
+		// 认证与访问控制先于其他处理
+		if cmd == "AUTH" {
+			c.write(s.auth(c, protocol.ArgStrings(args)))
+			continue
+		} else if cmd == "HELLO" {
+			c.write(s.hello(c, protocol.ArgStrings(args)))
+			continue
+		} else if resp := s.checkACL(c, cmd, args); resp != nil {
+			c.write(resp)
+			continue
+		}
+		if s.cluster != nil && cmd == "ASKING" {
+			asked = true
+			c.write(protocol.OK)
+			continue
+		}
+		// 事务命令，以及 MULTI 中的命令入队
+		if s.handleMulti(c, cmd, args) {
+			continue
+		}
+		// 集群模式：键不由本节点服务时重定向
+		if s.cluster != nil {
+			if resp := s.clusterRedirect(c, cmd, protocol.ArgStrings(args)); resp != nil {
+				c.write(resp)
 				continue
 			}
-			key := args[0]
-			value := args[1]
-			// 支持 EX seconds 和 PX milliseconds
-			ttl := int64(0)
-			i := 2
-			bad := false
-			for i < len(args) {
-				op := strings.ToUpper(args[i])
-				switch op {
-				case "EX":
-					if i+1 >= len(args) {
-						conn.Write([]byte("-ERR syntax error\r\n"))
-						bad = true
-						break
-					}
-					sec, err := strconv.ParseInt(args[i+1], 10, 64)
-					if err != nil {
-						conn.Write([]byte("-ERR invalid expire time\r\n"))
-						bad = true
-						break
-					}
-					ttl = sec
-					i += 2
-				case "PX":
-					if i+1 >= len(args) {
-						conn.Write([]byte("-ERR syntax error\r\n"))
-						bad = true
-						break
-					}
-					ms, err := strconv.ParseInt(args[i+1], 10, 64)
-					if err != nil {
-						conn.Write([]byte("-ERR invalid expire time\r\n"))
-						bad = true
-						break
-					}
-					// 转换为秒（向上取整）
-					ttl = (ms + 999) / 1000
-					i += 2
-				default:
-					i++
-				}
-				if bad {
-					break
-				}
+		}
+		// 发布/订阅命令，以及订阅模式下的命令限制
+		if handled, quit := s.handlePubSub(c, cmd, args); handled {
+			if quit {
+				return
 			}
-			if bad {
+			continue
+		}
+		// PSYNC/SYNC 将连接转为复制连接
+		if cmd == "PSYNC" || cmd == "SYNC" {
+			if s.raft.node != nil {
+				c.write(raftUnsupported)
 				continue
 			}
-			// 如果存在 PX 参数则按毫秒设置；否则按秒设置
-			pxMillis := int64(0)
-			for j := 2; j < len(args); j++ {
-				if strings.ToUpper(args[j]) == "PX" && j+1 < len(args) {
-					if ms, err := strconv.ParseInt(args[j+1], 10, 64); err == nil {
-						pxMillis = ms
-					}
-				}
-			}
-			// 如果 storage 配置了 max memory 则使用 TrySet 系列以进行内存检查
-			if s.store.GetMaxMemory() > 0 {
-				if pxMillis > 0 {
-					if !s.store.TrySetWithMs(key, value, pxMillis) {
-						conn.Write([]byte("-ERR max memory reached\r\n"))
+			c.out.Flush()
+			s.serveReplica(c, reader, cmd, protocol.ArgStrings(args))
+			return
+		}
+		// 阻塞命令：等待期间监听连接，断开或超时后撤销等待。Raft 模式下写入须经
+		// 日志提交，阻塞命令按超时处理，不会阻塞。
+		if s.router != nil && s.raft.node == nil && s.router.IsBlocking(cmd) {
+			if sargs := protocol.ArgStrings(args); command.MayBlock(cmd, sargs) {
+				if command.IsWrite(cmd) {
+					if resp := s.denyWrite(); resp != nil {
+						c.write(resp)
 						continue
 					}
-				} else {
-					if !s.store.TrySet(key, value, ttl) {
-						conn.Write([]byte("-ERR max memory reached\r\n"))
-						continue
+				}
+				// 阻塞前写出此前的回复，客户端可能正等待它们
+				c.out.Flush()
+				w := watchConn(conn, reader)
+				resp, _, rerr := s.router.HandleBlocking(cmd, s.store, sargs, w.cancel)
+				s.flushPropagated(c)
+				if werr := w.stop(); werr != nil {
+					if ne, ok := werr.(net.Error); ok && ne.Timeout() {
+						// SetDeadline 同时限制了写，需放开后才能发出错误
+						_ = conn.SetWriteDeadline(time.Time{})
+						c.write(protocol.Error("ERR connection timeout"))
 					}
+					return
 				}
-			} else {
-				if pxMillis > 0 {
-					s.store.SetWithMs(key, value, pxMillis)
+				if rerr != nil {
+					c.write(protocol.Error("ERR " + rerr.Error()))
 				} else {
-					s.store.Set(key, value, ttl)
+					c.write(resp)
 				}
-			}
-			conn.Write([]byte("+OK\r\n"))
-		case "GET":
-			if len(args) < 1 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'GET' command\r\n"))
-				continue
-			}
-			key := args[0]
-			if v, ok := s.store.Get(key); ok {
-				// Bulk string: $<len>\r\n<bytes>\r\n
-				conn.Write([]byte(fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)))
-			} else {
-				conn.Write([]byte("$-1\r\n"))
-			}
-		case "DEL":
-			count := 0
-			for _, k := range args {
-				if s.store.Delete(k) {
-					count++
-				}
-			}
-			conn.Write([]byte(fmt.Sprintf(":%d\r\n", count)))
-		case "EXISTS":
-			count := 0
-			for _, k := range args {
-				if s.store.Exists(k) {
-					count++
-				}
-			}
-			conn.Write([]byte(fmt.Sprintf(":%d\r\n", count)))
-		case "EXPIRE":
-			if len(args) < 2 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'EXPIRE' command\r\n"))
-				continue
-			}
-			key := args[0]
-			ttl, err := strconv.ParseInt(args[1], 10, 64)
-			if err != nil {
-				conn.Write([]byte("-ERR invalid expire time\r\n"))
-				continue
-			}
-			if s.store.Expire(key, ttl) {
-				conn.Write([]byte(":1\r\n"))
-			} else {
-				conn.Write([]byte(":0\r\n"))
-			}
-		case "PEXPIRE":
-			if len(args) < 2 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'PEXPIRE' command\r\n"))
-				continue
-			}
-			key := args[0]
-			ms, err := strconv.ParseInt(args[1], 10, 64)
-			if err != nil {
-				conn.Write([]byte("-ERR invalid expire time\r\n"))
-				continue
-			}
-			if s.store.PExpire(key, ms) {
-				conn.Write([]byte(":1\r\n"))
-			} else {
-				conn.Write([]byte(":0\r\n"))
-			}
-		case "PTTL":
-			if len(args) < 1 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'PTTL' command\r\n"))
 				continue
 			}
-			key := args[0]
-			pttl := s.store.PTTL(key)
-			conn.Write([]byte(fmt.Sprintf(":%d\r\n", pttl)))
-		case "TTL":
-			if len(args) < 1 {
-				conn.Write([]byte("-ERR wrong number of arguments for 'TTL' command\r\n"))
-				continue
+		}
+		// WAIT 阻塞到足够多的副本确认本连接的写入
+		if cmd == "WAIT" {
+			if !s.wait(c, reader, protocol.ArgStrings(args)) {
+				return
 			}
-			key := args[0]
-			ttl := s.store.TTL(key)
-			conn.Write([]byte(fmt.Sprintf(":%d\r\n", ttl)))
-		case "INFO":
-			info := fmt.Sprintf("# Server\r\nredis_version:redisX-0.2.0\r\nconnected_clients:%d\r\nkeys:%d\r\nuptime_in_seconds:%d\r\n", atomic.LoadUint64(&s.connCount), s.store.Count(), int(time.Since(s.startTime).Seconds()))
-			conn.Write([]byte(fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)))
-		default:
-			conn.Write([]byte("-ERR unknown command\r\n"))
+			continue
+		}
+		// RAFT 命令不与写命令互斥，领导者等待提交期间仍能处理节点间的 RPC
+		if cmd == "RAFT" {
+			c.write(s.raftCommand(protocol.ArgStrings(args)))
+			continue
+		}
+		if cmd == "QUIT" {
+			c.write(protocol.OK)
+			return
+		}
+		c.write(s.call(c, cmd, args))
+	}
+}
+
+// execute 执行单个非阻塞命令并返回回复；由调用方负责通过 Shared/Exclusive 与
+// EXEC 互斥并记录 AOF（见 call；事务中的阻塞命令按超时处理，不会阻塞）
+func (s *Server) execute(c *client, cmd string, argv [][]byte) protocol.Reply {
+	// 数据命令由路由处理，参数按处理器的需要转换
+	if resp, handled, rerr := s.router.Handle(cmd, s.store, argv); handled {
+		if rerr != nil {
+			return protocol.Error("ERR " + rerr.Error())
+		}
+		return resp
+	}
+	args := protocol.ArgStrings(argv)
+	switch strings.ToUpper(cmd) {
+	case "PING":
+		return protocol.SimpleString("PONG")
+	case "PUBLISH", "SPUBLISH":
+		return s.publish(cmd, args)
+	case "PUBSUB":
+		return s.pubsubCommand(args)
+	case "SAVE", "BGSAVE", "LASTSAVE":
+		return s.snapshotCommand(cmd, args)
+	case "BGREWRITEAOF":
+		return s.bgrewriteaof()
+	case "REPLICAOF", "SLAVEOF":
+		if s.raft.node != nil {
+			return raftUnsupported
 		}
+		return s.replicaof(args)
+	case "REPLCONF":
+		return s.replconf(c, args)
+	case "CLUSTER":
+		return s.clusterCommand(args)
+	case "ASKING":
+		return clusterDisabledReply
+	case "MIGRATE":
+		return s.migrate(args)
+	case "ACL":
+		return s.aclCommand(c, args)
+	case "CONFIG":
+		return s.configCommand(args)
+	case "WAIT":
+		// 事务中的 WAIT 不阻塞，直接回复已确认的副本数
+		return s.waitNow(c, args)
+	case "UNWATCH":
+		s.unwatch(c)
+		return protocol.OK
+	case "INFO":
+		info := fmt.Sprintf("# Server\r\nredis_version:%s\r\nconnected_clients:%d\r\nblocked_clients:%d\r\nkeys:%d\r\nuptime_in_seconds:%d\r\n", serverVersion, atomic.LoadUint64(&s.connCount), s.store.BlockedClients(), s.store.Count(), int(time.Since(s.startTime).Seconds()))
+		info += "\r\n" + s.persistenceInfo() + "\r\n" + s.replicationInfo() + "\r\n" + s.clusterInfo() + "\r\n" + s.raftInfo()
+		return protocol.Verbatim(info)
 	}
+	return protocol.ErrUnknownCommand
 }
@@ -6,48 +6,35 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"redisx/internal/protocol"
 )
 
-func startServer(t *testing.T) *Server {
+func startServer(t testing.TB) *Server {
+	return startConfigured(t, newTestServer(t))
+}
+
+// newTestServer 返回监听随机端口的服务器，快照与 RDB 文件写在测试的临时目录下，
+// 不留在包目录中
+func newTestServer(t testing.TB) *Server {
 	s := NewServer(":0")
-	go func() {
-		if err := s.Start(); err != nil {
-			t.Fatalf("start server: %v", err)
-		}
-	}()
-	// 等待 listener 就绪
-	for i := 0; i < 50; i++ {
-		if s.ln != nil {
-			return s
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	t.Fatalf("server failed to start")
-	return nil
+	dir := t.TempDir()
+	s.SnapshotPath = filepath.Join(dir, "redisx.snap")
+	s.RDBPath = filepath.Join(dir, "dump.rdb")
+	return s
 }
 
 func startServerWithConfig(t *testing.T, maxConns int, connTimeout time.Duration, maxMemory int64) *Server {
-	s := NewServer(":0")
+	s := newTestServer(t)
 	s.MaxConns = maxConns
 	s.ConnTimeout = connTimeout
 	s.MaxMemoryBytes = maxMemory
-	go func() {
-		if err := s.Start(); err != nil {
-			t.Fatalf("start server: %v", err)
-		}
-	}()
-	for i := 0; i < 50; i++ {
-		if s.ln != nil {
-			return s
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
-	t.Fatalf("server failed to start")
-	return nil
+	return startConfigured(t, s)
 }
 
 func writeReq(conn net.Conn, parts ...string) error {
@@ -325,3 +312,144 @@ func TestMaxMemory(t *testing.T) {
 		t.Fatalf("expected max memory error, got %q", line)
 	}
 }
+
+func TestHashCommandsAndWrongType(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if err := writeReq(conn, "HSET", "user", "name", "redisx", "age", "1"); err != nil {
+		t.Fatalf("write hset: %v", err)
+	}
+	line, _ := readLine(r)
+	if line != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", line)
+	}
+	if err := writeReq(conn, "HGET", "user", "name"); err != nil {
+		t.Fatalf("write hget: %v", err)
+	}
+	val, _ := readBulk(r)
+	if val != "redisx" {
+		t.Fatalf("expected redisx, got %q", val)
+	}
+	if err := writeReq(conn, "GET", "user"); err != nil {
+		t.Fatalf("write get: %v", err)
+	}
+	line, _ = readLine(r)
+	if !strings.HasPrefix(line, "-WRONGTYPE") {
+		t.Fatalf("expected WRONGTYPE, got %q", line)
+	}
+}
+
+func TestListMaxMemory(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	s.store.SetMaxMemory(4)
+
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if err := writeReq(conn, "RPUSH", "q", "ab", "cd"); err != nil {
+		t.Fatalf("write rpush: %v", err)
+	}
+	line, _ := readLine(r)
+	if line != ":2\r\n" {
+		t.Fatalf("expected :2, got %q", line)
+	}
+	if err := writeReq(conn, "RPUSH", "q", "e"); err != nil {
+		t.Fatalf("write rpush: %v", err)
+	}
+	line, _ = readLine(r)
+	if line != "-ERR max memory reached\r\n" {
+		t.Fatalf("expected max memory error, got %q", line)
+	}
+}
+
+func TestProtocolLimits(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath = ""
+	s.MaxMultibulkLen = 4
+	startConfigured(t, s)
+	defer s.ln.Close()
+
+	// 超过限制或格式错误的请求回复协议错误后关闭连接
+	for _, tt := range []struct{ req, want string }{
+		{"*1\r\n$999999999\r\n", "-ERR Protocol error: invalid bulk length"},
+		{"*5\r\n", "-ERR Protocol error: invalid multibulk length"},
+		{"*x\r\n", "-ERR Protocol error: invalid multibulk length"},
+		{"*1\r\n+PING\r\n", "-ERR Protocol error: expected '$', got '+'"},
+		{"GET \"k\r\n", "-ERR Protocol error: unbalanced quotes in request"},
+	} {
+		conn, r := dialServer(t, s)
+		if _, err := conn.Write([]byte(tt.req)); err != nil {
+			t.Fatal(err)
+		}
+		expectLine(t, conn, r, tt.want)
+		if line, err := readLine(r); err != io.EOF {
+			t.Fatalf("%q: expected the connection to be closed, got %q (%v)", tt.req, line, err)
+		}
+		conn.Close()
+	}
+
+	// 参数个数为负数的请求被跳过
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	if _, err := conn.Write([]byte("*-1\r\n*1\r\n$4\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, conn, r, "+PONG")
+
+	// inline 命令中带引号与转义的参数
+	if _, err := conn.Write([]byte("SET \"a b\" \"x\\r\\n\\x00y\"\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	expectLine(t, conn, r, "+OK")
+	writeReq(conn, "GET", "a b")
+	if v, err := readBulk(r); err != nil || v != "x\r\n\x00y" {
+		t.Fatalf("GET: %q (%v)", v, err)
+	}
+	expectLine(t, conn, r, "*2", "CONFIG", "GET", "max-multibulk-len")
+	readBulk(r)
+	if v, _ := readBulk(r); v != "4" {
+		t.Fatalf("max-multibulk-len: %q", v)
+	}
+}
+
+func TestArityCheckedBeforeDispatch(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	// 服务器命令缺少参数时返回错误，不会使服务器崩溃
+	expectLine(t, conn, r, "-ERR wrong number of arguments for 'config' command", "CONFIG")
+	expectLine(t, conn, r, "-ERR wrong number of arguments for 'acl' command", "acl")
+	expectLine(t, conn, r, "-ERR wrong number of arguments for 'get' command", "GET")
+	if resp := s.configCommand(nil); resp != protocol.WrongArgs("config") {
+		t.Fatalf("CONFIG without a subcommand: %v", resp)
+	}
+	// 事务中参数个数错误的命令使 EXEC 放弃事务
+	expectLine(t, conn, r, "+OK", "MULTI")
+	expectLine(t, conn, r, "-ERR wrong number of arguments for 'config' command", "CONFIG")
+	expectLine(t, conn, r, "-EXECABORT Transaction discarded because of previous errors.", "EXEC")
+	expectLine(t, conn, r, "+PONG", "PING")
+}
+
+func TestErrorRepliesKeepFraming(t *testing.T) {
+	s := startServer(t)
+	defer s.ln.Close()
+	conn, r := dialServer(t, s)
+	defer conn.Close()
+	// 错误信息中带换行的参数不会注入额外的回复
+	expectLine(t, conn, r, "-ERR unknown subcommand or wrong number of arguments for 'x  +OK'. Try CONFIG HELP.", "CONFIG", "x\r\n+OK")
+	expectLine(t, conn, r, "+PONG", "PING")
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"redisx/internal/protocol"
+	"redisx/internal/rdb"
+	"redisx/internal/storage"
+)
+
+// defaultSnapshotPath 为默认的快照文件路径（相对于工作目录）
+const defaultSnapshotPath = "redisx.snap"
+
+// defaultRDBPath 为默认导入的 Redis RDB 文件路径（与 Redis 的默认文件名相同）
+const defaultRDBPath = "dump.rdb"
+
+// errSaveInProgress 表示已有后台保存在进行
+var errSaveInProgress = errors.New("Background save already in progress")
+
+// snapshotState 记录快照持久化的状态，供 LASTSAVE 与 INFO 使用
+type snapshotState struct {
+	mu         sync.Mutex
+	inProgress bool      // 正在进行 SAVE 或 BGSAVE
+	scheduled  bool      // BGSAVE SCHEDULE 请求在当前保存结束后再执行一次
+	bgStart    time.Time // 当前 BGSAVE 的开始时间
+	lastSave   time.Time // 最近一次成功保存的时间
+	lastStatus string    // 最近一次 BGSAVE 的结果（ok/err）
+	lastBgTime time.Duration
+	changes    int64 // 最近一次成功保存时的累计修改次数
+}
+
+// loadSnapshot 在启动时加载快照文件；文件不存在时尝试导入 Redis 的 RDB 文件
+func (s *Server) loadSnapshot() error {
+	if s.SnapshotPath == "" {
+		return s.loadRDB()
+	}
+	f, err := os.Open(s.SnapshotPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.loadRDB()
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	n, err := s.store.LoadSnapshot(f)
+	if err != nil {
+		return fmt.Errorf("load snapshot %s: %w", s.SnapshotPath, err)
+	}
+	s.snap.mu.Lock()
+	s.snap.changes = s.store.Changes()
+	s.snap.mu.Unlock()
+	log.Printf("loaded %d keys from %s in %v", n, s.SnapshotPath, time.Since(start))
+	return nil
+}
+
+// loadRDB 导入 RDBPath 指向的 Redis RDB 文件；文件不存在时视为空数据。导入的数据
+// 不计为已保存，之后的 SAVE/BGSAVE 会将其写入快照文件。
+func (s *Server) loadRDB() error {
+	if s.RDBPath == "" {
+		return nil
+	}
+	f, err := os.Open(s.RDBPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	start := time.Now()
+	st, err := rdb.Load(f, s.store)
+	if err != nil {
+		return fmt.Errorf("load RDB %s: %w", s.RDBPath, err)
+	}
+	log.Printf("imported %d keys from %s in %v (%d expired, %d skipped)", st.Keys, s.RDBPath, time.Since(start), st.Expired, st.Skipped)
+	return nil
+}
+
+// writeSnapshot 将快照写入临时文件后原子地替换目标文件
+func writeSnapshot(path string, sn *storage.Snapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := sn.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// beginSave 标记保存开始；已有保存进行中时返回 errSaveInProgress
+func (s *Server) beginSave() error {
+	s.snap.mu.Lock()
+	defer s.snap.mu.Unlock()
+	if s.snap.inProgress {
+		return errSaveInProgress
+	}
+	s.snap.inProgress = true
+	return nil
+}
+
+// finishSave 记录保存结果；返回是否需要执行被 SCHEDULE 推迟的 BGSAVE
+func (s *Server) finishSave(sn *storage.Snapshot, err error, background bool, start time.Time) bool {
+	s.snap.mu.Lock()
+	defer s.snap.mu.Unlock()
+	s.snap.inProgress = false
+	s.snap.bgStart = time.Time{}
+	if err == nil {
+		s.snap.lastSave = time.Now()
+		s.snap.changes = sn.Changes
+	}
+	if background {
+		s.snap.lastBgTime = time.Since(start)
+		s.snap.lastStatus = "ok"
+		if err != nil {
+			s.snap.lastStatus = "err"
+			log.Printf("background save failed: %v", err)
+		}
+	}
+	scheduled := s.snap.scheduled
+	s.snap.scheduled = false
+	return scheduled
+}
+
+// save 实现 SAVE：在当前连接上同步写出快照
+func (s *Server) save() error {
+	if s.SnapshotPath == "" {
+		return errors.New("snapshot persistence is disabled")
+	}
+	if err := s.beginSave(); err != nil {
+		return err
+	}
+	start := time.Now()
+	sn := s.store.Snapshot()
+	err := writeSnapshot(s.SnapshotPath, sn)
+	sn.Release()
+	if s.finishSave(sn, err, false, start) {
+		s.bgsave(false)
+	}
+	return err
+}
+
+// bgsave 实现 BGSAVE：在后台 goroutine 中写出创建时刻的快照。快照通过写时复制
+// 保持一致，写出期间不持有 Storage 的锁。schedule 为 true 且已有保存进行中时，
+// 在其结束后再执行一次。
+func (s *Server) bgsave(schedule bool) (scheduled bool, err error) {
+	if s.SnapshotPath == "" {
+		return false, errors.New("snapshot persistence is disabled")
+	}
+	if err := s.beginSave(); err != nil {
+		if !schedule {
+			return false, err
+		}
+		s.snap.mu.Lock()
+		s.snap.scheduled = true
+		s.snap.mu.Unlock()
+		return true, nil
+	}
+	start := time.Now()
+	s.snap.mu.Lock()
+	s.snap.bgStart = start
+	s.snap.mu.Unlock()
+	sn := s.store.Snapshot()
+	go func() {
+		err := writeSnapshot(s.SnapshotPath, sn)
+		sn.Release()
+		if s.finishSave(sn, err, true, start) {
+			s.bgsave(false)
+		}
+	}()
+	return false, nil
+}
+
+// snapshotCommand 实现 SAVE/BGSAVE/LASTSAVE
+func (s *Server) snapshotCommand(cmd string, args []string) protocol.Reply {
+	switch strings.ToUpper(cmd) {
+	case "SAVE":
+		if err := s.save(); err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		return protocol.OK
+	case "BGSAVE":
+		schedule := false
+		if len(args) == 1 && strings.ToUpper(args[0]) == "SCHEDULE" {
+			schedule = true
+		} else if len(args) > 0 {
+			return protocol.ErrSyntax
+		}
+		scheduled, err := s.bgsave(schedule)
+		if err != nil {
+			return protocol.Error("ERR " + err.Error())
+		}
+		if scheduled {
+			return protocol.SimpleString("Background saving scheduled")
+		}
+		return protocol.SimpleString("Background saving started")
+	default: // LASTSAVE
+		s.snap.mu.Lock()
+		defer s.snap.mu.Unlock()
+		return protocol.Integer(s.snap.lastSave.Unix())
+	}
+}
+
+// persistenceInfo 返回 INFO 的 Persistence 段
+func (s *Server) persistenceInfo() string {
+	changes := s.store.Changes()
+	s.snap.mu.Lock()
+	defer s.snap.mu.Unlock()
+	inProgress, current := 0, int64(-1)
+	if s.snap.inProgress && !s.snap.bgStart.IsZero() {
+		inProgress = 1
+		current = int64(time.Since(s.snap.bgStart).Seconds())
+	}
+	lastBgTime := int64(-1)
+	if s.snap.lastStatus != "" {
+		lastBgTime = int64(s.snap.lastBgTime.Seconds())
+	}
+	status := s.snap.lastStatus
+	if status == "" {
+		status = "ok"
+	}
+	return fmt.Sprintf("# Persistence\r\nrdb_changes_since_last_save:%d\r\nrdb_bgsave_in_progress:%d\r\nrdb_last_save_time:%d\r\nrdb_last_bgsave_status:%s\r\nrdb_last_bgsave_time_sec:%d\r\nrdb_current_bgsave_time_sec:%d\r\n",
+		changes-s.snap.changes, inProgress, s.snap.lastSave.Unix(), status, lastBgTime, current) + s.aofInfo()
+}
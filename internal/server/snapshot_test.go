@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"redisx/internal/rdb"
+	"redisx/internal/storage"
+)
+
+func startServerWithSnapshot(t *testing.T, path string) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath = path
+	return startConfigured(t, s)
+}
+
+// startConfigured 启动已配置好的服务器并等待其开始监听
+func startConfigured(t testing.TB, s *Server) *Server {
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+	select {
+	case <-s.ready:
+		return s
+	case err := <-errc:
+		t.Fatalf("start server: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("server failed to start")
+	}
+	return nil
+}
+
+// infoField 从 INFO 输出中取出某个字段
+func infoField(t *testing.T, conn net.Conn, r *bufio.Reader, field string) string {
+	t.Helper()
+	writeReq(conn, "INFO")
+	info, err := readBulk(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(info, "\r\n") {
+		if v, ok := strings.CutPrefix(line, field+":"); ok {
+			return v
+		}
+	}
+	t.Fatalf("INFO has no %s field:\n%s", field, info)
+	return ""
+}
+
+func TestSaveAndLoadOnStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.snap")
+	s := startServerWithSnapshot(t, path)
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	expectLine(t, conn, r, "+OK", "SET", "k", "v")
+	expectLine(t, conn, r, "+OK", "SET", "short", "v", "PX", "50")
+	expectLine(t, conn, r, ":2", "RPUSH", "l", "a", "b")
+	if got := infoField(t, conn, r, "rdb_changes_since_last_save"); got == "0" {
+		t.Fatal("expected pending changes before SAVE")
+	}
+	expectLine(t, conn, r, "+OK", "SAVE")
+	if got := infoField(t, conn, r, "rdb_changes_since_last_save"); got != "0" {
+		t.Fatalf("expected no pending changes after SAVE, got %s", got)
+	}
+	conn.Close()
+	s.ln.Close()
+
+	// 重启后加载快照；已过期的键被跳过
+	time.Sleep(60 * time.Millisecond)
+	s2 := startServerWithSnapshot(t, path)
+	defer s2.ln.Close()
+	conn2, err := net.Dial("tcp", s2.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	r2 := bufio.NewReader(conn2)
+	expectLine(t, conn2, r2, "$1", "GET", "k")
+	expectLine(t, conn2, r2, "v")
+	expectLine(t, conn2, r2, ":0", "EXISTS", "short")
+	expectLine(t, conn2, r2, ":2", "LLEN", "l")
+	if got := infoField(t, conn2, r2, "keys"); got != "2" {
+		t.Fatalf("expected 2 keys after load, got %s", got)
+	}
+}
+
+func TestBgsave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.snap")
+	s := startServerWithSnapshot(t, path)
+	defer s.ln.Close()
+	conn, err := net.Dial("tcp", s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for i := 0; i < 100; i++ {
+		expectLine(t, conn, r, "+OK", "SET", "k"+strconv.Itoa(i), "v")
+	}
+	writeReq(conn, "LASTSAVE")
+	line, _ := readLine(r)
+	before := strings.TrimSpace(line)
+	time.Sleep(1100 * time.Millisecond)
+
+	expectLine(t, conn, r, "+Background saving started", "BGSAVE")
+	// 后台保存期间的写入不影响快照内容
+	expectLine(t, conn, r, "+OK", "SET", "k0", "changed")
+	deadline := time.Now().Add(5 * time.Second)
+	for infoField(t, conn, r, "rdb_bgsave_in_progress") != "0" {
+		if time.Now().After(deadline) {
+			t.Fatal("BGSAVE did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := infoField(t, conn, r, "rdb_last_bgsave_status"); got != "ok" {
+		t.Fatalf("expected bgsave status ok, got %s", got)
+	}
+	writeReq(conn, "LASTSAVE")
+	line, _ = readLine(r)
+	if after := strings.TrimSpace(line); after == before {
+		t.Fatalf("LASTSAVE not updated: %s", after)
+	}
+
+	s2 := startServerWithSnapshot(t, path)
+	defer s2.ln.Close()
+	if n := s2.store.Count(); n != 100 {
+		t.Fatalf("expected 100 keys, got %d", n)
+	}
+	if v, _ := s2.store.Get("k0"); string(v) != "v" {
+		t.Fatalf("expected point-in-time value, got %q", v)
+	}
+}
+
+func TestLoadRDBOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	src := storage.NewStorage()
+	src.Set("k", []byte("v"), 0)
+	src.SetWithMs("ttl", []byte("v"), 60000)
+	src.RPush("l", []string{"a", "b"})
+	sn := src.Snapshot()
+	f, err := os.Create(filepath.Join(dir, "dump.rdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rdb.Write(f, sn); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	sn.Release()
+
+	s := NewServer(":0")
+	s.SnapshotPath = filepath.Join(dir, "dump.snap")
+	s.RDBPath = filepath.Join(dir, "dump.rdb")
+	startConfigured(t, s)
+	conn, r := dialServer(t, s)
+	expectLine(t, conn, r, "$1", "GET", "k")
+	expectLine(t, conn, r, "v")
+	if s.store.PTTL("ttl") <= 0 {
+		t.Fatal("expected TTL to be imported")
+	}
+	if got := infoField(t, conn, r, "rdb_changes_since_last_save"); got == "0" {
+		t.Fatal("imported data should count as unsaved")
+	}
+	// 快照文件存在后以快照为准，不再导入 RDB
+	expectLine(t, conn, r, ":1", "DEL", "k")
+	expectLine(t, conn, r, "+OK", "SAVE")
+	conn.Close()
+	s.ln.Close()
+
+	s2 := NewServer(":0")
+	s2.SnapshotPath = s.SnapshotPath
+	s2.RDBPath = s.RDBPath
+	startConfigured(t, s2)
+	defer s2.ln.Close()
+	if s2.store.Exists("k") {
+		t.Fatal("expected the snapshot to take precedence over the RDB file")
+	}
+	if l, _ := s2.store.LRange("l", 0, -1); len(l) != 2 {
+		t.Fatalf("unexpected list %v", l)
+	}
+}
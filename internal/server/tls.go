@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tlsHandshakeTimeout 为未配置 ConnTimeout 时 TLS 握手的超时
+const tlsHandshakeTimeout = 10 * time.Second
+
+// tlsState 保存当前使用的证书；重新加载时整体替换，只影响之后的握手
+type tlsState struct {
+	certs atomic.Pointer[tlsCerts]
+	// mu 保护证书、私钥与 CA 的文件路径，CONFIG SET 可在运行时修改它们
+	mu sync.RWMutex
+}
+
+type tlsCerts struct {
+	cert tls.Certificate
+	// clientCAs 为验证客户端证书的 CA，未配置 TLSCAFile 时为 nil
+	clientCAs *x509.CertPool
+}
+
+// tlsEnabled 报告是否配置了 TLS
+func (s *Server) tlsEnabled() bool {
+	return s.TLSCertFile != "" || s.TLSKeyFile != ""
+}
+
+// ReloadTLS loads the certificate, key and CA files again. New connections
+// use the new certificates; established connections are not affected. On
+// error the current certificates are kept. CONFIG SET of tls-cert-file,
+// tls-key-file or tls-ca-cert-file also reloads the certificates.
+func (s *Server) ReloadTLS() error {
+	s.tls.mu.RLock()
+	defer s.tls.mu.RUnlock()
+	return s.reloadTLS()
+}
+
+// reloadTLS 实现 ReloadTLS；调用方需持有 s.tls.mu
+func (s *Server) reloadTLS() error {
+	if !s.tlsEnabled() {
+		return errors.New("TLS is not configured")
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if s.TLSCAFile != "" {
+		pem, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return fmt.Errorf("load tls ca: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load tls ca: no certificates found in %s", s.TLSCAFile)
+		}
+	}
+	s.tls.certs.Store(&tlsCerts{cert: cert, clientCAs: pool})
+	return nil
+}
+
+// tlsConfig 校验 TLS 配置、加载证书并返回监听使用的配置。每次握手时取当前的
+// 证书，ReloadTLS 之后无需重新创建监听。
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	base := &tls.Config{}
+	switch s.TLSMinVersion {
+	case "", "1.2":
+		base.MinVersion = tls.VersionTLS12
+	case "1.3":
+		base.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid tls min version %q, must be 1.2 or 1.3", s.TLSMinVersion)
+	}
+	if s.TLSCipherSuites != "" {
+		// TLS 1.3 的套件不可配置，只影响 TLS 1.2
+		ids := map[string]uint16{}
+		for _, cs := range tls.CipherSuites() {
+			ids[cs.Name] = cs.ID
+		}
+		for _, name := range strings.Split(s.TLSCipherSuites, ":") {
+			id, ok := ids[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure tls cipher suite %q", name)
+			}
+			base.CipherSuites = append(base.CipherSuites, id)
+		}
+	}
+	switch s.TLSAuthClients {
+	case "no":
+		base.ClientAuth = tls.NoClientCert
+	case "optional":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case "", "yes":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid tls auth clients %q, must be yes, no or optional", s.TLSAuthClients)
+	}
+	if base.ClientAuth != tls.NoClientCert && s.TLSCAFile == "" {
+		return nil, errors.New("tls client authentication requires a CA file")
+	}
+	if err := s.ReloadTLS(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			certs := s.tls.certs.Load()
+			c := base.Clone()
+			c.Certificates = []tls.Certificate{certs.cert}
+			c.ClientCAs = certs.clientCAs
+			return c, nil
+		},
+	}, nil
+}
+
+// tlsHandshake 完成 TLS 握手；开启 TLSClientCertUser 时将客户端证书的 CN 所对应
+// 的 ACL 用户作为连接的用户。握手失败时返回 false。
+func (s *Server) tlsHandshake(c *client, conn *tls.Conn) bool {
+	timeout := s.ConnTimeout
+	if timeout <= 0 {
+		timeout = tlsHandshakeTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return false
+	}
+	if certs := conn.ConnectionState().PeerCertificates; s.TLSClientCertUser && len(certs) > 0 {
+		if u := s.acl.Lookup(certs[0].Subject.CommonName); u != nil {
+			c.user = u
+		}
+	}
+	return true
+}
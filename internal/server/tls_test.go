@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert 为测试生成的证书与私钥
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+var testSerial int64
+
+// newTestCert 生成 CN 为 cn 的证书；parent 为 nil 时生成自签名的 CA
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeServerCert 写出服务器的证书、私钥与 CA，并设置到 s 的 TLS 配置
+func writeServerCert(t *testing.T, s *Server, dir string, ca, cert *testCert) {
+	t.Helper()
+	s.TLSCertFile = filepath.Join(dir, "server.crt")
+	s.TLSKeyFile = filepath.Join(dir, "server.key")
+	s.TLSCAFile = filepath.Join(dir, "ca.crt")
+	for path, data := range map[string][]byte{s.TLSCertFile: cert.certPEM, s.TLSKeyFile: cert.keyPEM, s.TLSCAFile: ca.certPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dialTLS 以 cert（可为 nil）为客户端证书连接 addr
+func dialTLS(t *testing.T, addr string, ca *testCert, cert *testCert) (*tls.Conn, *bufio.Reader, error) {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{cert.tlsCert(t)}
+	}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// TLS 1.3 下服务器拒绝客户端证书发生在客户端握手完成之后，读一次才能发现
+	return conn, bufio.NewReader(conn), nil
+}
+
+func TestTLSClientCertUser(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	s.RequirePass = "secret"
+	s.TLSClientCertUser = true
+	writeServerCert(t, s, dir, ca, newTestCert(t, "server", ca))
+	if err := s.acl.SetUser("alice", "on", "~*", "+@all"); err != nil {
+		t.Fatal(err)
+	}
+	startConfigured(t, s)
+	defer s.ln.Close()
+	addr := s.ln.Addr().String()
+
+	// CN 对应 ACL 用户的客户端自动认证
+	conn, r, err := dialTLS(t, addr, ca, newTestCert(t, "alice", ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectLine(t, conn, r, "$5", "ACL", "WHOAMI")
+	expectLine(t, conn, r, "alice")
+	expectLine(t, conn, r, "+OK", "SET", "k", "v")
+
+	// CN 没有对应的用户时需要 AUTH
+	conn2, r2, err := dialTLS(t, addr, ca, newTestCert(t, "mallory", ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	expectLine(t, conn2, r2, "-NOAUTH Authentication required.", "GET", "k")
+	expectLine(t, conn2, r2, "+OK", "AUTH", "secret")
+
+	// 未提供证书或证书不是由 CA 签发的客户端无法连接
+	other := newTestCert(t, "other-ca", nil)
+	for _, cert := range []*testCert{nil, newTestCert(t, "alice", other)} {
+		conn, r, err := dialTLS(t, addr, ca, cert)
+		if err == nil {
+			writeReq(conn, "PING")
+			_, err = r.ReadString('\n')
+			conn.Close()
+		}
+		if err == nil {
+			t.Fatalf("client certificate %v accepted", cert != nil)
+		}
+	}
+
+	// 明文连接无法使用 TLS 端口
+	plain, pr := dialServer(t, s)
+	defer plain.Close()
+	writeReq(plain, "PING")
+	if line, err := pr.ReadString('\n'); err == nil {
+		t.Fatalf("plaintext client got %q", line)
+	}
+}
+
+func TestTLSSeparatePortAndReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	s.TLSAddr = "127.0.0.1:0"
+	s.TLSAuthClients = "no"
+	s.TLSMinVersion = "1.3"
+	writeServerCert(t, s, dir, ca, newTestCert(t, "server-1", ca))
+	startConfigured(t, s)
+	defer s.ln.Close()
+	tlsAddr := s.tlsLn.Addr().String()
+
+	// 明文端口不受影响
+	plain, pr := dialServer(t, s)
+	defer plain.Close()
+	expectLine(t, plain, pr, "+OK", "SET", "k", "v")
+
+	conn, r, err := dialTLS(t, tlsAddr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectLine(t, conn, r, "$1", "GET", "k")
+	expectLine(t, conn, r, "v")
+	if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "server-1" {
+		t.Fatalf("server certificate CN = %q", cn)
+	}
+
+	// 低于最低版本的客户端无法握手
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	if c, err := tls.Dial("tcp", tlsAddr, &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12}); err == nil {
+		c.Close()
+		t.Fatal("TLS 1.2 client accepted")
+	}
+
+	// 重新加载证书后新连接使用新证书，已有连接不断开
+	writeServerCert(t, s, dir, ca, newTestCert(t, "server-2", ca))
+	if err := s.ReloadTLS(); err != nil {
+		t.Fatal(err)
+	}
+	conn2, r2, err := dialTLS(t, tlsAddr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	expectLine(t, conn2, r2, "+PONG", "PING")
+	if cn := conn2.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "server-2" {
+		t.Fatalf("server certificate CN after reload = %q", cn)
+	}
+	expectLine(t, conn, r, "+PONG", "PING")
+
+	// 加载失败时保留当前证书
+	if err := os.WriteFile(s.TLSKeyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadTLS(); err == nil {
+		t.Fatal("reload with an invalid key succeeded")
+	}
+	conn3, r3, err := dialTLS(t, tlsAddr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn3.Close()
+	expectLine(t, conn3, r3, "+PONG", "PING")
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	for _, tt := range []struct {
+		name  string
+		apply func(s *Server)
+	}{
+		{"client auth without ca", func(s *Server) { s.TLSCAFile = "" }},
+		{"min version", func(s *Server) { s.TLSMinVersion = "1.1" }},
+		{"cipher suite", func(s *Server) { s.TLSCipherSuites = "TLS_RSA_WITH_RC4_128_SHA" }},
+		{"auth clients", func(s *Server) { s.TLSAuthClients = "maybe" }},
+	} {
+		s := NewServer("127.0.0.1:0")
+		s.SnapshotPath = ""
+		s.RDBPath = ""
+		writeServerCert(t, s, dir, ca, newTestCert(t, "server", ca))
+		tt.apply(s)
+		if err := s.Start(); err == nil {
+			t.Fatalf("%s: Start succeeded", tt.name)
+		}
+	}
+}
+
+func TestTLSReloadWithConfigSet(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	s := NewServer("127.0.0.1:0")
+	s.SnapshotPath = ""
+	s.RDBPath = ""
+	s.TLSAddr = "127.0.0.1:0"
+	s.TLSAuthClients = "no"
+	writeServerCert(t, s, dir, ca, newTestCert(t, "server-1", ca))
+	startConfigured(t, s)
+	defer s.ln.Close()
+	tlsAddr := s.tlsLn.Addr().String()
+	plain, pr := dialServer(t, s)
+	defer plain.Close()
+
+	// 运行中的服务器换用另一组证书文件：新连接使用新证书
+	next := newTestCert(t, "server-2", ca)
+	certFile, keyFile := filepath.Join(dir, "next.crt"), filepath.Join(dir, "next.key")
+	for path, data := range map[string][]byte{certFile: next.certPEM, keyFile: next.keyPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLine(t, plain, pr, "+OK", "CONFIG", "SET", "tls-cert-file", certFile, "tls-key-file", keyFile)
+	conn, r, err := dialTLS(t, tlsAddr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectLine(t, conn, r, "+PONG", "PING")
+	if cn := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "server-2" {
+		t.Fatalf("server certificate CN after CONFIG SET = %q", cn)
+	}
+
+	// 加载失败时回复错误，参数与证书都保持不变
+	writeReq(plain, "CONFIG", "SET", "tls-key-file", filepath.Join(dir, "missing.key"))
+	if line, _ := readLine(pr); !strings.HasPrefix(line, "-ERR CONFIG SET failed") {
+		t.Fatalf("expected CONFIG SET error, got %q", line)
+	}
+	expectLine(t, plain, pr, "*2", "CONFIG", "GET", "tls-key-file")
+	expectLine(t, plain, pr, "$12")
+	expectLine(t, plain, pr, "tls-key-file")
+	if line, _ := readBulk(pr); line != keyFile {
+		t.Fatalf("tls-key-file after failed CONFIG SET = %q", line)
+	}
+	expectLine(t, plain, pr, "-ERR Unknown option or number of arguments for CONFIG SET - 'maxclients'", "CONFIG", "SET", "maxclients", "1")
+	conn2, r2, err := dialTLS(t, tlsAddr, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	expectLine(t, conn2, r2, "+PONG", "PING")
+	if cn := conn2.ConnectionState().PeerCertificates[0].Subject.CommonName; cn != "server-2" {
+		t.Fatalf("server certificate CN after failed CONFIG SET = %q", cn)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"time"
+
+	"redisx/internal/protocol"
+)
+
+const defaultMinReplicasMaxLag = 10 * time.Second
+
+const noReplicasReply protocol.Error = "NOREPLICAS Not enough good replicas to write."
+
+// waitArgs 解析 WAIT numreplicas timeout；timeout 以毫秒计，0 表示一直等待
+func (s *Server) waitArgs(args []string) (int, time.Duration, protocol.Reply) {
+	if len(args) != 2 {
+		return 0, 0, protocol.WrongArgs("wait")
+	}
+	if s.isReplica() {
+		return 0, 0, protocol.Error("ERR WAIT cannot be used with replica instances.")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, 0, protocol.ErrNotInteger
+	}
+	ms, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return 0, 0, protocol.Error("ERR timeout is not an integer or out of range")
+	}
+	if ms < 0 {
+		return 0, 0, protocol.Error("ERR timeout is negative")
+	}
+	return n, time.Duration(ms) * time.Millisecond, nil
+}
+
+// ackedReplicas 返回已确认偏移 off 的在线副本数，以及下一次有副本确认时关闭的通道
+func (s *Server) ackedReplicas(off int64) (int, <-chan struct{}) {
+	rs := &s.replication
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	n := 0
+	for rep := range rs.replicas {
+		if rep.online && rep.ackOffset >= off {
+			n++
+		}
+	}
+	if rs.acked == nil {
+		rs.acked = make(chan struct{})
+	}
+	return n, rs.acked
+}
+
+// waitNow 不等待地回复已确认本连接写入的副本数（事务中的 WAIT）
+func (s *Server) waitNow(c *client, args []string) protocol.Reply {
+	if _, _, errResp := s.waitArgs(args); errResp != nil {
+		return errResp
+	}
+	n, _ := s.ackedReplicas(c.woff)
+	return protocol.Integer(n)
+}
+
+// wait 实现 WAIT：阻塞到至少 numreplicas 个副本确认了本连接最后一次写入的复制
+// 偏移或超时，回复已确认的副本数。等待期间通过 REPLCONF GETACK 请求副本立即
+// 确认。连接在等待期间断开或超时时返回 false。
+func (s *Server) wait(c *client, r *bufio.Reader, args []string) bool {
+	want, timeout, errResp := s.waitArgs(args)
+	if errResp != nil {
+		c.write(errResp)
+		return true
+	}
+	n, acked := s.ackedReplicas(c.woff)
+	if n < want {
+		s.feedIfMaster("REPLCONF", "GETACK", "*")
+		var expire <-chan time.Time
+		if timeout > 0 {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			expire = t.C
+		}
+		c.out.Flush()
+		w := watchConn(c.conn, r)
+	loop:
+		for n < want {
+			select {
+			case <-acked:
+				n, acked = s.ackedReplicas(c.woff)
+			case <-expire:
+				break loop
+			case <-w.cancel:
+				break loop
+			}
+		}
+		if werr := w.stop(); werr != nil {
+			if ne, ok := werr.(net.Error); ok && ne.Timeout() {
+				_ = c.conn.SetWriteDeadline(time.Time{})
+				c.write(protocol.Error("ERR connection timeout"))
+			}
+			return false
+		}
+		n, _ = s.ackedReplicas(c.woff)
+	}
+	c.write(protocol.Integer(n))
+	return true
+}
+
+// goodReplicasLocked 返回最近 MinReplicasMaxLag 内确认过偏移的在线副本数；
+// 调用方需持有 replication.mu
+func (s *Server) goodReplicasLocked() int {
+	n := 0
+	for rep := range s.replication.replicas {
+		if rep.online && time.Since(rep.ackTime) <= s.MinReplicasMaxLag {
+			n++
+		}
+	}
+	return n
+}
+
+// minReplicasReply 在配置了 MinReplicasToWrite 且健康的副本不足时返回 NOREPLICAS；
+// 副本节点不检查
+func (s *Server) minReplicasReply() protocol.Reply {
+	if s.MinReplicasToWrite <= 0 {
+		return nil
+	}
+	s.replication.mu.Lock()
+	defer s.replication.mu.Unlock()
+	if s.replication.master == nil && s.goodReplicasLocked() < s.MinReplicasToWrite {
+		return noReplicasReply
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// startSlowAckReplica 启动一个不再定期发送 ACK、只在收到 GETACK 时确认的服务器
+func startSlowAckReplica(t *testing.T) *Server {
+	s := NewServer(":0")
+	s.SnapshotPath, s.RDBPath = "", ""
+	s.ReplAckPeriod = time.Hour
+	return startConfigured(t, s)
+}
+
+func TestWait(t *testing.T) {
+	master := startReplServer(t)
+	defer master.ln.Close()
+	replica := startSlowAckReplica(t)
+	defer replica.ln.Close()
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+
+	expectLine(t, mc, mr, ":0", "WAIT", "0", "0")
+	expectLine(t, mc, mr, "-ERR timeout is negative", "WAIT", "1", "-1")
+	start := time.Now()
+	expectLine(t, mc, mr, ":0", "WAIT", "1", "50")
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("expected WAIT to block until the timeout")
+	}
+
+	replicate(t, replica, master)
+	expectLine(t, mc, mr, "+OK", "SET", "k", "v")
+	// 副本不会主动确认，WAIT 通过 GETACK 获得确认
+	expectLine(t, mc, mr, ":1", "WAIT", "1", "0")
+	if v, _ := replica.store.Get("k"); string(v) != "v" {
+		t.Fatalf("expected the write to reach the replica, got %q", v)
+	}
+	start = time.Now()
+	expectLine(t, mc, mr, ":1", "WAIT", "2", "100")
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatal("expected WAIT to block until the timeout")
+	}
+
+	// 事务中的 WAIT 不阻塞
+	expectLine(t, mc, mr, "+OK", "MULTI")
+	expectLine(t, mc, mr, "+QUEUED", "WAIT", "2", "0")
+	expectLine(t, mc, mr, "*1", "EXEC")
+	expectLine(t, mc, mr, ":1")
+
+	rc, rr := dialServer(t, replica)
+	defer rc.Close()
+	expectLine(t, rc, rr, "-ERR WAIT cannot be used with replica instances.", "WAIT", "1", "0")
+}
+
+func TestMinReplicasToWrite(t *testing.T) {
+	master := NewServer(":0")
+	master.SnapshotPath, master.RDBPath = "", ""
+	master.MinReplicasToWrite = 1
+	master.MinReplicasMaxLag = 300 * time.Millisecond
+	startConfigured(t, master)
+	defer master.ln.Close()
+	replica := startSlowAckReplica(t)
+	defer replica.ln.Close()
+	mc, mr := dialServer(t, master)
+	defer mc.Close()
+
+	expectLine(t, mc, mr, "-NOREPLICAS Not enough good replicas to write.", "SET", "k", "v")
+	expectLine(t, mc, mr, "-NOREPLICAS Not enough good replicas to write.", "BLPOP", "l", "1")
+	expectLine(t, mc, mr, "+OK", "MULTI")
+	expectLine(t, mc, mr, "+QUEUED", "SET", "k", "v")
+	expectLine(t, mc, mr, "-NOREPLICAS Not enough good replicas to write.", "EXEC")
+	expectLine(t, mc, mr, "$-1", "GET", "k")
+
+	replicate(t, replica, master)
+	expectLine(t, mc, mr, "+OK", "SET", "k", "v")
+	if infoField(t, mc, mr, "min_slaves_good_slaves") != "1" {
+		t.Fatal("expected one good replica")
+	}
+
+	// 副本超过 MinReplicasMaxLag 没有确认后不再计为健康副本
+	time.Sleep(400 * time.Millisecond)
+	expectLine(t, mc, mr, "-NOREPLICAS Not enough good replicas to write.", "SET", "k", "v2")
+	expectLine(t, mc, mr, "$1", "GET", "k")
+	expectLine(t, mc, mr, "v")
+	expectLine(t, mc, mr, ":1", "WAIT", "1", "0")
+	expectLine(t, mc, mr, "+OK", "SET", "k", "v2")
+}
@@ -0,0 +1,199 @@
+package storage
+
+import "time"
+
+// listWaiter 表示一个阻塞在若干键上的客户端（BLPOP/BRPOP/BLMOVE/BLMPOP）。
+// try 在持有写锁时调用，尝试从 key 取数据并在成功时返回 true；成功后 prop
+// 返回与本次写入等价的非阻塞命令（只读的 XREAD 为 nil）。
+type listWaiter struct {
+	keys   []string
+	try    func(key string) (bool, error)
+	prop   func() []string
+	done   chan struct{}
+	served bool
+}
+
+// blockOn 先按顺序尝试 keys，全部为空时在这些键上排队等待，直到被 push 唤醒、
+// 超时（timeout 为 0 表示无限等待）或 cancel 被关闭。等待同一个键的客户端按
+// FIFO 顺序获得服务。timeout 为负数时只尝试一次、不阻塞。返回 false 表示超时或被取消。
+//
+// 可能阻塞的调用不经过 Shared，因此首次尝试在这里进入 gate，避免与 EXEC 交错；
+// 等待期间释放 gate，之后由写操作在其锁内直接服务。timeout 为负数的调用
+// 视为普通命令，由调用方自行记录，这里不再通过 prop 记录。
+func (s *Storage) blockOn(keys []string, timeout time.Duration, cancel <-chan struct{}, try func(key string) (bool, error), prop func() []string) (bool, error) {
+	if timeout >= 0 {
+		s.gate.RLock()
+	}
+	s.mu.Lock()
+	for _, k := range keys {
+		ok, err := try(k)
+		if err != nil || ok {
+			if ok && timeout >= 0 && prop != nil {
+				s.propagateLocked(prop())
+			}
+			s.serveReadyLocked()
+			s.mu.Unlock()
+			if timeout >= 0 {
+				s.gate.RUnlock()
+			}
+			return ok, err
+		}
+	}
+	if timeout < 0 {
+		s.mu.Unlock()
+		return false, nil
+	}
+	w := &listWaiter{keys: keys, try: try, prop: prop, done: make(chan struct{})}
+	if s.waiters == nil {
+		s.waiters = make(map[string][]*listWaiter)
+	}
+	for _, k := range keys {
+		s.waiters[k] = append(s.waiters[k], w)
+	}
+	s.mu.Unlock()
+	s.gate.RUnlock()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-w.done:
+		return true, nil
+	case <-timer:
+	case <-cancel:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.served {
+		// 超时/取消与唤醒同时发生：以已完成的服务为准
+		return true, nil
+	}
+	s.removeWaiterLocked(w)
+	return false, nil
+}
+
+// BlockedClients returns the number of clients currently waiting in a
+// blocking command.
+func (s *Storage) BlockedClients() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[*listWaiter]struct{})
+	for _, q := range s.waiters {
+		for _, w := range q {
+			seen[w] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// removeWaiterLocked 将 waiter 从其所有键的队列中移除；调用方需持有写锁
+func (s *Storage) removeWaiterLocked(w *listWaiter) {
+	for _, k := range w.keys {
+		q := s.waiters[k]
+		for i, x := range q {
+			if x == w {
+				q = append(q[:i], q[i+1:]...)
+				break
+			}
+		}
+		if len(q) == 0 {
+			delete(s.waiters, k)
+		} else {
+			s.waiters[k] = q
+		}
+	}
+}
+
+// signalReadyLocked 在有客户端阻塞于 key 时将其标记为就绪；调用方需持有写锁
+func (s *Storage) signalReadyLocked(key string) {
+	if len(s.waiters[key]) > 0 {
+		s.ready = append(s.ready, key)
+	}
+}
+
+// serveReadyLocked 依次为就绪键上排队的客户端服务（FIFO）。服务过程中
+// 可能产生新的就绪键（如 BLMOVE 推入目标列表），循环直至没有就绪键。
+// 写操作在命令结束时调用；Exclusive 执行期间只保留就绪键，由 Exclusive 在
+// fn 返回后调用，使事务中的写入对阻塞的客户端整体可见。调用方需持有写锁。
+func (s *Storage) serveReadyLocked() {
+	if s.exclusive {
+		return
+	}
+	for len(s.ready) > 0 {
+		key := s.ready[0]
+		s.ready = s.ready[1:]
+		// 按排队顺序逐个尝试；某个客户端无法被服务（如 XREADGROUP 的新条目已被
+		// 同组其他消费者取走）时继续尝试后面的客户端
+		for _, w := range append([]*listWaiter(nil), s.waiters[key]...) {
+			if w.served {
+				continue
+			}
+			ok, err := w.try(key)
+			if err != nil || !ok {
+				continue
+			}
+			if w.prop != nil {
+				s.propagateLocked(w.prop())
+			}
+			w.served = true
+			s.removeWaiterLocked(w)
+			close(w.done)
+		}
+	}
+	s.ready = nil
+}
+
+// BlockingPop pops one element from the first non-empty list among keys
+// (head if left). It blocks until an element is available, timeout elapses
+// (0 blocks forever) or cancel is closed; ok is false in the latter cases.
+func (s *Storage) BlockingPop(keys []string, left bool, timeout time.Duration, cancel <-chan struct{}) (key, value string, ok bool, err error) {
+	ok, err = s.blockOn(keys, timeout, cancel, func(k string) (bool, error) {
+		e, err := s.listForWrite(k)
+		if err != nil || e == nil {
+			return false, err
+		}
+		key, value = k, s.listPopLocked(k, e, left)
+		return true, nil
+	}, func() []string { return popCommand(key, left, 0) })
+	return key, value, ok, err
+}
+
+// BlockingMPop pops up to count elements from the first non-empty list
+// among keys, blocking like BlockingPop.
+func (s *Storage) BlockingMPop(keys []string, left bool, count int, timeout time.Duration, cancel <-chan struct{}) (key string, values []string, ok bool, err error) {
+	ok, err = s.blockOn(keys, timeout, cancel, func(k string) (bool, error) {
+		e, err := s.listForWrite(k)
+		if err != nil || e == nil {
+			return false, err
+		}
+		n := count
+		if n > e.List.Len() {
+			n = e.List.Len()
+		}
+		key, values = k, make([]string, n)
+		for i := range values {
+			values[i] = s.listPopLocked(k, e, left)
+		}
+		return true, nil
+	}, func() []string { return popCommand(key, left, len(values)) })
+	return key, values, ok, err
+}
+
+// BlockingMove is the blocking variant of LMove.
+func (s *Storage) BlockingMove(src, dst string, srcLeft, dstLeft bool, timeout time.Duration, cancel <-chan struct{}) (value string, ok bool, err error) {
+	ok, err = s.blockOn([]string{src}, timeout, cancel, func(k string) (bool, error) {
+		v, moved, err := s.lmoveLocked(src, dst, srcLeft, dstLeft)
+		value = v
+		return moved, err
+	}, func() []string { return []string{"LMOVE", src, dst, side(srcLeft), side(dstLeft)} })
+	return value, ok, err
+}
+
+// LMPop pops up to count elements from the first non-empty list among keys
+// without blocking; ok is false when all lists were empty.
+func (s *Storage) LMPop(keys []string, left bool, count int) (key string, values []string, ok bool, err error) {
+	return s.BlockingMPop(keys, left, count, -1, nil)
+}
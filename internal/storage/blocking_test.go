@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitBlocked 等待指定数量的客户端进入阻塞状态
+func waitBlocked(t *testing.T, s *Storage, n int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if s.BlockedClients() == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d blocked clients, got %d", n, s.BlockedClients())
+}
+
+func TestBlockingPopFIFO(t *testing.T) {
+	s := NewStorage()
+	results := make(chan string, 2)
+	for _, name := range []string{"first", "second"} {
+		name := name
+		go func() {
+			_, v, ok, _ := s.BlockingPop([]string{"q"}, true, 0, nil)
+			if ok {
+				results <- name + ":" + v
+			}
+		}()
+		// 保证入队顺序
+		waitBlocked(t, s, map[string]int{"first": 1, "second": 2}[name])
+	}
+	s.RPush("q", []string{"a"})
+	if r := <-results; r != "first:a" {
+		t.Fatalf("expected first waiter served first, got %s", r)
+	}
+	s.RPush("q", []string{"b"})
+	if r := <-results; r != "second:b" {
+		t.Fatalf("expected second waiter served, got %s", r)
+	}
+	if s.Exists("q") {
+		t.Fatalf("expected list to be consumed")
+	}
+}
+
+func TestBlockingPopTimeoutAndCancel(t *testing.T) {
+	s := NewStorage()
+	start := time.Now()
+	if _, _, ok, _ := s.BlockingPop([]string{"q"}, true, 50*time.Millisecond, nil); ok {
+		t.Fatalf("expected timeout")
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("returned before timeout")
+	}
+	cancel := make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		_, _, ok, _ := s.BlockingPop([]string{"q"}, true, 0, cancel)
+		done <- ok
+	}()
+	waitBlocked(t, s, 1)
+	close(cancel)
+	if <-done {
+		t.Fatalf("expected cancelled pop to fail")
+	}
+	if n := s.BlockedClients(); n != 0 {
+		t.Fatalf("expected waiter cleaned up, got %d", n)
+	}
+	s.RPush("q", []string{"v"})
+	if n, _ := s.LLen("q"); n != 1 {
+		t.Fatalf("expected element to stay in list, got len %d", n)
+	}
+}
+
+func TestBlockingMoveChain(t *testing.T) {
+	s := NewStorage()
+	got := make(chan string, 1)
+	go func() {
+		_, v, ok, _ := s.BlockingPop([]string{"dst"}, true, time.Second, nil)
+		if ok {
+			got <- v
+		}
+	}()
+	go func() {
+		s.BlockingMove("src", "dst", true, false, time.Second, nil)
+	}()
+	waitBlocked(t, s, 2)
+	s.RPush("src", []string{"job"})
+	select {
+	case v := <-got:
+		if v != "job" {
+			t.Fatalf("expected job, got %q", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("BLPOP on destination was not woken by BLMOVE")
+	}
+}
+
+func TestBlockingPropagation(t *testing.T) {
+	s := NewStorage()
+	s.EnablePropagation()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.BlockingPop([]string{"q"}, true, 0, nil)
+	}()
+	waitBlocked(t, s, 1)
+	s.RPush("q", []string{"a", "b"})
+	<-done
+	// 非阻塞调用由调用方记录，不在这里重复记录
+	s.LMPop([]string{"q"}, false, 1)
+	s.RPush("src", []string{"x"})
+	s.BlockingMove("src", "dst", false, true, time.Second, nil)
+
+	got := s.TakePropagated()
+	want := [][]string{{"LPOP", "q"}, {"LMOVE", "src", "dst", "RIGHT", "LEFT"}}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if strings.Join(got[i], " ") != strings.Join(want[i], " ") {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if len(s.TakePropagated()) != 0 {
+		t.Fatal("TakePropagated should clear the recorded commands")
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"io"
+	"time"
+)
+
+// DUMP 负载格式（值的编码与快照文件相同，见 writeValue）：
+//
+//	类型(1B，即 ValueType) | 值 | 版本(2B 小端) | CRC64-ECMA 校验和（8B 小端，覆盖此前的全部字节）
+//
+// 负载不含键名与过期时间，由 RESTORE 的参数给出。
+const dumpVersion = 1
+
+var (
+	// ErrBadPayload 表示 RESTORE 的负载版本不支持或校验失败
+	ErrBadPayload = errors.New("ERR DUMP payload version or checksum are wrong")
+	// ErrBusyKey 表示 RESTORE 的目标键已存在且未指定 REPLACE
+	ErrBusyKey = errors.New("BUSYKEY Target key name already exists.")
+)
+
+// Dump serializes the value stored at key into a self-contained payload that
+// Restore accepts. It returns false if the key does not exist.
+func (s *Storage) Dump(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e := s.lookupRead(key)
+	if e == nil {
+		return "", false
+	}
+	var b bytes.Buffer
+	sw := &snapshotWriter{w: bufio.NewWriter(&b), crc: crc64.New(crcTable)}
+	sw.byte(byte(e.Type))
+	sw.writeValue(e)
+	var version [2]byte
+	binary.LittleEndian.PutUint16(version[:], dumpVersion)
+	sw.write(version[:])
+	sw.w.Flush()
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], sw.crc.Sum64())
+	b.Write(sum[:])
+	return b.String(), true
+}
+
+// Restore creates key from a payload produced by Dump. expireAt is the
+// absolute expiration in Unix milliseconds, 0 for none; a time in the past
+// only deletes the existing key. Without replace an existing key fails with
+// ErrBusyKey.
+func (s *Storage) Restore(key, payload string, expireAt int64, replace bool) error {
+	e, err := decodeDump(payload)
+	if err != nil {
+		return err
+	}
+	e.ExpireAt = expireAt
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.lookupWrite(key)
+	if old != nil && !replace {
+		return ErrBusyKey
+	}
+	if e.expired(time.Now().UnixMilli()) {
+		if old != nil {
+			s.removeEntry(key, old)
+		}
+		return nil
+	}
+	var oldSize int64
+	if old != nil {
+		oldSize = old.memSize()
+	}
+	if err := s.reserve(e.memSize() - oldSize); err != nil {
+		return err
+	}
+	s.totalBytes += e.memSize() - oldSize
+	s.setEntry(key, e)
+	s.touchLocked(key)
+	return nil
+}
+
+// decodeDump 校验并解码 DUMP 负载
+func decodeDump(payload string) (*Entry, error) {
+	if len(payload) < 11 {
+		return nil, ErrBadPayload
+	}
+	body, trailer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if binary.LittleEndian.Uint16([]byte(body[len(body)-2:])) > dumpVersion ||
+		crc64.Checksum([]byte(body), crcTable) != binary.LittleEndian.Uint64([]byte(trailer)) {
+		return nil, ErrBadPayload
+	}
+	value := body[:len(body)-2]
+	br := bufio.NewReader(bytes.NewReader([]byte(value)))
+	sr := &snapshotReader{r: br, crc: crc64.New(crcTable)}
+	e := sr.readValue(ValueType(sr.byte()))
+	if sr.err != nil {
+		return nil, ErrBadPayload
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		// 值之后有多余字节
+		return nil, ErrBadPayload
+	}
+	return e, nil
+}
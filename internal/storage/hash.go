@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+var (
+	// ErrHashNotInteger 表示 HINCRBY 作用的字段值不是整数
+	ErrHashNotInteger = errors.New("hash value is not an integer")
+	// ErrHashNotFloat 表示 HINCRBYFLOAT 作用的字段值不是浮点数
+	ErrHashNotFloat = errors.New("hash value is not a float")
+	// ErrIncrOverflow 表示自增结果溢出
+	ErrIncrOverflow = errors.New("increment or decrement would overflow")
+	// ErrIncrNaN 表示浮点自增结果为 NaN 或 Infinity
+	ErrIncrNaN = errors.New("increment would produce NaN or Infinity")
+	// ErrRandCountRange 表示负数 count 的随机取样超过 MaxRandCount
+	ErrRandCountRange = errors.New("value is out of range")
+)
+
+// MaxRandCount 为 HRANDFIELD/SRANDMEMBER 负数 count（允许重复）一次最多返回的
+// 元素个数：结果在读锁内生成，不限制时很大的 count 会占用无界的内存并阻塞写入
+const MaxRandCount = 1 << 20
+
+// reservoir 用蓄水池抽样从逐个加入的元素中不重复地随机选出至多 k 个，只占用
+// O(k) 的内存；正数 count 的随机取样不必复制并打乱整个集合
+type reservoir struct {
+	k     int
+	seen  int
+	items []string
+}
+
+func newReservoir(k int) *reservoir {
+	return &reservoir{k: k, items: make([]string, 0, k)}
+}
+
+func (r *reservoir) add(v string) {
+	r.seen++
+	if len(r.items) < r.k {
+		r.items = append(r.items, v)
+	} else if j := rand.Intn(r.seen); j < r.k {
+		r.items[j] = v
+	}
+}
+
+// sample 返回选出的元素；先加入的元素总在前面的位置，因此打乱后返回
+func (r *reservoir) sample() []string {
+	rand.Shuffle(len(r.items), func(i, j int) { r.items[i], r.items[j] = r.items[j], r.items[i] })
+	return r.items
+}
+
+// hashForRead 返回 key 对应的 hash entry（不存在时为 nil）；调用方需持有读锁
+func (s *Storage) hashForRead(key string) (*Entry, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeHash {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// hashForWrite 返回 key 对应的 hash entry，create 为 true 时不存在则创建；
+// 调用方需持有写锁
+func (s *Storage) hashForWrite(key string, create bool) (*Entry, error) {
+	e := s.lookupWrite(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &Entry{Type: TypeHash, Hash: make(map[string]string)}
+		s.setEntry(key, e)
+		s.touchLocked(key)
+		return e, nil
+	}
+	if e.Type != TypeHash {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// hashSetField 写入单个字段并维护 entry.size 与 totalBytes；返回是否为新字段
+func (s *Storage) hashSetField(e *Entry, field, value string) bool {
+	old, exists := e.Hash[field]
+	var delta int64
+	if exists {
+		delta = int64(len(value) - len(old))
+	} else {
+		delta = int64(len(field) + len(value))
+	}
+	e.Hash[field] = value
+	e.size += delta
+	s.totalBytes += delta
+	return !exists
+}
+
+// hashDropIfEmpty 在 hash 为空时删除该键（与 Redis 语义一致）
+func (s *Storage) hashDropIfEmpty(key string, e *Entry) {
+	if len(e.Hash) == 0 {
+		s.removeEntry(key, e)
+	}
+}
+
+// hashGrowth 计算写入 pairs 后新增的字节数，用于 maxMemory 预检
+func hashGrowth(e *Entry, pairs []string) int64 {
+	var delta int64
+	for i := 0; i+1 < len(pairs); i += 2 {
+		f, v := pairs[i], pairs[i+1]
+		if e != nil {
+			if old, ok := e.Hash[f]; ok {
+				delta += int64(len(v) - len(old))
+				continue
+			}
+		}
+		delta += int64(len(f) + len(v))
+	}
+	return delta
+}
+
+// HSet sets field/value pairs (pairs must have even length) and returns the
+// number of newly added fields.
+func (s *Storage) HSet(key string, pairs []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.hashForWrite(key, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.reserve(hashGrowth(e, pairs)); err != nil {
+		return 0, err
+	}
+	if e == nil {
+		e, _ = s.hashForWrite(key, true)
+	}
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if s.hashSetField(e, pairs[i], pairs[i+1]) {
+			added++
+		}
+	}
+	return added, nil
+}
+
+// HSetNX sets field only if it does not exist yet. Returns true if it was set.
+func (s *Storage) HSetNX(key, field, value string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.hashForWrite(key, false)
+	if err != nil {
+		return false, err
+	}
+	if e != nil {
+		if _, ok := e.Hash[field]; ok {
+			return false, nil
+		}
+	}
+	if err := s.reserve(int64(len(field) + len(value))); err != nil {
+		return false, err
+	}
+	if e == nil {
+		e, _ = s.hashForWrite(key, true)
+	}
+	s.hashSetField(e, field, value)
+	return true, nil
+}
+
+// HGet returns the value of field in the hash stored at key.
+func (s *Storage) HGet(key, field string) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil {
+		return "", false, err
+	}
+	v, ok := e.Hash[field]
+	return v, ok, nil
+}
+
+// HMGet returns the values of fields; found[i] reports whether fields[i] exists.
+func (s *Storage) HMGet(key string, fields []string) (values []string, found []bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	values = make([]string, len(fields))
+	found = make([]bool, len(fields))
+	if e == nil {
+		return values, found, nil
+	}
+	for i, f := range fields {
+		values[i], found[i] = e.Hash[f]
+	}
+	return values, found, nil
+}
+
+// HDel removes fields and returns the number of fields that were removed.
+// The key itself is deleted once the hash becomes empty.
+func (s *Storage) HDel(key string, fields []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.hashForWrite(key, false)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, f := range fields {
+		if v, ok := e.Hash[f]; ok {
+			delta := int64(len(f) + len(v))
+			e.size -= delta
+			s.totalBytes -= delta
+			delete(e.Hash, f)
+			removed++
+		}
+	}
+	s.hashDropIfEmpty(key, e)
+	return removed, nil
+}
+
+// HExists reports whether field exists in the hash stored at key.
+func (s *Storage) HExists(key, field string) (bool, error) {
+	_, ok, err := s.HGet(key, field)
+	return ok, err
+}
+
+// HLen returns the number of fields in the hash stored at key.
+func (s *Storage) HLen(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return len(e.Hash), nil
+}
+
+// HStrLen returns the length of the value associated with field.
+func (s *Storage) HStrLen(key, field string) (int, error) {
+	v, _, err := s.HGet(key, field)
+	return len(v), err
+}
+
+// HGetAll returns all fields and values as a flat [field, value, ...] slice.
+func (s *Storage) HGetAll(key string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(e.Hash)*2)
+	for f, v := range e.Hash {
+		out = append(out, f, v)
+	}
+	return out, nil
+}
+
+// HKeys returns all field names of the hash stored at key.
+func (s *Storage) HKeys(key string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(e.Hash))
+	for f := range e.Hash {
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// HVals returns all values of the hash stored at key.
+func (s *Storage) HVals(key string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(e.Hash))
+	for _, v := range e.Hash {
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// HIncrBy increments the integer stored at field by delta.
+func (s *Storage) HIncrBy(key, field string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.hashForWrite(key, false)
+	if err != nil {
+		return 0, err
+	}
+	var cur int64
+	if e != nil {
+		if v, ok := e.Hash[field]; ok {
+			cur, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, ErrHashNotInteger
+			}
+		}
+	}
+	if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+		return 0, ErrIncrOverflow
+	}
+	cur += delta
+	val := strconv.FormatInt(cur, 10)
+	if err := s.reserve(hashGrowth(e, []string{field, val})); err != nil {
+		return 0, err
+	}
+	if e == nil {
+		e, _ = s.hashForWrite(key, true)
+	}
+	s.hashSetField(e, field, val)
+	return cur, nil
+}
+
+// HIncrByFloat increments the float stored at field by delta and returns the
+// new value formatted the way it is stored.
+func (s *Storage) HIncrByFloat(key, field string, delta float64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.hashForWrite(key, false)
+	if err != nil {
+		return "", err
+	}
+	var cur float64
+	if e != nil {
+		if v, ok := e.Hash[field]; ok {
+			cur, err = strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(cur) {
+				return "", ErrHashNotFloat
+			}
+		}
+	}
+	cur += delta
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return "", ErrIncrNaN
+	}
+	val := strconv.FormatFloat(cur, 'f', -1, 64)
+	if err := s.reserve(hashGrowth(e, []string{field, val})); err != nil {
+		return "", err
+	}
+	if e == nil {
+		e, _ = s.hashForWrite(key, true)
+	}
+	s.hashSetField(e, field, val)
+	return val, nil
+}
+
+// HRandField returns random fields (and their values) from the hash stored at
+// key. A positive count returns up to count distinct fields, a negative count
+// may return the same field multiple times and always returns -count fields;
+// it fails with ErrRandCountRange when -count exceeds MaxRandCount.
+func (s *Storage) HRandField(key string, count int) (fields, values []string, err error) {
+	if count < -MaxRandCount {
+		return nil, nil, ErrRandCountRange
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.hashForRead(key)
+	if err != nil || e == nil || count == 0 {
+		return nil, nil, err
+	}
+	if count < 0 {
+		all := make([]string, 0, len(e.Hash))
+		for f := range e.Hash {
+			all = append(all, f)
+		}
+		n := -count
+		fields, values = make([]string, n), make([]string, n)
+		for i := range fields {
+			f := all[rand.Intn(len(all))]
+			fields[i], values[i] = f, e.Hash[f]
+		}
+		return fields, values, nil
+	}
+	r := newReservoir(min(count, len(e.Hash)))
+	for f := range e.Hash {
+		r.add(f)
+	}
+	fields = r.sample()
+	values = make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = e.Hash[f]
+	}
+	return fields, values, nil
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHashSetGetDel(t *testing.T) {
+	s := NewStorage()
+	n, err := s.HSet("h", []string{"f1", "v1", "f2", "v2"})
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 new fields, got %d, %v", n, err)
+	}
+	if n, _ := s.HSet("h", []string{"f1", "v1b"}); n != 0 {
+		t.Fatalf("expected overwrite to add 0 fields, got %d", n)
+	}
+	if v, ok, _ := s.HGet("h", "f1"); !ok || v != "v1b" {
+		t.Fatalf("expected f1=v1b, got %q,%v", v, ok)
+	}
+	if n, _ := s.HLen("h"); n != 2 {
+		t.Fatalf("expected hlen 2, got %d", n)
+	}
+	if n, _ := s.HDel("h", []string{"f1", "f2", "nope"}); n != 2 {
+		t.Fatalf("expected 2 removed, got %d", n)
+	}
+	if s.Exists("h") {
+		t.Fatalf("expected empty hash to be deleted")
+	}
+}
+
+func TestHashMemoryAccounting(t *testing.T) {
+	s := NewStorage()
+	s.HSet("h", []string{"ab", "cde"})
+	if m := s.MemoryUsage(); m != 5 {
+		t.Fatalf("expected 5 bytes, got %d", m)
+	}
+	s.HSet("h", []string{"ab", "c"})
+	if m := s.MemoryUsage(); m != 3 {
+		t.Fatalf("expected 3 bytes after overwrite, got %d", m)
+	}
+	s.Delete("h")
+	if m := s.MemoryUsage(); m != 0 {
+		t.Fatalf("expected 0 bytes after delete, got %d", m)
+	}
+	s.SetMaxMemory(4)
+	if _, err := s.HSet("h", []string{"abc", "def"}); !errors.Is(err, ErrMaxMemory) {
+		t.Fatalf("expected ErrMaxMemory, got %v", err)
+	}
+}
+
+func TestHashWrongType(t *testing.T) {
+	s := NewStorage()
+	s.Set("str", []byte("v"), 0)
+	if _, err := s.HSet("str", []string{"f", "v"}); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected ErrWrongType, got %v", err)
+	}
+	s.HSet("h", []string{"f", "1"})
+	if _, _, err := s.GetString("h"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected ErrWrongType for GetString, got %v", err)
+	}
+	if _, err := s.IncrBy("h", 1); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected ErrWrongType for IncrBy, got %v", err)
+	}
+	// SET 覆盖 hash 时内存计数应正确
+	s.Set("h", []byte("xy"), 0)
+	if m := s.MemoryUsage(); m != 3 {
+		t.Fatalf("expected 3 bytes, got %d", m)
+	}
+}
+
+func TestHashIncr(t *testing.T) {
+	s := NewStorage()
+	if n, err := s.HIncrBy("h", "c", 5); err != nil || n != 5 {
+		t.Fatalf("expected 5, got %d,%v", n, err)
+	}
+	if n, _ := s.HIncrBy("h", "c", -7); n != -2 {
+		t.Fatalf("expected -2, got %d", n)
+	}
+	if v, err := s.HIncrByFloat("h", "f", 10.5); err != nil || v != "10.5" {
+		t.Fatalf("expected 10.5, got %q,%v", v, err)
+	}
+	s.HSet("h", []string{"s", "abc"})
+	if _, err := s.HIncrBy("h", "s", 1); !errors.Is(err, ErrHashNotInteger) {
+		t.Fatalf("expected ErrHashNotInteger, got %v", err)
+	}
+}
+
+func TestHRandField(t *testing.T) {
+	s := NewStorage()
+	s.HSet("h", []string{"a", "1", "b", "2", "c", "3"})
+	if f, _, _ := s.HRandField("h", 10); len(f) != 3 {
+		t.Fatalf("expected 3 distinct fields, got %v", f)
+	}
+	// count 小于字段数时返回不重复的字段，多次取样覆盖所有字段
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		f, v, _ := s.HRandField("h", 2)
+		if len(f) != 2 || f[0] == f[1] || v[0] != map[string]string{"a": "1", "b": "2", "c": "3"}[f[0]] {
+			t.Fatalf("expected 2 distinct fields with values, got %v %v", f, v)
+		}
+		seen[f[0]], seen[f[1]] = true, true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected every field to be sampled, got %v", seen)
+	}
+	if f, v, _ := s.HRandField("h", -5); len(f) != 5 || len(v) != 5 {
+		t.Fatalf("expected 5 fields with repeats, got %v", f)
+	}
+	if _, _, err := s.HRandField("h", -1000000000000); !errors.Is(err, ErrRandCountRange) {
+		t.Fatalf("expected ErrRandCountRange, got %v", err)
+	}
+	if f, _, err := s.HRandField("h", -MaxRandCount); err != nil || len(f) != MaxRandCount {
+		t.Fatalf("expected %d fields, got %d (%v)", MaxRandCount, len(f), err)
+	}
+}
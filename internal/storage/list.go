@@ -0,0 +1,512 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrNoSuchKey 表示操作要求键存在但键不存在（如 LSET）
+	ErrNoSuchKey = errors.New("no such key")
+	// ErrIndexOutOfRange 表示列表下标越界
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+const listMinCap = 8
+
+// List 是基于环形缓冲区的双端队列，两端 push/pop 均为 O(1)，按下标访问 O(1)。
+type List struct {
+	buf  []string
+	head int
+	n    int
+}
+
+// NewList returns an empty list.
+func NewList() *List {
+	return &List{}
+}
+
+// Len returns the number of elements.
+func (l *List) Len() int { return l.n }
+
+func (l *List) pos(i int) int {
+	return (l.head + i) % len(l.buf)
+}
+
+func (l *List) grow() {
+	if l.n < len(l.buf) {
+		return
+	}
+	size := len(l.buf) * 2
+	if size < listMinCap {
+		size = listMinCap
+	}
+	nb := make([]string, size)
+	for i := 0; i < l.n; i++ {
+		nb[i] = l.buf[l.pos(i)]
+	}
+	l.buf = nb
+	l.head = 0
+}
+
+// PushFront inserts v at the head.
+func (l *List) PushFront(v string) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.buf)) % len(l.buf)
+	l.buf[l.head] = v
+	l.n++
+}
+
+// PushBack appends v at the tail.
+func (l *List) PushBack(v string) {
+	l.grow()
+	l.buf[l.pos(l.n)] = v
+	l.n++
+}
+
+// PopFront removes and returns the head element. The list must be non-empty.
+func (l *List) PopFront() string {
+	v := l.buf[l.head]
+	l.buf[l.head] = ""
+	l.head = (l.head + 1) % len(l.buf)
+	l.n--
+	return v
+}
+
+// PopBack removes and returns the tail element. The list must be non-empty.
+func (l *List) PopBack() string {
+	p := l.pos(l.n - 1)
+	v := l.buf[p]
+	l.buf[p] = ""
+	l.n--
+	return v
+}
+
+// At returns the element at index i (0 <= i < Len()).
+func (l *List) At(i int) string {
+	return l.buf[l.pos(i)]
+}
+
+func (l *List) set(i int, v string) {
+	l.buf[l.pos(i)] = v
+}
+
+// Slice returns a copy of elements in [start, stop] (inclusive, already normalized).
+func (l *List) Slice(start, stop int) []string {
+	if start > stop {
+		return []string{}
+	}
+	out := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		out = append(out, l.At(i))
+	}
+	return out
+}
+
+// reset 用给定元素重建列表
+func (l *List) reset(vals []string) {
+	l.buf = nil
+	l.head = 0
+	l.n = 0
+	for _, v := range vals {
+		l.PushBack(v)
+	}
+}
+
+// normalizeRange 将 Redis 风格的 start/stop（支持负数）转换为 [start, stop] 闭区间；
+// 区间为空时 ok 为 false
+func normalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+func listBytes(vals []string) int64 {
+	var n int64
+	for _, v := range vals {
+		n += int64(len(v))
+	}
+	return n
+}
+
+// listForRead 返回 key 对应的 list entry（不存在时为 nil）；调用方需持有读锁
+func (s *Storage) listForRead(key string) (*Entry, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeList {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// listForWrite 返回 key 对应的 list entry（不存在时为 nil）；调用方需持有写锁
+func (s *Storage) listForWrite(key string) (*Entry, error) {
+	e := s.lookupWrite(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeList {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// listPushLocked 向列表头/尾追加元素，必要时创建键；调用方需持有写锁
+func (s *Storage) listPushLocked(key string, e *Entry, vals []string, left bool) *Entry {
+	if e == nil {
+		e = &Entry{Type: TypeList, List: NewList()}
+		s.setEntry(key, e)
+		s.touchLocked(key)
+	}
+	for _, v := range vals {
+		if left {
+			e.List.PushFront(v)
+		} else {
+			e.List.PushBack(v)
+		}
+	}
+	delta := listBytes(vals)
+	e.size += delta
+	s.totalBytes += delta
+	s.signalReadyLocked(key)
+	return e
+}
+
+// listPopLocked 从列表头/尾弹出一个元素，列表为空时删除键；调用方需持有写锁
+func (s *Storage) listPopLocked(key string, e *Entry, left bool) string {
+	var v string
+	if left {
+		v = e.List.PopFront()
+	} else {
+		v = e.List.PopBack()
+	}
+	e.size -= int64(len(v))
+	s.totalBytes -= int64(len(v))
+	if e.List.Len() == 0 {
+		s.removeEntry(key, e)
+	}
+	return v
+}
+
+func (s *Storage) listPush(key string, vals []string, left, onlyIfExists bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+	if e == nil && onlyIfExists {
+		return 0, nil
+	}
+	if err := s.reserve(listBytes(vals)); err != nil {
+		return 0, err
+	}
+	e = s.listPushLocked(key, e, vals, left)
+	n := e.List.Len()
+	// 返回值为 push 后的长度，之后再唤醒阻塞在该键上的客户端
+	s.serveReadyLocked()
+	return n, nil
+}
+
+// LPush inserts values at the head of the list and returns the new length.
+func (s *Storage) LPush(key string, vals []string) (int, error) {
+	return s.listPush(key, vals, true, false)
+}
+
+// RPush appends values to the tail of the list and returns the new length.
+func (s *Storage) RPush(key string, vals []string) (int, error) {
+	return s.listPush(key, vals, false, false)
+}
+
+// LPushX is like LPush but only operates on an existing list.
+func (s *Storage) LPushX(key string, vals []string) (int, error) {
+	return s.listPush(key, vals, true, true)
+}
+
+// RPushX is like RPush but only operates on an existing list.
+func (s *Storage) RPushX(key string, vals []string) (int, error) {
+	return s.listPush(key, vals, false, true)
+}
+
+func (s *Storage) listPop(key string, count int, left bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	if count > e.List.Len() {
+		count = e.List.Len()
+	}
+	out := make([]string, count)
+	for i := range out {
+		out[i] = s.listPopLocked(key, e, left)
+	}
+	return out, nil
+}
+
+// LPop removes and returns up to count elements from the head. A nil result
+// means the key does not exist.
+func (s *Storage) LPop(key string, count int) ([]string, error) {
+	return s.listPop(key, count, true)
+}
+
+// RPop removes and returns up to count elements from the tail.
+func (s *Storage) RPop(key string, count int) ([]string, error) {
+	return s.listPop(key, count, false)
+}
+
+// LLen returns the length of the list stored at key.
+func (s *Storage) LLen(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.listForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.List.Len(), nil
+}
+
+// LRange returns elements between start and stop (inclusive, negative
+// indexes count from the tail).
+func (s *Storage) LRange(key string, start, stop int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.listForRead(key)
+	if err != nil || e == nil {
+		return []string{}, err
+	}
+	start, stop, ok := normalizeRange(start, stop, e.List.Len())
+	if !ok {
+		return []string{}, nil
+	}
+	return e.List.Slice(start, stop), nil
+}
+
+// LIndex returns the element at index (negative indexes count from the tail).
+func (s *Storage) LIndex(key string, index int) (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.listForRead(key)
+	if err != nil || e == nil {
+		return "", false, err
+	}
+	if index < 0 {
+		index += e.List.Len()
+	}
+	if index < 0 || index >= e.List.Len() {
+		return "", false, nil
+	}
+	return e.List.At(index), true, nil
+}
+
+// LSet replaces the element at index.
+func (s *Storage) LSet(key string, index int, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return ErrNoSuchKey
+	}
+	if index < 0 {
+		index += e.List.Len()
+	}
+	if index < 0 || index >= e.List.Len() {
+		return ErrIndexOutOfRange
+	}
+	old := e.List.At(index)
+	delta := int64(len(value) - len(old))
+	if err := s.reserve(delta); err != nil {
+		return err
+	}
+	e.List.set(index, value)
+	e.size += delta
+	s.totalBytes += delta
+	return nil
+}
+
+// LInsert inserts value before or after the first occurrence of pivot.
+// Returns the new length, -1 if pivot was not found, or 0 if key is missing.
+func (s *Storage) LInsert(key string, before bool, pivot, value string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	vals := e.List.Slice(0, e.List.Len()-1)
+	idx := -1
+	for i, v := range vals {
+		if v == pivot {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return -1, nil
+	}
+	if err := s.reserve(int64(len(value))); err != nil {
+		return 0, err
+	}
+	if !before {
+		idx++
+	}
+	vals = append(vals[:idx], append([]string{value}, vals[idx:]...)...)
+	e.List.reset(vals)
+	e.size += int64(len(value))
+	s.totalBytes += int64(len(value))
+	return e.List.Len(), nil
+}
+
+// LRem removes occurrences of value: count > 0 from head, count < 0 from
+// tail, count == 0 all of them. Returns the number of removed elements.
+func (s *Storage) LRem(key string, count int, value string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	vals := e.List.Slice(0, e.List.Len()-1)
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := 0
+	keep := make([]bool, len(vals))
+	for i := range keep {
+		keep[i] = true
+	}
+	for j := 0; j < len(vals); j++ {
+		i := j
+		if count < 0 {
+			i = len(vals) - 1 - j
+		}
+		if vals[i] == value && (limit == 0 || removed < limit) {
+			keep[i] = false
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	out := make([]string, 0, len(vals)-removed)
+	for i, v := range vals {
+		if keep[i] {
+			out = append(out, v)
+		}
+	}
+	e.List.reset(out)
+	delta := int64(removed * len(value))
+	e.size -= delta
+	s.totalBytes -= delta
+	if e.List.Len() == 0 {
+		s.removeEntry(key, e)
+	}
+	return removed, nil
+}
+
+// LTrim trims the list so that it only contains the range [start, stop].
+func (s *Storage) LTrim(key string, start, stop int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.listForWrite(key)
+	if err != nil || e == nil {
+		return err
+	}
+	start, stop, ok := normalizeRange(start, stop, e.List.Len())
+	if !ok {
+		s.removeEntry(key, e)
+		return nil
+	}
+	vals := e.List.Slice(start, stop)
+	e.List.reset(vals)
+	newSize := listBytes(vals)
+	s.totalBytes += newSize - e.size
+	e.size = newSize
+	return nil
+}
+
+// LPos returns the indexes of elements equal to value. rank selects the
+// n-th match (negative searches from the tail), count limits the number of
+// matches (0 means all) and maxLen limits the number of compared elements
+// (0 means unlimited).
+func (s *Storage) LPos(key, value string, rank, count, maxLen int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.listForRead(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	n := e.List.Len()
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	var out []int
+	for j := 0; j < n; j++ {
+		if maxLen > 0 && j >= maxLen {
+			break
+		}
+		i := j
+		if rank < 0 {
+			i = n - 1 - j
+		}
+		if e.List.At(i) != value {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		out = append(out, i)
+		if count > 0 && len(out) >= count {
+			break
+		}
+	}
+	return out, nil
+}
+
+// LMove atomically pops an element from src (head if srcLeft) and pushes it
+// to dst (head if dstLeft). ok is false when src does not exist.
+func (s *Storage) LMove(src, dst string, srcLeft, dstLeft bool) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok, err := s.lmoveLocked(src, dst, srcLeft, dstLeft)
+	s.serveReadyLocked()
+	return v, ok, err
+}
+
+// lmoveLocked 实现 LMOVE；调用方需持有写锁
+func (s *Storage) lmoveLocked(src, dst string, srcLeft, dstLeft bool) (string, bool, error) {
+	se, err := s.listForWrite(src)
+	if err != nil || se == nil {
+		return "", false, err
+	}
+	de, err := s.listForWrite(dst)
+	if err != nil {
+		return "", false, err
+	}
+	v := s.listPopLocked(src, se, srcLeft)
+	if src == dst {
+		// 源列表可能因弹出最后一个元素而被删除
+		de = s.lookupWrite(dst)
+	}
+	s.listPushLocked(dst, de, []string{v}, dstLeft)
+	return v, true, nil
+}
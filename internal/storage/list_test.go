@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestListDequeGrow(t *testing.T) {
+	l := NewList()
+	for i := 0; i < 20; i++ {
+		l.PushBack(string(rune('a' + i)))
+		l.PushFront(string(rune('A' + i)))
+	}
+	if l.Len() != 40 {
+		t.Fatalf("expected 40 elements, got %d", l.Len())
+	}
+	if l.At(0) != "T" || l.At(39) != "t" {
+		t.Fatalf("unexpected ends %q %q", l.At(0), l.At(39))
+	}
+	if v := l.PopFront(); v != "T" {
+		t.Fatalf("expected T, got %q", v)
+	}
+	if v := l.PopBack(); v != "t" {
+		t.Fatalf("expected t, got %q", v)
+	}
+}
+
+func TestListPushPopRange(t *testing.T) {
+	s := NewStorage()
+	s.RPush("l", []string{"b", "c"})
+	if n, _ := s.LPush("l", []string{"a"}); n != 3 {
+		t.Fatalf("expected length 3, got %d", n)
+	}
+	if vals, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(vals, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected range %v", vals)
+	}
+	if vals, _ := s.LRange("l", -2, 100); !reflect.DeepEqual(vals, []string{"b", "c"}) {
+		t.Fatalf("unexpected range %v", vals)
+	}
+	if vals, _ := s.RPop("l", 5); !reflect.DeepEqual(vals, []string{"c", "b", "a"}) {
+		t.Fatalf("unexpected pop %v", vals)
+	}
+	if s.Exists("l") || s.MemoryUsage() != 0 {
+		t.Fatalf("expected empty list removed, mem=%d", s.MemoryUsage())
+	}
+	if n, _ := s.LPushX("l", []string{"x"}); n != 0 {
+		t.Fatalf("expected LPUSHX on missing key to be no-op")
+	}
+}
+
+func TestListEditing(t *testing.T) {
+	s := NewStorage()
+	s.RPush("l", []string{"a", "b", "a", "c", "a"})
+	if n, _ := s.LInsert("l", true, "c", "x"); n != 6 {
+		t.Fatalf("expected 6, got %d", n)
+	}
+	if n, _ := s.LRem("l", -2, "a"); n != 2 {
+		t.Fatalf("expected 2 removed, got %d", n)
+	}
+	if vals, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(vals, []string{"a", "b", "x", "c"}) {
+		t.Fatalf("unexpected list %v", vals)
+	}
+	if err := s.LSet("l", -1, "z"); err != nil {
+		t.Fatalf("lset: %v", err)
+	}
+	if err := s.LSet("l", 10, "z"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("expected ErrIndexOutOfRange, got %v", err)
+	}
+	s.LTrim("l", 1, 2)
+	if vals, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(vals, []string{"b", "x"}) {
+		t.Fatalf("unexpected list after trim %v", vals)
+	}
+	if m := s.MemoryUsage(); m != 2 {
+		t.Fatalf("expected 2 bytes, got %d", m)
+	}
+}
+
+func TestListPosAndMove(t *testing.T) {
+	s := NewStorage()
+	s.RPush("l", []string{"a", "b", "c", "b", "b"})
+	if idx, _ := s.LPos("l", "b", -1, 2, 0); !reflect.DeepEqual(idx, []int{4, 3}) {
+		t.Fatalf("unexpected lpos %v", idx)
+	}
+	if idx, _ := s.LPos("l", "b", 2, 0, 0); !reflect.DeepEqual(idx, []int{3, 4}) {
+		t.Fatalf("unexpected lpos %v", idx)
+	}
+	v, ok, _ := s.LMove("l", "dst", true, false)
+	if !ok || v != "a" {
+		t.Fatalf("expected to move a, got %q", v)
+	}
+	if n, _ := s.LLen("dst"); n != 1 {
+		t.Fatalf("expected dst length 1, got %d", n)
+	}
+	// 单元素列表自身轮转
+	v, ok, _ = s.LMove("dst", "dst", true, false)
+	if !ok || v != "a" || !s.Exists("dst") {
+		t.Fatalf("expected rotation of single element list")
+	}
+}
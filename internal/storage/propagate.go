@@ -0,0 +1,52 @@
+package storage
+
+import "strconv"
+
+// 普通写命令由服务器在执行后自行记录（如写入 AOF）。阻塞命令则不同：被唤醒时的
+// 弹出发生在另一条写命令的调用中，首次尝试也不经过服务器的写路径，因此由 Storage
+// 在执行处记录一条等价的非阻塞命令（如 BLPOP 记为 LPOP），调用方按执行顺序取出。
+
+// EnablePropagation starts recording the writes performed by blocking
+// commands; they are returned by TakePropagated.
+func (s *Storage) EnablePropagation() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.propagating = true
+}
+
+// TakePropagated returns and clears the recorded writes of blocking
+// commands, in execution order.
+func (s *Storage) TakePropagated() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmds := s.propagated
+	s.propagated = nil
+	return cmds
+}
+
+// propagateLocked 记录一条命令；调用方需持有写锁
+func (s *Storage) propagateLocked(cmd []string) {
+	if s.propagating && cmd != nil {
+		s.propagated = append(s.propagated, cmd)
+	}
+}
+
+// side 返回 LEFT/RIGHT 参数
+func side(left bool) string {
+	if left {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// popCommand 返回 LPOP/RPOP 形式的命令；count 为 0 表示不带 count 参数
+func popCommand(key string, left bool, count int) []string {
+	cmd := []string{"RPOP", key}
+	if left {
+		cmd[0] = "LPOP"
+	}
+	if count > 0 {
+		cmd = append(cmd, strconv.Itoa(count))
+	}
+	return cmd
+}
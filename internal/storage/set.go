@@ -0,0 +1,467 @@
+package storage
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// setMaxIntsetEntries 为 intset 编码允许的最大元素数，超过后转换为哈希表编码
+const setMaxIntsetEntries = 512
+
+// Set 是无序集合。元素全部为整数且数量不超过 setMaxIntsetEntries 时使用有序
+// []int64（intset）紧凑编码，否则使用 map。
+type Set struct {
+	ints []int64
+	m    map[string]struct{}
+}
+
+// NewSet returns an empty set using the intset encoding.
+func NewSet() *Set {
+	return &Set{}
+}
+
+// parseSetInt 仅接受规范形式的整数（如 "01"、"+1" 不视为整数），保证往返一致
+func parseSetInt(s string) (int64, bool) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != s {
+		return 0, false
+	}
+	return v, true
+}
+
+// IsIntset reports whether the set currently uses the compact integer encoding.
+func (st *Set) IsIntset() bool { return st.m == nil }
+
+// Len returns the number of members.
+func (st *Set) Len() int {
+	if st.m == nil {
+		return len(st.ints)
+	}
+	return len(st.m)
+}
+
+func (st *Set) intsetSearch(v int64) (int, bool) {
+	i := sort.Search(len(st.ints), func(i int) bool { return st.ints[i] >= v })
+	return i, i < len(st.ints) && st.ints[i] == v
+}
+
+// convert 将 intset 编码转换为哈希表编码
+func (st *Set) convert() {
+	st.m = make(map[string]struct{}, len(st.ints)+1)
+	for _, v := range st.ints {
+		st.m[strconv.FormatInt(v, 10)] = struct{}{}
+	}
+	st.ints = nil
+}
+
+// Add inserts member and reports whether it was newly added.
+func (st *Set) Add(member string) bool {
+	if st.m == nil {
+		if v, ok := parseSetInt(member); ok {
+			i, found := st.intsetSearch(v)
+			if found {
+				return false
+			}
+			if len(st.ints) < setMaxIntsetEntries {
+				st.ints = append(st.ints, 0)
+				copy(st.ints[i+1:], st.ints[i:])
+				st.ints[i] = v
+				return true
+			}
+		}
+		st.convert()
+	}
+	if _, ok := st.m[member]; ok {
+		return false
+	}
+	st.m[member] = struct{}{}
+	return true
+}
+
+// Remove deletes member and reports whether it was present.
+func (st *Set) Remove(member string) bool {
+	if st.m == nil {
+		v, ok := parseSetInt(member)
+		if !ok {
+			return false
+		}
+		i, found := st.intsetSearch(v)
+		if !found {
+			return false
+		}
+		st.ints = append(st.ints[:i], st.ints[i+1:]...)
+		return true
+	}
+	if _, ok := st.m[member]; !ok {
+		return false
+	}
+	delete(st.m, member)
+	return true
+}
+
+// Has reports whether member is in the set.
+func (st *Set) Has(member string) bool {
+	if st.m == nil {
+		v, ok := parseSetInt(member)
+		if !ok {
+			return false
+		}
+		_, found := st.intsetSearch(v)
+		return found
+	}
+	_, ok := st.m[member]
+	return ok
+}
+
+// Members returns all members (intset members are in ascending order).
+func (st *Set) Members() []string {
+	out := make([]string, 0, st.Len())
+	st.each(func(m string) { out = append(out, m) })
+	return out
+}
+
+// each 依次对每个元素调用 fn，顺序与 Members 相同
+func (st *Set) each(fn func(string)) {
+	if st.m == nil {
+		for _, v := range st.ints {
+			fn(strconv.FormatInt(v, 10))
+		}
+		return
+	}
+	for k := range st.m {
+		fn(k)
+	}
+}
+
+func setBytes(members []string) int64 {
+	var n int64
+	for _, m := range members {
+		n += int64(len(m))
+	}
+	return n
+}
+
+// setForRead 返回 key 对应的 set entry（不存在时为 nil）；调用方需持有读锁
+func (s *Storage) setForRead(key string) (*Entry, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeSet {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// setForWrite 返回 key 对应的 set entry（不存在时为 nil）；调用方需持有写锁
+func (s *Storage) setForWrite(key string) (*Entry, error) {
+	e := s.lookupWrite(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeSet {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// setAddLocked 添加成员，必要时创建键；调用方需持有写锁
+func (s *Storage) setAddLocked(key string, e *Entry, members []string) (*Entry, int) {
+	if e == nil {
+		e = &Entry{Type: TypeSet, Set: NewSet()}
+		s.setEntry(key, e)
+		s.touchLocked(key)
+	}
+	added := 0
+	for _, m := range members {
+		if e.Set.Add(m) {
+			added++
+			e.size += int64(len(m))
+			s.totalBytes += int64(len(m))
+		}
+	}
+	return e, added
+}
+
+// setRemoveLocked 删除成员，集合为空时删除键；调用方需持有写锁
+func (s *Storage) setRemoveLocked(key string, e *Entry, members []string) int {
+	removed := 0
+	for _, m := range members {
+		if e.Set.Remove(m) {
+			removed++
+			e.size -= int64(len(m))
+			s.totalBytes -= int64(len(m))
+		}
+	}
+	if e.Set.Len() == 0 {
+		s.removeEntry(key, e)
+	}
+	return removed
+}
+
+// SAdd adds members and returns the number of newly added members.
+func (s *Storage) SAdd(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.setForWrite(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.reserve(setBytes(members)); err != nil {
+		return 0, err
+	}
+	_, added := s.setAddLocked(key, e, members)
+	return added, nil
+}
+
+// SRem removes members and returns the number of removed members.
+func (s *Storage) SRem(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.setForWrite(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return s.setRemoveLocked(key, e, members), nil
+}
+
+// SIsMember reports whether member belongs to the set stored at key.
+func (s *Storage) SIsMember(key, member string) (bool, error) {
+	res, err := s.SMIsMember(key, []string{member})
+	if err != nil {
+		return false, err
+	}
+	return res[0], nil
+}
+
+// SMIsMember reports membership for each of members.
+func (s *Storage) SMIsMember(key string, members []string) ([]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.setForRead(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]bool, len(members))
+	if e == nil {
+		return out, nil
+	}
+	for i, m := range members {
+		out[i] = e.Set.Has(m)
+	}
+	return out, nil
+}
+
+// SMembers returns all members of the set stored at key.
+func (s *Storage) SMembers(key string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.setForRead(key)
+	if err != nil || e == nil {
+		return []string{}, err
+	}
+	return e.Set.Members(), nil
+}
+
+// SCard returns the number of members of the set stored at key.
+func (s *Storage) SCard(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.setForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.Set.Len(), nil
+}
+
+// SPop removes and returns up to count random members. A nil result means
+// the key does not exist.
+func (s *Storage) SPop(key string, count int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.setForWrite(key)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	all := e.Set.Members()
+	rand.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+	if count < len(all) {
+		all = all[:count]
+	}
+	s.setRemoveLocked(key, e, all)
+	return all, nil
+}
+
+// SRandMember returns random members without removing them. A positive count
+// returns distinct members, a negative count may repeat members and fails
+// with ErrRandCountRange when -count exceeds MaxRandCount.
+func (s *Storage) SRandMember(key string, count int) ([]string, error) {
+	if count < -MaxRandCount {
+		return nil, ErrRandCountRange
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.setForRead(key)
+	if err != nil || e == nil || count == 0 {
+		return nil, err
+	}
+	if count < 0 {
+		all := e.Set.Members()
+		out := make([]string, -count)
+		for i := range out {
+			out[i] = all[rand.Intn(len(all))]
+		}
+		return out, nil
+	}
+	r := newReservoir(min(count, e.Set.Len()))
+	e.Set.each(r.add)
+	return r.sample(), nil
+}
+
+// SMove moves member from src to dst. Returns false if member was not in src.
+func (s *Storage) SMove(src, dst, member string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	se, err := s.setForWrite(src)
+	if err != nil {
+		return false, err
+	}
+	de, err := s.setForWrite(dst)
+	if err != nil {
+		return false, err
+	}
+	if se == nil || !se.Set.Has(member) {
+		return false, nil
+	}
+	if src == dst {
+		return true, nil
+	}
+	s.setRemoveLocked(src, se, []string{member})
+	s.setAddLocked(dst, de, []string{member})
+	return true, nil
+}
+
+// SetOp 表示集合运算类型
+type SetOp int
+
+const (
+	SetInter SetOp = iota
+	SetUnion
+	SetDiff
+)
+
+// setOpLocked 计算 keys 的交/并/差集；不存在的键视为空集合。limit > 0 时交集
+// 最多收集 limit 个成员后即停止。调用方需持有锁
+func (s *Storage) setOpLocked(op SetOp, keys []string, limit int) ([]string, error) {
+	sets := make([]*Set, len(keys))
+	for i, k := range keys {
+		e := s.lookupRead(k)
+		if e == nil {
+			continue
+		}
+		if e.Type != TypeSet {
+			return nil, ErrWrongType
+		}
+		sets[i] = e.Set
+	}
+	var out []string
+	switch op {
+	case SetInter:
+		// 从最小集合出发逐个检查，任一集合为空则结果为空
+		smallest := -1
+		for i, st := range sets {
+			if st == nil {
+				return []string{}, nil
+			}
+			if smallest < 0 || st.Len() < sets[smallest].Len() {
+				smallest = i
+			}
+		}
+		for _, m := range sets[smallest].Members() {
+			inAll := true
+			for i, st := range sets {
+				if i != smallest && !st.Has(m) {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				out = append(out, m)
+				if limit > 0 && len(out) >= limit {
+					break
+				}
+			}
+		}
+	case SetUnion:
+		seen := make(map[string]struct{})
+		for _, st := range sets {
+			if st == nil {
+				continue
+			}
+			for _, m := range st.Members() {
+				if _, ok := seen[m]; !ok {
+					seen[m] = struct{}{}
+					out = append(out, m)
+				}
+			}
+		}
+	case SetDiff:
+		if sets[0] == nil {
+			return []string{}, nil
+		}
+		for _, m := range sets[0].Members() {
+			keep := true
+			for _, st := range sets[1:] {
+				if st != nil && st.Has(m) {
+					keep = false
+					break
+				}
+			}
+			if keep {
+				out = append(out, m)
+			}
+		}
+	}
+	if out == nil {
+		out = []string{}
+	}
+	return out, nil
+}
+
+// SetOperation returns the intersection, union or difference of keys.
+func (s *Storage) SetOperation(op SetOp, keys []string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.setOpLocked(op, keys, 0)
+}
+
+// SetOperationStore stores the result of op over keys into dst (overwriting
+// any existing value) and returns the resulting cardinality.
+func (s *Storage) SetOperationStore(op SetOp, dst string, keys []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members, err := s.setOpLocked(op, keys, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.reserve(setBytes(members) - s.liveSize(dst)); err != nil {
+		return 0, err
+	}
+	if e, ok := s.data[dst]; ok {
+		s.removeEntry(dst, e)
+	}
+	if len(members) > 0 {
+		s.setAddLocked(dst, nil, members)
+	}
+	return len(members), nil
+}
+
+// SInterCard returns the cardinality of the intersection of keys, stopping
+// early once limit is reached (0 means unlimited).
+func (s *Storage) SInterCard(keys []string, limit int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members, err := s.setOpLocked(SetInter, keys, limit)
+	return len(members), err
+}
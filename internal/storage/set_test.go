@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func sorted(vals []string) []string {
+	out := append([]string(nil), vals...)
+	sort.Strings(out)
+	return out
+}
+
+func TestSetIntsetEncoding(t *testing.T) {
+	st := NewSet()
+	for _, m := range []string{"3", "1", "2", "1"} {
+		st.Add(m)
+	}
+	if !st.IsIntset() || st.Len() != 3 {
+		t.Fatalf("expected intset with 3 members, intset=%v len=%d", st.IsIntset(), st.Len())
+	}
+	if !reflect.DeepEqual(st.Members(), []string{"1", "2", "3"}) {
+		t.Fatalf("expected sorted intset members, got %v", st.Members())
+	}
+	// 非规范整数不能进入 intset
+	st.Add("01")
+	if st.IsIntset() || !st.Has("01") || !st.Has("1") {
+		t.Fatalf("expected conversion to hashtable keeping all members")
+	}
+
+	big := NewSet()
+	for i := 0; i <= setMaxIntsetEntries; i++ {
+		big.Add(strconv.Itoa(i))
+	}
+	if big.IsIntset() || big.Len() != setMaxIntsetEntries+1 {
+		t.Fatalf("expected conversion after %d entries", setMaxIntsetEntries)
+	}
+}
+
+func TestSetAddRemMove(t *testing.T) {
+	s := NewStorage()
+	if n, _ := s.SAdd("s", []string{"a", "b", "a"}); n != 2 {
+		t.Fatalf("expected 2 added, got %d", n)
+	}
+	if ok, _ := s.SMove("s", "d", "a"); !ok {
+		t.Fatalf("expected smove to succeed")
+	}
+	if ok, _ := s.SIsMember("d", "a"); !ok {
+		t.Fatalf("expected a in d")
+	}
+	if n, _ := s.SRem("s", []string{"b"}); n != 1 || s.Exists("s") {
+		t.Fatalf("expected s removed once empty")
+	}
+	if m := s.MemoryUsage(); m != 1 {
+		t.Fatalf("expected 1 byte, got %d", m)
+	}
+	s.Set("str", []byte("v"), 0)
+	if _, err := s.SAdd("str", []string{"x"}); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	s := NewStorage()
+	s.SAdd("a", []string{"1", "2", "3", "x"})
+	s.SAdd("b", []string{"2", "3", "4"})
+	if got, _ := s.SetOperation(SetInter, []string{"a", "b"}); !reflect.DeepEqual(sorted(got), []string{"2", "3"}) {
+		t.Fatalf("unexpected inter %v", got)
+	}
+	if got, _ := s.SetOperation(SetUnion, []string{"a", "b", "missing"}); len(got) != 5 {
+		t.Fatalf("unexpected union %v", got)
+	}
+	if got, _ := s.SetOperation(SetDiff, []string{"a", "b"}); !reflect.DeepEqual(sorted(got), []string{"1", "x"}) {
+		t.Fatalf("unexpected diff %v", got)
+	}
+	if got, _ := s.SetOperation(SetInter, []string{"a", "missing"}); len(got) != 0 {
+		t.Fatalf("expected empty inter with missing key, got %v", got)
+	}
+	if n, _ := s.SetOperationStore(SetUnion, "u", []string{"a", "b"}); n != 5 {
+		t.Fatalf("expected 5 stored, got %d", n)
+	}
+	if n, _ := s.SInterCard([]string{"a", "b"}, 1); n != 1 {
+		t.Fatalf("expected limit to cap card at 1, got %d", n)
+	}
+	// 结果为空时目标键被删除
+	s.SetOperationStore(SetInter, "u", []string{"a", "missing"})
+	if s.Exists("u") {
+		t.Fatalf("expected empty result to delete destination")
+	}
+}
+
+func TestSetPopAndRand(t *testing.T) {
+	s := NewStorage()
+	s.SAdd("s", []string{"a", "b", "c"})
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		got, _ := s.SRandMember("s", 2)
+		if len(got) != 2 || got[0] == got[1] {
+			t.Fatalf("expected 2 distinct members, got %v", got)
+		}
+		seen[got[0]], seen[got[1]] = true, true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected every member to be sampled, got %v", seen)
+	}
+	if got, _ := s.SRandMember("s", 10); len(got) != 3 {
+		t.Fatalf("expected all 3 members, got %v", got)
+	}
+	if got, _ := s.SRandMember("s", -6); len(got) != 6 {
+		t.Fatalf("expected 6 members with repeats, got %v", got)
+	}
+	if _, err := s.SRandMember("s", -1000000000000); !errors.Is(err, ErrRandCountRange) {
+		t.Fatalf("expected ErrRandCountRange, got %v", err)
+	}
+	if got, _ := s.SPop("s", 2); len(got) != 2 {
+		t.Fatalf("expected 2 popped, got %v", got)
+	}
+	if n, _ := s.SCard("s"); n != 1 {
+		t.Fatalf("expected 1 remaining, got %d", n)
+	}
+}
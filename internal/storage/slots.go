@@ -0,0 +1,71 @@
+package storage
+
+// slotIndex 按哈希槽记录键，供集群模式按槽统计与枚举键（COUNTKEYSINSLOT、
+// GETKEYSINSLOT 与槽迁移）。已过期但尚未删除的键仍计入索引，与 Redis 一致。
+type slotIndex struct {
+	slot func(key string) int
+	keys []map[string]struct{}
+}
+
+func (x *slotIndex) add(key string) {
+	n := x.slot(key)
+	if x.keys[n] == nil {
+		x.keys[n] = make(map[string]struct{})
+	}
+	x.keys[n][key] = struct{}{}
+}
+
+func (x *slotIndex) remove(key string) {
+	n := x.slot(key)
+	delete(x.keys[n], key)
+	if len(x.keys[n]) == 0 {
+		x.keys[n] = nil
+	}
+}
+
+// EnableSlotIndex starts indexing keys by slot(key), which must return a
+// value in [0, slots). Existing keys are indexed immediately.
+func (s *Storage) EnableSlotIndex(slots int, slot func(key string) int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slots = &slotIndex{slot: slot, keys: make([]map[string]struct{}, slots)}
+	for key := range s.data {
+		s.slots.add(key)
+	}
+}
+
+// CountKeysInSlot returns the number of keys in the slot. It returns 0 when
+// the slot index is not enabled.
+func (s *Storage) CountKeysInSlot(slot int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.slots == nil || slot < 0 || slot >= len(s.slots.keys) {
+		return 0
+	}
+	return len(s.slots.keys[slot])
+}
+
+// KeysInSlot returns up to count keys of the slot in no particular order.
+func (s *Storage) KeysInSlot(slot, count int) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.slots == nil || slot < 0 || slot >= len(s.slots.keys) {
+		return nil
+	}
+	keys := make([]string, 0, min(count, len(s.slots.keys[slot])))
+	for key := range s.slots.keys[slot] {
+		if len(keys) == count {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// setEntry 设置键的值并维护槽索引；调用方需持有写锁
+func (s *Storage) setEntry(key string, e *Entry) {
+	s.data[key] = e
+	if s.slots != nil {
+		s.slots.add(key)
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"maps"
+	"time"
+)
+
+// Snapshot 是某一时刻的只读数据视图，用于 BGSAVE 等需要一致性视图但不能长时间
+// 持有 Storage.mu 的场景。创建时只复制键到 entry 指针的映射；此后写操作在修改
+// 仍被快照共享的 entry 之前先复制一份（写时复制），快照看到的数据保持不变。
+type Snapshot struct {
+	s    *Storage
+	data map[string]*Entry
+	// Time 为快照创建时间（Unix 毫秒），写出时据此跳过已过期的键
+	Time int64
+	// Changes 为快照创建时的累计修改次数（见 Storage.Changes）
+	Changes int64
+}
+
+// Snapshot returns a point-in-time view of the data. The caller must call
+// Release once done so that writers stop copying shared entries.
+func (s *Storage) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sn := &Snapshot{s: s, data: maps.Clone(s.data), Time: time.Now().UnixMilli(), Changes: s.changes}
+	s.snapshots = append(s.snapshots, sn)
+	return sn
+}
+
+// Len returns the number of keys in the snapshot (including expired ones).
+func (sn *Snapshot) Len() int { return len(sn.data) }
+
+// Range calls fn for each key that had not expired at sn.Time, stopping early
+// if fn returns false. Entries must not be modified.
+func (sn *Snapshot) Range(fn func(key string, e *Entry) bool) {
+	for key, e := range sn.data {
+		if e.expired(sn.Time) {
+			continue
+		}
+		if !fn(key, e) {
+			return
+		}
+	}
+}
+
+// Release detaches the snapshot from the storage.
+func (sn *Snapshot) Release() {
+	s := sn.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, x := range s.snapshots {
+		if x == sn {
+			s.snapshots = append(s.snapshots[:i], s.snapshots[i+1:]...)
+			break
+		}
+	}
+	if len(s.snapshots) == 0 {
+		s.snapshots = nil
+	}
+}
+
+// Changes returns the number of write operations applied since the storage
+// was created (a key touched by one command counts once per command).
+func (s *Storage) Changes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.changes
+}
+
+// mutableLocked 返回可以原地修改的 entry：e 仍被某个快照共享时复制一份并替换
+// s.data 中的指针。调用方需持有写锁。
+func (s *Storage) mutableLocked(key string, e *Entry) *Entry {
+	for _, sn := range s.snapshots {
+		if sn.data[key] == e {
+			c := e.clone()
+			s.data[key] = c
+			return c
+		}
+	}
+	return e
+}
+
+// clone 深复制 entry；stream 条目的 Fields 创建后不再修改，可以共享
+func (e *Entry) clone() *Entry {
+	c := *e
+	switch e.Type {
+	case TypeHash:
+		c.Hash = maps.Clone(e.Hash)
+	case TypeList:
+		c.List = &List{buf: append([]string(nil), e.List.buf...), head: e.List.head, n: e.List.n}
+	case TypeSet:
+		c.Set = &Set{ints: append([]int64(nil), e.Set.ints...), m: maps.Clone(e.Set.m)}
+	case TypeZSet:
+		c.ZSet = NewZSet()
+		for m, score := range e.ZSet.dict {
+			c.ZSet.set(m, score)
+		}
+	case TypeStream:
+		c.Stream = e.Stream.clone()
+	}
+	return &c
+}
+
+func (st *Stream) clone() *Stream {
+	c := *st
+	c.entries = append([]StreamEntry(nil), st.entries...)
+	c.groups = make(map[string]*ConsumerGroup, len(st.groups))
+	for name, g := range st.groups {
+		ng := *g
+		ng.pel = make(map[StreamID]*PendingEntry, len(g.pel))
+		for id, pe := range g.pel {
+			p := *pe
+			ng.pel[id] = &p
+		}
+		ng.consumers = make(map[string]*Consumer, len(g.consumers))
+		for cname, cons := range g.consumers {
+			nc := *cons
+			// 消费者的 PEL 与组 PEL 共享同一批 PendingEntry
+			nc.pel = make(map[StreamID]*PendingEntry, len(cons.pel))
+			for id := range cons.pel {
+				nc.pel[id] = ng.pel[id]
+			}
+			ng.consumers[cname] = &nc
+		}
+		c.groups[name] = &ng
+	}
+	return &c
+}
@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"math"
+	"time"
+)
+
+// 快照文件格式（整数均为大端或 varint）：
+//
+//	magic "REDISX" | 版本（4 位 ASCII 数字，如 "0001"）
+//	记录*：类型(1B，即 ValueType) | 过期时间(int64 Unix 毫秒，0 表示永不过期) | key | 值
+//	snapshotEOF(1B) | CRC64-ECMA 校验和（8B 小端，覆盖此前的全部字节）
+//
+// 字符串编码为 uvarint 长度 + 字节；各类型的值编码见 writeValue。
+const (
+	snapshotMagic   = "REDISX"
+	snapshotVersion = 1
+	snapshotEOF     = 0xFF
+	// snapshotMaxLen 限制单个字符串/集合长度，避免损坏的文件导致超大分配
+	snapshotMaxLen = 512 << 20
+)
+
+// ErrBadSnapshot 表示快照文件格式错误或校验失败
+var ErrBadSnapshot = errors.New("bad snapshot file")
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash64
+	n   int64
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc.Write(p)
+	var n int
+	n, sw.err = sw.w.Write(p)
+	sw.n += int64(n)
+}
+
+func (sw *snapshotWriter) byte(b byte)      { sw.write([]byte{b}) }
+func (sw *snapshotWriter) uvarint(v uint64) { sw.write(sw.buf[:binary.PutUvarint(sw.buf[:], v)]) }
+func (sw *snapshotWriter) varint(v int64)   { sw.write(sw.buf[:binary.PutVarint(sw.buf[:], v)]) }
+func (sw *snapshotWriter) id(id StreamID)   { sw.uvarint(id.Ms); sw.uvarint(id.Seq) }
+
+func (sw *snapshotWriter) int64(v int64) {
+	binary.BigEndian.PutUint64(sw.buf[:8], uint64(v))
+	sw.write(sw.buf[:8])
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+func (sw *snapshotWriter) bytes(b []byte) {
+	sw.uvarint(uint64(len(b)))
+	sw.write(b)
+}
+
+func (sw *snapshotWriter) strings(ss []string) {
+	sw.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		sw.string(s)
+	}
+}
+
+// WriteTo encodes the snapshot to w, skipping keys that had already expired
+// when the snapshot was taken.
+func (sn *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc64.New(crcTable)}
+	sw.write([]byte(fmt.Sprintf("%s%04d", snapshotMagic, snapshotVersion)))
+	for key, e := range sn.data {
+		if e.expired(sn.Time) {
+			continue
+		}
+		sw.byte(byte(e.Type))
+		sw.int64(e.ExpireAt)
+		sw.string(key)
+		sw.writeValue(e)
+		if sw.err != nil {
+			return sw.n, sw.err
+		}
+	}
+	sw.byte(snapshotEOF)
+	if sw.err != nil {
+		return sw.n, sw.err
+	}
+	// 校验和本身不计入 CRC
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], sw.crc.Sum64())
+	if _, err := sw.w.Write(sum[:]); err != nil {
+		return sw.n, err
+	}
+	sw.n += 8
+	return sw.n, sw.w.Flush()
+}
+
+func (sw *snapshotWriter) writeValue(e *Entry) {
+	switch e.Type {
+	case TypeString:
+		sw.bytes(e.Value)
+	case TypeHash:
+		sw.uvarint(uint64(len(e.Hash)))
+		for f, v := range e.Hash {
+			sw.string(f)
+			sw.string(v)
+		}
+	case TypeList:
+		sw.strings(e.List.Slice(0, e.List.Len()-1))
+	case TypeSet:
+		sw.strings(e.Set.Members())
+	case TypeZSet:
+		sw.uvarint(uint64(e.ZSet.Len()))
+		for x := e.ZSet.zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+			sw.string(x.member)
+			sw.int64(int64(math.Float64bits(x.score)))
+		}
+	case TypeStream:
+		sw.writeStream(e.Stream)
+	}
+}
+
+// writeStream 编码条目以及消费组（含 PEL 与消费者）
+func (sw *snapshotWriter) writeStream(st *Stream) {
+	sw.id(st.lastID)
+	sw.id(st.maxDeletedID)
+	sw.uvarint(st.entriesAdded)
+	sw.uvarint(uint64(len(st.entries)))
+	for _, en := range st.entries {
+		sw.id(en.ID)
+		sw.strings(en.Fields)
+	}
+	sw.uvarint(uint64(len(st.groups)))
+	for _, g := range st.groups {
+		sw.string(g.Name)
+		sw.id(g.LastID)
+		sw.varint(g.EntriesRead)
+		sw.uvarint(uint64(len(g.consumers)))
+		for _, c := range g.consumers {
+			sw.string(c.Name)
+			sw.varint(c.SeenTime)
+			sw.varint(c.ActiveTime)
+		}
+		sw.uvarint(uint64(len(g.pel)))
+		for _, pe := range g.pel {
+			sw.id(pe.ID)
+			sw.string(pe.Consumer)
+			sw.varint(pe.DeliveryTime)
+			sw.varint(pe.DeliveryCount)
+		}
+	}
+}
+
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash64
+	err error
+}
+
+func (sr *snapshotReader) fail(format string, args ...any) {
+	if sr.err == nil {
+		sr.err = fmt.Errorf("%w: %s", ErrBadSnapshot, fmt.Sprintf(format, args...))
+	}
+}
+
+func (sr *snapshotReader) read(p []byte) {
+	if sr.err != nil {
+		return
+	}
+	if _, err := io.ReadFull(sr.r, p); err != nil {
+		sr.fail("unexpected end of file")
+		return
+	}
+	sr.crc.Write(p)
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	var b [1]byte
+	sr.read(b[:])
+	return b[0], sr.err
+}
+
+func (sr *snapshotReader) byte() byte {
+	b, _ := sr.ReadByte()
+	return b
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(sr)
+	if err != nil {
+		sr.fail("invalid varint")
+	}
+	return v
+}
+
+func (sr *snapshotReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(sr)
+	if err != nil {
+		sr.fail("invalid varint")
+	}
+	return v
+}
+
+func (sr *snapshotReader) int64() int64 {
+	var b [8]byte
+	sr.read(b[:])
+	return int64(binary.BigEndian.Uint64(b[:]))
+}
+
+func (sr *snapshotReader) id() StreamID {
+	ms := sr.uvarint()
+	return StreamID{Ms: ms, Seq: sr.uvarint()}
+}
+
+// count 读取长度前缀并做上限检查
+func (sr *snapshotReader) count() int {
+	n := sr.uvarint()
+	if n > snapshotMaxLen {
+		sr.fail("length %d too large", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *snapshotReader) string() string {
+	return string(sr.bytes())
+}
+
+func (sr *snapshotReader) bytes() []byte {
+	n := sr.count()
+	if sr.err != nil || n == 0 {
+		return nil
+	}
+	b := make([]byte, n)
+	sr.read(b)
+	return b
+}
+
+func (sr *snapshotReader) strings() []string {
+	n := sr.count()
+	out := make([]string, 0, min(n, 1024))
+	for i := 0; i < n && sr.err == nil; i++ {
+		out = append(out, sr.string())
+	}
+	return out
+}
+
+// LoadSnapshot replaces the current data with the snapshot read from r and
+// returns the number of keys loaded. Keys that have already expired are
+// skipped. The data is left untouched if the file is malformed or its
+// checksum does not match. When r is a *bufio.Reader it is used directly and
+// nothing past the end of the snapshot is consumed, so the caller can keep
+// reading data that follows it (as in an AOF with a snapshot preamble).
+func (s *Storage) LoadSnapshot(r io.Reader) (int, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	sr := &snapshotReader{r: br, crc: crc64.New(crcTable)}
+	header := make([]byte, len(snapshotMagic)+4)
+	sr.read(header)
+	if sr.err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, fmt.Errorf("%w: wrong signature", ErrBadSnapshot)
+	}
+	var version int
+	if _, err := fmt.Sscanf(string(header[len(snapshotMagic):]), "%04d", &version); err != nil || version > snapshotVersion {
+		return 0, fmt.Errorf("%w: unsupported version %q", ErrBadSnapshot, header[len(snapshotMagic):])
+	}
+
+	now := time.Now().UnixMilli()
+	data := make(map[string]*Entry)
+	var total int64
+	for sr.err == nil {
+		t := sr.byte()
+		if sr.err != nil || t == snapshotEOF {
+			break
+		}
+		expireAt := sr.int64()
+		key := sr.string()
+		e := sr.readValue(ValueType(t))
+		if sr.err != nil {
+			break
+		}
+		e.ExpireAt = expireAt
+		if e.expired(now) {
+			continue
+		}
+		data[key] = e
+		total += e.memSize()
+	}
+	if sr.err != nil {
+		return 0, sr.err
+	}
+	want := sr.crc.Sum64()
+	var sum [8]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return 0, fmt.Errorf("%w: missing checksum", ErrBadSnapshot)
+	}
+	if binary.LittleEndian.Uint64(sum[:]) != want {
+		return 0, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.data {
+		s.touchLocked(key)
+	}
+	for key := range data {
+		s.touchLocked(key)
+	}
+	s.data = data
+	s.totalBytes = total
+	if s.slots != nil {
+		s.slots.keys = make([]map[string]struct{}, len(s.slots.keys))
+		for key := range data {
+			s.slots.add(key)
+		}
+	}
+	return len(data), nil
+}
+
+// readValue 解码一个值并计算其 size（与写路径的计数方式一致）
+func (sr *snapshotReader) readValue(t ValueType) *Entry {
+	e := &Entry{Type: t}
+	switch t {
+	case TypeString:
+		e.Value = sr.bytes()
+	case TypeHash:
+		n := sr.count()
+		e.Hash = make(map[string]string, min(n, 1024))
+		for i := 0; i < n && sr.err == nil; i++ {
+			f, v := sr.string(), sr.string()
+			e.Hash[f] = v
+			e.size += int64(len(f) + len(v))
+		}
+	case TypeList:
+		vals := sr.strings()
+		e.List = NewList()
+		e.List.reset(vals)
+		e.size = listBytes(vals)
+	case TypeSet:
+		members := sr.strings()
+		e.Set = NewSet()
+		for _, m := range members {
+			e.Set.Add(m)
+		}
+		e.size = setBytes(members)
+	case TypeZSet:
+		n := sr.count()
+		e.ZSet = NewZSet()
+		for i := 0; i < n && sr.err == nil; i++ {
+			m := sr.string()
+			score := math.Float64frombits(uint64(sr.int64()))
+			e.ZSet.set(m, score)
+			e.size += int64(len(m) + zsetMemberOverhead)
+		}
+	case TypeStream:
+		e.Stream, e.size = sr.readStream()
+	default:
+		sr.fail("unknown value type %d", t)
+	}
+	return e
+}
+
+func (sr *snapshotReader) readStream() (*Stream, int64) {
+	st := NewStream()
+	var size int64
+	st.lastID = sr.id()
+	st.maxDeletedID = sr.id()
+	st.entriesAdded = sr.uvarint()
+	n := sr.count()
+	st.entries = make([]StreamEntry, 0, min(n, 1024))
+	for i := 0; i < n && sr.err == nil; i++ {
+		en := StreamEntry{ID: sr.id(), Fields: sr.strings()}
+		st.entries = append(st.entries, en)
+		size += streamEntryBytes(en.Fields)
+	}
+	ng := sr.count()
+	for i := 0; i < ng && sr.err == nil; i++ {
+		g := &ConsumerGroup{
+			Name:      sr.string(),
+			pel:       make(map[StreamID]*PendingEntry),
+			consumers: make(map[string]*Consumer),
+		}
+		g.LastID = sr.id()
+		g.EntriesRead = sr.varint()
+		nc := sr.count()
+		for j := 0; j < nc && sr.err == nil; j++ {
+			c := &Consumer{Name: sr.string(), pel: make(map[StreamID]*PendingEntry)}
+			c.SeenTime = sr.varint()
+			c.ActiveTime = sr.varint()
+			g.consumers[c.Name] = c
+		}
+		np := sr.count()
+		for j := 0; j < np && sr.err == nil; j++ {
+			pe := &PendingEntry{ID: sr.id(), Consumer: sr.string()}
+			pe.DeliveryTime = sr.varint()
+			pe.DeliveryCount = sr.varint()
+			c := g.consumers[pe.Consumer]
+			if c == nil {
+				sr.fail("pending entry %s owned by unknown consumer %q", pe.ID, pe.Consumer)
+				break
+			}
+			g.pel[pe.ID] = pe
+			c.pel[pe.ID] = pe
+		}
+		st.groups[g.Name] = g
+	}
+	return st, size
+}
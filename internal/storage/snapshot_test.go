@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func saveSnapshot(t *testing.T, s *Storage) []byte {
+	t.Helper()
+	sn := s.Snapshot()
+	defer sn.Release()
+	var buf bytes.Buffer
+	if _, err := sn.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	s := NewStorage()
+	s.Set("str", []byte("hello"), 0)
+	s.SetWithMs("ttl", []byte("v"), 60000)
+	s.SetWithMs("gone", []byte("v"), 1)
+	s.HSet("h", []string{"f1", "v1", "f2", "v2"})
+	s.RPush("l", []string{"a", "b", "c"})
+	s.SAdd("ints", []string{"3", "1", "2"})
+	s.SAdd("words", []string{"x", "y"})
+	s.ZAdd("z", ZAddFlags{}, []ZMember{{Member: "m1", Score: 1.5}, {Member: "m2", Score: -2}})
+	mustXAdd(t, s, "st", "1-0", "k", "v")
+	mustXAdd(t, s, "st", "2-0", "k", "w")
+	s.XGroupCreate("st", "g", StreamID{}, false, false, -1)
+	s.XReadGroup("g", "alice", []XReadArg{{Key: "st", New: true}}, 1, false, -1, nil)
+	time.Sleep(5 * time.Millisecond)
+
+	data := saveSnapshot(t, s)
+	r := NewStorage()
+	n, err := r.LoadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Fatalf("expected 8 keys (expired key skipped), got %d", n)
+	}
+	if v, _ := r.Get("str"); string(v) != "hello" {
+		t.Fatalf("unexpected string %q", v)
+	}
+	if ttl := r.PTTL("ttl"); ttl <= 0 || ttl > 60000 {
+		t.Fatalf("expected TTL to be preserved, got %d", ttl)
+	}
+	if v, _, _ := r.HGet("h", "f2"); v != "v2" {
+		t.Fatalf("unexpected hash field %q", v)
+	}
+	if l, _ := r.LRange("l", 0, -1); len(l) != 3 || l[0] != "a" || l[2] != "c" {
+		t.Fatalf("unexpected list %v", l)
+	}
+	if e := r.data["ints"]; !e.Set.IsIntset() || e.Set.Len() != 3 {
+		t.Fatal("expected intset encoding to be restored")
+	}
+	if got, _ := r.ZRange("z", ZRangeSpec{Start: 0, Stop: -1, Count: -1}); len(got) != 2 || got[0].Member != "m2" || got[1].Score != 1.5 {
+		t.Fatalf("unexpected zset %v", got)
+	}
+	sum, _ := r.XPendingSummary("st", "g")
+	if sum.Count != 1 || len(sum.Consumers) != 1 || sum.Consumers[0].Name != "alice" {
+		t.Fatalf("unexpected pending summary %+v", sum)
+	}
+	res, _ := r.XReadGroup("g", "bob", []XReadArg{{Key: "st", New: true}}, 0, false, -1, nil)
+	if len(res) != 1 || res[0].Entries[0].ID != (StreamID{2, 0}) {
+		t.Fatalf("group position not restored: %+v", res)
+	}
+	if r.MemoryUsage() != s.MemoryUsage()-1 {
+		t.Fatalf("memory accounting mismatch: %d vs %d", r.MemoryUsage(), s.MemoryUsage()-1)
+	}
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	s := NewStorage()
+	s.Set("k", []byte("v"), 0)
+	data := saveSnapshot(t, s)
+
+	r := NewStorage()
+	r.Set("keep", []byte("me"), 0)
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-10] ^= 0xFF
+	if _, err := r.LoadSnapshot(bytes.NewReader(bad)); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("expected ErrBadSnapshot, got %v", err)
+	}
+	if _, err := r.LoadSnapshot(bytes.NewReader(data[:len(data)-3])); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("expected truncated file to be rejected, got %v", err)
+	}
+	if _, err := r.LoadSnapshot(bytes.NewReader([]byte("NOTASNAPSHOT"))); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("expected bad signature error, got %v", err)
+	}
+	if v, _ := r.Get("keep"); string(v) != "me" {
+		t.Fatal("failed load must not modify existing data")
+	}
+}
+
+func TestSnapshotCopyOnWrite(t *testing.T) {
+	s := NewStorage()
+	s.Set("k", []byte("old"), 0)
+	s.RPush("l", []string{"a"})
+	s.HSet("h", []string{"f", "old"})
+	sn := s.Snapshot()
+	// 快照之后的写入不应影响快照内容
+	s.Set("k", []byte("new"), 0)
+	s.RPush("l", []string{"b"})
+	s.HSet("h", []string{"f", "new"})
+	s.Expire("h", 100)
+	s.Set("added", []byte("x"), 0)
+
+	var buf bytes.Buffer
+	if _, err := sn.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sn.Release()
+	if len(s.snapshots) != 0 {
+		t.Fatal("snapshot should be released")
+	}
+	r := NewStorage()
+	if _, err := r.LoadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Get("k"); string(v) != "old" {
+		t.Fatalf("expected old value, got %q", v)
+	}
+	if l, _ := r.LRange("l", 0, -1); len(l) != 1 {
+		t.Fatalf("expected list of 1, got %v", l)
+	}
+	if v, _, _ := r.HGet("h", "f"); v != "old" || r.TTL("h") != -1 {
+		t.Fatalf("expected untouched hash, got %q ttl %d", v, r.TTL("h"))
+	}
+	if r.Exists("added") {
+		t.Fatal("key added after the snapshot should not be saved")
+	}
+	// 当前数据不受影响
+	if l, _ := s.LRange("l", 0, -1); len(l) != 2 {
+		t.Fatalf("expected live list of 2, got %v", l)
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	s := NewStorage()
+	s.HSet("h", []string{"f1", "v1", "f2", "v2"})
+	mustXAdd(t, s, "st", "1-0", "k", "v")
+	s.XGroupCreate("st", "g", StreamID{}, false, false, -1)
+
+	r := NewStorage()
+	for _, key := range []string{"h", "st"} {
+		payload, ok := s.Dump(key)
+		if !ok {
+			t.Fatalf("expected %s to exist", key)
+		}
+		if err := r.Restore(key, payload, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Restore(key, payload, 0, false); !errors.Is(err, ErrBusyKey) {
+			t.Fatalf("expected ErrBusyKey, got %v", err)
+		}
+	}
+	if v, _, _ := r.HGet("h", "f2"); v != "v2" {
+		t.Fatalf("unexpected hash field %q", v)
+	}
+	if groups, _ := r.XInfoGroups("st"); len(groups) != 1 {
+		t.Fatalf("expected consumer group to be restored, got %+v", groups)
+	}
+	if r.MemoryUsage() != s.MemoryUsage() {
+		t.Fatalf("memory accounting mismatch: %d vs %d", r.MemoryUsage(), s.MemoryUsage())
+	}
+
+	// REPLACE 覆盖已有键并设置过期时间；过去的时间只删除键
+	s.Set("str", []byte("hello"), 0)
+	payload, _ := s.Dump("str")
+	if err := r.Restore("h", payload, time.Now().UnixMilli()+60000, true); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Get("h"); string(v) != "hello" || r.PTTL("h") <= 0 {
+		t.Fatalf("unexpected restored string %q ttl %d", v, r.PTTL("h"))
+	}
+	if err := r.Restore("h", payload, 1, true); err != nil || r.Exists("h") {
+		t.Fatalf("expected past expiration to delete the key, err %v", err)
+	}
+
+	bad := []byte(payload)
+	bad[1] ^= 0xFF
+	for _, p := range []string{string(bad), payload[:len(payload)-1], "x"} {
+		if err := r.Restore("bad", p, 0, false); !errors.Is(err, ErrBadPayload) {
+			t.Fatalf("expected ErrBadPayload for %q, got %v", p, err)
+		}
+	}
+	if _, ok := s.Dump("missing"); ok {
+		t.Fatal("expected missing key not to be dumped")
+	}
+}
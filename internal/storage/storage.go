@@ -1,15 +1,76 @@
 package storage
 
 import (
+	"errors"
 	"strconv"
 	"sync"
 	"time"
 )
 
-// Entry 表示存储的值及过期时间（Unix 毫秒）
+var (
+	// ErrWrongType 表示对键执行了与其值类型不匹配的操作
+	ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	// ErrMaxMemory 表示写入会超出 maxMemory 限制
+	ErrMaxMemory = errors.New("max memory reached")
+)
+
+// ValueType 标识键所保存的值类型
+type ValueType uint8
+
+const (
+	TypeString ValueType = iota
+	TypeHash
+	TypeList
+	TypeSet
+	TypeZSet
+	TypeStream
+)
+
+// String returns the type name as reported by the TYPE command.
+func (t ValueType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeHash:
+		return "hash"
+	case TypeList:
+		return "list"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	case TypeStream:
+		return "stream"
+	}
+	return "none"
+}
+
+// Entry 表示存储的值及过期时间（Unix 毫秒）。字符串值 Value 存入后不再原地
+// 修改：修改时替换为新的切片（写时复制），因此读者与快照可以不加锁地持有它。
 type Entry struct {
-	Value    string
-	ExpireAt int64 // Unix 毫秒时间戳，0 表示永不过期
+	Type     ValueType
+	Value    []byte            // TypeString
+	Hash     map[string]string // TypeHash
+	List     *List             // TypeList
+	Set      *Set              // TypeSet
+	ZSet     *ZSet             // TypeZSet
+	Stream   *Stream           // TypeStream
+	ExpireAt int64             // Unix 毫秒时间戳，0 表示永不过期
+
+	// size 为容器类型（hash、list、set、zset 等）累计的字节数，字符串直接使用 len(Value)
+	size int64
+}
+
+// memSize 返回该 entry 计入 totalBytes 的字节数
+func (e *Entry) memSize() int64 {
+	if e.Type == TypeString {
+		return int64(len(e.Value))
+	}
+	return e.size
+}
+
+func (e *Entry) expired(now int64) bool {
+	return e.ExpireAt != 0 && now >= e.ExpireAt
 }
 
 type Storage struct {
@@ -17,6 +78,25 @@ type Storage struct {
 	data       map[string]*Entry
 	maxMemory  int64 // bytes, 0 means no limit
 	totalBytes int64 // current total bytes used by values
+
+	// 阻塞命令的等待队列（按键 FIFO）及本轮写操作产生的就绪键；exclusive 为
+	// true 时（Exclusive 执行期间）就绪键只记录，在整个区间结束后统一服务
+	waiters   map[string][]*listWaiter
+	ready     []string
+	exclusive bool
+
+	// gate 保证 EXEC 执行期间没有其他命令交错执行（见 Exclusive/Shared）
+	gate sync.RWMutex
+	// watched 为被 WATCH 的键维护版本号
+	watched map[string]*watchedKey
+	// changes 为累计修改次数；snapshots 为尚未释放的快照（写时复制）
+	changes   int64
+	snapshots []*Snapshot
+	// propagated 为阻塞命令以等价的非阻塞命令形式记录的写入（见 propagate.go）
+	propagating bool
+	propagated  [][]string
+	// slots 为集群模式的按槽键索引（见 slots.go），nil 表示未启用
+	slots *slotIndex
 }
 
 func NewStorage() *Storage {
@@ -44,76 +124,117 @@ func (s *Storage) GetMaxMemory() int64 {
 	return s.maxMemory
 }
 
-// Get retrieves the value for the given key. If the key is expired it will be
-// removed and the function returns ("", false).
-func (s *Storage) Get(key string) (string, bool) {
+// Get retrieves the string value for the given key. If the key is expired it
+// will be removed and the function returns (nil, false). Keys holding other
+// value types are reported as missing; use GetString to tell them apart. The
+// returned slice is shared with the storage and must not be modified.
+func (s *Storage) Get(key string) ([]byte, bool) {
+	v, ok, err := s.GetString(key)
+	return v, ok && err == nil
+}
+
+// GetString is like Get but returns ErrWrongType when the key holds a
+// non-string value.
+func (s *Storage) GetString(key string) ([]byte, bool, error) {
 	s.mu.RLock()
 	v, ok := s.data[key]
 	if !ok {
 		s.mu.RUnlock()
-		return "", false
+		return nil, false, nil
 	}
 	// 过期检查（使用毫秒精度）
-	if v.ExpireAt != 0 && time.Now().UnixMilli() >= v.ExpireAt {
+	if v.expired(time.Now().UnixMilli()) {
 		// 升级为写锁以删除已过期的键
 		s.mu.RUnlock()
 		s.mu.Lock()
-		if vv, ok2 := s.data[key]; ok2 {
-			if vv.ExpireAt != 0 && time.Now().UnixMilli() >= vv.ExpireAt {
-				delete(s.data, key)
-				s.mu.Unlock()
-				return "", false
-			}
-			val := vv.Value
-			s.mu.Unlock()
-			return val, true
+		defer s.mu.Unlock()
+		vv := s.lookupWrite(key)
+		if vv == nil {
+			return nil, false, nil
+		}
+		if vv.Type != TypeString {
+			return nil, false, ErrWrongType
 		}
-		s.mu.Unlock()
-		return "", false
+		return vv.Value, true, nil
+	}
+	defer s.mu.RUnlock()
+	if v.Type != TypeString {
+		return nil, false, ErrWrongType
+	}
+	return v.Value, true, nil
+}
+
+// lookupRead 返回未过期的 entry；调用方需持有读锁
+func (s *Storage) lookupRead(key string) *Entry {
+	e, ok := s.data[key]
+	if !ok || e.expired(time.Now().UnixMilli()) {
+		return nil
 	}
-	val := v.Value
-	s.mu.RUnlock()
-	return val, true
+	return e
 }
 
-// Set sets the value and ttl in seconds (0 means no expiration).
-func (s *Storage) Set(key, value string, ttlSeconds int64) {
+// lookupWrite 返回未过期的 entry，并顺带删除已过期的键；调用方需持有写锁
+func (s *Storage) lookupWrite(key string) *Entry {
+	s.touchLocked(key)
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(time.Now().UnixMilli()) {
+		s.removeEntry(key, e)
+		return nil
+	}
+	return s.mutableLocked(key, e)
+}
+
+// removeEntry 删除键并调整内存计数；调用方需持有写锁
+func (s *Storage) removeEntry(key string, e *Entry) {
+	s.totalBytes -= e.memSize()
+	delete(s.data, key)
+	if s.slots != nil {
+		s.slots.remove(key)
+	}
+	s.touchLocked(key)
+}
+
+// reserve 检查新增 delta 字节是否超出 maxMemory；调用方需持有写锁
+func (s *Storage) reserve(delta int64) error {
+	if delta > 0 && s.maxMemory > 0 && s.totalBytes+delta > s.maxMemory {
+		return ErrMaxMemory
+	}
+	return nil
+}
+
+// Set sets the value and ttl in seconds (0 means no expiration). The storage
+// takes ownership of value: the caller must not modify it afterwards.
+func (s *Storage) Set(key string, value []byte, ttlSeconds int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	exp := int64(0)
 	if ttlSeconds > 0 {
 		exp = time.Now().UnixMilli() + ttlSeconds*1000
 	}
-	oldLen := 0
-	if e, ok := s.data[key]; ok {
-		// 如果旧值未过期，计算旧长度
-		if e.ExpireAt == 0 || time.Now().UnixMilli() < e.ExpireAt {
-			oldLen = len(e.Value)
-		}
-	}
-	delta := int64(len(value) - oldLen)
+	oldLen := s.liveSize(key)
+	delta := int64(len(value)) - oldLen
 	// 更新总字节数
 	s.totalBytes += delta
-	s.data[key] = &Entry{Value: value, ExpireAt: exp}
+	s.setEntry(key, &Entry{Value: value, ExpireAt: exp})
+	s.touchLocked(key)
 }
 
 // SetWithMs sets the value and ttl in milliseconds (0 means no expiration).
-func (s *Storage) SetWithMs(key, value string, ttlMillis int64) {
+func (s *Storage) SetWithMs(key string, value []byte, ttlMillis int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	exp := int64(0)
 	if ttlMillis > 0 {
 		exp = time.Now().UnixMilli() + ttlMillis
 	}
-	oldLen := 0
-	if e, ok := s.data[key]; ok {
-		if e.ExpireAt == 0 || time.Now().UnixMilli() < e.ExpireAt {
-			oldLen = len(e.Value)
-		}
-	}
-	delta := int64(len(value) - oldLen)
+	oldLen := s.liveSize(key)
+	delta := int64(len(value)) - oldLen
 	s.totalBytes += delta
-	s.data[key] = &Entry{Value: value, ExpireAt: exp}
+	s.setEntry(key, &Entry{Value: value, ExpireAt: exp})
+	s.touchLocked(key)
 }
 
 func (s *Storage) Delete(key string) bool {
@@ -121,13 +242,20 @@ func (s *Storage) Delete(key string) bool {
 	defer s.mu.Unlock()
 	if e, ok := s.data[key]; ok {
 		// 调整内存计数
-		s.totalBytes -= int64(len(e.Value))
-		delete(s.data, key)
+		s.removeEntry(key, e)
 		return true
 	}
 	return false
 }
 
+// liveSize 返回键当前计入内存的字节数（已过期视为 0）；调用方需持有写锁
+func (s *Storage) liveSize(key string) int64 {
+	if e, ok := s.data[key]; ok && !e.expired(time.Now().UnixMilli()) {
+		return e.memSize()
+	}
+	return 0
+}
+
 // IncrBy atomically increments the integer value of a key by delta. If the key
 // does not exist it is set to delta. Returns the new value or an error if the
 // current value is not an integer.
@@ -136,35 +264,29 @@ func (s *Storage) IncrBy(key string, delta int64) (int64, error) {
 	defer s.mu.Unlock()
 	var cur int64
 	oldLen := 0
-	if e, ok := s.data[key]; ok {
-		if e.ExpireAt != 0 && time.Now().UnixMilli() >= e.ExpireAt {
-			// expired
-			// 调整内存计数
-			s.totalBytes -= int64(len(e.Value))
-			delete(s.data, key)
-			cur = 0
-		} else {
-			val := e.Value
-			oldLen = len(val)
-			if val == "" {
-				cur = 0
-			} else {
-				v, err := strconv.ParseInt(val, 10, 64)
-				if err != nil {
-					return 0, err
-				}
-				cur = v
+	if e := s.lookupWrite(key); e != nil {
+		if e.Type != TypeString {
+			return 0, ErrWrongType
+		}
+		val := e.Value
+		oldLen = len(val)
+		if len(val) > 0 {
+			v, err := strconv.ParseInt(string(val), 10, 64)
+			if err != nil {
+				return 0, err
 			}
+			cur = v
 		}
 	}
 	cur += delta
-	newVal := strconv.FormatInt(cur, 10)
+	// 写入新的切片而非原地修改，已返回给读者的旧值不受影响
+	newVal := strconv.AppendInt(nil, cur, 10)
 	// 更新总字节数
 	s.totalBytes += int64(len(newVal) - oldLen)
 	if e, ok := s.data[key]; ok {
 		e.Value = newVal
 	} else {
-		s.data[key] = &Entry{Value: newVal, ExpireAt: 0}
+		s.setEntry(key, &Entry{Value: newVal, ExpireAt: 0})
 	}
 	return cur, nil
 }
@@ -175,7 +297,9 @@ func (s *Storage) Persist(key string) bool {
 	defer s.mu.Unlock()
 	if e, ok := s.data[key]; ok {
 		if e.ExpireAt != 0 {
+			e = s.mutableLocked(key, e)
 			e.ExpireAt = 0
+			s.touchLocked(key)
 			return true
 		}
 		return false
@@ -185,48 +309,40 @@ func (s *Storage) Persist(key string) bool {
 
 // TrySet tries to set a key given seconds TTL, honoring maxMemory if set.
 // Returns true if set succeeded, false if rejected due to memory limit.
-func (s *Storage) TrySet(key, value string, ttlSeconds int64) bool {
+func (s *Storage) TrySet(key string, value []byte, ttlSeconds int64) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	exp := int64(0)
 	if ttlSeconds > 0 {
 		exp = time.Now().UnixMilli() + ttlSeconds*1000
 	}
-	oldLen := 0
-	if e, ok := s.data[key]; ok {
-		if e.ExpireAt == 0 || time.Now().UnixMilli() < e.ExpireAt {
-			oldLen = len(e.Value)
-		}
-	}
-	delta := int64(len(value) - oldLen)
+	oldLen := s.liveSize(key)
+	delta := int64(len(value)) - oldLen
 	if s.maxMemory > 0 && s.totalBytes+delta > s.maxMemory {
 		return false
 	}
 	s.totalBytes += delta
-	s.data[key] = &Entry{Value: value, ExpireAt: exp}
+	s.setEntry(key, &Entry{Value: value, ExpireAt: exp})
+	s.touchLocked(key)
 	return true
 }
 
 // TrySetWithMs tries to set a key given ms TTL, honoring maxMemory if set.
-func (s *Storage) TrySetWithMs(key, value string, ttlMillis int64) bool {
+func (s *Storage) TrySetWithMs(key string, value []byte, ttlMillis int64) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	exp := int64(0)
 	if ttlMillis > 0 {
 		exp = time.Now().UnixMilli() + ttlMillis
 	}
-	oldLen := 0
-	if e, ok := s.data[key]; ok {
-		if e.ExpireAt == 0 || time.Now().UnixMilli() < e.ExpireAt {
-			oldLen = len(e.Value)
-		}
-	}
-	delta := int64(len(value) - oldLen)
+	oldLen := s.liveSize(key)
+	delta := int64(len(value)) - oldLen
 	if s.maxMemory > 0 && s.totalBytes+delta > s.maxMemory {
 		return false
 	}
 	s.totalBytes += delta
-	s.data[key] = &Entry{Value: value, ExpireAt: exp}
+	s.setEntry(key, &Entry{Value: value, ExpireAt: exp})
+	s.touchLocked(key)
 	return true
 }
 
@@ -242,11 +358,13 @@ func (s *Storage) Expire(key string, ttlSeconds int64) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if e, ok := s.data[key]; ok {
+		e = s.mutableLocked(key, e)
 		if ttlSeconds > 0 {
 			e.ExpireAt = time.Now().UnixMilli() + ttlSeconds*1000
 		} else {
 			e.ExpireAt = 0
 		}
+		s.touchLocked(key)
 		return true
 	}
 	return false
@@ -257,16 +375,49 @@ func (s *Storage) PExpire(key string, ttlMillis int64) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if e, ok := s.data[key]; ok {
+		e = s.mutableLocked(key, e)
 		if ttlMillis > 0 {
 			e.ExpireAt = time.Now().UnixMilli() + ttlMillis
 		} else {
 			e.ExpireAt = 0
 		}
+		s.touchLocked(key)
 		return true
 	}
 	return false
 }
 
+// PExpireAt sets an absolute expiry as a Unix time in milliseconds. A time in
+// the past deletes the key. Returns false if the key does not exist.
+func (s *Storage) PExpireAt(key string, unixMillis int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.lookupWrite(key)
+	if e == nil {
+		return false
+	}
+	if unixMillis <= time.Now().UnixMilli() {
+		s.removeEntry(key, e)
+		return true
+	}
+	e.ExpireAt = unixMillis
+	return true
+}
+
+// PExpireTime 返回键的绝对过期时间（Unix 毫秒）：-2 表示键不存在，-1 表示永不过期
+func (s *Storage) PExpireTime(key string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e := s.lookupRead(key)
+	if e == nil {
+		return -2
+	}
+	if e.ExpireAt == 0 {
+		return -1
+	}
+	return e.ExpireAt
+}
+
 // TTL returns remaining seconds: -2 key not exist, -1 key exists but no expiry.
 func (s *Storage) TTL(key string) int64 {
 	s.mu.RLock()
@@ -321,8 +472,7 @@ func (s *Storage) StartJanitor(interval time.Duration) {
 			for k, v := range s.data {
 				if v.ExpireAt != 0 && now >= v.ExpireAt {
 					// 调整内存计数
-					s.totalBytes -= int64(len(v.Value))
-					delete(s.data, k)
+					s.removeEntry(k, v)
 				}
 			}
 			s.mu.Unlock()
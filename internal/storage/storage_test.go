@@ -1,14 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"testing"
 	"time"
 )
 
 func TestSetGetDeleteExists(t *testing.T) {
 	s := NewStorage()
-	s.Set("k1", "v1", 0)
-	if v, ok := s.Get("k1"); !ok || v != "v1" {
+	s.Set("k1", []byte("v1"), 0)
+	if v, ok := s.Get("k1"); !ok || string(v) != "v1" {
 		t.Fatalf("expected k1=v1, got %v,%v", v, ok)
 	}
 	if !s.Exists("k1") {
@@ -24,7 +25,7 @@ func TestSetGetDeleteExists(t *testing.T) {
 
 func TestExpireAndTTL(t *testing.T) {
 	s := NewStorage()
-	s.Set("k2", "v2", 0)
+	s.Set("k2", []byte("v2"), 0)
 	if !s.Expire("k2", 1) {
 		t.Fatalf("expected expire to succeed")
 	}
@@ -57,8 +58,8 @@ func TestExpireAndTTL(t *testing.T) {
 
 func TestCountAndJanitor(t *testing.T) {
 	s := NewStorage()
-	s.Set("a", "1", 0)
-	s.Set("b", "2", 1)
+	s.Set("a", []byte("1"), 0)
+	s.Set("b", []byte("2"), 1)
 	if n := s.Count(); n != 2 {
 		t.Fatalf("expected count 2, got %d", n)
 	}
@@ -72,7 +73,7 @@ func TestCountAndJanitor(t *testing.T) {
 
 func TestPExpireAndPTTL(t *testing.T) {
 	s := NewStorage()
-	s.Set("kp", "vp", 0)
+	s.Set("kp", []byte("vp"), 0)
 	if !s.PExpire("kp", 500) {
 		t.Fatalf("expected PExpire to succeed")
 	}
@@ -88,3 +89,94 @@ func TestPExpireAndPTTL(t *testing.T) {
 		t.Fatalf("expected PTTL -2 for missing key, got %d", pttl)
 	}
 }
+
+func TestPExpireAt(t *testing.T) {
+	s := NewStorage()
+	if s.PExpireAt("missing", time.Now().UnixMilli()+1000) {
+		t.Fatal("expected PExpireAt on a missing key to fail")
+	}
+	s.Set("k", []byte("v"), 0)
+	if got := s.PExpireTime("k"); got != -1 {
+		t.Fatalf("expected -1 without expiry, got %d", got)
+	}
+	at := time.Now().UnixMilli() + 60000
+	if !s.PExpireAt("k", at) || s.PExpireTime("k") != at {
+		t.Fatalf("expected expiry %d, got %d", at, s.PExpireTime("k"))
+	}
+	// 过去的时间点直接删除键
+	if !s.PExpireAt("k", 1) || s.Exists("k") {
+		t.Fatal("expected key to be deleted by a past expiry")
+	}
+	if got := s.PExpireTime("k"); got != -2 {
+		t.Fatalf("expected -2 for missing key, got %d", got)
+	}
+}
+
+func TestSlotIndex(t *testing.T) {
+	s := NewStorage()
+	s.Set("a1", []byte("v"), 0)
+	slot := func(key string) int { return int(key[0] - 'a') }
+	s.EnableSlotIndex(4, slot)
+	s.Set("a2", []byte("v"), 0)
+	s.RPush("b1", []string{"x"})
+	s.Set("a2", []byte("w"), 0)
+	if n := s.CountKeysInSlot(0); n != 2 {
+		t.Fatalf("expected 2 keys in slot 0, got %d", n)
+	}
+	if keys := s.KeysInSlot(0, 1); len(keys) != 1 {
+		t.Fatalf("expected count to limit keys, got %v", keys)
+	}
+	// 删除与清空容器都会移出索引
+	s.Delete("a1")
+	s.LPop("b1", 1)
+	if s.CountKeysInSlot(0) != 1 || s.CountKeysInSlot(1) != 0 {
+		t.Fatalf("unexpected counts %d %d", s.CountKeysInSlot(0), s.CountKeysInSlot(1))
+	}
+	if keys := s.KeysInSlot(0, 10); len(keys) != 1 || keys[0] != "a2" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestStringValueCopyOnWrite(t *testing.T) {
+	s := NewStorage()
+	s.Set("n", []byte("1"), 0)
+	v, _ := s.Get("n")
+	sn := s.Snapshot()
+	defer sn.Release()
+	// 修改替换为新的切片，此前返回的值与快照中的值不变
+	if n, err := s.IncrBy("n", 41); err != nil || n != 42 {
+		t.Fatalf("IncrBy: %d (%v)", n, err)
+	}
+	if string(v) != "1" {
+		t.Fatalf("value returned before INCR changed to %q", v)
+	}
+	sn.Range(func(key string, e *Entry) bool {
+		if key == "n" && string(e.Value) != "1" {
+			t.Fatalf("snapshot value changed to %q", e.Value)
+		}
+		return true
+	})
+	if v, _ := s.Get("n"); string(v) != "42" {
+		t.Fatalf("expected 42, got %q", v)
+	}
+	if got := s.MemoryUsage(); got != 2 {
+		t.Fatalf("expected 2 bytes in use, got %d", got)
+	}
+
+	// 二进制的键和值经快照文件原样保存
+	bin := []byte("a\r\nb\x00\xff")
+	s.Set("k\x00\r\n", bin, 0)
+	var buf bytes.Buffer
+	sn2 := s.Snapshot()
+	defer sn2.Release()
+	if _, err := sn2.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r := NewStorage()
+	if _, err := r.LoadSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := r.Get("k\x00\r\n"); !ok || !bytes.Equal(v, bin) {
+		t.Fatalf("binary value: %q", v)
+	}
+}
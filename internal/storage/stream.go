@@ -0,0 +1,1083 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidStreamID 表示无法解析的 stream ID
+	ErrInvalidStreamID = errors.New("Invalid stream ID specified as stream command argument")
+	// ErrStreamIDTooSmall 表示 XADD 指定的 ID 不大于当前最大 ID
+	ErrStreamIDTooSmall = errors.New("The ID specified in XADD is equal or smaller than the target stream top item")
+	// ErrStreamIDZero 表示 XADD 指定了 0-0
+	ErrStreamIDZero = errors.New("The ID specified in XADD must be greater than 0-0")
+	// ErrBusyGroup 表示消费组已存在
+	ErrBusyGroup = errors.New("BUSYGROUP Consumer Group name already exists")
+	// ErrXGroupKeyMissing 表示 XGROUP 要求键存在
+	ErrXGroupKeyMissing = errors.New("The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// errNoGroup 构造 NOGROUP 错误
+func errNoGroup(key, group string) error {
+	return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, group)
+}
+
+// StreamID 为 stream 条目 ID：毫秒时间戳-序号
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+// MaxStreamID 是可能的最大 ID
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// Less reports whether id sorts before o.
+func (id StreamID) Less(o StreamID) bool {
+	return id.Ms < o.Ms || (id.Ms == o.Ms && id.Seq < o.Seq)
+}
+
+// IsZero reports whether id is 0-0.
+func (id StreamID) IsZero() bool { return id.Ms == 0 && id.Seq == 0 }
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Next returns the smallest ID greater than id; ok is false on overflow.
+func (id StreamID) Next() (StreamID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return StreamID{id.Ms, id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// Prev returns the greatest ID smaller than id; ok is false on underflow.
+func (id StreamID) Prev() (StreamID, bool) {
+	if id.Seq > 0 {
+		return StreamID{id.Ms, id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseStreamID parses "ms-seq" or "ms" (using missingSeq as the sequence).
+func ParseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// XAddID 描述 XADD 的 ID 参数："*" 自动生成、"ms-*" 自动序号或完整 ID
+type XAddID struct {
+	Auto    bool
+	SeqAuto bool
+	ID      StreamID
+}
+
+// ParseXAddID parses the id argument of XADD.
+func ParseXAddID(s string) (XAddID, error) {
+	if s == "*" {
+		return XAddID{Auto: true}, nil
+	}
+	if ms, ok := strings.CutSuffix(s, "-*"); ok {
+		v, err := strconv.ParseUint(ms, 10, 64)
+		if err != nil {
+			return XAddID{}, ErrInvalidStreamID
+		}
+		return XAddID{SeqAuto: true, ID: StreamID{Ms: v}}, nil
+	}
+	id, err := ParseStreamID(s, 0)
+	if err != nil {
+		return XAddID{}, err
+	}
+	return XAddID{ID: id}, nil
+}
+
+// StreamEntry 为 stream 中的一条消息，Fields 为 field/value 交替排列
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// PendingEntry 为 PEL（已投递未确认）中的一条记录
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64 // Unix 毫秒
+	DeliveryCount int64
+}
+
+// Consumer 为消费组中的消费者
+type Consumer struct {
+	Name       string
+	SeenTime   int64
+	ActiveTime int64 // -1 表示从未成功读取
+	pel        map[StreamID]*PendingEntry
+}
+
+// ConsumerGroup 为消费组，pel 汇总所有消费者的待确认条目
+type ConsumerGroup struct {
+	Name        string
+	LastID      StreamID
+	EntriesRead int64 // -1 表示未知
+	pel         map[StreamID]*PendingEntry
+	consumers   map[string]*Consumer
+}
+
+// Stream 为追加型日志；条目按 ID 升序保存在切片中，范围查询通过二分查找完成
+type Stream struct {
+	entries      []StreamEntry
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	groups       map[string]*ConsumerGroup
+}
+
+// NewStream returns an empty stream.
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*ConsumerGroup)}
+}
+
+// Len returns the number of entries.
+func (st *Stream) Len() int { return len(st.entries) }
+
+// LastID returns the last generated ID.
+func (st *Stream) LastID() StreamID { return st.lastID }
+
+// search 返回第一个 ID >= id 的下标
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].ID.Less(id) })
+}
+
+func (st *Stream) lookup(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// Range returns entries with start <= ID <= end (descending when rev), at
+// most count entries (count <= 0 means unlimited).
+func (st *Stream) Range(start, end StreamID, count int, rev bool) []StreamEntry {
+	out := []StreamEntry{}
+	if end.Less(start) {
+		return out
+	}
+	if !rev {
+		for i := st.search(start); i < len(st.entries) && !end.Less(st.entries[i].ID); i++ {
+			if count > 0 && len(out) >= count {
+				break
+			}
+			out = append(out, st.entries[i])
+		}
+		return out
+	}
+	i := st.search(end)
+	if i == len(st.entries) || end.Less(st.entries[i].ID) {
+		i--
+	}
+	for ; i >= 0 && !st.entries[i].ID.Less(start); i-- {
+		if count > 0 && len(out) >= count {
+			break
+		}
+		out = append(out, st.entries[i])
+	}
+	return out
+}
+
+// after 返回 ID 严格大于 id 的条目
+func (st *Stream) after(id StreamID, count int) []StreamEntry {
+	next, ok := id.Next()
+	if !ok {
+		return []StreamEntry{}
+	}
+	return st.Range(next, MaxStreamID, count, false)
+}
+
+func streamEntryBytes(fields []string) int64 {
+	n := int64(16) // ID
+	for _, f := range fields {
+		n += int64(len(f))
+	}
+	return n
+}
+
+// TrimStrategy 表示 XTRIM/XADD 的裁剪方式
+type TrimStrategy int
+
+const (
+	TrimMaxLen TrimStrategy = iota + 1
+	TrimMinID
+)
+
+// XTrimOptions 描述裁剪参数；Approx 对应 "~"，此时 Limit 限制单次删除的条目数
+type XTrimOptions struct {
+	Strategy TrimStrategy
+	MaxLen   int64
+	MinID    StreamID
+	Approx   bool
+	Limit    int64
+}
+
+// trim 删除最旧的条目直至满足条件，返回释放的字节数与删除条数
+func (st *Stream) trim(opts XTrimOptions) (freed int64, removed int64) {
+	n := 0
+	switch opts.Strategy {
+	case TrimMaxLen:
+		if int64(len(st.entries)) > opts.MaxLen {
+			n = len(st.entries) - int(opts.MaxLen)
+		}
+	case TrimMinID:
+		n = st.search(opts.MinID)
+	}
+	if opts.Approx && opts.Limit > 0 && int64(n) > opts.Limit {
+		n = int(opts.Limit)
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	for _, e := range st.entries[:n] {
+		freed += streamEntryBytes(e.Fields)
+	}
+	st.entries = append([]StreamEntry(nil), st.entries[n:]...)
+	return freed, int64(n)
+}
+
+// streamForRead 返回 key 对应的 stream entry（不存在时为 nil）；调用方需持有读锁
+func (s *Storage) streamForRead(key string) (*Entry, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeStream {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// streamForWrite 返回 key 对应的 stream entry（不存在时为 nil）；调用方需持有写锁
+func (s *Storage) streamForWrite(key string, create bool) (*Entry, error) {
+	e := s.lookupWrite(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &Entry{Type: TypeStream, Stream: NewStream()}
+		s.setEntry(key, e)
+		s.touchLocked(key)
+		return e, nil
+	}
+	if e.Type != TypeStream {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// groupForWrite 返回消费组，不存在时返回 NOGROUP；调用方需持有写锁
+func (s *Storage) groupForWrite(key, group string) (*Entry, *ConsumerGroup, error) {
+	e, err := s.streamForWrite(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e == nil {
+		return nil, nil, errNoGroup(key, group)
+	}
+	g, ok := e.Stream.groups[group]
+	if !ok {
+		return nil, nil, errNoGroup(key, group)
+	}
+	return e, g, nil
+}
+
+// XAdd appends an entry and applies optional trimming. ok is false when
+// noMkStream is set and the key does not exist.
+func (s *Storage) XAdd(key string, noMkStream bool, id XAddID, fields []string, trim *XTrimOptions) (StreamID, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if e == nil && noMkStream {
+		return StreamID{}, false, nil
+	}
+	var last StreamID
+	if e != nil {
+		last = e.Stream.lastID
+	}
+	var newID StreamID
+	switch {
+	case id.Auto:
+		ms := uint64(time.Now().UnixMilli())
+		if ms > last.Ms {
+			newID = StreamID{Ms: ms}
+		} else {
+			var ok bool
+			if newID, ok = last.Next(); !ok {
+				return StreamID{}, false, ErrStreamIDTooSmall
+			}
+		}
+	case id.SeqAuto:
+		// 新 stream 的 lastID 为 0-0，因此 "0-*" 得到 0-1
+		switch {
+		case id.ID.Ms > last.Ms:
+			newID = StreamID{Ms: id.ID.Ms}
+		case id.ID.Ms == last.Ms && last.Seq < math.MaxUint64:
+			newID = StreamID{Ms: last.Ms, Seq: last.Seq + 1}
+		default:
+			return StreamID{}, false, ErrStreamIDTooSmall
+		}
+	default:
+		if id.ID.IsZero() {
+			return StreamID{}, false, ErrStreamIDZero
+		}
+		if !last.Less(id.ID) {
+			return StreamID{}, false, ErrStreamIDTooSmall
+		}
+		newID = id.ID
+	}
+	size := streamEntryBytes(fields)
+	if err := s.reserve(size); err != nil {
+		return StreamID{}, false, err
+	}
+	if e == nil {
+		e, _ = s.streamForWrite(key, true)
+	}
+	st := e.Stream
+	st.entries = append(st.entries, StreamEntry{ID: newID, Fields: append([]string(nil), fields...)})
+	st.lastID = newID
+	st.entriesAdded++
+	e.size += size
+	s.totalBytes += size
+	if trim != nil {
+		freed, _ := st.trim(*trim)
+		e.size -= freed
+		s.totalBytes -= freed
+	}
+	s.signalReadyLocked(key)
+	s.serveReadyLocked()
+	return newID, true, nil
+}
+
+// XTrim trims the stream and returns the number of removed entries.
+func (s *Storage) XTrim(key string, opts XTrimOptions) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	freed, removed := e.Stream.trim(opts)
+	e.size -= freed
+	s.totalBytes -= freed
+	return removed, nil
+}
+
+// XLen returns the number of entries in the stream stored at key.
+func (s *Storage) XLen(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.streamForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.Stream.Len(), nil
+}
+
+// XRange returns entries between start and end (inclusive).
+func (s *Storage) XRange(key string, start, end StreamID, count int, rev bool) ([]StreamEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.streamForRead(key)
+	if err != nil || e == nil {
+		return []StreamEntry{}, err
+	}
+	return e.Stream.Range(start, end, count, rev), nil
+}
+
+// XDel deletes entries by ID and returns the number of deleted entries.
+func (s *Storage) XDel(key string, ids []StreamID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	st := e.Stream
+	deleted := 0
+	for _, id := range ids {
+		i := st.search(id)
+		if i >= len(st.entries) || st.entries[i].ID != id {
+			continue
+		}
+		size := streamEntryBytes(st.entries[i].Fields)
+		st.entries = append(st.entries[:i], st.entries[i+1:]...)
+		e.size -= size
+		s.totalBytes -= size
+		if st.maxDeletedID.Less(id) {
+			st.maxDeletedID = id
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// XReadArg 为 XREAD/XREADGROUP 的单个 stream 参数：Latest 对应 "$"，
+// New 对应 XREADGROUP 的 ">"
+type XReadArg struct {
+	Key    string
+	ID     StreamID
+	Latest bool
+	New    bool
+}
+
+// StreamResult 为某个 key 上读到的条目
+type StreamResult struct {
+	Key     string
+	Entries []StreamEntry
+}
+
+// XRead returns entries newer than the given IDs. With timeout >= 0 it blocks
+// until at least one stream has new entries (0 blocks forever); a negative
+// timeout never blocks. A nil result means nothing was read.
+func (s *Storage) XRead(args []XReadArg, count int, timeout time.Duration, cancel <-chan struct{}) ([]StreamResult, error) {
+	// "$" 在调用时解析为当前最大 ID
+	s.mu.RLock()
+	for i := range args {
+		if !args[i].Latest {
+			continue
+		}
+		e, err := s.streamForRead(args[i].Key)
+		if err != nil {
+			s.mu.RUnlock()
+			return nil, err
+		}
+		if e != nil {
+			args[i].ID = e.Stream.lastID
+		}
+		args[i].Latest = false
+	}
+	s.mu.RUnlock()
+
+	keys := make([]string, len(args))
+	for i, a := range args {
+		keys[i] = a.Key
+	}
+	var res []StreamResult
+	_, err := s.blockOn(keys, timeout, cancel, func(string) (bool, error) {
+		res = nil
+		for _, a := range args {
+			e := s.lookupRead(a.Key)
+			if e == nil {
+				continue
+			}
+			if e.Type != TypeStream {
+				return false, ErrWrongType
+			}
+			if entries := e.Stream.after(a.ID, count); len(entries) > 0 {
+				res = append(res, StreamResult{Key: a.Key, Entries: entries})
+			}
+		}
+		return len(res) > 0, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// consumerLocked 返回消费者，不存在时创建；调用方需持有写锁
+func (g *ConsumerGroup) consumerLocked(name string, now int64) (*Consumer, bool) {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &Consumer{Name: name, SeenTime: now, ActiveTime: -1, pel: make(map[StreamID]*PendingEntry)}
+		g.consumers[name] = c
+	}
+	return c, !ok
+}
+
+// sortedPending 返回按 ID 排序的 PEL 条目
+func sortedPending(pel map[StreamID]*PendingEntry) []*PendingEntry {
+	out := make([]*PendingEntry, 0, len(pel))
+	for _, p := range pel {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID.Less(out[j].ID) })
+	return out
+}
+
+// readGroupLocked 为消费者读取一个 stream；调用方需持有写锁
+func (s *Storage) readGroupLocked(e *Entry, g *ConsumerGroup, c *Consumer, a XReadArg, count int, noAck bool, now int64) []StreamEntry {
+	st := e.Stream
+	if !a.New {
+		// 读取消费者自身的待确认历史，已删除的条目以 nil fields 返回
+		out := []StreamEntry{}
+		for _, p := range sortedPending(c.pel) {
+			if !a.ID.Less(p.ID) {
+				continue
+			}
+			if count > 0 && len(out) >= count {
+				break
+			}
+			entry, ok := st.lookup(p.ID)
+			if !ok {
+				entry = StreamEntry{ID: p.ID}
+			}
+			out = append(out, entry)
+		}
+		return out
+	}
+	entries := st.after(g.LastID, count)
+	for _, entry := range entries {
+		g.LastID = entry.ID
+		if g.EntriesRead >= 0 {
+			g.EntriesRead++
+		}
+		if noAck {
+			continue
+		}
+		if p, ok := g.pel[entry.ID]; ok {
+			// 之前已投递给其他消费者（SETID 回退后再次读取）
+			delete(g.consumers[p.Consumer].pel, entry.ID)
+		}
+		p := &PendingEntry{ID: entry.ID, Consumer: c.Name, DeliveryTime: now, DeliveryCount: 1}
+		g.pel[entry.ID] = p
+		c.pel[entry.ID] = p
+	}
+	if len(entries) > 0 {
+		c.ActiveTime = now
+	}
+	return entries
+}
+
+// XReadGroup reads entries on behalf of consumer in group. Blocking only
+// applies when every stream uses ">".
+func (s *Storage) XReadGroup(group, consumer string, args []XReadArg, count int, noAck bool, timeout time.Duration, cancel <-chan struct{}) ([]StreamResult, error) {
+	keys := make([]string, len(args))
+	blockable := true
+	for i, a := range args {
+		keys[i] = a.Key
+		if !a.New {
+			blockable = false
+		}
+	}
+	if !blockable {
+		timeout = -1
+	}
+	var res []StreamResult
+	_, err := s.blockOn(keys, timeout, cancel, func(string) (bool, error) {
+		res = nil
+		now := time.Now().UnixMilli()
+		for _, a := range args {
+			e, g, err := s.groupForWrite(a.Key, group)
+			if err != nil {
+				return false, err
+			}
+			c, _ := g.consumerLocked(consumer, now)
+			c.SeenTime = now
+			entries := s.readGroupLocked(e, g, c, a, count, noAck, now)
+			if len(entries) > 0 || !a.New {
+				res = append(res, StreamResult{Key: a.Key, Entries: entries})
+			}
+		}
+		return len(res) > 0, nil
+	}, func() []string {
+		// 阻塞的 XREADGROUP 只读取新条目，在相同的数据上重放结果相同
+		cmd := []string{"XREADGROUP", "GROUP", group, consumer}
+		if count > 0 {
+			cmd = append(cmd, "COUNT", strconv.Itoa(count))
+		}
+		if noAck {
+			cmd = append(cmd, "NOACK")
+		}
+		cmd = append(cmd, "STREAMS")
+		cmd = append(cmd, keys...)
+		for range keys {
+			cmd = append(cmd, ">")
+		}
+		return cmd
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// XGroupCreate creates a consumer group starting after id (or after the last
+// entry when latest). entriesRead < 0 means unknown.
+func (s *Storage) XGroupCreate(key, group string, id StreamID, latest, mkStream bool, entriesRead int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		if !mkStream {
+			return ErrXGroupKeyMissing
+		}
+		e, _ = s.streamForWrite(key, true)
+	}
+	if _, ok := e.Stream.groups[group]; ok {
+		return ErrBusyGroup
+	}
+	if latest {
+		id = e.Stream.lastID
+	}
+	e.Stream.groups[group] = &ConsumerGroup{
+		Name:        group,
+		LastID:      id,
+		EntriesRead: entriesRead,
+		pel:         make(map[StreamID]*PendingEntry),
+		consumers:   make(map[string]*Consumer),
+	}
+	return nil
+}
+
+// XGroupSetID sets the last delivered ID of a group.
+func (s *Storage) XGroupSetID(key, group string, id StreamID, latest bool, entriesRead int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return err
+	}
+	if latest {
+		id = e.Stream.lastID
+	}
+	g.LastID = id
+	g.EntriesRead = entriesRead
+	return nil
+}
+
+// XGroupDestroy removes a consumer group. Returns false if it did not exist.
+func (s *Storage) XGroupDestroy(key, group string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil {
+		return false, err
+	}
+	if e == nil {
+		return false, ErrXGroupKeyMissing
+	}
+	if _, ok := e.Stream.groups[group]; !ok {
+		return false, nil
+	}
+	delete(e.Stream.groups, group)
+	return true, nil
+}
+
+// XGroupCreateConsumer creates a consumer; returns false if it already existed.
+func (s *Storage) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return false, err
+	}
+	_, created := g.consumerLocked(consumer, time.Now().UnixMilli())
+	return created, nil
+}
+
+// XGroupDelConsumer removes a consumer and its pending entries, returning
+// the number of pending entries it owned.
+func (s *Storage) XGroupDelConsumer(key, group, consumer string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return 0, err
+	}
+	c, ok := g.consumers[consumer]
+	if !ok {
+		return 0, nil
+	}
+	for id := range c.pel {
+		delete(g.pel, id)
+	}
+	delete(g.consumers, consumer)
+	return len(c.pel), nil
+}
+
+// XAck acknowledges ids and returns the number of entries removed from the PEL.
+func (s *Storage) XAck(key, group string, ids []StreamID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.streamForWrite(key, false)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	g, ok := e.Stream.groups[group]
+	if !ok {
+		return 0, nil
+	}
+	acked := 0
+	for _, id := range ids {
+		p, ok := g.pel[id]
+		if !ok {
+			continue
+		}
+		delete(g.pel, id)
+		if c, ok := g.consumers[p.Consumer]; ok {
+			delete(c.pel, id)
+		}
+		acked++
+	}
+	return acked, nil
+}
+
+// PendingSummary 为 XPENDING 的汇总形式
+type PendingSummary struct {
+	Count     int
+	Min, Max  StreamID
+	Consumers []ConsumerPending
+}
+
+// ConsumerPending 为某消费者的待确认数
+type ConsumerPending struct {
+	Name  string
+	Count int
+}
+
+// PendingInfo 为 XPENDING 扩展形式中的一行
+type PendingInfo struct {
+	ID            StreamID
+	Consumer      string
+	Idle          int64
+	DeliveryCount int64
+}
+
+// XPendingSummary returns the summary form of XPENDING.
+func (s *Storage) XPendingSummary(key, group string) (PendingSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+	sum := PendingSummary{Count: len(g.pel)}
+	if sum.Count == 0 {
+		return sum, nil
+	}
+	sorted := sortedPending(g.pel)
+	sum.Min, sum.Max = sorted[0].ID, sorted[len(sorted)-1].ID
+	names := make([]string, 0, len(g.consumers))
+	for name, c := range g.consumers {
+		if len(c.pel) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum.Consumers = append(sum.Consumers, ConsumerPending{Name: name, Count: len(g.consumers[name].pel)})
+	}
+	return sum, nil
+}
+
+// XPendingRange returns the extended form of XPENDING. consumer may be empty
+// to include all consumers.
+func (s *Storage) XPendingRange(key, group string, minIdle int64, start, end StreamID, count int, consumer string) ([]PendingInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return nil, err
+	}
+	pel := g.pel
+	if consumer != "" {
+		c, ok := g.consumers[consumer]
+		if !ok {
+			return []PendingInfo{}, nil
+		}
+		pel = c.pel
+	}
+	now := time.Now().UnixMilli()
+	out := []PendingInfo{}
+	for _, p := range sortedPending(pel) {
+		if p.ID.Less(start) || end.Less(p.ID) {
+			continue
+		}
+		if len(out) >= count {
+			break
+		}
+		idle := now - p.DeliveryTime
+		if idle < minIdle {
+			continue
+		}
+		out = append(out, PendingInfo{ID: p.ID, Consumer: p.Consumer, Idle: idle, DeliveryCount: p.DeliveryCount})
+	}
+	return out, nil
+}
+
+// XClaimOptions 对应 XCLAIM 的可选参数；Idle/Time/RetryCount 为 -1 表示未指定
+type XClaimOptions struct {
+	Idle       int64
+	Time       int64
+	RetryCount int64
+	Force      bool
+	JustID     bool
+	LastID     *StreamID
+}
+
+// claimLocked 将 PEL 条目转移给消费者；调用方需持有写锁
+func claimLocked(g *ConsumerGroup, c *Consumer, p *PendingEntry, now int64, opts XClaimOptions) {
+	if old, ok := g.consumers[p.Consumer]; ok {
+		delete(old.pel, p.ID)
+	}
+	p.Consumer = c.Name
+	c.pel[p.ID] = p
+	switch {
+	case opts.Idle >= 0:
+		p.DeliveryTime = now - opts.Idle
+	case opts.Time >= 0:
+		p.DeliveryTime = opts.Time
+	default:
+		p.DeliveryTime = now
+	}
+	if opts.RetryCount >= 0 {
+		p.DeliveryCount = opts.RetryCount
+	} else if !opts.JustID {
+		p.DeliveryCount++
+	}
+	c.ActiveTime = now
+}
+
+// XClaim changes ownership of pending entries idle for at least minIdle
+// milliseconds and returns the claimed entries (only IDs when JustID).
+func (s *Storage) XClaim(key, group, consumer string, minIdle int64, ids []StreamID, opts XClaimOptions) ([]StreamEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	if opts.LastID != nil && g.LastID.Less(*opts.LastID) {
+		g.LastID = *opts.LastID
+	}
+	c, _ := g.consumerLocked(consumer, now)
+	c.SeenTime = now
+	out := []StreamEntry{}
+	for _, id := range ids {
+		entry, exists := e.Stream.lookup(id)
+		p, pending := g.pel[id]
+		if !pending {
+			if !opts.Force || !exists {
+				continue
+			}
+			p = &PendingEntry{ID: id, Consumer: c.Name, DeliveryTime: now}
+			g.pel[id] = p
+		}
+		if !exists {
+			// 条目已被删除：从 PEL 中移除
+			delete(g.pel, id)
+			if old, ok := g.consumers[p.Consumer]; ok {
+				delete(old.pel, id)
+			}
+			continue
+		}
+		if minIdle > 0 && now-p.DeliveryTime < minIdle {
+			continue
+		}
+		claimLocked(g, c, p, now, opts)
+		if opts.JustID {
+			entry = StreamEntry{ID: id}
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// XAutoClaim scans the PEL from start and claims up to count entries idle for
+// at least minIdle milliseconds. It returns the cursor for the next call (0-0
+// when the scan is complete), the claimed entries and the IDs of pending
+// entries that no longer exist in the stream.
+func (s *Storage) XAutoClaim(key, group, consumer string, minIdle int64, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+	now := time.Now().UnixMilli()
+	c, _ := g.consumerLocked(consumer, now)
+	c.SeenTime = now
+	opts := XClaimOptions{Idle: -1, Time: -1, RetryCount: -1, JustID: justID}
+	claimed := []StreamEntry{}
+	deleted := []StreamID{}
+	// 与 Redis 一致：单次最多扫描 count*10 个 PEL 条目
+	attempts := count * 10
+	next := StreamID{}
+	for _, p := range sortedPending(g.pel) {
+		if p.ID.Less(start) {
+			continue
+		}
+		if attempts == 0 || len(claimed) >= count {
+			next = p.ID
+			break
+		}
+		attempts--
+		entry, exists := e.Stream.lookup(p.ID)
+		if !exists {
+			delete(g.pel, p.ID)
+			if old, ok := g.consumers[p.Consumer]; ok {
+				delete(old.pel, p.ID)
+			}
+			deleted = append(deleted, p.ID)
+			continue
+		}
+		if minIdle > 0 && now-p.DeliveryTime < minIdle {
+			continue
+		}
+		claimLocked(g, c, p, now, opts)
+		if justID {
+			entry = StreamEntry{ID: p.ID}
+		}
+		claimed = append(claimed, entry)
+	}
+	return next, claimed, deleted, nil
+}
+
+// StreamInfo 为 XINFO STREAM 的结果
+type StreamInfo struct {
+	Length          int
+	LastGeneratedID StreamID
+	MaxDeletedID    StreamID
+	EntriesAdded    uint64
+	FirstID         StreamID
+	Groups          int
+	First, Last     *StreamEntry
+}
+
+// GroupInfo 为 XINFO GROUPS 中的一项；Lag 为 -1 表示无法计算
+type GroupInfo struct {
+	Name        string
+	Consumers   int
+	Pending     int
+	LastID      StreamID
+	EntriesRead int64
+	Lag         int64
+}
+
+// ConsumerInfo 为 XINFO CONSUMERS 中的一项
+type ConsumerInfo struct {
+	Name     string
+	Pending  int
+	Idle     int64
+	Inactive int64
+}
+
+// XInfoStream returns general information about a stream. ok is false when
+// the key does not exist.
+func (s *Storage) XInfoStream(key string) (StreamInfo, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.streamForRead(key)
+	if err != nil || e == nil {
+		return StreamInfo{}, false, err
+	}
+	st := e.Stream
+	info := StreamInfo{
+		Length:          st.Len(),
+		LastGeneratedID: st.lastID,
+		MaxDeletedID:    st.maxDeletedID,
+		EntriesAdded:    st.entriesAdded,
+		Groups:          len(st.groups),
+	}
+	if st.Len() > 0 {
+		first, last := st.entries[0], st.entries[st.Len()-1]
+		info.First, info.Last = &first, &last
+		info.FirstID = first.ID
+	}
+	return info, true, nil
+}
+
+// lag 计算消费组落后的条目数；存在无法确定的删除时返回 -1
+func (st *Stream) lag(g *ConsumerGroup) int64 {
+	if st.Len() == 0 {
+		return 0
+	}
+	if g.EntriesRead >= 0 && (st.maxDeletedID.IsZero() || st.maxDeletedID.Less(g.LastID)) {
+		return int64(st.entriesAdded) - g.EntriesRead
+	}
+	return -1
+}
+
+// XInfoGroups returns information about the consumer groups of a stream.
+func (s *Storage) XInfoGroups(key string) ([]GroupInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.streamForRead(key)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrNoSuchKey
+	}
+	names := make([]string, 0, len(e.Stream.groups))
+	for name := range e.Stream.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]GroupInfo, 0, len(names))
+	for _, name := range names {
+		g := e.Stream.groups[name]
+		out = append(out, GroupInfo{
+			Name:        name,
+			Consumers:   len(g.consumers),
+			Pending:     len(g.pel),
+			LastID:      g.LastID,
+			EntriesRead: g.EntriesRead,
+			Lag:         e.Stream.lag(g),
+		})
+	}
+	return out, nil
+}
+
+// XInfoConsumers returns information about the consumers of a group.
+func (s *Storage) XInfoConsumers(key, group string) ([]ConsumerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, g, err := s.groupForWrite(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	names := make([]string, 0, len(g.consumers))
+	for name := range g.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]ConsumerInfo, 0, len(names))
+	for _, name := range names {
+		c := g.consumers[name]
+		inactive := int64(-1)
+		if c.ActiveTime >= 0 {
+			inactive = now - c.ActiveTime
+		}
+		out = append(out, ConsumerInfo{Name: name, Pending: len(c.pel), Idle: now - c.SeenTime, Inactive: inactive})
+	}
+	return out, nil
+}
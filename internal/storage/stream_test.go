@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustXAdd(t *testing.T, s *Storage, key, id string, fields ...string) StreamID {
+	t.Helper()
+	spec, err := ParseXAddID(id)
+	if err != nil {
+		t.Fatalf("parse %s: %v", id, err)
+	}
+	got, _, err := s.XAdd(key, false, spec, fields, nil)
+	if err != nil {
+		t.Fatalf("XADD %s: %v", id, err)
+	}
+	return got
+}
+
+func TestXAddIDs(t *testing.T) {
+	s := NewStorage()
+	if id := mustXAdd(t, s, "s", "0-*", "f", "v"); id != (StreamID{0, 1}) {
+		t.Fatalf("expected 0-1, got %s", id)
+	}
+	mustXAdd(t, s, "s", "5-3", "f", "v")
+	if id := mustXAdd(t, s, "s", "5-*", "f", "v"); id != (StreamID{5, 4}) {
+		t.Fatalf("expected 5-4, got %s", id)
+	}
+	if _, _, err := s.XAdd("s", false, XAddID{ID: StreamID{5, 4}}, []string{"f", "v"}, nil); !errors.Is(err, ErrStreamIDTooSmall) {
+		t.Fatalf("expected ErrStreamIDTooSmall, got %v", err)
+	}
+	if _, _, err := s.XAdd("new", false, XAddID{}, []string{"f", "v"}, nil); !errors.Is(err, ErrStreamIDZero) {
+		t.Fatalf("expected ErrStreamIDZero, got %v", err)
+	}
+	auto := mustXAdd(t, s, "s", "*", "f", "v")
+	if !(StreamID{5, 4}).Less(auto) {
+		t.Fatalf("auto ID %s should be greater than 5-4", auto)
+	}
+	if _, ok, _ := s.XAdd("missing", true, XAddID{Auto: true}, []string{"f", "v"}, nil); ok {
+		t.Fatal("NOMKSTREAM should not create the key")
+	}
+}
+
+func TestXRangeTrimAndDelete(t *testing.T) {
+	s := NewStorage()
+	for i := 1; i <= 5; i++ {
+		s.XAdd("s", false, XAddID{ID: StreamID{uint64(i), 0}}, []string{"n", "x"}, nil)
+	}
+	got, _ := s.XRange("s", StreamID{2, 0}, StreamID{4, 0}, 0, false)
+	if len(got) != 3 || got[0].ID.Ms != 2 {
+		t.Fatalf("unexpected range %v", got)
+	}
+	got, _ = s.XRange("s", StreamID{}, MaxStreamID, 2, true)
+	if len(got) != 2 || got[0].ID.Ms != 5 || got[1].ID.Ms != 4 {
+		t.Fatalf("unexpected reverse range %v", got)
+	}
+	if n, _ := s.XDel("s", []StreamID{{3, 0}, {9, 0}}); n != 1 {
+		t.Fatalf("expected 1 deleted, got %d", n)
+	}
+	if n, _ := s.XTrim("s", XTrimOptions{Strategy: TrimMaxLen, MaxLen: 2}); n != 2 {
+		t.Fatalf("expected 2 trimmed, got %d", n)
+	}
+	if n, _ := s.XTrim("s", XTrimOptions{Strategy: TrimMinID, MinID: StreamID{5, 0}}); n != 1 {
+		t.Fatalf("expected 1 trimmed by MINID, got %d", n)
+	}
+	info, _, _ := s.XInfoStream("s")
+	if info.Length != 1 || info.EntriesAdded != 5 || info.MaxDeletedID != (StreamID{3, 0}) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	// 裁剪后占用的内存应只剩一条记录
+	if s.totalBytes != streamEntryBytes([]string{"n", "x"}) {
+		t.Fatalf("unexpected totalBytes %d", s.totalBytes)
+	}
+}
+
+func TestXReadBlocksUntilXAdd(t *testing.T) {
+	s := NewStorage()
+	mustXAdd(t, s, "s", "1-0", "a", "1")
+	done := make(chan []StreamResult, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			res, _ := s.XRead([]XReadArg{{Key: "s", Latest: true}}, 0, time.Second, nil)
+			done <- res
+		}()
+	}
+	waitBlocked(t, s, 2)
+	mustXAdd(t, s, "s", "2-0", "b", "2")
+	// XREAD 不消费数据，所有等待者都应收到新条目
+	for i := 0; i < 2; i++ {
+		res := <-done
+		if len(res) != 1 || len(res[0].Entries) != 1 || res[0].Entries[0].ID != (StreamID{2, 0}) {
+			t.Fatalf("unexpected XREAD result %+v", res)
+		}
+	}
+	res, _ := s.XRead([]XReadArg{{Key: "s", ID: StreamID{2, 0}}}, 0, 10*time.Millisecond, nil)
+	if res != nil {
+		t.Fatalf("expected timeout, got %+v", res)
+	}
+}
+
+func TestConsumerGroupLifecycle(t *testing.T) {
+	s := NewStorage()
+	if err := s.XGroupCreate("s", "g", StreamID{}, false, false, -1); !errors.Is(err, ErrXGroupKeyMissing) {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+	if err := s.XGroupCreate("s", "g", StreamID{}, false, true, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.XGroupCreate("s", "g", StreamID{}, false, false, -1); !errors.Is(err, ErrBusyGroup) {
+		t.Fatalf("expected BUSYGROUP, got %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		s.XAdd("s", false, XAddID{ID: StreamID{uint64(i), 0}}, []string{"k", "v"}, nil)
+	}
+	res, err := s.XReadGroup("g", "alice", []XReadArg{{Key: "s", New: true}}, 2, false, -1, nil)
+	if err != nil || len(res) != 1 || len(res[0].Entries) != 2 {
+		t.Fatalf("unexpected XREADGROUP result %+v, %v", res, err)
+	}
+	res, _ = s.XReadGroup("g", "bob", []XReadArg{{Key: "s", New: true}}, 0, false, -1, nil)
+	if len(res[0].Entries) != 1 || res[0].Entries[0].ID != (StreamID{3, 0}) {
+		t.Fatalf("bob should get the remaining entry, got %+v", res)
+	}
+	sum, _ := s.XPendingSummary("s", "g")
+	if sum.Count != 3 || sum.Min != (StreamID{1, 0}) || len(sum.Consumers) != 2 || sum.Consumers[0].Count != 2 {
+		t.Fatalf("unexpected pending summary %+v", sum)
+	}
+	// 读取 alice 的历史
+	res, _ = s.XReadGroup("g", "alice", []XReadArg{{Key: "s"}}, 0, false, -1, nil)
+	if len(res[0].Entries) != 2 {
+		t.Fatalf("expected alice history of 2, got %+v", res)
+	}
+	if n, _ := s.XAck("s", "g", []StreamID{{1, 0}, {1, 0}, {9, 0}}); n != 1 {
+		t.Fatalf("expected 1 acked, got %d", n)
+	}
+	// bob 认领 alice 的 2-0
+	claimed, _ := s.XClaim("s", "g", "bob", 0, []StreamID{{2, 0}}, XClaimOptions{Idle: -1, Time: -1, RetryCount: -1})
+	if len(claimed) != 1 {
+		t.Fatalf("expected 1 claimed, got %+v", claimed)
+	}
+	infos, _ := s.XPendingRange("s", "g", 0, StreamID{}, MaxStreamID, 10, "bob")
+	if len(infos) != 2 || infos[0].ID != (StreamID{2, 0}) || infos[0].DeliveryCount != 2 {
+		t.Fatalf("unexpected bob pending %+v", infos)
+	}
+	// 删除条目后 XAUTOCLAIM 清理 PEL 并报告被删除的 ID
+	s.XDel("s", []StreamID{{3, 0}})
+	next, got, deleted, _ := s.XAutoClaim("s", "g", "carol", 0, StreamID{}, 10, false)
+	if !next.IsZero() || len(got) != 1 || len(deleted) != 1 || deleted[0] != (StreamID{3, 0}) {
+		t.Fatalf("unexpected XAUTOCLAIM result %s %+v %+v", next, got, deleted)
+	}
+	if n, _ := s.XGroupDelConsumer("s", "g", "carol"); n != 1 {
+		t.Fatalf("expected carol to own 1 pending entry, got %d", n)
+	}
+	if _, err := s.XReadGroup("nope", "c", []XReadArg{{Key: "s", New: true}}, 0, false, -1, nil); err == nil {
+		t.Fatal("expected NOGROUP error")
+	}
+}
+
+func TestXReadGroupBlockingServesOneConsumer(t *testing.T) {
+	s := NewStorage()
+	s.XGroupCreate("s", "g", StreamID{}, false, true, -1)
+	type result struct {
+		name string
+		res  []StreamResult
+	}
+	done := make(chan result, 3)
+	for i, name := range []string{"c1", "c2"} {
+		name := name
+		go func() {
+			res, _ := s.XReadGroup("g", name, []XReadArg{{Key: "s", New: true}}, 0, false, 200*time.Millisecond, nil)
+			done <- result{name, res}
+		}()
+		waitBlocked(t, s, i+1)
+	}
+	// 同组之外的 XREAD 排在后面，仍应被唤醒
+	go func() {
+		res, _ := s.XRead([]XReadArg{{Key: "s", Latest: true}}, 0, time.Second, nil)
+		done <- result{"reader", res}
+	}()
+	waitBlocked(t, s, 3)
+	mustXAdd(t, s, "s", "1-0", "k", "v")
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		r := <-done
+		got[r.name] = r.res != nil
+	}
+	if !got["c1"] || got["c2"] || !got["reader"] {
+		t.Fatalf("expected c1 and reader served, c2 timed out: %v", got)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import "time"
+
+// watchedKey 记录被 WATCH 的键的版本号；refs 为正在监视该键的 WATCH 数量
+type watchedKey struct {
+	refs    int
+	version uint64
+}
+
+// WatchToken 记录 WATCH 时键的状态，供 EXEC 前检查键是否被修改或已过期
+type WatchToken struct {
+	Key     string
+	version uint64
+	live    bool
+}
+
+// touchLocked 记录一次对 key 的修改：累加修改次数，并递增键的版本号使监视该键
+// 的事务在 EXEC 时中止。只为被 WATCH 的键维护版本号；写路径通过 lookupWrite
+// 取键时即视为修改（可能偶尔误判为已修改，但不会漏判）。调用方需持有写锁。
+func (s *Storage) touchLocked(key string) {
+	s.changes++
+	if w := s.watched[key]; w != nil {
+		w.version++
+	}
+}
+
+// Exclusive runs fn while no other command executes (used by EXEC); commands
+// run through Shared, as well as the initial attempt of blocking commands,
+// wait until fn returns. Blocked clients whose keys became ready during fn
+// are served once fn returns, so they never observe a partial transaction.
+// fn must not call Shared or Exclusive.
+func (s *Storage) Exclusive(fn func()) {
+	s.gate.Lock()
+	defer s.gate.Unlock()
+	s.mu.Lock()
+	s.exclusive = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.exclusive = false
+		s.serveReadyLocked()
+		s.mu.Unlock()
+	}()
+	fn()
+}
+
+// Shared runs fn as a single command that may execute concurrently with
+// other commands but never inside an Exclusive section.
+func (s *Storage) Shared(fn func()) {
+	s.gate.RLock()
+	defer s.gate.RUnlock()
+	fn()
+}
+
+// Watch starts watching key and returns a token describing its current
+// state. Every token must be released with Unwatch.
+func (s *Storage) Watch(key string) WatchToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watched == nil {
+		s.watched = make(map[string]*watchedKey)
+	}
+	w := s.watched[key]
+	if w == nil {
+		w = &watchedKey{}
+		s.watched[key] = w
+	}
+	w.refs++
+	return WatchToken{Key: key, version: w.version, live: s.lookupRead(key) != nil}
+}
+
+// Unwatch releases tokens obtained from Watch.
+func (s *Storage) Unwatch(tokens []WatchToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tokens {
+		w := s.watched[t.Key]
+		if w == nil {
+			continue
+		}
+		if w.refs--; w.refs == 0 {
+			delete(s.watched, t.Key)
+		}
+	}
+}
+
+// Touched reports whether any watched key was modified since WATCH, or
+// expired after having been live at WATCH time.
+func (s *Storage) Touched(tokens []WatchToken) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now().UnixMilli()
+	for _, t := range tokens {
+		if w := s.watched[t.Key]; w == nil || w.version != t.version {
+			return true
+		}
+		if t.live {
+			if e, ok := s.data[t.Key]; !ok || e.expired(now) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package storage
+
+import "testing"
+
+func TestWatchVersions(t *testing.T) {
+	s := NewStorage()
+	s.Set("k", []byte("v"), 0)
+	tok := []WatchToken{s.Watch("k"), s.Watch("missing")}
+	if s.Touched(tok) {
+		t.Fatal("untouched keys reported as modified")
+	}
+	// 读取不影响版本号
+	s.Get("k")
+	s.HGet("k", "f")
+	if s.Touched(tok) {
+		t.Fatal("reads should not touch watched keys")
+	}
+	// 创建此前不存在的键
+	s.LPush("missing", []string{"a"})
+	if !s.Touched(tok[1:]) {
+		t.Fatal("creating a watched key should touch it")
+	}
+	if s.Touched(tok[:1]) {
+		t.Fatal("unrelated write touched k")
+	}
+	s.Expire("k", 100)
+	if !s.Touched(tok[:1]) {
+		t.Fatal("EXPIRE should touch the key")
+	}
+	s.Unwatch(tok)
+	if len(s.watched) != 0 {
+		t.Fatalf("expected watch table to be empty, got %v", s.watched)
+	}
+}
+
+func TestWatchSharedByClients(t *testing.T) {
+	s := NewStorage()
+	a := []WatchToken{s.Watch("k")}
+	s.Set("k", []byte("1"), 0)
+	b := []WatchToken{s.Watch("k")}
+	if !s.Touched(a) || s.Touched(b) {
+		t.Fatal("each token should compare against the version at its own WATCH")
+	}
+	s.Unwatch(a)
+	s.Delete("k")
+	if !s.Touched(b) {
+		t.Fatal("DEL should touch the key for remaining watchers")
+	}
+}
@@ -0,0 +1,715 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrScoreNaN 表示运算结果分值为 NaN
+var ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// ZMember 是有序集合中的一个元素
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange 表示分值区间，MinEx/MaxEx 为 true 时对应端点为开区间
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+func (r ScoreRange) gteMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) lteMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// LexBound 表示字典序区间端点；Inf 为 -1/+1 时分别对应 "-" 与 "+"
+type LexBound struct {
+	Value     string
+	Inclusive bool
+	Inf       int
+}
+
+// LexRange 表示字典序区间（要求集合内元素分值相同）
+type LexRange struct {
+	Min, Max LexBound
+}
+
+func (r LexRange) gteMin(m string) bool {
+	switch r.Min.Inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if r.Min.Inclusive {
+		return m >= r.Min.Value
+	}
+	return m > r.Min.Value
+}
+
+func (r LexRange) lteMax(m string) bool {
+	switch r.Max.Inf {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	if r.Max.Inclusive {
+		return m <= r.Max.Value
+	}
+	return m < r.Max.Value
+}
+
+// ZSet 为有序集合：dict 提供 O(1) 的分值查询，skiplist 提供 O(log n) 的有序访问
+type ZSet struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+// NewZSet returns an empty sorted set.
+func NewZSet() *ZSet {
+	return &ZSet{dict: make(map[string]float64), zsl: newSkiplist()}
+}
+
+// Len returns the number of members.
+func (z *ZSet) Len() int { return len(z.dict) }
+
+// Score returns the score of member.
+func (z *ZSet) Score(member string) (float64, bool) {
+	s, ok := z.dict[member]
+	return s, ok
+}
+
+// set 插入或更新元素，返回是否为新元素
+func (z *ZSet) set(member string, score float64) bool {
+	if cur, ok := z.dict[member]; ok {
+		if cur != score {
+			z.zsl.delete(cur, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+func (z *ZSet) remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0-based rank of member (descending when rev).
+func (z *ZSet) Rank(member string, rev bool) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	r := z.zsl.rank(score, member)
+	if rev {
+		return z.zsl.length - r, true
+	}
+	return r - 1, true
+}
+
+// RangeByRank returns members with ranks in [start, stop] (Redis-style indexes).
+func (z *ZSet) RangeByRank(start, stop int, rev bool) []ZMember {
+	start, stop, ok := normalizeRange(start, stop, z.Len())
+	if !ok {
+		return []ZMember{}
+	}
+	out := make([]ZMember, 0, stop-start+1)
+	var x *zslNode
+	if rev {
+		x = z.zsl.byRank(z.zsl.length - start)
+	} else {
+		x = z.zsl.byRank(start + 1)
+	}
+	for n := stop - start + 1; n > 0 && x != nil; n-- {
+		out = append(out, ZMember{Member: x.member, Score: x.score})
+		if rev {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return out
+}
+
+// rangeNodes 从区间端点出发，跳过 offset 个元素后收集至多 count 个（count < 0 表示不限）。
+// 借助排名跳转，offset 的开销为 O(log n)。
+func (z *ZSet) rangeNodes(first, last *zslNode, inMin, inMax func(*zslNode) bool, rev bool, offset, count int) []ZMember {
+	out := []ZMember{}
+	x := first
+	if rev {
+		x = last
+	}
+	if x == nil || offset < 0 {
+		return out
+	}
+	if offset > 0 {
+		r := z.zsl.rank(x.score, x.member)
+		if rev {
+			r -= offset
+		} else {
+			r += offset
+		}
+		if r < 1 || r > z.zsl.length {
+			return out
+		}
+		x = z.zsl.byRank(r)
+	}
+	for x != nil && count != 0 {
+		if rev && !inMin(x) || !rev && !inMax(x) {
+			break
+		}
+		out = append(out, ZMember{Member: x.member, Score: x.score})
+		count--
+		if rev {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return out
+}
+
+func (z *ZSet) scoreBounds(r ScoreRange) (first, last *zslNode) {
+	first = z.zsl.firstMatch(func(n *zslNode) bool { return r.gteMin(n.score) })
+	if first != nil && !r.lteMax(first.score) {
+		first = nil
+	}
+	last = z.zsl.lastMatch(func(n *zslNode) bool { return r.lteMax(n.score) })
+	if last != nil && !r.gteMin(last.score) {
+		last = nil
+	}
+	return first, last
+}
+
+func (z *ZSet) lexBounds(r LexRange) (first, last *zslNode) {
+	first = z.zsl.firstMatch(func(n *zslNode) bool { return r.gteMin(n.member) })
+	if first != nil && !r.lteMax(first.member) {
+		first = nil
+	}
+	last = z.zsl.lastMatch(func(n *zslNode) bool { return r.lteMax(n.member) })
+	if last != nil && !r.gteMin(last.member) {
+		last = nil
+	}
+	return first, last
+}
+
+// RangeByScore returns members within r in O(log n + m).
+func (z *ZSet) RangeByScore(r ScoreRange, rev bool, offset, count int) []ZMember {
+	first, last := z.scoreBounds(r)
+	return z.rangeNodes(first, last,
+		func(n *zslNode) bool { return r.gteMin(n.score) },
+		func(n *zslNode) bool { return r.lteMax(n.score) }, rev, offset, count)
+}
+
+// RangeByLex returns members within the lexicographic range r.
+func (z *ZSet) RangeByLex(r LexRange, rev bool, offset, count int) []ZMember {
+	first, last := z.lexBounds(r)
+	return z.rangeNodes(first, last,
+		func(n *zslNode) bool { return r.gteMin(n.member) },
+		func(n *zslNode) bool { return r.lteMax(n.member) }, rev, offset, count)
+}
+
+// countBetween 通过排名差在 O(log n) 内统计区间元素数
+func (z *ZSet) countBetween(first, last *zslNode) int {
+	if first == nil || last == nil {
+		return 0
+	}
+	n := z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// ZAddFlags 对应 ZADD 的 NX/XX/GT/LT 选项
+type ZAddFlags struct {
+	NX, XX, GT, LT bool
+}
+
+// RangeBy 表示 ZRANGE 的区间类型
+type RangeBy int
+
+const (
+	ByRank RangeBy = iota
+	ByScore
+	ByLex
+)
+
+// ZRangeSpec 描述统一的 ZRANGE 查询
+type ZRangeSpec struct {
+	By          RangeBy
+	Start, Stop int // ByRank
+	Score       ScoreRange
+	Lex         LexRange
+	Rev         bool
+	Offset      int
+	Count       int // < 0 表示不限
+}
+
+func (z *ZSet) query(spec ZRangeSpec) []ZMember {
+	switch spec.By {
+	case ByScore:
+		return z.RangeByScore(spec.Score, spec.Rev, spec.Offset, spec.Count)
+	case ByLex:
+		return z.RangeByLex(spec.Lex, spec.Rev, spec.Offset, spec.Count)
+	}
+	return z.RangeByRank(spec.Start, spec.Stop, spec.Rev)
+}
+
+const zsetMemberOverhead = 8 // 每个元素的分值占用
+
+// zsetForRead 返回 key 对应的 zset entry（不存在时为 nil）；调用方需持有读锁
+func (s *Storage) zsetForRead(key string) (*Entry, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeZSet {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// zsetForWrite 返回 key 对应的 zset entry（不存在时为 nil）；调用方需持有写锁
+func (s *Storage) zsetForWrite(key string) (*Entry, error) {
+	e := s.lookupWrite(key)
+	if e == nil {
+		return nil, nil
+	}
+	if e.Type != TypeZSet {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+// zsetSetLocked 写入单个元素并维护内存计数，必要时创建键；调用方需持有写锁
+func (s *Storage) zsetSetLocked(key string, e *Entry, member string, score float64) (*Entry, bool) {
+	if e == nil {
+		e = &Entry{Type: TypeZSet, ZSet: NewZSet()}
+		s.setEntry(key, e)
+		s.touchLocked(key)
+	}
+	added := e.ZSet.set(member, score)
+	if added {
+		delta := int64(len(member) + zsetMemberOverhead)
+		e.size += delta
+		s.totalBytes += delta
+		s.signalReadyLocked(key)
+	}
+	return e, added
+}
+
+// zsetRemoveLocked 删除元素，集合为空时删除键；调用方需持有写锁
+func (s *Storage) zsetRemoveLocked(key string, e *Entry, member string) bool {
+	if !e.ZSet.remove(member) {
+		return false
+	}
+	delta := int64(len(member) + zsetMemberOverhead)
+	e.size -= delta
+	s.totalBytes -= delta
+	if e.ZSet.Len() == 0 {
+		s.removeEntry(key, e)
+	}
+	return true
+}
+
+func zsetBytes(members []ZMember) int64 {
+	var n int64
+	for _, m := range members {
+		n += int64(len(m.Member) + zsetMemberOverhead)
+	}
+	return n
+}
+
+// ZAdd adds or updates members according to flags. It returns the number of
+// added members and the number of members whose score changed.
+func (s *Storage) ZAdd(key string, flags ZAddFlags, members []ZMember) (added, updated int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zsetForWrite(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := s.reserve(zsetBytes(members)); err != nil {
+		return 0, 0, err
+	}
+	for _, m := range members {
+		if e != nil {
+			if cur, ok := e.ZSet.Score(m.Member); ok {
+				if flags.NX || (flags.GT && m.Score <= cur) || (flags.LT && m.Score >= cur) {
+					continue
+				}
+				if m.Score != cur {
+					e.ZSet.set(m.Member, m.Score)
+					updated++
+				}
+				continue
+			}
+		}
+		if flags.XX {
+			continue
+		}
+		e, _ = s.zsetSetLocked(key, e, m.Member, m.Score)
+		added++
+	}
+	s.serveReadyLocked()
+	return added, updated, nil
+}
+
+// ZAddIncr implements ZADD ... INCR and ZINCRBY. ok is false when the update
+// was skipped because of flags.
+func (s *Storage) ZAddIncr(key string, flags ZAddFlags, member string, incr float64) (score float64, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zsetForWrite(key)
+	if err != nil {
+		return 0, false, err
+	}
+	var cur float64
+	exists := false
+	if e != nil {
+		cur, exists = e.ZSet.Score(member)
+	}
+	if (exists && flags.NX) || (!exists && flags.XX) {
+		return 0, false, nil
+	}
+	score = cur + incr
+	if math.IsNaN(score) {
+		return 0, false, ErrScoreNaN
+	}
+	if exists && ((flags.GT && score <= cur) || (flags.LT && score >= cur)) {
+		return 0, false, nil
+	}
+	if !exists {
+		if err := s.reserve(int64(len(member) + zsetMemberOverhead)); err != nil {
+			return 0, false, err
+		}
+	}
+	s.zsetSetLocked(key, e, member, score)
+	s.serveReadyLocked()
+	return score, true, nil
+}
+
+// ZRem removes members and returns the number of removed members.
+func (s *Storage) ZRem(key string, members []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zsetForWrite(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	removed := 0
+	for _, m := range members {
+		if e.ZSet.Len() == 0 {
+			break
+		}
+		if s.zsetRemoveLocked(key, e, m) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// ZMScore returns the scores of members; found[i] reports whether members[i] exists.
+func (s *Storage) ZMScore(key string, members []string) (scores []float64, found []bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	scores = make([]float64, len(members))
+	found = make([]bool, len(members))
+	if e == nil {
+		return scores, found, nil
+	}
+	for i, m := range members {
+		scores[i], found[i] = e.ZSet.Score(m)
+	}
+	return scores, found, nil
+}
+
+// ZScore returns the score of member.
+func (s *Storage) ZScore(key, member string) (float64, bool, error) {
+	scores, found, err := s.ZMScore(key, []string{member})
+	if err != nil {
+		return 0, false, err
+	}
+	return scores[0], found[0], nil
+}
+
+// ZCard returns the number of members of the sorted set stored at key.
+func (s *Storage) ZCard(key string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.ZSet.Len(), nil
+}
+
+// ZRank returns the 0-based rank and score of member (descending when rev).
+func (s *Storage) ZRank(key, member string, rev bool) (rank int, score float64, ok bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil || e == nil {
+		return 0, 0, false, err
+	}
+	rank, ok = e.ZSet.Rank(member, rev)
+	score, _ = e.ZSet.Score(member)
+	return rank, score, ok, nil
+}
+
+// ZRange runs a unified ZRANGE query.
+func (s *Storage) ZRange(key string, spec ZRangeSpec) ([]ZMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil || e == nil {
+		return []ZMember{}, err
+	}
+	return e.ZSet.query(spec), nil
+}
+
+// ZRangeStore stores the result of a ZRANGE query on src into dst and
+// returns the number of stored members.
+func (s *Storage) ZRangeStore(dst, src string, spec ZRangeSpec) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zsetForWrite(src)
+	if err != nil {
+		return 0, err
+	}
+	var res []ZMember
+	if e != nil {
+		res = e.ZSet.query(spec)
+	}
+	return s.zsetStoreLocked(dst, res)
+}
+
+// zsetStoreLocked 用 members 覆盖 dst（为空时删除 dst）；调用方需持有写锁
+func (s *Storage) zsetStoreLocked(dst string, members []ZMember) (int, error) {
+	if err := s.reserve(zsetBytes(members) - s.liveSize(dst)); err != nil {
+		return 0, err
+	}
+	if old, ok := s.data[dst]; ok {
+		s.removeEntry(dst, old)
+	}
+	var e *Entry
+	for _, m := range members {
+		e, _ = s.zsetSetLocked(dst, e, m.Member, m.Score)
+	}
+	s.serveReadyLocked()
+	return len(members), nil
+}
+
+// ZCount returns the number of members with a score within r.
+func (s *Storage) ZCount(key string, r ScoreRange) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.ZSet.countBetween(e.ZSet.scoreBounds(r)), nil
+}
+
+// ZLexCount returns the number of members within the lexicographic range r.
+func (s *Storage) ZLexCount(key string, r LexRange) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, err := s.zsetForRead(key)
+	if err != nil || e == nil {
+		return 0, err
+	}
+	return e.ZSet.countBetween(e.ZSet.lexBounds(r)), nil
+}
+
+// zpopLocked 弹出至多 count 个最小（max 为 true 时最大）元素；调用方需持有写锁
+func (s *Storage) zpopLocked(key string, e *Entry, count int, max bool) []ZMember {
+	out := []ZMember{}
+	for ; count > 0 && e.ZSet.Len() > 0; count-- {
+		x := e.ZSet.zsl.header.level[0].forward
+		if max {
+			x = e.ZSet.zsl.tail
+		}
+		out = append(out, ZMember{Member: x.member, Score: x.score})
+		s.zsetRemoveLocked(key, e, x.member)
+	}
+	return out
+}
+
+// ZPop removes and returns up to count members with the lowest (or highest
+// when max) scores.
+func (s *Storage) ZPop(key string, count int, max bool) ([]ZMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := s.zsetForWrite(key)
+	if err != nil || e == nil {
+		return []ZMember{}, err
+	}
+	return s.zpopLocked(key, e, count, max), nil
+}
+
+// BlockingZPop pops one member from the first non-empty sorted set among
+// keys, blocking like BlockingPop.
+func (s *Storage) BlockingZPop(keys []string, max bool, timeout time.Duration, cancel <-chan struct{}) (key string, member ZMember, ok bool, err error) {
+	ok, err = s.blockOn(keys, timeout, cancel, func(k string) (bool, error) {
+		e, err := s.zsetForWrite(k)
+		if err != nil || e == nil {
+			return false, err
+		}
+		key, member = k, s.zpopLocked(k, e, 1, max)[0]
+		return true, nil
+	}, func() []string {
+		if max {
+			return []string{"ZPOPMAX", key}
+		}
+		return []string{"ZPOPMIN", key}
+	})
+	return key, member, ok, err
+}
+
+// Aggregate 表示 ZUNIONSTORE/ZINTERSTORE 的 AGGREGATE 选项
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+func aggregate(agg Aggregate, a, b float64) float64 {
+	switch agg {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
+	}
+	v := a + b
+	// +inf 与 -inf 相加时按 Redis 约定取 0
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// zsetInputLocked 读取运算输入：zset 原样返回，普通 set 的元素分值视为 1
+func (s *Storage) zsetInputLocked(key string) (map[string]float64, error) {
+	e := s.lookupRead(key)
+	if e == nil {
+		return nil, nil
+	}
+	switch e.Type {
+	case TypeZSet:
+		return e.ZSet.dict, nil
+	case TypeSet:
+		m := make(map[string]float64, e.Set.Len())
+		for _, member := range e.Set.Members() {
+			m[member] = 1
+		}
+		return m, nil
+	}
+	return nil, ErrWrongType
+}
+
+// ZSetOperationStore computes the union, intersection or difference of keys
+// (applying weights and agg for union/intersection), stores it in dst and
+// returns the resulting cardinality. weights may be nil.
+func (s *Storage) ZSetOperationStore(op SetOp, dst string, keys []string, weights []float64, agg Aggregate) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inputs := make([]map[string]float64, len(keys))
+	for i, k := range keys {
+		m, err := s.zsetInputLocked(k)
+		if err != nil {
+			return 0, err
+		}
+		inputs[i] = m
+	}
+	weight := func(i int) float64 {
+		if weights == nil {
+			return 1
+		}
+		return weights[i]
+	}
+	weighted := func(score float64, i int) float64 {
+		v := score * weight(i)
+		if math.IsNaN(v) {
+			return 0
+		}
+		return v
+	}
+	result := make(map[string]float64)
+	switch op {
+	case SetUnion:
+		for i, in := range inputs {
+			for m, sc := range in {
+				v := weighted(sc, i)
+				if cur, ok := result[m]; ok {
+					result[m] = aggregate(agg, cur, v)
+				} else {
+					result[m] = v
+				}
+			}
+		}
+	case SetInter:
+		if len(inputs) > 0 && inputs[0] != nil {
+		next:
+			for m, sc := range inputs[0] {
+				v := weighted(sc, 0)
+				for i := 1; i < len(inputs); i++ {
+					other, ok := inputs[i][m]
+					if !ok {
+						continue next
+					}
+					v = aggregate(agg, v, weighted(other, i))
+				}
+				result[m] = v
+			}
+		}
+	case SetDiff:
+		if len(inputs) > 0 {
+		skip:
+			for m, sc := range inputs[0] {
+				for _, in := range inputs[1:] {
+					if _, ok := in[m]; ok {
+						continue skip
+					}
+				}
+				result[m] = sc
+			}
+		}
+	}
+	members := make([]ZMember, 0, len(result))
+	for m, sc := range result {
+		members = append(members, ZMember{Member: m, Score: sc})
+	}
+	return s.zsetStoreLocked(dst, members)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func members(ms []ZMember) []string {
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = m.Member
+	}
+	return out
+}
+
+func TestSkiplistRankConsistency(t *testing.T) {
+	z := NewZSet()
+	for i := 0; i < 1000; i++ {
+		z.set("m"+strconv.Itoa(i), float64((i*7919)%1000))
+	}
+	// 更新一部分分值以覆盖删除+重新插入路径
+	for i := 0; i < 1000; i += 3 {
+		z.set("m"+strconv.Itoa(i), float64(i)+0.5)
+	}
+	prev := math.Inf(-1)
+	for r := 1; r <= z.Len(); r++ {
+		x := z.zsl.byRank(r)
+		if x == nil || x.score < prev {
+			t.Fatalf("skiplist out of order at rank %d", r)
+		}
+		if got := z.zsl.rank(x.score, x.member); got != r {
+			t.Fatalf("rank mismatch for %s: got %d want %d", x.member, got, r)
+		}
+		prev = x.score
+	}
+	for i := 0; i < 1000; i += 2 {
+		z.remove("m" + strconv.Itoa(i))
+	}
+	if z.Len() != 500 || z.zsl.length != 500 {
+		t.Fatalf("expected 500 members, got %d/%d", z.Len(), z.zsl.length)
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	s := NewStorage()
+	s.ZAdd("z", ZAddFlags{}, []ZMember{{"a", 1}, {"b", 2}})
+	if added, _, _ := s.ZAdd("z", ZAddFlags{XX: true}, []ZMember{{"c", 3}}); added != 0 || zcard(t, s, "z") != 2 {
+		t.Fatalf("XX must not add new members")
+	}
+	if _, updated, _ := s.ZAdd("z", ZAddFlags{GT: true}, []ZMember{{"a", 0}, {"b", 5}}); updated != 1 {
+		t.Fatalf("expected GT to update only b, got %d", updated)
+	}
+	if sc, ok, _ := s.ZAddIncr("z", ZAddFlags{NX: true}, "a", 1); ok {
+		t.Fatalf("expected NX INCR on existing member to be skipped, got %v", sc)
+	}
+	if sc, _, _ := s.ZAddIncr("z", ZAddFlags{}, "a", 2.5); sc != 3.5 {
+		t.Fatalf("expected 3.5, got %v", sc)
+	}
+	if _, _, err := s.ZAddIncr("inf", ZAddFlags{}, "x", math.Inf(1)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, _, err := s.ZAddIncr("inf", ZAddFlags{}, "x", math.Inf(-1)); err != ErrScoreNaN {
+		t.Fatalf("expected ErrScoreNaN, got %v", err)
+	}
+}
+
+func zcard(t *testing.T, s *Storage, key string) int {
+	n, err := s.ZCard(key)
+	if err != nil {
+		t.Fatalf("zcard: %v", err)
+	}
+	return n
+}
+
+func TestZRangeQueries(t *testing.T) {
+	s := NewStorage()
+	s.ZAdd("z", ZAddFlags{}, []ZMember{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}, {"e", 5}})
+	got, _ := s.ZRange("z", ZRangeSpec{Start: 1, Stop: -2, Count: -1})
+	if !reflect.DeepEqual(members(got), []string{"b", "c", "d"}) {
+		t.Fatalf("unexpected rank range %v", members(got))
+	}
+	got, _ = s.ZRange("z", ZRangeSpec{Start: 0, Stop: 1, Rev: true, Count: -1})
+	if !reflect.DeepEqual(members(got), []string{"e", "d"}) {
+		t.Fatalf("unexpected rev rank range %v", members(got))
+	}
+	spec := ZRangeSpec{By: ByScore, Score: ScoreRange{Min: 2, Max: 5, MaxEx: true}, Offset: 1, Count: 5}
+	got, _ = s.ZRange("z", spec)
+	if !reflect.DeepEqual(members(got), []string{"c", "d"}) {
+		t.Fatalf("unexpected score range %v", members(got))
+	}
+	spec.Rev = true
+	got, _ = s.ZRange("z", spec)
+	if !reflect.DeepEqual(members(got), []string{"c", "b"}) {
+		t.Fatalf("unexpected rev score range %v", members(got))
+	}
+	if n, _ := s.ZCount("z", ScoreRange{Min: math.Inf(-1), Max: 3}); n != 3 {
+		t.Fatalf("expected count 3, got %d", n)
+	}
+
+	s.ZAdd("lex", ZAddFlags{}, []ZMember{{"apple", 0}, {"banana", 0}, {"cherry", 0}})
+	lr := LexRange{Min: LexBound{Value: "b", Inclusive: true}, Max: LexBound{Inf: 1}}
+	got, _ = s.ZRange("lex", ZRangeSpec{By: ByLex, Lex: lr, Count: -1})
+	if !reflect.DeepEqual(members(got), []string{"banana", "cherry"}) {
+		t.Fatalf("unexpected lex range %v", members(got))
+	}
+	if n, _ := s.ZLexCount("lex", LexRange{Min: LexBound{Inf: -1}, Max: LexBound{Value: "banana"}}); n != 1 {
+		t.Fatalf("expected lexcount 1, got %d", n)
+	}
+}
+
+func TestZRankAndPop(t *testing.T) {
+	s := NewStorage()
+	s.ZAdd("z", ZAddFlags{}, []ZMember{{"a", 10}, {"b", 20}, {"c", 30}})
+	if r, sc, ok, _ := s.ZRank("z", "b", true); !ok || r != 1 || sc != 20 {
+		t.Fatalf("unexpected revrank %d %v %v", r, sc, ok)
+	}
+	got, _ := s.ZPop("z", 2, true)
+	if !reflect.DeepEqual(members(got), []string{"c", "b"}) {
+		t.Fatalf("unexpected zpopmax %v", members(got))
+	}
+	s.ZPop("z", 1, false)
+	if s.Exists("z") || s.MemoryUsage() != 0 {
+		t.Fatalf("expected zset removed with memory released, mem=%d", s.MemoryUsage())
+	}
+}
+
+func TestZSetOperationStore(t *testing.T) {
+	s := NewStorage()
+	s.ZAdd("a", ZAddFlags{}, []ZMember{{"x", 1}, {"y", 2}})
+	s.ZAdd("b", ZAddFlags{}, []ZMember{{"y", 10}, {"z", 20}})
+	s.SAdd("plain", []string{"y"})
+	if n, _ := s.ZSetOperationStore(SetUnion, "u", []string{"a", "b"}, []float64{2, 1}, AggregateSum); n != 3 {
+		t.Fatalf("expected 3 members, got %d", n)
+	}
+	if sc, _, _ := s.ZScore("u", "y"); sc != 14 {
+		t.Fatalf("expected weighted sum 14, got %v", sc)
+	}
+	if n, _ := s.ZSetOperationStore(SetInter, "i", []string{"a", "b", "plain"}, nil, AggregateMax); n != 1 {
+		t.Fatalf("expected 1 member, got %d", n)
+	}
+	if sc, _, _ := s.ZScore("i", "y"); sc != 10 {
+		t.Fatalf("expected max 10, got %v", sc)
+	}
+	if n, _ := s.ZSetOperationStore(SetDiff, "d", []string{"a", "b"}, nil, AggregateSum); n != 1 {
+		t.Fatalf("expected diff of 1, got %d", n)
+	}
+}
+
+func TestBlockingZPop(t *testing.T) {
+	s := NewStorage()
+	done := make(chan ZMember, 1)
+	go func() {
+		_, m, ok, _ := s.BlockingZPop([]string{"z"}, false, time.Second, nil)
+		if ok {
+			done <- m
+		}
+	}()
+	waitBlocked(t, s, 1)
+	s.ZAdd("z", ZAddFlags{}, []ZMember{{"b", 2}, {"a", 1}})
+	select {
+	case m := <-done:
+		if m.Member != "a" {
+			t.Fatalf("expected lowest member a, got %s", m.Member)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("BZPOPMIN was not woken by ZADD")
+	}
+}